@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nebula/nebula/internal/password"
+)
+
+// runHashPassword handles nebula hash-password: it reads a password from
+// standard input and prints its hash, to be used as auth.password
+func runHashPassword(args []string) error {
+	fs := flag.NewFlagSet("hash-password", flag.ExitOnError)
+	algorithm := fs.String("algorithm", password.Argon2id, "hash algorithm, argon2id or bcrypt")
+	fs.Parse(args)
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return fmt.Errorf("failed to read the password: %w", err)
+	}
+	plain := strings.TrimRight(line, "\r\n")
+	if plain == "" {
+		return fmt.Errorf("empty password")
+	}
+
+	hash, err := password.Hash(plain, *algorithm)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hash)
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nebula/nebula/internal/config"
+)
+
+// unitTemplate is the systemd unit written by --systemd-unit
+const unitTemplate = `[Unit]
+Description=Nebula system administration panel
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+Type=simple
+ExecStart=%s
+WorkingDirectory=%s
+Environment=NEBULA_CONFIG=%s
+ExecReload=/bin/kill -HUP $MAINPID
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+
+// initConfig writes a default config to configPath and, when unitPath is set,
+// a systemd unit running this binary with that config. Existing files are only
+// replaced with force.
+func initConfig(configPath, unitPath string, force bool) error {
+	configPath, err := filepath.Abs(configPath)
+	if err != nil {
+		return err
+	}
+
+	if err := createFile(configPath, 0600, force, func(f *os.File) error {
+		return config.WriteDefault(f, nil)
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Default configuration written to %s\n", configPath)
+
+	if unitPath == "" {
+		return nil
+	}
+
+	binary, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the nebula binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(binary); err == nil {
+		binary = resolved
+	}
+
+	if err := createFile(unitPath, 0644, force, func(f *os.File) error {
+		_, err := fmt.Fprintf(f, unitTemplate, binary, filepath.Dir(configPath), configPath)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Systemd unit written to %s\n", unitPath)
+	return nil
+}
+
+// createFile creates path, refusing to overwrite it unless force is set, and fills it with write
+func createFile(path string, perm os.FileMode, force bool, write func(*os.File) error) error {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if !force {
+		flags |= os.O_EXCL
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path, flags, perm)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists, use --force to overwrite it", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
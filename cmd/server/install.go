@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nebula/nebula/internal/auth"
+	"github.com/nebula/nebula/internal/config"
+)
+
+// serviceName is the name Nebula is registered under with the service manager
+const serviceName = "nebula"
+
+// installOptions are the settings of nebula install and nebula uninstall
+type installOptions struct {
+	// Binary is the absolute path of this executable
+	Binary     string
+	ConfigDir  string
+	DataDir    string
+	ConfigPath string
+	// NoStart registers the service without starting it
+	NoStart bool
+	// Force overwrites an existing config file and service definition
+	Force bool
+	// Purge removes the config and data directories on uninstall
+	Purge bool
+}
+
+// runInstall handles nebula install: it creates the config and data
+// directories, writes a default config unless one exists, and registers
+// Nebula with the service manager of the OS
+func runInstall(args []string) error {
+	opts, err := parseInstallFlags("install", args)
+	if err != nil {
+		return err
+	}
+	if err := auth.RequireRoot(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(opts.ConfigDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", opts.ConfigDir, err)
+	}
+	// The database holds sessions and credentials, readable by root only
+	if err := os.MkdirAll(opts.DataDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", opts.DataDir, err)
+	}
+	if err := os.Chmod(opts.DataDir, 0700); err != nil {
+		return err
+	}
+
+	_, statErr := os.Stat(opts.ConfigPath)
+	if opts.Force || os.IsNotExist(statErr) {
+		overrides := map[string]interface{}{
+			"storage.path": filepath.Join(opts.DataDir, "nebula.db"),
+		}
+		if err := createFile(opts.ConfigPath, 0600, true, func(f *os.File) error {
+			return config.WriteDefault(f, overrides)
+		}); err != nil {
+			return err
+		}
+		fmt.Printf("Default configuration written to %s, change auth.password before exposing the panel\n", opts.ConfigPath)
+	} else {
+		fmt.Printf("Keeping the existing configuration %s\n", opts.ConfigPath)
+	}
+
+	if err := installService(opts); err != nil {
+		return err
+	}
+	if opts.NoStart {
+		fmt.Println("Nebula is installed and starts at boot")
+	} else {
+		fmt.Println("Nebula is installed and running")
+	}
+	return nil
+}
+
+// runUninstall handles nebula uninstall: it stops Nebula and removes its
+// service definition, and with --purge its config and data
+func runUninstall(args []string) error {
+	opts, err := parseInstallFlags("uninstall", args)
+	if err != nil {
+		return err
+	}
+	if err := auth.RequireRoot(); err != nil {
+		return err
+	}
+
+	if err := uninstallService(opts); err != nil {
+		return err
+	}
+	fmt.Println("Nebula service removed")
+
+	if !opts.Purge {
+		fmt.Printf("Configuration in %s and data in %s were kept, use --purge to remove them\n", opts.ConfigDir, opts.DataDir)
+		return nil
+	}
+	for _, dir := range []string{opts.ConfigDir, opts.DataDir} {
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+		fmt.Printf("Removed %s\n", dir)
+	}
+	return nil
+}
+
+// parseInstallFlags parses the flags of the install and uninstall commands
+func parseInstallFlags(command string, args []string) (installOptions, error) {
+	configDir, dataDir := defaultInstallDirs()
+
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	fs.StringVar(&configDir, "config-dir", configDir, "directory of the configuration file")
+	fs.StringVar(&dataDir, "data-dir", dataDir, "directory of the database")
+	var opts installOptions
+	if command == "install" {
+		fs.BoolVar(&opts.NoStart, "no-start", false, "enable the service without starting it")
+		fs.BoolVar(&opts.Force, "force", false, "overwrite an existing configuration and service definition")
+	} else {
+		fs.BoolVar(&opts.Purge, "purge", false, "also remove the configuration and data directories")
+	}
+	if err := fs.Parse(args); err != nil {
+		return opts, err
+	}
+	if fs.NArg() > 0 {
+		return opts, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	var err error
+	if opts.ConfigDir, err = filepath.Abs(configDir); err != nil {
+		return opts, err
+	}
+	if opts.DataDir, err = filepath.Abs(dataDir); err != nil {
+		return opts, err
+	}
+	opts.ConfigPath = filepath.Join(opts.ConfigDir, "config.yaml")
+
+	if opts.Binary, err = os.Executable(); err != nil {
+		return opts, fmt.Errorf("failed to locate the nebula binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(opts.Binary); err == nil {
+		opts.Binary = resolved
+	}
+	return opts, nil
+}
@@ -0,0 +1,100 @@
+//go:build darwin
+
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// launchdLabel is the label of the launchd daemon
+const launchdLabel = "com.nebula.server"
+
+// plistPath is where the launchd daemon is installed
+const plistPath = "/Library/LaunchDaemons/" + launchdLabel + ".plist"
+
+// logPath is where launchd writes the output of the daemon
+const logPath = "/var/log/nebula.log"
+
+// plistTemplate is the launchd daemon written by nebula install
+const plistTemplate = `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>%s</string>
+	<key>ProgramArguments</key>
+	<array>
+		<string>%s</string>
+		<string>--config</string>
+		<string>%s</string>
+	</array>
+	<key>WorkingDirectory</key>
+	<string>%s</string>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+	<key>StandardOutPath</key>
+	<string>%s</string>
+	<key>StandardErrorPath</key>
+	<string>%s</string>
+</dict>
+</plist>
+`
+
+// defaultInstallDirs returns the config and data directories of an
+// installed server
+func defaultInstallDirs() (string, string) {
+	return "/usr/local/etc/nebula", "/usr/local/var/nebula"
+}
+
+// installService writes a launchd daemon running Nebula at boot and loads
+// it unless NoStart is set
+func installService(opts installOptions) error {
+	if err := createFile(plistPath, 0644, opts.Force, func(f *os.File) error {
+		_, err := fmt.Fprintf(f, plistTemplate, launchdLabel, escapeXML(opts.Binary), escapeXML(opts.ConfigPath),
+			escapeXML(opts.DataDir), logPath, logPath)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Launchd daemon written to %s\n", plistPath)
+
+	if opts.NoStart {
+		return nil
+	}
+	return launchctl("load", "-w", plistPath)
+}
+
+// uninstallService unloads the launchd daemon and removes it
+func uninstallService(opts installOptions) error {
+	if _, err := os.Stat(plistPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s not found, Nebula is not installed as a service", plistPath)
+	}
+
+	// Not loaded when installed with --no-start and never started
+	if err := launchctl("unload", "-w", plistPath); err != nil {
+		fmt.Println(err)
+	}
+	return os.Remove(plistPath)
+}
+
+// launchctl runs launchctl with args
+func launchctl(args ...string) error {
+	out, err := exec.Command("launchctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// escapeXML escapes s for a plist string
+func escapeXML(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,66 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// unitDir is where the systemd unit is installed
+const unitDir = "/etc/systemd/system"
+
+// defaultInstallDirs returns the config and data directories of an
+// installed server
+func defaultInstallDirs() (string, string) {
+	return "/etc/nebula", "/var/lib/nebula"
+}
+
+// installService writes a systemd unit running Nebula, then enables and
+// starts it
+func installService(opts installOptions) error {
+	unitPath := filepath.Join(unitDir, serviceName+".service")
+	if err := createFile(unitPath, 0644, opts.Force, func(f *os.File) error {
+		_, err := fmt.Fprintf(f, unitTemplate, opts.Binary, opts.DataDir, opts.ConfigPath)
+		return err
+	}); err != nil {
+		return err
+	}
+	fmt.Printf("Systemd unit written to %s\n", unitPath)
+
+	if err := systemctl("daemon-reload"); err != nil {
+		return err
+	}
+	if opts.NoStart {
+		return systemctl("enable", serviceName)
+	}
+	return systemctl("enable", "--now", serviceName)
+}
+
+// uninstallService stops and disables Nebula and removes its unit
+func uninstallService(opts installOptions) error {
+	unitPath := filepath.Join(unitDir, serviceName+".service")
+	if _, err := os.Stat(unitPath); os.IsNotExist(err) {
+		return fmt.Errorf("%s not found, Nebula is not installed as a service", unitPath)
+	}
+
+	if err := systemctl("disable", "--now", serviceName); err != nil {
+		return err
+	}
+	if err := os.Remove(unitPath); err != nil {
+		return err
+	}
+	return systemctl("daemon-reload")
+}
+
+// systemctl runs systemctl with args
+func systemctl(args ...string) error {
+	out, err := exec.Command("systemctl", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
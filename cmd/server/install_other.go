@@ -0,0 +1,24 @@
+//go:build !linux && !darwin && !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// defaultInstallDirs returns the config and data directories of an
+// installed server
+func defaultInstallDirs() (string, string) {
+	return "/usr/local/etc/nebula", "/var/db/nebula"
+}
+
+// installService reports that no service manager is supported here
+func installService(opts installOptions) error {
+	return fmt.Errorf("nebula install is not supported on %s, start the binary with your init system", runtime.GOOS)
+}
+
+// uninstallService reports that no service manager is supported here
+func uninstallService(opts installOptions) error {
+	return fmt.Errorf("nebula uninstall is not supported on %s", runtime.GOOS)
+}
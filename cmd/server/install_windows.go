@@ -0,0 +1,109 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// stopTimeout is how long uninstall waits for the service to stop
+const stopTimeout = 30 * time.Second
+
+// defaultInstallDirs returns the config and data directories of an
+// installed server
+func defaultInstallDirs() (string, string) {
+	programData := os.Getenv("ProgramData")
+	if programData == "" {
+		programData = `C:\ProgramData`
+	}
+	return filepath.Join(programData, "Nebula"), filepath.Join(programData, "Nebula", "data")
+}
+
+// installService registers Nebula with the service control manager,
+// starting at boot, and starts it unless NoStart is set. Services start in
+// the system directory, so the data directory is passed with --data-dir.
+func installService(opts installOptions) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	cfg := mgr.Config{
+		DisplayName: "Nebula",
+		Description: "Nebula system administration panel",
+		StartType:   mgr.StartAutomatic,
+	}
+
+	s, err := m.OpenService(serviceName)
+	switch {
+	case err != nil:
+		s, err = m.CreateService(serviceName, opts.Binary, cfg, "--config", opts.ConfigPath, "--data-dir", opts.DataDir)
+		if err != nil {
+			return fmt.Errorf("failed to create the service: %w", err)
+		}
+	case !opts.Force:
+		s.Close()
+		return fmt.Errorf("service %s already exists, use --force to overwrite it", serviceName)
+	default:
+		cfg.BinaryPathName = syscall.EscapeArg(opts.Binary) +
+			" --config " + syscall.EscapeArg(opts.ConfigPath) +
+			" --data-dir " + syscall.EscapeArg(opts.DataDir)
+		if err := s.UpdateConfig(cfg); err != nil {
+			s.Close()
+			return fmt.Errorf("failed to update the service: %w", err)
+		}
+	}
+	defer s.Close()
+	fmt.Printf("Windows service %s registered\n", serviceName)
+
+	if opts.NoStart {
+		return nil
+	}
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("failed to start the service: %w", err)
+	}
+	return nil
+}
+
+// uninstallService stops Nebula and removes its service registration
+func uninstallService(opts installOptions) error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("failed to connect to the service manager: %w", err)
+	}
+	defer m.Disconnect()
+
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("service %s not found, Nebula is not installed as a service", serviceName)
+	}
+	defer s.Close()
+
+	if status, err := s.Query(); err == nil && status.State != svc.Stopped {
+		if _, err := s.Control(svc.Stop); err != nil {
+			return fmt.Errorf("failed to stop the service: %w", err)
+		}
+		for deadline := time.Now().Add(stopTimeout); status.State != svc.Stopped; {
+			if time.Now().After(deadline) {
+				return fmt.Errorf("service %s did not stop within %s", serviceName, stopTimeout)
+			}
+			time.Sleep(300 * time.Millisecond)
+			if status, err = s.Query(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("failed to remove the service: %w", err)
+	}
+	return nil
+}
@@ -2,32 +2,89 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/nebula/nebula/internal/api"
 	"github.com/nebula/nebula/internal/auth"
+	"github.com/nebula/nebula/internal/certs"
+	"github.com/nebula/nebula/internal/cluster"
 	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/containers"
+	"github.com/nebula/nebula/internal/events"
 	"github.com/nebula/nebula/internal/files"
+	"github.com/nebula/nebula/internal/lockout"
+	"github.com/nebula/nebula/internal/logging"
 	"github.com/nebula/nebula/internal/metrics"
+	"github.com/nebula/nebula/internal/mounts"
+	"github.com/nebula/nebula/internal/notify"
 	"github.com/nebula/nebula/internal/packages"
+	"github.com/nebula/nebula/internal/power"
 	"github.com/nebula/nebula/internal/process"
+	"github.com/nebula/nebula/internal/ratelimit"
+	"github.com/nebula/nebula/internal/scheduler"
 	"github.com/nebula/nebula/internal/service"
 	"github.com/nebula/nebula/internal/storage"
 	"github.com/nebula/nebula/internal/terminal"
 	"github.com/nebula/nebula/internal/updater"
+	"github.com/nebula/nebula/internal/websocket"
 	"github.com/nebula/nebula/web"
 )
 
-// @title Nebula API
-// @version 1.0
-// @description System Administration Panel API
-// @host localhost:8080
-// @BasePath /api/v1
+// serviceWatchInterval is how often services are checked for failures
+const serviceWatchInterval = time.Minute
+
 func main() {
+	// nebula install and nebula uninstall manage the OS service,
+	// nebula hash-password hashes auth.password
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "install":
+			if err := runInstall(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to install Nebula: %v", err)
+			}
+			return
+		case "uninstall":
+			if err := runUninstall(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to uninstall Nebula: %v", err)
+			}
+			return
+		case "hash-password":
+			if err := runHashPassword(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to hash the password: %v", err)
+			}
+			return
+		}
+	}
+
+	configPath := flag.String("config", envOr("NEBULA_CONFIG", "config.yaml"), "path of the config file")
+	dataDir := flag.String("data-dir", "", "directory relative paths such as the database are resolved in, the working directory by default")
+	keyFile := flag.String("key-file", envOr("NEBULA_KEY_FILE", "nebula.key"), "file holding the secret stored credentials are encrypted with, generated on first run")
+	initPath := flag.String("init-config", "", "write a default config file to this path and exit")
+	unitPath := flag.String("systemd-unit", "", "with --init-config, also write a systemd unit to this path")
+	force := flag.Bool("force", false, "with --init-config, overwrite existing files")
+	profile := flag.String("profile", os.Getenv("NEBULA_PROFILE"), "config profile overlay to apply, e.g. dev or prod")
+	flag.Parse()
+
+	if *initPath != "" {
+		if err := initConfig(*initPath, *unitPath, *force); err != nil {
+			log.Fatalf("Failed to initialize configuration: %v", err)
+		}
+		return
+	}
+
+	if *dataDir != "" {
+		if err := os.Chdir(*dataDir); err != nil {
+			log.Fatalf("Failed to enter data directory: %v", err)
+		}
+	}
+
 	log.Println("Starting Nebula...")
 
 	// Check for root/admin privileges (skip with NEBULA_NO_ROOT=1 for development)
@@ -40,14 +97,16 @@ func main() {
 		log.Println("WARNING: Running without root check (development mode)")
 	}
 
-	// Load configuration
-	configPath := "config.yaml"
-	if envPath := os.Getenv("NEBULA_CONFIG"); envPath != "" {
-		configPath = envPath
+	// Restore the database from a backup before opening it
+	if restorePath := os.Getenv("NEBULA_RESTORE"); restorePath != "" {
+		if err := storage.Restore(restorePath, "nebula.db"); err != nil {
+			log.Fatalf("Failed to restore database from %s: %v", restorePath, err)
+		}
+		log.Printf("Database restored from %s", restorePath)
 	}
 
 	// Initialize storage first (needed for config)
-	store, err := storage.New("nebula.db")
+	store, err := storage.Open("nebula.db")
 	if err != nil {
 		log.Printf("Warning: Failed to initialize storage: %v", err)
 		// Continue without storage
@@ -57,25 +116,40 @@ func main() {
 	}
 
 	// Initialize privilege manager
-	privilegeManager := auth.NewPrivilegeManager(store)
+	privilegeManager, err := auth.NewPrivilegeManager(store, *keyFile)
+	if err != nil {
+		log.Fatalf("Failed to load the credential encryption key: %v", err)
+	}
 	if privilegeManager.HasCredentials() {
 		log.Println("Stored credentials found")
 	}
 
 	// Load configuration
-	cfg, err := config.NewManager(configPath, store)
+	cfg, err := config.NewManager(*configPath, *profile, store)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
 	appConfig := cfg.Get()
-	log.Printf("Configuration loaded from %s", configPath)
+	if err := logging.Setup(appConfig.Logging.Level, appConfig.Logging.Format); err != nil {
+		log.Fatalf("Failed to configure logging: %v", err)
+	}
+	privilegeManager.SetCredentialTTL(appConfig.Auth.CredentialsTTL)
+	privilegeManager.SetEscalation(appConfig.Auth.Escalation)
+	privilegeManager.SetSudoMode(appConfig.Auth.SudoMode)
+	privilegeManager.SetElevationTTL(appConfig.Auth.ElevationTTL)
+	if cfg.Profile() != "" {
+		log.Printf("Configuration loaded from %s with profile %s", *configPath, cfg.Profile())
+	} else {
+		log.Printf("Configuration loaded from %s", *configPath)
+	}
 
 	// Initialize metrics collector
 	metricsCollector := metrics.NewCollector(
 		store,
 		appConfig.Metrics.Interval,
 		appConfig.Metrics.HistorySize,
+		appConfig.Metrics.TopProcesses,
 	)
 
 	// Initialize process manager
@@ -94,6 +168,14 @@ func main() {
 		appConfig.Files.MaxUploadSize,
 		appConfig.Files.AllowedExtensions,
 	)
+	filesManager.ConfigureUploads(appConfig.Files.UploadDir, appConfig.Files.UploadExpiry)
+	filesManager.SetQuota(0, appConfig.Files.MinFreeSpace)
+	fileRoots := files.NewRoots(filesManager)
+	fileRoots.Configure(roots(appConfig.Files.Roots))
+	fileRemotes := files.NewRemotes()
+	if err := fileRemotes.Configure(remotes(appConfig.Files.Remotes), appConfig.Files.MaxUploadSize, appConfig.Files.AllowedExtensions); err != nil {
+		log.Printf("Warning: Remote hosts not available: %v", err)
+	}
 
 	// Initialize package manager
 	packagesManager, err := packages.DetectManager()
@@ -101,18 +183,144 @@ func main() {
 		log.Printf("Warning: Package manager not available: %v", err)
 	}
 
+	// Connect to Docker or Podman when installed
+	containersManager, err := containers.NewManager(appConfig.Containers.Host)
+	if err != nil {
+		log.Printf("Container management disabled: %v", err)
+	} else {
+		log.Printf("Managing %s containers through %s", containersManager.Runtime(), containersManager.Endpoint())
+	}
+
+	// Keep an inventory of the TLS certificates on the host
+	certInventory := certs.NewInventory(certSettings(appConfig))
+
+	// Run recurring tasks defined through the API
+	taskScheduler, err := scheduler.NewScheduler(store, schedulerSettings(appConfig))
+	if err != nil {
+		log.Fatalf("Failed to initialize task scheduler: %v", err)
+	}
+	registerTaskActions(taskScheduler, appConfig, store, serviceManager, packagesManager)
+
 	// Initialize terminal manager
 	terminalManager := terminal.NewManager(
 		appConfig.Terminal.MaxSessions,
 		appConfig.Terminal.AllowedShells,
 		appConfig.Terminal.DefaultShell,
+		terminalPolicy(appConfig),
+		store,
 	)
 
 	// Initialize updater
-	upd := updater.NewUpdater(
-		appConfig.Updater.Enabled,
-		appConfig.Updater.CheckInterval,
-	)
+	upd := updater.NewUpdater(updaterSettings(appConfig))
+	if store != nil {
+		// Don't lose queued metrics when an update or rollback restarts the process
+		upd.BeforeRestart(func() {
+			if err := store.FlushMetrics(); err != nil {
+				log.Printf("Failed to flush metrics before restart: %v", err)
+			}
+		})
+	}
+
+	// Compress WebSocket messages for clients that support it
+	websocket.SetCompression(appConfig.WebSocket.Compression, appConfig.WebSocket.CompressionLevel)
+	websocket.SetAllowedOrigins(appConfig.WebSocket.AllowedOrigins)
+	websocket.SetTrustedProxies(appConfig.Server.TrustedProxies)
+
+	// Subsystems publish their events on the bus, which fans them out to
+	// WebSocket clients and webhooks
+	bus := events.NewBus()
+	defer bus.Close()
+
+	// Publish update progress
+	upd.OnStatus(func(status updater.Status) {
+		bus.Publish(events.TopicUpdate, "update.status", status)
+		// Results get their own events so notifications can be routed for them
+		if status.Phase == updater.PhaseDone || status.Phase == updater.PhaseFailed {
+			bus.Publish(events.TopicUpdate, "update."+status.Phase, status)
+		}
+	})
+
+	// Alert on certificates that are about to expire
+	certInventory.OnAlert(func(cert certs.Certificate) {
+		bus.Publish(events.TopicAlerts, "certificate."+cert.Status, cert)
+	})
+	certInventory.OnResolve(func(cert certs.Certificate) {
+		bus.Publish(events.TopicAlerts, "certificate.resolved", cert)
+	})
+
+	// Announce new releases once per version
+	upd.OnAvailable(func(info updater.UpdateInfo) {
+		bus.Publish(events.TopicUpdate, "update.available", info)
+	})
+
+	// Report privileged commands that failed, e.g. for expired credentials
+	privilegeManager.OnFailure(func(failure auth.PrivilegeFailure) {
+		bus.Publish(events.TopicSecurity, "privilege.failed", failure)
+	})
+
+	// Apply reloaded settings to the running managers
+	cfg.OnReload(func(c *config.Config) {
+		if err := logging.Setup(c.Logging.Level, c.Logging.Format); err != nil {
+			log.Printf("Failed to configure logging: %v", err)
+		}
+		metricsCollector.Configure(c.Metrics.Interval, c.Metrics.HistorySize, c.Metrics.TopProcesses)
+		privilegeManager.SetCredentialTTL(c.Auth.CredentialsTTL)
+		privilegeManager.SetEscalation(c.Auth.Escalation)
+		privilegeManager.SetSudoMode(c.Auth.SudoMode)
+		privilegeManager.SetElevationTTL(c.Auth.ElevationTTL)
+		filesManager.Configure(c.Files.RootPath, c.Files.MaxUploadSize, c.Files.AllowedExtensions)
+		filesManager.ConfigureUploads(c.Files.UploadDir, c.Files.UploadExpiry)
+		filesManager.SetQuota(0, c.Files.MinFreeSpace)
+		fileRoots.Configure(roots(c.Files.Roots))
+		if err := fileRemotes.Configure(remotes(c.Files.Remotes), c.Files.MaxUploadSize, c.Files.AllowedExtensions); err != nil {
+			log.Printf("Warning: Remote hosts not available: %v", err)
+		}
+		terminalManager.Reconfigure(
+			c.Terminal.MaxSessions,
+			c.Terminal.AllowedShells,
+			c.Terminal.DefaultShell,
+			terminalPolicy(c),
+		)
+		upd.Configure(updaterSettings(c))
+		certInventory.Configure(certSettings(c))
+		taskScheduler.Configure(schedulerSettings(c))
+		websocket.SetCompression(c.WebSocket.Compression, c.WebSocket.CompressionLevel)
+		websocket.SetAllowedOrigins(c.WebSocket.AllowedOrigins)
+		log.Println("Configuration applied to running services")
+	})
+
+	// Limit the API request rate of each client
+	limiter := ratelimit.NewLimiter(rateLimitSettings(appConfig))
+	cfg.OnReload(func(c *config.Config) {
+		limiter.Configure(rateLimitSettings(c))
+	})
+
+	// Lock out clients repeatedly failing to log in
+	guard := lockout.NewGuard(store, lockoutSettings(appConfig))
+	cfg.OnReload(func(c *config.Config) {
+		guard.Configure(lockoutSettings(c))
+	})
+
+	// Route events to email, chat and HTTP notification channels
+	notifyManager, err := notify.NewManager(store)
+	if err != nil {
+		log.Fatalf("Failed to initialize notifications: %v", err)
+	}
+	if err := notifyManager.Configure(emailNotifications(appConfig.Notify.Email)); err != nil {
+		log.Printf("Email notifications disabled: %v", err)
+	}
+	cfg.OnReload(func(c *config.Config) {
+		if err := notifyManager.Configure(emailNotifications(c.Notify.Email)); err != nil {
+			log.Printf("Email notifications not updated: %v", err)
+		}
+	})
+
+	// A controller keeps the agents registering with it and proxies to them
+	var registry *cluster.Registry
+	if appConfig.Cluster.Mode == cluster.ModeController {
+		registry = cluster.NewRegistry(appConfig.Cluster.Token, appConfig.Cluster.HostTimeout)
+		log.Println("Running as cluster controller")
+	}
 
 	// Create router
 	router := api.NewRouter(
@@ -122,64 +330,190 @@ func main() {
 		processManager,
 		serviceManager,
 		filesManager,
+		fileRoots,
+		fileRemotes,
 		packagesManager,
+		containersManager,
+		certInventory,
 		terminalManager,
 		upd,
+		power.NewManager(),
+		mounts.NewManager(privilegeManager),
+		notifyManager,
+		taskScheduler,
 		privilegeManager,
+		limiter,
+		guard,
+		bus,
+		registry,
 	)
 
-	// Register static files
-	web.RegisterStaticRoutes(router.Engine())
+	// Queue messages for slow WebSocket clients as configured
+	router.Hub().SetClientPolicy(clientPolicy(appConfig))
+	cfg.OnReload(func(c *config.Config) {
+		router.Hub().SetClientPolicy(clientPolicy(c))
+	})
 
-	// Start WebSocket hub
-	router.StartWebSocketHub()
+	// Register static files
+	web.RegisterStaticRoutes(router.Engine(), appConfig.Server.BasePath)
 
-	// Start metrics collector in background
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+
+	// Start WebSocket hub, stopped before the HTTP server on shutdown
+	hubCtx, stopHub := context.WithCancel(ctx)
+	defer stopHub()
+	router.StartWebSocketHub(hubCtx)
+
+	// Batch metrics writes so the database isn't synced on every sample
+	if store != nil && appConfig.Storage.MetricsFlushInterval > 0 {
+		go store.StartMetricsBatching(ctx, appConfig.Storage.MetricsFlushInterval, appConfig.Storage.MetricsBatchSize)
+	}
+
+	// Average the metrics history into longer kept rollups
+	if store != nil {
+		go store.StartMetricsRollups(ctx)
+	}
+
+	// Start metrics collector in background
 	go metricsCollector.Start(ctx)
 
-	// Broadcast metrics to WebSocket clients
+	// Enforce metrics and audit log retention
+	if store != nil && appConfig.Storage.RetentionInterval > 0 {
+		go store.StartRetention(ctx, appConfig.Storage.RetentionInterval, []storage.RetentionPolicy{
+			{Bucket: storage.BucketMetricsHistory, MaxAge: appConfig.Storage.MetricsRetention},
+			{Bucket: storage.BucketMetrics1m, MaxAge: appConfig.Storage.Metrics1mRetention},
+			{Bucket: storage.BucketMetrics5m, MaxAge: appConfig.Storage.Metrics5mRetention},
+			{Bucket: storage.BucketAuditLog, MaxAge: appConfig.Storage.AuditRetention},
+			{Bucket: storage.BucketTaskRuns, MaxAge: appConfig.Scheduler.HistoryRetention},
+			{Bucket: storage.BucketNotifyDeliveries, MaxAge: appConfig.Notify.HistoryRetention},
+		})
+	}
+
+	// Periodic integrity checks of the database
+	if store != nil && appConfig.Storage.HealthCheckInterval > 0 {
+		go store.StartHealthChecks(ctx, appConfig.Storage.HealthCheckInterval)
+	}
+
+	// Scheduled database backups
+	if store != nil && appConfig.Storage.BackupDir != "" && appConfig.Storage.BackupInterval > 0 {
+		go store.StartBackups(ctx, appConfig.Storage.BackupDir, appConfig.Storage.BackupInterval, appConfig.Storage.BackupKeep)
+		log.Printf("Database backups enabled every %s to %s", appConfig.Storage.BackupInterval, appConfig.Storage.BackupDir)
+	}
+
+	// Scan for TLS certificates
+	go certInventory.Start(ctx, appConfig.Certificates.ScanInterval)
+
+	// Check for updates and apply them in the maintenance window
+	go upd.Start(ctx, store)
+
+	// Publish metrics samples
 	go func() {
 		sub := metricsCollector.Subscribe()
 		defer metricsCollector.Unsubscribe(sub)
 		for m := range sub {
-			router.BroadcastMetrics(m)
+			bus.Publish(events.TopicMetrics, "metrics.sample", m)
 		}
 	}()
 
+	// Run scheduled tasks
+	if appConfig.Scheduler.Enabled {
+		go taskScheduler.Start(ctx)
+	}
+
+	// Send notifications for the events matching the routing rules
+	notifyManager.Start(ctx, bus)
+
+	// Report databases found corrupted and re-initialized, also when opened
+	if store != nil {
+		store.OnRecovered(func(status storage.HealthStatus) {
+			bus.Publish(events.TopicSystem, "storage.recovered", status)
+		})
+	}
+
+	// Report services entering and leaving the failed state
+	if serviceManager != nil {
+		go service.Watch(ctx, serviceManager, serviceWatchInterval, func(svc service.ServiceInfo) {
+			bus.Publish(events.TopicServices, "service.failed", svc)
+		}, func(svc service.ServiceInfo) {
+			bus.Publish(events.TopicServices, "service.recovered", svc)
+		})
+	}
+
+	// Deliver events to webhooks
+	if hooks := appConfig.Events.Webhooks; len(hooks) > 0 {
+		events.StartWebhooks(ctx, bus, webhooks(hooks))
+		log.Printf("Delivering events to %d webhooks", len(hooks))
+	}
+
+	// Register with the controller when running as an agent
+	if appConfig.Cluster.Mode == cluster.ModeAgent {
+		go cluster.NewAgent(agentSettings(appConfig)).Run(ctx)
+	}
+
+	// Serve HTTPS directly when server.tls is enabled
+	tlsConfig, httpHandler, err := serverTLS(appConfig)
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+
 	// Create HTTP server
 	server := &http.Server{
 		Addr:         appConfig.Address(),
-		Handler:      router.Engine(),
+		Handler:      router.Handler(),
 		ReadTimeout:  appConfig.Server.ReadTimeout,
 		WriteTimeout: appConfig.Server.WriteTimeout,
+		TLSConfig:    tlsConfig,
 	}
 
 	// Start server in goroutine
 	go func() {
-		log.Printf("Server starting on http://%s", appConfig.Address())
-		log.Printf("Swagger UI: http://%s/swagger/index.html", appConfig.Address())
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Printf("Server starting on %s", appConfig.URL())
+		log.Printf("OpenAPI: %s/openapi.json, Swagger UI: %s/swagger/index.html", appConfig.URL(), appConfig.URL())
+		var err error
+		if tlsConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("Server error: %v", err)
 		}
 	}()
 
+	// Redirect plain HTTP to HTTPS and answer ACME challenges
+	var redirectServer *http.Server
+	if httpHandler != nil && appConfig.Server.TLS.HTTPPort > 0 {
+		redirectServer = &http.Server{
+			Addr:        fmt.Sprintf("%s:%d", appConfig.Server.Host, appConfig.Server.TLS.HTTPPort),
+			Handler:     httpHandler,
+			ReadTimeout: appConfig.Server.ReadTimeout,
+		}
+		go func() {
+			log.Printf("Redirecting http://%s to HTTPS", redirectServer.Addr)
+			if err := redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Fatalf("HTTP redirect server error: %v", err)
+			}
+		}()
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	notifyServiceStop(quit)
 
-	sig := <-quit
-	log.Printf("Received signal: %v", sig)
+	for {
+		sig := <-quit
+		log.Printf("Received signal: %v", sig)
+		if sig != syscall.SIGHUP {
+			break
+		}
 
-	// Handle SIGHUP for config reload
-	if sig == syscall.SIGHUP {
+		// Handle SIGHUP for config reload and keep running
 		log.Println("Reloading configuration...")
-		if err := cfg.Reload(); err != nil {
+		if err := cfg.Reload("system"); err != nil {
 			log.Printf("Failed to reload config: %v", err)
 		}
-		// Continue running
-		<-quit
 	}
 
 	// Graceful shutdown
@@ -191,7 +525,16 @@ func main() {
 	// Close terminal sessions
 	terminalManager.Close()
 
+	// Send close frames to WebSocket and event stream clients
+	stopHub()
+	if err := router.Hub().Wait(shutdownCtx); err != nil {
+		log.Printf("WebSocket hub shutdown error: %v", err)
+	}
+
 	// Shutdown server
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
 	if err := server.Shutdown(shutdownCtx); err != nil {
 		log.Printf("Server shutdown error: %v", err)
 	}
@@ -201,3 +544,213 @@ func main() {
 
 	log.Println("Server stopped")
 }
+
+// envOr returns the environment variable key, or fallback when it is unset
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// terminalPolicy builds the terminal session policy from the configuration
+func terminalPolicy(c *config.Config) terminal.Policy {
+	return terminal.Policy{
+		DefaultCols:  uint16(c.Terminal.DefaultCols),
+		DefaultRows:  uint16(c.Terminal.DefaultRows),
+		MaxCols:      uint16(c.Terminal.MaxCols),
+		MaxRows:      uint16(c.Terminal.MaxRows),
+		AllowedEnv:   c.Terminal.AllowedEnv,
+		AllowCommand: c.Terminal.AllowCommand,
+
+		AllowMultiplexer: c.Terminal.AllowMultiplexer,
+		SerialDevices:    c.Terminal.SerialDevices,
+
+		DefaultScrollback: c.Terminal.ScrollbackSize,
+		MaxScrollback:     c.Terminal.MaxScrollbackSize,
+		DetachTimeout:     c.Terminal.DetachTimeout,
+
+		MaxSessionsPerUser: c.Terminal.MaxSessionsPerUser,
+	}
+}
+
+// updaterSettings builds the updater settings from the configuration
+func updaterSettings(c *config.Config) updater.Settings {
+	return updater.Settings{
+		Enabled:           c.Updater.Enabled,
+		CheckInterval:     c.Updater.CheckInterval,
+		Channel:           c.Updater.Channel,
+		AutoApply:         c.Updater.AutoApply,
+		MaintenanceWindow: c.Updater.MaintenanceWindow,
+		Proxy:             c.Updater.Proxy,
+		GitHubToken:       c.Updater.GitHubToken,
+		ManifestURL:       c.Updater.ManifestURL,
+		KeepVersions:      c.Updater.KeepVersions,
+	}
+}
+
+// certSettings builds the certificate inventory settings from the configuration
+func certSettings(c *config.Config) certs.Settings {
+	return certs.Settings{
+		Paths:    c.Certificates.Paths,
+		WarnDays: c.Certificates.WarnDays,
+	}
+}
+
+// schedulerSettings builds the task scheduler limits from the configuration
+func schedulerSettings(c *config.Config) scheduler.Settings {
+	return scheduler.Settings{
+		MaxConcurrent: c.Scheduler.MaxConcurrent,
+		MaxOutput:     c.Scheduler.MaxOutput,
+	}
+}
+
+// registerTaskActions makes the actions acting on Nebula managers available
+// to scheduled tasks
+func registerTaskActions(s *scheduler.Scheduler, appConfig *config.Config, store *storage.Storage, serviceManager service.Manager, packagesManager packages.Manager) {
+	s.Register(scheduler.ActionBackup, func(ctx context.Context, task scheduler.Task, out *scheduler.Output) error {
+		cfg := appConfig.Storage
+		if store == nil {
+			return fmt.Errorf("storage not available")
+		}
+		if cfg.BackupDir == "" {
+			return fmt.Errorf("storage.backup_dir is not set")
+		}
+		path, err := store.BackupToFile(cfg.BackupDir, cfg.BackupKeep)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Backup written to %s\n", path)
+		return nil
+	})
+	s.Register(scheduler.ActionCleanCache, func(ctx context.Context, task scheduler.Task, out *scheduler.Output) error {
+		if packagesManager == nil {
+			return fmt.Errorf("package manager not available")
+		}
+		if err := packagesManager.Clean(); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s package cache cleaned\n", packagesManager.Type())
+		return nil
+	})
+	s.Register(scheduler.ActionRestartService, func(ctx context.Context, task scheduler.Task, out *scheduler.Output) error {
+		if serviceManager == nil {
+			return fmt.Errorf("service manager not available")
+		}
+		if err := serviceManager.Restart(task.Service); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Service %s restarted\n", task.Service)
+		return nil
+	})
+}
+
+// rateLimitSettings builds the API rate limits from the configuration
+func rateLimitSettings(c *config.Config) ratelimit.Settings {
+	settings := ratelimit.Settings{
+		Enabled: c.RateLimit.Enabled,
+		Default: ratelimit.Limit{Rate: c.RateLimit.Rate, Burst: c.RateLimit.Burst},
+		PerIP:   ratelimit.Limit{Rate: c.RateLimit.IPRate, Burst: c.RateLimit.IPBurst},
+	}
+	for _, route := range c.RateLimit.Routes {
+		settings.Routes = append(settings.Routes, ratelimit.Route{
+			Prefix:  route.Prefix,
+			Methods: route.Methods,
+			Limit:   ratelimit.Limit{Rate: route.Rate, Burst: route.Burst},
+		})
+	}
+	return settings
+}
+
+// lockoutSettings builds the login lockout settings from the configuration
+func lockoutSettings(c *config.Config) lockout.Settings {
+	return lockout.Settings{
+		Enabled:     c.Auth.Lockout.Enabled,
+		MaxFailures: c.Auth.Lockout.MaxFailures,
+		BaseDelay:   c.Auth.Lockout.BaseDelay,
+		MaxDelay:    c.Auth.Lockout.MaxDelay,
+		Window:      c.Auth.Lockout.Window,
+	}
+}
+
+// clientPolicy builds the WebSocket client queueing policy from the configuration
+func clientPolicy(c *config.Config) websocket.ClientPolicy {
+	return websocket.ClientPolicy{
+		SendBuffer: c.WebSocket.SendBuffer,
+		SlowClient: c.WebSocket.SlowClientPolicy,
+		Coalesce:   c.WebSocket.Coalesce,
+	}
+}
+
+// webhooks builds the webhook targets from the configuration
+func webhooks(hooks []config.WebhookConfig) []events.Webhook {
+	targets := make([]events.Webhook, len(hooks))
+	for i, hook := range hooks {
+		targets[i] = events.Webhook{URL: hook.URL, Topics: hook.Topics, Secret: hook.Secret}
+	}
+	return targets
+}
+
+// emailNotifications builds the channel and rule of the email notifications
+// set in the configuration, none when they are disabled
+func emailNotifications(c config.EmailNotifyConfig) ([]notify.ChannelConfig, []notify.Rule) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	const name = "config-email"
+	channel := notify.ChannelConfig{
+		Name:     name,
+		Type:     notify.TypeEmail,
+		Enabled:  true,
+		SMTPHost: c.SMTPHost,
+		SMTPPort: c.SMTPPort,
+		Username: c.Username,
+		Password: c.Password,
+		From:     c.From,
+		To:       c.To,
+	}
+	rule := notify.Rule{ID: name, Enabled: true, Events: c.Events, MinSeverity: c.MinSeverity, Channels: []string{name}}
+	return []notify.ChannelConfig{channel}, []notify.Rule{rule}
+}
+
+// roots builds the named file roots from the configuration
+func roots(dirs []config.RootConfig) []files.Root {
+	roots := make([]files.Root, len(dirs))
+	for i, dir := range dirs {
+		roots[i] = files.Root{Name: dir.Name, Path: dir.Path, ReadOnly: dir.ReadOnly, Quota: dir.Quota, Users: dir.Users}
+	}
+	return roots
+}
+
+// remotes builds the settings of the remote file hosts from the
+// configuration
+func remotes(hosts []config.RemoteConfig) []files.RemoteSettings {
+	settings := make([]files.RemoteSettings, len(hosts))
+	for i, host := range hosts {
+		settings[i] = files.RemoteSettings{
+			Name:       host.Name,
+			Address:    host.Address,
+			User:       host.User,
+			Password:   host.Password,
+			KeyFile:    host.KeyFile,
+			HostKey:    host.HostKey,
+			KnownHosts: host.KnownHosts,
+			RootPath:   host.RootPath,
+		}
+	}
+	return settings
+}
+
+// agentSettings builds the cluster agent settings from the configuration
+func agentSettings(c *config.Config) cluster.AgentSettings {
+	return cluster.AgentSettings{
+		ControllerURL: c.Cluster.ControllerURL,
+		Token:         c.Cluster.Token,
+		Registration: cluster.Registration{
+			Name:    c.Cluster.Name,
+			URL:     c.Cluster.AdvertiseURL,
+			Version: updater.Version,
+		},
+		Interval: c.Cluster.HeartbeatInterval,
+	}
+}
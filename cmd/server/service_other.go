@@ -0,0 +1,9 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// notifyServiceStop relays stop requests to quit when Nebula runs as a
+// Windows service. Other service managers stop it with SIGTERM.
+func notifyServiceStop(quit chan<- os.Signal) {}
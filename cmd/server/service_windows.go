@@ -0,0 +1,47 @@
+//go:build windows
+
+package main
+
+import (
+	"log"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// serviceHandler reports to the service control manager and turns its stop
+// and shutdown requests into signals on quit
+type serviceHandler struct {
+	quit chan<- os.Signal
+}
+
+// Execute runs for the lifetime of the service
+func (h serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for req := range requests {
+		switch req.Cmd {
+		case svc.Interrogate:
+			status <- req.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			h.quit <- syscall.SIGTERM
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// notifyServiceStop relays stop requests to quit when Nebula runs as a
+// Windows service
+func notifyServiceStop(quit chan<- os.Signal) {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return
+	}
+	go func() {
+		if err := svc.Run(serviceName, serviceHandler{quit: quit}); err != nil {
+			log.Printf("Windows service error: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nebula/nebula/internal/config"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serverTLS returns the TLS configuration of the HTTP server and the handler
+// of the plain HTTP listener, which redirects to HTTPS and answers ACME
+// challenges. Both are nil when server.tls is disabled.
+func serverTLS(c *config.Config) (*tls.Config, http.Handler, error) {
+	settings := c.Server.TLS
+	if !settings.Enabled {
+		return nil, nil, nil
+	}
+	redirect := httpsRedirect(c.Server.Port)
+
+	if settings.Autocert {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(settings.CacheDir),
+			HostPolicy: autocert.HostWhitelist(settings.Domains...),
+			Email:      settings.Email,
+		}
+		if settings.ACMEDirectory != "" {
+			m.Client = &acme.Client{DirectoryURL: settings.ACMEDirectory}
+		}
+		tlsConfig := m.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, m.HTTPHandler(redirect), nil
+	}
+
+	certs := &certReloader{certFile: settings.CertFile, keyFile: settings.KeyFile}
+	if _, err := certs.GetCertificate(nil); err != nil {
+		return nil, nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certs.GetCertificate,
+	}
+	return tlsConfig, redirect, nil
+}
+
+// httpsRedirect redirects requests to the same host and path on the HTTPS
+// port
+func httpsRedirect(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusMovedPermanently)
+	})
+}
+
+// certReloader serves the certificate of certFile and keyFile, loading them
+// again once they change so renewed certificates apply without a restart
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modified := r.modified
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			if r.cert != nil {
+				return r.cert, nil
+			}
+			return nil, err
+		}
+		if info.ModTime().After(modified) {
+			modified = info.ModTime()
+		}
+	}
+	if r.cert != nil && !modified.After(r.modified) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		if r.cert != nil {
+			// Keep serving the old certificate while the files are replaced
+			log.Printf("Failed to reload TLS certificate: %v", err)
+			return r.cert, nil
+		}
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	if r.cert != nil {
+		log.Printf("TLS certificate reloaded from %s", r.certFile)
+	}
+	r.cert = &cert
+	r.modified = modified
+	return r.cert, nil
+}
@@ -0,0 +1,1801 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/nebula/nebula/internal/certs"
+	"github.com/nebula/nebula/internal/cluster"
+	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/containers"
+	"github.com/nebula/nebula/internal/files"
+	"github.com/nebula/nebula/internal/jobs"
+	"github.com/nebula/nebula/internal/metrics"
+	"github.com/nebula/nebula/internal/mounts"
+	"github.com/nebula/nebula/internal/notify"
+	"github.com/nebula/nebula/internal/packages"
+	"github.com/nebula/nebula/internal/process"
+	"github.com/nebula/nebula/internal/scheduler"
+	"github.com/nebula/nebula/internal/service"
+	"github.com/nebula/nebula/internal/storage"
+	"github.com/nebula/nebula/internal/sysconf"
+	"github.com/nebula/nebula/internal/terminal"
+	"github.com/nebula/nebula/internal/updater"
+	"github.com/nebula/nebula/internal/websocket"
+)
+
+// operationDoc documents a route in the OpenAPI spec
+type operationDoc struct {
+	tag         string
+	summary     string
+	description string
+	params      []paramDoc
+	// body is a value of the JSON request body type
+	body         interface{}
+	optionalBody bool
+	// upload is the multipart form field carrying an uploaded file
+	upload string
+	// formFields are the required text fields sent along with an upload
+	formFields []string
+	// status is the success status, 200 when zero
+	status int
+	// response is a value of the JSON response body type
+	response interface{}
+	// consumes is the content type of request bodies sent raw instead of
+	// JSON
+	consumes string
+	// produces is the content type of responses that aren't JSON
+	produces string
+	// errors lists the error statuses, answered with an ErrorResponse
+	errors []int
+	// clusterToken is set on routes authenticated with the cluster token
+	// instead of the user credentials
+	clusterToken bool
+}
+
+// paramDoc documents a path, query or header parameter
+type paramDoc struct {
+	in          string
+	name        string
+	kind        string
+	description string
+	required    bool
+}
+
+// streamParams are the query parameters of the event streams
+var streamParams = []paramDoc{
+	{"query", "topics", "string", "Comma separated topics to subscribe to", false},
+	{"query", "client", "string", "Client name shown in /api/v1/ws/clients", false},
+	{"query", "resume", "integer", "Sequence number of the last message received, to replay the ones missed", false},
+	ticketParam,
+}
+
+// ticketParam authenticates the streams browsers open without credentials
+var ticketParam = paramDoc{"query", "ticket", "string", "One-time ticket from POST /api/v1/auth/ticket, in place of the credentials", false}
+
+// rootParam picks the named root a file endpoint works on
+var rootParam = paramDoc{"query", "root", "string", "Name of a root from GET /api/v2/files/roots, root_path when omitted", false}
+
+// remoteParam picks the remote host a file endpoint works on
+var remoteParam = paramDoc{"query", "remote", "string", "Name of a remote host from GET /api/v2/files/remotes, the local files when omitted", false}
+
+// pageParams are the paging, sorting and filtering parameters of the list
+// endpoints
+var pageParams = []paramDoc{
+	{"query", "limit", "integer", "Page size (default 100, max 1000)", false},
+	{"query", "cursor", "string", "next_cursor of the previous page", false},
+	{"query", "sort", "string", "Field to sort by, prefixed with - for descending order", false},
+	{"query", "filter", "string", "field:value, case-insensitive equality; repeat to combine", false},
+}
+
+// listParams adds free-text search to pageParams
+var listParams = append(pageParams, paramDoc{"query", "q", "string", "Case-insensitive search in the text fields", false})
+
+// operationDocs documents the routes, keyed by method and gin path. ANY
+// matches every method of routes registered with Any.
+var operationDocs = map[string]operationDoc{
+	"GET /api/v1/metrics/cpu": {
+		tag:         "metrics",
+		summary:     "Get CPU metrics",
+		description: "Returns current CPU usage information",
+		response:    metrics.CPUInfo{},
+	},
+	"GET /api/v1/metrics/memory": {
+		tag:         "metrics",
+		summary:     "Get memory metrics",
+		description: "Returns current memory usage information",
+		response:    metrics.MemoryInfo{},
+	},
+	"GET /api/v1/metrics/disk": {
+		tag:         "metrics",
+		summary:     "Get disk metrics",
+		description: "Returns disk usage information for all mounted partitions",
+		response:    []metrics.DiskInfo{},
+	},
+	"GET /api/v1/metrics/network": {
+		tag:         "metrics",
+		summary:     "Get network metrics",
+		description: "Returns network interface counters, with their rates per second since the last collected sample",
+		response:    []metrics.NetworkInfo{},
+	},
+	"GET /api/v1/metrics/all": {
+		tag:         "metrics",
+		summary:     "Get all metrics",
+		description: "Returns all system metrics",
+		response:    metrics.AllMetrics{},
+	},
+	"GET /api/v1/metrics/history": {
+		tag:         "metrics",
+		summary:     "Get metrics history",
+		description: "Returns the in-memory metrics history, oldest first. With from, to or step it returns instead a MetricsRangeResponse: the stored history of the range, with the average and maximum of each step. Parts of the range older than storage.metrics_retention are read from the 1-minute and 5-minute rollups.",
+		params: append([]paramDoc{
+			{"query", "from", "string", "Start of the range (RFC3339), an hour before to by default", false},
+			{"query", "to", "string", "End of the range (RFC3339), now by default", false},
+			{"query", "step", "string", "Length of each point (Go duration, e.g. 1m), the range split in 300 by default", false},
+		}, listParams...),
+		response: ListResponse[metrics.AllMetrics]{},
+		errors:   []int{400},
+	},
+
+	"GET /api/v1/processes": {
+		tag:         "processes",
+		summary:     "List all processes",
+		description: "Returns a page of the running processes",
+		params:      listParams,
+		response:    ListResponse[process.ProcessInfo]{},
+		errors:      []int{400, 500},
+	},
+	"GET /api/v1/processes/search": {
+		tag:         "processes",
+		summary:     "Search processes",
+		description: "Search for processes by name",
+		params: append([]paramDoc{
+			{"query", "q", "string", "Search query", true},
+		}, pageParams...),
+		response: ListResponse[process.ProcessInfo]{},
+		errors:   []int{400, 500},
+	},
+	"GET /api/v1/processes/:pid": {
+		tag:         "processes",
+		summary:     "Get process details",
+		description: "Returns detailed information about a specific process",
+		params: []paramDoc{
+			{"path", "pid", "integer", "Process ID", true},
+		},
+		response: process.ProcessInfo{},
+		errors:   []int{404},
+	},
+	"POST /api/v1/processes/:pid/kill": {
+		tag:         "processes",
+		summary:     "Kill a process",
+		description: "Terminates a process by PID",
+		params: []paramDoc{
+			{"path", "pid", "integer", "Process ID", true},
+			{"query", "force", "boolean", "Force kill (SIGKILL)", false},
+		},
+		response: MessageResponse{},
+		errors:   []int{400, 500},
+	},
+	"GET /api/v1/processes/:pid/tree": {
+		tag:         "processes",
+		summary:     "Get process tree",
+		description: "Returns the process tree starting from a specific PID",
+		params: []paramDoc{
+			{"path", "pid", "integer", "Process ID", true},
+		},
+		response: process.TreeNode{},
+		errors:   []int{404},
+	},
+
+	"GET /api/v1/services": {
+		tag:         "services",
+		summary:     "List all services",
+		description: "Returns a page of the system services",
+		params:      listParams,
+		response:    ListResponse[service.ServiceInfo]{},
+		errors:      []int{400, 500},
+	},
+	"GET /api/v1/services/:name": {
+		tag:         "services",
+		summary:     "Get service details",
+		description: "Returns detailed information about a specific service",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: service.ServiceInfo{},
+		errors:   []int{404},
+	},
+	"POST /api/v1/services/:name/start": {
+		tag:         "services",
+		summary:     "Start a service",
+		description: "Starts a system service",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{500},
+	},
+	"POST /api/v1/services/:name/stop": {
+		tag:         "services",
+		summary:     "Stop a service",
+		description: "Stops a system service",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{500},
+	},
+	"POST /api/v1/services/:name/restart": {
+		tag:         "services",
+		summary:     "Restart a service",
+		description: "Restarts a system service",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{500},
+	},
+	"POST /api/v1/services/:name/enable": {
+		tag:         "services",
+		summary:     "Enable a service",
+		description: "Enables a service to start at boot",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{500},
+	},
+	"POST /api/v1/services/:name/disable": {
+		tag:         "services",
+		summary:     "Disable a service",
+		description: "Disables a service from starting at boot",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{500},
+	},
+	"GET /api/v1/services/:name/logs": {
+		tag:         "services",
+		summary:     "Get service logs",
+		description: "Returns recent logs for a service",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+			{"query", "lines", "integer", "Number of lines, 100 by default", false},
+		},
+		response: []service.ServiceLog{},
+		errors:   []int{500},
+	},
+
+	"GET /api/v1/files/list": {
+		tag:         "files",
+		summary:     "List directory contents",
+		description: "Returns files and directories in a path, with the space left in the root as quota",
+		params: append([]paramDoc{
+			{"query", "path", "string", "Directory path", true},
+		}, listParams...),
+		response: fileListResponse{},
+		errors:   []int{400, 500},
+	},
+	"GET /api/v1/files/info": {
+		tag:         "files",
+		summary:     "Get file/directory info",
+		description: "Returns information about a file or directory",
+		params: []paramDoc{
+			{"query", "path", "string", "File or directory path", true},
+		},
+		response: files.FileInfo{},
+		errors:   []int{404},
+	},
+	"GET /api/v1/files/download": {
+		tag:         "files",
+		summary:     "Download a file",
+		description: "Downloads a file, answering Range requests with 206 so downloads can resume and If-Modified-Since with 304. Directories are streamed as zip archives without a Content-Length, in Zip64 format when over 4 GiB.",
+		params: []paramDoc{
+			{"query", "path", "string", "File path", true},
+			{"header", "Range", "string", "Byte ranges to send, e.g. bytes=1024-", false},
+			{"header", "If-Modified-Since", "string", "Answer 304 when the file hasn't changed since", false},
+		},
+		produces: "application/octet-stream",
+		errors:   []int{404},
+	},
+	"POST /api/v1/files/upload": {
+		tag:         "files",
+		summary:     "Upload a file",
+		description: "Uploads a file to a directory",
+		params: []paramDoc{
+			{"query", "path", "string", "Destination directory", true},
+		},
+		upload:   "file",
+		response: uploadResponse{},
+		errors:   []int{400, 500},
+	},
+	"POST /api/v1/files/mkdir": {
+		tag:         "files",
+		summary:     "Create directory",
+		description: "Creates a new directory",
+		body:        pathRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 500},
+	},
+	"DELETE /api/v1/files/delete": {
+		tag:         "files",
+		summary:     "Delete file or directory",
+		description: "Deletes a file or directory",
+		params: []paramDoc{
+			{"query", "path", "string", "Path to delete", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{400, 500},
+	},
+	"PUT /api/v1/files/rename": {
+		tag:         "files",
+		summary:     "Rename file or directory",
+		description: "Renames a file or directory, copying it across filesystems",
+		body:        renameRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 500},
+	},
+	"GET /api/v1/files/read": {
+		tag:         "files",
+		summary:     "Read file content",
+		description: "Returns the content of a text file",
+		params: []paramDoc{
+			{"query", "path", "string", "File path", true},
+		},
+		response: contentResponse{},
+		errors:   []int{400, 500},
+	},
+	"PUT /api/v1/files/write": {
+		tag:         "files",
+		summary:     "Write file content",
+		description: "Writes content to a file",
+		body:        writeRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 500},
+	},
+	"PUT /api/v1/files/permissions": {
+		tag:         "files",
+		summary:     "Change permissions and ownership",
+		description: "Changes the mode, octal (0755) or symbolic (u+x,go-w), and the owner and group, names or IDs, of a file or directory. With recursive everything below a directory changes too, except symbolic links.",
+		body:        permissionsRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 403, 404, 500},
+	},
+
+	"GET /api/v1/packages": {
+		tag:         "packages",
+		summary:     "List installed packages",
+		description: "Returns a page of the installed packages",
+		params:      listParams,
+		response:    ListResponse[packages.PackageInfo]{},
+		errors:      []int{400, 500},
+	},
+	"GET /api/v1/packages/search": {
+		tag:         "packages",
+		summary:     "Search packages",
+		description: "Searches for packages in the repository",
+		params: append([]paramDoc{
+			{"query", "q", "string", "Search query", true},
+		}, pageParams...),
+		response: ListResponse[packages.PackageInfo]{},
+		errors:   []int{400, 500},
+	},
+	"GET /api/v1/packages/info": {
+		tag:         "packages",
+		summary:     "Get package info",
+		description: "Returns detailed information about a package",
+		params: []paramDoc{
+			{"query", "name", "string", "Package name", true},
+		},
+		response: packages.PackageInfo{},
+		errors:   []int{400, 404},
+	},
+	"GET /api/v1/packages/type": {
+		tag:         "packages",
+		summary:     "Get package manager type",
+		description: "Returns the detected package manager type",
+		response:    packageTypeResponse{},
+	},
+	"POST /api/v1/packages/install": {
+		tag:         "packages",
+		summary:     "Install a package",
+		description: "Installs a package",
+		body:        packageRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 500},
+	},
+	"DELETE /api/v1/packages/remove": {
+		tag:         "packages",
+		summary:     "Remove a package",
+		description: "Removes an installed package",
+		params: []paramDoc{
+			{"query", "name", "string", "Package name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{400, 500},
+	},
+	"POST /api/v1/packages/update": {
+		tag:         "packages",
+		summary:     "Update a package",
+		description: "Updates a package to the latest version",
+		body:        packageRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 500},
+	},
+	"POST /api/v1/packages/upgrade-all": {
+		tag:         "packages",
+		summary:     "Upgrade all packages",
+		description: "Upgrades all installed packages",
+		response:    MessageResponse{},
+		errors:      []int{500},
+	},
+
+	"GET /api/v1/containers": {
+		tag:         "containers",
+		summary:     "List containers",
+		description: "Returns the running containers, or every container with all=true",
+		params: []paramDoc{
+			{"query", "all", "boolean", "Include stopped containers", false},
+		},
+		response: []containers.Container{},
+		errors:   []int{503},
+	},
+	"GET /api/v1/containers/runtime": {
+		tag:         "containers",
+		summary:     "Get the container runtime",
+		description: "Returns whether Docker or Podman is used and the API endpoint",
+		response:    runtimeResponse{},
+		errors:      []int{503},
+	},
+	"GET /api/v1/containers/images": {
+		tag:      "containers",
+		summary:  "List images",
+		response: []containers.Image{},
+		errors:   []int{503},
+	},
+	"POST /api/v1/containers/images/pull": {
+		tag:         "containers",
+		summary:     "Pull an image",
+		description: "Downloads an image from its registry, returning when the pull is complete",
+		body:        pullRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 500},
+	},
+	"POST /api/v1/containers/prune": {
+		tag:         "containers",
+		summary:     "Prune containers and images",
+		description: "Removes stopped containers and dangling images",
+		response:    containers.PruneReport{},
+		errors:      []int{500},
+	},
+	"GET /api/v1/containers/:id": {
+		tag:         "containers",
+		summary:     "Inspect a container",
+		description: "Returns the full description of a container as reported by the runtime",
+		params: []paramDoc{
+			{"path", "id", "string", "Container ID or name", true},
+		},
+		response: map[string]interface{}{},
+		errors:   []int{404},
+	},
+	"POST /api/v1/containers/:id/start": {
+		tag:     "containers",
+		summary: "Start a container",
+		params: []paramDoc{
+			{"path", "id", "string", "Container ID or name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404, 500},
+	},
+	"POST /api/v1/containers/:id/stop": {
+		tag:     "containers",
+		summary: "Stop a container",
+		params: []paramDoc{
+			{"path", "id", "string", "Container ID or name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404, 500},
+	},
+	"POST /api/v1/containers/:id/restart": {
+		tag:     "containers",
+		summary: "Restart a container",
+		params: []paramDoc{
+			{"path", "id", "string", "Container ID or name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404, 500},
+	},
+	"GET /api/v1/containers/:id/logs": {
+		tag:         "containers",
+		summary:     "Get container logs",
+		description: "Returns the last lines written by a container. With follow=true new lines are streamed as newline-delimited JSON until the client disconnects.",
+		params: []paramDoc{
+			{"path", "id", "string", "Container ID or name", true},
+			{"query", "tail", "integer", "Number of lines, 100 by default", false},
+			{"query", "since", "string", "Only lines after this time (RFC3339)", false},
+			{"query", "follow", "boolean", "Stream new lines", false},
+		},
+		response: []containers.LogLine{},
+		errors:   []int{400, 404},
+	},
+	"GET /api/v1/containers/:id/stats": {
+		tag:         "containers",
+		summary:     "Get container resource usage",
+		description: "Returns CPU, memory, network, block I/O and process usage of a running container",
+		params: []paramDoc{
+			{"path", "id", "string", "Container ID or name", true},
+		},
+		response: containers.Stats{},
+		errors:   []int{404},
+	},
+
+	"GET /api/v1/certificates": {
+		tag:         "certificates",
+		summary:     "List TLS certificates",
+		description: "Returns the certificates found in the configured paths, soonest expiry first",
+		response:    certificatesResponse{},
+	},
+	"POST /api/v1/certificates": {
+		tag:         "certificates",
+		summary:     "Upload a certificate and key",
+		description: "Stores a PEM certificate chain and its private key in the upload directory as name.crt and name.key, replacing an existing pair. The key must match the certificate.",
+		body:        uploadCertificateRequest{},
+		response:    certs.Certificate{},
+		errors:      []int{400, 500},
+	},
+	"POST /api/v1/certificates/scan": {
+		tag:         "certificates",
+		summary:     "Rescan TLS certificates",
+		description: "Scans the configured paths again and returns the certificates found",
+		response:    []certs.Certificate{},
+	},
+	"POST /api/v1/certificates/reload": {
+		tag:         "certificates",
+		summary:     "Reload a service using certificates",
+		description: "Reloads one of the services listed in certificates.reload_services so it picks up new certificates. nebula reloads the Nebula configuration.",
+		body:        reloadRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 403, 500},
+	},
+
+	"GET /api/v1/terminal/shells": {
+		tag:         "terminal",
+		summary:     "Get available shells",
+		description: "Returns a list of available shells",
+		response:    shellsResponse{},
+	},
+	"GET /api/v1/terminal/sessions": {
+		tag:         "terminal",
+		summary:     "Get active sessions",
+		description: "Returns a list of active terminal sessions with their metadata",
+		response:    []terminal.SessionInfo{},
+	},
+	"DELETE /api/v1/terminal/sessions/:id": {
+		tag:         "terminal",
+		summary:     "Terminate a session",
+		description: "Forcibly closes a terminal session, disconnecting all attached clients. Only the owner of the session or an administrator may close it.",
+		params: []paramDoc{
+			{"path", "id", "string", "Session ID", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{403, 404},
+	},
+	"GET /api/v1/terminal/multiplexers": {
+		tag:         "terminal",
+		summary:     "List tmux/screen sessions",
+		description: "Returns the tmux and screen sessions running on the host that the terminal can attach to",
+		response:    []terminal.MultiplexerSession{},
+	},
+	"GET /api/v1/terminal/serial": {
+		tag:         "terminal",
+		summary:     "List serial devices",
+		description: "Returns the serial devices that console sessions may open",
+		response:    []string{},
+	},
+	"GET /api/v1/terminal/broadcast": {
+		tag:         "terminal",
+		summary:     "Get broadcast sessions",
+		description: "Returns the sessions whose input is currently mirrored to each other",
+		response:    broadcastResponse{},
+	},
+	"PUT /api/v1/terminal/broadcast": {
+		tag:         "terminal",
+		summary:     "Link sessions for broadcast input",
+		description: "Mirrors keystrokes typed in any of the given sessions to all of them. Users other than administrators may only link, and replace a group of, their own sessions.",
+		body:        broadcastRequest{},
+		response:    broadcastResponse{},
+		errors:      []int{400, 403},
+	},
+	"DELETE /api/v1/terminal/broadcast": {
+		tag:         "terminal",
+		summary:     "Stop broadcast input",
+		description: "Unlinks all sessions from broadcast mode",
+		response:    MessageResponse{},
+		errors:      []int{403},
+	},
+
+	"GET /api/v1/system/info": {
+		tag:         "system",
+		summary:     "Get system information",
+		description: "Returns general system information, with the load averages and, on Linux, the CPU, memory and I/O pressure stall information (PSI)",
+		response:    metrics.SystemInfo{},
+	},
+	"GET /api/v1/system/power": {
+		tag:         "system",
+		summary:     "Get power management status",
+		description: "Returns the supported actions and the scheduled one, if any",
+		response:    powerStatusResponse{},
+	},
+	"DELETE /api/v1/system/power": {
+		tag:      "system",
+		summary:  "Cancel a scheduled power action",
+		response: powerResponse{},
+		errors:   []int{404},
+	},
+	"POST /api/v1/system/reboot": {
+		tag:          "system",
+		summary:      "Reboot the system",
+		description:  "Without confirm, returns a confirmation token valid for a minute. Sending it back as confirm reboots the system at the requested time, warning logged in users.",
+		body:         powerRequest{},
+		optionalBody: true,
+		response:     powerResponse{},
+		errors:       []int{400, 403, 409},
+	},
+	"POST /api/v1/system/shutdown": {
+		tag:          "system",
+		summary:      "Shut down the system",
+		description:  "Without confirm, returns a confirmation token valid for a minute. Sending it back as confirm powers off the system at the requested time, warning logged in users.",
+		body:         powerRequest{},
+		optionalBody: true,
+		response:     powerResponse{},
+		errors:       []int{400, 403, 409},
+	},
+	"POST /api/v1/system/suspend": {
+		tag:          "system",
+		summary:      "Suspend the system",
+		description:  "Without confirm, returns a confirmation token valid for a minute. Sending it back as confirm suspends the system at the requested time. Not available on every system.",
+		body:         powerRequest{},
+		optionalBody: true,
+		response:     powerResponse{},
+		errors:       []int{400, 403, 409, 501},
+	},
+	"GET /api/v1/system/settings": {
+		tag:         "system",
+		summary:     "Get host settings",
+		description: "Returns the hostname, timezone, NTP state and locale, and whether they can be changed",
+		response:    sysconf.Settings{},
+	},
+	"PUT /api/v1/system/hostname": {
+		tag:      "system",
+		summary:  "Set the hostname",
+		body:     hostnameRequest{},
+		response: MessageResponse{},
+		errors:   []int{400, 501},
+	},
+	"PUT /api/v1/system/timezone": {
+		tag:      "system",
+		summary:  "Set the timezone",
+		body:     timezoneRequest{},
+		response: MessageResponse{},
+		errors:   []int{400, 501},
+	},
+	"PUT /api/v1/system/ntp": {
+		tag:      "system",
+		summary:  "Enable or disable NTP",
+		body:     ntpRequest{},
+		response: MessageResponse{},
+		errors:   []int{400, 501},
+	},
+	"PUT /api/v1/system/locale": {
+		tag:      "system",
+		summary:  "Set the system locale",
+		body:     localeRequest{},
+		response: MessageResponse{},
+		errors:   []int{400, 501},
+	},
+	"GET /api/v1/system/timezones": {
+		tag:         "system",
+		summary:     "List timezones",
+		description: "Returns the names of the tz database",
+		response:    []string{},
+	},
+	"GET /api/v1/system/locales": {
+		tag:         "system",
+		summary:     "List locales",
+		description: "Returns the locales that can be set",
+		response:    []string{},
+		errors:      []int{501},
+	},
+	"GET /api/v1/mounts": {
+		tag:         "mounts",
+		summary:     "List mounted filesystems",
+		description: "Returns a page of the filesystems mounted, as in /proc/mounts",
+		params:      listParams,
+		response:    ListResponse[mounts.Mount]{},
+		errors:      []int{400, 501},
+	},
+	"POST /api/v1/mounts": {
+		tag:         "mounts",
+		summary:     "Mount a filesystem",
+		description: "Mounts a device, a UUID= or LABEL= tag, a network share or an image file on an existing directory, with the privilege manager. Image files such as ISOs are mounted through a loop device. The filesystem type is detected when omitted.",
+		body:        mounts.MountRequest{},
+		status:      http.StatusCreated,
+		response:    mounts.Mount{},
+		errors:      []int{400, 500, 501},
+	},
+	"DELETE /api/v1/mounts": {
+		tag:         "mounts",
+		summary:     "Unmount a filesystem",
+		description: "Unmounts the filesystem mounted last on target. A lazy unmount detaches it at once and cleans up once it is no longer busy.",
+		params: []paramDoc{
+			{"query", "target", "string", "Mount point", true},
+			{"query", "lazy", "boolean", "Unmount lazily", false},
+		},
+		response: MessageResponse{},
+		errors:   []int{400, 404, 500, 501},
+	},
+	"GET /api/v1/mounts/fstab": {
+		tag:         "mounts",
+		summary:     "List fstab entries",
+		description: "Returns a page of the entries of /etc/fstab, the filesystems mounted at boot",
+		params:      listParams,
+		response:    ListResponse[mounts.Entry]{},
+		errors:      []int{400, 501},
+	},
+	"PUT /api/v1/mounts/fstab": {
+		tag:         "mounts",
+		summary:     "Add or replace an fstab entry",
+		description: "Validates the entry and writes it to /etc/fstab with the privilege manager, replacing the entry for the same mount point, or the same source for swap, where it is. Comments and other entries are kept. Options default to defaults. Answers 201 when the entry is added.",
+		body:        mounts.Entry{},
+		response:    mounts.Entry{},
+		errors:      []int{400, 500, 501},
+	},
+	"DELETE /api/v1/mounts/fstab": {
+		tag:     "mounts",
+		summary: "Remove an fstab entry",
+		params: []paramDoc{
+			{"query", "target", "string", "Mount point of the entry, its source for swap", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{400, 404, 500, 501},
+	},
+	"GET /api/v1/config": {
+		tag:         "system",
+		summary:     "Get current configuration",
+		description: "Returns the current server configuration",
+		response:    config.Config{},
+	},
+	"PATCH /api/v1/config": {
+		tag:         "system",
+		summary:     "Update configuration",
+		description: "Validates and stores configuration overrides, applying hot-reloadable settings immediately. Keys may be nested objects or dotted paths (server.port); null removes an override.",
+		body:        map[string]interface{}{},
+		response:    configPatchResponse{},
+		errors:      []int{400},
+	},
+	"GET /api/v1/config/schema": {
+		tag:         "system",
+		summary:     "Get configuration schema",
+		description: "Describes every configuration key with its type, default, description and whether it is hot-reloadable",
+		response:    []config.Field{},
+	},
+	"GET /api/v1/config/history": {
+		tag:         "system",
+		summary:     "Get configuration history",
+		description: "Returns applied configuration changes with who made them and the old and new values, newest first",
+		params: []paramDoc{
+			{"query", "cursor", "string", "Cursor from the previous page", false},
+			{"query", "limit", "integer", "Page size (max 1000)", false},
+		},
+		response: storage.ConfigHistoryPage{},
+		errors:   []int{400},
+	},
+	"POST /api/v1/config/reload": {
+		tag:         "system",
+		summary:     "Reload configuration",
+		description: "Reloads the configuration from file",
+		response:    MessageResponse{},
+		errors:      []int{500},
+	},
+	"GET /api/v1/update/check": {
+		tag:         "system",
+		summary:     "Check for updates",
+		description: "Checks if a new version is available",
+		response:    updater.UpdateInfo{},
+		errors:      []int{500},
+	},
+	"POST /api/v1/update/apply": {
+		tag:         "system",
+		summary:     "Apply update",
+		description: "Downloads and applies the latest update. Rejected with 409 when the latest release of the channel isn't newer than the running version, older versions are restored with POST /api/v1/update/rollback.",
+		response:    MessageResponse{},
+		errors:      []int{409, 500},
+	},
+	"GET /api/v1/update/status": {
+		tag:         "system",
+		summary:     "Get update status",
+		description: "Returns the phase and download progress of the running or last update or rollback. The same status is pushed to /ws/metrics clients as \"update\" messages.",
+		response:    updater.Status{},
+	},
+	"GET /api/v1/update/versions": {
+		tag:         "system",
+		summary:     "List previous versions",
+		description: "Lists the replaced binaries kept on disk that can be restored with a rollback, newest first",
+		response:    []updater.SavedVersion{},
+		errors:      []int{500},
+	},
+	"POST /api/v1/update/rollback": {
+		tag:          "system",
+		summary:      "Roll back an update",
+		description:  "Restores a previous version (the newest one unless version is given) and restarts the server",
+		body:         rollbackRequest{},
+		optionalBody: true,
+		response:     rollbackResponse{},
+		errors:       []int{400},
+	},
+	"GET /api/v1/version": {
+		tag:         "system",
+		summary:     "Get version",
+		description: "Returns the current version and the active config profile",
+		response:    versionResponse{},
+	},
+
+	"GET /api/v1/notifications/channels": {
+		tag:         "notifications",
+		summary:     "List notification channels",
+		description: "Returns the channels with their credentials masked",
+		response:    []notify.ChannelConfig{},
+	},
+	"PUT /api/v1/notifications/channels/:name": {
+		tag:         "notifications",
+		summary:     "Create or update a notification channel",
+		description: "Types are email, slack, discord, teams, telegram and http. Masked credentials keep the stored values, so a channel read from the API can be sent back edited. Channels set in the configuration file (configured) can't be changed.",
+		params: []paramDoc{
+			{"path", "name", "string", "Channel name", true},
+		},
+		body:     notify.ChannelConfig{},
+		response: notify.ChannelConfig{},
+		errors:   []int{400},
+	},
+	"DELETE /api/v1/notifications/channels/:name": {
+		tag:     "notifications",
+		summary: "Delete a notification channel",
+		params: []paramDoc{
+			{"path", "name", "string", "Channel name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404},
+	},
+	"POST /api/v1/notifications/channels/:name/test": {
+		tag:         "notifications",
+		summary:     "Send a test notification",
+		description: "Sends a test message through a channel, even when it is disabled, without retrying. The attempt is recorded in the delivery history.",
+		params: []paramDoc{
+			{"path", "name", "string", "Channel name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404, 502},
+	},
+	"GET /api/v1/notifications/deliveries": {
+		tag:         "notifications",
+		summary:     "Get notification delivery history",
+		description: "Returns the deliveries to channels, newest first, with the number of attempts and the last error",
+		params: []paramDoc{
+			{"query", "channel", "string", "Only deliveries to this channel", false},
+			{"query", "cursor", "string", "Cursor from the previous page", false},
+			{"query", "limit", "integer", "Page size (max 1000)", false},
+		},
+		response: storage.NotifyDeliveryPage{},
+		errors:   []int{400, 503},
+	},
+	"GET /api/v1/notifications/rules": {
+		tag:      "notifications",
+		summary:  "List notification rules",
+		response: []notify.Rule{},
+	},
+	"POST /api/v1/notifications/rules": {
+		tag:         "notifications",
+		summary:     "Create a notification rule",
+		description: "Routes the events matching the patterns to channels, e.g. {\"enabled\": true, \"events\": [\"certificate.*\", \"service.failed\"], \"channels\": [\"ops\"]}",
+		body:        notify.Rule{},
+		status:      http.StatusCreated,
+		response:    notify.Rule{},
+		errors:      []int{400},
+	},
+	"PUT /api/v1/notifications/rules/:id": {
+		tag:     "notifications",
+		summary: "Update a notification rule",
+		params: []paramDoc{
+			{"path", "id", "string", "Rule ID", true},
+		},
+		body:     notify.Rule{},
+		response: notify.Rule{},
+		errors:   []int{400, 404},
+	},
+	"DELETE /api/v1/notifications/rules/:id": {
+		tag:     "notifications",
+		summary: "Delete a notification rule",
+		params: []paramDoc{
+			{"path", "id", "string", "Rule ID", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404},
+	},
+
+	"GET /api/v1/tasks": {
+		tag:         "tasks",
+		summary:     "List scheduled tasks",
+		description: "Returns the tasks with their next run and the state of the last one",
+		response:    tasksResponse{},
+	},
+	"POST /api/v1/tasks": {
+		tag:         "tasks",
+		summary:     "Create a scheduled task",
+		description: "Actions are command, backup, clean_cache and restart_service. Cron takes five fields (minute hour day month weekday) or a macro such as @daily, evaluated in local time.",
+		body:        taskRequest{},
+		status:      http.StatusCreated,
+		response:    scheduler.TaskState{},
+		errors:      []int{400},
+	},
+	"GET /api/v1/tasks/runs": {
+		tag:     "tasks",
+		summary: "Get run history of all tasks",
+		params: []paramDoc{
+			{"query", "cursor", "string", "Cursor from the previous page", false},
+			{"query", "limit", "integer", "Page size (max 1000)", false},
+		},
+		response: storage.TaskRunPage{},
+		errors:   []int{400},
+	},
+	"GET /api/v1/tasks/:id": {
+		tag:     "tasks",
+		summary: "Get a scheduled task",
+		params: []paramDoc{
+			{"path", "id", "string", "Task ID", true},
+		},
+		response: scheduler.TaskState{},
+		errors:   []int{404},
+	},
+	"PUT /api/v1/tasks/:id": {
+		tag:     "tasks",
+		summary: "Update a scheduled task",
+		params: []paramDoc{
+			{"path", "id", "string", "Task ID", true},
+		},
+		body:     taskRequest{},
+		response: scheduler.TaskState{},
+		errors:   []int{400, 404},
+	},
+	"DELETE /api/v1/tasks/:id": {
+		tag:     "tasks",
+		summary: "Delete a scheduled task",
+		params: []paramDoc{
+			{"path", "id", "string", "Task ID", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404},
+	},
+	"POST /api/v1/tasks/:id/run": {
+		tag:         "tasks",
+		summary:     "Run a task now",
+		description: "Starts the task immediately, even when disabled. The result is published on the jobs topic.",
+		params: []paramDoc{
+			{"path", "id", "string", "Task ID", true},
+		},
+		status:   http.StatusAccepted,
+		response: storage.TaskRun{},
+		errors:   []int{404, 409},
+	},
+	"GET /api/v1/tasks/:id/runs": {
+		tag:         "tasks",
+		summary:     "Get task run history",
+		description: "Returns the finished runs of a task, newest first, with their captured output",
+		params: []paramDoc{
+			{"path", "id", "string", "Task ID", true},
+			{"query", "cursor", "string", "Cursor from the previous page", false},
+			{"query", "limit", "integer", "Page size (max 1000)", false},
+		},
+		response: storage.TaskRunPage{},
+		errors:   []int{400},
+	},
+
+	"POST /api/v1/storage/backup": {
+		tag:         "storage",
+		summary:     "Download a database backup",
+		description: "Streams a consistent snapshot of the database as a download. Administrators only.",
+		produces:    "application/octet-stream",
+		errors:      []int{403, 503},
+	},
+	"GET /api/v1/storage/retention": {
+		tag:         "storage",
+		summary:     "Get retention status",
+		description: "Returns the state of the background retention job and its last cleanup",
+		response:    storage.RetentionStatus{},
+		errors:      []int{503},
+	},
+	"GET /api/v1/storage/export": {
+		tag:         "storage",
+		summary:     "Export configuration buckets",
+		description: "Downloads preferences, bookmarks and config overrides as a JSON dump. Secret configuration overrides and the credentials of notification channels are masked. Administrators only.",
+		params: []paramDoc{
+			{"query", "buckets", "string", "Comma separated bucket names, defaults to all exportable buckets", false},
+		},
+		response: storage.Dump{},
+		errors:   []int{400, 403, 500, 503},
+	},
+	"POST /api/v1/storage/import": {
+		tag:         "storage",
+		summary:     "Import configuration buckets",
+		description: "Loads a JSON dump produced by the export endpoint, merging into or replacing the existing buckets. Configuration overrides are validated like PATCH /api/v1/config first, nothing is imported when they are invalid, then applied and recorded in the configuration history. Imported channels, rules and tasks take effect right away. Masked secrets and channel credentials keep the stored values of the same key or channel. Administrators only.",
+		params: []paramDoc{
+			{"query", "mode", "string", "merge (default) or replace", false},
+		},
+		body:     storage.Dump{},
+		response: importResponse{},
+		errors:   []int{400, 403, 500, 503},
+	},
+
+	"GET /api/v1/audit": {
+		tag:         "audit",
+		summary:     "Query the audit log",
+		description: "Returns audit log entries, newest first unless sort=timestamp, filtered by time range, user, action, resource and free text",
+		params: append([]paramDoc{
+			{"query", "from", "string", "Start time (RFC3339), inclusive", false},
+			{"query", "to", "string", "End time (RFC3339), exclusive", false},
+			{"query", "user", "string", "User", false},
+			{"query", "action", "string", "Action", false},
+			{"query", "resource", "string", "Resource prefix", false},
+		}, listParams...),
+		response: ListResponse[storage.AuditEntry]{},
+		errors:   []int{400, 503},
+	},
+
+	"GET /api/v1/ws/stats": {
+		tag:         "websocket",
+		summary:     "Get realtime statistics",
+		description: "Returns the WebSocket hub counters (clients, messages and bytes sent, dropped messages, per-topic rates) and the event bus counters (events published per topic, webhook deliveries). With format=prometheus the counters are returned in the Prometheus text format.",
+		params: []paramDoc{
+			{"query", "format", "string", "json or prometheus", false},
+		},
+		response: statsResponse{},
+	},
+	"GET /api/v1/ws/clients": {
+		tag:         "websocket",
+		summary:     "List WebSocket clients",
+		description: "Lists the clients connected to /ws, /ws/metrics and the event streams with their subscriptions and dropped messages",
+		response:    []websocket.ClientInfo{},
+	},
+	"DELETE /api/v1/ws/clients/:id": {
+		tag:         "websocket",
+		summary:     "Disconnect a WebSocket client",
+		description: "Closes the connection of a client with a policy violation close frame",
+		params: []paramDoc{
+			{"path", "id", "string", "Client ID", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404},
+	},
+
+	"POST /api/v1/cluster/register": {
+		tag:          "cluster",
+		summary:      "Register an agent",
+		description:  "Called by agents on startup and on every heartbeat, authenticated with the cluster token",
+		clusterToken: true,
+		body:         cluster.Registration{},
+		response:     cluster.Host{},
+		errors:       []int{400, 401},
+	},
+	"GET /api/v1/hosts": {
+		tag:         "cluster",
+		summary:     "List hosts",
+		description: "Lists the agents registered with this controller and whether they are online",
+		response:    []cluster.Host{},
+	},
+	"DELETE /api/v1/hosts/:name": {
+		tag:         "cluster",
+		summary:     "Remove a host",
+		description: "Forgets an agent, it is listed again on its next heartbeat if still running",
+		params: []paramDoc{
+			{"path", "name", "string", "Host name", true},
+		},
+		response: MessageResponse{},
+		errors:   []int{404},
+	},
+	"ANY /api/v1/hosts/:name/proxy/*path": {
+		tag:         "cluster",
+		summary:     "Proxy a request to a host",
+		description: "Forwards a request to the API, WebSocket or event stream endpoints of an agent, e.g. /api/v1/hosts/web1/proxy/api/v1/metrics/all or /api/v1/hosts/web1/proxy/ws/terminal",
+		params: []paramDoc{
+			{"path", "name", "string", "Host name", true},
+			{"path", "path", "string", "Agent path", true},
+		},
+		errors: []int{403, 404, 502},
+	},
+
+	"GET /api/v1/auth/status": {
+		tag:         "auth",
+		summary:     "Get privilege status",
+		description: "Returns current privilege status, whether credentials are stored and the clients locked out after failed logins",
+		response:    privilegeStatusResponse{},
+	},
+	"GET /api/v1/auth/credentials": {
+		tag:         "auth",
+		summary:     "Get credentials validity",
+		description: "Reports whether sudo credentials are stored and when they expire, after auth.credentials_ttl",
+		response:    credentialsResponse{},
+	},
+	"POST /api/v1/auth/credentials": {
+		tag:         "auth",
+		summary:     "Set sudo credentials",
+		description: "Stores sudo password for privileged operations, kept for auth.credentials_ttl. Rejected with 409 when auth.escalation is pkexec or auth.sudo_mode is set. Wrong passwords count as failed logins of auth.lockout.",
+		body:        passwordRequest{},
+		response:    MessageResponse{},
+		errors:      []int{400, 401, 409, 429},
+	},
+	"POST /api/v1/auth/credentials/extend": {
+		tag:         "auth",
+		summary:     "Extend credentials validity",
+		description: "Keeps the stored sudo credentials for another auth.credentials_ttl from now",
+		response:    credentialsResponse{},
+		errors:      []int{404, 500},
+	},
+	"DELETE /api/v1/auth/credentials": {
+		tag:         "auth",
+		summary:     "Clear stored credentials",
+		description: "Removes stored sudo credentials",
+		response:    MessageResponse{},
+	},
+	"POST /api/v1/auth/validate": {
+		tag:         "auth",
+		summary:     "Validate credentials",
+		description: "Tests if provided credentials are valid. Wrong passwords count as failed logins of auth.lockout.",
+		body:        passwordRequest{},
+		response:    validateResponse{},
+		errors:      []int{400, 429},
+	},
+	"POST /api/v1/auth/key/rotate": {
+		tag:         "auth",
+		summary:     "Rotate the credential encryption key",
+		description: "Generates a new install secret and encrypts the stored sudo credentials again with it",
+		response:    MessageResponse{},
+		errors:      []int{500},
+	},
+	"POST /api/v1/auth/elevate": {
+		tag:         "auth",
+		summary:     "Elevate",
+		description: "Checks the sudo password and returns a token standing in for it, valid for auth.elevation_ttl and kept in memory only. Requests sending it in X-Sudo-Token, or the password itself in X-Sudo-Password, run their privileged commands with it instead of the stored credentials. Wrong passwords count as failed logins of auth.lockout.",
+		body:        passwordRequest{},
+		status:      201,
+		response:    elevationResponse{},
+		errors:      []int{400, 401, 409, 429},
+	},
+	"DELETE /api/v1/auth/elevate": {
+		tag:         "auth",
+		summary:     "Revoke an elevation",
+		description: "Revokes the elevation token sent in X-Sudo-Token before it expires",
+		params:      []paramDoc{{"header", "X-Sudo-Token", "string", "Elevation token to revoke", true}},
+		response:    MessageResponse{},
+		errors:      []int{404},
+	},
+	"POST /api/v1/auth/sessions": {
+		tag:         "auth",
+		summary:     "Log in",
+		description: "Creates a session for the basic auth user and sets the nebula_session cookie authenticating the following requests until auth.session_ttl passes or the session is revoked",
+		status:      201,
+		response:    storage.Session{},
+		errors:      []int{400, 503},
+	},
+	"POST /api/v1/auth/ticket": {
+		tag:         "auth",
+		summary:     "Create a stream ticket",
+		description: "Returns a one-time ticket authenticating a WebSocket or event stream as the current user, for clients such as browsers that can't send credentials when opening them. Tickets expire after 30 seconds.",
+		response:    streamTicketResponse{},
+		status:      http.StatusCreated,
+	},
+	"GET /api/v1/auth/sessions": {
+		tag:         "auth",
+		summary:     "List sessions",
+		description: "Returns the sessions that haven't expired or been revoked, newest first. Users other than administrators only see their own.",
+		params:      listParams,
+		response:    ListResponse[storage.Session]{},
+		errors:      []int{400, 503},
+	},
+	"DELETE /api/v1/auth/sessions": {
+		tag:         "auth",
+		summary:     "Revoke the sessions of a user",
+		description: "Revokes every session of a user, who must log in again. Users other than administrators may only revoke their own.",
+		params:      []paramDoc{{"query", "username", "string", "User whose sessions are revoked", true}},
+		response:    MessageResponse{},
+		errors:      []int{400, 403, 503},
+	},
+	"GET /api/v1/auth/oidc/login": {
+		tag:         "auth",
+		summary:     "Log in with OpenID Connect",
+		description: "Redirects the browser to the login page of the auth.oidc provider, which sends it back to the callback",
+		status:      302,
+		errors:      []int{404, 502, 503},
+	},
+	"GET /api/v1/auth/oidc/callback": {
+		tag:         "auth",
+		summary:     "OpenID Connect callback",
+		description: "Completes a login with the provider, checking the state, nonce and ID token. Users in auth.oidc.admin_groups get full access, users in auth.oidc.viewer_groups read-only access. Sets the nebula_session cookie and redirects to the panel.",
+		params: []paramDoc{
+			{"query", "code", "string", "Authorization code issued by the provider", false},
+			{"query", "state", "string", "State of the login started at /api/v1/auth/oidc/login", true},
+		},
+		status: 302,
+		errors: []int{400, 403, 404, 503},
+	},
+	"POST /api/v1/auth/passkeys/registration": {
+		tag:          "auth",
+		summary:      "Start a passkey registration",
+		description:  "Returns the options of navigator.credentials.create for a new passkey of the current user, with binary values base64url encoded. The challenge expires after 5 minutes.",
+		body:         passkeyRegistrationRequest{},
+		optionalBody: true,
+		response:     passkeyCreationResponse{},
+		errors:       []int{400, 404, 503},
+	},
+	"POST /api/v1/auth/passkeys": {
+		tag:         "auth",
+		summary:     "Register a passkey",
+		description: "Checks the response of the authenticator to a registration and stores the passkey. Logins with it get the role the user has now.",
+		body:        passkeyRegisterRequest{},
+		status:      201,
+		response:    storage.Passkey{},
+		errors:      []int{400, 404, 409, 503},
+	},
+	"GET /api/v1/auth/passkeys": {
+		tag:         "auth",
+		summary:     "List passkeys",
+		description: "Returns the passkeys of every user, oldest first",
+		params:      listParams,
+		response:    ListResponse[storage.Passkey]{},
+		errors:      []int{400, 503},
+	},
+	"DELETE /api/v1/auth/passkeys/:id": {
+		tag:      "auth",
+		summary:  "Delete a passkey",
+		response: MessageResponse{},
+		errors:   []int{404, 503},
+	},
+	"POST /api/v1/auth/passkeys/login/options": {
+		tag:          "auth",
+		summary:      "Start a passkey login",
+		description:  "Returns the options of navigator.credentials.get, limited to the passkeys of username when given. Made without credentials.",
+		body:         passkeyLoginRequest{},
+		optionalBody: true,
+		response:     passkeyRequestResponse{},
+		errors:       []int{400, 404, 503},
+	},
+	"POST /api/v1/auth/passkeys/login": {
+		tag:         "auth",
+		summary:     "Log in with a passkey",
+		description: "Checks the response of the authenticator to a login, creates a session and sets the nebula_session cookie. Made without credentials.",
+		body:        passkeyAssertionRequest{},
+		status:      201,
+		response:    storage.Session{},
+		errors:      []int{400, 401, 404, 503},
+	},
+	"DELETE /api/v1/auth/sessions/:id": {
+		tag:         "auth",
+		summary:     "Revoke a session",
+		description: "Revokes a session, the client holding its cookie must log in again. Sessions of other users answer 404 unless the caller is an administrator.",
+		response:    MessageResponse{},
+		errors:      []int{404, 503},
+	},
+
+	"GET /ws": {
+		tag:         "streams",
+		summary:     "Event stream",
+		description: "WebSocket delivering the events of the subscribed topics. Clients send subscribe and unsubscribe messages to change topics, and may resume after a reconnection from the sequence number of the last message received.",
+		params:      streamParams,
+		status:      http.StatusSwitchingProtocols,
+	},
+	"GET /ws/metrics": {
+		tag:         "streams",
+		summary:     "Metrics stream",
+		description: "WebSocket delivering the metrics and update topics, kept for clients that predate topic subscriptions",
+		params:      streamParams,
+		status:      http.StatusSwitchingProtocols,
+	},
+	"GET /ws/files": {
+		tag:         "files",
+		summary:     "Directory changes",
+		description: "WebSocket delivering the changes to the entries of directories. Clients send {\"type\": \"subscribe\", \"payload\": {\"path\": ...}} or unsubscribe, and receive files messages whose event is file.created, file.modified, file.deleted or file.renamed. An overflow message means changes were dropped and listings should be reloaded.",
+		params:      []paramDoc{rootParam},
+		status:      http.StatusSwitchingProtocols,
+	},
+
+	"GET /ws/files/tail": {
+		tag:         "files",
+		summary:     "Follow a file",
+		description: "WebSocket sending the last lines of a file, then the lines appended to it like tail -f, as files messages whose event is file.lines. Like tail -F it follows the path: file.rotated is sent when it names a new file, file.truncated when the file shrinks, and the file is read again from its start. Remote files can't be followed.",
+		params: []paramDoc{
+			{"query", "path", "string", "File followed", true},
+			{"query", "lines", "integer", "Last lines sent first, 10 by default, 10000 at most", false},
+			rootParam,
+		},
+		status: http.StatusSwitchingProtocols,
+		errors: []int{400, 403, 404},
+	},
+
+	"GET /ws/terminal": {
+		tag:         "terminal",
+		summary:     "Terminal session",
+		description: "WebSocket attached to a terminal session, created when it doesn't exist. Binary messages carry the terminal output and input.",
+		params: []paramDoc{
+			{"query", "session", "string", "Session ID, reattached when it exists and belongs to the user, or the user is an administrator", false},
+			{"query", "shell", "string", "Shell to start", false},
+			{"query", "command", "string", "Command to run instead of a shell", false},
+			{"query", "cwd", "string", "Working directory", false},
+			{"query", "cols", "integer", "Columns", false},
+			{"query", "rows", "integer", "Rows", false},
+			{"query", "scrollback", "integer", "Bytes of output kept for reattaching clients", false},
+			{"query", "serial", "string", "Serial device to open instead of a shell", false},
+			{"query", "baud", "integer", "Serial baud rate", false},
+			{"query", "databits", "integer", "Serial data bits", false},
+			{"query", "stopbits", "integer", "Serial stop bits", false},
+			{"query", "parity", "string", "Serial parity", false},
+			{"query", "attach", "string", "tmux or screen session to attach, as type:name", false},
+			{"query", "env", "string", "Environment variable as KEY=value, may be repeated", false},
+			ticketParam,
+		},
+		status: http.StatusSwitchingProtocols,
+		errors: []int{400, 403, 500},
+	},
+
+	"GET /api/v2/metrics": {
+		tag:         "metrics",
+		summary:     "Get all metrics",
+		description: "Returns all system metrics",
+		response:    metrics.AllMetrics{},
+	},
+	"DELETE /api/v2/processes/:pid": {
+		tag:         "processes",
+		summary:     "Terminate a process",
+		description: "Terminates a process by PID",
+		params: []paramDoc{
+			{"path", "pid", "integer", "Process ID", true},
+			{"query", "force", "boolean", "Force kill (SIGKILL)", false},
+		},
+		status: http.StatusNoContent,
+		errors: []int{400, 404, 500},
+	},
+	"PUT /api/v2/services/:name/state": {
+		tag:         "services",
+		summary:     "Set service state",
+		description: "Starts or stops a service, doing nothing when it is already in the requested state",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		body:     serviceStateRequest{},
+		response: service.ServiceInfo{},
+		errors:   []int{400, 404, 500},
+	},
+	"PUT /api/v2/services/:name/enabled": {
+		tag:         "services",
+		summary:     "Set service boot start",
+		description: "Enables or disables a service at boot, doing nothing when it already is",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		body:     serviceEnabledRequest{},
+		response: service.ServiceInfo{},
+		errors:   []int{400, 404, 500},
+	},
+	"POST /api/v2/services/:name/restart": {
+		tag:         "services",
+		summary:     "Restart a service",
+		description: "Restarts a system service",
+		params: []paramDoc{
+			{"path", "name", "string", "Service name", true},
+		},
+		response: service.ServiceInfo{},
+		errors:   []int{404, 500},
+	},
+
+	"GET /api/v2/files/list/*path": {
+		tag:         "files",
+		summary:     "List directory contents",
+		description: "Returns files and directories in a path, with the space left in the root as quota",
+		params: append([]paramDoc{
+			{"path", "path", "string", "Directory path", true},
+			rootParam,
+			remoteParam,
+		}, listParams...),
+		response: fileListResponse{},
+		errors:   []int{400, 403, 404, 500, 502},
+	},
+	"GET /api/v2/files/info/*path": {
+		tag:         "files",
+		summary:     "Get file/directory info",
+		description: "Returns information about a file or directory. Symbolic links are described by their target, with link_target and link_resolved set, and by themselves when broken or leading outside the root.",
+		params: []paramDoc{
+			{"path", "path", "string", "File or directory path", true},
+			rootParam,
+			remoteParam,
+		},
+		response: files.FileInfo{},
+		errors:   []int{403, 404, 500, 502},
+	},
+	"GET /api/v2/files/content/*path": {
+		tag:         "files",
+		summary:     "Read file content",
+		description: "Returns the content of a text file, refusing files over 10 MiB with 413. With offset or length only a part is returned, as a chunk with its offset, length and the file size, so files of any size can be paged: the next chunk starts at offset+length. Chunks don't end in the middle of a UTF-8 character.",
+		params: []paramDoc{
+			{"path", "path", "string", "File path", true},
+			{"query", "offset", "integer", "Byte the chunk starts at, counted from the end when negative to read the tail", false},
+			{"query", "length", "integer", "Bytes read, 10 MiB at most and by default", false},
+			rootParam,
+			remoteParam,
+		},
+		response: contentResponse{},
+		errors:   []int{400, 403, 404, 413, 500, 502},
+	},
+	"GET /api/v2/files/download/*path": {
+		tag:         "files",
+		summary:     "Download a file",
+		description: "Downloads a file, answering Range requests with 206 so downloads can resume and If-Modified-Since with 304. Directories are streamed as zip archives without a Content-Length, in Zip64 format when over 4 GiB.",
+		params: []paramDoc{
+			{"path", "path", "string", "File path", true},
+			{"header", "Range", "string", "Byte ranges to send, e.g. bytes=1024-", false},
+			{"header", "If-Modified-Since", "string", "Answer 304 when the file hasn't changed since", false},
+			rootParam,
+			remoteParam,
+		},
+		produces: "application/octet-stream",
+		errors:   []int{403, 404, 500, 502},
+	},
+	"GET /api/v2/files/search/*path": {
+		tag:         "files",
+		summary:     "Search file contents",
+		description: "Searches the text files below a path for lines matching a regular expression, streamed as newline-delimited JSON as they are found. Binary files and symbolic links are skipped.",
+		params: []paramDoc{
+			{"path", "path", "string", "Directory or file searched", true},
+			{"query", "q", "string", "Regular expression (RE2 syntax)", true},
+			{"query", "literal", "boolean", "Match q as plain text", false},
+			{"query", "ignore_case", "boolean", "Match case-insensitively", false},
+			{"query", "include", "string", "Comma-separated globs of the file names searched, e.g. *.go,*.md", false},
+			{"query", "exclude", "string", "Comma-separated globs of file and directory names skipped, e.g. .git,node_modules", false},
+			{"query", "max_size", "integer", "Skip files larger than this many bytes, 10 MiB by default", false},
+			{"query", "context", "integer", "Lines sent before and after each match", false},
+			{"query", "limit", "integer", "Stop after this many matches, 1000 by default, 0 for no limit", false},
+			rootParam,
+			remoteParam,
+		},
+		response: []files.Match{},
+		errors:   []int{400, 403, 404, 502},
+	},
+	"GET /api/v2/files/tail/*path": {
+		tag:         "files",
+		summary:     "Read the last lines of a file",
+		description: "Returns the last lines of a file, like tail, and the offset of its end. Lines are searched in the last 10 MiB of the file at most. GET /ws/files/tail follows the file.",
+		params: []paramDoc{
+			{"path", "path", "string", "File path", true},
+			{"query", "lines", "integer", "Lines returned, 10 by default, 10000 at most", false},
+			rootParam,
+			remoteParam,
+		},
+		response: files.Tail{},
+		errors:   []int{400, 403, 404, 500, 502},
+	},
+	"GET /api/v2/files/links/*path": {
+		tag:         "files",
+		summary:     "Read a symbolic link",
+		description: "Returns the target stored in a symbolic link and the path it resolves to, following every link, empty when the link is broken",
+		params:      []paramDoc{{"path", "path", "string", "Symbolic link", true}, rootParam, remoteParam},
+		response:    files.Link{},
+		errors:      []int{400, 403, 404, 502},
+	},
+	"PUT /api/v2/files/content": {
+		tag:         "files",
+		summary:     "Write file content",
+		description: "Creates or replaces a file, answering 201 when it is created",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        fileContentRequest{},
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 413, 500, 502, 507},
+	},
+	"PATCH /api/v2/files/content": {
+		tag:         "files",
+		summary:     "Append or patch file content",
+		description: "Writes content at offset, replacing the bytes there and growing the file past its end, or appends it when offset is omitted. Appending creates a missing file, answering 201. Offsets past the end of the file are refused with 400.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        patchContentRequest{},
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 404, 500, 502, 507},
+	},
+	"PUT /api/v2/files/directories": {
+		tag:         "files",
+		summary:     "Create directory",
+		description: "Creates a directory, answering 201 when it is created and 200 when it already exists",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        filePathRequest{},
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 409, 500, 502},
+	},
+	"PUT /api/v2/files/permissions": {
+		tag:         "files",
+		summary:     "Change permissions and ownership",
+		description: "Changes the mode, octal (0755) or symbolic (u+x,go-w), and the owner and group, names or IDs, only IDs on remote hosts, of a file or directory, answering with the changed file. With recursive everything below a directory changes too, except symbolic links.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        permissionsRequest{},
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 404, 500, 502},
+	},
+	"POST /api/v2/files/move": {
+		tag:         "files",
+		summary:     "Move file or directory",
+		description: "Moves or renames a file or directory, never replacing an existing one. Across filesystems the files are copied, keeping modes and modification times, then deleted: the answer is then 202 Accepted with a job reporting the bytes copied in progress.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        moveRequest{},
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 404, 409, 500, 502},
+	},
+	"POST /api/v2/files/copy": {
+		tag:         "files",
+		summary:     "Copy file or directory",
+		description: "Copies a file or directory, keeping modes, modification times and, where allowed, owners, never replacing an existing one. Symbolic links are copied as links, sockets, pipes and devices are left out. Copies of 64 MiB or more run in a job: the answer is then 202 Accepted with a job reporting the bytes copied in progress.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        copyRequest{},
+		status:      http.StatusCreated,
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 404, 409, 500, 502, 507},
+	},
+	"POST /api/v2/files/links": {
+		tag:         "files",
+		summary:     "Create a link",
+		description: "Creates a symbolic link at path pointing to target, stored as given, or with hard a hard link to the file at target. Symbolic link targets must stay inside the root, hard links on the same filesystem.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        linkRequest{},
+		status:      http.StatusCreated,
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 404, 409, 500, 502},
+	},
+	"POST /api/v2/files/upload": {
+		tag:         "files",
+		summary:     "Upload a file",
+		description: "Uploads a file to the directory in the path form field",
+		params:      []paramDoc{rootParam, remoteParam},
+		upload:      "file",
+		formFields:  []string{"path"},
+		status:      http.StatusCreated,
+		response:    files.FileInfo{},
+		errors:      []int{400, 403, 413, 500, 502, 507},
+	},
+	"POST /api/v2/files/compress": {
+		tag:         "files",
+		summary:     "Create an archive",
+		description: "Starts a job archiving files and directories into a zip, tar.gz or tar.zst file inside the root, the format taken from the destination extension when omitted. Level goes from 1, fastest, to 9, smallest. The archive appears once complete.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        compressRequest{},
+		status:      http.StatusAccepted,
+		response:    jobs.Job{},
+		errors:      []int{400, 403, 404, 409, 502},
+	},
+	"GET /api/v2/files/shares": {
+		tag:         "files",
+		summary:     "List share links",
+		description: "Returns the share links that haven't expired, newest first: those the user created or whose root the user may use, and all of them for administrators. The URL downloading a link is only shown to its creator and administrators.",
+		params:      listParams,
+		response:    ListResponse[shareResponse]{},
+		errors:      []int{400, 503},
+	},
+	"POST /api/v2/files/shares": {
+		tag:         "files",
+		summary:     "Create a share link",
+		description: "Creates a signed link downloading a file, or a directory as a zip archive, without authentication. It lasts expires_in seconds, 24 hours by default and 30 days at most, and max_downloads downloads when set. The link stops working when its root is removed or its creator may no longer use it.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        shareRequest{},
+		status:      http.StatusCreated,
+		response:    shareResponse{},
+		errors:      []int{400, 403, 404, 500, 503},
+	},
+	"GET /api/v2/files/roots": {
+		tag:         "files",
+		summary:     "List named roots",
+		description: "Returns the roots configured in files.roots the user may use, whose files the other file endpoints reach with the root parameter. Changes to read-only roots are refused with 403.",
+		params:      listParams,
+		response:    ListResponse[files.Root]{},
+		errors:      []int{400},
+	},
+	"GET /api/v2/files/remotes": {
+		tag:         "files",
+		summary:     "List remote hosts",
+		description: "Returns the remote hosts configured in files.remotes, whose files the other file endpoints reach with the remote parameter over SFTP",
+		params:      listParams,
+		response:    ListResponse[files.Remote]{},
+		errors:      []int{400},
+	},
+	"DELETE /api/v2/files/shares/:id": {
+		tag:         "files",
+		summary:     "Revoke a share link",
+		description: "Revokes a share link, only allowed to its creator and administrators",
+		status:      http.StatusNoContent,
+		errors:      []int{403, 404, 500, 503},
+	},
+	"GET /share/:token": {
+		tag:         "files",
+		summary:     "Download a share link",
+		description: "Downloads the file of a share link without authentication, answering Range requests like other downloads. Every request counts as a download. Invalid, revoked, expired and used up links answer 404.",
+		produces:    "application/octet-stream",
+		errors:      []int{404, 429, 503},
+	},
+	"POST /api/v2/files/uploads": {
+		tag:         "files",
+		summary:     "Start a resumable upload",
+		description: "Starts an upload sent in chunks, for files too large for one request or connections that drop. The Location header names the upload chunks are sent to. The optional checksum is the hex SHA-256 of the whole file, verified once all chunks arrived. Remote hosts don't take resumable uploads, answering 501.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        createUploadRequest{},
+		status:      http.StatusCreated,
+		response:    files.Upload{},
+		errors:      []int{400, 403, 404, 413, 500, 501, 502, 507},
+	},
+	"GET /api/v2/files/uploads/:id": {
+		tag:         "files",
+		summary:     "Get a resumable upload",
+		description: "Returns an unfinished upload, whose offset is where an interrupted upload resumes",
+		params: []paramDoc{
+			{"path", "id", "string", "Upload ID", true},
+			rootParam,
+		},
+		response: files.Upload{},
+		errors:   []int{404},
+	},
+	"PATCH /api/v2/files/uploads/:id": {
+		tag:         "files",
+		summary:     "Send an upload chunk",
+		description: "Appends the request body to an upload. Chunks that don't start at the offset of the upload are refused with 409. The response to the last chunk carries the file, once moved to its path. An upload failing its checksum is discarded with 422.",
+		params: []paramDoc{
+			{"path", "id", "string", "Upload ID", true},
+			{"header", "Upload-Offset", "integer", "Offset the chunk starts at", true},
+		},
+		consumes: "application/octet-stream",
+		response: files.Upload{},
+		errors:   []int{400, 403, 404, 409, 413, 422, 500},
+	},
+	"DELETE /api/v2/files/uploads/:id": {
+		tag:         "files",
+		summary:     "Cancel a resumable upload",
+		description: "Discards an unfinished upload",
+		params: []paramDoc{
+			{"path", "id", "string", "Upload ID", true},
+			rootParam,
+		},
+		status: http.StatusNoContent,
+		errors: []int{404},
+	},
+	"DELETE /api/v2/files": {
+		tag:         "files",
+		summary:     "Delete file or directory",
+		description: "Deletes a file or directory. A symbolic link is deleted itself, never its target.",
+		params:      []paramDoc{rootParam, remoteParam},
+		body:        filePathRequest{},
+		status:      http.StatusNoContent,
+		errors:      []int{400, 403, 404, 500, 502},
+	},
+
+	"POST /api/v2/packages/upgrade": {
+		tag:         "packages",
+		summary:     "Upgrade all packages",
+		description: "Starts a job upgrading all installed packages",
+		status:      http.StatusAccepted,
+		response:    jobs.Job{},
+	},
+	"GET /api/v2/packages/:name": {
+		tag:         "packages",
+		summary:     "Get package info",
+		description: "Returns detailed information about a package",
+		params: []paramDoc{
+			{"path", "name", "string", "Package name", true},
+		},
+		response: packages.PackageInfo{},
+		errors:   []int{404},
+	},
+	"PUT /api/v2/packages/:name": {
+		tag:         "packages",
+		summary:     "Install a package",
+		description: "Starts a job installing the package, or returns it with 200 when it is already installed",
+		params: []paramDoc{
+			{"path", "name", "string", "Package name", true},
+		},
+		status:   http.StatusAccepted,
+		response: jobs.Job{},
+	},
+	"DELETE /api/v2/packages/:name": {
+		tag:         "packages",
+		summary:     "Remove a package",
+		description: "Starts a job removing the package, or answers 204 when it isn't installed",
+		params: []paramDoc{
+			{"path", "name", "string", "Package name", true},
+		},
+		status:   http.StatusAccepted,
+		response: jobs.Job{},
+		errors:   []int{404},
+	},
+	"POST /api/v2/packages/:name/upgrade": {
+		tag:         "packages",
+		summary:     "Upgrade a package",
+		description: "Starts a job updating the package to the latest version",
+		params: []paramDoc{
+			{"path", "name", "string", "Package name", true},
+		},
+		status:   http.StatusAccepted,
+		response: jobs.Job{},
+	},
+
+	"GET /api/v2/jobs": {
+		tag:         "jobs",
+		summary:     "List jobs",
+		description: "Returns a page of the running and recently finished jobs, newest first",
+		params:      listParams,
+		response:    ListResponse[jobs.Job]{},
+		errors:      []int{400},
+	},
+	"GET /api/v2/jobs/:id": {
+		tag:         "jobs",
+		summary:     "Get a job",
+		description: "Returns the status of a job",
+		params: []paramDoc{
+			{"path", "id", "string", "Job ID", true},
+		},
+		response: jobs.Job{},
+		errors:   []int{404},
+	},
+
+	"GET /api/v1/diagnostics": {
+		tag:         "system",
+		summary:     "Get diagnostics",
+		description: "Returns a support bundle: version, runtime and memory statistics, dependency checks and the latest errors logged",
+		params: []paramDoc{
+			{"query", "stacks", "boolean", "Include the stack of every goroutine", false},
+		},
+		response: diagnosticsResponse{},
+	},
+	"GET /api/v1/status": {
+		tag:         "system",
+		summary:     "Get request statistics",
+		description: "Sums up the requests served by the panel since it started: count, 5xx errors, requests in flight, average and 95th percentile latency per route",
+		response:    statusResponse{},
+	},
+	"GET /api/v1/prometheus": {
+		tag:         "system",
+		summary:     "Prometheus metrics",
+		description: "Returns the HTTP request counters and latency histograms per route, the WebSocket hub and the event bus counters in the Prometheus text format",
+		produces:    "text/plain",
+	},
+
+	"GET /events": {
+		tag:         "streams",
+		summary:     "Event stream (Server-Sent Events)",
+		description: "Server-Sent Events fallback of /ws. EventSource resumes automatically with Last-Event-ID.",
+		params:      append(streamParams, paramDoc{"header", "Last-Event-ID", "integer", "Sequence number to resume from", false}),
+		produces:    "text/event-stream",
+	},
+	"GET /events/metrics": {
+		tag:         "streams",
+		summary:     "Metrics stream (Server-Sent Events)",
+		description: "Server-Sent Events fallback of /ws/metrics",
+		params:      append(streamParams, paramDoc{"header", "Last-Event-ID", "integer", "Sequence number to resume from", false}),
+		produces:    "text/event-stream",
+	},
+
+	"GET /health": {
+		tag:         "health",
+		summary:     "Health check",
+		description: "Reports whether the server and its database are usable, answering 503 when the database is not",
+		response:    healthResponse{},
+	},
+	"GET /healthz": {
+		tag:         "health",
+		summary:     "Liveness probe",
+		description: "Reports whether the server is alive and its database intact, answering 503 when it is not",
+		response:    probeResponse{},
+	},
+	"GET /readyz": {
+		tag:         "health",
+		summary:     "Readiness probe",
+		description: "Checks the dependencies of the server: database open and writable, free space of its volume, metrics collection and service manager. Answers 503 when a critical check fails and status degraded when another one does.",
+		response:    probeResponse{},
+	},
+}
@@ -0,0 +1,117 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// AuditHandler handles audit log endpoints
+type AuditHandler struct {
+	storage *storage.Storage
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(store *storage.Storage) *AuditHandler {
+	return &AuditHandler{storage: store}
+}
+
+// Query handles GET /api/v1/audit
+func (h *AuditHandler) Query(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+
+	// The log is scanned in timestamp order, so that is the only sort
+	lq := listQuery(c)
+	if lq.Sort != "" && lq.Sort != "timestamp" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("cannot sort by %q", lq.Sort)})
+		return
+	}
+	filters, err := newMatcher[storage.AuditEntry](ListQuery{Filters: lq.Filters})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	q := storage.AuditQuery{
+		User:      c.Query("user"),
+		Action:    c.Query("action"),
+		Resource:  c.Query("resource"),
+		Text:      lq.Text,
+		Cursor:    lq.Cursor,
+		Limit:     lq.Limit,
+		Ascending: lq.Sort != "" && !lq.Desc,
+		Match:     filters.matches,
+	}
+
+	for param, target := range map[string]*time.Time{"from": &q.From, "to": &q.To} {
+		if v := c.Query(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("invalid %s", param)})
+				return
+			}
+			*target = t
+		}
+	}
+
+	page, err := h.storage.QueryAuditLog(q)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListResponse[storage.AuditEntry]{Items: page.Entries, Total: page.Total, NextCursor: page.Next})
+}
+
+// auditMiddleware records every state-changing API request in the audit log
+// and publishes it on the audit topic of the event bus
+func auditMiddleware(store *storage.Storage, bus *events.Bus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return
+		}
+
+		recordAudit(c, store, bus, c.Request.Method, c.Request.URL.Path, fmt.Sprintf("status %d", c.Writer.Status()))
+	}
+}
+
+// recordAudit adds an entry describing an operation to the audit log, with
+// more detail than the one auditMiddleware records for the request, and
+// publishes it on the audit topic
+func recordAudit(c *gin.Context, store *storage.Storage, bus *events.Bus, action, resource, details string) {
+	entry := storage.AuditEntry{
+		ID:        newID(),
+		Timestamp: time.Now(),
+		Action:    action,
+		Resource:  resource,
+		Details:   details,
+		User:      requestUser(c),
+		IP:        c.ClientIP(),
+	}
+	if store != nil {
+		if err := store.AddAuditLog(entry); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to write audit log", "error", err)
+		}
+	}
+	bus.Publish(events.TopicAudit, "audit.entry", entry)
+}
+
+// newID returns a random identifier
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
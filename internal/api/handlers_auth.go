@@ -1,108 +1,245 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nebula/nebula/internal/auth"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/lockout"
+	"github.com/nebula/nebula/internal/storage"
 )
 
 // AuthHandler handles authentication and privilege endpoints
 type AuthHandler struct {
 	privilegeManager *auth.PrivilegeManager
+	guard            *lockout.Guard
+	bus              *events.Bus
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(pm *auth.PrivilegeManager) *AuthHandler {
-	return &AuthHandler{privilegeManager: pm}
+func NewAuthHandler(pm *auth.PrivilegeManager, guard *lockout.Guard, bus *events.Bus) *AuthHandler {
+	return &AuthHandler{privilegeManager: pm, guard: guard, bus: bus}
 }
 
-// GetPrivilegeStatus godoc
-// @Summary Get privilege status
-// @Description Returns current privilege status and whether credentials are stored
-// @Tags auth
-// @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Router /api/v1/auth/status [get]
+// privilegeStatusResponse reports whether privileged operations can run
+type privilegeStatusResponse struct {
+	IsElevated       bool `json:"is_elevated"`
+	HasCredentials   bool `json:"has_credentials"`
+	RequiresPassword bool `json:"requires_password"`
+	// Escalation is how privileged commands escalate, sudo or pkexec
+	Escalation string `json:"escalation"`
+	// SudoMode is set when the password is never stored, privileged
+	// requests carry it or an elevation token
+	SudoMode bool `json:"sudo_mode"`
+	// Lockouts lists the IP addresses and usernames locked out after failed logins
+	Lockouts []storage.LoginFailures `json:"lockouts"`
+}
+
+// passwordRequest is the body of credential requests
+type passwordRequest struct {
+	Password string `json:"password"`
+}
+
+// credentialsResponse reports how long the stored credentials are kept
+type credentialsResponse struct {
+	HasCredentials bool `json:"has_credentials"`
+	// ExpiresAt is when the credentials are wiped, absent when they are kept until cleared
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// RemainingSeconds is the validity left, 0 without expiry
+	RemainingSeconds int64 `json:"remaining_seconds"`
+}
+
+// elevationResponse carries an elevation token, sent in X-Sudo-Token
+type elevationResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// validateResponse reports whether a password is valid
+type validateResponse struct {
+	Valid bool `json:"valid"`
+}
+
+// GetPrivilegeStatus handles GET /api/v1/auth/status
 func (h *AuthHandler) GetPrivilegeStatus(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"is_elevated":       h.privilegeManager.IsElevated(),
-		"has_credentials":   h.privilegeManager.HasCredentials(),
-		"requires_password": !h.privilegeManager.IsElevated() && !h.privilegeManager.HasCredentials(),
+	c.JSON(http.StatusOK, privilegeStatusResponse{
+		IsElevated:       h.privilegeManager.IsElevated(),
+		HasCredentials:   h.privilegeManager.HasCredentials(),
+		RequiresPassword: h.privilegeManager.RequiresPassword(),
+		Escalation:       h.privilegeManager.Escalation(),
+		SudoMode:         h.privilegeManager.SudoMode(),
+		Lockouts:         h.guard.Lockouts(),
 	})
 }
 
-// SetCredentials godoc
-// @Summary Set sudo credentials
-// @Description Stores sudo password for privileged operations
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Password"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string
-// @Router /api/v1/auth/credentials [post]
+// SetCredentials handles POST /api/v1/auth/credentials
 func (h *AuthHandler) SetCredentials(c *gin.Context) {
-	var req struct {
-		Password string `json:"password"`
-	}
+	var req passwordRequest
 
 	if err := c.BindJSON(&req); err != nil || req.Password == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "password required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "password required"})
+		return
+	}
+	if h.privilegeManager.SudoMode() {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: auth.ErrSudoMode.Error()})
+		return
+	}
+
+	if h.lockedOut(c) {
 		return
 	}
 
 	// Validate credentials
-	if !h.privilegeManager.ValidateCredentials(req.Password) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+	valid := h.privilegeManager.ValidateCredentials(req.Password)
+	h.recordPassword(c, valid)
+	if !valid {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid credentials"})
 		return
 	}
 
 	// Store credentials
-	if err := h.privilegeManager.SetCredentials(req.Password); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to store credentials"})
+	err := h.privilegeManager.SetCredentials(req.Password)
+	if errors.Is(err, auth.ErrCredentialsNotUsed) || errors.Is(err, auth.ErrSudoMode) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to store credentials"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "credentials stored successfully"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "credentials stored successfully"})
+}
+
+// GetCredentials handles GET /api/v1/auth/credentials
+func (h *AuthHandler) GetCredentials(c *gin.Context) {
+	expires, ok := h.privilegeManager.CredentialsExpiry()
+	c.JSON(http.StatusOK, newCredentialsResponse(ok, expires))
 }
 
-// ClearCredentials godoc
-// @Summary Clear stored credentials
-// @Description Removes stored sudo credentials
-// @Tags auth
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Router /api/v1/auth/credentials [delete]
+// ExtendCredentials handles POST /api/v1/auth/credentials/extend
+func (h *AuthHandler) ExtendCredentials(c *gin.Context) {
+	expires, err := h.privilegeManager.ExtendCredentials()
+	if errors.Is(err, auth.ErrNoCredentials) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to extend credentials"})
+		return
+	}
+	c.JSON(http.StatusOK, newCredentialsResponse(true, expires))
+}
+
+// newCredentialsResponse describes credentials expiring at expires, zero
+// for never
+func newCredentialsResponse(ok bool, expires time.Time) credentialsResponse {
+	resp := credentialsResponse{HasCredentials: ok}
+	if ok && !expires.IsZero() {
+		resp.ExpiresAt = &expires
+		resp.RemainingSeconds = int64(max(time.Until(expires), 0).Seconds())
+	}
+	return resp
+}
+
+// ClearCredentials handles DELETE /api/v1/auth/credentials
 func (h *AuthHandler) ClearCredentials(c *gin.Context) {
 	if err := h.privilegeManager.ClearCredentials(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to clear credentials"})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to clear credentials"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "credentials cleared"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "credentials cleared"})
 }
 
-// ValidateCredentials godoc
-// @Summary Validate credentials
-// @Description Tests if provided credentials are valid
-// @Tags auth
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Password"
-// @Success 200 {object} map[string]bool
-// @Router /api/v1/auth/validate [post]
+// ValidateCredentials handles POST /api/v1/auth/validate
 func (h *AuthHandler) ValidateCredentials(c *gin.Context) {
-	var req struct {
-		Password string `json:"password"`
-	}
+	var req passwordRequest
 
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "password required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "password required"})
+		return
+	}
+	if h.lockedOut(c) {
 		return
 	}
 
 	valid := h.privilegeManager.ValidateCredentials(req.Password)
-	c.JSON(http.StatusOK, gin.H{"valid": valid})
+	h.recordPassword(c, valid)
+	c.JSON(http.StatusOK, validateResponse{Valid: valid})
+}
+
+// lockedOut answers 429 to clients locked out after failed logins or sudo
+// password checks, and reports whether it did
+func (h *AuthHandler) lockedOut(c *gin.Context) bool {
+	wait, locked := h.guard.Locked(c.ClientIP(), requestUser(c))
+	if locked {
+		rejectLockedOut(c, wait)
+	}
+	return locked
+}
+
+// recordPassword counts a wrong sudo password against the client like a
+// failed login, so the password can't be guessed through these endpoints
+func (h *AuthHandler) recordPassword(c *gin.Context, valid bool) {
+	user := requestUser(c)
+	if valid {
+		h.guard.Succeed(c.ClientIP(), user)
+		return
+	}
+	h.bus.Publish(events.TopicSecurity, "auth.failed", gin.H{"user": user, "ip": c.ClientIP(), "path": c.Request.URL.Path})
+	if wait := h.guard.Fail(c.ClientIP(), user); wait > 0 {
+		h.bus.Publish(events.TopicSecurity, "auth.locked", gin.H{"user": user, "ip": c.ClientIP(), "seconds": int(wait.Seconds())})
+	}
+}
+
+// RotateKey handles POST /api/v1/auth/key/rotate
+func (h *AuthHandler) RotateKey(c *gin.Context) {
+	if err := h.privilegeManager.RotateKey(); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "credential encryption key rotated"})
+}
+
+// Elevate handles POST /api/v1/auth/elevate
+func (h *AuthHandler) Elevate(c *gin.Context) {
+	var req passwordRequest
+	if err := c.BindJSON(&req); err != nil || req.Password == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "password required"})
+		return
+	}
+	if h.lockedOut(c) {
+		return
+	}
+
+	token, expires, err := h.privilegeManager.Elevate(requestUser(c), req.Password)
+	if err == nil || errors.Is(err, auth.ErrInvalidPassword) {
+		h.recordPassword(c, err == nil)
+	}
+	switch {
+	case errors.Is(err, auth.ErrInvalidPassword):
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, auth.ErrCredentialsNotUsed):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to elevate"})
+		return
+	}
+	c.JSON(http.StatusCreated, elevationResponse{Token: token, ExpiresAt: expires})
+}
+
+// RevokeElevation handles DELETE /api/v1/auth/elevate
+func (h *AuthHandler) RevokeElevation(c *gin.Context) {
+	token := c.GetString(contextElevationKey)
+	if token == "" || !h.privilegeManager.RevokeElevation(token, requestUser(c)) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "elevation not found"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "elevation revoked"})
 }
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/certs"
+	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/service"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// reloadSelf is the reload_services entry that reloads Nebula itself
+const reloadSelf = "nebula"
+
+// CertificatesHandler handles TLS certificate inventory endpoints
+type CertificatesHandler struct {
+	inventory      *certs.Inventory
+	config         *config.Manager
+	serviceManager service.Manager
+	store          *storage.Storage
+	bus            *events.Bus
+}
+
+// NewCertificatesHandler creates a new certificates handler
+func NewCertificatesHandler(inventory *certs.Inventory, cfg *config.Manager, serviceManager service.Manager, store *storage.Storage, bus *events.Bus) *CertificatesHandler {
+	return &CertificatesHandler{inventory: inventory, config: cfg, serviceManager: serviceManager, store: store, bus: bus}
+}
+
+// certificatesResponse lists the certificates of the last scan
+type certificatesResponse struct {
+	Certificates []certs.Certificate `json:"certificates"`
+	ScannedAt    time.Time           `json:"scanned_at"`
+	WarnDays     int                 `json:"warn_days"`
+}
+
+// uploadCertificateRequest is the body of certificate uploads
+type uploadCertificateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Certificate string `json:"certificate" binding:"required"`
+	Key         string `json:"key" binding:"required"`
+}
+
+// reloadRequest names the service to reload
+type reloadRequest struct {
+	Service string `json:"service" binding:"required"`
+}
+
+// List handles GET /api/v1/certificates
+func (h *CertificatesHandler) List(c *gin.Context) {
+	list, scanned := h.inventory.List()
+	if list == nil {
+		list = []certs.Certificate{}
+	}
+	c.JSON(http.StatusOK, certificatesResponse{
+		Certificates: list,
+		ScannedAt:    scanned,
+		WarnDays:     h.inventory.Settings().WarnDays,
+	})
+}
+
+// Scan handles POST /api/v1/certificates/scan
+func (h *CertificatesHandler) Scan(c *gin.Context) {
+	list := h.inventory.Scan()
+	if list == nil {
+		list = []certs.Certificate{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Upload handles POST /api/v1/certificates
+func (h *CertificatesHandler) Upload(c *gin.Context) {
+	var req uploadCertificateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	cfg := h.config.Get().Certificates
+	cert, err := certs.Upload(cfg.UploadDir, req.Name, []byte(req.Certificate), []byte(req.Key), cfg.WarnDays)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, certs.ErrInvalid) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Certificate uploaded", "path", cert.Path, "user", requestUser(c))
+	recordAudit(c, h.store, h.bus, "certificate.upload", cert.Path, cert.Subject+", expires "+cert.NotAfter.Format("2006-01-02"))
+	h.bus.Publish(events.TopicSystem, "certificate.uploaded", gin.H{"certificate": cert, "user": requestUser(c)})
+	h.inventory.Scan()
+
+	c.JSON(http.StatusOK, cert)
+}
+
+// Reload handles POST /api/v1/certificates/reload
+func (h *CertificatesHandler) Reload(c *gin.Context) {
+	var req reloadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	allowed := false
+	for _, name := range h.config.Get().Certificates.ReloadServices {
+		if name == req.Service {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "service not listed in certificates.reload_services"})
+		return
+	}
+
+	user := requestUser(c)
+	var err error
+	switch {
+	case req.Service == reloadSelf:
+		err = h.config.Reload(user)
+	case h.serviceManager == nil:
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "service manager not available"})
+		return
+	default:
+		err = h.serviceManager.Reload(req.Service)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Service reloaded after a certificate change", "service", req.Service, "user", user)
+	recordAudit(c, h.store, h.bus, "certificate.reload", req.Service, "")
+	h.bus.Publish(events.TopicSystem, "certificate.reloaded", gin.H{"service": req.Service, "user": user})
+	c.JSON(http.StatusOK, MessageResponse{Message: req.Service + " reloaded"})
+}
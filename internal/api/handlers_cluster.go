@@ -0,0 +1,99 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/cluster"
+)
+
+// proxyPrefixes are the agent paths the controller forwards requests to
+var proxyPrefixes = []string{"/api/v1/", "/ws", "/events"}
+
+// ClusterHandler handles the controller endpoints of a multi-host setup
+type ClusterHandler struct {
+	registry *cluster.Registry
+}
+
+// NewClusterHandler creates a new cluster handler
+func NewClusterHandler(registry *cluster.Registry) *ClusterHandler {
+	return &ClusterHandler{registry: registry}
+}
+
+// Register handles POST /api/v1/cluster/register
+func (h *ClusterHandler) Register(c *gin.Context) {
+	if !h.registry.Authorized(c.GetHeader(cluster.TokenHeader)) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid cluster token"})
+		return
+	}
+
+	var reg cluster.Registration
+	if err := c.ShouldBindJSON(&reg); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	known, found := h.registry.Get(reg.Name)
+	host, err := h.registry.Register(reg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !found || !known.Online || known.URL != host.URL {
+		slog.InfoContext(c.Request.Context(), "Host registered", "host", host.Name, "client_ip", c.ClientIP(), "url", host.URL)
+	}
+
+	c.JSON(http.StatusOK, host)
+}
+
+// Hosts handles GET /api/v1/hosts
+func (h *ClusterHandler) Hosts(c *gin.Context) {
+	c.JSON(http.StatusOK, h.registry.Hosts())
+}
+
+// RemoveHost handles DELETE /api/v1/hosts/:name
+func (h *ClusterHandler) RemoveHost(c *gin.Context) {
+	if !h.registry.Remove(c.Param("name")) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "host not found"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "host removed"})
+}
+
+// Proxy handles every method of /api/v1/hosts/:name/proxy/*path
+func (h *ClusterHandler) Proxy(c *gin.Context) {
+	host, ok := h.registry.Get(c.Param("name"))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "host not found"})
+		return
+	}
+	if !host.Online {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "host " + host.Name + " is offline"})
+		return
+	}
+
+	path := c.Param("path")
+	if !proxyAllowed(path) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "path not available through the proxy"})
+		return
+	}
+
+	if err := h.registry.Proxy(c.Writer, c.Request, host, path, requestUser(c)); err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+	}
+}
+
+// proxyAllowed reports whether path is an agent endpoint the controller forwards to
+func proxyAllowed(path string) bool {
+	if strings.Contains(path, "..") {
+		return false
+	}
+	for _, prefix := range proxyPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
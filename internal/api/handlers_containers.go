@@ -0,0 +1,241 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/containers"
+	"github.com/nebula/nebula/internal/events"
+)
+
+// ContainersHandler handles Docker and Podman endpoints
+type ContainersHandler struct {
+	manager *containers.Manager
+	bus     *events.Bus
+}
+
+// NewContainersHandler creates a new containers handler, manager is nil
+// when no container runtime was found
+func NewContainersHandler(manager *containers.Manager, bus *events.Bus) *ContainersHandler {
+	return &ContainersHandler{manager: manager, bus: bus}
+}
+
+// available answers 503 when there is no container runtime
+func (h *ContainersHandler) available(c *gin.Context) bool {
+	if h.manager == nil {
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, ErrorResponse{Error: "container runtime not available"})
+		return false
+	}
+	return true
+}
+
+// runtimeResponse describes the container runtime
+type runtimeResponse struct {
+	Runtime  string `json:"runtime"`
+	Endpoint string `json:"endpoint"`
+}
+
+// pullRequest names the image to pull
+type pullRequest struct {
+	Image string `json:"image" binding:"required"`
+}
+
+// Runtime handles GET /api/v1/containers/runtime
+func (h *ContainersHandler) Runtime(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	c.JSON(http.StatusOK, runtimeResponse{Runtime: h.manager.Runtime(), Endpoint: h.manager.Endpoint()})
+}
+
+// List handles GET /api/v1/containers
+func (h *ContainersHandler) List(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	list, err := h.manager.List(c.Query("all") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// Inspect handles GET /api/v1/containers/:id
+func (h *ContainersHandler) Inspect(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	raw, err := h.manager.Inspect(c.Param("id"))
+	if err != nil {
+		containerError(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", raw)
+}
+
+// Start handles POST /api/v1/containers/:id/start
+func (h *ContainersHandler) Start(c *gin.Context) {
+	h.action(c, h.manager.Start, "container.started", "container started")
+}
+
+// Stop handles POST /api/v1/containers/:id/stop
+func (h *ContainersHandler) Stop(c *gin.Context) {
+	h.action(c, h.manager.Stop, "container.stopped", "container stopped")
+}
+
+// Restart handles POST /api/v1/containers/:id/restart
+func (h *ContainersHandler) Restart(c *gin.Context) {
+	h.action(c, h.manager.Restart, "container.restarted", "container restarted")
+}
+
+// action changes the state of a container and announces it on the event bus
+func (h *ContainersHandler) action(c *gin.Context, run func(string) error, eventType, message string) {
+	if !h.available(c) {
+		return
+	}
+	id := c.Param("id")
+	if err := run(id); err != nil {
+		containerError(c, err)
+		return
+	}
+	h.bus.Publish(events.TopicContainers, eventType, gin.H{"id": id, "user": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: message})
+}
+
+// Logs handles GET /api/v1/containers/:id/logs
+func (h *ContainersHandler) Logs(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	opts := containers.LogOptions{Tail: 100, Follow: c.Query("follow") == "true"}
+	if v := c.Query("tail"); v != "" {
+		tail, err := strconv.Atoi(v)
+		if err != nil || tail < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid tail"})
+			return
+		}
+		opts.Tail = tail
+	}
+	if v := c.Query("since"); v != "" {
+		since, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid since"})
+			return
+		}
+		opts.Since = since
+	}
+
+	id := c.Param("id")
+	if !opts.Follow {
+		lines := []containers.LogLine{}
+		err := h.manager.Logs(c.Request.Context(), id, opts, func(line containers.LogLine) error {
+			lines = append(lines, line)
+			return nil
+		})
+		if err != nil {
+			containerError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, lines)
+		return
+	}
+
+	// Headers are only sent with the first line, so errors before it are still reported as JSON
+	started := false
+	enc := json.NewEncoder(c.Writer)
+	err := h.manager.Logs(c.Request.Context(), id, opts, func(line containers.LogLine) error {
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+			started = true
+		}
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil && !started {
+		containerError(c, err)
+	}
+}
+
+// Stats handles GET /api/v1/containers/:id/stats
+func (h *ContainersHandler) Stats(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	stats, err := h.manager.Stats(c.Param("id"))
+	if err != nil {
+		containerError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// Images handles GET /api/v1/containers/images
+func (h *ContainersHandler) Images(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	images, err := h.manager.Images()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, images)
+}
+
+// Pull handles POST /api/v1/containers/images/pull
+func (h *ContainersHandler) Pull(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	var req pullRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.manager.Pull(c.Request.Context(), req.Image); err != nil {
+		containerError(c, err)
+		return
+	}
+	h.bus.Publish(events.TopicContainers, "image.pulled", gin.H{"image": req.Image, "user": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: "image pulled"})
+}
+
+// Prune handles POST /api/v1/containers/prune
+func (h *ContainersHandler) Prune(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	report, err := h.manager.Prune()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.bus.Publish(events.TopicContainers, "containers.pruned", gin.H{"report": report, "user": requestUser(c)})
+	c.JSON(http.StatusOK, report)
+}
+
+// containerError answers with 404 for missing containers and images, 400
+// for invalid names and 500 otherwise
+func containerError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, containers.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, containers.ErrInvalidName):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
@@ -1,34 +1,152 @@
 package api
 
 import (
-	"io"
+	"errors"
+	"log/slog"
+	"mime"
 	"net/http"
 	"path/filepath"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
 	"github.com/nebula/nebula/internal/files"
+	"github.com/nebula/nebula/internal/jobs"
+	"github.com/nebula/nebula/internal/storage"
+	"github.com/nebula/nebula/internal/websocket"
 )
 
 // FilesHandler handles file manager endpoints
 type FilesHandler struct {
 	manager *files.Manager
+	// roots are the directories v2 endpoints reach with the root parameter
+	roots *files.Roots
+	// remotes are the hosts v2 endpoints reach with the remote parameter
+	remotes *files.Remotes
+	bus     *events.Bus
+	jobs    *jobs.Manager
+	// storage keeps the share links
+	storage *storage.Storage
 }
 
 // NewFilesHandler creates a new files handler
-func NewFilesHandler(manager *files.Manager) *FilesHandler {
-	return &FilesHandler{manager: manager}
+func NewFilesHandler(manager *files.Manager, roots *files.Roots, remotes *files.Remotes, bus *events.Bus, jobManager *jobs.Manager, store *storage.Storage) *FilesHandler {
+	return &FilesHandler{manager: manager, roots: roots, remotes: remotes, bus: bus, jobs: jobManager, storage: store}
 }
 
-// List godoc
-// @Summary List directory contents
-// @Description Returns files and directories in a path
-// @Tags files
-// @Produce json
-// @Param path query string true "Directory path"
-// @Success 200 {array} files.FileInfo
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/list [get]
+const (
+	// rootKey is the context key of the named root a request works on
+	rootKey = "files.root"
+	// remoteKey is the context key of the remote host a request works on
+	remoteKey = "files.remote"
+)
+
+// managerFor returns the manager of the named root or host given by the
+// root or remote query parameter, the main one without them. Unknown
+// roots and hosts are answered with 404, roots the user may not use with
+// 403.
+func (h *FilesHandler) managerFor(c *gin.Context) (*files.Manager, bool) {
+	rootName, name := c.Query("root"), c.Query("remote")
+	if rootName != "" && name != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "root and remote can't be used together"})
+		return nil, false
+	}
+	if rootName != "" {
+		return h.rootManager(c, rootName)
+	}
+	if name == "" {
+		return h.manager, true
+	}
+	var m *files.Manager
+	if h.remotes != nil {
+		m = h.remotes.Get(name)
+	}
+	if m == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "remote host not found: " + name})
+		return nil, false
+	}
+	c.Set(remoteKey, name)
+	return m, true
+}
+
+// rootManager returns the manager of a named root the user may use
+func (h *FilesHandler) rootManager(c *gin.Context, name string) (*files.Manager, bool) {
+	var root files.Root
+	var m *files.Manager
+	if h.roots != nil {
+		root, m = h.roots.Get(name)
+	}
+	if m == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "root not found: " + name})
+		return nil, false
+	}
+	if !root.Allows(requestUser(c)) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "root not allowed: " + name})
+		return nil, false
+	}
+	c.Set(rootKey, name)
+	return m, true
+}
+
+// Roots handles GET /api/v2/files/roots, listing the named roots the user
+// may use
+func (h *FilesHandler) Roots(c *gin.Context) {
+	roots := []files.Root{}
+	if h.roots != nil {
+		roots = h.roots.List(requestUser(c))
+	}
+	respondList(c, listQuery(c), roots)
+}
+
+// Remotes handles GET /api/v2/files/remotes, listing the remote hosts
+func (h *FilesHandler) Remotes(c *gin.Context) {
+	remotes := []files.Remote{}
+	if h.remotes != nil {
+		remotes = h.remotes.List()
+	}
+	respondList(c, listQuery(c), remotes)
+}
+
+// pathRequest names a file or directory
+type pathRequest struct {
+	Path string `json:"path"`
+}
+
+// renameRequest is the body of renames
+type renameRequest struct {
+	OldPath string `json:"old_path"`
+	NewPath string `json:"new_path"`
+}
+
+// writeRequest is the body of file writes
+type writeRequest struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// permissionsRequest changes the mode, owner or group of a file
+type permissionsRequest struct {
+	Path string `json:"path" binding:"required"`
+	// Mode is octal, e.g. 0755, or symbolic, e.g. u+x,go-w
+	Mode string `json:"mode"`
+	// Owner and Group are names or numeric IDs
+	Owner string `json:"owner"`
+	Group string `json:"group"`
+	// Recursive changes everything below a directory too
+	Recursive bool `json:"recursive"`
+}
+
+// uploadResponse reports the name an uploaded file was saved as
+type uploadResponse struct {
+	Message  string `json:"message"`
+	Filename string `json:"filename"`
+}
+
+// contentResponse holds the content of a text file
+type contentResponse struct {
+	Content string `json:"content"`
+}
+
+// List handles GET /api/v1/files/list
 func (h *FilesHandler) List(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
@@ -37,79 +155,84 @@ func (h *FilesHandler) List(c *gin.Context) {
 
 	list, err := h.manager.List(path)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, list)
+	respondFiles(c, h.manager, list)
 }
 
-// Info godoc
-// @Summary Get file/directory info
-// @Description Returns information about a file or directory
-// @Tags files
-// @Produce json
-// @Param path query string true "File or directory path"
-// @Success 200 {object} files.FileInfo
-// @Failure 404 {object} map[string]string
-// @Router /api/v1/files/info [get]
+// Info handles GET /api/v1/files/info
 func (h *FilesHandler) Info(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
 		return
 	}
 
 	info, err := h.manager.Info(path)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, info)
 }
 
-// Download godoc
-// @Summary Download a file
-// @Description Downloads a file or directory (as zip)
-// @Tags files
-// @Produce octet-stream
-// @Param path query string true "File path"
-// @Success 200 {file} binary
-// @Failure 404 {object} map[string]string
-// @Router /api/v1/files/download [get]
+// Download handles GET /api/v1/files/download
 func (h *FilesHandler) Download(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
 		return
 	}
 
-	reader, size, err := h.manager.Download(path)
+	h.serveDownload(c, h.manager, path, func(c *gin.Context, err error) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	})
+}
+
+// serveDownload sends the file at path of m with http.ServeContent, which
+// answers Range requests so downloads can resume, and If-Modified-Since
+// with 304. Directories are sent as zip archives streamed while they are
+// built, without a Content-Length. fail answers errors opening the path.
+func (h *FilesHandler) serveDownload(c *gin.Context, m *files.Manager, path string, fail func(*gin.Context, error)) {
+	file, info, err := m.Open(path)
+	if errors.Is(err, files.ErrIsDir) {
+		c.Header("Content-Disposition", attachment(downloadName(path)+".zip"))
+		c.Header("Content-Type", "application/zip")
+		c.Status(http.StatusOK)
+		if err := m.WriteZip(path, c.Writer); err != nil {
+			// The headers are sent already, the client gets a truncated archive
+			slog.WarnContext(c.Request.Context(), "Failed to stream zip archive", "path", path, "error", err)
+		}
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		fail(c, err)
 		return
 	}
-	defer reader.Close()
+	defer file.Close()
 
-	filename := filepath.Base(path)
-	c.Header("Content-Disposition", "attachment; filename="+filename)
-	c.Header("Content-Length", string(rune(size)))
+	c.Header("Content-Disposition", attachment(downloadName(path)))
 	c.Header("Content-Type", "application/octet-stream")
+	http.ServeContent(c.Writer, c.Request, info.Name(), info.ModTime(), file)
+}
 
-	io.Copy(c.Writer, reader)
+// downloadName returns the name a download of path is saved as
+func downloadName(path string) string {
+	name := filepath.Base(filepath.Clean("/" + path))
+	if name == "/" || name == `\` {
+		return "files"
+	}
+	return name
 }
 
-// Upload godoc
-// @Summary Upload a file
-// @Description Uploads a file to a directory
-// @Tags files
-// @Accept multipart/form-data
-// @Produce json
-// @Param path query string true "Destination directory"
-// @Param file formData file true "File to upload"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/upload [post]
+// attachment returns a Content-Disposition saving the response as
+// filename, encoded for names that aren't plain ASCII
+func attachment(filename string) string {
+	return mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+}
+
+// Upload handles POST /api/v1/files/upload
 func (h *FilesHandler) Upload(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
@@ -118,152 +241,200 @@ func (h *FilesHandler) Upload(c *gin.Context) {
 
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "file required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file required"})
 		return
 	}
 	defer file.Close()
 
 	if err := h.manager.Upload(path, file, header.Filename); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "file uploaded", "filename": header.Filename})
+	h.publish(c, "file.uploaded", gin.H{"path": filepath.Join(path, header.Filename)})
+	c.JSON(http.StatusOK, uploadResponse{Message: "file uploaded", Filename: header.Filename})
 }
 
-// Mkdir godoc
-// @Summary Create directory
-// @Description Creates a new directory
-// @Tags files
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Path"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/mkdir [post]
+// Mkdir handles POST /api/v1/files/mkdir
 func (h *FilesHandler) Mkdir(c *gin.Context) {
-	var req struct {
-		Path string `json:"path"`
-	}
+	var req pathRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request"})
 		return
 	}
 
 	if err := h.manager.CreateDir(req.Path); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "directory created"})
+	h.publish(c, "file.created", gin.H{"path": req.Path, "dir": true})
+	c.JSON(http.StatusOK, MessageResponse{Message: "directory created"})
 }
 
-// Delete godoc
-// @Summary Delete file or directory
-// @Description Deletes a file or directory
-// @Tags files
-// @Produce json
-// @Param path query string true "Path to delete"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/delete [delete]
+// Delete handles DELETE /api/v1/files/delete
 func (h *FilesHandler) Delete(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
 		return
 	}
 
 	if err := h.manager.Delete(path); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "deleted"})
+	h.publish(c, "file.deleted", gin.H{"path": path})
+	c.JSON(http.StatusOK, MessageResponse{Message: "deleted"})
 }
 
-// Rename godoc
-// @Summary Rename file or directory
-// @Description Renames a file or directory
-// @Tags files
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Old and new paths"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/rename [put]
+// Rename handles PUT /api/v1/files/rename
 func (h *FilesHandler) Rename(c *gin.Context) {
-	var req struct {
-		OldPath string `json:"old_path"`
-		NewPath string `json:"new_path"`
-	}
+	var req renameRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request"})
 		return
 	}
 
-	if err := h.manager.Rename(req.OldPath, req.NewPath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.manager.Move(req.OldPath, req.NewPath, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "renamed"})
+	h.publish(c, "file.renamed", gin.H{"path": req.NewPath, "old_path": req.OldPath})
+	c.JSON(http.StatusOK, MessageResponse{Message: "renamed"})
 }
 
-// Read godoc
-// @Summary Read file content
-// @Description Returns the content of a text file
-// @Tags files
-// @Produce json
-// @Param path query string true "File path"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/read [get]
+// Read handles GET /api/v1/files/read
 func (h *FilesHandler) Read(c *gin.Context) {
 	path := c.Query("path")
 	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "path required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
 		return
 	}
 
 	content, err := h.manager.Read(path)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"content": string(content)})
+	c.JSON(http.StatusOK, contentResponse{Content: string(content)})
 }
 
-// Write godoc
-// @Summary Write file content
-// @Description Writes content to a file
-// @Tags files
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Path and content"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/files/write [put]
+// Write handles PUT /api/v1/files/write
 func (h *FilesHandler) Write(c *gin.Context) {
-	var req struct {
-		Path    string `json:"path"`
-		Content string `json:"content"`
-	}
+	var req writeRequest
 	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request"})
 		return
 	}
 
 	if err := h.manager.Write(req.Path, []byte(req.Content)); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "file written"})
+	h.publish(c, "file.written", gin.H{"path": req.Path})
+	c.JSON(http.StatusOK, MessageResponse{Message: "file written"})
+}
+
+// Permissions handles PUT /api/v1/files/permissions
+func (h *FilesHandler) Permissions(c *gin.Context) {
+	if _, ok := h.setPermissions(c, h.manager); ok {
+		c.JSON(http.StatusOK, MessageResponse{Message: "permissions changed"})
+	}
+}
+
+// setPermissions applies a permissionsRequest with m, answering the
+// request when it fails
+func (h *FilesHandler) setPermissions(c *gin.Context, m *files.Manager) (permissionsRequest, bool) {
+	var req permissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return req, false
+	}
+	if req.Mode == "" && req.Owner == "" && req.Group == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "mode, owner or group required"})
+		return req, false
+	}
+
+	if req.Mode != "" {
+		if err := m.SetPermissions(req.Path, req.Mode, req.Recursive); err != nil {
+			fileError(c, err)
+			return req, false
+		}
+	}
+	if req.Owner != "" || req.Group != "" {
+		if err := m.SetOwner(req.Path, req.Owner, req.Group, req.Recursive); err != nil {
+			fileError(c, err)
+			return req, false
+		}
+	}
+
+	h.publish(c, "file.permissions", gin.H{"path": req.Path, "mode": req.Mode, "owner": req.Owner, "group": req.Group, "recursive": req.Recursive})
+	return req, true
+}
+
+// Watch handles GET /ws/files, sending the changes to the directories the
+// client subscribes to
+func (h *FilesHandler) Watch(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	websocket.HandleWatch(c.Writer, c.Request, func(path string, send func(string, interface{})) (func(), error) {
+		return m.Watch(path, func(change files.Change) {
+			send("file."+change.Kind, change)
+		})
+	})
+}
+
+// Follow handles GET /ws/files/tail, sending the last lines of the file at
+// path then the lines appended to it, like tail -f
+func (h *FilesHandler) Follow(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+	lines, ok := tailLines(c)
+	if !ok {
+		return
+	}
+	// Missing files and directories are refused before upgrading
+	tail, err := m.Tail(path, lines)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	websocket.HandleFollow(c.Writer, c.Request, func(send func(string, interface{})) (func(), error) {
+		send("file."+files.FollowLines, files.FollowEvent{Kind: files.FollowLines, Path: path, Lines: tail.Lines, Offset: tail.Offset})
+		return m.Follow(path, tail.Offset, func(event files.FollowEvent) {
+			send("file."+event.Kind, event)
+		})
+	})
+}
+
+// publish announces a change made through the file manager on the event bus
+func (h *FilesHandler) publish(c *gin.Context, eventType string, data gin.H) {
+	data["user"] = requestUser(c)
+	sourceOf(c, data)
+	h.bus.Publish(events.TopicFiles, eventType, data)
+}
+
+// sourceOf tags data with the named root or remote host of the request
+func sourceOf(c *gin.Context, data gin.H) {
+	if root := c.GetString(rootKey); root != "" {
+		data["root"] = root
+	}
+	if remote := c.GetString(remoteKey); remote != "" {
+		data["remote"] = remote
+	}
 }
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/files"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+const (
+	// defaultShareExpiry is how long share links last unless given
+	defaultShareExpiry = 24 * time.Hour
+	// maxShareExpiry is the longest a share link may last
+	maxShareExpiry = 30 * 24 * time.Hour
+)
+
+// shareRequest creates a share link
+type shareRequest struct {
+	Path string `json:"path" binding:"required"`
+	// ExpiresIn is the lifetime of the link in seconds, 24 hours when 0
+	ExpiresIn int `json:"expires_in"`
+	// MaxDownloads limits the downloads of the link, 0 for no limit
+	MaxDownloads int `json:"max_downloads"`
+}
+
+// shareResponse is a share link with the URL downloading it
+type shareResponse struct {
+	storage.ShareLink
+	// URL is only shown to the creator of the link and administrators
+	URL string `json:"url,omitempty"`
+}
+
+// CreateShare handles POST /api/v2/files/shares, answering with the link
+// and the URL anyone may download the file at. The file is on the named
+// root or remote host of the request, like other file endpoints.
+func (h *FilesHandler) CreateShare(c *gin.Context) {
+	if !h.sharesAvailable(c) {
+		return
+	}
+	var req shareRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+	expiry := defaultShareExpiry
+	if req.ExpiresIn != 0 {
+		expiry = time.Duration(req.ExpiresIn) * time.Second
+	}
+	if expiry <= 0 || expiry > maxShareExpiry {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("expires_in must be between 1 and %d seconds", int(maxShareExpiry.Seconds()))})
+		return
+	}
+	if req.MaxDownloads < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "max_downloads must not be negative"})
+		return
+	}
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	if _, err := m.Info(req.Path); err != nil {
+		fileError(c, err)
+		return
+	}
+
+	now := time.Now()
+	link := storage.ShareLink{
+		ID:           newShareID(),
+		Path:         req.Path,
+		CreatedBy:    requestUser(c),
+		Root:         c.GetString(rootKey),
+		Remote:       c.GetString(remoteKey),
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(expiry),
+		MaxDownloads: req.MaxDownloads,
+	}
+	if err := h.storage.SaveShareLink(link); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	share, err := h.shareResponse(c, link)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.publish(c, "file.shared", gin.H{"path": link.Path, "id": link.ID, "expires_at": link.ExpiresAt})
+	c.JSON(http.StatusCreated, share)
+}
+
+// ListShares handles GET /api/v2/files/shares, listing the links the user
+// created or whose files the user may access. Only their creator and
+// administrators see the URLs.
+func (h *FilesHandler) ListShares(c *gin.Context) {
+	if !h.sharesAvailable(c) {
+		return
+	}
+	links, err := h.storage.ListShareLinks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	user, admin := requestUser(c), isAdmin(c)
+	shares := make([]shareResponse, 0, len(links))
+	for _, link := range links {
+		owned := admin || link.CreatedBy == user
+		if !owned && !h.shareVisible(link, user) {
+			continue
+		}
+		share := shareResponse{ShareLink: link}
+		if owned {
+			if share, err = h.shareResponse(c, link); err != nil {
+				c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+				return
+			}
+		}
+		shares = append(shares, share)
+	}
+	respondList(c, listQuery(c), shares)
+}
+
+// DeleteShare handles DELETE /api/v2/files/shares/:id, revoking the link.
+// Only its creator and administrators may revoke it.
+func (h *FilesHandler) DeleteShare(c *gin.Context) {
+	if !h.sharesAvailable(c) {
+		return
+	}
+	link, err := h.storage.GetShareLink(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if link == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "share link not found"})
+		return
+	}
+	if link.CreatedBy != requestUser(c) && !isAdmin(c) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "share link created by another user"})
+		return
+	}
+	if err := h.storage.DeleteShareLink(link.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.publish(c, "file.unshared", shareSource(*link, gin.H{"path": link.Path, "id": link.ID}))
+	c.Status(http.StatusNoContent)
+}
+
+// DownloadShare handles GET /share/:token, downloading the file of a share
+// link without authentication. Every request counts as a download, Range
+// requests resuming one too.
+func (h *FilesHandler) DownloadShare(c *gin.Context) {
+	if !h.sharesAvailable(c) {
+		return
+	}
+	// Invalid, revoked, expired and used up links look the same
+	notFound := func() {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "share link not found or expired"})
+	}
+
+	id, _, ok := strings.Cut(c.Param("token"), ".")
+	if !ok {
+		notFound()
+		return
+	}
+	link, err := h.storage.GetShareLink(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if link == nil {
+		notFound()
+		return
+	}
+	token, err := h.shareToken(*link)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !hmac.Equal([]byte(token), []byte(c.Param("token"))) {
+		notFound()
+		return
+	}
+	m := h.shareManager(*link)
+	if m == nil {
+		notFound()
+		return
+	}
+
+	link, err = h.storage.UseShareLink(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if link == nil {
+		notFound()
+		return
+	}
+
+	h.bus.Publish(events.TopicFiles, "file.downloaded", shareSource(*link, gin.H{"path": link.Path, "share": link.ID, "downloads": link.Downloads, "ip": c.ClientIP()}))
+	h.serveDownload(c, m, link.Path, func(c *gin.Context, err error) { notFound() })
+}
+
+// shareManager returns the manager of the files of a share link, nil when
+// its root or remote host is gone or its creator may no longer use the root
+func (h *FilesHandler) shareManager(link storage.ShareLink) *files.Manager {
+	switch {
+	case link.Root != "":
+		if h.roots == nil {
+			return nil
+		}
+		root, m := h.roots.Get(link.Root)
+		if m == nil || !root.Allows(link.CreatedBy) {
+			return nil
+		}
+		return m
+	case link.Remote != "":
+		if h.remotes == nil {
+			return nil
+		}
+		return h.remotes.Get(link.Remote)
+	}
+	return h.manager
+}
+
+// shareSource tags data with the named root or remote host of a share link
+func shareSource(link storage.ShareLink, data gin.H) gin.H {
+	if link.Root != "" {
+		data["root"] = link.Root
+	}
+	if link.Remote != "" {
+		data["remote"] = link.Remote
+	}
+	return data
+}
+
+// shareVisible reports whether user may access the files of a share link
+func (h *FilesHandler) shareVisible(link storage.ShareLink, user string) bool {
+	if link.Root == "" {
+		return true
+	}
+	if h.roots == nil {
+		return false
+	}
+	root, m := h.roots.Get(link.Root)
+	return m != nil && root.Allows(user)
+}
+
+// sharesAvailable answers 503 when there is no storage to keep share
+// links in
+func (h *FilesHandler) sharesAvailable(c *gin.Context) bool {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return false
+	}
+	return true
+}
+
+// shareResponse adds the download URL to a share link
+func (h *FilesHandler) shareResponse(c *gin.Context, link storage.ShareLink) (shareResponse, error) {
+	token, err := h.shareToken(link)
+	if err != nil {
+		return shareResponse{}, err
+	}
+	return shareResponse{ShareLink: link, URL: basePath(c) + "/share/" + token}, nil
+}
+
+// shareToken returns the token of a share link: its ID and a signature of
+// the ID, path, expiry and root or remote host, so a token can't be made up
+// or moved to another file
+func (h *FilesHandler) shareToken(link storage.ShareLink) (string, error) {
+	key, err := h.storage.ShareKey()
+	if err != nil {
+		return "", err
+	}
+	signed := link.ID + "\x00" + link.Path + "\x00" + strconv.FormatInt(link.ExpiresAt.Unix(), 10)
+	if link.Root != "" || link.Remote != "" {
+		signed += "\x00" + link.Root + "\x00" + link.Remote
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return link.ID + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// newShareID returns a random share link ID
+func newShareID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// uploadOffsetHeader carries the offset a chunk starts at in requests, and
+// the bytes received in responses
+const uploadOffsetHeader = "Upload-Offset"
+
+// createUploadRequest starts a resumable upload
+type createUploadRequest struct {
+	Path string `json:"path" binding:"required"`
+	Size int64  `json:"size" binding:"required"`
+	// Checksum is the SHA-256 of the whole file, hex encoded, verified
+	// once the upload is complete
+	Checksum string `json:"checksum"`
+}
+
+// CreateUpload handles POST /api/v2/files/uploads, answering with the
+// upload and its location chunks are sent to
+func (h *FilesHandler) CreateUpload(c *gin.Context) {
+	var req createUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path and size required"})
+		return
+	}
+
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	upload, err := m.CreateUpload(req.Path, req.Size, req.Checksum)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	// Chunks go to the manager the upload was created on
+	location := basePath(c) + "/api/v2/files/uploads/" + upload.ID
+	if root := c.GetString(rootKey); root != "" {
+		location += "?root=" + url.QueryEscape(root)
+	}
+	c.Header("Location", location)
+	c.Header(uploadOffsetHeader, "0")
+	c.JSON(http.StatusCreated, upload)
+}
+
+// GetUpload handles GET /api/v2/files/uploads/:id, telling a client
+// resuming an upload where to continue
+func (h *FilesHandler) GetUpload(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	upload, err := m.GetUpload(c.Param("id"))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	c.JSON(http.StatusOK, upload)
+}
+
+// WriteChunk handles PATCH /api/v2/files/uploads/:id, appending the request
+// body at the offset in the Upload-Offset header. The upload answering the
+// last chunk carries the assembled file.
+func (h *FilesHandler) WriteChunk(c *gin.Context) {
+	offset, err := strconv.ParseInt(c.GetHeader(uploadOffsetHeader), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: uploadOffsetHeader + " header required"})
+		return
+	}
+
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	upload, err := m.WriteChunk(c.Param("id"), offset, c.Request.Body)
+	if upload != nil {
+		c.Header(uploadOffsetHeader, strconv.FormatInt(upload.Offset, 10))
+	}
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	if upload.File != nil {
+		h.publish(c, "file.uploaded", gin.H{"path": upload.Path})
+	}
+	c.JSON(http.StatusOK, upload)
+}
+
+// CancelUpload handles DELETE /api/v2/files/uploads/:id
+func (h *FilesHandler) CancelUpload(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	if err := m.CancelUpload(c.Param("id")); err != nil {
+		fileError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,670 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/files"
+	"github.com/nebula/nebula/internal/jobs"
+)
+
+// compressQueue serializes archive creation, which is heavy on CPU and disk
+const compressQueue = "files.compress"
+
+// moveQueue serializes moves across filesystems and large copies, which
+// copy everything
+const moveQueue = "files.move"
+
+// copyJobSize is the size from which copies run in a job rather than
+// during the request
+const copyJobSize = 64 * 1024 * 1024
+
+// moveRequest is the body of moves
+type moveRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+}
+
+// copyRequest is the body of copies
+type copyRequest struct {
+	From string `json:"from" binding:"required"`
+	To   string `json:"to" binding:"required"`
+}
+
+// filePathRequest names a file or directory
+type filePathRequest struct {
+	Path string `json:"path" binding:"required"`
+}
+
+// fileContentRequest is the body of file writes
+type fileContentRequest struct {
+	Path    string `json:"path" binding:"required"`
+	Content string `json:"content"`
+}
+
+// patchContentRequest writes content into a file at offset, at its end
+// when offset is omitted
+type patchContentRequest struct {
+	Path    string `json:"path" binding:"required"`
+	Content string `json:"content"`
+	Offset  *int64 `json:"offset"`
+}
+
+// linkRequest creates a symbolic or, with hard, a hard link at path
+type linkRequest struct {
+	Path   string `json:"path" binding:"required"`
+	Target string `json:"target" binding:"required"`
+	Hard   bool   `json:"hard"`
+}
+
+// compressRequest archives files and directories into a new file
+type compressRequest struct {
+	Paths       []string `json:"paths" binding:"required,min=1"`
+	Destination string   `json:"destination" binding:"required"`
+	// Format is zip, tar.gz or tar.zst, taken from the extension of the
+	// destination when empty
+	Format string `json:"format"`
+	// Level is the compression level from 1, fastest, to 9, smallest
+	Level int `json:"level"`
+}
+
+// ListPath handles GET /api/v2/files/list/*path
+func (h *FilesHandler) ListPath(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	list, err := m.List(pathParam(c))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	respondFiles(c, m, list)
+}
+
+// fileListResponse is a page of a directory with the space left in its root
+type fileListResponse struct {
+	ListResponse[files.FileInfo]
+	// Quota is missing for remote roots, whose space isn't known
+	Quota *files.Quota `json:"quota,omitempty"`
+}
+
+// respondFiles writes the page of a directory listing selected by the
+// query, with the quota of the root
+func respondFiles(c *gin.Context, m *files.Manager, list []files.FileInfo) {
+	page, err := pageItems(listQuery(c), list)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	resp := fileListResponse{ListResponse: page}
+	if quota, err := m.Quota(); err == nil {
+		resp.Quota = &quota
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// InfoPath handles GET /api/v2/files/info/*path
+func (h *FilesHandler) InfoPath(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	info, err := m.Info(pathParam(c))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, info)
+}
+
+// ReadPath handles GET /api/v2/files/content/*path
+func (h *FilesHandler) ReadPath(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	if c.Query("offset") != "" || c.Query("length") != "" {
+		readRange(c, m)
+		return
+	}
+	content, err := m.Read(pathParam(c))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, contentResponse{Content: string(content)})
+}
+
+// readRange answers a read of a part of a file, for files too large to
+// read whole
+func readRange(c *gin.Context, m *files.Manager) {
+	var offset, length int64
+	for name, dst := range map[string]*int64{"offset": &offset, "length": &length} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || (name == "length" && n < 0) {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid " + name})
+				return
+			}
+			*dst = n
+		}
+	}
+	chunk, err := m.ReadRange(pathParam(c), offset, length)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, chunk)
+}
+
+// DownloadPath handles GET /api/v2/files/download/*path, directories are
+// sent as zip archives. Files support Range and If-Modified-Since.
+func (h *FilesHandler) DownloadPath(c *gin.Context) {
+	if m, ok := h.managerFor(c); ok {
+		h.serveDownload(c, m, pathParam(c), fileError)
+	}
+}
+
+// defaultSearchLimit is the number of matches a content search stops at
+// unless the client asks for another limit
+const defaultSearchLimit = 1000
+
+// SearchPath handles GET /api/v2/files/search/*path, streaming the lines
+// matching q in the files below path as newline-delimited JSON
+func (h *FilesHandler) SearchPath(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	opts := files.SearchOptions{
+		Pattern:    c.Query("q"),
+		Literal:    c.Query("literal") == "true",
+		IgnoreCase: c.Query("ignore_case") == "true",
+		Include:    splitList(c.QueryArray("include")),
+		Exclude:    splitList(c.QueryArray("exclude")),
+		MaxResults: defaultSearchLimit,
+	}
+	if opts.Pattern == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "q required"})
+		return
+	}
+	for name, dst := range map[string]*int{"context": &opts.Context, "limit": &opts.MaxResults} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid " + name})
+				return
+			}
+			*dst = n
+		}
+	}
+	if v := c.Query("max_size"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid max_size"})
+			return
+		}
+		opts.MaxFileSize = n
+	}
+
+	// Headers are only sent with the first match, so errors before it are still reported as JSON
+	started := false
+	start := func() {
+		if !started {
+			c.Header("Content-Type", "application/x-ndjson")
+			c.Header("Cache-Control", "no-cache")
+			c.Status(http.StatusOK)
+			started = true
+		}
+	}
+	enc := json.NewEncoder(c.Writer)
+	err := m.SearchContent(c.Request.Context(), pathParam(c), opts, func(match files.Match) error {
+		start()
+		if err := enc.Encode(match); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil && !started {
+		fileError(c, err)
+		return
+	}
+	start()
+}
+
+// splitList splits the comma-separated values of a repeated query
+// parameter
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// TailPath handles GET /api/v2/files/tail/*path, returning the last lines
+// of a file
+func (h *FilesHandler) TailPath(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	lines, ok := tailLines(c)
+	if !ok {
+		return
+	}
+	tail, err := m.Tail(pathParam(c), lines)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tail)
+}
+
+// tailLines returns the lines query parameter, zero for the default
+func tailLines(c *gin.Context) (int, bool) {
+	v := c.Query("lines")
+	if v == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid lines"})
+		return 0, false
+	}
+	return n, true
+}
+
+// LinkPath handles GET /api/v2/files/links/*path, returning the target of a
+// symbolic link
+func (h *FilesHandler) LinkPath(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	link, err := m.Readlink(pathParam(c))
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, link)
+}
+
+// CreateLink handles POST /api/v2/files/links
+func (h *FilesHandler) CreateLink(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req linkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path and target required"})
+		return
+	}
+
+	var err error
+	if req.Hard {
+		err = m.Hardlink(req.Target, req.Path)
+	} else {
+		err = m.Symlink(req.Target, req.Path)
+	}
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.created", gin.H{"path": req.Path, "target": req.Target, "hard": req.Hard})
+	h.respondFile(c, m, req.Path, true)
+}
+
+// PutContent handles PUT /api/v2/files/content, answering 201 when the file
+// is created
+func (h *FilesHandler) PutContent(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req fileContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+
+	_, err := m.Info(req.Path)
+	created := errors.Is(err, fs.ErrNotExist)
+	if err := m.Write(req.Path, []byte(req.Content)); err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.written", gin.H{"path": req.Path})
+	h.respondFile(c, m, req.Path, created)
+}
+
+// PatchContent handles PATCH /api/v2/files/content, appending to a file or
+// replacing a part of it. Appending creates missing files, answering 201.
+func (h *FilesHandler) PatchContent(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req patchContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+
+	_, err := m.Info(req.Path)
+	created := errors.Is(err, fs.ErrNotExist)
+	if req.Offset == nil {
+		err = m.Append(req.Path, []byte(req.Content))
+	} else {
+		err = m.WriteAt(req.Path, *req.Offset, []byte(req.Content))
+	}
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.written", gin.H{"path": req.Path})
+	h.respondFile(c, m, req.Path, created)
+}
+
+// PutDirectory handles PUT /api/v2/files/directories, answering 201 when
+// the directory is created and 200 when it already exists
+func (h *FilesHandler) PutDirectory(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req filePathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+
+	info, err := m.Info(req.Path)
+	switch {
+	case err == nil && info.IsDir:
+		c.JSON(http.StatusOK, info)
+		return
+	case err == nil:
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "a file exists at " + req.Path})
+		return
+	}
+
+	if err := m.CreateDir(req.Path); err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.created", gin.H{"path": req.Path, "dir": true})
+	h.respondFile(c, m, req.Path, true)
+}
+
+// Move handles POST /api/v2/files/move, refusing to replace an existing
+// destination. Moves across filesystems copy the files in a job, answering
+// 202 Accepted with it.
+func (h *FilesHandler) Move(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req moveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from and to required"})
+		return
+	}
+
+	if _, err := m.Info(req.From); err != nil {
+		fileError(c, err)
+		return
+	}
+	if _, err := m.Info(req.To); err == nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: req.To + " already exists"})
+		return
+	}
+
+	err := m.Rename(req.From, req.To)
+	if files.IsCrossDevice(err) {
+		user := requestUser(c)
+		renamed := gin.H{"path": req.To, "old_path": req.From, "user": user}
+		sourceOf(c, renamed)
+		spec := jobs.Spec{Action: "file.move", Target: req.From, User: user, Queue: moveQueue}
+		respondJob(c, h.jobs.StartProgress(spec, func(progress func(done, total int64)) error {
+			if err := m.Move(req.From, req.To, progress); err != nil {
+				return err
+			}
+			h.bus.Publish(events.TopicFiles, "file.renamed", renamed)
+			return nil
+		}))
+		return
+	}
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.renamed", gin.H{"path": req.To, "old_path": req.From})
+	h.respondFile(c, m, req.To, false)
+}
+
+// Copy handles POST /api/v2/files/copy, answering 201 with the copy. Copies
+// of copyJobSize or more run in a job, answering 202 Accepted with the job
+// reporting the bytes copied in progress.
+func (h *FilesHandler) Copy(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req copyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from and to required"})
+		return
+	}
+
+	if _, err := m.Info(req.From); err != nil {
+		fileError(c, err)
+		return
+	}
+	if _, err := m.Info(req.To); err == nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: req.To + " already exists"})
+		return
+	}
+	size, err := m.Size(req.From)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+
+	if size >= copyJobSize {
+		user := requestUser(c)
+		copied := gin.H{"path": req.To, "from": req.From, "user": user}
+		sourceOf(c, copied)
+		spec := jobs.Spec{Action: "file.copy", Target: req.From, User: user, Queue: moveQueue}
+		respondJob(c, h.jobs.StartProgress(spec, func(progress func(done, total int64)) error {
+			if err := m.Copy(req.From, req.To, progress); err != nil {
+				return err
+			}
+			h.bus.Publish(events.TopicFiles, "file.copied", copied)
+			return nil
+		}))
+		return
+	}
+	if err := m.Copy(req.From, req.To, nil); err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.copied", gin.H{"path": req.To, "from": req.From})
+	h.respondFile(c, m, req.To, true)
+}
+
+// Remove handles DELETE /api/v2/files
+func (h *FilesHandler) Remove(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req filePathRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+
+	if _, err := m.Info(req.Path); err != nil {
+		fileError(c, err)
+		return
+	}
+	if err := m.Delete(req.Path); err != nil {
+		fileError(c, err)
+		return
+	}
+
+	h.publish(c, "file.deleted", gin.H{"path": req.Path})
+	c.Status(http.StatusNoContent)
+}
+
+// UploadFile handles POST /api/v2/files/upload, a multipart form with the
+// directory in path and the file in file
+func (h *FilesHandler) UploadFile(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	dir := c.PostForm("path")
+	if dir == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "path required"})
+		return
+	}
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "file required"})
+		return
+	}
+	defer file.Close()
+
+	if err := m.Upload(dir, file, header.Filename); err != nil {
+		fileError(c, err)
+		return
+	}
+
+	path := filepath.Join(dir, filepath.Base(header.Filename))
+	h.publish(c, "file.uploaded", gin.H{"path": path})
+	h.respondFile(c, m, path, true)
+}
+
+// Compress handles POST /api/v2/files/compress, creating the archive in a
+// job and answering 202 Accepted with it
+func (h *FilesHandler) Compress(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	var req compressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "paths and destination required"})
+		return
+	}
+
+	archive := files.Archive{Paths: req.Paths, Destination: req.Destination, Format: req.Format, Level: req.Level}
+	if err := m.CheckArchive(&archive); err != nil {
+		fileError(c, err)
+		return
+	}
+	if _, err := m.Info(req.Destination); err == nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: req.Destination + " already exists"})
+		return
+	}
+
+	// The job outlives the request, so the event is published without it
+	user := requestUser(c)
+	created := gin.H{"path": archive.Destination, "user": user}
+	sourceOf(c, created)
+	spec := jobs.Spec{Action: "file.compress", Target: req.Destination, User: user, Queue: compressQueue}
+	respondJob(c, h.jobs.Start(spec, func() error {
+		if err := m.Compress(archive); err != nil {
+			return err
+		}
+		h.bus.Publish(events.TopicFiles, "file.created", created)
+		return nil
+	}))
+}
+
+// PutPermissions handles PUT /api/v2/files/permissions
+func (h *FilesHandler) PutPermissions(c *gin.Context) {
+	m, ok := h.managerFor(c)
+	if !ok {
+		return
+	}
+	if req, ok := h.setPermissions(c, m); ok {
+		h.respondFile(c, m, req.Path, false)
+	}
+}
+
+// respondFile answers a change with the file it made, 201 Created for new
+// files
+func (h *FilesHandler) respondFile(c *gin.Context, m *files.Manager, path string, created bool) {
+	info, err := m.Info(path)
+	if err != nil {
+		fileError(c, err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, info)
+}
+
+// pathParam returns the path addressed by the *path parameter
+func pathParam(c *gin.Context) string {
+	if path := c.Param("path"); path != "" {
+		return path
+	}
+	return "/"
+}
+
+// fileError maps file manager errors to HTTP status codes
+func fileError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, files.ErrOutsideRoot), errors.Is(err, files.ErrDeleteRoot), errors.Is(err, files.ErrReadOnly),
+		errors.Is(err, files.ErrExtension), errors.Is(err, fs.ErrPermission):
+		status = http.StatusForbidden
+	case errors.Is(err, files.ErrIsDir), errors.Is(err, files.ErrInvalidMode), errors.Is(err, files.ErrUnknownOwner),
+		errors.Is(err, files.ErrInvalidUpload), errors.Is(err, files.ErrInvalidArchive), errors.Is(err, files.ErrInvalidSearch),
+		errors.Is(err, files.ErrNotSymlink), errors.Is(err, files.ErrInvalidLink), errors.Is(err, files.ErrInvalidRange),
+		errors.Is(err, files.ErrCopyIntoItself):
+		status = http.StatusBadRequest
+	case errors.Is(err, files.ErrTooLarge), errors.Is(err, files.ErrUploadTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, files.ErrUploadOffset), errors.Is(err, fs.ErrExist):
+		status = http.StatusConflict
+	case errors.Is(err, files.ErrChecksum):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, files.ErrQuotaExceeded), errors.Is(err, files.ErrNoSpace):
+		status = http.StatusInsufficientStorage
+	case errors.Is(err, files.ErrNotSupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, files.ErrUnreachable):
+		status = http.StatusBadGateway
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
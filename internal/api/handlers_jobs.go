@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/jobs"
+)
+
+// JobsHandler handles the endpoints of long running operations
+type JobsHandler struct {
+	manager *jobs.Manager
+}
+
+// NewJobsHandler creates a new jobs handler, publishing the progress of
+// jobs on the jobs topic
+func NewJobsHandler(manager *jobs.Manager, bus *events.Bus) *JobsHandler {
+	manager.OnChange(func(job jobs.Job) {
+		var eventType string
+		switch job.Status {
+		case jobs.StatusRunning:
+			eventType = "job.started"
+			if job.Progress != nil {
+				eventType = "job.progress"
+			}
+		case jobs.StatusCompleted:
+			eventType = "job.completed"
+		case jobs.StatusFailed:
+			eventType = "job.failed"
+		default:
+			return
+		}
+		bus.Publish(events.TopicJobs, eventType, job)
+		// Tell the user who started it even when not subscribed to jobs
+		if job.Finished() {
+			bus.PublishTo(job.User, events.TopicNotices, eventType, job)
+		}
+	})
+	return &JobsHandler{manager: manager}
+}
+
+// List handles GET /api/v2/jobs
+func (h *JobsHandler) List(c *gin.Context) {
+	respondList(c, listQuery(c), h.manager.List())
+}
+
+// Get handles GET /api/v2/jobs/:id
+func (h *JobsHandler) Get(c *gin.Context) {
+	job, err := h.manager.Get(c.Param("id"))
+	if err != nil {
+		jobError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// respondJob answers a request that started a job with 202 Accepted and the
+// location to follow it at
+func respondJob(c *gin.Context, job jobs.Job) {
+	c.Header("Location", basePath(c)+"/api/v2/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// jobError maps job errors to HTTP status codes
+func jobError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if errors.Is(err, jobs.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
@@ -2,105 +2,147 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nebula/nebula/internal/metrics"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+const (
+	// historyRange is the range of history queries without from
+	historyRange = time.Hour
+	// historyPoints is the number of points of history queries without step
+	historyPoints = 300
+	// maxHistoryPoints bounds the points of a history query
+	maxHistoryPoints = 10000
 )
 
 // MetricsHandler handles metrics endpoints
 type MetricsHandler struct {
 	collector *metrics.Collector
+	store     *storage.Storage
 }
 
 // NewMetricsHandler creates a new metrics handler
-func NewMetricsHandler(collector *metrics.Collector) *MetricsHandler {
-	return &MetricsHandler{collector: collector}
+func NewMetricsHandler(collector *metrics.Collector, store *storage.Storage) *MetricsHandler {
+	return &MetricsHandler{collector: collector, store: store}
+}
+
+// MetricsRangeResponse is the stored metrics history of a time range,
+// downsampled into steps
+type MetricsRangeResponse struct {
+	From   time.Time              `json:"from"`
+	To     time.Time              `json:"to"`
+	Step   string                 `json:"step"`
+	Points []storage.MetricsPoint `json:"points"`
 }
 
-// GetCPU godoc
-// @Summary Get CPU metrics
-// @Description Returns current CPU usage information
-// @Tags metrics
-// @Produce json
-// @Success 200 {object} metrics.CPUInfo
-// @Router /api/v1/metrics/cpu [get]
+// GetCPU handles GET /api/v1/metrics/cpu
 func (h *MetricsHandler) GetCPU(c *gin.Context) {
 	cpu, err := h.collector.GetCPUInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, cpu)
 }
 
-// GetMemory godoc
-// @Summary Get memory metrics
-// @Description Returns current memory usage information
-// @Tags metrics
-// @Produce json
-// @Success 200 {object} metrics.MemoryInfo
-// @Router /api/v1/metrics/memory [get]
+// GetMemory handles GET /api/v1/metrics/memory
 func (h *MetricsHandler) GetMemory(c *gin.Context) {
 	mem, err := h.collector.GetMemoryInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, mem)
 }
 
-// GetDisk godoc
-// @Summary Get disk metrics
-// @Description Returns disk usage information for all mounted partitions
-// @Tags metrics
-// @Produce json
-// @Success 200 {array} metrics.DiskInfo
-// @Router /api/v1/metrics/disk [get]
+// GetDisk handles GET /api/v1/metrics/disk
 func (h *MetricsHandler) GetDisk(c *gin.Context) {
 	disks, err := h.collector.GetDiskInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, disks)
 }
 
-// GetNetwork godoc
-// @Summary Get network metrics
-// @Description Returns network interface statistics
-// @Tags metrics
-// @Produce json
-// @Success 200 {array} metrics.NetworkInfo
-// @Router /api/v1/metrics/network [get]
+// GetNetwork handles GET /api/v1/metrics/network
 func (h *MetricsHandler) GetNetwork(c *gin.Context) {
 	net, err := h.collector.GetNetworkInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, net)
 }
 
-// GetAll godoc
-// @Summary Get all metrics
-// @Description Returns all system metrics
-// @Tags metrics
-// @Produce json
-// @Success 200 {object} metrics.AllMetrics
-// @Router /api/v1/metrics/all [get]
+// GetAll handles GET /api/v1/metrics/all
 func (h *MetricsHandler) GetAll(c *gin.Context) {
 	metrics := h.collector.GetLatest()
 	c.JSON(http.StatusOK, metrics)
 }
 
-// GetHistory godoc
-// @Summary Get metrics history
-// @Description Returns historical metrics data
-// @Tags metrics
-// @Produce json
-// @Success 200 {array} metrics.AllMetrics
-// @Router /api/v1/metrics/history [get]
+// GetHistory handles GET /api/v1/metrics/history, returning the in-memory
+// history or, with from, to or step, the stored history of a time range
 func (h *MetricsHandler) GetHistory(c *gin.Context) {
+	if c.Query("from") != "" || c.Query("to") != "" || c.Query("step") != "" {
+		h.getHistoryRange(c)
+		return
+	}
 	history := h.collector.GetHistory()
-	c.JSON(http.StatusOK, history)
+	respondList(c, listQuery(c), history)
+}
+
+// getHistoryRange handles GET /api/v1/metrics/history?from=&to=&step=,
+// averaging the stored history and its rollups over each step. to defaults to now, from to
+// an hour before to and step to a length giving historyPoints points.
+func (h *MetricsHandler) getHistoryRange(c *gin.Context) {
+	to := time.Now()
+	if v := c.Query("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid to"})
+			return
+		}
+		to = t
+	}
+	from := to.Add(-historyRange)
+	if v := c.Query("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid from"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "from must be before to"})
+		return
+	}
+
+	step := max((to.Sub(from) / historyPoints).Round(time.Second), time.Second)
+	if v := c.Query("step"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid step"})
+			return
+		}
+		step = d
+	}
+	if to.Sub(from)/step > maxHistoryPoints {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "step too small for the range"})
+		return
+	}
+
+	points, err := h.store.MetricsHistory(from, to, step)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if points == nil {
+		points = []storage.MetricsPoint{}
+	}
+	c.JSON(http.StatusOK, MetricsRangeResponse{From: from, To: to, Step: step.String(), Points: points})
 }
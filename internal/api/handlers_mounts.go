@@ -0,0 +1,128 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/mounts"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// MountsHandler handles mount point and fstab endpoints
+type MountsHandler struct {
+	manager *mounts.Manager
+	store   *storage.Storage
+	bus     *events.Bus
+}
+
+// NewMountsHandler creates a new mounts handler
+func NewMountsHandler(manager *mounts.Manager, store *storage.Storage, bus *events.Bus) *MountsHandler {
+	return &MountsHandler{manager: manager, store: store, bus: bus}
+}
+
+// List handles GET /api/v1/mounts
+func (h *MountsHandler) List(c *gin.Context) {
+	list, err := h.manager.List()
+	if err != nil {
+		mountsError(c, err)
+		return
+	}
+	respondList(c, listQuery(c), list)
+}
+
+// Mount handles POST /api/v1/mounts
+func (h *MountsHandler) Mount(c *gin.Context) {
+	var req mounts.MountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	mount, err := h.manager.Mount(c.Request.Context(), req)
+	if err != nil {
+		mountsError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "mount.mount", mount.Target, mount.Source+" ("+mount.FSType+")")
+	h.bus.Publish(events.TopicSystem, "mount.mounted", gin.H{"mount": mount, "user": requestUser(c)})
+	c.JSON(http.StatusCreated, mount)
+}
+
+// Unmount handles DELETE /api/v1/mounts?target=, unmounting lazily with lazy=true
+func (h *MountsHandler) Unmount(c *gin.Context) {
+	target := c.Query("target")
+	if err := h.manager.Unmount(c.Request.Context(), target, c.Query("lazy") == "true"); err != nil {
+		mountsError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "mount.unmount", target, "")
+	h.bus.Publish(events.TopicSystem, "mount.unmounted", gin.H{"target": target, "user": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: target + " unmounted"})
+}
+
+// Fstab handles GET /api/v1/mounts/fstab
+func (h *MountsHandler) Fstab(c *gin.Context) {
+	entries, err := h.manager.Fstab()
+	if err != nil {
+		mountsError(c, err)
+		return
+	}
+	respondList(c, listQuery(c), entries)
+}
+
+// SetFstabEntry handles PUT /api/v1/mounts/fstab, adding the entry or
+// replacing the one for the same mount point
+func (h *MountsHandler) SetFstabEntry(c *gin.Context) {
+	var entry mounts.Entry
+	if err := c.ShouldBindJSON(&entry); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	entry, created, err := h.manager.SetFstabEntry(c.Request.Context(), entry)
+	if err != nil {
+		mountsError(c, err)
+		return
+	}
+	audit, action, status := "fstab.update", "updated", http.StatusOK
+	if created {
+		audit, action, status = "fstab.add", "added", http.StatusCreated
+	}
+	recordAudit(c, h.store, h.bus, audit, entry.Key(), entry.Source+" ("+entry.FSType+")")
+	h.bus.Publish(events.TopicSystem, "fstab.changed", gin.H{"action": action, "entry": entry, "user": requestUser(c)})
+	c.JSON(status, entry)
+}
+
+// RemoveFstabEntry handles DELETE /api/v1/mounts/fstab?target=, target
+// being the source for swap entries
+func (h *MountsHandler) RemoveFstabEntry(c *gin.Context) {
+	target := c.Query("target")
+	if target == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "target required"})
+		return
+	}
+	if err := h.manager.RemoveFstabEntry(c.Request.Context(), target); err != nil {
+		mountsError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "fstab.remove", target, "")
+	h.bus.Publish(events.TopicSystem, "fstab.changed", gin.H{"action": "removed", "target": target, "user": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: "fstab entry removed"})
+}
+
+// mountsError answers 400 for invalid mounts and entries, 404 for missing
+// ones, 501 where filesystems can't be managed and 500 when mount fails
+func mountsError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, mounts.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, mounts.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, mounts.ErrUnsupported):
+		status = http.StatusNotImplemented
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
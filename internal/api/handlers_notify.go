@@ -0,0 +1,166 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/notify"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// NotifyHandler handles notification channel and rule endpoints
+type NotifyHandler struct {
+	manager *notify.Manager
+	store   *storage.Storage
+	bus     *events.Bus
+}
+
+// NewNotifyHandler creates a new notifications handler
+func NewNotifyHandler(manager *notify.Manager, store *storage.Storage, bus *events.Bus) *NotifyHandler {
+	return &NotifyHandler{manager: manager, store: store, bus: bus}
+}
+
+// ListChannels handles GET /api/v1/notifications/channels
+func (h *NotifyHandler) ListChannels(c *gin.Context) {
+	channels := h.manager.Channels()
+	for i, ch := range channels {
+		channels[i] = ch.Masked()
+	}
+	c.JSON(http.StatusOK, channels)
+}
+
+// SaveChannel handles PUT /api/v1/notifications/channels/:name
+func (h *NotifyHandler) SaveChannel(c *gin.Context) {
+	var ch notify.ChannelConfig
+	if err := c.ShouldBindJSON(&ch); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	ch.Name = c.Param("name")
+	if old, err := h.manager.Channel(ch.Name); err == nil {
+		ch = ch.Unmask(old)
+	}
+
+	if err := h.manager.SaveChannel(ch); err != nil {
+		notifyError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "notification.channel.save", ch.Name, ch.Type)
+	c.JSON(http.StatusOK, ch.Masked())
+}
+
+// DeleteChannel handles DELETE /api/v1/notifications/channels/:name
+func (h *NotifyHandler) DeleteChannel(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.manager.DeleteChannel(name); err != nil {
+		notifyError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "notification.channel.delete", name, "")
+	c.JSON(http.StatusOK, MessageResponse{Message: "channel deleted"})
+}
+
+// TestChannel handles POST /api/v1/notifications/channels/:name/test
+func (h *NotifyHandler) TestChannel(c *gin.Context) {
+	err := h.manager.Test(c.Request.Context(), c.Param("name"))
+	if errors.Is(err, notify.ErrNotFound) || errors.Is(err, notify.ErrInvalid) {
+		notifyError(c, err)
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "test notification sent"})
+}
+
+// ListRules handles GET /api/v1/notifications/rules
+func (h *NotifyHandler) ListRules(c *gin.Context) {
+	c.JSON(http.StatusOK, h.manager.Rules())
+}
+
+// CreateRule handles POST /api/v1/notifications/rules
+func (h *NotifyHandler) CreateRule(c *gin.Context) {
+	var rule notify.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rule.ID = ""
+	h.saveRule(c, rule, http.StatusCreated)
+}
+
+// UpdateRule handles PUT /api/v1/notifications/rules/:id
+func (h *NotifyHandler) UpdateRule(c *gin.Context) {
+	var rule notify.Rule
+	if err := c.ShouldBindJSON(&rule); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	rule.ID = c.Param("id")
+	h.saveRule(c, rule, http.StatusOK)
+}
+
+// saveRule stores a rule and records it in the audit log
+func (h *NotifyHandler) saveRule(c *gin.Context, rule notify.Rule, status int) {
+	rule, err := h.manager.SaveRule(rule)
+	if err != nil {
+		notifyError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "notification.rule.save", rule.ID, "")
+	c.JSON(status, rule)
+}
+
+// DeleteRule handles DELETE /api/v1/notifications/rules/:id
+func (h *NotifyHandler) DeleteRule(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.manager.DeleteRule(id); err != nil {
+		notifyError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "notification.rule.delete", id, "")
+	c.JSON(http.StatusOK, MessageResponse{Message: "rule deleted"})
+}
+
+// Deliveries handles GET /api/v1/notifications/deliveries, optionally for
+// one channel with ?channel=
+func (h *NotifyHandler) Deliveries(c *gin.Context) {
+	if h.store == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid limit"})
+			return
+		}
+		limit = min(n, 1000)
+	}
+
+	page, err := h.store.GetNotifyDeliveries(c.Query("channel"), c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// notifyError answers 404 for missing channels and rules, 400 for invalid
+// settings and 500 otherwise
+func notifyError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, notify.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, notify.ErrInvalid):
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/oidc"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// oidcStateCookie binds a login to the browser that started it
+const oidcStateCookie = "nebula_oidc_state"
+
+// oidcLoginTimeout is how long a user has to log in with the provider
+const oidcLoginTimeout = 10 * time.Minute
+
+// providerOIDC marks the sessions of users logged in with OpenID Connect
+const providerOIDC = "oidc"
+
+// OIDCHandler logs users in with the OpenID Connect provider of
+// auth.oidc, mapping their groups to a Nebula role
+type OIDCHandler struct {
+	storage *storage.Storage
+	config  *config.Manager
+	bus     *events.Bus
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCHandler creates a new OpenID Connect handler
+func NewOIDCHandler(store *storage.Storage, cfg *config.Manager, bus *events.Bus) *OIDCHandler {
+	return &OIDCHandler{storage: store, config: cfg, bus: bus}
+}
+
+// Login handles GET /api/v1/auth/oidc/login
+func (h *OIDCHandler) Login(c *gin.Context) {
+	cfg, ok := h.enabled(c)
+	if !ok {
+		return
+	}
+
+	login := storage.LoginState{
+		State:     oidc.NewState(),
+		Nonce:     oidc.NewState(),
+		Verifier:  oidc.NewState(),
+		CreatedAt: time.Now(),
+	}
+	authURL, err := h.providerFor(cfg).AuthURL(c.Request.Context(), cfg.RedirectURL, login.State, login.Nonce, login.Verifier)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "OpenID Connect provider not available", "error", err)
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: "identity provider not available"})
+		return
+	}
+	if err := h.storage.SaveLoginState(login, oidcLoginTimeout); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Lax, the provider sends the browser back with a cross-site navigation
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, login.State, int(oidcLoginTimeout.Seconds()), basePath(c)+"/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback handles GET /api/v1/auth/oidc/callback
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	cfg, ok := h.enabled(c)
+	if !ok {
+		return
+	}
+	if e := c.Query("error"); e != "" {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed: " + e + " " + c.Query("error_description")})
+		return
+	}
+
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	if state == "" || cookie != state {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid login state"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, basePath(c)+"/api/v1/auth/oidc", "", c.Request.TLS != nil, true)
+	login, err := h.storage.TakeLoginState(state)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if login == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "login expired, start again"})
+		return
+	}
+
+	claims, err := h.providerFor(cfg).Exchange(c.Request.Context(), c.Query("code"), cfg.RedirectURL, login.Verifier, login.Nonce)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "OpenID Connect login failed", "error", err)
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed"})
+		return
+	}
+
+	user := oidcUsername(claims, cfg.UsernameClaim)
+	role := oidcRole(oidcGroups(claims, cfg.GroupsClaim), cfg)
+	if user == "" || role == "" {
+		h.bus.Publish(events.TopicSecurity, "auth.failed", gin.H{"user": user, "ip": c.ClientIP(), "path": c.Request.URL.Path, "provider": providerOIDC})
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "user not allowed to access Nebula"})
+		return
+	}
+
+	ttl := h.config.Get().Auth.SessionTTL
+	if _, err := startSession(c, h.storage, ttl, storage.Session{Username: user, Provider: providerOIDC, Role: role}); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create session"})
+		return
+	}
+	c.Redirect(http.StatusFound, basePath(c)+"/")
+}
+
+// enabled returns the OpenID Connect settings, answering the request when
+// logins with a provider aren't possible
+func (h *OIDCHandler) enabled(c *gin.Context) (config.OIDCConfig, bool) {
+	cfg := h.config.Get().Auth
+	if !cfg.Enabled || !cfg.OIDC.Enabled {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "OpenID Connect login is disabled"})
+		return cfg.OIDC, false
+	}
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return cfg.OIDC, false
+	}
+	return cfg.OIDC, true
+}
+
+// providerFor returns the provider of cfg, created again when the settings
+// change on a configuration reload
+func (h *OIDCHandler) providerFor(cfg config.OIDCConfig) *oidc.Provider {
+	settings := oidc.Settings{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		Scopes:       cfg.Scopes,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.provider == nil || !reflect.DeepEqual(h.provider.Settings(), settings) {
+		h.provider = oidc.NewProvider(settings)
+	}
+	return h.provider
+}
+
+// oidcUsername returns the username of a user, from claim or else their
+// email. Emails are only used once the provider verified them, anyone could
+// sign up with the address of a Nebula user otherwise. The subject is the
+// last resort, prefixed with the provider so it can't take the name of a
+// local user.
+func oidcUsername(claims oidc.Claims, claim string) string {
+	if user := claims.String(claim); user != "" && (claim != "email" || claims.Bool("email_verified")) {
+		return user
+	}
+	if email := claims.String("email"); email != "" && claims.Bool("email_verified") {
+		return email
+	}
+	if sub := claims.String("sub"); sub != "" {
+		return providerOIDC + ":" + sub
+	}
+	return ""
+}
+
+// oidcGroups returns the groups of a user from claim, ignoring an email
+// used as group that the provider hasn't verified
+func oidcGroups(claims oidc.Claims, claim string) []string {
+	if claim == "email" && !claims.Bool("email_verified") {
+		return nil
+	}
+	return claims.Strings(claim)
+}
+
+// oidcRole maps the groups of a user to their role, empty when they are in
+// none of the configured groups
+func oidcRole(groups []string, cfg config.OIDCConfig) string {
+	member := func(allowed []string) bool {
+		for _, group := range groups {
+			for _, a := range allowed {
+				if group == a {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	switch {
+	case member(cfg.AdminGroups):
+		return roleAdmin
+	case member(cfg.ViewerGroups):
+		return roleViewer
+	}
+	return ""
+}
@@ -4,190 +4,153 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/jobs"
 	"github.com/nebula/nebula/internal/packages"
 )
 
+// packagesQueue serializes package operations, package managers hold a
+// lock while they run
+const packagesQueue = "packages"
+
 // PackagesHandler handles package manager endpoints
 type PackagesHandler struct {
 	manager packages.Manager
+	jobs    *jobs.Manager
+}
+
+// NewPackagesHandler creates a new packages handler, running package
+// operations as jobs
+func NewPackagesHandler(manager packages.Manager, jobManager *jobs.Manager) *PackagesHandler {
+	return &PackagesHandler{manager: manager, jobs: jobManager}
 }
 
-// NewPackagesHandler creates a new packages handler
-func NewPackagesHandler(manager packages.Manager) *PackagesHandler {
-	return &PackagesHandler{manager: manager}
+// packageRequest names the package to install or update
+type packageRequest struct {
+	Name string `json:"name"`
 }
 
-// List godoc
-// @Summary List installed packages
-// @Description Returns a list of installed packages
-// @Tags packages
-// @Produce json
-// @Success 200 {array} packages.PackageInfo
-// @Router /api/v1/packages [get]
+// packageTypeResponse names the package manager in use
+type packageTypeResponse struct {
+	Type string `json:"type"`
+}
+
+// List handles GET /api/v1/packages
 func (h *PackagesHandler) List(c *gin.Context) {
 	pkgs, err := h.manager.List()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, pkgs)
+	respondList(c, listQuery(c), pkgs)
 }
 
-// Search godoc
-// @Summary Search packages
-// @Description Searches for packages in the repository
-// @Tags packages
-// @Produce json
-// @Param q query string true "Search query"
-// @Success 200 {array} packages.PackageInfo
-// @Failure 400 {object} map[string]string
-// @Router /api/v1/packages/search [get]
+// Search handles GET /api/v1/packages/search
 func (h *PackagesHandler) Search(c *gin.Context) {
 	query := c.Query("q")
 	if query == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "query required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "query required"})
 		return
 	}
 
 	pkgs, err := h.manager.Search(query)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, pkgs)
+
+	// q is the search term here, not a filter on the results
+	q := listQuery(c)
+	q.Text = ""
+	respondList(c, q, pkgs)
 }
 
-// Install godoc
-// @Summary Install a package
-// @Description Installs a package
-// @Tags packages
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Package name"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/packages/install [post]
+// Install handles POST /api/v1/packages/install
 func (h *PackagesHandler) Install(c *gin.Context) {
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req packageRequest
 	if err := c.BindJSON(&req); err != nil || req.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "package name required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "package name required"})
 		return
 	}
 
-	if err := h.manager.Install(req.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.runJob(c, "install", req.Name, func() error { return h.manager.Install(req.Name) }); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "package installed"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "package installed"})
 }
 
-// Remove godoc
-// @Summary Remove a package
-// @Description Removes an installed package
-// @Tags packages
-// @Produce json
-// @Param name query string true "Package name"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/packages/remove [delete]
+// Remove handles DELETE /api/v1/packages/remove
 func (h *PackagesHandler) Remove(c *gin.Context) {
 	name := c.Query("name")
 	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "package name required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "package name required"})
 		return
 	}
 
-	if err := h.manager.Remove(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.runJob(c, "remove", name, func() error { return h.manager.Remove(name) }); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "package removed"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "package removed"})
 }
 
-// Update godoc
-// @Summary Update a package
-// @Description Updates a package to the latest version
-// @Tags packages
-// @Accept json
-// @Produce json
-// @Param body body map[string]string true "Package name"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/packages/update [post]
+// Update handles POST /api/v1/packages/update
 func (h *PackagesHandler) Update(c *gin.Context) {
-	var req struct {
-		Name string `json:"name"`
-	}
+	var req packageRequest
 	if err := c.BindJSON(&req); err != nil || req.Name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "package name required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "package name required"})
 		return
 	}
 
-	if err := h.manager.Update(req.Name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.runJob(c, "update", req.Name, func() error { return h.manager.Update(req.Name) }); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "package updated"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "package updated"})
 }
 
-// UpgradeAll godoc
-// @Summary Upgrade all packages
-// @Description Upgrades all installed packages
-// @Tags packages
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/packages/upgrade-all [post]
+// UpgradeAll handles POST /api/v1/packages/upgrade-all
 func (h *PackagesHandler) UpgradeAll(c *gin.Context) {
-	if err := h.manager.UpgradeAll(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.runJob(c, "upgrade-all", "", h.manager.UpgradeAll); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "all packages upgraded"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "all packages upgraded"})
 }
 
-// Info godoc
-// @Summary Get package info
-// @Description Returns detailed information about a package
-// @Tags packages
-// @Produce json
-// @Param name query string true "Package name"
-// @Success 200 {object} packages.PackageInfo
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Router /api/v1/packages/info [get]
+// Info handles GET /api/v1/packages/info
 func (h *PackagesHandler) Info(c *gin.Context) {
 	name := c.Query("name")
 	if name == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "package name required"})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "package name required"})
 		return
 	}
 
 	pkg, err := h.manager.Info(name)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, pkg)
 }
 
-// GetType godoc
-// @Summary Get package manager type
-// @Description Returns the detected package manager type
-// @Tags packages
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Router /api/v1/packages/type [get]
+// GetType handles GET /api/v1/packages/type
 func (h *PackagesHandler) GetType(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{"type": h.manager.Type()})
+	c.JSON(http.StatusOK, packageTypeResponse{Type: h.manager.Type()})
+}
+
+// runJob runs a package operation as a job and waits for it
+func (h *PackagesHandler) runJob(c *gin.Context, action, name string, run func() error) error {
+	_, err := h.jobs.Run(h.jobSpec(c, action, name), run)
+	return err
+}
+
+// jobSpec describes a package operation
+func (h *PackagesHandler) jobSpec(c *gin.Context, action, name string) jobs.Spec {
+	return jobs.Spec{Action: "package." + action, Target: name, User: requestUser(c), Queue: packagesQueue}
 }
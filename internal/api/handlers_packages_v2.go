@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPackage handles GET /api/v2/packages/:name
+func (h *PackagesHandler) GetPackage(c *gin.Context) {
+	pkg, err := h.manager.Info(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, pkg)
+}
+
+// PutPackage handles PUT /api/v2/packages/:name. Installed packages are
+// returned as they are, others are installed by a job.
+func (h *PackagesHandler) PutPackage(c *gin.Context) {
+	name := c.Param("name")
+	if pkg, err := h.manager.Info(name); err == nil && pkg.Installed {
+		c.JSON(http.StatusOK, pkg)
+		return
+	}
+
+	respondJob(c, h.jobs.Start(h.jobSpec(c, "install", name), func() error { return h.manager.Install(name) }))
+}
+
+// DeletePackage handles DELETE /api/v2/packages/:name. Packages that
+// aren't installed need no job.
+func (h *PackagesHandler) DeletePackage(c *gin.Context) {
+	name := c.Param("name")
+	pkg, err := h.manager.Info(name)
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !pkg.Installed {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	respondJob(c, h.jobs.Start(h.jobSpec(c, "remove", name), func() error { return h.manager.Remove(name) }))
+}
+
+// UpgradePackage handles POST /api/v2/packages/:name/upgrade
+func (h *PackagesHandler) UpgradePackage(c *gin.Context) {
+	name := c.Param("name")
+	respondJob(c, h.jobs.Start(h.jobSpec(c, "update", name), func() error { return h.manager.Update(name) }))
+}
+
+// UpgradePackages handles POST /api/v2/packages/upgrade
+func (h *PackagesHandler) UpgradePackages(c *gin.Context) {
+	respondJob(c, h.jobs.Start(h.jobSpec(c, "upgrade-all", ""), h.manager.UpgradeAll))
+}
@@ -0,0 +1,373 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/storage"
+	"github.com/nebula/nebula/internal/webauthn"
+)
+
+// providerPasskey marks the sessions of users logged in with a passkey
+const providerPasskey = "passkey"
+
+// PasskeysHandler registers the passkeys of logged in users and logs them
+// in with those, hardware keys or the authenticators of their devices
+type PasskeysHandler struct {
+	storage *storage.Storage
+	config  *config.Manager
+	bus     *events.Bus
+}
+
+// NewPasskeysHandler creates a new passkeys handler
+func NewPasskeysHandler(store *storage.Storage, cfg *config.Manager, bus *events.Bus) *PasskeysHandler {
+	return &PasskeysHandler{storage: store, config: cfg, bus: bus}
+}
+
+// passkeyRegistrationRequest starts the registration of a passkey
+type passkeyRegistrationRequest struct {
+	// Name tells the passkeys of a user apart, e.g. YubiKey
+	Name string `json:"name"`
+}
+
+// passkeyCreationResponse carries the options of navigator.credentials.create
+type passkeyCreationResponse struct {
+	PublicKey webauthn.CreationOptions `json:"publicKey"`
+}
+
+// passkeyRegisterRequest is the response of the authenticator to a
+// registration, binary fields base64url encoded
+type passkeyRegisterRequest struct {
+	ClientDataJSON    string `json:"client_data_json" binding:"required"`
+	AttestationObject string `json:"attestation_object" binding:"required"`
+}
+
+// passkeyLoginRequest starts a login with a passkey
+type passkeyLoginRequest struct {
+	// Username limits the login to their passkeys, any discoverable passkey
+	// when empty
+	Username string `json:"username"`
+}
+
+// passkeyRequestResponse carries the options of navigator.credentials.get
+type passkeyRequestResponse struct {
+	PublicKey webauthn.RequestOptions `json:"publicKey"`
+}
+
+// passkeyAssertionRequest is the response of the authenticator to a login,
+// binary fields base64url encoded
+type passkeyAssertionRequest struct {
+	ID                string `json:"id" binding:"required"`
+	ClientDataJSON    string `json:"client_data_json" binding:"required"`
+	AuthenticatorData string `json:"authenticator_data" binding:"required"`
+	Signature         string `json:"signature" binding:"required"`
+}
+
+// BeginRegistration handles POST /api/v1/auth/passkeys/registration
+func (h *PasskeysHandler) BeginRegistration(c *gin.Context) {
+	settings, ok := h.enabled(c)
+	if !ok {
+		return
+	}
+	user := c.GetString(contextUserKey)
+	if user == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "authentication is disabled"})
+		return
+	}
+	var req passkeyRegistrationRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	passkeys, err := h.storage.ListPasskeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	var exclude [][]byte
+	for _, passkey := range passkeys {
+		if passkey.Username != user {
+			continue
+		}
+		if id, err := webauthn.Decode(passkey.ID); err == nil {
+			exclude = append(exclude, id)
+		}
+	}
+
+	ceremony := storage.PasskeyCeremony{
+		Challenge:    webauthn.NewChallenge(),
+		Registration: true,
+		Username:     user,
+		Provider:     c.GetString(contextProviderKey),
+		Role:         c.GetString(contextRoleKey),
+		Name:         strings.TrimSpace(req.Name),
+		CreatedAt:    time.Now(),
+	}
+	if err := h.storage.SavePasskeyCeremony(ceremony, webauthn.Timeout); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, passkeyCreationResponse{PublicKey: settings.CreationOptions(ceremony.Challenge, user, exclude)})
+}
+
+// Register handles POST /api/v1/auth/passkeys
+func (h *PasskeysHandler) Register(c *gin.Context) {
+	settings, ok := h.enabled(c)
+	if !ok {
+		return
+	}
+	var req passkeyRegisterRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	clientData, err1 := webauthn.Decode(req.ClientDataJSON)
+	attestation, err2 := webauthn.Decode(req.AttestationObject)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "fields must be base64url encoded"})
+		return
+	}
+
+	ceremony, ok := h.takeCeremony(c, clientData, true)
+	if !ok {
+		return
+	}
+	// Only the user who started the registration may complete it
+	if ceremony.Username != c.GetString(contextUserKey) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "registration started by another user"})
+		return
+	}
+
+	credential, err := settings.VerifyRegistration(ceremony.Challenge, clientData, attestation)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "registration failed: " + err.Error()})
+		return
+	}
+	id := webauthn.Encode(credential.ID)
+	existing, err := h.storage.GetPasskey(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: "passkey already registered"})
+		return
+	}
+
+	passkey := storage.Passkey{
+		ID:        id,
+		Username:  ceremony.Username,
+		Name:      ceremony.Name,
+		Provider:  ceremony.Provider,
+		Role:      ceremony.Role,
+		PublicKey: credential.PublicKey,
+		SignCount: credential.SignCount,
+		CreatedAt: time.Now(),
+	}
+	if passkey.Name == "" {
+		passkey.Name = "Passkey"
+	}
+	if err := h.storage.SavePasskey(passkey); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.bus.Publish(events.TopicSecurity, "passkey.registered", gin.H{"id": passkey.ID, "user": passkey.Username, "name": passkey.Name})
+	c.JSON(http.StatusCreated, passkey)
+}
+
+// List handles GET /api/v1/auth/passkeys
+func (h *PasskeysHandler) List(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+	passkeys, err := h.storage.ListPasskeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	respondList(c, listQuery(c), passkeys)
+}
+
+// Delete handles DELETE /api/v1/auth/passkeys/:id
+func (h *PasskeysHandler) Delete(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+	passkey, err := h.storage.GetPasskey(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if passkey == nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "passkey not found"})
+		return
+	}
+	if err := h.storage.DeletePasskey(passkey.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.bus.Publish(events.TopicSecurity, "passkey.deleted", gin.H{"id": passkey.ID, "user": passkey.Username, "by": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: "passkey deleted"})
+}
+
+// BeginLogin handles POST /api/v1/auth/passkeys/login/options
+func (h *PasskeysHandler) BeginLogin(c *gin.Context) {
+	settings, ok := h.enabled(c)
+	if !ok {
+		return
+	}
+	var req passkeyLoginRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	var allow [][]byte
+	if req.Username != "" {
+		passkeys, err := h.storage.ListPasskeys()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+		for _, passkey := range passkeys {
+			if passkey.Username != req.Username {
+				continue
+			}
+			if id, err := webauthn.Decode(passkey.ID); err == nil {
+				allow = append(allow, id)
+			}
+		}
+		// Users without passkeys get the options of a discoverable login, so
+		// the answer doesn't tell who has passkeys
+	}
+
+	ceremony := storage.PasskeyCeremony{
+		Challenge: webauthn.NewChallenge(),
+		Username:  req.Username,
+		CreatedAt: time.Now(),
+	}
+	if err := h.storage.SavePasskeyCeremony(ceremony, webauthn.Timeout); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, passkeyRequestResponse{PublicKey: settings.RequestOptions(ceremony.Challenge, allow)})
+}
+
+// Login handles POST /api/v1/auth/passkeys/login
+func (h *PasskeysHandler) Login(c *gin.Context) {
+	settings, ok := h.enabled(c)
+	if !ok {
+		return
+	}
+	var req passkeyAssertionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	clientData, err1 := webauthn.Decode(req.ClientDataJSON)
+	authData, err2 := webauthn.Decode(req.AuthenticatorData)
+	signature, err3 := webauthn.Decode(req.Signature)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "fields must be base64url encoded"})
+		return
+	}
+
+	ceremony, ok := h.takeCeremony(c, clientData, false)
+	if !ok {
+		return
+	}
+	passkey, err := h.storage.GetPasskey(strings.TrimRight(req.ID, "="))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if passkey == nil || (ceremony.Username != "" && passkey.Username != ceremony.Username) {
+		h.fail(c, "", "unknown passkey")
+		return
+	}
+
+	credential := webauthn.Credential{PublicKey: passkey.PublicKey, SignCount: passkey.SignCount}
+	count, err := settings.VerifyAssertion(ceremony.Challenge, credential, clientData, authData, signature)
+	if err != nil {
+		h.fail(c, passkey.Username, err.Error())
+		return
+	}
+	// The passkey logs in only while its user still could with the login
+	// method they registered it with
+	if !validSession(&storage.Session{Username: passkey.Username, Provider: passkey.Provider}, h.config.Get()) {
+		h.fail(c, passkey.Username, "login method of the user is disabled")
+		return
+	}
+
+	passkey.SignCount = count
+	passkey.LastUsedAt = time.Now()
+	if err := h.storage.SavePasskey(*passkey); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ttl := h.config.Get().Auth.SessionTTL
+	session, err := startSession(c, h.storage, ttl, storage.Session{Username: passkey.Username, Provider: providerPasskey, Role: passkey.Role})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create session"})
+		return
+	}
+	c.JSON(http.StatusCreated, session)
+}
+
+// takeCeremony returns the pending ceremony clientDataJSON answers,
+// answering the request when there is none of the kind
+func (h *PasskeysHandler) takeCeremony(c *gin.Context, clientDataJSON []byte, registration bool) (*storage.PasskeyCeremony, bool) {
+	challenge, err := webauthn.Challenge(clientDataJSON)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+	ceremony, err := h.storage.TakePasskeyCeremony(challenge)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return nil, false
+	}
+	if ceremony == nil || ceremony.Registration != registration {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "challenge expired, start again"})
+		return nil, false
+	}
+	return ceremony, true
+}
+
+// fail rejects a login, without telling the client why
+func (h *PasskeysHandler) fail(c *gin.Context, user, reason string) {
+	slog.WarnContext(c.Request.Context(), "Passkey login failed", "user", user, "error", reason)
+	h.bus.Publish(events.TopicSecurity, "auth.failed", gin.H{"user": user, "ip": c.ClientIP(), "path": c.Request.URL.Path, "provider": providerPasskey})
+	c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "login failed"})
+}
+
+// enabled returns the relying party settings, answering the request when
+// passkeys aren't available
+func (h *PasskeysHandler) enabled(c *gin.Context) (webauthn.Settings, bool) {
+	cfg := h.config.Get().Auth
+	settings := webauthn.Settings{RPID: cfg.WebAuthn.RPID, RPName: cfg.WebAuthn.RPName, Origins: cfg.WebAuthn.Origins}
+	if !cfg.Enabled || !cfg.WebAuthn.Enabled {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "passkeys are disabled"})
+		return settings, false
+	}
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return settings, false
+	}
+	return settings, true
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/power"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// PowerHandler handles reboot, shutdown and suspend endpoints
+type PowerHandler struct {
+	manager *power.Manager
+	store   *storage.Storage
+	bus     *events.Bus
+}
+
+// NewPowerHandler creates a new power handler
+func NewPowerHandler(manager *power.Manager, store *storage.Storage, bus *events.Bus) *PowerHandler {
+	manager.OnExecute(func(s power.Schedule, err error) {
+		if err != nil {
+			bus.Publish(events.TopicSystem, "power.failed", gin.H{"schedule": s, "error": err.Error()})
+			return
+		}
+		bus.Publish(events.TopicSystem, "power.executing", s)
+	})
+	return &PowerHandler{manager: manager, store: store, bus: bus}
+}
+
+// powerRequest is the body of reboot, shutdown and suspend requests
+type powerRequest struct {
+	// Confirm is the token returned by the first request
+	Confirm string `json:"confirm"`
+	// At is HH:MM or an RFC3339 time, empty for now
+	At string `json:"at"`
+	// Message is shown to logged in users
+	Message string `json:"message"`
+}
+
+// powerStatusResponse lists the supported actions and the scheduled one
+type powerStatusResponse struct {
+	Supported []string        `json:"supported"`
+	Scheduled *power.Schedule `json:"scheduled"`
+}
+
+// powerResponse is the reply to power requests. A request without confirm
+// gets the confirmation token, a confirmed one the schedule.
+type powerResponse struct {
+	Message      string          `json:"message"`
+	Action       string          `json:"action,omitempty"`
+	ConfirmToken string          `json:"confirm_token,omitempty"`
+	ExpiresAt    *time.Time      `json:"expires_at,omitempty"`
+	Scheduled    *power.Schedule `json:"scheduled,omitempty"`
+	Cancelled    *power.Schedule `json:"cancelled,omitempty"`
+}
+
+// GetPower handles GET /api/v1/system/power
+func (h *PowerHandler) GetPower(c *gin.Context) {
+	c.JSON(http.StatusOK, powerStatusResponse{
+		Supported: h.manager.Supported(),
+		Scheduled: h.manager.Pending(),
+	})
+}
+
+// Reboot handles POST /api/v1/system/reboot
+func (h *PowerHandler) Reboot(c *gin.Context) {
+	h.request(c, power.ActionReboot)
+}
+
+// Shutdown handles POST /api/v1/system/shutdown
+func (h *PowerHandler) Shutdown(c *gin.Context) {
+	h.request(c, power.ActionShutdown)
+}
+
+// Suspend handles POST /api/v1/system/suspend
+func (h *PowerHandler) Suspend(c *gin.Context) {
+	h.request(c, power.ActionSuspend)
+}
+
+// request issues a confirmation token for action, or schedules it when the
+// request carries one
+func (h *PowerHandler) request(c *gin.Context, action string) {
+	var req powerRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	at, err := power.ParseAt(req.At, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user := requestUser(c)
+	if req.Confirm == "" {
+		token, expires, err := h.manager.Confirmation(action, user)
+		if err != nil {
+			powerError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, powerResponse{
+			Action:       action,
+			ConfirmToken: token,
+			ExpiresAt:    &expires,
+			Message:      fmt.Sprintf("send the request again with confirm to %s", action),
+		})
+		return
+	}
+
+	s, err := h.manager.Schedule(req.Confirm, action, user, req.Message, at)
+	if err != nil {
+		powerError(c, err)
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Power action scheduled", "action", action, "at", s.At, "user", user)
+	details := "at " + s.At.Format(time.RFC3339)
+	if s.Message != "" {
+		details += ": " + s.Message
+	}
+	recordAudit(c, h.store, h.bus, "power."+action, "system", details)
+	h.bus.Publish(events.TopicSystem, "power.scheduled", s)
+
+	c.JSON(http.StatusOK, powerResponse{Message: action + " scheduled", Scheduled: &s})
+}
+
+// CancelPower handles DELETE /api/v1/system/power
+func (h *PowerHandler) CancelPower(c *gin.Context) {
+	s, ok := h.manager.Cancel(requestUser(c))
+	if !ok {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "no action scheduled"})
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "Power action cancelled", "action", s.Action, "scheduled_by", s.User, "user", requestUser(c))
+	recordAudit(c, h.store, h.bus, "power.cancel", "system", s.Action+" at "+s.At.Format(time.RFC3339))
+	h.bus.Publish(events.TopicSystem, "power.cancelled", gin.H{"schedule": s, "user": requestUser(c)})
+
+	c.JSON(http.StatusOK, powerResponse{Message: s.Action + " cancelled", Cancelled: &s})
+}
+
+// powerError maps power manager errors to status codes
+func powerError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, power.ErrUnsupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, power.ErrConfirm):
+		status = http.StatusForbidden
+	case errors.Is(err, power.ErrPending):
+		status = http.StatusConflict
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Terminate handles DELETE /api/v2/processes/:pid, killing the process
+// with force=true
+func (h *ProcessHandler) Terminate(c *gin.Context) {
+	pid, err := strconv.ParseInt(c.Param("pid"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid PID"})
+		return
+	}
+
+	if _, err := h.manager.Get(int32(pid)); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err := h.manager.Kill(int32(pid), c.Query("force") == "true"); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
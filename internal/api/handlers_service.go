@@ -5,160 +5,104 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
 	"github.com/nebula/nebula/internal/service"
 )
 
 // ServiceHandler handles service endpoints
 type ServiceHandler struct {
 	manager service.Manager
+	bus     *events.Bus
 }
 
 // NewServiceHandler creates a new service handler
-func NewServiceHandler(manager service.Manager) *ServiceHandler {
-	return &ServiceHandler{manager: manager}
+func NewServiceHandler(manager service.Manager, bus *events.Bus) *ServiceHandler {
+	return &ServiceHandler{manager: manager, bus: bus}
 }
 
-// List godoc
-// @Summary List all services
-// @Description Returns a list of all system services
-// @Tags services
-// @Produce json
-// @Success 200 {array} service.ServiceInfo
-// @Router /api/v1/services [get]
+// List handles GET /api/v1/services
 func (h *ServiceHandler) List(c *gin.Context) {
 	services, err := h.manager.List()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, services)
+	respondList(c, listQuery(c), services)
 }
 
-// Get godoc
-// @Summary Get service details
-// @Description Returns detailed information about a specific service
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Success 200 {object} service.ServiceInfo
-// @Failure 404 {object} map[string]string
-// @Router /api/v1/services/{name} [get]
+// Get handles GET /api/v1/services/:name
 func (h *ServiceHandler) Get(c *gin.Context) {
 	name := c.Param("name")
 
 	svc, err := h.manager.Get(name)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, svc)
 }
 
-// Start godoc
-// @Summary Start a service
-// @Description Starts a system service
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/services/{name}/start [post]
+// Start handles POST /api/v1/services/:name/start
 func (h *ServiceHandler) Start(c *gin.Context) {
 	name := c.Param("name")
 
 	if err := h.manager.Start(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "service started"})
+	h.publish(c, "service.started", name)
+	c.JSON(http.StatusOK, MessageResponse{Message: "service started"})
 }
 
-// Stop godoc
-// @Summary Stop a service
-// @Description Stops a system service
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/services/{name}/stop [post]
+// Stop handles POST /api/v1/services/:name/stop
 func (h *ServiceHandler) Stop(c *gin.Context) {
 	name := c.Param("name")
 
 	if err := h.manager.Stop(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "service stopped"})
+	h.publish(c, "service.stopped", name)
+	c.JSON(http.StatusOK, MessageResponse{Message: "service stopped"})
 }
 
-// Restart godoc
-// @Summary Restart a service
-// @Description Restarts a system service
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/services/{name}/restart [post]
+// Restart handles POST /api/v1/services/:name/restart
 func (h *ServiceHandler) Restart(c *gin.Context) {
 	name := c.Param("name")
 
 	if err := h.manager.Restart(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "service restarted"})
+	h.publish(c, "service.restarted", name)
+	c.JSON(http.StatusOK, MessageResponse{Message: "service restarted"})
 }
 
-// Enable godoc
-// @Summary Enable a service
-// @Description Enables a service to start at boot
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/services/{name}/enable [post]
+// Enable handles POST /api/v1/services/:name/enable
 func (h *ServiceHandler) Enable(c *gin.Context) {
 	name := c.Param("name")
 
 	if err := h.manager.Enable(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "service enabled"})
+	h.publish(c, "service.enabled", name)
+	c.JSON(http.StatusOK, MessageResponse{Message: "service enabled"})
 }
 
-// Disable godoc
-// @Summary Disable a service
-// @Description Disables a service from starting at boot
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/services/{name}/disable [post]
+// Disable handles POST /api/v1/services/:name/disable
 func (h *ServiceHandler) Disable(c *gin.Context) {
 	name := c.Param("name")
 
 	if err := h.manager.Disable(name); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "service disabled"})
+	h.publish(c, "service.disabled", name)
+	c.JSON(http.StatusOK, MessageResponse{Message: "service disabled"})
 }
 
-// Logs godoc
-// @Summary Get service logs
-// @Description Returns recent logs for a service
-// @Tags services
-// @Produce json
-// @Param name path string true "Service name"
-// @Param lines query int false "Number of lines" default(100)
-// @Success 200 {array} service.ServiceLog
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/services/{name}/logs [get]
+// Logs handles GET /api/v1/services/:name/logs
 func (h *ServiceHandler) Logs(c *gin.Context) {
 	name := c.Param("name")
 	lines := 100
@@ -170,8 +114,13 @@ func (h *ServiceHandler) Logs(c *gin.Context) {
 
 	logs, err := h.manager.Logs(name, lines)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, logs)
 }
+
+// publish announces a change of state of a service on the event bus
+func (h *ServiceHandler) publish(c *gin.Context, eventType, name string) {
+	h.bus.Publish(events.TopicServices, eventType, gin.H{"name": name, "user": requestUser(c)})
+}
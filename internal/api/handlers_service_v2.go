@@ -0,0 +1,123 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/service"
+)
+
+// serviceStateRequest is the desired state of a service
+type serviceStateRequest struct {
+	State string `json:"state" binding:"required" desc:"running or stopped"`
+}
+
+// serviceEnabledRequest sets whether a service starts at boot
+type serviceEnabledRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// PutState handles PUT /api/v2/services/:name/state. Services already in
+// the requested state are left alone.
+func (h *ServiceHandler) PutState(c *gin.Context) {
+	var req serviceStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "state required"})
+		return
+	}
+
+	svc, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+
+	var err error
+	switch {
+	case req.State == svc.Status:
+		c.JSON(http.StatusOK, svc)
+		return
+	case req.State == service.StatusRunning:
+		if err = h.manager.Start(svc.Name); err == nil {
+			h.publish(c, "service.started", svc.Name)
+		}
+	case req.State == service.StatusStopped:
+		if err = h.manager.Stop(svc.Name); err == nil {
+			h.publish(c, "service.stopped", svc.Name)
+		}
+	default:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "state must be running or stopped"})
+		return
+	}
+	h.respondService(c, svc.Name, err)
+}
+
+// PutEnabled handles PUT /api/v2/services/:name/enabled
+func (h *ServiceHandler) PutEnabled(c *gin.Context) {
+	var req serviceEnabledRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "enabled required"})
+		return
+	}
+
+	svc, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+
+	enabled := svc.StartType == service.StartTypeAuto
+	if *req.Enabled == enabled {
+		c.JSON(http.StatusOK, svc)
+		return
+	}
+
+	var err error
+	if *req.Enabled {
+		if err = h.manager.Enable(svc.Name); err == nil {
+			h.publish(c, "service.enabled", svc.Name)
+		}
+	} else {
+		if err = h.manager.Disable(svc.Name); err == nil {
+			h.publish(c, "service.disabled", svc.Name)
+		}
+	}
+	h.respondService(c, svc.Name, err)
+}
+
+// RestartService handles POST /api/v2/services/:name/restart
+func (h *ServiceHandler) RestartService(c *gin.Context) {
+	svc, ok := h.lookup(c)
+	if !ok {
+		return
+	}
+
+	err := h.manager.Restart(svc.Name)
+	if err == nil {
+		h.publish(c, "service.restarted", svc.Name)
+	}
+	h.respondService(c, svc.Name, err)
+}
+
+// lookup returns the service of the request, answering 404 when there is
+// no such service
+func (h *ServiceHandler) lookup(c *gin.Context) (service.ServiceInfo, bool) {
+	svc, err := h.manager.Get(c.Param("name"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return svc, false
+	}
+	return svc, true
+}
+
+// respondService answers a change to a service with its new state
+func (h *ServiceHandler) respondService(c *gin.Context, name string, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	svc, err := h.manager.Get(name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, svc)
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// sessionCookie is the cookie holding the token of a logged in client
+const sessionCookie = "nebula_session"
+
+// SessionsHandler handles the login sessions of API users. A session is
+// created with the basic auth credentials and authenticates the client
+// through its cookie until it expires or is revoked.
+type SessionsHandler struct {
+	storage *storage.Storage
+	config  *config.Manager
+	bus     *events.Bus
+}
+
+// NewSessionsHandler creates a new sessions handler
+func NewSessionsHandler(store *storage.Storage, cfg *config.Manager, bus *events.Bus) *SessionsHandler {
+	return &SessionsHandler{storage: store, config: cfg, bus: bus}
+}
+
+// Create handles POST /api/v1/auth/sessions
+func (h *SessionsHandler) Create(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+	cfg := h.config.Get().Auth
+	user := c.GetString(contextUserKey)
+	if !cfg.Enabled || user == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "authentication is disabled"})
+		return
+	}
+
+	session, err := startSession(c, h.storage, cfg.SessionTTL, storage.Session{Username: user, Provider: c.GetString(contextProviderKey), Role: c.GetString(contextRoleKey)})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create session"})
+		return
+	}
+	c.JSON(http.StatusCreated, session)
+}
+
+// startSession stores session for the client of the request, valid for ttl,
+// and sets the cookie authenticating the client with it
+func startSession(c *gin.Context, store *storage.Storage, ttl time.Duration, session storage.Session) (storage.Session, error) {
+	token := newSessionToken()
+	now := time.Now()
+	session.ID = sessionID(token)
+	session.CreatedAt = now
+	session.ExpiresAt = now.Add(ttl)
+	session.IP = c.ClientIP()
+	session.UserAgent = c.Request.UserAgent()
+	if err := store.SaveSession(session); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save session", "error", err)
+		return session, err
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(sessionCookie, token, int(ttl.Seconds()), basePath(c)+"/", "", c.Request.TLS != nil, true)
+	return session, nil
+}
+
+// List handles GET /api/v1/auth/sessions, listing every session to
+// administrators and their own to other users
+func (h *SessionsHandler) List(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+	sessions, err := h.storage.ListSessions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if !isAdmin(c) {
+		user := requestUser(c)
+		own := sessions[:0]
+		for _, session := range sessions {
+			if session.Username == user {
+				own = append(own, session)
+			}
+		}
+		sessions = own
+	}
+	respondList(c, listQuery(c), sessions)
+}
+
+// Revoke handles DELETE /api/v1/auth/sessions/:id. Users other than
+// administrators may only revoke their own sessions.
+func (h *SessionsHandler) Revoke(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+	session, err := h.storage.GetSession(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	// Sessions of other users look missing, like in List
+	if session == nil || (!isAdmin(c) && session.Username != requestUser(c)) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "session not found"})
+		return
+	}
+	if err := h.storage.DeleteSession(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	h.bus.Publish(events.TopicSecurity, "session.revoked", gin.H{"id": session.ID, "user": session.Username, "by": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: "Session revoked"})
+}
+
+// RevokeUser handles DELETE /api/v1/auth/sessions?username=. Users other
+// than administrators may only revoke their own sessions.
+func (h *SessionsHandler) RevokeUser(c *gin.Context) {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+	username := c.Query("username")
+	if username == "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "username required"})
+		return
+	}
+	if !isAdmin(c) && username != requestUser(c) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "administrator access required"})
+		return
+	}
+	deleted, err := h.storage.DeleteUserSessions(username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if deleted > 0 {
+		h.bus.Publish(events.TopicSecurity, "session.revoked", gin.H{"user": username, "count": deleted, "by": requestUser(c)})
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: fmt.Sprintf("%d sessions of %s revoked", deleted, username)})
+}
+
+// newSessionToken returns the secret a client presents in its session cookie
+func newSessionToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sessionID derives the ID a session is stored and listed under from its
+// token, so listing sessions doesn't reveal usable tokens
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:16])
+}
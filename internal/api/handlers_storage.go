@@ -0,0 +1,177 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/notify"
+	"github.com/nebula/nebula/internal/scheduler"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// StorageHandler handles database maintenance endpoints
+type StorageHandler struct {
+	storage   *storage.Storage
+	config    *config.Manager
+	notify    *notify.Manager
+	scheduler *scheduler.Scheduler
+}
+
+// importResponse reports an import and the imported settings that only
+// apply after a restart
+type importResponse struct {
+	Imported        map[string]int `json:"imported"`
+	RestartRequired []string       `json:"restart_required"`
+}
+
+// NewStorageHandler creates a new storage handler
+func NewStorageHandler(store *storage.Storage, cfg *config.Manager, notifyManager *notify.Manager, taskScheduler *scheduler.Scheduler) *StorageHandler {
+	return &StorageHandler{storage: store, config: cfg, notify: notifyManager, scheduler: taskScheduler}
+}
+
+// available aborts the request when storage could not be opened
+func (h *StorageHandler) available(c *gin.Context) bool {
+	if h.storage == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return false
+	}
+	return true
+}
+
+// Backup handles POST /api/v1/storage/backup
+func (h *StorageHandler) Backup(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	// The length is the one of the snapshot being written, so headers are
+	// set once it is taken
+	filename := fmt.Sprintf("nebula-%s.db", time.Now().UTC().Format("20060102-150405"))
+	_, err := h.storage.WriteSnapshot(c.Writer, func(size int64) {
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+		c.Status(http.StatusOK)
+	})
+	switch {
+	case err == nil:
+	case !c.Writer.Written():
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+	default:
+		// Headers are already sent, the client sees a truncated download
+		c.Error(err)
+	}
+}
+
+// GetRetention handles GET /api/v1/storage/retention
+func (h *StorageHandler) GetRetention(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+	c.JSON(http.StatusOK, h.storage.RetentionStatus())
+}
+
+// Export handles GET /api/v1/storage/export
+func (h *StorageHandler) Export(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	var buckets []string
+	if v := c.Query("buckets"); v != "" {
+		buckets = strings.Split(v, ",")
+	}
+
+	dump, err := h.storage.Export(buckets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	// Credentials stay on the instance, imports keep the stored ones
+	if overrides, ok := dump.Buckets[storage.BucketConfig]; ok {
+		config.MaskOverrides(overrides)
+	}
+	if channels, ok := dump.Buckets[storage.BucketNotifications]; ok {
+		if err := notify.MaskExport(channels); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	filename := fmt.Sprintf("nebula-export-%s.json", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.JSON(http.StatusOK, dump)
+}
+
+// Import handles POST /api/v1/storage/import
+func (h *StorageHandler) Import(c *gin.Context) {
+	if !h.available(c) {
+		return
+	}
+
+	mode := c.DefaultQuery("mode", "merge")
+	if mode != "merge" && mode != "replace" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "mode must be merge or replace"})
+		return
+	}
+
+	var dump storage.Dump
+	if err := c.BindJSON(&dump); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid dump"})
+		return
+	}
+
+	if channels, ok := dump.Buckets[storage.BucketNotifications]; ok {
+		if err := h.notify.UnmaskImport(channels); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	var result *storage.ImportResult
+	write := func() (err error) {
+		result, err = h.storage.Import(&dump, mode == "replace")
+		return err
+	}
+	// Configuration overrides are validated and applied as if they were
+	// patched, the change is recorded in the history
+	var restart []string
+	var err error
+	if overrides, ok := dump.Buckets[storage.BucketConfig]; ok {
+		restart, err = h.config.Import(overrides, mode == "replace", requestUser(c), write)
+	} else {
+		err = write()
+	}
+	if verr, ok := err.(*config.ValidationError); ok {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid configuration", Problems: verr.Problems})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Channels, rules and tasks are loaded at startup, they are read again
+	if _, ok := dump.Buckets[storage.BucketNotifications]; ok {
+		if err := h.notify.Reload(); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if _, ok := dump.Buckets[storage.BucketTasks]; ok {
+		if err := h.scheduler.Reload(); err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if restart == nil {
+		restart = []string{}
+	}
+	c.JSON(http.StatusOK, importResponse{Imported: result.Imported, RestartRequired: restart})
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/storage"
+	"github.com/nebula/nebula/internal/sysconf"
+)
+
+// SysconfHandler handles hostname, timezone, NTP and locale endpoints
+type SysconfHandler struct {
+	store *storage.Storage
+	bus   *events.Bus
+}
+
+// NewSysconfHandler creates a new host settings handler
+func NewSysconfHandler(store *storage.Storage, bus *events.Bus) *SysconfHandler {
+	return &SysconfHandler{store: store, bus: bus}
+}
+
+// GetSettings handles GET /api/v1/system/settings
+func (h *SysconfHandler) GetSettings(c *gin.Context) {
+	settings, err := sysconf.Get()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// hostnameRequest is the body of hostname changes
+type hostnameRequest struct {
+	Hostname string `json:"hostname" binding:"required"`
+}
+
+// SetHostname handles PUT /api/v1/system/hostname
+func (h *SysconfHandler) SetHostname(c *gin.Context) {
+	var req hostnameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.apply(c, "hostname", req.Hostname, sysconf.SetHostname)
+}
+
+// timezoneRequest is the body of timezone changes
+type timezoneRequest struct {
+	Timezone string `json:"timezone" binding:"required"`
+}
+
+// SetTimezone handles PUT /api/v1/system/timezone
+func (h *SysconfHandler) SetTimezone(c *gin.Context) {
+	var req timezoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.apply(c, "timezone", req.Timezone, sysconf.SetTimezone)
+}
+
+// ntpRequest is the body of NTP changes
+type ntpRequest struct {
+	Enabled *bool `json:"enabled" binding:"required"`
+}
+
+// SetNTP handles PUT /api/v1/system/ntp
+func (h *SysconfHandler) SetNTP(c *gin.Context) {
+	var req ntpRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.apply(c, "ntp", fmt.Sprint(*req.Enabled), func(string) error {
+		return sysconf.SetNTP(*req.Enabled)
+	})
+}
+
+// localeRequest is the body of locale changes
+type localeRequest struct {
+	Locale string `json:"locale" binding:"required"`
+}
+
+// SetLocale handles PUT /api/v1/system/locale
+func (h *SysconfHandler) SetLocale(c *gin.Context) {
+	var req localeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.apply(c, "locale", req.Locale, sysconf.SetLocale)
+}
+
+// Timezones handles GET /api/v1/system/timezones
+func (h *SysconfHandler) Timezones(c *gin.Context) {
+	zones, err := sysconf.Timezones()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, zones)
+}
+
+// Locales handles GET /api/v1/system/locales
+func (h *SysconfHandler) Locales(c *gin.Context) {
+	locales, err := sysconf.Locales()
+	if err != nil {
+		sysconfError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, locales)
+}
+
+// apply changes a setting, recording the old and new value in the audit log
+func (h *SysconfHandler) apply(c *gin.Context, setting, value string, set func(string) error) {
+	var old string
+	if settings, err := sysconf.Get(); err == nil {
+		old = map[string]string{
+			"hostname": settings.Hostname,
+			"timezone": settings.Timezone,
+			"ntp":      fmt.Sprint(settings.NTP),
+			"locale":   settings.Locale,
+		}[setting]
+	}
+
+	if err := set(value); err != nil {
+		sysconfError(c, err)
+		return
+	}
+
+	recordAudit(c, h.store, h.bus, setting+".set", "system", fmt.Sprintf("%s -> %s", old, value))
+	h.bus.Publish(events.TopicSystem, setting+".changed", gin.H{"old": old, "new": value, "user": requestUser(c)})
+	c.JSON(http.StatusOK, MessageResponse{Message: setting + " updated"})
+}
+
+// sysconfError answers 400 for invalid values, 501 where settings can't be
+// changed and 500 when the system tool fails
+func sysconfError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, sysconf.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, sysconf.ErrUnsupported):
+		status = http.StatusNotImplemented
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
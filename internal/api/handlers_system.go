@@ -1,7 +1,11 @@
 package api
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nebula/nebula/internal/config"
@@ -25,98 +29,216 @@ func NewSystemHandler(cfg *config.Manager, mc *metrics.Collector, upd *updater.U
 	}
 }
 
-// GetSystemInfo godoc
-// @Summary Get system information
-// @Description Returns general system information
-// @Tags system
-// @Produce json
-// @Success 200 {object} metrics.SystemInfo
-// @Router /api/v1/system/info [get]
+// GetSystemInfo handles GET /api/v1/system/info
 func (h *SystemHandler) GetSystemInfo(c *gin.Context) {
 	info, err := h.metricsCollector.GetSystemInfo()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, info)
 }
 
-// GetConfig godoc
-// @Summary Get current configuration
-// @Description Returns the current server configuration
-// @Tags system
-// @Produce json
-// @Success 200 {object} config.Config
-// @Router /api/v1/config [get]
+// GetConfig handles GET /api/v1/config
 func (h *SystemHandler) GetConfig(c *gin.Context) {
-	cfg := h.configManager.Get()
-	
-	// Mask sensitive data
+	c.JSON(http.StatusOK, maskConfig(h.configManager.Get()))
+}
+
+// configPatchResponse holds the configuration after a change and the
+// changed settings that only apply after a restart
+type configPatchResponse struct {
+	Config          config.Config `json:"config"`
+	RestartRequired []string      `json:"restart_required"`
+}
+
+// PatchConfig handles PATCH /api/v1/config
+func (h *SystemHandler) PatchConfig(c *gin.Context) {
+	var body map[string]interface{}
+	if err := c.BindJSON(&body); err != nil || len(body) == 0 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	changes := make(map[string]interface{})
+	flattenConfig("", body, changes)
+
+	restart, err := h.configManager.Patch(changes, requestUser(c))
+	if err != nil {
+		if verr, ok := err.(*config.ValidationError); ok {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid configuration", Problems: verr.Problems})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if restart == nil {
+		restart = []string{}
+	}
+	c.JSON(http.StatusOK, configPatchResponse{
+		Config:          maskConfig(h.configManager.Get()),
+		RestartRequired: restart,
+	})
+}
+
+// GetConfigSchema handles GET /api/v1/config/schema
+func (h *SystemHandler) GetConfigSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, config.Fields())
+}
+
+// GetConfigHistory handles GET /api/v1/config/history
+func (h *SystemHandler) GetConfigHistory(c *gin.Context) {
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid limit"})
+			return
+		}
+		limit = min(n, 1000)
+	}
+
+	page, err := h.configManager.History(c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// maskConfig returns a copy of the configuration without secrets
+func maskConfig(cfg *config.Config) config.Config {
 	safeCfg := *cfg
 	safeCfg.Auth.Password = "********"
-	
-	c.JSON(http.StatusOK, safeCfg)
-}
-
-// ReloadConfig godoc
-// @Summary Reload configuration
-// @Description Reloads the configuration from file
-// @Tags system
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/config/reload [post]
+	if safeCfg.Updater.GitHubToken != "" {
+		safeCfg.Updater.GitHubToken = "********"
+	}
+	if safeCfg.Cluster.Token != "" {
+		safeCfg.Cluster.Token = "********"
+	}
+	safeCfg.Events.Webhooks = make([]config.WebhookConfig, len(cfg.Events.Webhooks))
+	for i, hook := range cfg.Events.Webhooks {
+		if hook.Secret != "" {
+			hook.Secret = "********"
+		}
+		safeCfg.Events.Webhooks[i] = hook
+	}
+	return safeCfg
+}
+
+// flattenConfig converts nested settings into dotted keys
+func flattenConfig(prefix string, in map[string]interface{}, out map[string]interface{}) {
+	for key, value := range in {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenConfig(key, nested, out)
+			continue
+		}
+		out[key] = value
+	}
+}
+
+// ReloadConfig handles POST /api/v1/config/reload
 func (h *SystemHandler) ReloadConfig(c *gin.Context) {
-	if err := h.configManager.Reload(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.configManager.Reload(requestUser(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "configuration reloaded"})
+	c.JSON(http.StatusOK, MessageResponse{Message: "configuration reloaded"})
 }
 
-// CheckUpdate godoc
-// @Summary Check for updates
-// @Description Checks if a new version is available
-// @Tags system
-// @Produce json
-// @Success 200 {object} updater.UpdateInfo
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/update/check [get]
+// CheckUpdate handles GET /api/v1/update/check
 func (h *SystemHandler) CheckUpdate(c *gin.Context) {
 	info, err := h.updater.CheckForUpdate()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, info)
 }
 
-// ApplyUpdate godoc
-// @Summary Apply update
-// @Description Downloads and applies the latest update
-// @Tags system
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Failure 500 {object} map[string]string
-// @Router /api/v1/update/apply [post]
+// ApplyUpdate handles POST /api/v1/update/apply
 func (h *SystemHandler) ApplyUpdate(c *gin.Context) {
-	if err := h.updater.Apply(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	err := h.updater.Apply()
+	if errors.Is(err, updater.ErrNoUpdate) {
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"message": "update applied, restart required"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "update applied, restart required"})
+}
+
+// GetUpdateStatus handles GET /api/v1/update/status
+func (h *SystemHandler) GetUpdateStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.updater.Status())
+}
+
+// GetSavedVersions handles GET /api/v1/update/versions
+func (h *SystemHandler) GetSavedVersions(c *gin.Context) {
+	versions, err := h.updater.Versions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, versions)
+}
+
+// rollbackRequest names the saved version to restore
+type rollbackRequest struct {
+	Version string `json:"version"`
+}
+
+// rollbackResponse names the version restored
+type rollbackResponse struct {
+	Message string `json:"message"`
+	Version string `json:"version"`
+}
+
+// RollbackUpdate handles POST /api/v1/update/rollback
+func (h *SystemHandler) RollbackUpdate(c *gin.Context) {
+	var req rollbackRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request"})
+			return
+		}
+	}
+
+	version, err := h.updater.Rollback(req.Version)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rollbackResponse{Message: "rolled back, restarting", Version: version})
+
+	// Restart once the response has been sent
+	ctx := c.Request.Context()
+	go func() {
+		time.Sleep(time.Second)
+		if err := h.updater.Restart(); err != nil {
+			slog.ErrorContext(ctx, "Restart after rollback failed", "error", err)
+		}
+	}()
+}
+
+// versionResponse describes the running build
+type versionResponse struct {
+	Version    string `json:"version"`
+	Repository string `json:"repository"`
+	Profile    string `json:"profile"`
 }
 
-// GetVersion godoc
-// @Summary Get version
-// @Description Returns the current version
-// @Tags system
-// @Produce json
-// @Success 200 {object} map[string]string
-// @Router /api/v1/version [get]
+// GetVersion handles GET /api/v1/version
 func (h *SystemHandler) GetVersion(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
-		"version":    h.updater.GetVersion(),
-		"repository": "https://github.com/" + updater.GitHubRepo,
+	c.JSON(http.StatusOK, versionResponse{
+		Version:    h.updater.GetVersion(),
+		Repository: "https://github.com/" + updater.GitHubRepo,
+		Profile:    h.configManager.Profile(),
 	})
 }
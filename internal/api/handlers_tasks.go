@@ -0,0 +1,198 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/scheduler"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// TasksHandler handles scheduled task endpoints
+type TasksHandler struct {
+	scheduler *scheduler.Scheduler
+	store     *storage.Storage
+	bus       *events.Bus
+}
+
+// NewTasksHandler creates a new scheduled tasks handler
+func NewTasksHandler(s *scheduler.Scheduler, store *storage.Storage, bus *events.Bus) *TasksHandler {
+	s.OnRun(func(run storage.TaskRun) {
+		eventType := "task.started"
+		switch run.Status {
+		case scheduler.StatusSucceeded:
+			eventType = "task.completed"
+		case scheduler.StatusFailed:
+			eventType = "task.failed"
+		case scheduler.StatusSkipped:
+			eventType = "task.skipped"
+		}
+		bus.Publish(events.TopicJobs, eventType, run)
+	})
+	return &TasksHandler{scheduler: s, store: store, bus: bus}
+}
+
+// taskRequest is the body of create and update requests
+type taskRequest struct {
+	Name    string `json:"name" binding:"required"`
+	Enabled bool   `json:"enabled"`
+	Cron    string `json:"cron" binding:"required"`
+	Action  string `json:"action" binding:"required"`
+	Command string `json:"command"`
+	Service string `json:"service"`
+	Timeout int    `json:"timeout"`
+}
+
+// task converts the request to a task with the given ID
+func (r taskRequest) task(id string) scheduler.Task {
+	return scheduler.Task{
+		ID:      id,
+		Name:    r.Name,
+		Enabled: r.Enabled,
+		Cron:    r.Cron,
+		Action:  r.Action,
+		Command: r.Command,
+		Service: r.Service,
+		Timeout: r.Timeout,
+	}
+}
+
+// tasksResponse lists the tasks and the actions they can run
+type tasksResponse struct {
+	Tasks   []scheduler.TaskState `json:"tasks"`
+	Actions []string              `json:"actions"`
+}
+
+// List handles GET /api/v1/tasks
+func (h *TasksHandler) List(c *gin.Context) {
+	c.JSON(http.StatusOK, tasksResponse{
+		Tasks:   h.scheduler.Tasks(),
+		Actions: h.scheduler.Actions(),
+	})
+}
+
+// Get handles GET /api/v1/tasks/:id
+func (h *TasksHandler) Get(c *gin.Context) {
+	task, err := h.scheduler.Get(c.Param("id"))
+	if err != nil {
+		taskError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// Create handles POST /api/v1/tasks
+func (h *TasksHandler) Create(c *gin.Context) {
+	var req taskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.save(c, req.task(""), http.StatusCreated, "task.create")
+}
+
+// Update handles PUT /api/v1/tasks/:id
+func (h *TasksHandler) Update(c *gin.Context) {
+	var req taskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	h.save(c, req.task(c.Param("id")), http.StatusOK, "task.update")
+}
+
+// save stores a task and records it in the audit log
+func (h *TasksHandler) save(c *gin.Context, task scheduler.Task, status int, action string) {
+	state, err := h.scheduler.Save(task, requestUser(c))
+	if err != nil {
+		taskError(c, err)
+		return
+	}
+	details := state.Cron + " " + state.Action
+	if state.Command != "" {
+		details += ": " + state.Command
+	}
+	if state.Service != "" {
+		details += ": " + state.Service
+	}
+	recordAudit(c, h.store, h.bus, action, state.Name, details)
+	c.JSON(status, state)
+}
+
+// Delete handles DELETE /api/v1/tasks/:id
+func (h *TasksHandler) Delete(c *gin.Context) {
+	task, err := h.scheduler.Get(c.Param("id"))
+	if err != nil {
+		taskError(c, err)
+		return
+	}
+	if err := h.scheduler.Delete(task.ID); err != nil {
+		taskError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "task.delete", task.Name, "")
+	c.JSON(http.StatusOK, MessageResponse{Message: "task deleted"})
+}
+
+// Run handles POST /api/v1/tasks/:id/run
+func (h *TasksHandler) Run(c *gin.Context) {
+	run, err := h.scheduler.RunNow(c.Param("id"), requestUser(c))
+	if err != nil {
+		taskError(c, err)
+		return
+	}
+	recordAudit(c, h.store, h.bus, "task.run", run.TaskName, "")
+	c.JSON(http.StatusAccepted, run)
+}
+
+// Runs handles GET /api/v1/tasks/:id/runs
+func (h *TasksHandler) Runs(c *gin.Context) {
+	h.runs(c, c.Param("id"))
+}
+
+// AllRuns handles GET /api/v1/tasks/runs
+func (h *TasksHandler) AllRuns(c *gin.Context) {
+	h.runs(c, "")
+}
+
+func (h *TasksHandler) runs(c *gin.Context, taskID string) {
+	if h.store == nil {
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "storage not available"})
+		return
+	}
+
+	limit := 50
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid limit"})
+			return
+		}
+		limit = min(n, 1000)
+	}
+
+	page, err := h.store.GetTaskRuns(taskID, c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// taskError answers 404 for missing tasks, 400 for invalid definitions,
+// 409 for tasks that can't start and 500 otherwise
+func taskError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, scheduler.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, scheduler.ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, scheduler.ErrBusy):
+		status = http.StatusConflict
+	}
+	c.JSON(status, ErrorResponse{Error: err.Error()})
+}
@@ -2,91 +2,314 @@ package api
 
 import (
 	"encoding/json"
-	"io"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/files"
 	"github.com/nebula/nebula/internal/terminal"
 	ws "github.com/nebula/nebula/internal/websocket"
 )
 
 // TerminalHandler handles terminal endpoints
 type TerminalHandler struct {
-	manager     *terminal.Manager
-	terminalHub *ws.TerminalHub
+	manager      *terminal.Manager
+	terminalHub  *ws.TerminalHub
+	filesManager *files.Manager
+	bus          *events.Bus
 }
 
 // NewTerminalHandler creates a new terminal handler
-func NewTerminalHandler(manager *terminal.Manager, hub *ws.TerminalHub) *TerminalHandler {
+func NewTerminalHandler(manager *terminal.Manager, hub *ws.TerminalHub, filesManager *files.Manager, bus *events.Bus) *TerminalHandler {
 	return &TerminalHandler{
-		manager:     manager,
-		terminalHub: hub,
+		manager:      manager,
+		terminalHub:  hub,
+		filesManager: filesManager,
+		bus:          bus,
 	}
 }
 
-// GetShells godoc
-// @Summary Get available shells
-// @Description Returns a list of available shells
-// @Tags terminal
-// @Produce json
-// @Success 200 {object} map[string]interface{}
-// @Router /api/v1/terminal/shells [get]
+// shellsResponse lists the shells sessions can start
+type shellsResponse struct {
+	Shells       []string `json:"shells"`
+	DefaultShell string   `json:"default_shell"`
+}
+
+// GetShells handles GET /api/v1/terminal/shells
 func (h *TerminalHandler) GetShells(c *gin.Context) {
 	shells := h.manager.GetAvailableShells()
 	defaultShell := h.manager.GetDefaultShell()
 
-	c.JSON(http.StatusOK, gin.H{
-		"shells":        shells,
-		"default_shell": defaultShell,
+	c.JSON(http.StatusOK, shellsResponse{
+		Shells:       shells,
+		DefaultShell: defaultShell,
 	})
 }
 
-// GetSessions godoc
-// @Summary Get active sessions
-// @Description Returns a list of active terminal sessions
-// @Tags terminal
-// @Produce json
-// @Success 200 {array} string
-// @Router /api/v1/terminal/sessions [get]
+// GetSessions handles GET /api/v1/terminal/sessions
 func (h *TerminalHandler) GetSessions(c *gin.Context) {
 	sessions := h.manager.ListSessions()
 	c.JSON(http.StatusOK, sessions)
 }
 
+// GetMultiplexers handles GET /api/v1/terminal/multiplexers
+func (h *TerminalHandler) GetMultiplexers(c *gin.Context) {
+	sessions := terminal.ListMultiplexerSessions()
+	if sessions == nil {
+		sessions = []terminal.MultiplexerSession{}
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// GetSerialDevices handles GET /api/v1/terminal/serial
+func (h *TerminalHandler) GetSerialDevices(c *gin.Context) {
+	c.JSON(http.StatusOK, h.manager.ListSerialDevices())
+}
+
+// TerminateSession handles DELETE /api/v1/terminal/sessions/:id
+func (h *TerminalHandler) TerminateSession(c *gin.Context) {
+	id := c.Param("id")
+
+	var owner string
+	if session, ok := h.manager.GetSession(id); ok {
+		if !controlsSession(c, session) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "session owned by another user"})
+			return
+		}
+		owner = session.Owner
+	}
+
+	if err := h.manager.CloseSession(id); err != nil {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Tell the owner when someone else closed their session
+	if user := requestUser(c); owner != "" && owner != user {
+		h.bus.PublishTo(owner, events.TopicNotices, "terminal.closed", gin.H{"session": id, "closed_by": user})
+	}
+
+	c.JSON(http.StatusOK, MessageResponse{Message: "session terminated"})
+}
+
+// broadcastRequest lists the sessions to link
+type broadcastRequest struct {
+	Sessions []string `json:"sessions"`
+}
+
+// broadcastResponse lists the sessions whose input is mirrored
+type broadcastResponse struct {
+	Enabled  bool     `json:"enabled"`
+	Sessions []string `json:"sessions"`
+}
+
+// GetBroadcast handles GET /api/v1/terminal/broadcast
+func (h *TerminalHandler) GetBroadcast(c *gin.Context) {
+	ids := h.manager.BroadcastSessions()
+	c.JSON(http.StatusOK, broadcastResponse{
+		Enabled:  len(ids) > 0,
+		Sessions: ids,
+	})
+}
+
+// SetBroadcast handles PUT /api/v1/terminal/broadcast
+func (h *TerminalHandler) SetBroadcast(c *gin.Context) {
+	var req broadcastRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid request"})
+		return
+	}
+
+	// Replacing the group also unlinks the sessions linked so far
+	if !h.controlsSessions(c, req.Sessions) || !h.controlsSessions(c, h.manager.BroadcastSessions()) {
+		return
+	}
+
+	if err := h.manager.SetBroadcast(req.Sessions); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, broadcastResponse{
+		Enabled:  len(req.Sessions) > 0,
+		Sessions: h.manager.BroadcastSessions(),
+	})
+}
+
+// ClearBroadcast handles DELETE /api/v1/terminal/broadcast
+func (h *TerminalHandler) ClearBroadcast(c *gin.Context) {
+	if !h.controlsSessions(c, h.manager.BroadcastSessions()) {
+		return
+	}
+	h.manager.SetBroadcast(nil)
+	c.JSON(http.StatusOK, MessageResponse{Message: "broadcast disabled"})
+}
+
 // HandleWebSocket handles the terminal WebSocket connection
 func (h *TerminalHandler) HandleWebSocket(c *gin.Context) {
 	sessionID := c.Query("session")
-	shell := c.Query("shell")
-	
-	// Default terminal size
-	cols := uint16(80)
-	rows := uint16(24)
-
-	// Create terminal session
-	session, err := h.manager.CreateSession(sessionID, shell, cols, rows)
+
+	opts, err := parseSessionOptions(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	// Working directory must satisfy the file manager root policy
+	if cwd := c.Query("cwd"); cwd != "" {
+		dir, err := h.filesManager.ResolveDir(cwd)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		opts.Dir = dir
+	}
+
+	// Reattach to an existing session, otherwise create a new one
+	session, exists := h.manager.GetSession(sessionID)
+	if exists && !controlsSession(c, session) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: "session owned by another user"})
+		return
+	}
+	if !exists {
+		session, err = h.manager.CreateSession(sessionID, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+			return
+		}
+	}
+
 	// Upgrade to WebSocket
 	client, err := h.terminalHub.HandleTerminalWebSocket(c.Writer, c.Request, sessionID)
 	if err != nil {
-		h.manager.CloseSession(sessionID)
+		if !exists {
+			h.manager.CloseSession(sessionID)
+		}
 		return
 	}
 
+	history, output, detach := session.Attach()
+
+	// Replay the scrollback so the client doesn't start from a blank screen
+	if len(history) > 0 {
+		if err := client.WriteMessage(websocket.BinaryMessage, history); err != nil {
+			detach()
+			h.terminalHub.RemoveClient(client)
+			return
+		}
+	}
+
 	// Handle terminal I/O
-	go h.handleTerminalInput(client, session)
-	go h.handleTerminalOutput(client, session)
+	go h.handleTerminalInput(client, session, detach)
+	go h.handleTerminalOutput(client, output)
+}
+
+// controlsSession reports whether the user of a request may use a session:
+// its owner or an administrator
+func controlsSession(c *gin.Context, session *terminal.Session) bool {
+	return isAdmin(c) || session.Owner == requestUser(c)
+}
+
+// controlsSessions checks that the user of a request may use every one of
+// the sessions, answering 403 otherwise. Unknown sessions are left to the
+// manager to report.
+func (h *TerminalHandler) controlsSessions(c *gin.Context, ids []string) bool {
+	for _, id := range ids {
+		if session, ok := h.manager.GetSession(id); ok && !controlsSession(c, session) {
+			c.JSON(http.StatusForbidden, ErrorResponse{Error: "session owned by another user: " + id})
+			return false
+		}
+	}
+	return true
+}
+
+// parseSessionOptions reads the session options from the query string
+func parseSessionOptions(c *gin.Context) (terminal.SessionOptions, error) {
+	opts := terminal.SessionOptions{
+		Shell:    c.Query("shell"),
+		Command:  c.Query("command"),
+		Owner:    requestUser(c),
+		ClientIP: c.ClientIP(),
+	}
+
+	if v := c.Query("cols"); v != "" {
+		cols, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return opts, fmt.Errorf("invalid cols")
+		}
+		opts.Cols = uint16(cols)
+	}
+
+	if v := c.Query("scrollback"); v != "" {
+		size, err := strconv.Atoi(v)
+		if err != nil || size < 0 {
+			return opts, fmt.Errorf("invalid scrollback")
+		}
+		opts.Scrollback = size
+	}
+
+	if v := c.Query("rows"); v != "" {
+		rows, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return opts, fmt.Errorf("invalid rows")
+		}
+		opts.Rows = uint16(rows)
+	}
+
+	if device := c.Query("serial"); device != "" {
+		serial := &terminal.SerialOptions{
+			Device: device,
+			Parity: c.Query("parity"),
+		}
+		for param, target := range map[string]*int{
+			"baud":     &serial.Baud,
+			"databits": &serial.DataBits,
+			"stopbits": &serial.StopBits,
+		} {
+			if v := c.Query(param); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil {
+					return opts, fmt.Errorf("invalid %s", param)
+				}
+				*target = n
+			}
+		}
+		opts.Serial = serial
+	}
+
+	if attach := c.Query("attach"); attach != "" {
+		kind, target, ok := strings.Cut(attach, ":")
+		if !ok || target == "" {
+			return opts, fmt.Errorf("invalid attach target, expected type:name")
+		}
+		opts.Multiplexer = kind
+		opts.Target = target
+	}
+
+	for _, kv := range c.QueryArray("env") {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || key == "" {
+			return opts, fmt.Errorf("invalid env entry: %s", kv)
+		}
+		if opts.Env == nil {
+			opts.Env = make(map[string]string)
+		}
+		opts.Env[key] = value
+	}
+
+	return opts, nil
 }
 
 // handleTerminalInput reads from WebSocket and writes to PTY
-func (h *TerminalHandler) handleTerminalInput(client *ws.TerminalClient, session *terminal.Session) {
+func (h *TerminalHandler) handleTerminalInput(client *ws.TerminalClient, session *terminal.Session, detach func()) {
 	defer func() {
-		h.manager.CloseSession(session.ID)
-		h.terminalHub.RemoveClient(session.ID)
+		// The session outlives the connection, the manager closes it once idle
+		detach()
+		h.terminalHub.RemoveClient(client)
 	}()
 
 	for {
@@ -96,41 +319,51 @@ func (h *TerminalHandler) handleTerminalInput(client *ws.TerminalClient, session
 		}
 
 		if msgType == websocket.TextMessage {
-			// Check for resize message
+			// Check for control messages
 			var msg struct {
-				Type string `json:"type"`
-				Cols uint16 `json:"cols"`
-				Rows uint16 `json:"rows"`
+				Type     string `json:"type"`
+				Cols     uint16 `json:"cols"`
+				Rows     uint16 `json:"rows"`
+				Protocol string `json:"protocol"`
 			}
-			if err := json.Unmarshal(data, &msg); err == nil && msg.Type == "resize" {
-				session.Resize(msg.Cols, msg.Rows)
-				continue
+			if err := json.Unmarshal(data, &msg); err == nil {
+				switch msg.Type {
+				case "resize":
+					session.Resize(msg.Cols, msg.Rows)
+					continue
+				case "transfer_cancel":
+					// Browser can't handle the transfer, abort it in the PTY
+					session.Write(terminal.CancelSequence(msg.Protocol))
+					continue
+				}
 			}
 		}
 
-		// Write to PTY
+		// Write to PTY, mirrored to linked sessions in broadcast mode
 		if msgType == websocket.BinaryMessage || msgType == websocket.TextMessage {
-			session.Write(data)
+			h.manager.WriteInput(session, data)
 		}
 	}
 }
 
-// handleTerminalOutput reads from PTY and writes to WebSocket
-func (h *TerminalHandler) handleTerminalOutput(client *ws.TerminalClient, session *terminal.Session) {
-	buf := make([]byte, 4096)
-	for {
-		n, err := session.Read(buf)
-		if err != nil {
-			if err != io.EOF {
-				// Terminal closed
+// handleTerminalOutput forwards session output to the WebSocket
+func (h *TerminalHandler) handleTerminalOutput(client *ws.TerminalClient, output <-chan []byte) {
+	// Closing the connection ends the input loop, which detaches the client
+	defer client.Close()
+
+	detector := terminal.NewTransferDetector()
+	for chunk := range output {
+		// Announce ZMODEM/trzsz transfers so the browser can take over the stream
+		if event := detector.Scan(chunk); event != nil {
+			if data, err := json.Marshal(gin.H{"type": "transfer", "protocol": event.Protocol, "direction": event.Direction}); err == nil {
+				if err := client.WriteMessage(websocket.TextMessage, data); err != nil {
+					return
+				}
 			}
-			return
 		}
 
-		if n > 0 {
-			if err := client.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
-				return
-			}
+		if err := client.WriteMessage(websocket.BinaryMessage, chunk); err != nil {
+			return
 		}
 	}
 }
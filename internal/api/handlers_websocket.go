@@ -0,0 +1,115 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/websocket"
+)
+
+// WebSocketHandler handles endpoints about the WebSocket hub
+type WebSocketHandler struct {
+	hub *websocket.Hub
+	bus *events.Bus
+}
+
+// NewWebSocketHandler creates a new WebSocket handler
+func NewWebSocketHandler(hub *websocket.Hub, bus *events.Bus) *WebSocketHandler {
+	return &WebSocketHandler{hub: hub, bus: bus}
+}
+
+// statsResponse holds the counters of the hub and the event bus
+type statsResponse struct {
+	WebSocket websocket.Stats `json:"websocket"`
+	Events    events.Stats    `json:"events"`
+}
+
+// Stats handles GET /api/v1/ws/stats
+func (h *WebSocketHandler) Stats(c *gin.Context) {
+	hubStats := h.hub.Stats()
+	busStats := h.bus.Stats()
+
+	if c.Query("format") == "prometheus" {
+		var b strings.Builder
+		writePrometheus(&b, hubStats, busStats)
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+		return
+	}
+
+	c.JSON(http.StatusOK, statsResponse{
+		WebSocket: hubStats,
+		Events:    busStats,
+	})
+}
+
+// Clients handles GET /api/v1/ws/clients
+func (h *WebSocketHandler) Clients(c *gin.Context) {
+	c.JSON(http.StatusOK, h.hub.Clients())
+}
+
+// Disconnect handles DELETE /api/v1/ws/clients/:id
+func (h *WebSocketHandler) Disconnect(c *gin.Context) {
+	if !h.hub.Disconnect(c.Param("id"), "disconnected by "+requestUser(c)) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "client not found"})
+		return
+	}
+	c.JSON(http.StatusOK, MessageResponse{Message: "client disconnected"})
+}
+
+// writePrometheus writes the realtime counters in the Prometheus text format
+func writePrometheus(b *strings.Builder, hub websocket.Stats, bus events.Stats) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("nebula_ws_clients", "gauge", "Connected WebSocket and event stream clients.")
+	fmt.Fprintf(b, "nebula_ws_clients %d\n", hub.Clients)
+	metric("nebula_ws_clients_peak", "gauge", "Most clients connected at once.")
+	fmt.Fprintf(b, "nebula_ws_clients_peak %d\n", hub.PeakClients)
+	metric("nebula_ws_connections_total", "counter", "Client connections.")
+	fmt.Fprintf(b, "nebula_ws_connections_total %d\n", hub.Connections)
+	metric("nebula_ws_disconnections_total", "counter", "Client disconnections.")
+	fmt.Fprintf(b, "nebula_ws_disconnections_total %d\n", hub.Disconnections)
+	metric("nebula_ws_messages_sent_total", "counter", "Messages written to clients.")
+	fmt.Fprintf(b, "nebula_ws_messages_sent_total %d\n", hub.MessagesSent)
+	metric("nebula_ws_bytes_sent_total", "counter", "Bytes of messages written to clients, before compression.")
+	fmt.Fprintf(b, "nebula_ws_bytes_sent_total %d\n", hub.BytesSent)
+	metric("nebula_ws_messages_dropped_total", "counter", "Messages dropped because a client queue was full.")
+	fmt.Fprintf(b, "nebula_ws_messages_dropped_total %d\n", hub.Queue.Dropped)
+	metric("nebula_ws_messages_coalesced_total", "counter", "Queued messages replaced by a newer one.")
+	fmt.Fprintf(b, "nebula_ws_messages_coalesced_total %d\n", hub.Queue.Coalesced)
+	metric("nebula_ws_slow_disconnects_total", "counter", "Clients disconnected for reading too slowly.")
+	fmt.Fprintf(b, "nebula_ws_slow_disconnects_total %d\n", hub.Queue.Disconnected)
+
+	metric("nebula_ws_topic_messages_total", "counter", "Messages broadcast per topic.")
+	for _, topic := range sortedKeys(hub.Topics) {
+		fmt.Fprintf(b, "nebula_ws_topic_messages_total{topic=%q} %d\n", topic, hub.Topics[topic].Messages)
+	}
+
+	metric("nebula_events_published_total", "counter", "Events published on the bus per topic.")
+	for _, topic := range sortedKeys(bus.Published) {
+		fmt.Fprintf(b, "nebula_events_published_total{topic=%q} %d\n", topic, bus.Published[topic])
+	}
+	metric("nebula_events_dropped_total", "counter", "Event deliveries lost because a subscriber was too slow.")
+	fmt.Fprintf(b, "nebula_events_dropped_total %d\n", bus.Dropped)
+
+	metric("nebula_webhook_deliveries_total", "counter", "Webhook deliveries per target and result.")
+	for _, hook := range bus.Webhooks {
+		fmt.Fprintf(b, "nebula_webhook_deliveries_total{target=%q,result=\"delivered\"} %d\n", hook.Target, hook.Delivered)
+		fmt.Fprintf(b, "nebula_webhook_deliveries_total{target=%q,result=\"failed\"} %d\n", hook.Target, hook.Failed)
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
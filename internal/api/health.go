@@ -0,0 +1,239 @@
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/logging"
+	"github.com/nebula/nebula/internal/storage"
+	"github.com/nebula/nebula/internal/updater"
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// minFreeDisk is the free space below which the database volume makes the
+// server not ready
+const minFreeDisk = 100 << 20
+
+// Overall states of the probes
+const (
+	probeOK          = "ok"
+	probeDegraded    = "degraded"
+	probeUnavailable = "unavailable"
+)
+
+// startedAt is when the server started
+var startedAt = time.Now()
+
+// checkResult is the outcome of checking a dependency
+type checkResult struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	// Critical checks make the server unavailable when they fail, the others
+	// only degraded
+	Critical bool   `json:"critical"`
+	Message  string `json:"message,omitempty"`
+}
+
+// probeResponse is the body of /healthz and /readyz
+type probeResponse struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// memoryStats is the part of runtime.MemStats useful for support
+type memoryStats struct {
+	Alloc        uint64     `json:"alloc"`
+	TotalAlloc   uint64     `json:"total_alloc"`
+	Sys          uint64     `json:"sys"`
+	HeapInuse    uint64     `json:"heap_inuse"`
+	HeapObjects  uint64     `json:"heap_objects"`
+	StackInuse   uint64     `json:"stack_inuse"`
+	NumGC        uint32     `json:"num_gc"`
+	PauseTotalNs uint64     `json:"pause_total_ns"`
+	LastGC       *time.Time `json:"last_gc,omitempty"`
+}
+
+// diagnosticsResponse is the support bundle of /api/v1/diagnostics
+type diagnosticsResponse struct {
+	Version       string               `json:"version"`
+	GoVersion     string               `json:"go_version"`
+	OS            string               `json:"os"`
+	Arch          string               `json:"arch"`
+	StartedAt     time.Time            `json:"started_at"`
+	UptimeSeconds int64                `json:"uptime_seconds"`
+	Goroutines    int                  `json:"goroutines"`
+	Memory        memoryStats          `json:"memory"`
+	Checks        []checkResult        `json:"checks"`
+	Storage       storage.HealthStatus `json:"storage"`
+	RecentErrors  []logging.Entry      `json:"recent_errors"`
+	// Stacks holds the stack of every goroutine, with stacks=true
+	Stacks string `json:"stacks,omitempty"`
+}
+
+// handleLiveness reports whether the server is alive: it answers and its
+// database is intact
+func (r *Router) handleLiveness(c *gin.Context) {
+	respondProbe(c, []checkResult{r.checkStorage()})
+}
+
+// handleReadiness reports whether the server can serve requests, checking
+// every dependency
+func (r *Router) handleReadiness(c *gin.Context) {
+	respondProbe(c, r.readinessChecks())
+}
+
+// handleDiagnostics returns the support bundle: runtime state, dependency
+// checks and the latest errors logged
+func (r *Router) handleDiagnostics(c *gin.Context) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	resp := diagnosticsResponse{
+		Version:       updater.Version,
+		GoVersion:     runtime.Version(),
+		OS:            runtime.GOOS,
+		Arch:          runtime.GOARCH,
+		StartedAt:     startedAt,
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		Goroutines:    runtime.NumGoroutine(),
+		Memory: memoryStats{
+			Alloc:        mem.Alloc,
+			TotalAlloc:   mem.TotalAlloc,
+			Sys:          mem.Sys,
+			HeapInuse:    mem.HeapInuse,
+			HeapObjects:  mem.HeapObjects,
+			StackInuse:   mem.StackInuse,
+			NumGC:        mem.NumGC,
+			PauseTotalNs: mem.PauseTotalNs,
+		},
+		Checks:       r.readinessChecks(),
+		RecentErrors: logging.Recent(),
+	}
+	if mem.LastGC != 0 {
+		last := time.Unix(0, int64(mem.LastGC))
+		resp.Memory.LastGC = &last
+	}
+	if r.store != nil {
+		resp.Storage = r.store.Health()
+	}
+	if c.Query("stacks") == "true" {
+		var buf bytes.Buffer
+		pprof.Lookup("goroutine").WriteTo(&buf, 2)
+		resp.Stacks = buf.String()
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// respondProbe answers a probe: 503 when a critical check failed
+func respondProbe(c *gin.Context, checks []checkResult) {
+	resp := probeResponse{Status: probeOK, Checks: checks}
+	for _, check := range checks {
+		switch {
+		case check.OK:
+		case check.Critical:
+			resp.Status = probeUnavailable
+		case resp.Status == probeOK:
+			resp.Status = probeDegraded
+		}
+	}
+
+	status := http.StatusOK
+	if resp.Status == probeUnavailable {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, resp)
+}
+
+// readinessChecks checks every dependency of the server
+func (r *Router) readinessChecks() []checkResult {
+	return []checkResult{
+		r.checkStorage(),
+		r.checkStorageWrites(),
+		r.checkDiskSpace(),
+		r.checkCollector(),
+		r.checkServiceManager(),
+	}
+}
+
+// checkStorage checks that the database is open and passed its last
+// integrity check
+func (r *Router) checkStorage() checkResult {
+	result := checkResult{Name: "storage", Critical: true}
+	if r.store == nil {
+		result.Message = "storage not available"
+		return result
+	}
+	if health := r.store.Health(); !health.Healthy && !health.LastCheck.IsZero() {
+		result.Message = health.Error
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// checkStorageWrites checks that the database accepts writes
+func (r *Router) checkStorageWrites() checkResult {
+	result := checkResult{Name: "storage_writable", Critical: true}
+	if r.store == nil {
+		result.Message = "storage not available"
+		return result
+	}
+	if err := r.store.Probe(); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.OK = true
+	return result
+}
+
+// checkDiskSpace checks the free space of the database volume
+func (r *Router) checkDiskSpace() checkResult {
+	result := checkResult{Name: "disk_space", Critical: true}
+	if r.store == nil {
+		result.Message = "storage not available"
+		return result
+	}
+	usage, err := disk.Usage(filepath.Dir(r.store.Path()))
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Message = fmt.Sprintf("%d MiB free", usage.Free>>20)
+	result.OK = usage.Free >= minFreeDisk
+	return result
+}
+
+// checkCollector checks that metrics were collected within the last
+// three intervals
+func (r *Router) checkCollector() checkResult {
+	result := checkResult{Name: "metrics_collector"}
+	if r.metricsCollector == nil {
+		result.Message = "metrics collector not available"
+		return result
+	}
+	last := r.metricsCollector.GetLatest().Timestamp
+	if last.IsZero() {
+		result.Message = "no metrics collected yet"
+		return result
+	}
+	age := time.Since(last)
+	result.Message = fmt.Sprintf("last sample %s ago", age.Round(time.Second))
+	result.OK = age <= 3*r.metricsCollector.Interval()
+	return result
+}
+
+// checkServiceManager checks that services can be managed on this system
+func (r *Router) checkServiceManager() checkResult {
+	result := checkResult{Name: "service_manager", OK: r.serviceManager != nil}
+	if !result.OK {
+		result.Message = "service manager not available on this system"
+	}
+	return result
+}
@@ -0,0 +1,340 @@
+package api
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultListLimit is the page size when the client doesn't ask for one
+const defaultListLimit = 100
+
+// maxListLimit caps the page size of list endpoints
+const maxListLimit = 1000
+
+// listQueryKey is the context key listMiddleware stores the query under
+const listQueryKey = "listQuery"
+
+// ListQuery holds the paging, sorting and filtering parameters shared by
+// the list endpoints:
+//
+//	limit=50            page size, up to maxListLimit
+//	cursor=...          next_cursor of the previous page
+//	sort=name, sort=-cpu_percent
+//	                    JSON field to sort by, descending with a leading -
+//	filter=status:running
+//	                    case-insensitive field equality, repeatable
+//	q=nginx             case-insensitive substring of any text field
+type ListQuery struct {
+	Limit   int
+	Cursor  string
+	Sort    string
+	Desc    bool
+	Filters map[string]string
+	Text    string
+}
+
+// listMiddleware parses the list parameters of the request, rejecting
+// malformed ones before the handler runs
+func listMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		q, err := parseListQuery(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+			return
+		}
+		c.Set(listQueryKey, q)
+		c.Next()
+	}
+}
+
+// parseListQuery reads the list parameters of the request
+func parseListQuery(c *gin.Context) (ListQuery, error) {
+	q := ListQuery{
+		Limit:  defaultListLimit,
+		Cursor: c.Query("cursor"),
+		Text:   c.Query("q"),
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return q, fmt.Errorf("invalid limit")
+		}
+		q.Limit = min(limit, maxListLimit)
+	}
+
+	if v := c.Query("sort"); v != "" {
+		q.Sort = strings.TrimPrefix(v, "-")
+		q.Desc = strings.HasPrefix(v, "-")
+		if q.Sort == "" {
+			return q, fmt.Errorf("invalid sort")
+		}
+	}
+
+	for _, v := range c.QueryArray("filter") {
+		field, value, ok := strings.Cut(v, ":")
+		if !ok || field == "" {
+			return q, fmt.Errorf("invalid filter %q, expected field:value", v)
+		}
+		if q.Filters == nil {
+			q.Filters = make(map[string]string)
+		}
+		q.Filters[field] = value
+	}
+	return q, nil
+}
+
+// listQuery returns the query parsed by listMiddleware
+func listQuery(c *gin.Context) ListQuery {
+	if v, ok := c.Get(listQueryKey); ok {
+		return v.(ListQuery)
+	}
+	q, _ := parseListQuery(c)
+	return q
+}
+
+// respondList writes the page of items selected by q
+func respondList[T any](c *gin.Context, q ListQuery, items []T) {
+	page, err := pageItems(q, items)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+// pageItems filters and sorts items, then returns the page q asks for.
+// Cursors are offsets into the filtered list.
+func pageItems[T any](q ListQuery, items []T) (ListResponse[T], error) {
+	m, err := newMatcher[T](q)
+	if err != nil {
+		return ListResponse[T]{}, err
+	}
+
+	offset := 0
+	if q.Cursor != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err == nil {
+			offset, err = strconv.Atoi(string(raw))
+		}
+		if err != nil || offset < 0 {
+			return ListResponse[T]{}, fmt.Errorf("invalid cursor")
+		}
+	}
+
+	selected := make([]T, 0, len(items))
+	for _, item := range items {
+		if m.matches(item) {
+			selected = append(selected, item)
+		}
+	}
+	if q.Sort != "" {
+		m.sort(selected)
+	}
+
+	page := ListResponse[T]{Items: []T{}, Total: len(selected)}
+	if offset >= len(selected) {
+		return page, nil
+	}
+	end := len(selected)
+	if q.Limit > 0 && offset+q.Limit < end {
+		end = offset + q.Limit
+		page.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(end)))
+	}
+	page.Items = selected[offset:end]
+	return page, nil
+}
+
+// matcher applies a list query to items of type T, addressing their
+// fields by JSON name
+type matcher[T any] struct {
+	q       ListQuery
+	fields  map[string][]int // JSON name to field index
+	filters map[string]string
+	text    string
+}
+
+// newMatcher resolves the fields q refers to, failing on unknown ones
+func newMatcher[T any](q ListQuery) (*matcher[T], error) {
+	m := &matcher[T]{q: q, fields: jsonFields(reflect.TypeOf((*T)(nil)).Elem()), text: strings.ToLower(q.Text)}
+
+	if q.Sort != "" {
+		index, ok := m.fields[q.Sort]
+		if !ok || !sortable(m.fieldType(index)) {
+			return nil, fmt.Errorf("cannot sort by %q", q.Sort)
+		}
+	}
+	for field, value := range q.Filters {
+		if _, ok := m.fields[field]; !ok {
+			return nil, fmt.Errorf("cannot filter by %q", field)
+		}
+		if m.filters == nil {
+			m.filters = make(map[string]string)
+		}
+		m.filters[field] = strings.ToLower(value)
+	}
+	return m, nil
+}
+
+// matches reports whether item passes the filters and text search
+func (m *matcher[T]) matches(item T) bool {
+	v := reflect.ValueOf(item)
+	for field, want := range m.filters {
+		if strings.ToLower(formatValue(fieldValue(v, m.fields[field]))) != want {
+			return false
+		}
+	}
+	if m.text == "" {
+		return true
+	}
+	for _, index := range m.fields {
+		f := fieldValue(v, index)
+		if f.Kind() == reflect.String && strings.Contains(strings.ToLower(f.String()), m.text) {
+			return true
+		}
+	}
+	return false
+}
+
+// sort orders items by the sort field, keeping the order of equal items
+func (m *matcher[T]) sort(items []T) {
+	index := m.fields[m.q.Sort]
+	sort.SliceStable(items, func(i, j int) bool {
+		a := fieldValue(reflect.ValueOf(items[i]), index)
+		b := fieldValue(reflect.ValueOf(items[j]), index)
+		if m.q.Desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
+
+// fieldType returns the type of the field at index, dereferencing pointers
+func (m *matcher[T]) fieldType(index []int) reflect.Type {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	f := t.FieldByIndex(index).Type
+	if f.Kind() == reflect.Pointer {
+		f = f.Elem()
+	}
+	return f
+}
+
+// jsonFields maps the JSON names of the fields of struct type t to their
+// index, following embedded structs
+func jsonFields(t reflect.Type) map[string][]int {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	fields := make(map[string][]int)
+	if t.Kind() != reflect.Struct {
+		return fields
+	}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Index
+	}
+	return fields
+}
+
+// fieldValue returns the field of v at index, the zero Value when a nil
+// pointer is in the way
+func fieldValue(v reflect.Value, index []int) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	f, err := v.FieldByIndexErr(index)
+	if err != nil {
+		return reflect.Value{}
+	}
+	for f.Kind() == reflect.Pointer {
+		if f.IsNil() {
+			return reflect.Value{}
+		}
+		f = f.Elem()
+	}
+	return f
+}
+
+// sortable reports whether fields of type t can be sorted
+func sortable(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// less orders two values of a sortable field. Missing values come first.
+func less(a, b reflect.Value) bool {
+	if !a.IsValid() || !b.IsValid() {
+		return !a.IsValid() && b.IsValid()
+	}
+	if t, ok := a.Interface().(time.Time); ok {
+		return t.Before(b.Interface().(time.Time))
+	}
+	switch a.Kind() {
+	case reflect.String:
+		return strings.ToLower(a.String()) < strings.ToLower(b.String())
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	}
+	return false
+}
+
+// formatValue returns the text filters compare a field value with
+func formatValue(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return fmt.Sprint(v.Interface())
+}
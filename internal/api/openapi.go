@@ -0,0 +1,196 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/cluster"
+	"github.com/nebula/nebula/internal/openapi"
+	"github.com/nebula/nebula/internal/updater"
+)
+
+// Security schemes of the API
+const (
+	securityBasic   = "basicAuth"
+	securityCluster = "clusterToken"
+)
+
+// pathParamPattern matches the :name and *name parameters of gin paths
+var pathParamPattern = regexp.MustCompile(`[:*](\w+)`)
+
+// handlerNamePattern extracts the receiver and method of a handler name,
+// e.g. github.com/nebula/nebula/internal/api.(*ServiceHandler).List-fm
+var handlerNamePattern = regexp.MustCompile(`\(\*(\w+)\)\.(\w+)`)
+
+// handleOpenAPI serves the OpenAPI document of the routes, built on the
+// first request once every route is registered
+func (r *Router) handleOpenAPI(c *gin.Context) {
+	r.specOnce.Do(func() {
+		spec, err := json.Marshal(r.buildOpenAPI())
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to encode the OpenAPI document", "error", err)
+			return
+		}
+		r.spec = spec
+	})
+	if r.spec == nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "OpenAPI document not available"})
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", r.spec)
+}
+
+// buildOpenAPI describes the routes registered on the engine with the
+// operationDocs. Routes without docs are listed with their path parameters.
+func (r *Router) buildOpenAPI() *openapi.Document {
+	doc := openapi.New("Nebula API", updater.Version, "System Administration Panel API")
+	if r.basePath != "" {
+		doc.Servers = []openapi.Server{{URL: r.basePath}}
+	}
+	doc.AddSecurityScheme(securityBasic, &openapi.SecurityScheme{Type: "http", Scheme: "basic"})
+	doc.AddSecurityScheme(securityCluster, &openapi.SecurityScheme{Type: "apiKey", In: "header", Name: cluster.TokenHeader})
+	errorSchema := doc.SchemaOf(ErrorResponse{})
+
+	for _, route := range r.engine.Routes() {
+		if route.Path == "/openapi.json" || strings.HasPrefix(route.Path, "/swagger/") {
+			continue
+		}
+
+		d, ok := operationDocs[route.Method+" "+route.Path]
+		id := operationID(route.Handler)
+		if rest, v2 := strings.CutPrefix(route.Path, "/api/v2/"); v2 {
+			// v2 reads shared with v1 keep the v1 docs
+			if !ok {
+				d, ok = operationDocs[route.Method+" /api/v1/"+rest]
+			}
+			id += "V2"
+		}
+		if !ok {
+			// Any registers the same handler for every method
+			if d, ok = operationDocs["ANY "+route.Path]; ok {
+				id += strings.ToUpper(route.Method[:1]) + strings.ToLower(route.Method[1:])
+			}
+		}
+
+		op := &openapi.Operation{
+			OperationID: id,
+			Summary:     d.summary,
+			Description: d.description,
+			Parameters:  parameters(route.Path, d.params),
+			Responses:   make(map[string]*openapi.Response),
+		}
+		if d.tag != "" {
+			op.Tags = []string{d.tag}
+		}
+
+		switch {
+		case d.upload != "":
+			form := &openapi.Schema{
+				Type:       "object",
+				Properties: map[string]*openapi.Schema{d.upload: {Type: "string", Format: "binary"}},
+				Required:   append([]string{d.upload}, d.formFields...),
+			}
+			for _, field := range d.formFields {
+				form.Properties[field] = &openapi.Schema{Type: "string"}
+			}
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{"multipart/form-data": {Schema: form}},
+			}
+		case d.consumes != "":
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{d.consumes: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}},
+			}
+		case d.body != nil:
+			op.RequestBody = &openapi.RequestBody{
+				Required: !d.optionalBody,
+				Content:  openapi.JSONContent(doc.SchemaOf(d.body)),
+			}
+		}
+
+		status := d.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		success := &openapi.Response{Description: http.StatusText(status)}
+		switch {
+		case d.produces == "application/octet-stream":
+			success.Content = map[string]openapi.MediaType{d.produces: {Schema: &openapi.Schema{Type: "string", Format: "binary"}}}
+		case d.produces != "":
+			success.Content = map[string]openapi.MediaType{d.produces: {Schema: &openapi.Schema{Type: "string"}}}
+		case d.response != nil:
+			success.Content = openapi.JSONContent(doc.SchemaOf(d.response))
+		}
+		op.Responses[strconv.Itoa(status)] = success
+
+		failures := d.errors
+		if authenticated(route.Path) {
+			op.Security = []map[string][]string{{securityCluster: {}}}
+			if !d.clusterToken {
+				op.Security = append([]map[string][]string{{securityBasic: {}}}, op.Security...)
+			}
+			failures = append([]int{http.StatusUnauthorized, http.StatusTooManyRequests}, failures...)
+		}
+		for _, code := range failures {
+			op.Responses[strconv.Itoa(code)] = &openapi.Response{
+				Description: http.StatusText(code),
+				Content:     openapi.JSONContent(errorSchema),
+			}
+		}
+
+		doc.AddOperation(route.Method, pathParamPattern.ReplaceAllString(route.Path, "{$1}"), op)
+	}
+	return doc
+}
+
+// authenticated reports whether the route at path requires the credentials
+// of the API
+func authenticated(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/ws" || strings.HasPrefix(path, "/ws/") ||
+		path == "/events" || strings.HasPrefix(path, "/events/")
+}
+
+// parameters returns the documented parameters of a route, adding its
+// undocumented path parameters
+func parameters(path string, docs []paramDoc) []openapi.Parameter {
+	var params []openapi.Parameter
+	documented := make(map[string]bool)
+	for _, p := range docs {
+		params = append(params, openapi.Parameter{
+			Name:        p.name,
+			In:          p.in,
+			Description: p.description,
+			Required:    p.required || p.in == "path",
+			Schema:      &openapi.Schema{Type: p.kind},
+		})
+		if p.in == "path" {
+			documented[p.name] = true
+		}
+	}
+
+	for _, m := range pathParamPattern.FindAllStringSubmatch(path, -1) {
+		if !documented[m[1]] {
+			params = append(params, openapi.Parameter{Name: m[1], In: "path", Required: true, Schema: &openapi.Schema{Type: "string"}})
+		}
+	}
+	return params
+}
+
+// operationID names an operation after its handler, e.g. serviceList for
+// ServiceHandler.List and health for Router.handleHealth
+func operationID(handler string) string {
+	m := handlerNamePattern.FindStringSubmatch(handler)
+	if m == nil {
+		return ""
+	}
+	receiver := strings.TrimSuffix(strings.TrimSuffix(m[1], "Handler"), "Router")
+	method := strings.TrimPrefix(m[2], "handle")
+	id := receiver + strings.ToUpper(method[:1]) + method[1:]
+	return strings.ToLower(id[:1]) + id[1:]
+}
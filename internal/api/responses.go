@@ -0,0 +1,22 @@
+package api
+
+// ErrorResponse is the body of every error response
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Problems lists the invalid settings of a rejected configuration change
+	Problems []string `json:"problems,omitempty"`
+}
+
+// MessageResponse is the body of operations that only report success
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// ListResponse is one page of a list endpoint
+type ListResponse[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of items matching the query across all pages
+	Total int `json:"total"`
+	// NextCursor is the cursor of the following page, empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
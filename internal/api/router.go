@@ -1,16 +1,45 @@
 package api
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
 	"net/http"
+	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nebula/nebula/internal/auth"
+	"github.com/nebula/nebula/internal/certs"
+	"github.com/nebula/nebula/internal/cluster"
 	"github.com/nebula/nebula/internal/config"
+	"github.com/nebula/nebula/internal/containers"
+	"github.com/nebula/nebula/internal/events"
 	"github.com/nebula/nebula/internal/files"
+	"github.com/nebula/nebula/internal/httpmetrics"
+	"github.com/nebula/nebula/internal/jobs"
+	"github.com/nebula/nebula/internal/lockout"
+	"github.com/nebula/nebula/internal/logging"
 	"github.com/nebula/nebula/internal/metrics"
+	"github.com/nebula/nebula/internal/mounts"
+	"github.com/nebula/nebula/internal/notify"
 	"github.com/nebula/nebula/internal/packages"
+	"github.com/nebula/nebula/internal/password"
+	"github.com/nebula/nebula/internal/power"
 	"github.com/nebula/nebula/internal/process"
+	"github.com/nebula/nebula/internal/ratelimit"
+	"github.com/nebula/nebula/internal/scheduler"
 	"github.com/nebula/nebula/internal/service"
+	"github.com/nebula/nebula/internal/storage"
 	"github.com/nebula/nebula/internal/terminal"
 	"github.com/nebula/nebula/internal/updater"
 	"github.com/nebula/nebula/internal/websocket"
@@ -21,34 +50,73 @@ import (
 
 // Router holds all route handlers and dependencies
 type Router struct {
-	engine           *gin.Engine
-	config           *config.Manager
-	metricsHandler   *MetricsHandler
-	processHandler   *ProcessHandler
-	serviceHandler   *ServiceHandler
-	filesHandler     *FilesHandler
-	packagesHandler  *PackagesHandler
-	terminalHandler  *TerminalHandler
-	systemHandler    *SystemHandler
-	authHandler      *AuthHandler
-	hub              *websocket.Hub
-	terminalHub      *websocket.TerminalHub
-	metricsCollector *metrics.Collector
-	privilegeManager *auth.PrivilegeManager
+	engine            *gin.Engine
+	config            *config.Manager
+	metricsHandler    *MetricsHandler
+	processHandler    *ProcessHandler
+	serviceHandler    *ServiceHandler
+	filesHandler      *FilesHandler
+	packagesHandler   *PackagesHandler
+	containersHandler *ContainersHandler
+	certsHandler      *CertificatesHandler
+	terminalHandler   *TerminalHandler
+	systemHandler     *SystemHandler
+	powerHandler      *PowerHandler
+	sysconfHandler    *SysconfHandler
+	mountsHandler     *MountsHandler
+	notifyHandler     *NotifyHandler
+	tasksHandler      *TasksHandler
+	authHandler       *AuthHandler
+	storageHandler    *StorageHandler
+	auditHandler      *AuditHandler
+	sessionsHandler   *SessionsHandler
+	oidcHandler       *OIDCHandler
+	passkeysHandler   *PasskeysHandler
+	jobsHandler       *JobsHandler
+	websocketHandler  *WebSocketHandler
+	clusterHandler    *ClusterHandler
+	store             *storage.Storage
+	bus               *events.Bus
+	hub               *websocket.Hub
+	terminalHub       *websocket.TerminalHub
+	metricsCollector  *metrics.Collector
+	serviceManager    service.Manager
+	privilegeManager  *auth.PrivilegeManager
+	limiter           *ratelimit.Limiter
+	guard             *lockout.Guard
+	pam               *auth.PAMAuthenticator
+	passwords         *password.Verifier
+	tickets           *ticketStore
+	httpMetrics       *httpmetrics.Recorder
+	basePath          string
+	specOnce          sync.Once
+	spec              []byte
 }
 
 // NewRouter creates a new router with all dependencies
 func NewRouter(
 	cfg *config.Manager,
-	store interface{},
+	store *storage.Storage,
 	metricsCollector *metrics.Collector,
 	processManager *process.Manager,
 	serviceManager service.Manager,
 	filesManager *files.Manager,
+	fileRoots *files.Roots,
+	fileRemotes *files.Remotes,
 	packagesManager packages.Manager,
+	containersManager *containers.Manager,
+	certInventory *certs.Inventory,
 	terminalManager *terminal.Manager,
 	upd *updater.Updater,
+	powerManager *power.Manager,
+	mountsManager *mounts.Manager,
+	notifyManager *notify.Manager,
+	taskScheduler *scheduler.Scheduler,
 	privilegeManager *auth.PrivilegeManager,
+	limiter *ratelimit.Limiter,
+	guard *lockout.Guard,
+	bus *events.Bus,
+	registry *cluster.Registry,
 ) *Router {
 	// Set Gin mode based on config
 	if cfg.Get().Logging.Level == "debug" {
@@ -57,29 +125,69 @@ func NewRouter(
 		gin.SetMode(gin.ReleaseMode)
 	}
 
+	basePath := cfg.Get().Server.BasePath
+
+	httpMetrics := httpmetrics.NewRecorder()
+
 	engine := gin.New()
-	engine.Use(gin.Recovery())
-	engine.Use(corsMiddleware())
+	// Client addresses key rate limits and lockouts, X-Forwarded-For is
+	// only read from the configured proxies
+	if err := engine.SetTrustedProxies(cfg.Get().Server.TrustedProxies); err != nil {
+		slog.Error("Invalid trusted proxies", "error", err)
+	}
+	engine.Use(basePathMiddleware(basePath))
 	engine.Use(loggerMiddleware())
+	engine.Use(requestMetricsMiddleware(httpMetrics))
+	engine.Use(recoveryMiddleware())
+	engine.Use(corsMiddleware())
+	engine.Use(clusterMiddleware(cfg, bus))
 
-	hub := websocket.NewHub()
+	hub := websocket.NewHub(cfg.Get().WebSocket.ResumeBuffer)
 	terminalHub := websocket.NewTerminalHub()
+	jobManager := jobs.NewManager()
 
 	r := &Router{
-		engine:           engine,
-		config:           cfg,
-		hub:              hub,
-		terminalHub:      terminalHub,
-		metricsCollector: metricsCollector,
-		privilegeManager: privilegeManager,
-		metricsHandler:   NewMetricsHandler(metricsCollector),
-		processHandler:   NewProcessHandler(processManager),
-		serviceHandler:   NewServiceHandler(serviceManager),
-		filesHandler:     NewFilesHandler(filesManager),
-		packagesHandler:  NewPackagesHandler(packagesManager),
-		terminalHandler:  NewTerminalHandler(terminalManager, terminalHub),
-		systemHandler:    NewSystemHandler(cfg, metricsCollector, upd),
-		authHandler:      NewAuthHandler(privilegeManager),
+		engine:            engine,
+		config:            cfg,
+		hub:               hub,
+		terminalHub:       terminalHub,
+		metricsCollector:  metricsCollector,
+		serviceManager:    serviceManager,
+		privilegeManager:  privilegeManager,
+		limiter:           limiter,
+		guard:             guard,
+		pam:               auth.NewPAMAuthenticator(),
+		passwords:         password.NewVerifier(),
+		tickets:           newTicketStore(),
+		httpMetrics:       httpMetrics,
+		basePath:          basePath,
+		metricsHandler:    NewMetricsHandler(metricsCollector, store),
+		processHandler:    NewProcessHandler(processManager),
+		serviceHandler:    NewServiceHandler(serviceManager, bus),
+		filesHandler:      NewFilesHandler(filesManager, fileRoots, fileRemotes, bus, jobManager, store),
+		packagesHandler:   NewPackagesHandler(packagesManager, jobManager),
+		containersHandler: NewContainersHandler(containersManager, bus),
+		certsHandler:      NewCertificatesHandler(certInventory, cfg, serviceManager, store, bus),
+		terminalHandler:   NewTerminalHandler(terminalManager, terminalHub, filesManager, bus),
+		systemHandler:     NewSystemHandler(cfg, metricsCollector, upd),
+		powerHandler:      NewPowerHandler(powerManager, store, bus),
+		sysconfHandler:    NewSysconfHandler(store, bus),
+		mountsHandler:     NewMountsHandler(mountsManager, store, bus),
+		notifyHandler:     NewNotifyHandler(notifyManager, store, bus),
+		tasksHandler:      NewTasksHandler(taskScheduler, store, bus),
+		authHandler:       NewAuthHandler(privilegeManager, guard, bus),
+		storageHandler:    NewStorageHandler(store, cfg, notifyManager, taskScheduler),
+		auditHandler:      NewAuditHandler(store),
+		sessionsHandler:   NewSessionsHandler(store, cfg, bus),
+		oidcHandler:       NewOIDCHandler(store, cfg, bus),
+		passkeysHandler:   NewPasskeysHandler(store, cfg, bus),
+		jobsHandler:       NewJobsHandler(jobManager, bus),
+		websocketHandler:  NewWebSocketHandler(hub, bus),
+		store:             store,
+		bus:               bus,
+	}
+	if registry != nil {
+		r.clusterHandler = NewClusterHandler(registry)
 	}
 
 	r.setupRoutes()
@@ -91,10 +199,15 @@ func (r *Router) setupRoutes() {
 	// Auth middleware (optional)
 	authMiddleware := r.authMiddleware()
 
-	// API v1 group
+	// API v1 group, the middleware checks auth.enabled on every request so it can be toggled at runtime
 	v1 := r.engine.Group("/api/v1")
-	if r.config.Get().Auth.Enabled {
-		v1.Use(authMiddleware)
+	v1.Use(ipRateLimitMiddleware(r.limiter))
+	v1.Use(authMiddleware)
+	v1.Use(roleMiddleware())
+	v1.Use(elevationMiddleware(r.privilegeManager))
+	v1.Use(rateLimitMiddleware(r.limiter))
+	if r.store != nil {
+		v1.Use(auditMiddleware(r.store, r.bus))
 	}
 
 	// Metrics routes
@@ -105,14 +218,14 @@ func (r *Router) setupRoutes() {
 		metricsGroup.GET("/disk", r.metricsHandler.GetDisk)
 		metricsGroup.GET("/network", r.metricsHandler.GetNetwork)
 		metricsGroup.GET("/all", r.metricsHandler.GetAll)
-		metricsGroup.GET("/history", r.metricsHandler.GetHistory)
+		metricsGroup.GET("/history", listMiddleware(), r.metricsHandler.GetHistory)
 	}
 
 	// Process routes
 	processGroup := v1.Group("/processes")
 	{
-		processGroup.GET("", r.processHandler.List)
-		processGroup.GET("/search", r.processHandler.Search)
+		processGroup.GET("", listMiddleware(), r.processHandler.List)
+		processGroup.GET("/search", listMiddleware(), r.processHandler.Search)
 		processGroup.GET("/:pid", r.processHandler.Get)
 		processGroup.POST("/:pid/kill", r.processHandler.Kill)
 		processGroup.GET("/:pid/tree", r.processHandler.Tree)
@@ -121,7 +234,7 @@ func (r *Router) setupRoutes() {
 	// Service routes
 	serviceGroup := v1.Group("/services")
 	{
-		serviceGroup.GET("", r.serviceHandler.List)
+		serviceGroup.GET("", listMiddleware(), r.serviceHandler.List)
 		serviceGroup.GET("/:name", r.serviceHandler.Get)
 		serviceGroup.POST("/:name/start", r.serviceHandler.Start)
 		serviceGroup.POST("/:name/stop", r.serviceHandler.Stop)
@@ -134,7 +247,7 @@ func (r *Router) setupRoutes() {
 	// Files routes
 	filesGroup := v1.Group("/files")
 	{
-		filesGroup.GET("/list", r.filesHandler.List)
+		filesGroup.GET("/list", listMiddleware(), r.filesHandler.List)
 		filesGroup.GET("/info", r.filesHandler.Info)
 		filesGroup.GET("/download", r.filesHandler.Download)
 		filesGroup.POST("/upload", r.filesHandler.Upload)
@@ -143,13 +256,14 @@ func (r *Router) setupRoutes() {
 		filesGroup.PUT("/rename", r.filesHandler.Rename)
 		filesGroup.GET("/read", r.filesHandler.Read)
 		filesGroup.PUT("/write", r.filesHandler.Write)
+		filesGroup.PUT("/permissions", r.filesHandler.Permissions)
 	}
 
 	// Packages routes
 	packagesGroup := v1.Group("/packages")
 	{
-		packagesGroup.GET("", r.packagesHandler.List)
-		packagesGroup.GET("/search", r.packagesHandler.Search)
+		packagesGroup.GET("", listMiddleware(), r.packagesHandler.List)
+		packagesGroup.GET("/search", listMiddleware(), r.packagesHandler.Search)
 		packagesGroup.GET("/info", r.packagesHandler.Info)
 		packagesGroup.GET("/type", r.packagesHandler.GetType)
 		packagesGroup.POST("/install", r.packagesHandler.Install)
@@ -158,78 +272,711 @@ func (r *Router) setupRoutes() {
 		packagesGroup.POST("/upgrade-all", r.packagesHandler.UpgradeAll)
 	}
 
+	// Container routes
+	containersGroup := v1.Group("/containers")
+	{
+		containersGroup.GET("", r.containersHandler.List)
+		containersGroup.GET("/runtime", r.containersHandler.Runtime)
+		containersGroup.GET("/images", r.containersHandler.Images)
+		containersGroup.POST("/images/pull", r.containersHandler.Pull)
+		containersGroup.POST("/prune", r.containersHandler.Prune)
+		containersGroup.GET("/:id", r.containersHandler.Inspect)
+		containersGroup.POST("/:id/start", r.containersHandler.Start)
+		containersGroup.POST("/:id/stop", r.containersHandler.Stop)
+		containersGroup.POST("/:id/restart", r.containersHandler.Restart)
+		containersGroup.GET("/:id/logs", r.containersHandler.Logs)
+		containersGroup.GET("/:id/stats", r.containersHandler.Stats)
+	}
+
+	// TLS certificate routes
+	certsGroup := v1.Group("/certificates")
+	{
+		certsGroup.GET("", r.certsHandler.List)
+		certsGroup.POST("", r.certsHandler.Upload)
+		certsGroup.POST("/scan", r.certsHandler.Scan)
+		certsGroup.POST("/reload", r.certsHandler.Reload)
+	}
+
 	// Terminal routes
 	terminalGroup := v1.Group("/terminal")
 	{
 		terminalGroup.GET("/shells", r.terminalHandler.GetShells)
 		terminalGroup.GET("/sessions", r.terminalHandler.GetSessions)
+		terminalGroup.DELETE("/sessions/:id", r.terminalHandler.TerminateSession)
+		terminalGroup.GET("/multiplexers", r.terminalHandler.GetMultiplexers)
+		terminalGroup.GET("/serial", r.terminalHandler.GetSerialDevices)
+		terminalGroup.GET("/broadcast", r.terminalHandler.GetBroadcast)
+		terminalGroup.PUT("/broadcast", r.terminalHandler.SetBroadcast)
+		terminalGroup.DELETE("/broadcast", r.terminalHandler.ClearBroadcast)
 	}
 
 	// System routes
 	v1.GET("/system/info", r.systemHandler.GetSystemInfo)
+	v1.GET("/system/power", r.powerHandler.GetPower)
+	v1.DELETE("/system/power", r.powerHandler.CancelPower)
+	v1.POST("/system/reboot", r.powerHandler.Reboot)
+	v1.POST("/system/shutdown", r.powerHandler.Shutdown)
+	v1.POST("/system/suspend", r.powerHandler.Suspend)
+	v1.GET("/system/settings", r.sysconfHandler.GetSettings)
+	v1.PUT("/system/hostname", r.sysconfHandler.SetHostname)
+	v1.PUT("/system/timezone", r.sysconfHandler.SetTimezone)
+	v1.PUT("/system/ntp", r.sysconfHandler.SetNTP)
+	v1.PUT("/system/locale", r.sysconfHandler.SetLocale)
+	v1.GET("/system/timezones", r.sysconfHandler.Timezones)
+	v1.GET("/system/locales", r.sysconfHandler.Locales)
+
+	// Mount routes, changes run with the privilege manager
+	mountsGroup := v1.Group("/mounts")
+	{
+		mountsGroup.GET("", listMiddleware(), r.mountsHandler.List)
+		mountsGroup.POST("", r.mountsHandler.Mount)
+		mountsGroup.DELETE("", r.mountsHandler.Unmount)
+		mountsGroup.GET("/fstab", listMiddleware(), r.mountsHandler.Fstab)
+		mountsGroup.PUT("/fstab", r.mountsHandler.SetFstabEntry)
+		mountsGroup.DELETE("/fstab", r.mountsHandler.RemoveFstabEntry)
+	}
 	v1.GET("/config", r.systemHandler.GetConfig)
+	v1.PATCH("/config", r.systemHandler.PatchConfig)
+	v1.GET("/config/schema", r.systemHandler.GetConfigSchema)
+	v1.GET("/config/history", r.systemHandler.GetConfigHistory)
 	v1.POST("/config/reload", r.systemHandler.ReloadConfig)
 	v1.GET("/update/check", r.systemHandler.CheckUpdate)
 	v1.POST("/update/apply", r.systemHandler.ApplyUpdate)
+	v1.GET("/update/status", r.systemHandler.GetUpdateStatus)
+	v1.GET("/update/versions", r.systemHandler.GetSavedVersions)
+	v1.POST("/update/rollback", r.systemHandler.RollbackUpdate)
 	v1.GET("/version", r.systemHandler.GetVersion)
 
+	// Notification routes
+	notifyGroup := v1.Group("/notifications")
+	{
+		notifyGroup.GET("/channels", r.notifyHandler.ListChannels)
+		notifyGroup.PUT("/channels/:name", r.notifyHandler.SaveChannel)
+		notifyGroup.DELETE("/channels/:name", r.notifyHandler.DeleteChannel)
+		notifyGroup.POST("/channels/:name/test", r.notifyHandler.TestChannel)
+		notifyGroup.GET("/rules", r.notifyHandler.ListRules)
+		notifyGroup.POST("/rules", r.notifyHandler.CreateRule)
+		notifyGroup.PUT("/rules/:id", r.notifyHandler.UpdateRule)
+		notifyGroup.DELETE("/rules/:id", r.notifyHandler.DeleteRule)
+		notifyGroup.GET("/deliveries", r.notifyHandler.Deliveries)
+	}
+
+	// Scheduled task routes
+	tasksGroup := v1.Group("/tasks")
+	{
+		tasksGroup.GET("", r.tasksHandler.List)
+		tasksGroup.POST("", r.tasksHandler.Create)
+		tasksGroup.GET("/runs", r.tasksHandler.AllRuns)
+		tasksGroup.GET("/:id", r.tasksHandler.Get)
+		tasksGroup.PUT("/:id", r.tasksHandler.Update)
+		tasksGroup.DELETE("/:id", r.tasksHandler.Delete)
+		tasksGroup.POST("/:id/run", r.tasksHandler.Run)
+		tasksGroup.GET("/:id/runs", r.tasksHandler.Runs)
+	}
+
+	// Storage routes
+	v1.POST("/storage/backup", adminMiddleware(), r.storageHandler.Backup)
+	v1.GET("/storage/retention", r.storageHandler.GetRetention)
+	v1.GET("/storage/export", adminMiddleware(), r.storageHandler.Export)
+	v1.POST("/storage/import", adminMiddleware(), r.storageHandler.Import)
+
+	// Audit routes
+	v1.GET("/audit", listMiddleware(), r.auditHandler.Query)
+
+	// Support bundle and request metrics of the panel itself
+	v1.GET("/diagnostics", r.handleDiagnostics)
+	v1.GET("/status", r.handleStatus)
+	v1.GET("/prometheus", r.handlePrometheus)
+
+	// WebSocket hub routes
+	v1.GET("/ws/stats", r.websocketHandler.Stats)
+	v1.GET("/ws/clients", r.websocketHandler.Clients)
+	v1.DELETE("/ws/clients/:id", r.websocketHandler.Disconnect)
+
+	// Cluster routes, agents register with the cluster token instead of the user credentials
+	if r.clusterHandler != nil {
+		r.engine.POST("/api/v1/cluster/register", ipRateLimitMiddleware(r.limiter), r.clusterHandler.Register)
+		v1.GET("/hosts", r.clusterHandler.Hosts)
+		v1.DELETE("/hosts/:name", r.clusterHandler.RemoveHost)
+		v1.Any("/hosts/:name/proxy/*path", r.clusterHandler.Proxy)
+	}
+
 	// Auth routes
 	authGroup := v1.Group("/auth")
 	{
 		authGroup.GET("/status", r.authHandler.GetPrivilegeStatus)
+		authGroup.GET("/credentials", r.authHandler.GetCredentials)
 		authGroup.POST("/credentials", r.authHandler.SetCredentials)
+		authGroup.POST("/credentials/extend", r.authHandler.ExtendCredentials)
 		authGroup.DELETE("/credentials", r.authHandler.ClearCredentials)
 		authGroup.POST("/validate", r.authHandler.ValidateCredentials)
+		authGroup.POST("/key/rotate", r.authHandler.RotateKey)
+		authGroup.POST("/elevate", r.authHandler.Elevate)
+		authGroup.DELETE("/elevate", r.authHandler.RevokeElevation)
+		authGroup.POST("/ticket", r.handleStreamTicket)
+		authGroup.POST("/sessions", r.sessionsHandler.Create)
+		authGroup.GET("/sessions", listMiddleware(), r.sessionsHandler.List)
+		authGroup.DELETE("/sessions", r.sessionsHandler.RevokeUser)
+		authGroup.DELETE("/sessions/:id", r.sessionsHandler.Revoke)
+		authGroup.POST("/passkeys/registration", r.passkeysHandler.BeginRegistration)
+		authGroup.POST("/passkeys", r.passkeysHandler.Register)
+		authGroup.GET("/passkeys", listMiddleware(), r.passkeysHandler.List)
+		authGroup.DELETE("/passkeys/:id", r.passkeysHandler.Delete)
 	}
 
-	// WebSocket routes
-	r.engine.GET("/ws/metrics", r.handleMetricsWebSocket)
-	r.engine.GET("/ws/terminal", r.terminalHandler.HandleWebSocket)
+	// OpenID Connect login, made before the user is authenticated
+	r.engine.GET("/api/v1/auth/oidc/login", ipRateLimitMiddleware(r.limiter), r.oidcHandler.Login)
+	r.engine.GET("/api/v1/auth/oidc/callback", ipRateLimitMiddleware(r.limiter), r.oidcHandler.Callback)
 
-	// Swagger
-	r.engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
+	// Passkey login, made before the user is authenticated
+	r.engine.POST("/api/v1/auth/passkeys/login/options", ipRateLimitMiddleware(r.limiter), r.passkeysHandler.BeginLogin)
+	r.engine.POST("/api/v1/auth/passkeys/login", ipRateLimitMiddleware(r.limiter), r.passkeysHandler.Login)
 
-	// Health check
-	r.engine.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{"status": "ok"})
-	})
+	r.setupV2Routes(authMiddleware)
+
+	// Share links, downloaded by whoever holds one without logging in
+	r.engine.GET("/share/:token", ipRateLimitMiddleware(r.limiter), r.filesHandler.DownloadShare)
+
+	// WebSocket routes, authenticated like the API. Browsers authenticate
+	// them with a ticket from POST /api/v1/auth/ticket.
+	streams := r.engine.Group("")
+	streams.Use(ipRateLimitMiddleware(r.limiter))
+	streams.Use(authMiddleware)
+	streams.Use(roleMiddleware())
+	streams.GET("/ws", r.handleWebSocket)
+	streams.GET("/ws/metrics", r.handleMetricsWebSocket)
+	streams.GET("/ws/terminal", r.terminalHandler.HandleWebSocket)
+	streams.GET("/ws/files", r.filesHandler.Watch)
+	streams.GET("/ws/files/tail", r.filesHandler.Follow)
+
+	// Server-Sent Events fallbacks of the WebSocket streams
+	streams.GET("/events", r.handleEvents)
+	streams.GET("/events/metrics", r.handleMetricsEvents)
+
+	// OpenAPI document, generated from the registered routes, and the Swagger UI showing it
+	r.engine.GET("/openapi.json", r.handleOpenAPI)
+	r.engine.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL(r.basePath+"/openapi.json")))
+
+	// Health checks, /health is kept for existing monitors
+	r.engine.GET("/health", r.handleHealth)
+	r.engine.GET("/healthz", r.handleLiveness)
+	r.engine.GET("/readyz", r.handleReadiness)
 }
 
-// handleMetricsWebSocket handles metrics WebSocket connections
+// setupV2Routes configures the /api/v2 routes. v2 addresses resources by
+// path, answers changes with the changed resource and the matching status
+// code, and runs long operations as jobs. Reads identical in both versions
+// share the v1 handlers.
+func (r *Router) setupV2Routes(authMiddleware gin.HandlerFunc) {
+	v2 := r.engine.Group("/api/v2")
+	v2.Use(ipRateLimitMiddleware(r.limiter))
+	v2.Use(authMiddleware)
+	v2.Use(roleMiddleware())
+	v2.Use(elevationMiddleware(r.privilegeManager))
+	v2.Use(rateLimitMiddleware(r.limiter))
+	if r.store != nil {
+		v2.Use(auditMiddleware(r.store, r.bus))
+	}
+
+	// Metrics routes
+	metricsGroup := v2.Group("/metrics")
+	{
+		metricsGroup.GET("", r.metricsHandler.GetAll)
+		metricsGroup.GET("/cpu", r.metricsHandler.GetCPU)
+		metricsGroup.GET("/memory", r.metricsHandler.GetMemory)
+		metricsGroup.GET("/disk", r.metricsHandler.GetDisk)
+		metricsGroup.GET("/network", r.metricsHandler.GetNetwork)
+		metricsGroup.GET("/history", listMiddleware(), r.metricsHandler.GetHistory)
+	}
+
+	// Process routes
+	processGroup := v2.Group("/processes")
+	{
+		processGroup.GET("", listMiddleware(), r.processHandler.List)
+		processGroup.GET("/:pid", r.processHandler.Get)
+		processGroup.DELETE("/:pid", r.processHandler.Terminate)
+		processGroup.GET("/:pid/tree", r.processHandler.Tree)
+	}
+
+	// Service routes
+	serviceGroup := v2.Group("/services")
+	{
+		serviceGroup.GET("", listMiddleware(), r.serviceHandler.List)
+		serviceGroup.GET("/:name", r.serviceHandler.Get)
+		serviceGroup.PUT("/:name/state", r.serviceHandler.PutState)
+		serviceGroup.PUT("/:name/enabled", r.serviceHandler.PutEnabled)
+		serviceGroup.POST("/:name/restart", r.serviceHandler.RestartService)
+		serviceGroup.GET("/:name/logs", r.serviceHandler.Logs)
+	}
+
+	// Files routes
+	filesGroup := v2.Group("/files")
+	{
+		filesGroup.GET("/list/*path", listMiddleware(), r.filesHandler.ListPath)
+		filesGroup.GET("/info/*path", r.filesHandler.InfoPath)
+		filesGroup.GET("/content/*path", r.filesHandler.ReadPath)
+		filesGroup.GET("/download/*path", r.filesHandler.DownloadPath)
+		filesGroup.GET("/search/*path", r.filesHandler.SearchPath)
+		filesGroup.GET("/links/*path", r.filesHandler.LinkPath)
+		filesGroup.GET("/tail/*path", r.filesHandler.TailPath)
+		filesGroup.PUT("/content", r.filesHandler.PutContent)
+		filesGroup.PATCH("/content", r.filesHandler.PatchContent)
+		filesGroup.PUT("/directories", r.filesHandler.PutDirectory)
+		filesGroup.POST("/move", r.filesHandler.Move)
+		filesGroup.POST("/copy", r.filesHandler.Copy)
+		filesGroup.POST("/links", r.filesHandler.CreateLink)
+		filesGroup.POST("/upload", r.filesHandler.UploadFile)
+		filesGroup.POST("/uploads", r.filesHandler.CreateUpload)
+		filesGroup.GET("/uploads/:id", r.filesHandler.GetUpload)
+		filesGroup.PATCH("/uploads/:id", r.filesHandler.WriteChunk)
+		filesGroup.DELETE("/uploads/:id", r.filesHandler.CancelUpload)
+		filesGroup.PUT("/permissions", r.filesHandler.PutPermissions)
+		filesGroup.POST("/compress", r.filesHandler.Compress)
+		filesGroup.GET("/shares", listMiddleware(), r.filesHandler.ListShares)
+		filesGroup.GET("/roots", listMiddleware(), r.filesHandler.Roots)
+		filesGroup.GET("/remotes", listMiddleware(), r.filesHandler.Remotes)
+		filesGroup.POST("/shares", r.filesHandler.CreateShare)
+		filesGroup.DELETE("/shares/:id", r.filesHandler.DeleteShare)
+		filesGroup.DELETE("", r.filesHandler.Remove)
+	}
+
+	// Packages routes
+	packagesGroup := v2.Group("/packages")
+	{
+		packagesGroup.GET("", listMiddleware(), r.packagesHandler.List)
+		packagesGroup.GET("/type", r.packagesHandler.GetType)
+		packagesGroup.POST("/upgrade", r.packagesHandler.UpgradePackages)
+		packagesGroup.GET("/:name", r.packagesHandler.GetPackage)
+		packagesGroup.PUT("/:name", r.packagesHandler.PutPackage)
+		packagesGroup.DELETE("/:name", r.packagesHandler.DeletePackage)
+		packagesGroup.POST("/:name/upgrade", r.packagesHandler.UpgradePackage)
+	}
+
+	// Job routes
+	v2.GET("/jobs", listMiddleware(), r.jobsHandler.List)
+	v2.GET("/jobs/:id", r.jobsHandler.Get)
+}
+
+// healthResponse reports whether the server is usable
+type healthResponse struct {
+	Status  string               `json:"status"`
+	Storage storage.HealthStatus `json:"storage"`
+}
+
+// handleHealth reports whether the server and its database are usable
+func (r *Router) handleHealth(c *gin.Context) {
+	if r.store == nil {
+		c.JSON(http.StatusServiceUnavailable, healthResponse{
+			Status:  "degraded",
+			Storage: storage.HealthStatus{Error: "storage not available"},
+		})
+		return
+	}
+
+	health := r.store.Health()
+	if !health.Healthy && !health.LastCheck.IsZero() {
+		c.JSON(http.StatusServiceUnavailable, healthResponse{Status: "degraded", Storage: health})
+		return
+	}
+
+	c.JSON(http.StatusOK, healthResponse{Status: "ok", Storage: health})
+}
+
+// handleWebSocket handles event stream connections, subscribed to the
+// comma separated topics of the topics query parameter
+func (r *Router) handleWebSocket(c *gin.Context) {
+	opts, ok := connectOptions(c, wsResume)
+	if !ok {
+		return
+	}
+	r.hub.HandleWebSocket(c.Writer, c.Request, opts)
+}
+
+// handleMetricsWebSocket handles metrics WebSocket connections, kept for
+// clients that predate topic subscriptions
 func (r *Router) handleMetricsWebSocket(c *gin.Context) {
-	clientID := c.Query("client")
-	if clientID == "" {
-		clientID = "anonymous"
+	opts, ok := connectOptions(c, wsResume)
+	if !ok {
+		return
 	}
-	r.hub.HandleWebSocket(c.Writer, c.Request, clientID)
+	opts.Topics = []string{websocket.TopicMetrics, websocket.TopicUpdate}
+	r.hub.HandleWebSocket(c.Writer, c.Request, opts)
+}
+
+// handleEvents streams the comma separated topics of the topics query
+// parameter as Server-Sent Events
+func (r *Router) handleEvents(c *gin.Context) {
+	opts, ok := connectOptions(c, sseResume)
+	if !ok {
+		return
+	}
+	r.hub.HandleSSE(c.Writer, c.Request, opts)
+}
+
+// handleMetricsEvents streams metrics and update progress as Server-Sent Events
+func (r *Router) handleMetricsEvents(c *gin.Context) {
+	opts, ok := connectOptions(c, sseResume)
+	if !ok {
+		return
+	}
+	opts.Topics = []string{websocket.TopicMetrics, websocket.TopicUpdate}
+	r.hub.HandleSSE(c.Writer, c.Request, opts)
+}
+
+// connectOptions describes a client connecting to the hub from the query
+// parameters, client, topics and resume
+func connectOptions(c *gin.Context, resumeFrom func(*gin.Context) (uint64, bool)) (websocket.ConnectOptions, bool) {
+	resume, ok := resumeFrom(c)
+	if !ok {
+		return websocket.ConnectOptions{}, false
+	}
+
+	opts := websocket.ConnectOptions{
+		Name:     c.Query("client"),
+		RemoteIP: c.ClientIP(),
+		User:     requestUser(c),
+		Resume:   resume,
+	}
+	if opts.Name == "" {
+		opts.Name = "anonymous"
+	}
+	if v := c.Query("topics"); v != "" {
+		opts.Topics = strings.Split(v, ",")
+	}
+	return opts, true
+}
+
+// wsResume returns the sequence number a reconnecting client resumes from,
+// 0 for new connections
+func wsResume(c *gin.Context) (uint64, bool) {
+	v := c.Query("resume")
+	if v == "" {
+		return 0, true
+	}
+	resume, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid resume"})
+		return 0, false
+	}
+	return resume, true
+}
+
+// sseResume returns the sequence number an EventSource resumes from, sent
+// automatically as Last-Event-ID when it reconnects
+func sseResume(c *gin.Context) (uint64, bool) {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		return wsResume(c)
+	}
+	resume, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "invalid Last-Event-ID"})
+		return 0, false
+	}
+	return resume, true
 }
 
 // authMiddleware returns the authentication middleware
 func (r *Router) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		cfg := r.config.Get()
-		if !cfg.Auth.Enabled {
+		if !cfg.Auth.Enabled || c.GetBool(contextClusterKey) {
 			c.Next()
 			return
 		}
 
+		// Clients that logged in present their session instead of the credentials
+		if token, err := c.Cookie(sessionCookie); err == nil && r.store != nil {
+			session, err := r.store.GetSession(sessionID(token))
+			if err == nil && session != nil && validSession(session, cfg) {
+				c.Set(contextUserKey, session.Username)
+				c.Set(contextProviderKey, session.Provider)
+				if session.Role != "" {
+					c.Set(contextRoleKey, session.Role)
+				}
+				c.Next()
+				return
+			}
+		}
+
+		// Streams opened by browsers present a ticket instead of the credentials
+		if id := c.Query("ticket"); id != "" && c.Request.Method == http.MethodGet {
+			if ticket, ok := r.tickets.take(id); ok {
+				c.Set(contextUserKey, ticket.user)
+				c.Set(contextProviderKey, ticket.provider)
+				if ticket.role != "" {
+					c.Set(contextRoleKey, ticket.role)
+				}
+				c.Next()
+				return
+			}
+		}
+
 		username, password, ok := c.Request.BasicAuth()
-		if !ok || username != cfg.Auth.Username || password != cfg.Auth.Password {
+		if ok {
+			// Locked out clients aren't told whether their credentials are right
+			if wait, locked := r.guard.Locked(c.ClientIP(), username); locked {
+				rejectLockedOut(c, wait)
+				return
+			}
+		}
+		if !ok || !r.checkCredentials(c, cfg, username, password) {
+			// Requests without credentials are browsers asking for them, not failed logins
+			if ok {
+				r.bus.Publish(events.TopicSecurity, "auth.failed", gin.H{"user": username, "ip": c.ClientIP(), "path": c.Request.URL.Path})
+				if wait := r.guard.Fail(c.ClientIP(), username); wait > 0 {
+					r.bus.Publish(events.TopicSecurity, "auth.locked", gin.H{"user": username, "ip": c.ClientIP(), "seconds": int(wait.Seconds())})
+				}
+			}
 			c.Header("WWW-Authenticate", `Basic realm="Nebula"`)
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "unauthorized"})
 			return
 		}
 
+		r.guard.Succeed(c.ClientIP(), username)
+		c.Set(contextUserKey, username)
 		c.Next()
 	}
 }
 
+// checkCredentials checks basic auth credentials against the system accounts
+// with auth.pam, or else the configured username and password, plaintext or
+// hashed
+func (r *Router) checkCredentials(c *gin.Context, cfg *config.Config, username, password string) bool {
+	if !cfg.Auth.PAM.Enabled {
+		userOK := subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Auth.Username)) == 1
+		// The password is checked even for unknown users so timing doesn't tell them apart
+		return r.passwords.Verify(cfg.Auth.Password, password) && userOK
+	}
+	// Accounts without a password may be accepted by PAM, never by Nebula
+	if username == "" || password == "" {
+		return false
+	}
+	if err := r.pam.Authenticate(cfg.Auth.PAM.Service, cfg.Auth.PAM.Group, username, password); err != nil {
+		slog.WarnContext(c.Request.Context(), "PAM authentication failed", "user", username, "error", err)
+		return false
+	}
+	c.Set(contextProviderKey, providerPAM)
+	return true
+}
+
+// contextUserKey is the gin context key holding the authenticated username
+const contextUserKey = "user"
+
+// contextProviderKey is the gin context key holding how the user logged in,
+// the Provider of their sessions
+const contextProviderKey = "provider"
+
+// providerPAM marks the sessions of system users authenticated through PAM
+const providerPAM = "pam"
+
+// contextRoleKey is the gin context key holding the role of users logged in
+// with an external provider, unset for full access
+const contextRoleKey = "role"
+
+// Roles users of an external provider are mapped to
+const (
+	roleAdmin  = "admin"
+	roleViewer = "viewer"
+)
+
+// isAdmin reports whether the user of a request has full access: an
+// administrator of an external provider, or the configured user. System
+// users logged in through PAM aren't administrators of each other.
+func isAdmin(c *gin.Context) bool {
+	switch c.GetString(contextRoleKey) {
+	case roleAdmin:
+		return true
+	case "":
+		return c.GetString(contextProviderKey) != providerPAM
+	}
+	return false
+}
+
+// validSession reports whether a session still matches the configured
+// login methods, so changing the username or disabling a provider ends the
+// sessions it created
+func validSession(session *storage.Session, cfg *config.Config) bool {
+	switch session.Provider {
+	case "":
+		return !cfg.Auth.PAM.Enabled && session.Username == cfg.Auth.Username
+	case providerPAM:
+		return cfg.Auth.PAM.Enabled
+	case providerOIDC:
+		return cfg.Auth.OIDC.Enabled
+	case providerPasskey:
+		return cfg.Auth.WebAuthn.Enabled
+	}
+	return false
+}
+
+// roleMiddleware limits viewers to reading
+func roleMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString(contextRoleKey) == roleViewer && !readOnly(c.Request) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "read-only access"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// adminMiddleware lets only administrators through, for routes reading or
+// replacing the data of every user
+func adminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isAdmin(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, ErrorResponse{Error: "administrator access required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// readOnly reports whether a request only reads. Terminals are opened with
+// a GET but run commands, also when proxied to an agent.
+func readOnly(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return !strings.HasSuffix(req.URL.Path, "/ws/terminal")
+	}
+	return false
+}
+
+// Headers of sudo mode, carrying the sudo password of a request or an
+// elevation token from POST /api/v1/auth/elevate
+const (
+	sudoPasswordHeader = "X-Sudo-Password"
+	sudoTokenHeader    = "X-Sudo-Token"
+)
+
+// contextElevationKey is the gin context key holding the elevation token
+// of the request
+const contextElevationKey = "elevation"
+
+// elevationMiddleware adds the sudo password of a request, sent directly or
+// as an elevation token, to its context for the privileged commands it
+// runs. The headers are removed so they never reach proxied agents.
+func elevationMiddleware(pm *auth.PrivilegeManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		password := c.GetHeader(sudoPasswordHeader)
+		token := c.GetHeader(sudoTokenHeader)
+		c.Request.Header.Del(sudoPasswordHeader)
+		c.Request.Header.Del(sudoTokenHeader)
+
+		if token != "" {
+			p, ok := pm.ElevationPassword(token, requestUser(c))
+			if !ok {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "elevation expired, elevate again"})
+				return
+			}
+			password = p
+			c.Set(contextElevationKey, token)
+		}
+		if password != "" {
+			c.Request = c.Request.WithContext(auth.WithPassword(c.Request.Context(), password))
+		}
+		c.Next()
+	}
+}
+
+// contextClusterKey is the gin context key set on requests proxied by the controller
+const contextClusterKey = "cluster"
+
+// clusterMiddleware authenticates the requests a controller proxies to this
+// agent, made for the controller user in the user header
+func clusterMiddleware(cfg *config.Manager, bus *events.Bus) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(cluster.TokenHeader)
+		clusterCfg := cfg.Get().Cluster
+		if token == "" || clusterCfg.Mode != cluster.ModeAgent {
+			c.Next()
+			return
+		}
+
+		if !cluster.ValidToken(token, clusterCfg.Token) {
+			bus.Publish(events.TopicSecurity, "cluster.rejected", gin.H{"ip": c.ClientIP(), "path": c.Request.URL.Path})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid cluster token"})
+			return
+		}
+
+		c.Set(contextClusterKey, true)
+		if user := c.GetHeader(cluster.UserHeader); user != "" {
+			c.Set(contextUserKey, user)
+		}
+		c.Next()
+	}
+}
+
+// requestUser returns the user a request is made on behalf of
+func requestUser(c *gin.Context) string {
+	if user := c.GetString(contextUserKey); user != "" {
+		return user
+	}
+	if user, _, ok := c.Request.BasicAuth(); ok && user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// rateLimitMiddleware rejects the requests of clients over their rate limit
+// with 429 Too Many Requests. Clients are the authenticated user, so it
+// runs after authMiddleware, the cluster token of requests made without a
+// user, or the IP address of anonymous requests.
+func rateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		client := "ip:" + c.ClientIP()
+		if user := c.GetString(contextUserKey); user != "" {
+			client = "user:" + user
+		} else if c.GetBool(contextClusterKey) {
+			// Keyed by a digest so the token isn't kept in memory twice
+			sum := sha256.Sum256([]byte(c.GetHeader(cluster.TokenHeader)))
+			client = "token:" + hex.EncodeToString(sum[:8])
+		}
+
+		ok, wait := limiter.Allow(client, c.Request.Method, c.Request.URL.Path)
+		if !ok {
+			rejectRateLimited(c, wait)
+			return
+		}
+		c.Next()
+	}
+}
+
+// ipRateLimitMiddleware rejects the requests of IP addresses over the
+// per-IP limit. It runs before authMiddleware, so guessing credentials is
+// limited as well.
+func ipRateLimitMiddleware(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if ok, wait := limiter.AllowIP(c.ClientIP()); !ok {
+			rejectRateLimited(c, wait)
+			return
+		}
+		c.Next()
+	}
+}
+
+// rejectRateLimited answers 429 Too Many Requests, telling the client when
+// to retry
+func rejectRateLimited(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: "rate limit exceeded"})
+}
+
+// rejectLockedOut answers 429 Too Many Requests to a client locked out
+// after failed logins, telling it when to retry
+func rejectLockedOut(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, ErrorResponse{Error: "too many failed logins"})
+}
+
 // corsMiddleware returns CORS middleware
 func corsMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization, "+sudoPasswordHeader+", "+sudoTokenHeader+", "+uploadOffsetHeader+", "+logging.RequestIDHeader)
+		c.Header("Access-Control-Expose-Headers", uploadOffsetHeader+", "+logging.RequestIDHeader)
 		c.Header("Access-Control-Max-Age", "86400")
 
 		if c.Request.Method == "OPTIONS" {
@@ -241,9 +988,70 @@ func corsMiddleware() gin.HandlerFunc {
 	}
 }
 
-// loggerMiddleware returns logging middleware
+// loggerMiddleware tags every request with an ID, the caller's X-Request-ID
+// when it sends a usable one, and logs the request once handled. Handlers
+// logging with the request context include the ID, and the cluster proxy
+// forwards it so agents log the same one.
 func loggerMiddleware() gin.HandlerFunc {
-	return gin.Logger()
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(logging.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newID()
+			c.Request.Header.Set(logging.RequestIDHeader, id)
+		}
+		c.Header(logging.RequestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		switch {
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= http.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.Int("size", max(c.Writer.Size(), 0)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.String("user", requestUser(c)),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// validRequestID reports whether a request ID sent by a client is short
+// and printable enough to be logged and echoed
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// recoveryMiddleware turns panics in handlers into 500 responses, logging
+// them with the request ID
+func recoveryMiddleware() gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, err interface{}) {
+		slog.ErrorContext(c.Request.Context(), "Panic while handling request",
+			"error", fmt.Sprint(err), "path", c.Request.URL.Path, "stack", string(debug.Stack()))
+		c.AbortWithStatusJSON(http.StatusInternalServerError, ErrorResponse{Error: "internal server error"})
+	})
 }
 
 // Engine returns the Gin engine
@@ -251,17 +1059,76 @@ func (r *Router) Engine() *gin.Engine {
 	return r.engine
 }
 
+// Handler returns the HTTP handler of the server. With server.base_path
+// set, the prefix is removed before routing, and requests without it are
+// served as well for proxies that remove it themselves.
+func (r *Router) Handler() http.Handler {
+	if r.basePath == "" {
+		return r.engine
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch {
+		case req.URL.Path == r.basePath:
+			http.Redirect(w, req, r.basePath+"/", http.StatusMovedPermanently)
+		case strings.HasPrefix(req.URL.Path, r.basePath+"/"):
+			r.engine.ServeHTTP(w, stripBasePath(req, r.basePath))
+		default:
+			r.engine.ServeHTTP(w, req)
+		}
+	})
+}
+
+// stripBasePath returns a copy of req addressed without the base path.
+// RequestURI is rewritten too since the Swagger UI routes on it, and
+// X-Forwarded-Prefix tells gin the prefix of its redirects.
+func stripBasePath(req *http.Request, basePath string) *http.Request {
+	out := new(http.Request)
+	*out = *req
+	out.URL = new(url.URL)
+	*out.URL = *req.URL
+	out.URL.Path = strings.TrimPrefix(req.URL.Path, basePath)
+	out.URL.RawPath = strings.TrimPrefix(req.URL.RawPath, basePath)
+	out.RequestURI = out.URL.RequestURI()
+	out.Header = req.Header.Clone()
+	out.Header.Set("X-Forwarded-Prefix", basePath)
+	return out
+}
+
+// basePathKey is the context key of server.base_path
+const basePathKey = "basePath"
+
+// basePathMiddleware makes the base path available to handlers building
+// URLs for the client, see basePath
+func basePathMiddleware(prefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(basePathKey, prefix)
+		c.Next()
+	}
+}
+
+// basePath returns the prefix of the URLs the client reaches the server at
+func basePath(c *gin.Context) string {
+	return c.GetString(basePathKey)
+}
+
 // Hub returns the WebSocket hub
 func (r *Router) Hub() *websocket.Hub {
 	return r.hub
 }
 
-// StartWebSocketHub starts the WebSocket hub
-func (r *Router) StartWebSocketHub() {
-	go r.hub.Run()
-}
+// StartWebSocketHub starts the WebSocket hub, running until ctx is cancelled,
+// and forwards the events of the bus to the clients subscribed to their topic
+func (r *Router) StartWebSocketHub(ctx context.Context) {
+	go r.hub.Run(ctx)
 
-// BroadcastMetrics broadcasts metrics to all connected clients
-func (r *Router) BroadcastMetrics(metrics interface{}) {
-	r.hub.BroadcastJSON("metrics", metrics)
+	sub := r.bus.Subscribe(1024)
+	go func() {
+		for event := range sub.Events() {
+			if event.User != "" {
+				r.hub.SendToUser(event.User, event.Topic, event.Type, event.Data)
+				continue
+			}
+			r.hub.BroadcastEvent(event.Topic, event.Type, event.Data)
+		}
+	}()
 }
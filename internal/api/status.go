@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nebula/nebula/internal/httpmetrics"
+)
+
+// routeSummary sums up the requests of a route
+type routeSummary struct {
+	Method   string `json:"method"`
+	Route    string `json:"route"`
+	Requests uint64 `json:"requests"`
+	// Errors counts the 5xx responses
+	Errors   uint64  `json:"errors"`
+	InFlight int64   `json:"in_flight"`
+	AvgMs    float64 `json:"avg_ms"`
+	// P95Ms is the upper bound of the histogram bucket holding the 95th
+	// percentile
+	P95Ms float64 `json:"p95_ms"`
+}
+
+// statusResponse sums up the requests served by the panel
+type statusResponse struct {
+	StartedAt     time.Time      `json:"started_at"`
+	UptimeSeconds int64          `json:"uptime_seconds"`
+	Requests      uint64         `json:"requests"`
+	Errors        uint64         `json:"errors"`
+	InFlight      int64          `json:"in_flight"`
+	Routes        []routeSummary `json:"routes"`
+}
+
+// requestMetricsMiddleware records the count, latency and concurrency of
+// the requests per route
+func requestMetricsMiddleware(recorder *httpmetrics.Recorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done := recorder.Start(c.Request.Method, c.FullPath())
+		c.Next()
+		done(c.Writer.Status())
+	}
+}
+
+// handleStatus sums up the requests served per route
+func (r *Router) handleStatus(c *gin.Context) {
+	resp := statusResponse{
+		StartedAt:     startedAt,
+		UptimeSeconds: int64(time.Since(startedAt).Seconds()),
+		Routes:        []routeSummary{},
+	}
+	for _, route := range r.httpMetrics.Routes() {
+		summary := routeSummary{
+			Method:   route.Method,
+			Route:    route.Route,
+			Requests: route.Count,
+			InFlight: route.InFlight,
+			P95Ms:    route.Quantile(0.95) * 1000,
+		}
+		if route.Count > 0 {
+			summary.AvgMs = route.Sum / float64(route.Count) * 1000
+		}
+		for status, n := range route.Statuses {
+			if strings.HasPrefix(status, "5") {
+				summary.Errors += n
+			}
+		}
+		resp.Requests += summary.Requests
+		resp.Errors += summary.Errors
+		resp.InFlight += summary.InFlight
+		resp.Routes = append(resp.Routes, summary)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// handlePrometheus exposes the counters of the panel in the Prometheus text
+// format: HTTP requests, WebSocket hub and event bus
+func (r *Router) handlePrometheus(c *gin.Context) {
+	var b strings.Builder
+	writeHTTPPrometheus(&b, r.httpMetrics.Routes())
+	writePrometheus(&b, r.hub.Stats(), r.bus.Stats())
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(b.String()))
+}
+
+// writeHTTPPrometheus writes the request counters of the routes in the
+// Prometheus text format
+func writeHTTPPrometheus(b *strings.Builder, routes []httpmetrics.RouteStats) {
+	metric := func(name, kind, help string) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	metric("nebula_http_requests_total", "counter", "HTTP requests per route and status.")
+	for _, route := range routes {
+		for _, status := range sortedKeys(route.Statuses) {
+			fmt.Fprintf(b, "nebula_http_requests_total{method=%q,route=%q,status=%q} %d\n", route.Method, route.Route, status, route.Statuses[status])
+		}
+	}
+
+	metric("nebula_http_requests_in_flight", "gauge", "HTTP requests being served per route.")
+	for _, route := range routes {
+		fmt.Fprintf(b, "nebula_http_requests_in_flight{method=%q,route=%q} %d\n", route.Method, route.Route, route.InFlight)
+	}
+
+	metric("nebula_http_request_duration_seconds", "histogram", "Latency of the HTTP requests per route.")
+	for _, route := range routes {
+		labels := fmt.Sprintf("method=%q,route=%q", route.Method, route.Route)
+		for i, bound := range httpmetrics.Buckets {
+			fmt.Fprintf(b, "nebula_http_request_duration_seconds_bucket{%s,le=%q} %d\n", labels, strconv.FormatFloat(bound, 'f', -1, 64), route.Buckets[i])
+		}
+		fmt.Fprintf(b, "nebula_http_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, route.Count)
+		fmt.Fprintf(b, "nebula_http_request_duration_seconds_sum{%s} %g\n", labels, route.Sum)
+		fmt.Fprintf(b, "nebula_http_request_duration_seconds_count{%s} %d\n", labels, route.Count)
+	}
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamTicketTTL is how long a stream ticket may wait to be used
+const streamTicketTTL = 30 * time.Second
+
+// streamTicket authenticates a single WebSocket or event stream for the
+// user that asked for it. Browsers open streams without the Authorization
+// header of the page, so they present a ticket in the query instead.
+type streamTicket struct {
+	user     string
+	provider string
+	role     string
+	expires  time.Time
+}
+
+// streamTicketResponse is the body of POST /api/v1/auth/ticket
+type streamTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// ticketStore holds the stream tickets not used yet
+type ticketStore struct {
+	mu      sync.Mutex
+	tickets map[string]streamTicket
+}
+
+// newTicketStore creates an empty ticket store
+func newTicketStore() *ticketStore {
+	return &ticketStore{tickets: make(map[string]streamTicket)}
+}
+
+// issue stores a ticket and returns its ID, dropping expired tickets
+func (s *ticketStore) issue(t streamTicket) string {
+	id := newSessionToken()
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, old := range s.tickets {
+		if now.After(old.expires) {
+			delete(s.tickets, k)
+		}
+	}
+	s.tickets[id] = t
+	return id
+}
+
+// take removes the ticket id and returns it, false when it doesn't exist
+// or expired
+func (s *ticketStore) take(id string) (streamTicket, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tickets[id]
+	delete(s.tickets, id)
+	return t, ok && time.Now().Before(t.expires)
+}
+
+// handleStreamTicket handles POST /api/v1/auth/ticket
+func (r *Router) handleStreamTicket(c *gin.Context) {
+	t := streamTicket{
+		user:     c.GetString(contextUserKey),
+		provider: c.GetString(contextProviderKey),
+		role:     c.GetString(contextRoleKey),
+		expires:  time.Now().Add(streamTicketTTL),
+	}
+	c.JSON(http.StatusCreated, streamTicketResponse{Ticket: r.tickets.issue(t), ExpiresAt: t.expires})
+}
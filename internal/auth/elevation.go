@@ -0,0 +1,133 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+)
+
+// ErrSudoMode is returned when storing credentials in sudo mode
+var ErrSudoMode = errors.New("credentials are not stored in sudo mode")
+
+// ErrInvalidPassword is returned when elevating with a wrong password
+var ErrInvalidPassword = errors.New("invalid credentials")
+
+// DefaultElevationTTL is how long elevation tokens last unless configured
+const DefaultElevationTTL = 5 * time.Minute
+
+// elevation is an elevation token, standing in for the sudo password of a
+// user. Elevations are only kept in memory.
+type elevation struct {
+	user     string
+	password string
+	expires  time.Time
+}
+
+// passwordKey is the context key of the password of a request
+type passwordKey struct{}
+
+// WithPassword returns a context carrying the sudo password of a request,
+// used by RunWithPrivilegesContext instead of the stored one
+func WithPassword(ctx context.Context, password string) context.Context {
+	return context.WithValue(ctx, passwordKey{}, password)
+}
+
+// passwordFrom returns the password WithPassword added to ctx
+func passwordFrom(ctx context.Context) string {
+	password, _ := ctx.Value(passwordKey{}).(string)
+	return password
+}
+
+// SetSudoMode selects sudo mode, where the password is never stored and
+// privileged requests carry it or an elevation token instead. Enabling it
+// wipes the stored password.
+func (pm *PrivilegeManager) SetSudoMode(enabled bool) {
+	pm.mu.Lock()
+	pm.sudoMode = enabled
+	wipe := enabled && pm.password != ""
+	pm.mu.Unlock()
+
+	if wipe {
+		if err := pm.ClearCredentials(); err != nil {
+			log.Printf("Failed to clear stored credentials: %v", err)
+		}
+		log.Println("Stored credentials cleared, sudo mode never stores the password")
+	}
+}
+
+// SudoMode reports whether the password is only accepted per request
+func (pm *PrivilegeManager) SudoMode() bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.sudoMode
+}
+
+// SetElevationTTL sets how long new elevation tokens last
+func (pm *PrivilegeManager) SetElevationTTL(ttl time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.elevationTTL = ttl
+}
+
+// Elevate checks the sudo password and returns a token standing in for it
+// for user, and when the token expires
+func (pm *PrivilegeManager) Elevate(user, password string) (string, time.Time, error) {
+	if pm.Escalation() == EscalationPkexec {
+		return "", time.Time{}, ErrCredentialsNotUsed
+	}
+	if !pm.ValidateCredentials(password) {
+		return "", time.Time{}, ErrInvalidPassword
+	}
+
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := hex.EncodeToString(b)
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	now := time.Now()
+	for t, e := range pm.elevations {
+		if now.After(e.expires) {
+			delete(pm.elevations, t)
+		}
+	}
+	ttl := pm.elevationTTL
+	if ttl <= 0 {
+		ttl = DefaultElevationTTL
+	}
+	if pm.elevations == nil {
+		pm.elevations = make(map[string]elevation)
+	}
+	e := elevation{user: user, password: password, expires: now.Add(ttl)}
+	pm.elevations[token] = e
+	return token, e.expires, nil
+}
+
+// ElevationPassword returns the password token stands in for, when it
+// belongs to user and hasn't expired
+func (pm *PrivilegeManager) ElevationPassword(token, user string) (string, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	e, ok := pm.elevations[token]
+	if !ok || e.user != user || time.Now().After(e.expires) {
+		return "", false
+	}
+	return e.password, true
+}
+
+// RevokeElevation forgets an elevation token of user before it expires
+func (pm *PrivilegeManager) RevokeElevation(token, user string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	e, ok := pm.elevations[token]
+	if !ok || e.user != user {
+		return false
+	}
+	delete(pm.elevations, token)
+	return true
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// secretSize is the length of the per-install secrets
+const secretSize = 32
+
+// legacyKey is the key compiled into older releases, only used to read
+// credentials they stored and encrypt them again with the install secret
+const legacyKey = "nebula_secret_key_32bytes_long!"
+
+// keyRing holds the install secrets the stored credentials are encrypted
+// with, newest first. They are kept hex encoded, one per line, in a file
+// only the owner can read. Older secrets stay in the file only while a
+// rotation encrypts the credentials again.
+type keyRing struct {
+	path    string
+	secrets [][]byte
+}
+
+// loadKeyRing reads the secrets of path, generating the file on first run
+func loadKeyRing(path string) (*keyRing, error) {
+	k := &keyRing{path: path}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := k.rotate(); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated credential encryption key %s", path)
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+
+	for _, line := range strings.Fields(string(data)) {
+		secret, err := hex.DecodeString(line)
+		if err != nil || len(secret) != secretSize {
+			return nil, fmt.Errorf("invalid key file %s", path)
+		}
+		k.secrets = append(k.secrets, secret)
+	}
+	if len(k.secrets) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+
+	// Windows doesn't map file modes to permissions
+	if info, err := os.Stat(path); err == nil && runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		log.Printf("Warning: key file %s was readable by other users, restricting it to the owner", path)
+		if err := os.Chmod(path, 0600); err != nil {
+			return nil, fmt.Errorf("failed to restrict key file: %w", err)
+		}
+	}
+	return k, nil
+}
+
+// current returns the encryption key of the newest secret
+func (k *keyRing) current() []byte {
+	return deriveKey(k.secrets[0])
+}
+
+// keys returns the encryption keys of every secret, newest first
+func (k *keyRing) keys() [][]byte {
+	keys := make([][]byte, len(k.secrets))
+	for i, secret := range k.secrets {
+		keys[i] = deriveKey(secret)
+	}
+	return keys
+}
+
+// rotate generates a new secret and saves it ahead of the others, which
+// still decrypt the credentials until prune drops them
+func (k *keyRing) rotate() ([]byte, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	k.secrets = append([][]byte{secret}, k.secrets...)
+	if err := k.save(); err != nil {
+		k.secrets = k.secrets[1:]
+		return nil, err
+	}
+	return k.current(), nil
+}
+
+// prune drops every secret but the newest
+func (k *keyRing) prune() error {
+	if len(k.secrets) == 1 {
+		return nil
+	}
+	k.secrets = k.secrets[:1]
+	return k.save()
+}
+
+// save writes the secrets to a temporary file renamed over the key file,
+// so a crash never leaves it half written
+func (k *keyRing) save() error {
+	var b strings.Builder
+	for _, secret := range k.secrets {
+		b.WriteString(hex.EncodeToString(secret) + "\n")
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(k.path), ".nebula-key-*")
+	if err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	// CreateTemp creates the file readable by the owner only
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(b.String()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), k.path); err != nil {
+		return fmt.Errorf("failed to write key file: %w", err)
+	}
+	return nil
+}
+
+// deriveKey derives the AES key of the credentials from an install secret,
+// so the secret itself never keys the cipher
+func deriveKey(secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("nebula sudo credentials"))
+	return mac.Sum(nil)
+}
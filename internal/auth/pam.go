@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os/user"
+	"sync"
+	"time"
+)
+
+// pamCacheTTL is how long a successful PAM login is remembered, so basic
+// auth clients sending the password with every request don't run the PAM
+// stack, and its failure delay, each time
+const pamCacheTTL = 5 * time.Minute
+
+// ErrPAMUnavailable is returned when PAM can't be used on this system
+var ErrPAMUnavailable = errors.New("PAM authentication is only available on Linux builds with cgo and libpam")
+
+// PAMAuthenticator authenticates system users through PAM
+type PAMAuthenticator struct {
+	mu sync.Mutex
+	// cache holds the expiry of recent successful logins, keyed by a digest
+	// of the service, group, username and password
+	cache map[[sha256.Size]byte]time.Time
+}
+
+// NewPAMAuthenticator creates a PAM authenticator
+func NewPAMAuthenticator() *PAMAuthenticator {
+	return &PAMAuthenticator{cache: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// Authenticate checks the password of a system user with the PAM service,
+// and that the account is a member of group when it isn't empty
+func (a *PAMAuthenticator) Authenticate(service, group, username, password string) error {
+	key := sha256.Sum256([]byte(service + "\x00" + group + "\x00" + username + "\x00" + password))
+	now := time.Now()
+
+	a.mu.Lock()
+	expiry, ok := a.cache[key]
+	a.mu.Unlock()
+	if ok && now.Before(expiry) {
+		return nil
+	}
+
+	if err := pamAuthenticate(service, username, password); err != nil {
+		return err
+	}
+	if group != "" {
+		if err := checkGroup(username, group); err != nil {
+			return err
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for k, expiry := range a.cache {
+		if now.After(expiry) {
+			delete(a.cache, k)
+		}
+	}
+	a.cache[key] = now.Add(pamCacheTTL)
+	return nil
+}
+
+// checkGroup fails unless username is a member of group, as primary or
+// supplementary group
+func checkGroup(username, group string) error {
+	u, err := user.Lookup(username)
+	if err != nil {
+		return err
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	ids, err := u.GroupIds()
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if id == g.Gid {
+			return nil
+		}
+	}
+	return fmt.Errorf("user %s is not a member of %s", username, group)
+}
@@ -0,0 +1,148 @@
+//go:build linux && cgo
+
+package auth
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+// libpam is loaded at runtime so building doesn't need the PAM headers.
+// These declarations follow the Linux-PAM ABI.
+
+struct pam_message { int msg_style; const char *msg; };
+struct pam_response { char *resp; int resp_retcode; };
+struct pam_conv {
+	int (*conv)(int, const struct pam_message **, struct pam_response **, void *);
+	void *appdata_ptr;
+};
+
+#define NEBULA_PAM_SUCCESS 0
+#define NEBULA_PAM_BUF_ERR 5
+#define NEBULA_PAM_CONV_ERR 19
+#define NEBULA_PAM_PROMPT_ECHO_OFF 1
+#define NEBULA_PAM_PROMPT_ECHO_ON 2
+#define NEBULA_PAM_ERROR_MSG 3
+#define NEBULA_PAM_TEXT_INFO 4
+
+typedef int (*pam_start_fn)(const char *, const char *, const struct pam_conv *, void **);
+typedef int (*pam_call_fn)(void *, int);
+typedef const char *(*pam_strerror_fn)(void *, int);
+
+static void *nebula_libpam;
+
+static int nebula_pam_load(void) {
+	nebula_libpam = dlopen("libpam.so.0", RTLD_NOW);
+	return nebula_libpam != NULL;
+}
+
+struct nebula_credentials { const char *user; const char *password; };
+
+// nebula_conv answers password prompts with the password and other prompts
+// with the username
+static int nebula_conv(int n, const struct pam_message **msg, struct pam_response **resp, void *data) {
+	struct nebula_credentials *cred = data;
+	if (n <= 0) {
+		return NEBULA_PAM_CONV_ERR;
+	}
+	struct pam_response *r = calloc(n, sizeof(struct pam_response));
+	if (r == NULL) {
+		return NEBULA_PAM_BUF_ERR;
+	}
+	for (int i = 0; i < n; i++) {
+		switch (msg[i]->msg_style) {
+		case NEBULA_PAM_PROMPT_ECHO_OFF:
+			r[i].resp = strdup(cred->password);
+			break;
+		case NEBULA_PAM_PROMPT_ECHO_ON:
+			r[i].resp = strdup(cred->user);
+			break;
+		case NEBULA_PAM_ERROR_MSG:
+		case NEBULA_PAM_TEXT_INFO:
+			break;
+		default:
+			for (int j = 0; j < i; j++) {
+				free(r[j].resp);
+			}
+			free(r);
+			return NEBULA_PAM_CONV_ERR;
+		}
+	}
+	*resp = r;
+	return NEBULA_PAM_SUCCESS;
+}
+
+// nebula_pam_authenticate authenticates user and checks their account,
+// returning the PAM result and writing its description to errbuf
+static int nebula_pam_authenticate(const char *service, const char *user, const char *password, char *errbuf, size_t errlen) {
+	pam_start_fn start = (pam_start_fn)dlsym(nebula_libpam, "pam_start");
+	pam_call_fn authenticate = (pam_call_fn)dlsym(nebula_libpam, "pam_authenticate");
+	pam_call_fn acct_mgmt = (pam_call_fn)dlsym(nebula_libpam, "pam_acct_mgmt");
+	pam_call_fn end = (pam_call_fn)dlsym(nebula_libpam, "pam_end");
+	pam_strerror_fn strerror = (pam_strerror_fn)dlsym(nebula_libpam, "pam_strerror");
+	if (!start || !authenticate || !acct_mgmt || !end || !strerror) {
+		snprintf(errbuf, errlen, "libpam is missing symbols");
+		return -1;
+	}
+
+	struct nebula_credentials cred = { user, password };
+	struct pam_conv conv = { nebula_conv, &cred };
+	void *handle = NULL;
+	int rc = start(service, user, &conv, &handle);
+	if (rc != NEBULA_PAM_SUCCESS) {
+		snprintf(errbuf, errlen, "pam_start failed with code %d", rc);
+		return rc;
+	}
+	rc = authenticate(handle, 0);
+	if (rc == NEBULA_PAM_SUCCESS) {
+		rc = acct_mgmt(handle, 0);
+	}
+	if (rc != NEBULA_PAM_SUCCESS) {
+		snprintf(errbuf, errlen, "%s", strerror(handle, rc));
+	}
+	end(handle, rc);
+	return rc;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+var (
+	pamOnce   sync.Once
+	pamLoaded bool
+)
+
+// pamAuthenticate checks the password of a system user with the PAM
+// service, then that the account may log in
+func pamAuthenticate(service, username, password string) error {
+	pamOnce.Do(func() { pamLoaded = C.nebula_pam_load() != 0 })
+	if !pamLoaded {
+		return ErrPAMUnavailable
+	}
+
+	cService := C.CString(service)
+	defer C.free(unsafe.Pointer(cService))
+	cUser := C.CString(username)
+	defer C.free(unsafe.Pointer(cUser))
+	cPassword := C.CString(password)
+	defer func() {
+		C.memset(unsafe.Pointer(cPassword), 0, C.size_t(len(password)))
+		C.free(unsafe.Pointer(cPassword))
+	}()
+
+	const errLen = 256
+	errBuf := (*C.char)(C.calloc(errLen, 1))
+	defer C.free(unsafe.Pointer(errBuf))
+
+	if rc := C.nebula_pam_authenticate(cService, cUser, cPassword, errBuf, errLen); rc != 0 {
+		return fmt.Errorf("PAM authentication of %s failed: %s", username, C.GoString(errBuf))
+	}
+	return nil
+}
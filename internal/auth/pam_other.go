@@ -0,0 +1,8 @@
+//go:build !linux || !cgo
+
+package auth
+
+// pamAuthenticate reports that PAM isn't available on this build
+func pamAuthenticate(service, username, password string) error {
+	return ErrPAMUnavailable
+}
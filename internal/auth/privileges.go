@@ -1,49 +1,98 @@
 package auth
 
 import (
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"os/user"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/nebula/nebula/internal/storage"
 )
 
+const credentialsKey = "sudo_credentials"
+
+// ErrNoCredentials is returned when no credentials are stored
+var ErrNoCredentials = errors.New("no credentials stored")
+
+// ErrCredentialsNotUsed is returned when storing credentials while
+// commands escalate through polkit
+var ErrCredentialsNotUsed = errors.New("credentials are not stored with pkexec escalation")
+
+// Escalation methods of privileged commands when Nebula doesn't run as root
 const (
-	credentialsKey = "sudo_credentials"
-	encryptionKey  = "nebula_secret_key_32bytes_long!" // In production, use a secure key derivation
+	// EscalationSudo runs them with sudo and the stored password
+	EscalationSudo = "sudo"
+	// EscalationPkexec runs them with pkexec, the polkit agent of the
+	// desktop session asking for authorization
+	EscalationPkexec = "pkexec"
 )
 
 // PrivilegeManager manages elevated privileges and credentials
 type PrivilegeManager struct {
 	storage    *storage.Storage
+	keys       *keyRing
 	password   string
 	mu         sync.RWMutex
 	isElevated bool
+	// ttl is how long credentials are kept after they are set or
+	// extended, 0 until they are cleared
+	ttl time.Duration
+	// expires is when the credentials are wiped, zero for never
+	expires time.Time
+	timer   *time.Timer
+	// escalation is EscalationSudo or EscalationPkexec
+	escalation string
+	// sudoMode keeps the password out of storage, requests carry it instead
+	sudoMode     bool
+	elevationTTL time.Duration
+	// elevations are the tokens of POST /api/v1/auth/elevate, by token
+	elevations map[string]elevation
+	onFailure  func(PrivilegeFailure)
+}
+
+// PrivilegeFailure describes a privileged command that failed
+type PrivilegeFailure struct {
+	// Command is the name of the command only, its arguments may hold
+	// secrets such as the password option of a cifs mount
+	Command string    `json:"command"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
 }
 
-// NewPrivilegeManager creates a new privilege manager
-func NewPrivilegeManager(store *storage.Storage) *PrivilegeManager {
+// NewPrivilegeManager creates a new privilege manager. Stored credentials
+// are encrypted with a key derived from the install secret in keyFile,
+// generated on first run.
+func NewPrivilegeManager(store *storage.Storage, keyFile string) (*PrivilegeManager, error) {
 	pm := &PrivilegeManager{
 		storage:    store,
 		isElevated: IsRunningAsRoot(),
+		escalation: EscalationSudo,
 	}
 
 	// Load saved credentials
 	if store != nil {
+		keys, err := loadKeyRing(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		pm.keys = keys
 		pm.loadCredentials()
 	}
 
-	return pm
+	return pm, nil
 }
 
 // IsRunningAsRoot checks if the application is running with elevated privileges
@@ -91,20 +140,176 @@ func (pm *PrivilegeManager) SetCredentials(password string) error {
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
 
+	if pm.escalation == EscalationPkexec {
+		return ErrCredentialsNotUsed
+	}
+	if pm.sudoMode {
+		return ErrSudoMode
+	}
+
 	pm.password = password
+	pm.expires = time.Time{}
+	if pm.ttl > 0 {
+		pm.expires = time.Now().Add(pm.ttl)
+	}
+	pm.schedule()
 
 	// Encrypt and save to storage
 	if pm.storage != nil {
-		encrypted, err := encrypt(password, encryptionKey)
-		if err != nil {
-			return fmt.Errorf("failed to encrypt credentials: %w", err)
-		}
-		return pm.storage.Set(storage.BucketSessions, credentialsKey, []byte(encrypted))
+		return pm.saveCredentials(pm.keys.current())
 	}
 
 	return nil
 }
 
+// SetEscalation selects how privileged commands escalate, EscalationSudo
+// or EscalationPkexec. Switching to pkexec wipes the stored password, which
+// is no longer needed.
+func (pm *PrivilegeManager) SetEscalation(method string) {
+	pm.mu.Lock()
+	pm.escalation = method
+	wipe := method == EscalationPkexec && pm.password != ""
+	pm.mu.Unlock()
+
+	if wipe {
+		if err := pm.ClearCredentials(); err != nil {
+			log.Printf("Failed to clear stored credentials: %v", err)
+		}
+		log.Println("Stored credentials cleared, privileged commands escalate through pkexec")
+	}
+}
+
+// Escalation returns how privileged commands escalate
+func (pm *PrivilegeManager) Escalation() string {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.escalation
+}
+
+// RequiresPassword reports whether privileged commands need a password,
+// stored first or, in sudo mode, sent with each request
+func (pm *PrivilegeManager) RequiresPassword() bool {
+	return !pm.isElevated && pm.Escalation() == EscalationSudo && (pm.SudoMode() || !pm.HasCredentials())
+}
+
+// SetCredentialTTL sets how long credentials are kept after they are set
+// or extended, 0 keeps them until they are cleared. Credentials already
+// stored expire ttl from now at the latest.
+func (pm *PrivilegeManager) SetCredentialTTL(ttl time.Duration) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	pm.ttl = ttl
+	if pm.password == "" || ttl <= 0 {
+		return
+	}
+	if limit := time.Now().Add(ttl); pm.expires.IsZero() || pm.expires.After(limit) {
+		pm.expires = limit
+		pm.schedule()
+		if pm.storage != nil {
+			if err := pm.saveCredentials(pm.keys.current()); err != nil {
+				log.Printf("Failed to save credentials expiry: %v", err)
+			}
+		}
+	}
+}
+
+// CredentialsExpiry returns when the credentials are wiped, zero when they
+// are kept until cleared. It returns false when there are none.
+func (pm *PrivilegeManager) CredentialsExpiry() (time.Time, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	return pm.expires, pm.password != ""
+}
+
+// ExtendCredentials keeps the credentials for another TTL from now and
+// returns their new expiry
+func (pm *PrivilegeManager) ExtendCredentials() (time.Time, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.password == "" {
+		return time.Time{}, ErrNoCredentials
+	}
+	if pm.ttl <= 0 {
+		return time.Time{}, nil
+	}
+	pm.expires = time.Now().Add(pm.ttl)
+	pm.schedule()
+	if pm.storage != nil {
+		if err := pm.saveCredentials(pm.keys.current()); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return pm.expires, nil
+}
+
+// schedule wipes the credentials at their expiry. Callers must hold pm.mu.
+func (pm *PrivilegeManager) schedule() {
+	if pm.timer != nil {
+		pm.timer.Stop()
+		pm.timer = nil
+	}
+	if pm.expires.IsZero() {
+		return
+	}
+	pm.timer = time.AfterFunc(time.Until(pm.expires), pm.expire)
+}
+
+// expire wipes the credentials once they expired, from memory and storage
+func (pm *PrivilegeManager) expire() {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	// Extended since the timer fired
+	if pm.expires.IsZero() || time.Now().Before(pm.expires) {
+		return
+	}
+	pm.password = ""
+	pm.expires = time.Time{}
+	if pm.storage != nil {
+		if err := pm.storage.Delete(storage.BucketSessions, credentialsKey); err != nil {
+			log.Printf("Failed to delete expired credentials: %v", err)
+		}
+	}
+	log.Println("Stored credentials expired")
+}
+
+// RotateKey generates a new install secret and encrypts the stored
+// credentials again with it. The previous secret is kept in the key file
+// until they are saved, so an interrupted rotation loses nothing.
+func (pm *PrivilegeManager) RotateKey() error {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if pm.storage == nil {
+		return fmt.Errorf("storage not available")
+	}
+	key, err := pm.keys.rotate()
+	if err != nil {
+		return err
+	}
+	if pm.password != "" {
+		if err := pm.saveCredentials(key); err != nil {
+			return err
+		}
+	}
+	return pm.keys.prune()
+}
+
+// saveCredentials encrypts the password with key and stores it until it
+// expires. Callers must hold pm.mu.
+func (pm *PrivilegeManager) saveCredentials(key []byte) error {
+	encrypted, err := encrypt(pm.password, key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	if pm.expires.IsZero() {
+		return pm.storage.Set(storage.BucketSessions, credentialsKey, []byte(encrypted))
+	}
+	return pm.storage.SetWithTTL(storage.BucketSessions, credentialsKey, []byte(encrypted), time.Until(pm.expires))
+}
+
 // GetCredentials returns the stored credentials
 func (pm *PrivilegeManager) GetCredentials() string {
 	pm.mu.RLock()
@@ -125,6 +330,8 @@ func (pm *PrivilegeManager) ClearCredentials() error {
 	defer pm.mu.Unlock()
 
 	pm.password = ""
+	pm.expires = time.Time{}
+	pm.schedule()
 
 	if pm.storage != nil {
 		return pm.storage.Delete(storage.BucketSessions, credentialsKey)
@@ -133,19 +340,38 @@ func (pm *PrivilegeManager) ClearCredentials() error {
 	return nil
 }
 
-// loadCredentials loads credentials from storage
+// loadCredentials loads credentials from storage. Credentials encrypted
+// with an older secret, or the key of older releases, are encrypted again
+// with the current one.
 func (pm *PrivilegeManager) loadCredentials() {
 	data, err := pm.storage.Get(storage.BucketSessions, credentialsKey)
 	if err != nil || len(data) == 0 {
 		return
 	}
 
-	decrypted, err := decrypt(string(data), encryptionKey)
-	if err != nil {
-		return
+	legacy := sha256.Sum256([]byte(legacyKey))
+	for i, key := range append(pm.keys.keys(), legacy[:]) {
+		decrypted, err := decrypt(string(data), key)
+		if err != nil {
+			continue
+		}
+		pm.password = decrypted
+		if left, ok, err := pm.storage.TTL(storage.BucketSessions, credentialsKey); err == nil && ok {
+			pm.expires = time.Now().Add(left)
+			pm.schedule()
+		}
+		if i > 0 {
+			if err := pm.saveCredentials(pm.keys.current()); err != nil {
+				// Keep the old secrets, they still decrypt the stored credentials
+				log.Printf("Failed to re-encrypt stored credentials: %v", err)
+				return
+			}
+		}
+		break
+	}
+	if err := pm.keys.prune(); err != nil {
+		log.Printf("Failed to drop old credential keys: %v", err)
 	}
-
-	pm.password = decrypted
 }
 
 // ValidateCredentials validates sudo credentials
@@ -155,8 +381,9 @@ func (pm *PrivilegeManager) ValidateCredentials(password string) bool {
 		return true
 	}
 
-	// Test credentials with sudo -S
-	cmd := exec.Command("sudo", "-S", "-v")
+	// Test credentials with sudo -S, ignoring the timestamp sudo caches
+	// after a successful check, which would accept any password
+	cmd := exec.Command("sudo", "-k", "-S", "-v")
 	cmd.Stdin = strings.NewReader(password + "\n")
 	err := cmd.Run()
 	return err == nil
@@ -164,16 +391,68 @@ func (pm *PrivilegeManager) ValidateCredentials(password string) bool {
 
 // RunWithPrivileges runs a command with elevated privileges
 func (pm *PrivilegeManager) RunWithPrivileges(name string, args ...string) ([]byte, error) {
+	return pm.RunWithPrivilegesContext(context.Background(), name, args...)
+}
+
+// OnFailure registers a function called when a privileged command fails,
+// unless its context was cancelled
+func (pm *PrivilegeManager) OnFailure(fn func(PrivilegeFailure)) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.onFailure = fn
+}
+
+// RunWithPrivilegesContext runs a command with elevated privileges, with
+// the password of the request in ctx if any, or else the stored one
+func (pm *PrivilegeManager) RunWithPrivilegesContext(ctx context.Context, name string, args ...string) ([]byte, error) {
+	out, err := pm.runWithPrivileges(ctx, name, args...)
+	if err != nil && ctx.Err() == nil {
+		pm.mu.RLock()
+		onFailure := pm.onFailure
+		pm.mu.RUnlock()
+		if onFailure != nil {
+			onFailure(privilegeFailure(name, out, err))
+		}
+	}
+	return out, err
+}
+
+// privilegeFailure describes a failed command by its error and the last
+// line of its output, where commands and sudo report the cause
+func privilegeFailure(name string, out []byte, err error) PrivilegeFailure {
+	f := PrivilegeFailure{
+		Command: name,
+		Error:   err.Error(),
+		Time:    time.Now(),
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if last := strings.TrimSpace(lines[len(lines)-1]); last != "" {
+		f.Error += ": " + last
+	}
+	return f
+}
+
+// runWithPrivileges runs a command with elevated privileges
+func (pm *PrivilegeManager) runWithPrivileges(ctx context.Context, name string, args ...string) ([]byte, error) {
 	if pm.isElevated {
 		// Already running as root, execute directly
-		cmd := exec.Command(name, args...)
+		cmd := exec.CommandContext(ctx, name, args...)
 		return cmd.CombinedOutput()
 	}
 
-	// Use stored credentials with sudo
-	pm.mu.RLock()
-	password := pm.password
-	pm.mu.RUnlock()
+	// The polkit agent asks the desktop user, nothing is stored
+	if pm.Escalation() == EscalationPkexec {
+		cmd := exec.CommandContext(ctx, "pkexec", append([]string{name}, args...)...)
+		return cmd.CombinedOutput()
+	}
+
+	// Use the password of the request, or else the stored credentials, with sudo
+	password := passwordFrom(ctx)
+	if password == "" {
+		pm.mu.RLock()
+		password = pm.password
+		pm.mu.RUnlock()
+	}
 
 	if password == "" {
 		return nil, fmt.Errorf("no credentials stored, cannot run privileged command")
@@ -181,13 +460,13 @@ func (pm *PrivilegeManager) RunWithPrivileges(name string, args ...string) ([]by
 
 	if runtime.GOOS == "windows" {
 		// Windows doesn't use sudo
-		cmd := exec.Command(name, args...)
+		cmd := exec.CommandContext(ctx, name, args...)
 		return cmd.CombinedOutput()
 	}
 
 	// Use sudo with password from stdin
 	fullArgs := append([]string{"-S", name}, args...)
-	cmd := exec.Command("sudo", fullArgs...)
+	cmd := exec.CommandContext(ctx, "sudo", fullArgs...)
 	cmd.Stdin = strings.NewReader(password + "\n")
 	return cmd.CombinedOutput()
 }
@@ -202,6 +481,10 @@ func (pm *PrivilegeManager) RunWithPrivilegesInteractive(name string, args ...st
 		return exec.Command(name, args...)
 	}
 
+	if pm.Escalation() == EscalationPkexec {
+		return exec.Command("pkexec", append([]string{name}, args...)...)
+	}
+
 	fullArgs := append([]string{"-S", name}, args...)
 	cmd := exec.Command("sudo", fullArgs...)
 
@@ -216,12 +499,9 @@ func (pm *PrivilegeManager) RunWithPrivilegesInteractive(name string, args ...st
 	return cmd
 }
 
-// encrypt encrypts a string using AES-GCM
-func encrypt(plaintext, key string) (string, error) {
-	// Create a 32-byte key using SHA-256
-	keyHash := sha256.Sum256([]byte(key))
-
-	block, err := aes.NewCipher(keyHash[:])
+// encrypt encrypts a string using AES-GCM with a 32-byte key
+func encrypt(plaintext string, key []byte) (string, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -240,16 +520,14 @@ func encrypt(plaintext, key string) (string, error) {
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
-// decrypt decrypts a string using AES-GCM
-func decrypt(ciphertext, key string) (string, error) {
+// decrypt decrypts a string using AES-GCM with a 32-byte key
+func decrypt(ciphertext string, key []byte) (string, error) {
 	data, err := base64.StdEncoding.DecodeString(ciphertext)
 	if err != nil {
 		return "", err
 	}
 
-	keyHash := sha256.Sum256([]byte(key))
-
-	block, err := aes.NewCipher(keyHash[:])
+	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,262 @@
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificate states
+const (
+	StatusValid    = "valid"
+	StatusExpiring = "expiring"
+	StatusExpired  = "expired"
+)
+
+// maxFileSize skips files too large to be certificates
+const maxFileSize = 1 << 20
+
+// Certificate describes the first certificate of a PEM file
+type Certificate struct {
+	Path        string    `json:"path"`
+	Subject     string    `json:"subject"`
+	Issuer      string    `json:"issuer"`
+	DNSNames    []string  `json:"dns_names,omitempty"`
+	IPAddresses []string  `json:"ip_addresses,omitempty"`
+	Serial      string    `json:"serial"`
+	Fingerprint string    `json:"fingerprint"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+	DaysLeft    int       `json:"days_left"`
+	Status      string    `json:"status"`
+	SelfSigned  bool      `json:"self_signed"`
+	IsCA        bool      `json:"is_ca"`
+	// Chain is the number of certificates in the file, including this one
+	Chain int `json:"chain"`
+}
+
+// Settings configures the inventory
+type Settings struct {
+	// Paths are files and directories scanned for certificates
+	Paths []string
+	// WarnDays is how many days before expiry a certificate is expiring
+	WarnDays int
+}
+
+// Inventory keeps the certificates found in the configured paths
+type Inventory struct {
+	mu       sync.RWMutex
+	settings Settings
+	certs    []Certificate
+	scanned  time.Time
+	// alerted holds each certificate of the last scan, with the status
+	// alerts were raised for
+	alerted   map[string]Certificate
+	onAlert   func(Certificate)
+	onResolve func(Certificate)
+}
+
+// NewInventory creates a certificate inventory
+func NewInventory(settings Settings) *Inventory {
+	return &Inventory{settings: settings, alerted: make(map[string]Certificate)}
+}
+
+// Configure replaces the settings, they apply from the next scan
+func (inv *Inventory) Configure(settings Settings) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.settings = settings
+}
+
+// Settings returns the current settings
+func (inv *Inventory) Settings() Settings {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	return inv.settings
+}
+
+// OnAlert registers a function called when a certificate becomes expiring or expired
+func (inv *Inventory) OnAlert(fn func(Certificate)) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.onAlert = fn
+}
+
+// OnResolve registers a function called with the last alerted state of an
+// expiring or expired certificate that was renewed or removed
+func (inv *Inventory) OnResolve(fn func(Certificate)) {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	inv.onResolve = fn
+}
+
+// List returns the certificates found by the last scan and when it ran
+func (inv *Inventory) List() ([]Certificate, time.Time) {
+	inv.mu.RLock()
+	defer inv.mu.RUnlock()
+	return inv.certs, inv.scanned
+}
+
+// Start scans the paths every interval until ctx is cancelled
+func (inv *Inventory) Start(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		inv.Scan()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Scan reads the certificates in the configured paths, raising alerts for
+// those that became expiring or expired and resolving them once no expiring
+// or expired certificate is left at their path
+func (inv *Inventory) Scan() []Certificate {
+	settings := inv.Settings()
+	now := time.Now()
+
+	var certs []Certificate
+	seen := make(map[string]bool)
+	for _, root := range settings.Paths {
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if !os.IsNotExist(err) {
+					log.Printf("Failed to scan %s for certificates: %v", path, err)
+				}
+				return nil
+			}
+			if d.IsDir() || seen[path] {
+				return nil
+			}
+			seen[path] = true
+			if cert, ok := readCertificate(path, now, settings.WarnDays); ok {
+				certs = append(certs, cert)
+			}
+			return nil
+		})
+	}
+	sort.Slice(certs, func(i, j int) bool { return certs[i].NotAfter.Before(certs[j].NotAfter) })
+
+	inv.mu.Lock()
+	inv.certs = certs
+	inv.scanned = now
+	var alerts, resolved []Certificate
+	alerted := make(map[string]Certificate, len(certs))
+	failing := make(map[string]bool)
+	for _, cert := range certs {
+		key := cert.Path + "\x00" + cert.Fingerprint
+		if cert.Status != StatusValid {
+			failing[cert.Path] = true
+			if inv.alerted[key].Status != cert.Status {
+				alerts = append(alerts, cert)
+			}
+		}
+		alerted[key] = cert
+	}
+	for _, cert := range inv.alerted {
+		if cert.Status != StatusValid && !failing[cert.Path] {
+			resolved = append(resolved, cert)
+		}
+	}
+	inv.alerted = alerted
+	onAlert, onResolve := inv.onAlert, inv.onResolve
+	inv.mu.Unlock()
+
+	for _, cert := range alerts {
+		log.Printf("Certificate %s (%s) is %s, expires %s", cert.Path, cert.Subject, cert.Status, cert.NotAfter.Format(time.RFC3339))
+		if onAlert != nil {
+			onAlert(cert)
+		}
+	}
+	for _, cert := range resolved {
+		log.Printf("Certificate %s (%s) is no longer %s", cert.Path, cert.Subject, cert.Status)
+		if onResolve != nil {
+			onResolve(cert)
+		}
+	}
+	return certs
+}
+
+// readCertificate parses the first certificate of a PEM file, following symlinks
+func readCertificate(path string, now time.Time, warnDays int) (Certificate, bool) {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() > maxFileSize {
+		return Certificate{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Certificate{}, false
+	}
+
+	chain := ParseChain(data)
+	if len(chain) == 0 {
+		return Certificate{}, false
+	}
+	cert := describe(chain[0], now, warnDays)
+	cert.Path = path
+	cert.Chain = len(chain)
+	return cert, true
+}
+
+// ParseChain returns the certificates of PEM data, skipping keys and invalid blocks
+func ParseChain(data []byte) []*x509.Certificate {
+	var chain []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return chain
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			chain = append(chain, cert)
+		}
+	}
+}
+
+// describe summarizes a certificate
+func describe(c *x509.Certificate, now time.Time, warnDays int) Certificate {
+	sum := sha256.Sum256(c.Raw)
+	cert := Certificate{
+		Subject:     c.Subject.String(),
+		Issuer:      c.Issuer.String(),
+		DNSNames:    c.DNSNames,
+		Serial:      strings.ToUpper(c.SerialNumber.Text(16)),
+		Fingerprint: hex.EncodeToString(sum[:]),
+		NotBefore:   c.NotBefore,
+		NotAfter:    c.NotAfter,
+		DaysLeft:    int(c.NotAfter.Sub(now).Hours() / 24),
+		SelfSigned:  bytes.Equal(c.RawSubject, c.RawIssuer) && c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature) == nil,
+		IsCA:        c.IsCA,
+	}
+	for _, ip := range c.IPAddresses {
+		cert.IPAddresses = append(cert.IPAddresses, ip.String())
+	}
+
+	switch {
+	case now.After(c.NotAfter):
+		cert.Status = StatusExpired
+	case c.NotAfter.Sub(now) < time.Duration(warnDays)*24*time.Hour:
+		cert.Status = StatusExpiring
+	default:
+		cert.Status = StatusValid
+	}
+	return cert
+}
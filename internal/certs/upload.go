@@ -0,0 +1,87 @@
+package certs
+
+import (
+	"crypto"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// ErrInvalid is returned for uploads that aren't a matching certificate and key
+var ErrInvalid = errors.New("invalid certificate")
+
+// namePattern matches the names uploaded pairs are stored under
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Upload validates a PEM certificate chain and its private key and stores
+// them in dir as <name>.crt and <name>.key, replacing an existing pair
+func Upload(dir, name string, certPEM, keyPEM []byte, warnDays int) (Certificate, error) {
+	if !namePattern.MatchString(name) || len(name) > 128 {
+		return Certificate{}, fmt.Errorf("%w: invalid name %q", ErrInvalid, name)
+	}
+	chain := ParseChain(certPEM)
+	if len(chain) == 0 {
+		return Certificate{}, fmt.Errorf("%w: no PEM certificate found", ErrInvalid)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return Certificate{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	// X509KeyPair already rejects mismatched keys, this guards against
+	// key types it doesn't compare
+	if signer, ok := pair.PrivateKey.(crypto.Signer); !ok || !publicKeysEqual(signer.Public(), chain[0].PublicKey) {
+		return Certificate{}, fmt.Errorf("%w: private key does not match certificate", ErrInvalid)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Certificate{}, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	certPath := filepath.Join(dir, name+".crt")
+	if err := writeAtomic(filepath.Join(dir, name+".key"), keyPEM, 0600); err != nil {
+		return Certificate{}, err
+	}
+	if err := writeAtomic(certPath, certPEM, 0644); err != nil {
+		return Certificate{}, err
+	}
+
+	cert := describe(chain[0], time.Now(), warnDays)
+	cert.Path = certPath
+	cert.Chain = len(chain)
+	return cert, nil
+}
+
+// publicKeysEqual compares public keys of any standard type
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// writeAtomic writes data to a temporary file in the same directory and
+// renames it over path, so readers never see a partial file
+func writeAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
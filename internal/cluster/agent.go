@@ -0,0 +1,108 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// registerPath is the controller endpoint agents register with
+const registerPath = "/api/v1/cluster/register"
+
+// AgentSettings configures an agent
+type AgentSettings struct {
+	ControllerURL string
+	Token         string
+	// Registration describes this agent, Hostname and OS are filled in
+	Registration Registration
+	Interval     time.Duration
+}
+
+// Agent registers this instance with a controller and keeps the registration alive
+type Agent struct {
+	settings AgentSettings
+	client   *http.Client
+}
+
+// NewAgent creates an agent
+func NewAgent(settings AgentSettings) *Agent {
+	reg := &settings.Registration
+	if reg.Hostname == "" {
+		reg.Hostname, _ = os.Hostname()
+	}
+	if reg.Name == "" {
+		reg.Name = reg.Hostname
+	}
+	reg.OS = runtime.GOOS + "/" + runtime.GOARCH
+
+	return &Agent{
+		settings: settings,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Run registers with the controller every interval until ctx is cancelled
+func (a *Agent) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.settings.Interval)
+	defer ticker.Stop()
+
+	registered := false
+	for {
+		err := a.register(ctx)
+		switch {
+		case err != nil:
+			log.Printf("Failed to register with controller %s: %v", a.settings.ControllerURL, err)
+			registered = false
+		case !registered:
+			log.Printf("Registered with controller %s as %s", a.settings.ControllerURL, a.settings.Registration.Name)
+			registered = true
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// register sends the registration to the controller
+func (a *Agent) register(ctx context.Context) error {
+	body, err := json.Marshal(a.settings.Registration)
+	if err != nil {
+		return err
+	}
+
+	url := strings.TrimSuffix(a.settings.ControllerURL, "/") + registerPath
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(TokenHeader, a.settings.Token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+		}
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
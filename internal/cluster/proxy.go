@@ -0,0 +1,43 @@
+package cluster
+
+import (
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// Proxy forwards a request to an agent. path is the agent path, e.g.
+// /api/v1/metrics/all or /ws/terminal, user the controller user it is made for.
+// WebSocket upgrades and event streams are proxied as well.
+func (r *Registry) Proxy(w http.ResponseWriter, req *http.Request, host Host, path, user string) error {
+	target, err := ParseURL(host.URL)
+	if err != nil {
+		return err
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Director: func(out *http.Request) {
+			out.URL.Scheme = target.Scheme
+			out.URL.Host = target.Host
+			out.URL.Path = strings.TrimSuffix(target.Path, "/") + path
+			out.URL.RawPath = ""
+			out.Host = target.Host
+
+			// The agent trusts the cluster token, not the controller credentials
+			out.Header.Del("Authorization")
+			out.Header.Del("Cookie")
+			out.Header.Set(TokenHeader, r.token)
+			out.Header.Set(UserHeader, user)
+			// The controller checked the browser origin, which does not
+			// match the agent host
+			out.Header.Del("Origin")
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte(`{"error":"host ` + host.Name + ` unreachable"}`))
+		},
+	}
+	proxy.ServeHTTP(w, req)
+	return nil
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Modes a Nebula instance can run in
+const (
+	ModeStandalone = "standalone"
+	ModeAgent      = "agent"
+	ModeController = "controller"
+)
+
+// TokenHeader carries the cluster token on registrations and on the
+// requests the controller proxies to agents
+const TokenHeader = "X-Nebula-Cluster-Token"
+
+// UserHeader carries the controller user a proxied request is made for
+const UserHeader = "X-Nebula-User"
+
+// hostNamePattern restricts host names to what fits in a URL path segment
+var hostNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,62}$`)
+
+// Registration is sent by agents to the controller
+type Registration struct {
+	Name string `json:"name"`
+	// URL is where the controller reaches the agent, e.g. http://10.0.0.5:8080
+	URL      string `json:"url"`
+	Version  string `json:"version"`
+	Hostname string `json:"hostname"`
+	OS       string `json:"os"`
+}
+
+// Host is an agent known to the controller
+type Host struct {
+	Registration
+	RegisteredAt time.Time `json:"registered_at"`
+	LastSeen     time.Time `json:"last_seen"`
+	Online       bool      `json:"online"`
+}
+
+// Registry keeps the agents registered with a controller
+type Registry struct {
+	token   string
+	timeout time.Duration
+	mu      sync.RWMutex
+	hosts   map[string]*Host
+}
+
+// NewRegistry creates a registry accepting agents that present token. Hosts
+// are reported offline when not seen for timeout.
+func NewRegistry(token string, timeout time.Duration) *Registry {
+	return &Registry{
+		token:   token,
+		timeout: timeout,
+		hosts:   make(map[string]*Host),
+	}
+}
+
+// Token returns the cluster token sent to agents
+func (r *Registry) Token() string {
+	return r.token
+}
+
+// Authorized reports whether token is the cluster token
+func (r *Registry) Authorized(token string) bool {
+	return ValidToken(token, r.token)
+}
+
+// ValidToken reports whether token is the cluster token want, compared in constant time
+func ValidToken(token, want string) bool {
+	return token != "" && want != "" && subtle.ConstantTimeCompare([]byte(token), []byte(want)) == 1
+}
+
+// Validate checks a registration
+func (reg Registration) Validate() error {
+	if !ValidHostName(reg.Name) {
+		return fmt.Errorf("invalid host name %q", reg.Name)
+	}
+	if _, err := ParseURL(reg.URL); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidHostName reports whether name can be used as a host name
+func ValidHostName(name string) bool {
+	return hostNamePattern.MatchString(name)
+}
+
+// ParseURL checks the URL of a controller or an agent
+func ParseURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%q is not an http or https URL", raw)
+	}
+	return u, nil
+}
+
+// Register adds an agent or refreshes it, agents register again on every heartbeat
+func (r *Registry) Register(reg Registration) (*Host, error) {
+	if err := reg.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	host, ok := r.hosts[reg.Name]
+	if !ok {
+		host = &Host{RegisteredAt: now}
+		r.hosts[reg.Name] = host
+	}
+	host.Registration = reg
+	host.LastSeen = now
+
+	h := *host
+	h.Online = true
+	return &h, nil
+}
+
+// Hosts lists the registered agents by name
+func (r *Registry) Hosts() []Host {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hosts := make([]Host, 0, len(r.hosts))
+	for _, host := range r.hosts {
+		hosts = append(hosts, r.snapshot(host))
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Name < hosts[j].Name })
+	return hosts
+}
+
+// Get returns a registered agent
+func (r *Registry) Get(name string) (Host, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	host, ok := r.hosts[name]
+	if !ok {
+		return Host{}, false
+	}
+	return r.snapshot(host), true
+}
+
+// Remove forgets an agent, it shows up again if it is still running
+func (r *Registry) Remove(name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.hosts[name]; !ok {
+		return false
+	}
+	delete(r.hosts, name)
+	return true
+}
+
+// snapshot copies a host with its online state, r.mu must be held
+func (r *Registry) snapshot(host *Host) Host {
+	h := *host
+	h.Online = time.Since(h.LastSeen) < r.timeout
+	return h
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"encoding/json"
 	"fmt"
+	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,119 +16,360 @@ import (
 
 // Config holds all configuration values
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Storage  StorageConfig  `mapstructure:"storage"`
-	Auth     AuthConfig     `mapstructure:"auth"`
-	Metrics  MetricsConfig  `mapstructure:"metrics"`
-	Terminal TerminalConfig `mapstructure:"terminal"`
-	Files    FilesConfig    `mapstructure:"files"`
-	Packages PackagesConfig `mapstructure:"packages"`
-	Updater  UpdaterConfig  `mapstructure:"updater"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
+	Server       ServerConfig       `mapstructure:"server"`
+	Storage      StorageConfig      `mapstructure:"storage"`
+	Auth         AuthConfig         `mapstructure:"auth"`
+	RateLimit    RateLimitConfig    `mapstructure:"rate_limit"`
+	Metrics      MetricsConfig      `mapstructure:"metrics"`
+	Terminal     TerminalConfig     `mapstructure:"terminal"`
+	Files        FilesConfig        `mapstructure:"files"`
+	Packages     PackagesConfig     `mapstructure:"packages"`
+	Containers   ContainersConfig   `mapstructure:"containers"`
+	Certificates CertificatesConfig `mapstructure:"certificates"`
+	Scheduler    SchedulerConfig    `mapstructure:"scheduler"`
+	Notify       NotifyConfig       `mapstructure:"notifications"`
+	Updater      UpdaterConfig      `mapstructure:"updater"`
+	WebSocket    WebSocketConfig    `mapstructure:"websocket"`
+	Events       EventsConfig       `mapstructure:"events"`
+	Cluster      ClusterConfig      `mapstructure:"cluster"`
+	Logging      LoggingConfig      `mapstructure:"logging"`
 }
 
 // ServerConfig holds server configuration
 type ServerConfig struct {
-	Host            string        `mapstructure:"host"`
-	Port            int           `mapstructure:"port"`
-	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
-	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
-	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	Host            string        `mapstructure:"host" desc:"Address the HTTP server binds to"`
+	Port            int           `mapstructure:"port" desc:"Port the HTTP server listens on"`
+	ReadTimeout     time.Duration `mapstructure:"read_timeout" desc:"Maximum duration for reading a request"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout" desc:"Maximum duration for writing a response"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" desc:"Time allowed for in-flight requests on shutdown"`
+	BasePath        string        `mapstructure:"base_path" desc:"URL path Nebula is served under behind a reverse proxy, e.g. /nebula"`
+	TrustedProxies  []string      `mapstructure:"trusted_proxies" desc:"Addresses or CIDR ranges of reverse proxies whose X-Forwarded-For headers give the client address, none by default"`
+	TLS             TLSConfig     `mapstructure:"tls"`
+}
+
+// TLSConfig holds the HTTPS settings of the server
+type TLSConfig struct {
+	Enabled       bool     `mapstructure:"enabled" desc:"Serve HTTPS on server.port"`
+	CertFile      string   `mapstructure:"cert_file" desc:"PEM certificate chain, reloaded when the file changes"`
+	KeyFile       string   `mapstructure:"key_file" desc:"PEM private key of the certificate"`
+	Autocert      bool     `mapstructure:"autocert" desc:"Obtain and renew certificates with ACME, e.g. from Let's Encrypt, instead of cert_file and key_file"`
+	Domains       []string `mapstructure:"domains" desc:"Hostnames autocert requests certificates for"`
+	Email         string   `mapstructure:"email" desc:"Contact address of the ACME account"`
+	CacheDir      string   `mapstructure:"cache_dir" desc:"Directory autocert keeps the account and certificates in"`
+	ACMEDirectory string   `mapstructure:"acme_directory" desc:"ACME directory URL, Let's Encrypt when empty"`
+	HTTPPort      int      `mapstructure:"http_port" desc:"Port of the plain HTTP listener redirecting to HTTPS and answering ACME challenges, 0 to disable"`
 }
 
 // StorageConfig holds storage configuration
 type StorageConfig struct {
-	Path             string        `mapstructure:"path"`
-	MetricsRetention time.Duration `mapstructure:"metrics_retention"`
-	AuditRetention   time.Duration `mapstructure:"audit_retention"`
+	Path                 string        `mapstructure:"path" desc:"Database file path"`
+	MetricsRetention     time.Duration `mapstructure:"metrics_retention" desc:"How long metrics history is kept"`
+	Metrics1mRetention   time.Duration `mapstructure:"metrics_1m_retention" desc:"How long 1-minute metrics averages are kept"`
+	Metrics5mRetention   time.Duration `mapstructure:"metrics_5m_retention" desc:"How long 5-minute metrics averages are kept"`
+	AuditRetention       time.Duration `mapstructure:"audit_retention" desc:"How long audit log entries are kept"`
+	RetentionInterval    time.Duration `mapstructure:"retention_interval" desc:"How often expired entries are purged"`
+	MetricsBatchSize     int           `mapstructure:"metrics_batch_size" desc:"Metrics samples written per transaction"`
+	MetricsFlushInterval time.Duration `mapstructure:"metrics_flush_interval" desc:"Maximum delay before queued metrics are written, 0 writes immediately"`
+	HealthCheckInterval  time.Duration `mapstructure:"health_check_interval" desc:"How often the database integrity is checked, 0 only at startup"`
+	BackupDir            string        `mapstructure:"backup_dir" desc:"Directory for scheduled backups, empty disables them"`
+	BackupInterval       time.Duration `mapstructure:"backup_interval" desc:"Time between scheduled backups"`
+	BackupKeep           int           `mapstructure:"backup_keep" desc:"Number of backups kept, 0 keeps all"`
 }
 
 // AuthConfig holds authentication configuration
 type AuthConfig struct {
-	Enabled  bool   `mapstructure:"enabled"`
-	Username string `mapstructure:"username"`
-	Password string `mapstructure:"password"`
+	Enabled        bool           `mapstructure:"enabled" hot:"true" desc:"Require HTTP basic authentication for the API"`
+	Username       string         `mapstructure:"username" hot:"true" desc:"Username for basic authentication"`
+	Password       string         `mapstructure:"password" hot:"true" secret:"true" desc:"Password for basic authentication, plaintext or a bcrypt or argon2id hash from nebula hash-password, accepts env:, file: and vault: references"`
+	PasswordFile   string         `mapstructure:"password_file" hot:"true" desc:"File containing the password, overrides password"`
+	SessionTTL     time.Duration  `mapstructure:"session_ttl" hot:"true" desc:"Lifetime of the sessions created by POST /api/v1/auth/sessions"`
+	CredentialsTTL time.Duration  `mapstructure:"credentials_ttl" hot:"true" desc:"How long saved sudo credentials are kept after being set or extended, 0 keeps them until cleared"`
+	Escalation     string         `mapstructure:"escalation" hot:"true" desc:"How privileged commands escalate when not running as root: sudo with the saved password, or pkexec asking the polkit agent of the desktop session, Linux only"`
+	SudoMode       bool           `mapstructure:"sudo_mode" hot:"true" desc:"Never store the sudo password, privileged requests send it in X-Sudo-Password or an X-Sudo-Token from POST /api/v1/auth/elevate"`
+	ElevationTTL   time.Duration  `mapstructure:"elevation_ttl" hot:"true" desc:"Lifetime of the elevation tokens of POST /api/v1/auth/elevate"`
+	OIDC           OIDCConfig     `mapstructure:"oidc"`
+	PAM            PAMConfig      `mapstructure:"pam"`
+	Lockout        LockoutConfig  `mapstructure:"lockout"`
+	WebAuthn       WebAuthnConfig `mapstructure:"webauthn"`
+}
+
+// WebAuthnConfig holds the passkeys users can log in with
+type WebAuthnConfig struct {
+	Enabled bool     `mapstructure:"enabled" hot:"true" desc:"Allow registering passkeys and logging in with them at /api/v1/auth/passkeys/login"`
+	RPID    string   `mapstructure:"rp_id" hot:"true" desc:"Domain passkeys are bound to, e.g. nebula.example.com, changing it invalidates them"`
+	RPName  string   `mapstructure:"rp_name" hot:"true" desc:"Name of the site shown by authenticators"`
+	Origins []string `mapstructure:"origins" hot:"true" desc:"URLs the panel is opened at, e.g. https://nebula.example.com:8080"`
+}
+
+// LockoutConfig holds the lockout of clients failing to log in
+type LockoutConfig struct {
+	Enabled     bool          `mapstructure:"enabled" hot:"true" desc:"Lock out IP addresses and usernames after repeated failed logins"`
+	MaxFailures int           `mapstructure:"max_failures" hot:"true" desc:"Failed logins before the lockout"`
+	BaseDelay   time.Duration `mapstructure:"base_delay" hot:"true" desc:"First lockout, doubled by every further failure"`
+	MaxDelay    time.Duration `mapstructure:"max_delay" hot:"true" desc:"Longest lockout"`
+	Window      time.Duration `mapstructure:"window" hot:"true" desc:"Failures are forgotten this long after the last one or the end of the lockout"`
+}
+
+// PAMConfig holds the authentication of system accounts through PAM
+type PAMConfig struct {
+	Enabled bool   `mapstructure:"enabled" hot:"true" desc:"Authenticate with the system accounts through PAM instead of username and password, Linux only"`
+	Service string `mapstructure:"service" hot:"true" desc:"PAM service checking the passwords, a file in /etc/pam.d"`
+	Group   string `mapstructure:"group" hot:"true" desc:"Only members of this group may log in, e.g. wheel, any account when empty"`
+}
+
+// OIDCConfig holds the OpenID Connect provider users can log in with
+type OIDCConfig struct {
+	Enabled       bool     `mapstructure:"enabled" hot:"true" desc:"Allow logging in through an OpenID Connect provider at /api/v1/auth/oidc/login"`
+	Issuer        string   `mapstructure:"issuer" hot:"true" desc:"Issuer URL of the provider, e.g. https://keycloak.example.com/realms/main"`
+	ClientID      string   `mapstructure:"client_id" hot:"true" desc:"Client ID registered with the provider"`
+	ClientSecret  string   `mapstructure:"client_secret" hot:"true" secret:"true" desc:"Client secret registered with the provider, accepts env:, file: and vault: references"`
+	RedirectURL   string   `mapstructure:"redirect_url" hot:"true" desc:"URL of /api/v1/auth/oidc/callback as registered with the provider"`
+	Scopes        []string `mapstructure:"scopes" hot:"true" desc:"Scopes requested from the provider"`
+	UsernameClaim string   `mapstructure:"username_claim" hot:"true" desc:"ID token claim used as the username, the verified email and then oidc:<sub> are tried when it is missing"`
+	GroupsClaim   string   `mapstructure:"groups_claim" hot:"true" desc:"ID token claim listing the groups of the user"`
+	AdminGroups   []string `mapstructure:"admin_groups" hot:"true" desc:"Groups granted the admin role, with full access"`
+	ViewerGroups  []string `mapstructure:"viewer_groups" hot:"true" desc:"Groups granted the viewer role, with read-only access"`
+}
+
+// RateLimitConfig holds API rate limiting configuration
+type RateLimitConfig struct {
+	Enabled bool             `mapstructure:"enabled" hot:"true" desc:"Limit the API request rate of each user, cluster token, or IP address for anonymous requests"`
+	Rate    float64          `mapstructure:"rate" hot:"true" desc:"Requests per second allowed to each client, 0 for no limit"`
+	Burst   int              `mapstructure:"burst" hot:"true" desc:"Requests a client can make at once before the rate applies"`
+	Routes  []RateLimitRoute `mapstructure:"routes" hot:"true" desc:"Limits for path prefixes overriding the default, the longest matching prefix applies"`
+	IPRate  float64          `mapstructure:"ip_rate" hot:"true" desc:"Requests per second allowed to each IP address before authentication, 0 for no limit"`
+	IPBurst int              `mapstructure:"ip_burst" hot:"true" desc:"Requests an IP address can make at once before ip_rate applies"`
+}
+
+// RateLimitRoute holds the limit of the requests under a path prefix
+type RateLimitRoute struct {
+	Prefix string `mapstructure:"prefix"`
+	// Methods restricts the limit to these methods, all methods when empty
+	Methods []string `mapstructure:"methods"`
+	Rate    float64  `mapstructure:"rate"`
+	Burst   int      `mapstructure:"burst"`
 }
 
 // MetricsConfig holds metrics configuration
 type MetricsConfig struct {
-	Interval    time.Duration `mapstructure:"interval"`
-	HistorySize int           `mapstructure:"history_size"`
+	Interval     time.Duration `mapstructure:"interval" hot:"true" desc:"Interval between metrics samples"`
+	HistorySize  int           `mapstructure:"history_size" hot:"true" desc:"Number of samples kept in memory"`
+	TopProcesses int           `mapstructure:"top_processes" hot:"true" desc:"Processes using the most CPU and memory listed in each sample, 0 disables"`
 }
 
 // TerminalConfig holds terminal configuration
 type TerminalConfig struct {
-	DefaultShell  string   `mapstructure:"default_shell"`
-	AllowedShells []string `mapstructure:"allowed_shells"`
-	MaxSessions   int      `mapstructure:"max_sessions"`
+	DefaultShell       string   `mapstructure:"default_shell" hot:"true" desc:"Shell used when the client does not choose one"`
+	AllowedShells      []string `mapstructure:"allowed_shells" hot:"true" desc:"Shells clients may start"`
+	MaxSessions        int      `mapstructure:"max_sessions" hot:"true" desc:"Maximum number of concurrent terminal sessions"`
+	MaxSessionsPerUser int      `mapstructure:"max_sessions_per_user" hot:"true" desc:"Maximum number of concurrent terminal sessions per user"`
+	DefaultCols        int      `mapstructure:"default_cols" hot:"true" desc:"Terminal width used when the client does not send one"`
+	DefaultRows        int      `mapstructure:"default_rows" hot:"true" desc:"Terminal height used when the client does not send one"`
+	MaxCols            int      `mapstructure:"max_cols" hot:"true" desc:"Maximum terminal width"`
+	MaxRows            int      `mapstructure:"max_rows" hot:"true" desc:"Maximum terminal height"`
+	AllowedEnv         []string `mapstructure:"allowed_env" hot:"true" desc:"Environment variables clients may set"`
+	AllowCommand       bool     `mapstructure:"allow_command" hot:"true" desc:"Allow clients to pass a startup command"`
+	AllowMultiplexer   bool     `mapstructure:"allow_multiplexer" hot:"true" desc:"Allow attaching to host tmux/screen sessions"`
+	SerialDevices      []string `mapstructure:"serial_devices" hot:"true" desc:"Glob patterns of serial devices console sessions may open"`
+
+	ScrollbackSize    int           `mapstructure:"scrollback_size" hot:"true" desc:"Output kept per session for reattaching clients, in bytes"`
+	MaxScrollbackSize int           `mapstructure:"max_scrollback_size" hot:"true" desc:"Maximum scrollback size a client may request, in bytes"`
+	DetachTimeout     time.Duration `mapstructure:"detach_timeout" hot:"true" desc:"How long sessions without clients are kept alive"`
 }
 
 // FilesConfig holds file manager configuration
 type FilesConfig struct {
-	RootPath          string   `mapstructure:"root_path"`
-	MaxUploadSize     int64    `mapstructure:"max_upload_size"`
-	AllowedExtensions []string `mapstructure:"allowed_extensions"`
+	RootPath          string         `mapstructure:"root_path" hot:"true" desc:"Root directory of the file manager"`
+	MaxUploadSize     int64          `mapstructure:"max_upload_size" hot:"true" desc:"Maximum upload size in bytes"`
+	AllowedExtensions []string       `mapstructure:"allowed_extensions" hot:"true" desc:"File extensions allowed for upload, empty allows all"`
+	UploadDir         string         `mapstructure:"upload_dir" hot:"true" desc:"Directory resumable uploads are staged in until complete, empty uses the system temporary directory"`
+	UploadExpiry      time.Duration  `mapstructure:"upload_expiry" hot:"true" desc:"How long unfinished resumable uploads are kept after their last chunk"`
+	MinFreeSpace      int64          `mapstructure:"min_free_space" hot:"true" desc:"Disk space in bytes uploads and writes must leave free, 0 disables the check"`
+	Roots             []RootConfig   `mapstructure:"roots" hot:"true" desc:"Named directories managed beside root_path, with their own permissions"`
+	Remotes           []RemoteConfig `mapstructure:"remotes" hot:"true" secret:"true" desc:"Remote hosts whose files are managed over SFTP"`
+}
+
+// RootConfig holds the configuration of a named root directory
+type RootConfig struct {
+	Name     string `mapstructure:"name"`
+	Path     string `mapstructure:"path"`
+	ReadOnly bool   `mapstructure:"read_only"`
+	// Quota is the most bytes the files of the root may take, 0 for no limit
+	Quota int64 `mapstructure:"quota"`
+	// Users are the users allowed to use the root, everyone when empty
+	Users []string `mapstructure:"users"`
+}
+
+// RemoteConfig holds the configuration of a remote host reached over SFTP
+type RemoteConfig struct {
+	Name string `mapstructure:"name"`
+	// Address is host or host:port, port 22 when missing
+	Address  string `mapstructure:"address"`
+	User     string `mapstructure:"user"`
+	Password string `mapstructure:"password" secret:"true"`
+	KeyFile  string `mapstructure:"key_file"`
+	// HostKey is the public key of the host as in authorized_keys, the
+	// host is looked up in KnownHosts when empty
+	HostKey    string `mapstructure:"host_key"`
+	KnownHosts string `mapstructure:"known_hosts"`
+	RootPath   string `mapstructure:"root_path"`
 }
 
 // PackagesConfig holds packages configuration
 type PackagesConfig struct {
-	AutoDetect bool `mapstructure:"auto_detect"`
+	AutoDetect bool `mapstructure:"auto_detect" desc:"Detect the system package manager automatically"`
+}
+
+// ContainersConfig holds Docker and Podman configuration
+type ContainersConfig struct {
+	Host string `mapstructure:"host" desc:"Docker or Podman API: unix:///path/to.sock or tcp://host:port, empty uses DOCKER_HOST or the first socket found"`
+}
+
+// CertificatesConfig holds TLS certificate inventory configuration
+type CertificatesConfig struct {
+	Paths          []string      `mapstructure:"paths" hot:"true" desc:"Files and directories scanned for PEM certificates"`
+	WarnDays       int           `mapstructure:"warn_days" hot:"true" desc:"Days before expiry a certificate is reported as expiring"`
+	ScanInterval   time.Duration `mapstructure:"scan_interval" desc:"Time between certificate scans"`
+	UploadDir      string        `mapstructure:"upload_dir" hot:"true" desc:"Directory uploaded certificate and key pairs are written to"`
+	ReloadServices []string      `mapstructure:"reload_services" hot:"true" desc:"Services that may be reloaded after a certificate change, nebula reloads the configuration"`
+}
+
+// SchedulerConfig holds task scheduler configuration
+type SchedulerConfig struct {
+	Enabled          bool          `mapstructure:"enabled" desc:"Run scheduled tasks"`
+	MaxConcurrent    int           `mapstructure:"max_concurrent" hot:"true" desc:"Tasks running at once, further due tasks are skipped, 0 for no limit"`
+	MaxOutput        int           `mapstructure:"max_output" hot:"true" desc:"Output bytes kept per task run"`
+	HistoryRetention time.Duration `mapstructure:"history_retention" desc:"How long task run history is kept"`
+}
+
+// NotifyConfig holds notification configuration. Further channels and
+// rules are managed through the API.
+type NotifyConfig struct {
+	HistoryRetention time.Duration     `mapstructure:"history_retention" desc:"How long notification delivery history is kept"`
+	Email            EmailNotifyConfig `mapstructure:"email"`
+}
+
+// EmailNotifyConfig holds the email notifications set in the configuration
+// file, sent through the config-email channel and rule
+type EmailNotifyConfig struct {
+	Enabled     bool     `mapstructure:"enabled" hot:"true" desc:"Email the events matching events to the administrators"`
+	SMTPHost    string   `mapstructure:"smtp_host" hot:"true" desc:"SMTP server"`
+	SMTPPort    int      `mapstructure:"smtp_port" hot:"true" desc:"SMTP port, 465 uses TLS, others STARTTLS when offered"`
+	Username    string   `mapstructure:"username" hot:"true" desc:"SMTP username, empty to send without authentication"`
+	Password    string   `mapstructure:"password" hot:"true" secret:"true" desc:"SMTP password, accepts env:, file: and vault: references"`
+	From        string   `mapstructure:"from" hot:"true" desc:"Sender address"`
+	To          []string `mapstructure:"to" hot:"true" desc:"Administrator addresses"`
+	Events      []string `mapstructure:"events" hot:"true" desc:"Patterns of the event types emailed, e.g. certificate.* or *"`
+	MinSeverity string   `mapstructure:"min_severity" hot:"true" desc:"Least severity emailed: info, warning or critical"`
 }
 
 // UpdaterConfig holds updater configuration
 type UpdaterConfig struct {
-	Enabled       bool          `mapstructure:"enabled"`
-	CheckInterval time.Duration `mapstructure:"check_interval"`
+	Enabled       bool          `mapstructure:"enabled" hot:"true" desc:"Check for new releases"`
+	CheckInterval time.Duration `mapstructure:"check_interval" hot:"true" desc:"Time between update checks"`
+	Channel       string        `mapstructure:"channel" hot:"true" desc:"Release channel to follow: stable, beta or nightly"`
+	AutoApply     bool          `mapstructure:"auto_apply" hot:"true" desc:"Install available updates automatically and restart"`
+	// MaintenanceWindow is parsed by updater.ParseWindow
+	MaintenanceWindow string `mapstructure:"maintenance_window" hot:"true" desc:"Local time window for automatic updates, e.g. 02:00-04:00 or sat,sun 02:00-04:00, empty allows any time"`
+	Proxy             string `mapstructure:"proxy" hot:"true" desc:"Proxy URL for update requests (http, https or socks5), empty uses HTTPS_PROXY"`
+	GitHubToken       string `mapstructure:"github_token" hot:"true" secret:"true" desc:"GitHub token for update requests, accepts env:, file: and vault: references"`
+	ManifestURL       string `mapstructure:"manifest_url" hot:"true" desc:"URL of an update manifest used instead of GitHub releases, for internal mirrors"`
+	KeepVersions      int    `mapstructure:"keep_versions" hot:"true" desc:"Replaced binaries kept for rollbacks, 0 keeps none"`
+}
+
+// WebSocketConfig holds WebSocket configuration
+type WebSocketConfig struct {
+	Compression      bool `mapstructure:"compression" hot:"true" desc:"Negotiate permessage-deflate compression with clients that support it"`
+	CompressionLevel int  `mapstructure:"compression_level" hot:"true" desc:"Deflate level from -2 (Huffman only) to 9 (best compression)"`
+	ResumeBuffer     int  `mapstructure:"resume_buffer" desc:"Messages kept for replaying to reconnecting clients, 0 disables resuming"`
+	// SendBuffer, SlowClientPolicy and Coalesce apply to clients connecting after a change
+	SendBuffer       int      `mapstructure:"send_buffer" hot:"true" desc:"Messages queued per client before the slow client policy applies"`
+	SlowClientPolicy string   `mapstructure:"slow_client_policy" hot:"true" desc:"What happens when a client queue is full: drop-oldest or disconnect"`
+	Coalesce         bool     `mapstructure:"coalesce" hot:"true" desc:"Replace queued metrics and update messages with newer ones instead of queueing both"`
+	AllowedOrigins   []string `mapstructure:"allowed_origins" hot:"true" desc:"Origins such as https://nebula.example.com whose pages may open WebSockets besides the host requested, e.g. the public address of a proxy rewriting Host"`
+}
+
+// EventsConfig holds event delivery configuration
+type EventsConfig struct {
+	Webhooks []WebhookConfig `mapstructure:"webhooks" secret:"true" desc:"Endpoints receiving events as JSON POST requests"`
+}
+
+// WebhookConfig holds the configuration of a single webhook
+type WebhookConfig struct {
+	URL string `mapstructure:"url"`
+	// Topics filters the events sent, every topic except metrics when empty
+	Topics []string `mapstructure:"topics"`
+	Secret string   `mapstructure:"secret" secret:"true"`
+}
+
+// ClusterConfig holds multi-host configuration
+type ClusterConfig struct {
+	Mode              string        `mapstructure:"mode" desc:"standalone, agent (registers with a controller) or controller (manages agents)"`
+	Token             string        `mapstructure:"token" secret:"true" desc:"Token shared by the controller and its agents, accepts env:, file: and vault: references"`
+	ControllerURL     string        `mapstructure:"controller_url" desc:"URL of the controller an agent registers with"`
+	Name              string        `mapstructure:"name" desc:"Name an agent registers as, the hostname when empty"`
+	AdvertiseURL      string        `mapstructure:"advertise_url" desc:"URL the controller reaches an agent at"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval" desc:"How often an agent registers again with the controller"`
+	HostTimeout       time.Duration `mapstructure:"host_timeout" desc:"How long the controller waits for a heartbeat before reporting a host offline"`
 }
 
 // LoggingConfig holds logging configuration
 type LoggingConfig struct {
-	Level  string `mapstructure:"level"`
-	Format string `mapstructure:"format"`
+	Level  string `mapstructure:"level" desc:"Log level: debug, info, warn or error" hot:"true"`
+	Format string `mapstructure:"format" desc:"Log format: json or text" hot:"true"`
 }
 
 // Manager manages configuration with hot reload support
 type Manager struct {
+	path    string
+	profile string
 	config  *Config
 	storage *storage.Storage
 	viper   *viper.Viper
 	mu      sync.RWMutex
 
 	onReload []func(*Config)
+	patchMu  sync.Mutex
 }
 
-// NewManager creates a new configuration manager
-func NewManager(configPath string, store *storage.Storage) (*Manager, error) {
+// NewManager creates a new configuration manager. When profile is not empty
+// the profile overlay (e.g. config.prod.yaml) is merged on top of configPath.
+func NewManager(configPath, profile string, store *storage.Storage) (*Manager, error) {
 	v := viper.New()
 	v.SetConfigFile(configPath)
-	v.SetConfigType("yaml")
+	v.SetConfigType(configType(configPath))
 
 	// Set defaults
 	setDefaults(v)
 
-	// Read config file
-	if err := v.ReadInConfig(); err != nil {
-		return nil, fmt.Errorf("failed to read config: %w", err)
-	}
-
 	m := &Manager{
-		config:  &Config{},
+		path:    configPath,
+		profile: profile,
 		storage: store,
 		viper:   v,
 	}
 
-	// Unmarshal config
-	if err := v.Unmarshal(m.config); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	// Read config file, its includes and the profile overlay
+	if err := m.readConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
 	}
 
-	// Apply overrides from storage
-	m.applyStorageOverrides()
+	// Unmarshal config with the overrides from storage applied
+	config, err := m.build(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	m.config = config
 
 	// Watch for config changes
 	v.WatchConfig()
 	v.OnConfigChange(func(e fsnotify.Event) {
-		m.reload()
+		// Viper re-read the main file only, merge the includes and the profile again
+		if err := m.mergeOverlays(); err != nil {
+			log.Printf("Config reload failed: %v", err)
+			return
+		}
+		m.reload(SourceFile, "system")
 	})
 
 	return m, nil
@@ -138,37 +383,173 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("server.read_timeout", "10s")
 	v.SetDefault("server.write_timeout", "10s")
 	v.SetDefault("server.shutdown_timeout", "30s")
+	v.SetDefault("server.base_path", "")
+	v.SetDefault("server.trusted_proxies", []string{})
+	v.SetDefault("server.tls.enabled", false)
+	v.SetDefault("server.tls.cert_file", "")
+	v.SetDefault("server.tls.key_file", "")
+	v.SetDefault("server.tls.autocert", false)
+	v.SetDefault("server.tls.domains", []string{})
+	v.SetDefault("server.tls.email", "")
+	v.SetDefault("server.tls.cache_dir", "certs")
+	v.SetDefault("server.tls.acme_directory", "")
+	v.SetDefault("server.tls.http_port", 0)
 
 	// Storage defaults
 	v.SetDefault("storage.path", "./nebula.db")
 	v.SetDefault("storage.metrics_retention", "1h")
+	v.SetDefault("storage.metrics_1m_retention", "24h")
+	v.SetDefault("storage.metrics_5m_retention", "720h")
 	v.SetDefault("storage.audit_retention", "168h")
+	v.SetDefault("storage.retention_interval", "10m")
+	v.SetDefault("storage.metrics_batch_size", 30)
+	v.SetDefault("storage.metrics_flush_interval", "30s")
+	v.SetDefault("storage.health_check_interval", "1h")
+	v.SetDefault("storage.backup_dir", "")
+	v.SetDefault("storage.backup_interval", "24h")
+	v.SetDefault("storage.backup_keep", 7)
 
 	// Auth defaults
 	v.SetDefault("auth.enabled", false)
 	v.SetDefault("auth.username", "admin")
 	v.SetDefault("auth.password", "changeme")
+	v.SetDefault("auth.password_file", "")
+	v.SetDefault("auth.session_ttl", "12h")
+	v.SetDefault("auth.credentials_ttl", "8h")
+	v.SetDefault("auth.escalation", "sudo")
+	v.SetDefault("auth.sudo_mode", false)
+	v.SetDefault("auth.elevation_ttl", "5m")
+	v.SetDefault("auth.pam.enabled", false)
+	v.SetDefault("auth.pam.service", "login")
+	v.SetDefault("auth.pam.group", "")
+	v.SetDefault("auth.lockout.enabled", true)
+	v.SetDefault("auth.lockout.max_failures", 5)
+	v.SetDefault("auth.lockout.base_delay", "30s")
+	v.SetDefault("auth.lockout.max_delay", "1h")
+	v.SetDefault("auth.lockout.window", "15m")
+	v.SetDefault("auth.webauthn.enabled", false)
+	v.SetDefault("auth.webauthn.rp_id", "")
+	v.SetDefault("auth.webauthn.rp_name", "Nebula")
+	v.SetDefault("auth.webauthn.origins", []string{})
+	v.SetDefault("auth.oidc.enabled", false)
+	v.SetDefault("auth.oidc.issuer", "")
+	v.SetDefault("auth.oidc.client_id", "")
+	v.SetDefault("auth.oidc.client_secret", "")
+	v.SetDefault("auth.oidc.redirect_url", "")
+	v.SetDefault("auth.oidc.scopes", []string{"openid", "profile", "email"})
+	v.SetDefault("auth.oidc.username_claim", "preferred_username")
+	v.SetDefault("auth.oidc.groups_claim", "groups")
+	v.SetDefault("auth.oidc.admin_groups", []string{})
+	v.SetDefault("auth.oidc.viewer_groups", []string{})
+
+	// Rate limit defaults, generous for polling and strict for package changes
+	v.SetDefault("rate_limit.enabled", true)
+	v.SetDefault("rate_limit.rate", 20)
+	v.SetDefault("rate_limit.burst", 100)
+	v.SetDefault("rate_limit.routes", []map[string]interface{}{
+		{"prefix": "/api/v1/metrics", "rate": 50, "burst": 200},
+		{"prefix": "/api/v1/packages", "methods": []string{"POST", "DELETE"}, "rate": 0.1, "burst": 5},
+		{"prefix": "/api/v2/metrics", "rate": 50, "burst": 200},
+		{"prefix": "/api/v2/packages", "methods": []string{"PUT", "POST", "DELETE"}, "rate": 0.1, "burst": 5},
+		{"prefix": "/api/v1/auth", "methods": []string{"POST", "DELETE"}, "rate": 0.2, "burst": 5},
+	})
+	v.SetDefault("rate_limit.ip_rate", 50)
+	v.SetDefault("rate_limit.ip_burst", 200)
 
 	// Metrics defaults
 	v.SetDefault("metrics.interval", "1s")
 	v.SetDefault("metrics.history_size", 60)
+	v.SetDefault("metrics.top_processes", 5)
 
 	// Terminal defaults
 	v.SetDefault("terminal.default_shell", "")
 	v.SetDefault("terminal.allowed_shells", []string{"bash", "zsh", "sh", "ksh", "cmd", "powershell"})
 	v.SetDefault("terminal.max_sessions", 10)
+	v.SetDefault("terminal.max_sessions_per_user", 5)
+	v.SetDefault("terminal.default_cols", 80)
+	v.SetDefault("terminal.default_rows", 24)
+	v.SetDefault("terminal.max_cols", 500)
+	v.SetDefault("terminal.max_rows", 200)
+	v.SetDefault("terminal.allowed_env", []string{"LANG", "LC_ALL", "COLORTERM"})
+	v.SetDefault("terminal.allow_command", false)
+	v.SetDefault("terminal.allow_multiplexer", true)
+	v.SetDefault("terminal.serial_devices", []string{"/dev/ttyUSB*", "/dev/ttyACM*", "/dev/ttyS*"})
+	v.SetDefault("terminal.scrollback_size", 65536)
+	v.SetDefault("terminal.max_scrollback_size", 1048576)
+	v.SetDefault("terminal.detach_timeout", "0s")
 
 	// Files defaults
 	v.SetDefault("files.root_path", "/")
 	v.SetDefault("files.max_upload_size", 104857600) // 100MB
 	v.SetDefault("files.allowed_extensions", []string{})
+	v.SetDefault("files.upload_dir", "")
+	v.SetDefault("files.upload_expiry", "24h")
+	v.SetDefault("files.min_free_space", 0)
+	v.SetDefault("files.roots", []map[string]interface{}{})
+	v.SetDefault("files.remotes", []map[string]interface{}{})
 
 	// Packages defaults
 	v.SetDefault("packages.auto_detect", true)
 
+	// Containers defaults
+	v.SetDefault("containers.host", "")
+
+	// Certificates defaults
+	v.SetDefault("certificates.paths", []string{"/etc/letsencrypt/live", "/etc/nginx/ssl", "/etc/nebula/certs"})
+	v.SetDefault("certificates.warn_days", 30)
+	v.SetDefault("certificates.scan_interval", "6h")
+	v.SetDefault("certificates.upload_dir", "/etc/nebula/certs")
+	v.SetDefault("certificates.reload_services", []string{"nginx", "nebula"})
+
+	// Scheduler defaults
+	v.SetDefault("scheduler.enabled", true)
+	v.SetDefault("scheduler.max_concurrent", 4)
+	v.SetDefault("scheduler.max_output", 65536)
+	v.SetDefault("scheduler.history_retention", "720h")
+
+	// Notification defaults
+	v.SetDefault("notifications.history_retention", "720h")
+	v.SetDefault("notifications.email.enabled", false)
+	v.SetDefault("notifications.email.smtp_host", "")
+	v.SetDefault("notifications.email.smtp_port", 587)
+	v.SetDefault("notifications.email.username", "")
+	v.SetDefault("notifications.email.password", "")
+	v.SetDefault("notifications.email.from", "")
+	v.SetDefault("notifications.email.to", []string{})
+	v.SetDefault("notifications.email.events", []string{"certificate.*", "service.failed", "service.recovered", "update.available", "update.failed", "privilege.failed"})
+	v.SetDefault("notifications.email.min_severity", "info")
+
 	// Updater defaults
 	v.SetDefault("updater.enabled", true)
 	v.SetDefault("updater.check_interval", "24h")
+	v.SetDefault("updater.channel", "stable")
+	v.SetDefault("updater.auto_apply", false)
+	v.SetDefault("updater.maintenance_window", "")
+	v.SetDefault("updater.proxy", "")
+	v.SetDefault("updater.github_token", "")
+	v.SetDefault("updater.manifest_url", "")
+	v.SetDefault("updater.keep_versions", 2)
+
+	// WebSocket defaults
+	v.SetDefault("websocket.compression", true)
+	v.SetDefault("websocket.compression_level", 1)
+	v.SetDefault("websocket.resume_buffer", 1024)
+	v.SetDefault("websocket.send_buffer", 256)
+	v.SetDefault("websocket.slow_client_policy", "drop-oldest")
+	v.SetDefault("websocket.coalesce", true)
+	v.SetDefault("websocket.allowed_origins", []string{})
+
+	// Events defaults
+	v.SetDefault("events.webhooks", []map[string]interface{}{})
+
+	// Cluster defaults
+	v.SetDefault("cluster.mode", "standalone")
+	v.SetDefault("cluster.token", "")
+	v.SetDefault("cluster.controller_url", "")
+	v.SetDefault("cluster.name", "")
+	v.SetDefault("cluster.advertise_url", "")
+	v.SetDefault("cluster.heartbeat_interval", "30s")
+	v.SetDefault("cluster.host_timeout", "90s")
 
 	// Logging defaults
 	v.SetDefault("logging.level", "info")
@@ -182,18 +563,20 @@ func (m *Manager) Get() *Config {
 	return m.config
 }
 
-// reload reloads the configuration
-func (m *Manager) reload() {
+// reload reloads the configuration, recording what changed and who changed it
+func (m *Manager) reload(source, user string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	newConfig := &Config{}
-	if err := m.viper.Unmarshal(newConfig); err != nil {
+	newConfig, err := m.build(nil)
+	if err != nil {
+		// Keep running with the last valid configuration
+		log.Printf("Config reload failed: %v", err)
 		return
 	}
 
+	m.recordChange(source, user, m.config, newConfig)
 	m.config = newConfig
-	m.applyStorageOverrides()
 
 	// Notify listeners
 	for _, fn := range m.onReload {
@@ -201,15 +584,20 @@ func (m *Manager) reload() {
 	}
 }
 
-// Reload forces a configuration reload
-func (m *Manager) Reload() error {
-	if err := m.viper.ReadInConfig(); err != nil {
+// Reload forces a configuration reload on behalf of user
+func (m *Manager) Reload(user string) error {
+	if err := m.readConfig(); err != nil {
 		return err
 	}
-	m.reload()
+	m.reload(SourceReload, user)
 	return nil
 }
 
+// Profile returns the name of the active config profile, empty when none is selected
+func (m *Manager) Profile() string {
+	return m.profile
+}
+
 // OnReload registers a callback for configuration changes
 func (m *Manager) OnReload(fn func(*Config)) {
 	m.mu.Lock()
@@ -217,25 +605,191 @@ func (m *Manager) OnReload(fn func(*Config)) {
 	m.onReload = append(m.onReload, fn)
 }
 
-// applyStorageOverrides applies configuration overrides from storage
-func (m *Manager) applyStorageOverrides() {
+// build merges defaults, the config file and the overrides from storage into
+// a validated Config. Pending overrides are applied on top, a nil value
+// removes the stored override of that key.
+func (m *Manager) build(pending map[string]interface{}) (*Config, error) {
+	merged := viper.New()
+	if err := merged.MergeConfigMap(m.viper.AllSettings()); err != nil {
+		return nil, err
+	}
+
+	overrides := m.storedOverrides()
+	for key, value := range pending {
+		if value == nil {
+			delete(overrides, key)
+		} else {
+			overrides[key] = value
+		}
+	}
+	for key, value := range overrides {
+		merged.Set(key, value)
+	}
+
+	config := &Config{}
+	if err := merged.Unmarshal(config); err != nil {
+		return nil, err
+	}
+	if err := resolveSecrets(config); err != nil {
+		return nil, err
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// storedOverrides returns the configuration overrides kept in storage
+func (m *Manager) storedOverrides() map[string]interface{} {
+	overrides := make(map[string]interface{})
 	if m.storage == nil {
-		return
+		return overrides
 	}
 
-	// Check for port override
-	var port int
-	if err := m.storage.GetJSON(storage.BucketConfig, "server.port", &port); err == nil && port > 0 {
-		m.config.Server.Port = port
+	stored, err := m.storage.GetAll(storage.BucketConfig)
+	if err != nil {
+		return overrides
+	}
+	for key, data := range stored {
+		if _, ok := schema[key]; !ok {
+			continue
+		}
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err == nil && value != nil {
+			overrides[key] = value
+		}
 	}
+	return overrides
+}
+
+// Patch validates and stores configuration overrides on behalf of user, then applies them.
+// Keys use dotted notation (server.port); a nil value removes the override.
+// It returns the changed keys that only take effect after a restart.
+func (m *Manager) Patch(changes map[string]interface{}, user string) ([]string, error) {
+	if m.storage == nil {
+		return nil, fmt.Errorf("storage not available")
+	}
+
+	m.patchMu.Lock()
+	defer m.patchMu.Unlock()
 
-	// Check for auth override
-	var authEnabled bool
-	if err := m.storage.GetJSON(storage.BucketConfig, "auth.enabled", &authEnabled); err == nil {
-		m.config.Auth.Enabled = authEnabled
+	// Validate the resulting configuration before persisting anything
+	if err := m.check(changes); err != nil {
+		return nil, err
 	}
 
-	// Add more overrides as needed
+	var restart []string
+	for key, value := range changes {
+		var err error
+		if value == nil {
+			err = m.storage.Delete(storage.BucketConfig, key)
+		} else {
+			err = m.SetOverride(key, value)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !schema[key].Hot {
+			restart = append(restart, key)
+		}
+	}
+	sort.Strings(restart)
+
+	m.reload(SourceAPI, user)
+	return restart, nil
+}
+
+// MaskOverrides hides the values of secret keys in overrides, as stored in
+// storage, for exports
+func MaskOverrides(overrides map[string]json.RawMessage) {
+	masked, _ := json.Marshal(maskedValue)
+	for key, data := range overrides {
+		if schema[key].Secret && string(data) != `""` && string(data) != "null" {
+			overrides[key] = masked
+		}
+	}
+}
+
+// Import validates imported overrides, as stored in storage, once added to
+// the stored overrides or replacing them, then has write store them and
+// applies the configuration on behalf of user like Patch. Masked secrets
+// are replaced in overrides by the stored values, or left out when there
+// are none. It returns the changed keys that only take effect after a
+// restart.
+func (m *Manager) Import(overrides map[string]json.RawMessage, replace bool, user string, write func() error) ([]string, error) {
+	if m.storage == nil {
+		return nil, fmt.Errorf("storage not available")
+	}
+
+	m.patchMu.Lock()
+	defer m.patchMu.Unlock()
+
+	stored := m.storedOverrides()
+	changes := make(map[string]interface{}, len(overrides))
+	if replace {
+		for key := range stored {
+			changes[key] = nil
+		}
+	}
+	for key, data := range overrides {
+		var value interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, &ValidationError{Problems: []string{fmt.Sprintf("invalid value of %s", key)}}
+		}
+		if schema[key].Secret && value == maskedValue {
+			prev, ok := stored[key]
+			if !ok {
+				delete(overrides, key)
+				continue
+			}
+			data, err := json.Marshal(prev)
+			if err != nil {
+				return nil, err
+			}
+			overrides[key], value = data, prev
+		}
+		changes[key] = value
+	}
+	if err := m.check(changes); err != nil {
+		return nil, err
+	}
+	if err := write(); err != nil {
+		return nil, err
+	}
+
+	var restart []string
+	for key := range changes {
+		if !schema[key].Hot {
+			restart = append(restart, key)
+		}
+	}
+	sort.Strings(restart)
+
+	m.reload(SourceImport, user)
+	return restart, nil
+}
+
+// check validates the configuration pending overrides would give, as a
+// ValidationError
+func (m *Manager) check(changes map[string]interface{}) error {
+	var unknown []string
+	for key := range changes {
+		if _, ok := schema[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return &ValidationError{Problems: []string{"unknown keys: " + strings.Join(unknown, ", ")}}
+	}
+
+	if _, err := m.build(changes); err != nil {
+		if _, ok := err.(*ValidationError); ok {
+			return err
+		}
+		return &ValidationError{Problems: []string{err.Error()}}
+	}
+	return nil
 }
 
 // SetOverride sets a configuration override in storage
@@ -258,3 +812,11 @@ func (m *Manager) GetOverride(key string, value interface{}) error {
 func (c *Config) Address() string {
 	return fmt.Sprintf("%s:%d", c.Server.Host, c.Server.Port)
 }
+
+// URL returns the URL the server is reached at on its bind address
+func (c *Config) URL() string {
+	if c.Server.TLS.Enabled {
+		return "https://" + c.Address()
+	}
+	return "http://" + c.Address()
+}
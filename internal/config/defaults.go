@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// WriteDefault writes a YAML config file holding every key with its default
+// value and description, in the order the keys are declared in Config.
+// overrides replaces the defaults of some keys, by dotted name.
+func WriteDefault(w io.Writer, overrides map[string]interface{}) error {
+	defaults := viper.New()
+	setDefaults(defaults)
+	for key, value := range overrides {
+		defaults.Set(key, value)
+	}
+
+	var b strings.Builder
+	b.WriteString("# Nebula configuration\n")
+	b.WriteString("# Generated with --init-config or nebula install, keys are set to their default value.\n")
+	b.WriteString("# Keys marked (hot) take effect without restarting the server.\n")
+	writeSection(&b, reflect.TypeOf(Config{}), "", 0, defaults)
+
+	b.WriteString("\n# Additional config files (YAML, TOML or JSON) merged on top of this one, in order\n")
+	b.WriteString("# include:\n#   - secrets.yaml\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeSection(b *strings.Builder, t reflect.Type, prefix string, depth int, defaults *viper.Viper) {
+	indent := strings.Repeat("  ", depth)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+			fmt.Fprintf(b, "\n%s%s:\n", indent, name)
+			writeSection(b, sf.Type, key, depth+1, defaults)
+			continue
+		}
+
+		if desc := sf.Tag.Get("desc"); desc != "" {
+			if sf.Tag.Get("hot") == "true" {
+				desc += " (hot)"
+			}
+			fmt.Fprintf(b, "%s# %s\n", indent, desc)
+		}
+		writeValue(b, indent, name, defaults.Get(key))
+	}
+}
+
+// writeValue writes a single key in YAML syntax
+func writeValue(b *strings.Builder, indent, name string, value interface{}) {
+	switch v := value.(type) {
+	case []string:
+		if len(v) == 0 {
+			fmt.Fprintf(b, "%s%s: []\n", indent, name)
+			return
+		}
+		fmt.Fprintf(b, "%s%s:\n", indent, name)
+		for _, item := range v {
+			fmt.Fprintf(b, "%s  - %s\n", indent, strconv.Quote(item))
+		}
+	case []map[string]interface{}:
+		if len(v) == 0 {
+			fmt.Fprintf(b, "%s%s: []\n", indent, name)
+			return
+		}
+		fmt.Fprintf(b, "%s%s:\n", indent, name)
+		for _, item := range v {
+			keys := make([]string, 0, len(item))
+			for key := range item {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for i, key := range keys {
+				prefix := "    "
+				if i == 0 {
+					prefix = "  - "
+				}
+				fmt.Fprintf(b, "%s%s%s: %s\n", indent, prefix, key, flowValue(item[key]))
+			}
+		}
+	case string:
+		if _, err := time.ParseDuration(v); err == nil {
+			fmt.Fprintf(b, "%s%s: %s\n", indent, name, v)
+			return
+		}
+		fmt.Fprintf(b, "%s%s: %s\n", indent, name, strconv.Quote(v))
+	default:
+		fmt.Fprintf(b, "%s%s: %v\n", indent, name, v)
+	}
+}
+
+// flowValue writes a value of a list item in YAML flow syntax
+func flowValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return strconv.Quote(v)
+	case []string:
+		quoted := make([]string, len(v))
+		for i, s := range v {
+			quoted[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprint(v)
+	}
+}
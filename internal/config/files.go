@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// includeKey lists further config files merged on top of the one declaring it
+const includeKey = "include"
+
+// configType returns the format of a config file from its extension, YAML by default
+func configType(path string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), ".")); ext {
+	case "json", "toml", "yaml":
+		return ext
+	default:
+		return "yaml"
+	}
+}
+
+// profileExtensions are tried in order when looking for a profile overlay
+var profileExtensions = []string{".yaml", ".yml", ".toml", ".json"}
+
+// readConfig reads the main config file and merges its includes and the profile overlay
+func (m *Manager) readConfig() error {
+	if err := m.viper.ReadInConfig(); err != nil {
+		return err
+	}
+	return m.mergeOverlays()
+}
+
+// mergeOverlays merges the includes of the main config file, then the
+// overlay of the selected profile so it takes precedence over both
+func (m *Manager) mergeOverlays() error {
+	seen := map[string]bool{filepath.Clean(m.path): true}
+	if err := mergeIncludes(m.viper, m.viper.GetStringSlice(includeKey), filepath.Dir(m.path), seen); err != nil {
+		return err
+	}
+
+	if m.profile == "" {
+		return nil
+	}
+	overlay, err := profilePath(m.path, m.profile)
+	if err != nil {
+		return err
+	}
+	return mergeIncludes(m.viper, []string{overlay}, filepath.Dir(m.path), seen)
+}
+
+// profilePath returns the overlay of a profile, stored next to the main file
+// as <name>.<profile>.<ext>, e.g. config.prod.yaml for config.yaml
+func profilePath(path, profile string) (string, error) {
+	for _, r := range profile {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return "", fmt.Errorf("invalid profile name %q", profile)
+		}
+	}
+
+	base := strings.TrimSuffix(path, filepath.Ext(path)) + "." + profile
+	for _, ext := range profileExtensions {
+		if _, err := os.Stat(base + ext); err == nil {
+			return base + ext, nil
+		}
+	}
+	return "", fmt.Errorf("no config found for profile %s (expected %s.yaml)", profile, base)
+}
+
+// mergeIncludes merges the included files in order, so later files win.
+// Relative paths are resolved against the directory of the including file and
+// may contain glob patterns. Included files may include others in turn.
+func mergeIncludes(v *viper.Viper, includes []string, dir string, seen map[string]bool) error {
+	for _, include := range includes {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(dir, pattern)
+		}
+
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include %s: %w", include, err)
+		}
+		if len(matches) == 0 && !strings.ContainsAny(include, "*?[") {
+			return fmt.Errorf("included config %s not found", include)
+		}
+
+		for _, path := range matches {
+			path = filepath.Clean(path)
+			if seen[path] {
+				return fmt.Errorf("config %s is included more than once", path)
+			}
+			seen[path] = true
+
+			sub := viper.New()
+			sub.SetConfigFile(path)
+			sub.SetConfigType(configType(path))
+			if err := sub.ReadInConfig(); err != nil {
+				return fmt.Errorf("failed to read included config %s: %w", path, err)
+			}
+
+			nested := sub.GetStringSlice(includeKey)
+			settings := sub.AllSettings()
+			delete(settings, includeKey)
+			if err := v.MergeConfigMap(settings); err != nil {
+				return err
+			}
+
+			if err := mergeIncludes(v, nested, filepath.Dir(path), seen); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// Sources of configuration changes recorded in the history
+const (
+	SourceFile   = "file"
+	SourceReload = "reload"
+	SourceAPI    = "api"
+	SourceImport = "import"
+)
+
+// maskedValue replaces secrets in the change history
+const maskedValue = "********"
+
+// History returns the recorded configuration changes, newest first
+func (m *Manager) History(cursor string, limit int) (*storage.ConfigHistoryPage, error) {
+	if m.storage == nil {
+		return &storage.ConfigHistoryPage{Changes: []storage.ConfigChange{}}, nil
+	}
+	return m.storage.GetConfigHistory(cursor, limit)
+}
+
+// recordChange stores the differences between two configurations
+func (m *Manager) recordChange(source, user string, oldConfig, newConfig *Config) {
+	if m.storage == nil || oldConfig == nil {
+		return
+	}
+
+	diff := diffConfigs(oldConfig, newConfig)
+	if len(diff) == 0 {
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	change := storage.ConfigChange{
+		ID:        hex.EncodeToString(id),
+		Timestamp: time.Now(),
+		User:      user,
+		Source:    source,
+		Diff:      diff,
+	}
+	if err := m.storage.AddConfigChange(change); err != nil {
+		log.Printf("Failed to record config change: %v", err)
+	}
+}
+
+// diffConfigs lists the keys whose values differ, with secrets masked
+func diffConfigs(oldConfig, newConfig *Config) []storage.ConfigDiff {
+	oldValues := flatten(oldConfig)
+	newValues := flatten(newConfig)
+
+	var diff []storage.ConfigDiff
+	for key, newValue := range newValues {
+		oldValue := oldValues[key]
+		if reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		if schema[key].Secret {
+			oldValue, newValue = maskedValue, maskedValue
+		}
+		diff = append(diff, storage.ConfigDiff{Key: key, Old: oldValue, New: newValue})
+	}
+
+	sort.Slice(diff, func(i, j int) bool { return diff[i].Key < diff[j].Key })
+	return diff
+}
+
+// flatten maps every configuration key to its value, durations as strings
+func flatten(c *Config) map[string]interface{} {
+	values := make(map[string]interface{})
+	flattenStruct(reflect.ValueOf(c).Elem(), "", values)
+	return values
+}
+
+func flattenStruct(v reflect.Value, prefix string, values map[string]interface{}) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		field := v.Field(i)
+		if d, ok := field.Interface().(time.Duration); ok {
+			values[key] = d.String()
+			continue
+		}
+		if field.Kind() == reflect.Struct {
+			flattenStruct(field, key, values)
+			continue
+		}
+		values[key] = field.Interface()
+	}
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Field describes a single configuration key
+type Field struct {
+	Key         string      `json:"key"`
+	Type        string      `json:"type"`
+	Default     interface{} `json:"default"`
+	Description string      `json:"description"`
+	// Hot is true when a change takes effect without restarting the server
+	Hot bool `json:"hot_reload"`
+	// Secret values are masked when the configuration is returned
+	Secret bool `json:"secret"`
+}
+
+// schema maps every configuration key to its field, built from the Config struct tags
+var schema = buildSchema()
+
+// Fields returns all configuration keys sorted by key
+func Fields() []Field {
+	fields := make([]Field, 0, len(schema))
+	for _, f := range schema {
+		fields = append(fields, f)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Key < fields[j].Key })
+	return fields
+}
+
+// LookupField returns the field of a configuration key
+func LookupField(key string) (Field, bool) {
+	f, ok := schema[key]
+	return f, ok
+}
+
+// buildSchema walks the Config struct using the mapstructure, desc, hot and secret tags
+func buildSchema() map[string]Field {
+	defaults := viper.New()
+	setDefaults(defaults)
+
+	fields := make(map[string]Field)
+	walkStruct(reflect.TypeOf(Config{}), "", defaults, fields)
+	return fields
+}
+
+func walkStruct(t reflect.Type, prefix string, defaults *viper.Viper, fields map[string]Field) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("mapstructure")
+		if name == "" || name == "-" {
+			continue
+		}
+
+		key := name
+		if prefix != "" {
+			key = prefix + "." + name
+		}
+
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Duration(0)) {
+			walkStruct(sf.Type, key, defaults, fields)
+			continue
+		}
+
+		field := Field{
+			Key:         key,
+			Type:        typeName(sf.Type),
+			Default:     defaults.Get(key),
+			Description: sf.Tag.Get("desc"),
+			Hot:         sf.Tag.Get("hot") == "true",
+			Secret:      sf.Tag.Get("secret") == "true",
+		}
+		if field.Secret {
+			field.Default = nil
+		}
+		fields[key] = field
+	}
+}
+
+// typeName returns the JSON schema like type of a config field
+func typeName(t reflect.Type) string {
+	if t == reflect.TypeOf(time.Duration(0)) {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice:
+		return "array<" + typeName(t.Elem()) + ">"
+	default:
+		return strings.ToLower(t.Kind().String())
+	}
+}
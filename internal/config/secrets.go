@@ -0,0 +1,155 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Secret references accepted by fields tagged secret:"true":
+//
+//	env:NAME                   value of an environment variable
+//	file:/path/to/secret       contents of a file, trailing newline removed
+//	vault:secret/data/app#key  field of a HashiCorp Vault KV secret, using VAULT_ADDR and VAULT_TOKEN
+const (
+	secretEnvPrefix   = "env:"
+	secretFilePrefix  = "file:"
+	secretVaultPrefix = "vault:"
+)
+
+// vaultClient is used to read secrets from Vault
+var vaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// resolveSecrets replaces secret references in the configuration with their values
+func resolveSecrets(c *Config) error {
+	// An explicit password file takes precedence over the inline password
+	if c.Auth.PasswordFile != "" {
+		password, err := readSecretFile(c.Auth.PasswordFile)
+		if err != nil {
+			return fmt.Errorf("auth.password_file: %w", err)
+		}
+		c.Auth.Password = password
+	}
+
+	return walkSecrets(reflect.ValueOf(c).Elem(), "")
+}
+
+// walkSecrets resolves every string field tagged secret:"true"
+func walkSecrets(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("mapstructure")
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := walkSecrets(field, key); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct {
+			for j := 0; j < field.Len(); j++ {
+				if err := walkSecrets(field.Index(j), fmt.Sprintf("%s[%d]", key, j)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if sf.Tag.Get("secret") != "true" || field.Kind() != reflect.String {
+			continue
+		}
+		value, err := resolveSecret(field.String())
+		if err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+		field.SetString(value)
+	}
+	return nil
+}
+
+// resolveSecret returns the value a secret reference points to. Plain values are returned unchanged.
+func resolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, secretEnvPrefix):
+		name := strings.TrimPrefix(ref, secretEnvPrefix)
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, secretFilePrefix):
+		return readSecretFile(strings.TrimPrefix(ref, secretFilePrefix))
+	case strings.HasPrefix(ref, secretVaultPrefix):
+		return readVaultSecret(strings.TrimPrefix(ref, secretVaultPrefix))
+	default:
+		return ref, nil
+	}
+}
+
+// readSecretFile reads a secret from a file
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// readVaultSecret reads a field of a Vault KV secret, given as path#field
+func readVaultSecret(ref string) (string, error) {
+	path, field, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || field == "" {
+		return "", fmt.Errorf("vault reference must be path#field")
+	}
+
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		return "", fmt.Errorf("VAULT_ADDR is not set")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimRight(addr, "/")+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := vaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s for %s", resp.Status, path)
+	}
+
+	var body struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("invalid vault response: %w", err)
+	}
+
+	// KV version 2 nests the secret under data.data
+	data := body.Data
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		data = nested
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("field %s not found in vault secret %s", field, path)
+	}
+	return value, nil
+}
@@ -0,0 +1,274 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nebula/nebula/internal/cluster"
+	"github.com/nebula/nebula/internal/containers"
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/logging"
+	"github.com/nebula/nebula/internal/password"
+	"github.com/nebula/nebula/internal/updater"
+	"github.com/nebula/nebula/internal/websocket"
+)
+
+// ValidationError lists every invalid setting of a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the configuration for values the server cannot run with
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port must be between 1 and 65535")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdown_timeout must not be negative")
+	check(c.Server.BasePath == "" || (strings.HasPrefix(c.Server.BasePath, "/") && path.Clean(c.Server.BasePath) == c.Server.BasePath && c.Server.BasePath != "/"),
+		"server.base_path must be empty or a path such as /nebula, without a trailing slash")
+	for _, proxy := range c.Server.TrustedProxies {
+		_, _, err := net.ParseCIDR(proxy)
+		check(err == nil || net.ParseIP(proxy) != nil, "server.trusted_proxies must be IP addresses or CIDR ranges, got %q", proxy)
+	}
+	if tls := c.Server.TLS; tls.Enabled {
+		if tls.Autocert {
+			check(len(tls.Domains) > 0, "server.tls.domains is required with autocert")
+			check(tls.CacheDir != "", "server.tls.cache_dir is required with autocert")
+		} else {
+			check(tls.CertFile != "" && tls.KeyFile != "", "server.tls.cert_file and key_file are required unless autocert is enabled")
+		}
+		check(tls.HTTPPort >= 0 && tls.HTTPPort <= 65535, "server.tls.http_port must be between 0 and 65535")
+		check(tls.HTTPPort != c.Server.Port, "server.tls.http_port must differ from server.port")
+	}
+
+	check(c.Storage.MetricsRetention >= 0, "storage.metrics_retention must not be negative")
+	// Rollups read the history, which must outlive the steps being averaged
+	check(c.Storage.MetricsRetention == 0 || c.Storage.MetricsRetention >= 10*time.Minute,
+		"storage.metrics_retention must be at least 10m, or 0 to keep everything")
+	check(c.Storage.Metrics1mRetention >= 0, "storage.metrics_1m_retention must not be negative")
+	check(c.Storage.Metrics5mRetention >= 0, "storage.metrics_5m_retention must not be negative")
+	check(c.Storage.AuditRetention >= 0, "storage.audit_retention must not be negative")
+	check(c.Storage.BackupKeep >= 0, "storage.backup_keep must not be negative")
+
+	staticCredentials := c.Auth.Enabled && !c.Auth.PAM.Enabled
+	check(!staticCredentials || c.Auth.Username != "", "auth.username is required when auth is enabled")
+	check(!staticCredentials || c.Auth.Password != "", "auth.password is required when auth is enabled")
+	if password.IsHash(c.Auth.Password) {
+		check(password.Validate(c.Auth.Password) == nil, "auth.password is not a valid bcrypt or argon2id hash")
+	}
+	if c.Auth.PAM.Enabled {
+		check(runtime.GOOS == "linux", "auth.pam is only supported on Linux")
+		check(c.Auth.PAM.Service != "", "auth.pam.service is required")
+	}
+	check(c.Auth.SessionTTL > 0, "auth.session_ttl must be positive")
+	check(c.Auth.CredentialsTTL >= 0, "auth.credentials_ttl must not be negative")
+	check(c.Auth.Escalation == "sudo" || c.Auth.Escalation == "pkexec", "auth.escalation must be sudo or pkexec")
+	check(c.Auth.Escalation != "pkexec" || runtime.GOOS == "linux", "auth.escalation pkexec is only supported on Linux")
+	check(!c.Auth.SudoMode || c.Auth.Escalation == "sudo", "auth.sudo_mode requires auth.escalation sudo")
+	check(c.Auth.ElevationTTL > 0, "auth.elevation_ttl must be positive")
+	if lockout := c.Auth.Lockout; lockout.Enabled {
+		check(lockout.MaxFailures > 0, "auth.lockout.max_failures must be positive")
+		check(lockout.BaseDelay > 0, "auth.lockout.base_delay must be positive")
+		check(lockout.MaxDelay >= lockout.BaseDelay, "auth.lockout.max_delay must not be shorter than base_delay")
+		check(lockout.Window > 0, "auth.lockout.window must be positive")
+	}
+	if oidc := c.Auth.OIDC; oidc.Enabled {
+		check(c.Auth.Enabled, "auth.oidc requires auth.enabled")
+		check(strings.HasPrefix(oidc.Issuer, "https://") || strings.HasPrefix(oidc.Issuer, "http://"), "auth.oidc.issuer must be an http(s) URL")
+		check(oidc.ClientID != "", "auth.oidc.client_id is required")
+		check(strings.HasPrefix(oidc.RedirectURL, "https://") || strings.HasPrefix(oidc.RedirectURL, "http://"), "auth.oidc.redirect_url must be an http(s) URL")
+		check(oidc.UsernameClaim != "", "auth.oidc.username_claim is required")
+		check(len(oidc.AdminGroups)+len(oidc.ViewerGroups) > 0, "auth.oidc needs admin_groups or viewer_groups, users in neither can't log in")
+	}
+	if webauthn := c.Auth.WebAuthn; webauthn.Enabled {
+		check(c.Auth.Enabled, "auth.webauthn requires auth.enabled")
+		check(webauthn.RPID != "" && !strings.ContainsAny(webauthn.RPID, ":/"), "auth.webauthn.rp_id must be a domain, without scheme or port")
+		check(len(webauthn.Origins) > 0, "auth.webauthn.origins is required")
+		for _, origin := range webauthn.Origins {
+			check(strings.HasPrefix(origin, "https://") || strings.HasPrefix(origin, "http://"), "auth.webauthn.origins must be http(s) URLs")
+		}
+	}
+
+	check(c.Metrics.Interval > 0, "metrics.interval must be positive")
+	check(c.Metrics.HistorySize > 0, "metrics.history_size must be positive")
+	check(c.Metrics.TopProcesses >= 0, "metrics.top_processes must not be negative")
+
+	check(c.Terminal.MaxSessions >= 0, "terminal.max_sessions must not be negative")
+	check(c.Terminal.MaxSessionsPerUser >= 0, "terminal.max_sessions_per_user must not be negative")
+	// A zero maximum leaves the value unbounded
+	check(c.Terminal.MaxCols == 0 || c.Terminal.DefaultCols <= c.Terminal.MaxCols, "terminal.default_cols must not exceed terminal.max_cols")
+	check(c.Terminal.MaxRows == 0 || c.Terminal.DefaultRows <= c.Terminal.MaxRows, "terminal.default_rows must not exceed terminal.max_rows")
+	check(c.Terminal.MaxScrollbackSize == 0 || c.Terminal.ScrollbackSize <= c.Terminal.MaxScrollbackSize, "terminal.scrollback_size must not exceed terminal.max_scrollback_size")
+
+	check(c.Files.MaxUploadSize >= 0, "files.max_upload_size must not be negative")
+	check(c.Files.UploadExpiry > 0, "files.upload_expiry must be positive")
+	check(c.Files.MinFreeSpace >= 0, "files.min_free_space must not be negative")
+	roots := make(map[string]bool)
+	for i, root := range c.Files.Roots {
+		check(root.Name != "" && !strings.ContainsAny(root.Name, `/\.`) && !roots[root.Name],
+			"files.roots[%d].name must be set, unique and without / \\ or .", i)
+		roots[root.Name] = true
+		check(filepath.IsAbs(root.Path), "files.roots[%d].path must be an absolute path", i)
+		check(root.Quota >= 0, "files.roots[%d].quota must not be negative", i)
+	}
+	remotes := make(map[string]bool)
+	for i, remote := range c.Files.Remotes {
+		check(remote.Name != "" && !remotes[remote.Name], "files.remotes[%d].name must be set and unique", i)
+		remotes[remote.Name] = true
+		check(remote.Address != "", "files.remotes[%d].address is required", i)
+		check(remote.User != "", "files.remotes[%d].user is required", i)
+		check(remote.Password != "" || remote.KeyFile != "", "files.remotes[%d] needs a password or key_file", i)
+		check(strings.HasPrefix(remote.RootPath, "/"), "files.remotes[%d].root_path must be an absolute path", i)
+	}
+
+	if err := containers.ValidateHost(c.Containers.Host); err != nil {
+		problems = append(problems, "containers.host: "+err.Error())
+	}
+
+	check(c.Certificates.WarnDays >= 0, "certificates.warn_days must not be negative")
+	check(c.Certificates.ScanInterval > 0, "certificates.scan_interval must be positive")
+	check(c.Certificates.UploadDir != "", "certificates.upload_dir is required")
+
+	check(c.Scheduler.MaxConcurrent >= 0, "scheduler.max_concurrent must not be negative")
+	check(c.Scheduler.MaxOutput > 0, "scheduler.max_output must be positive")
+	check(c.Scheduler.HistoryRetention > 0, "scheduler.history_retention must be positive")
+	check(c.Notify.HistoryRetention > 0, "notifications.history_retention must be positive")
+	if email := c.Notify.Email; email.Enabled {
+		check(email.SMTPHost != "", "notifications.email.smtp_host is required")
+		check(email.SMTPPort >= 0 && email.SMTPPort <= 65535, "notifications.email.smtp_port must be a valid port")
+		check(len(email.To) > 0, "notifications.email.to needs at least one address")
+		for _, addr := range append([]string{email.From}, email.To...) {
+			_, err := mail.ParseAddress(addr)
+			check(err == nil, "notifications.email: invalid address %q", addr)
+		}
+		check(len(email.Events) > 0, "notifications.email.events needs at least one pattern")
+		for _, pattern := range email.Events {
+			_, err := path.Match(pattern, "")
+			check(err == nil, "notifications.email: invalid event pattern %q", pattern)
+		}
+		switch email.MinSeverity {
+		case "", "info", "warning", "critical":
+		default:
+			problems = append(problems, "notifications.email.min_severity must be one of info, warning, critical")
+		}
+	}
+
+	switch c.Updater.Channel {
+	case "stable", "beta", "nightly":
+	default:
+		problems = append(problems, "updater.channel must be one of stable, beta, nightly")
+	}
+
+	check(c.Updater.CheckInterval > 0, "updater.check_interval must be positive")
+	check(c.Updater.KeepVersions >= 0, "updater.keep_versions must not be negative")
+	if _, err := updater.ParseWindow(c.Updater.MaintenanceWindow); err != nil {
+		problems = append(problems, "updater.maintenance_window: "+err.Error())
+	}
+	if c.Updater.Proxy != "" {
+		if _, err := updater.ParseProxy(c.Updater.Proxy); err != nil {
+			problems = append(problems, "updater.proxy: "+err.Error())
+		}
+	}
+	if c.Updater.ManifestURL != "" {
+		if _, err := updater.ParseManifestURL(c.Updater.ManifestURL); err != nil {
+			problems = append(problems, "updater.manifest_url: "+err.Error())
+		}
+	}
+
+	check(c.WebSocket.ResumeBuffer >= 0, "websocket.resume_buffer must not be negative")
+	check(c.WebSocket.SendBuffer > 0, "websocket.send_buffer must be positive")
+	switch c.WebSocket.SlowClientPolicy {
+	case websocket.PolicyDropOldest, websocket.PolicyDisconnect:
+	default:
+		problems = append(problems, "websocket.slow_client_policy must be one of drop-oldest, disconnect")
+	}
+	if err := websocket.ValidateCompressionLevel(c.WebSocket.CompressionLevel); err != nil {
+		problems = append(problems, "websocket.compression_level: "+err.Error())
+	}
+	for _, origin := range c.WebSocket.AllowedOrigins {
+		if _, err := websocket.ParseOrigin(origin); err != nil {
+			problems = append(problems, "websocket.allowed_origins: "+err.Error())
+		}
+	}
+
+	check(c.RateLimit.Rate >= 0, "rate_limit.rate must not be negative")
+	check(c.RateLimit.Rate == 0 || c.RateLimit.Burst > 0, "rate_limit.burst must be positive")
+	check(c.RateLimit.IPRate >= 0, "rate_limit.ip_rate must not be negative")
+	check(c.RateLimit.IPRate == 0 || c.RateLimit.IPBurst > 0, "rate_limit.ip_burst must be positive")
+	for i, route := range c.RateLimit.Routes {
+		check(strings.HasPrefix(route.Prefix, "/"), "rate_limit.routes[%d].prefix must start with /", i)
+		check(route.Rate >= 0, "rate_limit.routes[%d].rate must not be negative", i)
+		check(route.Rate == 0 || route.Burst > 0, "rate_limit.routes[%d].burst must be positive", i)
+	}
+
+	for i, hook := range c.Events.Webhooks {
+		u, err := url.Parse(hook.URL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"events.webhooks[%d].url must be an http or https URL", i)
+		for _, topic := range hook.Topics {
+			check(isEventTopic(topic), "events.webhooks[%d].topics: unknown topic %q", i, topic)
+		}
+	}
+
+	switch c.Cluster.Mode {
+	case cluster.ModeStandalone:
+	case cluster.ModeAgent:
+		check(c.Cluster.Token != "", "cluster.token is required in agent mode")
+		_, err := cluster.ParseURL(c.Cluster.ControllerURL)
+		check(err == nil, "cluster.controller_url must be an http or https URL in agent mode")
+		_, err = cluster.ParseURL(c.Cluster.AdvertiseURL)
+		check(err == nil, "cluster.advertise_url must be an http or https URL in agent mode")
+		check(c.Cluster.Name == "" || cluster.ValidHostName(c.Cluster.Name),
+			"cluster.name may only contain letters, digits, dots, dashes and underscores")
+		check(c.Cluster.HeartbeatInterval > 0, "cluster.heartbeat_interval must be positive")
+	case cluster.ModeController:
+		check(c.Cluster.Token != "", "cluster.token is required in controller mode")
+		check(c.Cluster.HostTimeout > 0, "cluster.host_timeout must be positive")
+	default:
+		problems = append(problems, "cluster.mode must be one of standalone, agent, controller")
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		problems = append(problems, "logging.level must be one of debug, info, warn, error")
+	}
+	switch c.Logging.Format {
+	case logging.FormatJSON, logging.FormatText:
+	default:
+		problems = append(problems, "logging.format must be one of json, text")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// isEventTopic reports whether topic is an event bus topic
+func isEventTopic(topic string) bool {
+	for _, t := range events.Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
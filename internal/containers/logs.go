@@ -0,0 +1,137 @@
+package containers
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Streams a log line can come from
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// LogLine is a line written by a container
+type LogLine struct {
+	Stream    string    `json:"stream"`
+	Timestamp time.Time `json:"timestamp"`
+	Message   string    `json:"message"`
+}
+
+// LogOptions selects the log lines returned
+type LogOptions struct {
+	// Tail is the number of lines from the end, 0 for every line
+	Tail int
+	// Follow keeps streaming new lines until the context is cancelled
+	Follow bool
+	Since  time.Time
+}
+
+// Logs calls fn for each log line of a container, stopping at the first error fn returns
+func (m *Manager) Logs(ctx context.Context, id string, opts LogOptions, fn func(LogLine) error) error {
+	tty, err := m.hasTTY(id)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{"stdout": {"true"}, "stderr": {"true"}, "timestamps": {"true"}}
+	if opts.Tail > 0 {
+		query.Set("tail", strconv.Itoa(opts.Tail))
+	}
+	if opts.Follow {
+		query.Set("follow", "true")
+	}
+	if !opts.Since.IsZero() {
+		query.Set("since", strconv.FormatInt(opts.Since.Unix(), 10))
+	}
+
+	resp, err := m.do(ctx, http.MethodGet, "/containers/"+url.PathEscape(id)+"/logs?"+query.Encode())
+	if err != nil {
+		return fmt.Errorf("failed to read logs: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if tty {
+		return readLines(resp.Body, StreamStdout, fn)
+	}
+	return readMultiplexed(resp.Body, fn)
+}
+
+// hasTTY reports whether a container runs with a terminal, its output is
+// then a single raw stream instead of multiplexed stdout and stderr
+func (m *Manager) hasTTY(id string) (bool, error) {
+	raw, err := m.Inspect(id)
+	if err != nil {
+		return false, err
+	}
+	var container struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}
+	if err := json.Unmarshal(raw, &container); err != nil {
+		return false, err
+	}
+	return container.Config.Tty, nil
+}
+
+// readLines reads the raw output of a container with a terminal
+func readLines(r io.Reader, stream string, fn func(LogLine) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if err := fn(parseLine(stream, scanner.Text())); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// readMultiplexed reads output framed with an 8 byte header carrying the
+// stream and the length of the payload
+func readMultiplexed(r io.Reader, fn func(LogLine) error) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		stream := StreamStdout
+		if header[0] == 2 {
+			stream = StreamStderr
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err
+		}
+
+		for _, line := range strings.Split(strings.TrimSuffix(string(payload), "\n"), "\n") {
+			if err := fn(parseLine(stream, line)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseLine splits the timestamp the runtime puts in front of each line
+func parseLine(stream, line string) LogLine {
+	entry := LogLine{Stream: stream, Message: strings.TrimSuffix(line, "\r")}
+	if ts, message, ok := strings.Cut(line, " "); ok {
+		if t, err := time.Parse(time.RFC3339Nano, ts); err == nil {
+			entry.Timestamp = t
+			entry.Message = strings.TrimSuffix(message, "\r")
+		}
+	}
+	return entry
+}
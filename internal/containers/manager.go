@@ -0,0 +1,397 @@
+package containers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// requestTimeout bounds API calls that don't stream
+const requestTimeout = 30 * time.Second
+
+// Runtimes the manager can talk to, Podman serves a Docker compatible API
+const (
+	RuntimeDocker = "docker"
+	RuntimePodman = "podman"
+)
+
+// Errors callers can tell apart with errors.Is
+var (
+	// ErrNotFound is returned for containers and images that don't exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalidName is returned for names that aren't container or image references
+	ErrInvalidName = errors.New("invalid name")
+)
+
+// refPattern matches container names, IDs and image references
+var refPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/@-]*$`)
+
+// Container contains container information
+type Container struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Image   string            `json:"image"`
+	State   string            `json:"state"`
+	Status  string            `json:"status"`
+	Created time.Time         `json:"created"`
+	Ports   []Port            `json:"ports,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// Port is a port published by a container
+type Port struct {
+	IP          string `json:"ip,omitempty"`
+	PrivatePort int    `json:"private_port"`
+	PublicPort  int    `json:"public_port,omitempty"`
+	Type        string `json:"type"`
+}
+
+// Image contains image information
+type Image struct {
+	ID      string    `json:"id"`
+	Tags    []string  `json:"tags"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// PruneReport lists what a prune removed
+type PruneReport struct {
+	ContainersDeleted []string `json:"containers_deleted"`
+	ImagesDeleted     int      `json:"images_deleted"`
+	SpaceReclaimed    uint64   `json:"space_reclaimed"`
+}
+
+// Manager manages containers through the Docker or Podman API
+type Manager struct {
+	endpoint string
+	runtime  string
+	base     string
+	client   *http.Client
+}
+
+// NewManager connects to the container runtime at host, a unix:// or
+// tcp:// URL, or to DOCKER_HOST or the first Docker or Podman socket found
+// when empty
+func NewManager(host string) (*Manager, error) {
+	if host == "" {
+		host = os.Getenv("DOCKER_HOST")
+	}
+	if host == "" {
+		socket := detectSocket()
+		if socket == "" {
+			return nil, fmt.Errorf("no Docker or Podman socket found")
+		}
+		host = "unix://" + socket
+	}
+	if err := ValidateHost(host); err != nil {
+		return nil, err
+	}
+
+	m := &Manager{endpoint: host}
+	if socket, ok := strings.CutPrefix(host, "unix://"); ok {
+		m.base = "http://localhost"
+		m.client = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}}
+	} else {
+		m.base = "http://" + strings.TrimPrefix(host, "tcp://")
+		m.client = &http.Client{}
+	}
+
+	runtime, err := m.detectRuntime()
+	if err != nil {
+		return nil, fmt.Errorf("container runtime at %s not reachable: %w", host, err)
+	}
+	m.runtime = runtime
+	return m, nil
+}
+
+// ValidateHost checks a container host setting
+func ValidateHost(host string) error {
+	if host == "" || strings.HasPrefix(host, "unix://") || strings.HasPrefix(host, "tcp://") {
+		return nil
+	}
+	return fmt.Errorf("must be a unix:// or tcp:// URL")
+}
+
+// detectSocket returns the first Docker or Podman socket that exists
+func detectSocket() string {
+	candidates := []string{"/var/run/docker.sock", "/run/podman/podman.sock"}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "podman", "podman.sock"), filepath.Join(dir, "docker.sock"))
+	}
+	for _, socket := range candidates {
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return socket
+		}
+	}
+	return ""
+}
+
+// detectRuntime asks the API which runtime serves it
+func (m *Manager) detectRuntime() (string, error) {
+	var version struct {
+		Components []struct {
+			Name string `json:"Name"`
+		} `json:"Components"`
+	}
+	if err := m.getJSON("/version", &version); err != nil {
+		return "", err
+	}
+	for _, component := range version.Components {
+		if strings.Contains(strings.ToLower(component.Name), RuntimePodman) {
+			return RuntimePodman, nil
+		}
+	}
+	return RuntimeDocker, nil
+}
+
+// Runtime returns docker or podman
+func (m *Manager) Runtime() string {
+	return m.runtime
+}
+
+// Endpoint returns the API URL the manager talks to
+func (m *Manager) Endpoint() string {
+	return m.endpoint
+}
+
+// List returns the running containers, or every container when all is set
+func (m *Manager) List(all bool) ([]Container, error) {
+	var raw []struct {
+		ID      string            `json:"Id"`
+		Names   []string          `json:"Names"`
+		Image   string            `json:"Image"`
+		State   string            `json:"State"`
+		Status  string            `json:"Status"`
+		Created int64             `json:"Created"`
+		Labels  map[string]string `json:"Labels"`
+		Ports   []struct {
+			IP          string `json:"IP"`
+			PrivatePort int    `json:"PrivatePort"`
+			PublicPort  int    `json:"PublicPort"`
+			Type        string `json:"Type"`
+		} `json:"Ports"`
+	}
+	path := "/containers/json"
+	if all {
+		path += "?all=true"
+	}
+	if err := m.getJSON(path, &raw); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	containers := make([]Container, 0, len(raw))
+	for _, r := range raw {
+		c := Container{
+			ID:      r.ID,
+			Image:   r.Image,
+			State:   r.State,
+			Status:  r.Status,
+			Created: time.Unix(r.Created, 0),
+			Labels:  r.Labels,
+		}
+		if len(r.Names) > 0 {
+			c.Name = strings.TrimPrefix(r.Names[0], "/")
+		}
+		for _, p := range r.Ports {
+			c.Ports = append(c.Ports, Port{IP: p.IP, PrivatePort: p.PrivatePort, PublicPort: p.PublicPort, Type: p.Type})
+		}
+		containers = append(containers, c)
+	}
+	return containers, nil
+}
+
+// Inspect returns the full description of a container as reported by the runtime
+func (m *Manager) Inspect(id string) (json.RawMessage, error) {
+	if err := validateRef(id); err != nil {
+		return nil, err
+	}
+	var raw json.RawMessage
+	if err := m.getJSON("/containers/"+url.PathEscape(id)+"/json", &raw); err != nil {
+		return nil, err
+	}
+	return raw, nil
+}
+
+// Start starts a container
+func (m *Manager) Start(id string) error {
+	return m.action(id, "start")
+}
+
+// Stop stops a container
+func (m *Manager) Stop(id string) error {
+	return m.action(id, "stop")
+}
+
+// Restart restarts a container
+func (m *Manager) Restart(id string) error {
+	return m.action(id, "restart")
+}
+
+// action posts a state change to a container, the runtime replies 304 when
+// the container is already in that state
+func (m *Manager) action(id, action string) error {
+	if err := validateRef(id); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := m.do(ctx, http.MethodPost, "/containers/"+url.PathEscape(id)+"/"+action)
+	if err != nil {
+		return fmt.Errorf("failed to %s container: %w", action, err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Images returns the local images
+func (m *Manager) Images() ([]Image, error) {
+	var raw []struct {
+		ID       string   `json:"Id"`
+		RepoTags []string `json:"RepoTags"`
+		Size     int64    `json:"Size"`
+		Created  int64    `json:"Created"`
+	}
+	if err := m.getJSON("/images/json", &raw); err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+
+	images := make([]Image, 0, len(raw))
+	for _, r := range raw {
+		images = append(images, Image{ID: r.ID, Tags: r.RepoTags, Size: r.Size, Created: time.Unix(r.Created, 0)})
+	}
+	return images, nil
+}
+
+// Pull downloads an image, e.g. nginx or nginx:1.25, returning when it is complete
+func (m *Manager) Pull(ctx context.Context, image string) error {
+	if err := validateRef(image); err != nil {
+		return err
+	}
+	// Without a tag the API pulls every tag of the repository
+	if !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") && !strings.Contains(image, "@") {
+		image += ":latest"
+	}
+
+	resp, err := m.do(ctx, http.MethodPost, "/images/create?fromImage="+url.QueryEscape(image))
+	if err != nil {
+		return fmt.Errorf("failed to pull %s: %w", image, err)
+	}
+	defer resp.Body.Close()
+
+	// The body is a stream of progress messages, failures are reported in one of them
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		if err := dec.Decode(&progress); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to pull %s: %w", image, err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("failed to pull %s: %s", image, progress.Error)
+		}
+	}
+}
+
+// Prune removes stopped containers and dangling images
+func (m *Manager) Prune() (PruneReport, error) {
+	report := PruneReport{ContainersDeleted: []string{}}
+
+	var containers struct {
+		ContainersDeleted []string `json:"ContainersDeleted"`
+		SpaceReclaimed    uint64   `json:"SpaceReclaimed"`
+	}
+	if err := m.postJSON("/containers/prune", &containers); err != nil {
+		return report, fmt.Errorf("failed to prune containers: %w", err)
+	}
+	if containers.ContainersDeleted != nil {
+		report.ContainersDeleted = containers.ContainersDeleted
+	}
+
+	var images struct {
+		ImagesDeleted  []json.RawMessage `json:"ImagesDeleted"`
+		SpaceReclaimed uint64            `json:"SpaceReclaimed"`
+	}
+	if err := m.postJSON("/images/prune", &images); err != nil {
+		return report, fmt.Errorf("failed to prune images: %w", err)
+	}
+	report.ImagesDeleted = len(images.ImagesDeleted)
+	report.SpaceReclaimed = containers.SpaceReclaimed + images.SpaceReclaimed
+	return report, nil
+}
+
+// getJSON decodes the response of a GET request
+func (m *Manager) getJSON(path string, v interface{}) error {
+	return m.requestJSON(http.MethodGet, path, v)
+}
+
+// postJSON decodes the response of a POST request without body
+func (m *Manager) postJSON(path string, v interface{}) error {
+	return m.requestJSON(http.MethodPost, path, v)
+}
+
+func (m *Manager) requestJSON(method, path string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	resp, err := m.do(ctx, method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// do sends a request to the API, turning error statuses into errors
+func (m *Manager) do(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, m.base+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 300 || resp.StatusCode == http.StatusNotModified {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	var apiErr struct {
+		Message string `json:"message"`
+	}
+	json.NewDecoder(resp.Body).Decode(&apiErr)
+	if apiErr.Message == "" {
+		apiErr.Message = resp.Status
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, apiErr.Message)
+	}
+	return nil, errors.New(apiErr.Message)
+}
+
+// validateRef rejects names that would change the API path
+func validateRef(ref string) error {
+	if !refPattern.MatchString(ref) || strings.Contains(ref, "..") {
+		return fmt.Errorf("%w %q", ErrInvalidName, ref)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package containers
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Stats is a resource usage sample of a container
+type Stats struct {
+	CPUPercent    float64 `json:"cpu_percent"`
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx"`
+	NetworkTx     uint64  `json:"network_tx"`
+	BlockRead     uint64  `json:"block_read"`
+	BlockWrite    uint64  `json:"block_write"`
+	PIDs          uint64  `json:"pids"`
+}
+
+// rawStats is the part of the stats the runtime reports that Stats is computed from
+type rawStats struct {
+	CPUStats    cpuStats `json:"cpu_stats"`
+	PreCPUStats cpuStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+type cpuStats struct {
+	CPUUsage struct {
+		TotalUsage  uint64   `json:"total_usage"`
+		PercpuUsage []uint64 `json:"percpu_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  uint64 `json:"online_cpus"`
+}
+
+// Stats returns the resource usage of a running container. The runtime
+// samples the CPU twice, so the call takes about a second.
+func (m *Manager) Stats(id string) (Stats, error) {
+	if err := validateRef(id); err != nil {
+		return Stats{}, err
+	}
+
+	var raw rawStats
+	if err := m.getJSON("/containers/"+url.PathEscape(id)+"/stats?stream=false", &raw); err != nil {
+		return Stats{}, fmt.Errorf("failed to get stats: %w", err)
+	}
+	return raw.compute(), nil
+}
+
+// compute derives the usage the same way docker stats does
+func (raw rawStats) compute() Stats {
+	stats := Stats{
+		MemoryLimit: raw.MemoryStats.Limit,
+		PIDs:        raw.PidsStats.Current,
+	}
+
+	cpuDelta := float64(raw.CPUStats.CPUUsage.TotalUsage) - float64(raw.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(raw.CPUStats.SystemUsage) - float64(raw.PreCPUStats.SystemUsage)
+	cpus := float64(raw.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(raw.CPUStats.CPUUsage.PercpuUsage))
+	}
+	if cpuDelta > 0 && systemDelta > 0 {
+		stats.CPUPercent = cpuDelta / systemDelta * cpus * 100
+	}
+
+	// Page cache can be reclaimed, it is not counted as used
+	stats.MemoryUsage = raw.MemoryStats.Usage
+	cache := raw.MemoryStats.Stats["total_inactive_file"]
+	if v, ok := raw.MemoryStats.Stats["inactive_file"]; ok {
+		cache = v
+	}
+	if cache < stats.MemoryUsage {
+		stats.MemoryUsage -= cache
+	}
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+
+	for _, network := range raw.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+	for _, io := range raw.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(io.Op) {
+		case "read":
+			stats.BlockRead += io.Value
+		case "write":
+			stats.BlockWrite += io.Value
+		}
+	}
+	return stats
+}
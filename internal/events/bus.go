@@ -0,0 +1,166 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Topics events are published on
+const (
+	TopicMetrics    = "metrics"
+	TopicServices   = "services"
+	TopicJobs       = "jobs"
+	TopicAlerts     = "alerts"
+	TopicFiles      = "files"
+	TopicUpdate     = "update"
+	TopicAudit      = "audit"
+	TopicContainers = "containers"
+	TopicSystem     = "system"
+	TopicSecurity   = "security"
+	TopicNotices    = "notices" // messages for a single user, see PublishTo
+)
+
+// Topics lists every topic
+var Topics = []string{TopicMetrics, TopicServices, TopicJobs, TopicAlerts, TopicFiles, TopicUpdate, TopicAudit, TopicContainers, TopicSystem, TopicSecurity, TopicNotices}
+
+// Event is something that happened in a subsystem
+type Event struct {
+	Topic string `json:"topic"`
+	// Type names what happened within the topic, e.g. service.started
+	Type      string      `json:"type"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+	// User restricts WebSocket delivery to the sessions of a user
+	User string `json:"user,omitempty"`
+}
+
+// Bus fans events out from the subsystems publishing them to the
+// subscribers delivering them, such as WebSocket clients and webhooks
+type Bus struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]bool
+	closed bool
+
+	statsMu   sync.Mutex
+	published map[string]uint64
+	dropped   uint64
+	webhooks  []*webhookStats
+}
+
+// Subscription receives the events of some topics
+type Subscription struct {
+	bus     *Bus
+	topics  map[string]bool
+	ch      chan Event
+	mu      sync.Mutex
+	dropped uint64
+}
+
+// NewBus creates an event bus
+func NewBus() *Bus {
+	return &Bus{
+		subs:      make(map[*Subscription]bool),
+		published: make(map[string]uint64),
+	}
+}
+
+// Publish sends an event to the subscribers of its topic. It never blocks:
+// subscribers that fall behind lose the event.
+func (b *Bus) Publish(topic, eventType string, data interface{}) {
+	b.publish(Event{Topic: topic, Type: eventType, Data: data})
+}
+
+// PublishTo sends an event meant for a single user, such as a notice that
+// their job completed. WebSocket sessions of the user receive it whatever
+// their subscriptions, webhooks of the topic receive it like any other event.
+func (b *Bus) PublishTo(user, topic, eventType string, data interface{}) {
+	b.publish(Event{Topic: topic, Type: eventType, Data: data, User: user})
+}
+
+func (b *Bus) publish(event Event) {
+	if b == nil {
+		return
+	}
+	event.Timestamp = time.Now()
+
+	var dropped uint64
+	b.mu.RLock()
+	for sub := range b.subs {
+		if len(sub.topics) > 0 && !sub.topics[event.Topic] {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.mu.Lock()
+			sub.dropped++
+			sub.mu.Unlock()
+			dropped++
+		}
+	}
+	b.mu.RUnlock()
+
+	b.statsMu.Lock()
+	b.published[event.Topic]++
+	b.dropped += dropped
+	b.statsMu.Unlock()
+}
+
+// Subscribe returns a subscription to topics, or to every topic when none
+// is given, buffering up to buffer events
+func (b *Bus) Subscribe(buffer int, topics ...string) *Subscription {
+	sub := &Subscription{
+		bus:    b,
+		topics: make(map[string]bool),
+		ch:     make(chan Event, buffer),
+	}
+	for _, topic := range topics {
+		sub.topics[topic] = true
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.ch)
+		return sub
+	}
+	b.subs[sub] = true
+	return sub
+}
+
+// Close closes every subscription
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for sub := range b.subs {
+		close(sub.ch)
+	}
+	b.subs = nil
+}
+
+// Events returns the channel events are delivered on, closed when the
+// subscription ends
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Dropped returns the number of events lost because the subscriber was too slow
+func (s *Subscription) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Unsubscribe ends the subscription and closes its channel
+func (s *Subscription) Unsubscribe() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	if s.bus.subs[s] {
+		delete(s.bus.subs, s)
+		close(s.ch)
+	}
+}
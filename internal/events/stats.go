@@ -0,0 +1,76 @@
+package events
+
+import (
+	"net/url"
+	"sync"
+)
+
+// Stats describes the events published and delivered since the bus started
+type Stats struct {
+	Published map[string]uint64 `json:"published"`
+	// Dropped counts deliveries lost because a subscriber was too slow
+	Dropped  uint64         `json:"dropped"`
+	Webhooks []WebhookStats `json:"webhooks"`
+}
+
+// WebhookStats describes the deliveries to a webhook
+type WebhookStats struct {
+	// Target is the webhook URL without its query, which may hold tokens
+	Target    string `json:"target"`
+	Delivered uint64 `json:"delivered"`
+	Failed    uint64 `json:"failed"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// webhookStats holds the counters of a webhook
+type webhookStats struct {
+	mu    sync.Mutex
+	stats WebhookStats
+}
+
+// trackWebhook adds the counters of a webhook to the bus stats
+func (b *Bus) trackWebhook(rawURL string) *webhookStats {
+	target := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		target = u.Scheme + "://" + u.Host + u.Path
+	}
+
+	ws := &webhookStats{stats: WebhookStats{Target: target}}
+	b.statsMu.Lock()
+	b.webhooks = append(b.webhooks, ws)
+	b.statsMu.Unlock()
+	return ws
+}
+
+// record counts a delivery attempt
+func (s *webhookStats) record(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		s.stats.Failed++
+		s.stats.LastError = err.Error()
+		return
+	}
+	s.stats.Delivered++
+}
+
+// Stats returns the bus counters
+func (b *Bus) Stats() Stats {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+
+	stats := Stats{
+		Published: make(map[string]uint64, len(b.published)),
+		Dropped:   b.dropped,
+		Webhooks:  make([]WebhookStats, 0, len(b.webhooks)),
+	}
+	for topic, n := range b.published {
+		stats.Published[topic] = n
+	}
+	for _, ws := range b.webhooks {
+		ws.mu.Lock()
+		stats.Webhooks = append(stats.Webhooks, ws.stats)
+		ws.mu.Unlock()
+	}
+	return stats
+}
@@ -0,0 +1,97 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// webhookTimeout bounds the delivery of a single event
+const webhookTimeout = 10 * time.Second
+
+// webhookBuffer is the number of events queued per webhook
+const webhookBuffer = 256
+
+// Webhook receives events as JSON POST requests
+type Webhook struct {
+	URL string
+	// Topics filters the events sent, every topic except metrics when empty
+	Topics []string
+	// Secret signs the body with HMAC-SHA256 in the X-Nebula-Signature header
+	Secret string
+}
+
+// StartWebhooks delivers events to the webhooks until ctx is cancelled
+func StartWebhooks(ctx context.Context, bus *Bus, hooks []Webhook) {
+	client := &http.Client{Timeout: webhookTimeout}
+	for _, hook := range hooks {
+		topics := hook.Topics
+		if len(topics) == 0 {
+			// Metrics are published every second, they must be asked for
+			for _, topic := range Topics {
+				if topic != TopicMetrics {
+					topics = append(topics, topic)
+				}
+			}
+		}
+
+		sub := bus.Subscribe(webhookBuffer, topics...)
+		stats := bus.trackWebhook(hook.URL)
+		go func(hook Webhook) {
+			defer sub.Unsubscribe()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case event, ok := <-sub.Events():
+					if !ok {
+						return
+					}
+					err := deliver(ctx, client, hook, event)
+					if err != nil {
+						log.Printf("Webhook %s failed for %s: %v", hook.URL, event.Type, err)
+					}
+					stats.record(err)
+				}
+			}
+		}(hook)
+	}
+}
+
+// deliver posts an event to a webhook
+func deliver(ctx context.Context, client *http.Client, hook Webhook, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Nebula-Event", event.Type)
+	if hook.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(hook.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Nebula-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
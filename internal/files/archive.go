@@ -0,0 +1,295 @@
+package files
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Archive formats
+const (
+	FormatZip    = "zip"
+	FormatTarGz  = "tar.gz"
+	FormatTarZst = "tar.zst"
+)
+
+// ErrInvalidArchive is returned for unknown formats, compression levels
+// out of range and archives without paths
+var ErrInvalidArchive = errors.New("invalid archive")
+
+// archiveExtensions map the extensions of archive names to their format
+var archiveExtensions = []struct {
+	ext    string
+	format string
+}{
+	{".zip", FormatZip},
+	{".tar.gz", FormatTarGz},
+	{".tgz", FormatTarGz},
+	{".tar.zst", FormatTarZst},
+	{".tzst", FormatTarZst},
+}
+
+// Archive describes an archive to create
+type Archive struct {
+	// Paths are the files and directories archived, each stored under its
+	// name with the directories below it
+	Paths       []string
+	Destination string
+	// Format is one of the Format constants, taken from the extension of
+	// the destination when empty
+	Format string
+	// Level is the compression level from 1, fastest, to 9, smallest, 0
+	// uses the default of the format
+	Level int
+}
+
+// CheckArchive checks that an archive can be created, filling in its
+// format. The destination itself isn't checked, Compress replaces it.
+func (m *Manager) CheckArchive(a *Archive) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	if len(a.Paths) == 0 {
+		return fmt.Errorf("%w: no paths", ErrInvalidArchive)
+	}
+	if a.Format == "" {
+		name := strings.ToLower(a.Destination)
+		for _, e := range archiveExtensions {
+			if strings.HasSuffix(name, e.ext) {
+				a.Format = e.format
+				break
+			}
+		}
+	}
+	switch a.Format {
+	case FormatZip, FormatTarGz, FormatTarZst:
+	case "":
+		return fmt.Errorf("%w: format required, the destination has no archive extension", ErrInvalidArchive)
+	default:
+		return fmt.Errorf("%w: unsupported format %s", ErrInvalidArchive, a.Format)
+	}
+	if a.Level < 0 || a.Level > 9 {
+		return fmt.Errorf("%w: level must be between 1 and 9", ErrInvalidArchive)
+	}
+
+	for _, path := range a.Paths {
+		fullPath, err := m.resolveLinkPath(path)
+		if err != nil {
+			return err
+		}
+		if _, err := m.fsys.Lstat(fullPath); err != nil {
+			return err
+		}
+	}
+	dest, err := m.resolvePath(a.Destination)
+	if err != nil {
+		return err
+	}
+	if _, err := m.fsys.Stat(filepath.Dir(dest)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Compress creates an archive. It is written to a temporary file next to
+// the destination and renamed once complete, so a failed or running
+// compression never leaves a partial archive behind.
+func (m *Manager) Compress(a Archive) error {
+	if err := m.CheckArchive(&a); err != nil {
+		return err
+	}
+	dest, err := m.resolvePath(a.Destination)
+	if err != nil {
+		return err
+	}
+
+	tmp, tmpName, err := createTemp(m.fsys, filepath.Dir(dest), "."+filepath.Base(dest)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer m.fsys.Remove(tmpName)
+	w := m.limitWriter(tmp, m.sizeOf(dest))
+	defer w.release()
+
+	// The archive may be written inside a directory it contains
+	skip := func(p string) bool { return p == tmpName }
+	if a.Format == FormatZip {
+		err = m.writeZipArchive(w, a, skip)
+	} else {
+		err = m.writeTarArchive(w, a, skip)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	// createTemp makes the file private, archives get the usual mode
+	if err := m.fsys.Chmod(tmpName, 0644); err != nil {
+		return err
+	}
+	if err := m.fsys.Rename(tmpName, dest); err != nil {
+		return err
+	}
+	w.commit()
+	return nil
+}
+
+// writeZipArchive writes a zip archive of a to w. Symbolic links are left
+// out.
+func (m *Manager) writeZipArchive(w io.Writer, a Archive, skip func(string) bool) error {
+	zw := zip.NewWriter(w)
+	if a.Level > 0 {
+		zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(w, a.Level)
+		})
+	}
+
+	err := m.walkArchive(a.Paths, skip, func(name, path string, info fs.FileInfo) error {
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+			_, err := zw.CreateHeader(header)
+			return err
+		}
+		header.Method = zip.Deflate
+
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		return m.copyFrom(writer, path)
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeTarArchive writes a gzip or zstd compressed tarball of a to w.
+// Symbolic links are stored as links.
+func (m *Manager) writeTarArchive(w io.Writer, a Archive, skip func(string) bool) error {
+	var compressor io.WriteCloser
+	var err error
+	switch a.Format {
+	case FormatTarGz:
+		level := gzip.DefaultCompression
+		if a.Level > 0 {
+			level = a.Level
+		}
+		compressor, err = gzip.NewWriterLevel(w, level)
+	case FormatTarZst:
+		compressor, err = zstd.NewWriter(w, zstd.WithEncoderLevel(zstdLevel(a.Level)))
+	}
+	if err != nil {
+		return err
+	}
+
+	tw := tar.NewWriter(compressor)
+	err = m.walkArchive(a.Paths, skip, func(name, path string, info fs.FileInfo) error {
+		var link string
+		if info.Mode()&fs.ModeSymlink != 0 {
+			var err error
+			if link, err = m.fsys.Readlink(path); err != nil {
+				return err
+			}
+		} else if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		return m.copyFrom(tw, path)
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return compressor.Close()
+}
+
+// walkArchive calls fn for every path and everything below the
+// directories among them, with the name each is stored under. Symbolic
+// links are passed on without being followed.
+func (m *Manager) walkArchive(paths []string, skip func(string) bool, fn func(name, path string, info fs.FileInfo) error) error {
+	for _, path := range paths {
+		fullPath, err := m.resolveLinkPath(path)
+		if err != nil {
+			return err
+		}
+		base := filepath.Dir(fullPath)
+		err = walkFS(m.fsys, fullPath, func(p string, info fs.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if skip(p) {
+				return nil
+			}
+			rel, err := filepath.Rel(base, p)
+			if err != nil {
+				return err
+			}
+			return fn(filepath.ToSlash(rel), p, info)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zstdLevel maps a compression level from 1 to 9 to a zstd encoder level
+func zstdLevel(level int) zstd.EncoderLevel {
+	switch {
+	case level == 0:
+		return zstd.SpeedDefault
+	case level <= 2:
+		return zstd.SpeedFastest
+	case level <= 5:
+		return zstd.SpeedDefault
+	case level <= 8:
+		return zstd.SpeedBetterCompression
+	}
+	return zstd.SpeedBestCompression
+}
+
+// copyFrom copies the content of the file at path to w
+func (m *Manager) copyFrom(w io.Writer, path string) error {
+	f, err := m.fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
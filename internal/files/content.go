@@ -0,0 +1,165 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// MaxReadSize is the most a read returns at once: the whole file for
+// Read, a chunk for ReadRange
+const MaxReadSize = 10 * 1024 * 1024
+
+// ErrInvalidRange is returned for writes at offsets outside the file
+var ErrInvalidRange = errors.New("invalid range")
+
+// Chunk is a part of a file read with ReadRange
+type Chunk struct {
+	Content string `json:"content"`
+	// Offset is where the content starts in the file, the next chunk
+	// starting at Offset+Length
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+	// Size is the size of the whole file
+	Size int64 `json:"size"`
+}
+
+// ReadRange reads up to length bytes of a file from offset, MaxReadSize
+// when length is zero or larger. A negative offset counts from the end of
+// the file, to read its tail. Chunks don't end, nor start when counted
+// from the end, in the middle of a UTF-8 character, so text files can be
+// read chunk by chunk.
+func (m *Manager) ReadRange(path string, offset, length int64) (Chunk, error) {
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return Chunk{}, err
+	}
+	info, err := m.fsys.Stat(fullPath)
+	if err != nil {
+		return Chunk{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if info.IsDir() {
+		return Chunk{}, ErrIsDir
+	}
+
+	size := info.Size()
+	if length <= 0 || length > MaxReadSize {
+		length = MaxReadSize
+	}
+	fromEnd := offset < 0
+	if fromEnd {
+		offset = max(size+offset, 0)
+	}
+	offset = min(offset, size)
+
+	f, err := m.fsys.Open(fullPath)
+	if err != nil {
+		return Chunk{}, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return Chunk{}, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, length))
+	if err != nil {
+		return Chunk{}, err
+	}
+
+	if fromEnd && offset > 0 {
+		skip := 0
+		for skip < len(data) && skip < utf8.UTFMax-1 && !utf8.RuneStart(data[skip]) {
+			skip++
+		}
+		data, offset = data[skip:], offset+int64(skip)
+	}
+	if int64(len(data)) == length {
+		data = data[:runeEnd(data)]
+	}
+
+	// The file may have grown since it was checked
+	size = max(size, offset+int64(len(data)))
+	return Chunk{Content: string(data), Offset: offset, Length: int64(len(data)), Size: size}, nil
+}
+
+// runeEnd returns the length of data without a UTF-8 character cut at its
+// end, all of data when the cut character would be all there is
+func runeEnd(data []byte) int {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax+1; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) && i > 0 {
+				return i
+			}
+			break
+		}
+	}
+	return len(data)
+}
+
+// Append adds content at the end of a file, creating it when missing
+func (m *Manager) Append(path string, content []byte) error {
+	return m.writeAt(path, -1, content)
+}
+
+// WriteAt replaces the bytes of a file from offset with content, growing
+// it when content goes past its end. offset can't be past the end.
+func (m *Manager) WriteAt(path string, offset int64, content []byte) error {
+	if offset < 0 {
+		return fmt.Errorf("%w: negative offset", ErrInvalidRange)
+	}
+	return m.writeAt(path, offset, content)
+}
+
+// writeAt writes content at offset, at the end when offset is negative
+func (m *Manager) writeAt(path string, offset int64, content []byte) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if err := m.checkExtension(path); err != nil {
+		return err
+	}
+
+	flag := os.O_WRONLY
+	if offset < 0 {
+		flag |= os.O_CREATE
+	}
+	var size int64
+	if info, err := m.fsys.Stat(fullPath); err == nil {
+		if info.IsDir() {
+			return ErrIsDir
+		}
+		if offset > info.Size() {
+			return fmt.Errorf("%w: offset %d past the end of %s, %d bytes", ErrInvalidRange, offset, path, info.Size())
+		}
+		size = info.Size()
+	}
+	end := offset + int64(len(content))
+	if offset < 0 {
+		end = size + int64(len(content))
+	}
+	if err := m.reserve(end - size); err != nil {
+		return err
+	}
+
+	f, err := m.fsys.OpenFile(fullPath, flag, 0644)
+	if err != nil {
+		return err
+	}
+	// Seeking rather than O_APPEND, which SFTP servers may ignore
+	whence := io.SeekStart
+	if offset < 0 {
+		offset, whence = 0, io.SeekEnd
+	}
+	if _, err = f.Seek(offset, whence); err == nil {
+		_, err = f.Write(content)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
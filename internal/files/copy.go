@@ -0,0 +1,64 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// ErrCopyIntoItself is returned when copying a directory below itself
+var ErrCopyIntoItself = errors.New("cannot copy a directory into itself")
+
+// Copy copies a file or directory, keeping modes, modification times and,
+// where allowed, owners. Symbolic links are copied as links, sockets,
+// pipes and devices are left out. progress, if not nil, is called as the
+// copy goes on. An existing destination is never replaced, and a failed
+// copy removes what was copied.
+func (m *Manager) Copy(srcPath, dstPath string, progress ProgressFunc) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	src, err := m.resolveLinkPath(srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := m.resolveLinkPath(dstPath)
+	if err != nil {
+		return err
+	}
+	if within(src, dst) {
+		return fmt.Errorf("%w: %s", ErrCopyIntoItself, srcPath)
+	}
+	if _, err := m.fsys.Lstat(dst); err == nil {
+		return fmt.Errorf("%s: %w", dstPath, fs.ErrExist)
+	}
+
+	total, err := treeSize(m.fsys, src)
+	if err != nil {
+		return err
+	}
+	if err := m.reserve(total); err != nil {
+		return err
+	}
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	progress(0, total)
+
+	c := &treeCopier{fsys: m.fsys, total: total, progress: progress, skipSpecial: true}
+	if err := c.copy(src, dst); err != nil {
+		m.fsys.RemoveAll(dst)
+		return fmt.Errorf("failed to copy %s: %w", srcPath, err)
+	}
+	return nil
+}
+
+// Size returns the size of a file, or of the regular files below a
+// directory, telling how long copying it takes
+func (m *Manager) Size(path string) (int64, error) {
+	fullPath, err := m.resolveLinkPath(path)
+	if err != nil {
+		return 0, err
+	}
+	return treeSize(m.fsys, fullPath)
+}
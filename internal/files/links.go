@@ -0,0 +1,105 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrNotSymlink is returned when reading the target of a file that
+	// isn't a symbolic link
+	ErrNotSymlink = errors.New("not a symbolic link")
+	// ErrInvalidLink is returned for links that can't be created, like
+	// targets outside the root or hard links to directories
+	ErrInvalidLink = errors.New("invalid link")
+)
+
+// Link is a symbolic link and where it leads
+type Link struct {
+	Path string `json:"path"`
+	// Target is the target as stored in the link, relative to its
+	// directory unless absolute
+	Target string `json:"target"`
+	// Resolved is the absolute path the link leads to following every
+	// link on the way, empty when the link is broken
+	Resolved string `json:"resolved,omitempty"`
+}
+
+// Readlink returns the target of a symbolic link
+func (m *Manager) Readlink(path string) (Link, error) {
+	fullPath, err := m.resolveLinkPath(path)
+	if err != nil {
+		return Link{}, err
+	}
+	info, err := m.fsys.Lstat(fullPath)
+	if err != nil {
+		return Link{}, err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return Link{}, fmt.Errorf("%w: %s", ErrNotSymlink, path)
+	}
+
+	target, err := m.fsys.Readlink(fullPath)
+	if err != nil {
+		return Link{}, err
+	}
+	link := Link{Path: path, Target: target}
+	link.Resolved, _ = m.fsys.EvalSymlinks(fullPath)
+	return link, nil
+}
+
+// Symlink creates a symbolic link at path pointing to target, which is
+// stored as given. A relative target is taken from the directory of the
+// link and must stay inside the root, as an absolute one.
+func (m *Manager) Symlink(target, path string) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	fullPath, err := m.resolveLinkPath(path)
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("%w: target required", ErrInvalidLink)
+	}
+	dest := target
+	if !filepath.IsAbs(dest) {
+		dest = filepath.Join(filepath.Dir(fullPath), dest)
+	}
+	if _, err := m.resolvePath(dest); err != nil {
+		return fmt.Errorf("%w: target outside root", ErrInvalidLink)
+	}
+
+	return m.fsys.Symlink(target, fullPath)
+}
+
+// Hardlink creates a hard link at path to the file at target, which must
+// be on the same filesystem
+func (m *Manager) Hardlink(target, path string) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	fullPath, err := m.resolveLinkPath(path)
+	if err != nil {
+		return err
+	}
+	fullTarget, err := m.resolveLinkPath(target)
+	if err != nil {
+		return err
+	}
+	info, err := m.fsys.Lstat(fullTarget)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%w: hard links to directories aren't allowed", ErrInvalidLink)
+	}
+
+	err = m.fsys.Link(fullTarget, fullPath)
+	if IsCrossDevice(err) {
+		return fmt.Errorf("%w: hard links can't cross filesystems", ErrInvalidLink)
+	}
+	return err
+}
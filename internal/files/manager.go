@@ -2,15 +2,35 @@ package files
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// Errors callers can tell apart with errors.Is. Missing files are reported
+// with errors matching fs.ErrNotExist.
+var (
+	// ErrOutsideRoot is returned for paths outside the root directory
+	ErrOutsideRoot = errors.New("path outside root directory")
+	// ErrDeleteRoot is returned when deleting the root directory
+	ErrDeleteRoot = errors.New("cannot delete root directory")
+	// ErrExtension is returned for file extensions that aren't allowed
+	ErrExtension = errors.New("file extension not allowed")
+	// ErrIsDir is returned when reading a directory as a file
+	ErrIsDir = errors.New("cannot read directory")
+	// ErrTooLarge is returned when reading files too large to return whole
+	ErrTooLarge = errors.New("file too large to read")
+	// ErrReadOnly is returned for changes to the files of a read-only root
+	ErrReadOnly = errors.New("read-only root")
+)
+
 // FileInfo contains file information
 type FileInfo struct {
 	Name        string    `json:"name"`
@@ -23,24 +43,103 @@ type FileInfo struct {
 	Extension   string    `json:"extension,omitempty"`
 	MimeType    string    `json:"mime_type,omitempty"`
 	Permissions string    `json:"permissions"`
+	Owner       string    `json:"owner,omitempty"`
+	Group       string    `json:"group,omitempty"`
+	// LinkTarget is the target stored in a symbolic link
+	LinkTarget string `json:"link_target,omitempty"`
+	// LinkResolved is the path a symbolic link leads to, set by Info unless
+	// the link is broken
+	LinkResolved string `json:"link_resolved,omitempty"`
 }
 
 // Manager manages file operations
 type Manager struct {
+	// fsys is the filesystem the root is on
+	fsys              FS
 	rootPath          string
 	maxUploadSize     int64
 	allowedExtensions []string
+	readOnly          bool
+	quota             int64
+	minFree           int64
+	uploadDir         string
+	uploadExpiry      time.Duration
+	// uploadLocks holds a *sync.Mutex per resumable upload
+	uploadLocks sync.Map
+	// watcher is started by the first Watch
+	watcher *watcher
+	mu      sync.RWMutex
+	// usedBytes is the size of the root measured at usedAt, checked
+	// against its quota
+	usedBytes int64
+	usedAt    time.Time
+	// pending is the space set aside for writes in progress, not part of
+	// the root yet
+	pending int64
+	usageMu sync.Mutex
+	// reserveMu serializes checking the space left and setting it aside
+	reserveMu sync.Mutex
+	// uploadSpace holds the *reservation of each resumable upload
+	uploadSpace sync.Map
 }
 
 // NewManager creates a new file manager
 func NewManager(rootPath string, maxUploadSize int64, allowedExtensions []string) *Manager {
 	return &Manager{
+		fsys:              osFS{},
 		rootPath:          rootPath,
 		maxUploadSize:     maxUploadSize,
 		allowedExtensions: allowedExtensions,
 	}
 }
 
+// Configure replaces the root and upload limits, used when the configuration is reloaded
+func (m *Manager) Configure(rootPath string, maxUploadSize int64, allowedExtensions []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rootPath = rootPath
+	m.maxUploadSize = maxUploadSize
+	m.allowedExtensions = allowedExtensions
+}
+
+// SetReadOnly makes the manager refuse every change with ErrReadOnly
+func (m *Manager) SetReadOnly(readOnly bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.readOnly = readOnly
+}
+
+// writable returns ErrReadOnly when the manager is read-only
+func (m *Manager) writable() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.readOnly {
+		return ErrReadOnly
+	}
+	return nil
+}
+
+// root returns the root directory
+func (m *Manager) root() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.rootPath
+}
+
+// uploadLimit returns the maximum upload size
+func (m *Manager) uploadLimit() int64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.maxUploadSize
+}
+
+// extensions returns the allowed upload extensions
+func (m *Manager) extensions() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.allowedExtensions
+}
+
 // List returns files in a directory
 func (m *Manager) List(path string) ([]FileInfo, error) {
 	fullPath, err := m.resolvePath(path)
@@ -48,31 +147,30 @@ func (m *Manager) List(path string) ([]FileInfo, error) {
 		return nil, err
 	}
 
-	entries, err := os.ReadDir(fullPath)
+	entries, err := m.fsys.ReadDir(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read directory: %w", err)
 	}
 
 	var files []FileInfo
-	for _, entry := range entries {
-		info, err := entry.Info()
-		if err != nil {
-			continue
-		}
-
+	for _, info := range entries {
 		file := FileInfo{
-			Name:        entry.Name(),
-			Path:        filepath.Join(path, entry.Name()),
+			Name:        info.Name(),
+			Path:        filepath.Join(path, info.Name()),
 			Size:        info.Size(),
 			Mode:        info.Mode().String(),
 			ModTime:     info.ModTime(),
-			IsDir:       entry.IsDir(),
+			IsDir:       info.IsDir(),
 			IsSymlink:   info.Mode()&os.ModeSymlink != 0,
 			Permissions: formatPermissions(info.Mode()),
 		}
+		file.Owner, file.Group = ownerOf(info)
+		if file.IsSymlink {
+			file.LinkTarget, _ = m.fsys.Readlink(filepath.Join(fullPath, info.Name()))
+		}
 
-		if !entry.IsDir() {
-			file.Extension = strings.TrimPrefix(filepath.Ext(entry.Name()), ".")
+		if !info.IsDir() {
+			file.Extension = strings.TrimPrefix(filepath.Ext(info.Name()), ".")
 			file.MimeType = getMimeType(file.Extension)
 		}
 
@@ -90,28 +188,42 @@ func (m *Manager) List(path string) ([]FileInfo, error) {
 	return files, nil
 }
 
-// Info returns information about a file or directory
+// Info returns information about a file or directory. Symbolic links are
+// described by their target, with the link target set, and by themselves
+// when broken or leading out of the root.
 func (m *Manager) Info(path string) (FileInfo, error) {
-	fullPath, err := m.resolvePath(path)
+	fullPath, err := m.resolveLinkPath(path)
 	if err != nil {
 		return FileInfo{}, err
 	}
 
-	info, err := os.Stat(fullPath)
+	info, err := m.fsys.Lstat(fullPath)
 	if err != nil {
 		return FileInfo{}, fmt.Errorf("failed to stat file: %w", err)
 	}
+	isSymlink := info.Mode()&os.ModeSymlink != 0
+	var linkTarget, linkResolved string
+	if isSymlink {
+		linkTarget, _ = m.fsys.Readlink(fullPath)
+		if target, err := m.fsys.Stat(fullPath); err == nil && m.checkLinks(fullPath) == nil {
+			info = target
+			linkResolved, _ = m.fsys.EvalSymlinks(fullPath)
+		}
+	}
 
 	file := FileInfo{
-		Name:        info.Name(),
-		Path:        path,
-		Size:        info.Size(),
-		Mode:        info.Mode().String(),
-		ModTime:     info.ModTime(),
-		IsDir:       info.IsDir(),
-		IsSymlink:   info.Mode()&os.ModeSymlink != 0,
-		Permissions: formatPermissions(info.Mode()),
-	}
+		Name:         filepath.Base(fullPath),
+		Path:         path,
+		Size:         info.Size(),
+		Mode:         info.Mode().String(),
+		ModTime:      info.ModTime(),
+		IsDir:        info.IsDir(),
+		IsSymlink:    isSymlink,
+		Permissions:  formatPermissions(info.Mode()),
+		LinkTarget:   linkTarget,
+		LinkResolved: linkResolved,
+	}
+	file.Owner, file.Group = ownerOf(info)
 
 	if !info.IsDir() {
 		file.Extension = strings.TrimPrefix(filepath.Ext(info.Name()), ".")
@@ -129,25 +241,28 @@ func (m *Manager) Read(path string) ([]byte, error) {
 	}
 
 	// Check file size
-	info, err := os.Stat(fullPath)
+	info, err := m.fsys.Stat(fullPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to stat file: %w", err)
 	}
 
 	if info.IsDir() {
-		return nil, fmt.Errorf("cannot read directory")
+		return nil, ErrIsDir
 	}
 
 	// Limit file size for reading
-	if info.Size() > 10*1024*1024 { // 10MB limit
-		return nil, fmt.Errorf("file too large to read")
+	if info.Size() > MaxReadSize {
+		return nil, ErrTooLarge
 	}
 
-	return os.ReadFile(fullPath)
+	return readFile(m.fsys, fullPath)
 }
 
 // Write writes content to a file
 func (m *Manager) Write(path string, content []byte) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
 	fullPath, err := m.resolvePath(path)
 	if err != nil {
 		return err
@@ -156,82 +271,72 @@ func (m *Manager) Write(path string, content []byte) error {
 	if err := m.checkExtension(path); err != nil {
 		return err
 	}
+	if err := m.reserve(int64(len(content)) - m.sizeOf(fullPath)); err != nil {
+		return err
+	}
 
-	return os.WriteFile(fullPath, content, 0644)
+	return writeFile(m.fsys, fullPath, content, 0644)
 }
 
 // CreateDir creates a directory
 func (m *Manager) CreateDir(path string) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
 	fullPath, err := m.resolvePath(path)
 	if err != nil {
 		return err
 	}
 
-	return os.MkdirAll(fullPath, 0755)
+	return m.fsys.MkdirAll(fullPath, 0755)
 }
 
-// Delete deletes a file or directory
+// Delete deletes a file or directory, symbolic links and not their target
 func (m *Manager) Delete(path string) error {
-	fullPath, err := m.resolvePath(path)
+	if err := m.writable(); err != nil {
+		return err
+	}
+	fullPath, err := m.resolveLinkPath(path)
 	if err != nil {
 		return err
 	}
 
 	// Prevent deleting root
-	if fullPath == m.rootPath || fullPath == "/" {
-		return fmt.Errorf("cannot delete root directory")
+	if fullPath == filepath.Clean(m.root()) || fullPath == "/" {
+		return ErrDeleteRoot
 	}
 
-	return os.RemoveAll(fullPath)
+	defer m.forgetUsage()
+	return m.fsys.RemoveAll(fullPath)
 }
 
 // Rename renames a file or directory
 func (m *Manager) Rename(oldPath, newPath string) error {
-	oldFullPath, err := m.resolvePath(oldPath)
-	if err != nil {
+	if err := m.writable(); err != nil {
 		return err
 	}
-
-	newFullPath, err := m.resolvePath(newPath)
+	oldFullPath, err := m.resolveLinkPath(oldPath)
 	if err != nil {
 		return err
 	}
 
-	return os.Rename(oldFullPath, newFullPath)
-}
-
-// Copy copies a file or directory
-func (m *Manager) Copy(srcPath, dstPath string) error {
-	srcFullPath, err := m.resolvePath(srcPath)
+	newFullPath, err := m.resolveLinkPath(newPath)
 	if err != nil {
 		return err
 	}
 
-	dstFullPath, err := m.resolvePath(dstPath)
-	if err != nil {
-		return err
-	}
-
-	info, err := os.Stat(srcFullPath)
-	if err != nil {
-		return err
-	}
-
-	if info.IsDir() {
-		return m.copyDir(srcFullPath, dstFullPath)
-	}
-	return m.copyFile(srcFullPath, dstFullPath)
+	return m.fsys.Rename(oldFullPath, newFullPath)
 }
 
 // copyFile copies a single file
 func (m *Manager) copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
+	srcFile, err := m.fsys.Open(src)
 	if err != nil {
 		return err
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	dstFile, err := m.fsys.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
@@ -241,196 +346,276 @@ func (m *Manager) copyFile(src, dst string) error {
 	return err
 }
 
-// copyDir copies a directory recursively
-func (m *Manager) copyDir(src, dst string) error {
-	if err := os.MkdirAll(dst, 0755); err != nil {
+// Upload handles file upload
+func (m *Manager) Upload(path string, reader io.Reader, filename string) error {
+	if err := m.writable(); err != nil {
 		return err
 	}
-
-	entries, err := os.ReadDir(src)
+	fullPath, err := m.resolvePath(path)
 	if err != nil {
 		return err
 	}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			if err := m.copyDir(srcPath, dstPath); err != nil {
-				return err
-			}
-		} else {
-			if err := m.copyFile(srcPath, dstPath); err != nil {
-				return err
-			}
-		}
-	}
-
-	return nil
-}
-
-// Upload handles file upload
-func (m *Manager) Upload(path string, reader io.Reader, filename string) error {
-	fullPath, err := m.resolvePath(path)
-	if err != nil {
+	if err := m.checkExtension(filename); err != nil {
 		return err
 	}
 
-	if err := m.checkExtension(filename); err != nil {
+	// The file may exist already as a link
+	targetPath, err := m.resolvePath(filepath.Join(fullPath, filepath.Base(filename)))
+	if err != nil {
 		return err
 	}
 
-	targetPath := filepath.Join(fullPath, filename)
-	
-	file, err := os.Create(targetPath)
+	freed := m.sizeOf(targetPath)
+	file, err := m.fsys.OpenFile(targetPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return fmt.Errorf("failed to create file: %w", err)
 	}
-	defer file.Close()
+	w := m.limitWriter(file, freed)
 
 	// Limit upload size
-	limitedReader := io.LimitReader(reader, m.maxUploadSize)
+	limitedReader := io.LimitReader(reader, m.uploadLimit())
 	
-	_, err = io.Copy(file, limitedReader)
+	_, err = io.Copy(w, limitedReader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		w.release()
+	}
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrNoSpace) {
+		// What doesn't fit isn't kept half written
+		m.fsys.Remove(targetPath)
+		return err
+	}
+	if err == nil {
+		w.commit()
+	}
 	return err
 }
 
-// Download prepares a file for download
-func (m *Manager) Download(path string) (io.ReadCloser, int64, error) {
+// Open opens a file for download with its info. Directories are
+// downloaded as zip archives with WriteZip instead, Open returns ErrIsDir
+// for them.
+func (m *Manager) Open(path string) (File, os.FileInfo, error) {
 	fullPath, err := m.resolvePath(path)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
 
-	info, err := os.Stat(fullPath)
+	info, err := m.fsys.Stat(fullPath)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
-
 	if info.IsDir() {
-		// Create zip file for directory
-		return m.zipDirectory(fullPath)
+		return nil, nil, ErrIsDir
 	}
 
-	file, err := os.Open(fullPath)
+	file, err := m.fsys.Open(fullPath)
 	if err != nil {
-		return nil, 0, err
+		return nil, nil, err
 	}
-
-	return file, info.Size(), nil
+	return file, info, nil
 }
 
-// zipDirectory creates a zip archive of a directory
-func (m *Manager) zipDirectory(path string) (io.ReadCloser, int64, error) {
-	// Create temporary file for zip
-	tmpFile, err := os.CreateTemp("", "nebula-download-*.zip")
+// WriteZip writes a zip archive of a directory to w as it is built, so
+// large directories need neither memory nor temporary files. Files and
+// archives over 4 GiB, or with more than 65535 entries, get Zip64 records.
+// Each file is written with the size it had when the walk reached it, so a
+// file still growing, like a log, cannot keep the archive streaming.
+// Symbolic links and other special files are left out.
+func (m *Manager) WriteZip(path string, w io.Writer) error {
+	fullPath, err := m.resolvePath(path)
 	if err != nil {
-		return nil, 0, err
+		return err
 	}
 
-	zipWriter := zip.NewWriter(tmpFile)
-
-	basePath := filepath.Dir(path)
-	err = filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
+	zipWriter := zip.NewWriter(w)
+	basePath := filepath.Dir(fullPath)
+	err = walkFS(m.fsys, fullPath, func(filePath string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
 
 		relPath, err := filepath.Rel(basePath, filePath)
 		if err != nil {
 			return err
 		}
-
-		if info.IsDir() {
-			return nil
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
 		}
+		header.Name = filepath.ToSlash(relPath)
+		header.Method = zip.Deflate
 
-		writer, err := zipWriter.Create(relPath)
+		writer, err := zipWriter.CreateHeader(header)
 		if err != nil {
 			return err
 		}
 
-		file, err := os.Open(filePath)
+		file, err := m.fsys.Open(filePath)
 		if err != nil {
 			return err
 		}
 		defer file.Close()
 
-		_, err = io.Copy(writer, file)
+		_, err = io.Copy(writer, io.LimitReader(file, info.Size()))
 		return err
 	})
-
 	if err != nil {
-		zipWriter.Close()
-		tmpFile.Close()
-		os.Remove(tmpFile.Name())
-		return nil, 0, err
+		return err
 	}
-
-	zipWriter.Close()
-
-	// Get file size
-	info, _ := tmpFile.Stat()
-	size := info.Size()
-
-	// Seek to beginning
-	tmpFile.Seek(0, 0)
-
-	return &tempFileReader{tmpFile}, size, nil
+	return zipWriter.Close()
 }
 
-// tempFileReader wraps a temp file and deletes it on close
-type tempFileReader struct {
-	*os.File
+// resolvePath resolves and validates a path. The symbolic links on the way
+// are followed, the last one too, and must not lead out of the root.
+func (m *Manager) resolvePath(path string) (string, error) {
+	absPath, err := m.absPath(path)
+	if err != nil {
+		return "", err
+	}
+	if err := m.checkLinks(absPath); err != nil {
+		return "", err
+	}
+	return absPath, nil
 }
 
-func (t *tempFileReader) Close() error {
-	name := t.File.Name()
-	t.File.Close()
-	return os.Remove(name)
+// resolveLinkPath is resolvePath for operations on a symbolic link itself,
+// like deleting or renaming it: only the links leading to it are checked,
+// so it may point anywhere.
+func (m *Manager) resolveLinkPath(path string) (string, error) {
+	absPath, err := m.absPath(path)
+	if err != nil {
+		return "", err
+	}
+	if err := m.checkLinks(filepath.Dir(absPath)); err != nil {
+		return "", err
+	}
+	return absPath, nil
 }
 
-// resolvePath resolves and validates a path
-func (m *Manager) resolvePath(path string) (string, error) {
-	// Clean the path
+// absPath returns the absolute path of path, relative ones taken from the
+// root, checking that it is inside the root before following links
+func (m *Manager) absPath(path string) (string, error) {
 	cleanPath := filepath.Clean(path)
-	
-	// Make it relative to root
+	rootPath := filepath.Clean(m.root())
 	if !filepath.IsAbs(cleanPath) {
-		cleanPath = filepath.Join(m.rootPath, cleanPath)
+		cleanPath = filepath.Join(rootPath, cleanPath)
 	}
 
-	// Resolve to absolute path
 	absPath, err := filepath.Abs(cleanPath)
 	if err != nil {
 		return "", err
 	}
+	if !within(rootPath, absPath) {
+		return "", ErrOutsideRoot
+	}
+	return absPath, nil
+}
 
-	// Ensure path is within root
-	if m.rootPath != "/" {
-		if !strings.HasPrefix(absPath, m.rootPath) {
-			return "", fmt.Errorf("path outside root directory")
+// checkLinks returns ErrOutsideRoot when a symbolic link on path leads out
+// of the root. Missing elements at the end of path are taken as they are,
+// broken links by the path they would create.
+func (m *Manager) checkLinks(path string) error {
+	rootPath := filepath.Clean(m.root())
+	realRoot, err := m.fsys.EvalSymlinks(rootPath)
+	if err != nil {
+		realRoot = rootPath
+	}
+	resolved, err := resolveLinks(m.fsys, path, 0)
+	if err != nil {
+		return err
+	}
+	if !within(realRoot, resolved) {
+		return ErrOutsideRoot
+	}
+	return nil
+}
+
+// maxLinks is the number of broken links resolveLinks follows in a row,
+// as many as Linux does
+const maxLinks = 40
+
+// resolveLinks returns path with its symbolic links followed, also when its
+// end doesn't exist yet
+func resolveLinks(fsys FS, path string, links int) (string, error) {
+	resolved, err := fsys.EvalSymlinks(path)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return resolved, err
+	}
+
+	if info, err := fsys.Lstat(path); err == nil && info.Mode()&fs.ModeSymlink != 0 {
+		// Writing to a broken link creates its target
+		if links >= maxLinks {
+			return "", fmt.Errorf("%w: too many symbolic links", ErrOutsideRoot)
+		}
+		target, err := fsys.Readlink(path)
+		if err != nil {
+			return "", err
 		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		return resolveLinks(fsys, target, links+1)
 	}
 
-	return absPath, nil
+	dir := filepath.Dir(path)
+	if dir == path {
+		return path, nil
+	}
+	parent, err := resolveLinks(fsys, dir, links)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, filepath.Base(path)), nil
+}
+
+// within reports whether path is root or below it
+func within(root, path string) bool {
+	if root == string(filepath.Separator) {
+		return filepath.IsAbs(path)
+	}
+	return path == root || strings.HasPrefix(path, root+string(filepath.Separator))
+}
+
+// ResolveDir resolves a path against the root policy and ensures it is a directory
+func (m *Manager) ResolveDir(path string) (string, error) {
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	info, err := m.fsys.Stat(fullPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat directory: %w", err)
+	}
+
+	if !info.IsDir() {
+		return "", fmt.Errorf("not a directory: %s", path)
+	}
+
+	return fullPath, nil
 }
 
 // checkExtension validates file extension
 func (m *Manager) checkExtension(filename string) error {
-	if len(m.allowedExtensions) == 0 {
+	allowedExtensions := m.extensions()
+	if len(allowedExtensions) == 0 {
 		return nil // All extensions allowed
 	}
 
 	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), "."))
-	for _, allowed := range m.allowedExtensions {
+	for _, allowed := range allowedExtensions {
 		if strings.ToLower(allowed) == ext {
 			return nil
 		}
 	}
 
-	return fmt.Errorf("file extension not allowed: %s", ext)
+	return fmt.Errorf("%w: %s", ErrExtension, ext)
 }
 
 // formatPermissions formats file permissions as rwxrwxrwx
@@ -500,7 +685,7 @@ func (m *Manager) Search(basePath, pattern string) ([]FileInfo, error) {
 	}
 
 	var results []FileInfo
-	err = filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
+	err = walkFS(m.fsys, fullPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Skip errors
 		}
@@ -511,7 +696,7 @@ func (m *Manager) Search(basePath, pattern string) ([]FileInfo, error) {
 		}
 
 		if matched {
-			relPath, _ := filepath.Rel(m.rootPath, path)
+			relPath, _ := filepath.Rel(m.root(), path)
 			results = append(results, FileInfo{
 				Name:        info.Name(),
 				Path:        relPath,
@@ -0,0 +1,178 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// ProgressFunc is called with the bytes copied so far and the total to copy
+type ProgressFunc func(done, total int64)
+
+// IsCrossDevice reports whether err is a rename failing because source and
+// destination are on different filesystems
+func IsCrossDevice(err error) bool {
+	return errors.Is(err, syscall.EXDEV)
+}
+
+// Move moves a file or directory, renaming it when possible. Across
+// filesystems it is copied, keeping modes, modification times and, where
+// allowed, owners, then the source is deleted. progress, if not nil, is
+// called as the copy goes on. A failed copy leaves the source untouched
+// and removes what was copied.
+func (m *Manager) Move(srcPath, dstPath string, progress ProgressFunc) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	src, err := m.resolveLinkPath(srcPath)
+	if err != nil {
+		return err
+	}
+	dst, err := m.resolveLinkPath(dstPath)
+	if err != nil {
+		return err
+	}
+	if src == filepath.Clean(m.root()) {
+		return ErrDeleteRoot
+	}
+
+	err = m.fsys.Rename(src, dst)
+	if err == nil || !IsCrossDevice(err) {
+		return err
+	}
+
+	if _, err := m.fsys.Lstat(dst); err == nil {
+		return fmt.Errorf("%s: %w", dstPath, fs.ErrExist)
+	}
+	total, err := treeSize(m.fsys, src)
+	if err != nil {
+		return err
+	}
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	progress(0, total)
+
+	c := &treeCopier{fsys: m.fsys, total: total, progress: progress}
+	if err := c.copy(src, dst); err != nil {
+		m.fsys.RemoveAll(dst)
+		return fmt.Errorf("failed to move %s: %w", srcPath, err)
+	}
+	return m.fsys.RemoveAll(src)
+}
+
+// treeSize returns the size of the regular files at or below path
+func treeSize(fsys FS, path string) (int64, error) {
+	var total int64
+	err := walkFS(fsys, path, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// treeCopier copies a tree keeping its metadata, counting the bytes copied
+type treeCopier struct {
+	fsys     FS
+	done     int64
+	total    int64
+	progress ProgressFunc
+	// skipSpecial leaves out the files that can't be copied instead of
+	// failing
+	skipSpecial bool
+}
+
+// copy copies the file, link or directory at src to dst. Directories get
+// their times once their content is written, which changes them.
+func (c *treeCopier) copy(src, dst string) error {
+	info, err := c.fsys.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := c.fsys.Readlink(src)
+		if err != nil {
+			return err
+		}
+		if err := c.fsys.Symlink(target, dst); err != nil {
+			return err
+		}
+		preserveOwner(c.fsys, dst, info)
+		return nil
+	case info.IsDir():
+		if err := c.fsys.Mkdir(dst, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := c.fsys.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := c.copy(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+				return err
+			}
+		}
+	case info.Mode().IsRegular():
+		if err := c.copyFile(src, dst, info); err != nil {
+			return err
+		}
+	case c.skipSpecial:
+		return nil
+	default:
+		// Sockets, pipes and devices can't be copied, only recreated
+		return fmt.Errorf("cannot copy special file %s", src)
+	}
+
+	preserveOwner(c.fsys, dst, info)
+	// Mode bits beyond the permissions, like setgid, aren't set by creation
+	if err := c.fsys.Chmod(dst, info.Mode()); err != nil {
+		return err
+	}
+	return c.fsys.Chtimes(dst, time.Now(), info.ModTime())
+}
+
+// copyFile copies the content of a regular file, reporting progress
+func (c *treeCopier) copyFile(src, dst string, info fs.FileInfo) error {
+	in, err := c.fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := c.fsys.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, &progressReader{r: in, c: c})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// progressReader reports the bytes read through it to a treeCopier
+type progressReader struct {
+	r io.Reader
+	c *treeCopier
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.c.done += int64(n)
+		r.c.progress(r.c.done, r.c.total)
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+//go:build !windows
+
+package files
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// ownerNames caches the names of user and group IDs, looked up for every
+// listed file
+var ownerNames sync.Map
+
+// fileOwner returns the names of the owner and group of a file, their IDs
+// when they have no name
+func fileOwner(info fs.FileInfo) (string, string) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", ""
+	}
+	return ownerName(strconv.FormatUint(uint64(st.Uid), 10), false), ownerName(strconv.FormatUint(uint64(st.Gid), 10), true)
+}
+
+// ownerName returns the name of a user or group ID
+func ownerName(id string, group bool) string {
+	key := "u" + id
+	if group {
+		key = "g" + id
+	}
+	if name, ok := ownerNames.Load(key); ok {
+		return name.(string)
+	}
+
+	name := id
+	if group {
+		if g, err := user.LookupGroupId(id); err == nil {
+			name = g.Name
+		}
+	} else if u, err := user.LookupId(id); err == nil {
+		name = u.Username
+	}
+	ownerNames.Store(key, name)
+	return name
+}
+
+// checkPrivateDir makes sure no other user can read or swap the files of
+// dir, such as a staging directory in the shared temporary directory that
+// someone else may have created first. dir must be a real directory and it
+// and its parents must belong to the process or root, without being
+// writable by others unless sticky like /tmp. dir itself is made
+// accessible to its owner only.
+func checkPrivateDir(dir string) error {
+	uid := uint32(os.Geteuid())
+	dir = filepath.Clean(dir)
+	for p := dir; ; p = filepath.Dir(p) {
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+		st, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		mode := info.Mode()
+		switch {
+		case st.Uid != uid && st.Uid != 0:
+			return fmt.Errorf("%s is owned by another user", p)
+		case p == dir && !mode.IsDir():
+			return fmt.Errorf("%s is not a directory", p)
+		case mode.IsDir() && mode.Perm()&0022 != 0 && mode&fs.ModeSticky == 0:
+			return fmt.Errorf("%s is writable by other users", p)
+		}
+		if filepath.Dir(p) == p {
+			break
+		}
+	}
+
+	if info, err := os.Lstat(dir); err == nil && info.Mode().Perm()&0077 != 0 {
+		return os.Chmod(dir, 0700)
+	}
+	return nil
+}
+
+// preserveOwner gives path the owner and group of info, ignoring failures:
+// only root may give files away
+func preserveOwner(fsys FS, path string, info fs.FileInfo) {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		fsys.Lchown(path, int(st.Uid), int(st.Gid))
+	}
+}
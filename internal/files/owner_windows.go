@@ -0,0 +1,20 @@
+//go:build windows
+
+package files
+
+import "io/fs"
+
+// fileOwner reports no owner, Windows files have ACLs instead
+func fileOwner(info fs.FileInfo) (string, string) {
+	return "", ""
+}
+
+// checkPrivateDir does nothing, the temporary directory of a Windows user
+// is already private
+func checkPrivateDir(dir string) error {
+	return nil
+}
+
+// preserveOwner does nothing, moved files inherit the ACLs of their new
+// directory
+func preserveOwner(fsys FS, path string, info fs.FileInfo) {}
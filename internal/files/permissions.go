@@ -0,0 +1,260 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrInvalidMode is returned for modes that are neither octal nor symbolic
+	ErrInvalidMode = errors.New("invalid mode")
+	// ErrUnknownOwner is returned for users and groups that don't exist
+	ErrUnknownOwner = errors.New("unknown user or group")
+)
+
+// Permission bits of chmod modes
+const (
+	modeSetuid = 04000
+	modeSetgid = 02000
+	modeSticky = 01000
+)
+
+// SetPermissions changes the mode of a file or directory, and with
+// recursive of everything below a directory. mode is octal, e.g. 0755, or
+// symbolic as chmod takes it, e.g. u+x,go-w or a=rX. Symbolic links below
+// the path are skipped, changing them would change their target.
+func (m *Manager) SetPermissions(path, mode string, recursive bool) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	apply, err := parseMode(mode)
+	if err != nil {
+		return err
+	}
+
+	return m.walk(fullPath, recursive, func(p string, info fs.FileInfo) error {
+		return m.fsys.Chmod(p, toFileMode(apply(fromFileMode(info.Mode()), info.IsDir())))
+	})
+}
+
+// SetOwner changes the owner and group of a file or directory, and with
+// recursive of everything below a directory. Both are names or numeric
+// IDs, only IDs on remote hosts, an empty one is left unchanged.
+func (m *Manager) SetOwner(path, owner, group string, recursive bool) error {
+	if err := m.writable(); err != nil {
+		return err
+	}
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return err
+	}
+	if owner == "" && group == "" {
+		return fmt.Errorf("%w: owner or group required", ErrUnknownOwner)
+	}
+	if !isLocal(m.fsys) {
+		// Names of this host mean nothing on a remote one
+		for _, name := range []string{owner, group} {
+			if _, err := strconv.Atoi(name); name != "" && err != nil {
+				return fmt.Errorf("%w: remote owners and groups are numeric IDs", ErrUnknownOwner)
+			}
+		}
+	}
+	uid, gid := -1, -1
+	if owner != "" {
+		if uid, err = lookupID(owner, false); err != nil {
+			return err
+		}
+	}
+	if group != "" {
+		if gid, err = lookupID(group, true); err != nil {
+			return err
+		}
+	}
+
+	return m.walk(fullPath, recursive, func(p string, info fs.FileInfo) error {
+		return m.fsys.Chown(p, uid, gid)
+	})
+}
+
+// walk calls fn for path, and with recursive for everything below it that
+// isn't a symbolic link
+func (m *Manager) walk(path string, recursive bool, fn func(string, fs.FileInfo) error) error {
+	info, err := m.fsys.Stat(path)
+	if err != nil {
+		return err
+	}
+	if !recursive || !info.IsDir() {
+		return fn(path, info)
+	}
+	return walkFS(m.fsys, path, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		return fn(p, info)
+	})
+}
+
+// lookupID returns the ID of a user or group given by name or ID
+func lookupID(name string, group bool) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil && id >= 0 {
+		return id, nil
+	}
+	var id string
+	if group {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return 0, fmt.Errorf("%w: group %s", ErrUnknownOwner, name)
+		}
+		id = g.Gid
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return 0, fmt.Errorf("%w: user %s", ErrUnknownOwner, name)
+		}
+		id = u.Uid
+	}
+	n, err := strconv.Atoi(id)
+	if err != nil {
+		// Windows identifies accounts by SID
+		return 0, fmt.Errorf("%w: %s has no numeric ID", ErrUnknownOwner, name)
+	}
+	return n, nil
+}
+
+// parseMode parses an octal or symbolic mode into a function computing the
+// new chmod bits of a file from its current ones
+func parseMode(mode string) (func(bits uint32, isDir bool) uint32, error) {
+	mode = strings.TrimSpace(mode)
+	if mode == "" {
+		return nil, fmt.Errorf("%w: mode required", ErrInvalidMode)
+	}
+	if mode[0] >= '0' && mode[0] <= '9' {
+		v, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || v > 07777 {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidMode, mode)
+		}
+		return func(uint32, bool) uint32 { return uint32(v) }, nil
+	}
+
+	clauses := strings.Split(mode, ",")
+	for _, clause := range clauses {
+		if _, err := applyClause(0, clause, false); err != nil {
+			return nil, err
+		}
+	}
+	return func(bits uint32, isDir bool) uint32 {
+		for _, clause := range clauses {
+			bits, _ = applyClause(bits, clause, isDir)
+		}
+		return bits
+	}, nil
+}
+
+// applyClause applies a symbolic clause such as ug+rw or o= to bits
+func applyClause(bits uint32, clause string, isDir bool) (uint32, error) {
+	invalid := fmt.Errorf("%w: %s", ErrInvalidMode, clause)
+
+	// Who the clause applies to, everyone when omitted
+	var who uint32
+	i := 0
+	for ; i < len(clause) && strings.IndexByte("ugoa", clause[i]) >= 0; i++ {
+		switch clause[i] {
+		case 'u':
+			who |= 04700
+		case 'g':
+			who |= 02070
+		case 'o':
+			who |= 01007
+		case 'a':
+			who |= 07777
+		}
+	}
+	if who == 0 {
+		who = 07777
+	}
+	if i == len(clause) {
+		return bits, invalid
+	}
+
+	// One or more operators, each followed by its permissions
+	for i < len(clause) {
+		op := clause[i]
+		if op != '+' && op != '-' && op != '=' {
+			return bits, invalid
+		}
+		i++
+		var perm uint32
+		for ; i < len(clause) && strings.IndexByte("+-=", clause[i]) < 0; i++ {
+			switch clause[i] {
+			case 'r':
+				perm |= 0444
+			case 'w':
+				perm |= 0222
+			case 'x':
+				perm |= 0111
+			case 'X':
+				// Execute for directories and files someone can execute already
+				if isDir || bits&0111 != 0 {
+					perm |= 0111
+				}
+			case 's':
+				perm |= modeSetuid | modeSetgid
+			case 't':
+				perm |= modeSticky
+			default:
+				return bits, invalid
+			}
+		}
+		perm &= who
+		switch op {
+		case '+':
+			bits |= perm
+		case '-':
+			bits &^= perm
+		case '=':
+			bits = bits&^who | perm
+		}
+	}
+	return bits, nil
+}
+
+// fromFileMode returns the chmod bits of mode
+func fromFileMode(mode fs.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&fs.ModeSetuid != 0 {
+		bits |= modeSetuid
+	}
+	if mode&fs.ModeSetgid != 0 {
+		bits |= modeSetgid
+	}
+	if mode&fs.ModeSticky != 0 {
+		bits |= modeSticky
+	}
+	return bits
+}
+
+// toFileMode returns the FileMode os.Chmod sets for chmod bits
+func toFileMode(bits uint32) fs.FileMode {
+	mode := fs.FileMode(bits & 0777)
+	if bits&modeSetuid != 0 {
+		mode |= fs.ModeSetuid
+	}
+	if bits&modeSetgid != 0 {
+		mode |= fs.ModeSetgid
+	}
+	if bits&modeSticky != 0 {
+		mode |= fs.ModeSticky
+	}
+	return mode
+}
@@ -0,0 +1,273 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/disk"
+)
+
+// Errors of the space guard
+var (
+	// ErrQuotaExceeded is returned for writes that would take a root over
+	// its quota
+	ErrQuotaExceeded = errors.New("quota exceeded")
+	// ErrNoSpace is returned for writes that would leave less free disk
+	// space than the configured minimum
+	ErrNoSpace = errors.New("not enough free disk space")
+)
+
+const (
+	// usageTTL is how long the size of a root with a quota is trusted.
+	// Writes are added to it meanwhile, deletions are seen once it is
+	// measured again.
+	usageTTL = 30 * time.Second
+	// reserveAhead is how much more than needed streamed writes set aside
+	// at once, so they don't check the space on every write
+	reserveAhead = 1 << 20
+)
+
+// Quota is the disk space a root uses and has left
+type Quota struct {
+	// Limit is the most bytes the files of the root may take, zero when
+	// unlimited
+	Limit int64 `json:"limit,omitempty"`
+	// Used is the size of the files of the root, measured with a limit
+	Used int64 `json:"used,omitempty"`
+	// Free is the free space of the disk the root is on, less the minimum
+	// kept free
+	Free int64 `json:"free"`
+	// Reserved is the space set aside for writes in progress, like
+	// unfinished resumable uploads
+	Reserved int64 `json:"reserved,omitempty"`
+	// Remaining is how many bytes can still be written, within both
+	Remaining int64 `json:"remaining"`
+}
+
+// exceeded returns the error for writing size bytes past the space left
+func (q Quota) exceeded(size int64) error {
+	if left := q.Limit - q.Used - q.Reserved; q.Limit > 0 && size > left {
+		return fmt.Errorf("%w: %d bytes left of %d", ErrQuotaExceeded, max(left, 0), q.Limit)
+	}
+	return fmt.Errorf("%w: %d bytes available", ErrNoSpace, max(q.Free-q.Reserved, 0))
+}
+
+// SetQuota limits the bytes the files of the root may take, unlimited when
+// quota is zero, and the disk space writes must leave free
+func (m *Manager) SetQuota(quota, minFree int64) {
+	m.mu.Lock()
+	m.quota, m.minFree = quota, minFree
+	m.mu.Unlock()
+	m.forgetUsage()
+}
+
+// quotaSettings returns the quota and the minimum free space
+func (m *Manager) quotaSettings() (int64, int64) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.quota, m.minFree
+}
+
+// Quota returns the space the root uses and has left. The space of
+// remote roots isn't known, ErrNotSupported is returned for them.
+func (m *Manager) Quota() (Quota, error) {
+	if !isLocal(m.fsys) {
+		return Quota{}, ErrNotSupported
+	}
+	quota, minFree := m.quotaSettings()
+	usage, err := disk.Usage(m.root())
+	if err != nil {
+		return Quota{}, err
+	}
+	q := Quota{Limit: quota, Free: max(int64(usage.Free)-minFree, 0), Reserved: m.reserved()}
+	q.Remaining = max(q.Free-q.Reserved, 0)
+	if quota > 0 {
+		if q.Used, err = m.used(); err != nil {
+			return Quota{}, err
+		}
+		q.Remaining = min(q.Remaining, max(quota-q.Used-q.Reserved, 0))
+	}
+	return q, nil
+}
+
+// space returns the space left to the root, and whether writes are
+// limited by a quota or a minimum free space at all
+func (m *Manager) space() (Quota, bool, error) {
+	if quota, minFree := m.quotaSettings(); (quota == 0 && minFree == 0) || !isLocal(m.fsys) {
+		return Quota{}, false, nil
+	}
+	q, err := m.Quota()
+	return q, err == nil, err
+}
+
+// reserve checks that size more bytes fit in the root and counts them as
+// used, for writes made right away
+func (m *Manager) reserve(size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	r, err := m.hold(size)
+	if err != nil {
+		return err
+	}
+	r.commit(size)
+	return nil
+}
+
+// reservation is space set aside for a write in progress. It is left out
+// of the space of the root until commit counts the bytes as used or
+// release gives them back.
+type reservation struct {
+	m *Manager
+	// size is guarded by the usageMu of m
+	size int64
+}
+
+// hold sets size bytes aside, failing when they don't fit in the root
+func (m *Manager) hold(size int64) (*reservation, error) {
+	r := &reservation{m: m}
+	if err := r.ensure(size); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ensure grows the reservation to total bytes, failing when the bytes
+// missing don't fit in the root. Checking and setting aside happen under
+// one lock, so concurrent writes can't share the same space left.
+func (r *reservation) ensure(total int64) error {
+	m := r.m
+	m.reserveMu.Lock()
+	defer m.reserveMu.Unlock()
+
+	need := total - r.held()
+	if need <= 0 {
+		return nil
+	}
+	q, limited, err := m.space()
+	if err != nil {
+		return err
+	}
+	if limited && need > q.Remaining {
+		return q.exceeded(need)
+	}
+	m.usageMu.Lock()
+	r.size += need
+	m.pending += need
+	m.usageMu.Unlock()
+	return nil
+}
+
+// held returns the bytes the reservation sets aside
+func (r *reservation) held() int64 {
+	r.m.usageMu.Lock()
+	defer r.m.usageMu.Unlock()
+	return r.size
+}
+
+// commit ends the reservation, counting written bytes as used by the root
+func (r *reservation) commit(written int64) {
+	r.m.usageMu.Lock()
+	defer r.m.usageMu.Unlock()
+	r.m.pending -= r.size
+	r.m.usedBytes += written
+	r.size = 0
+}
+
+// release ends the reservation, for writes that aren't kept
+func (r *reservation) release() {
+	r.commit(0)
+}
+
+// reserved returns the space set aside for writes in progress
+func (m *Manager) reserved() int64 {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	return m.pending
+}
+
+// used returns the size of the files of the root, measured again once
+// usageTTL passed. Files that can't be read are left out.
+func (m *Manager) used() (int64, error) {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	if !m.usedAt.IsZero() && time.Since(m.usedAt) < usageTTL {
+		return m.usedBytes, nil
+	}
+
+	var total int64
+	err := walkFS(m.fsys, m.root(), func(p string, info fs.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	m.usedBytes, m.usedAt = total, time.Now()
+	return total, nil
+}
+
+// forgetUsage makes the next check measure the root again
+func (m *Manager) forgetUsage() {
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	m.usedAt = time.Time{}
+}
+
+// spaceWriter fails writes going past the space left to a root, for files
+// whose size isn't known before they are written. The bytes are set aside
+// as they are written.
+type spaceWriter struct {
+	w   io.Writer
+	res *reservation
+	// freed is how many bytes w takes without setting space aside, the
+	// size of the file it replaces
+	freed int64
+	// written counts the bytes of the file, from where w starts
+	written int64
+}
+
+// limitWriter wraps w, a file replacing freed bytes of the root, so it
+// fails once the root runs out of space. commit counts the bytes written
+// as used once the file is kept, release gives them back otherwise.
+func (m *Manager) limitWriter(w io.Writer, freed int64) *spaceWriter {
+	return &spaceWriter{w: w, res: &reservation{m: m}, freed: freed}
+}
+
+func (sw *spaceWriter) Write(p []byte) (int, error) {
+	if need := sw.written + int64(len(p)) - sw.freed; need > sw.res.held() {
+		// Ahead when it fits, otherwise only what this write needs
+		if err := sw.res.ensure(need + reserveAhead); err != nil {
+			if err := sw.res.ensure(need); err != nil {
+				return 0, err
+			}
+		}
+	}
+	n, err := sw.w.Write(p)
+	sw.written += int64(n)
+	return n, err
+}
+
+// commit counts the bytes written as used by the root
+func (sw *spaceWriter) commit() {
+	sw.res.commit(sw.written - sw.freed)
+}
+
+// release gives back the space set aside, for files that aren't kept
+func (sw *spaceWriter) release() {
+	sw.res.release()
+}
+
+// sizeOf returns the size of a file a write replaces, zero when there is
+// none
+func (m *Manager) sizeOf(fullPath string) int64 {
+	if info, err := m.fsys.Stat(fullPath); err == nil && info.Mode().IsRegular() {
+		return info.Size()
+	}
+	return 0
+}
@@ -0,0 +1,94 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Remote describes a remote host files are managed on
+type Remote struct {
+	Name     string `json:"name"`
+	Address  string `json:"address"`
+	User     string `json:"user"`
+	RootPath string `json:"root_path"`
+}
+
+// remote is a configured host and the manager of its files
+type remote struct {
+	settings RemoteSettings
+	manager  *Manager
+	fsys     *sftpFS
+}
+
+// Remotes holds the managers of the remote hosts reached over SFTP
+type Remotes struct {
+	remotes map[string]*remote
+	mu      sync.RWMutex
+}
+
+// NewRemotes creates an empty set of remote hosts
+func NewRemotes() *Remotes {
+	return &Remotes{remotes: make(map[string]*remote)}
+}
+
+// Configure replaces the remote hosts. Hosts whose settings didn't change
+// keep their connection, the others are closed. Hosts with invalid
+// settings are left out and reported in the returned error.
+func (r *Remotes) Configure(settings []RemoteSettings, maxUploadSize int64, allowedExtensions []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var errs []error
+	remotes := make(map[string]*remote, len(settings))
+	for _, s := range settings {
+		if old := r.remotes[s.Name]; old != nil && old.settings == s {
+			old.manager.Configure(s.RootPath, maxUploadSize, allowedExtensions)
+			remotes[s.Name] = old
+			delete(r.remotes, s.Name)
+			continue
+		}
+		fsys, err := newSFTPFS(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("remote %s: %w", s.Name, err))
+			continue
+		}
+		manager := NewManager(s.RootPath, maxUploadSize, allowedExtensions)
+		manager.fsys = fsys
+		remotes[s.Name] = &remote{settings: s, manager: manager, fsys: fsys}
+	}
+
+	for _, old := range r.remotes {
+		old.fsys.Close()
+	}
+	r.remotes = remotes
+	return errors.Join(errs...)
+}
+
+// Get returns the manager of a remote host, nil when there is no such host
+func (r *Remotes) Get(name string) *Manager {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if rm := r.remotes[name]; rm != nil {
+		return rm.manager
+	}
+	return nil
+}
+
+// List returns the remote hosts sorted by name
+func (r *Remotes) List() []Remote {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Remote, 0, len(r.remotes))
+	for _, rm := range r.remotes {
+		list = append(list, Remote{
+			Name:     rm.settings.Name,
+			Address:  rm.settings.Address,
+			User:     rm.settings.User,
+			RootPath: rm.settings.RootPath,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
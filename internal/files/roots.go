@@ -0,0 +1,103 @@
+package files
+
+import (
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Root is a named directory managed beside the main root, with its own
+// permissions
+type Root struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	ReadOnly bool   `json:"read_only"`
+	// Quota is the most bytes the files of the root may take, zero when
+	// unlimited
+	Quota int64 `json:"quota,omitempty"`
+	// Users are the users allowed to use the root, everyone when empty
+	Users []string `json:"users,omitempty"`
+}
+
+// Allows reports whether user may use the root
+func (r Root) Allows(user string) bool {
+	if len(r.Users) == 0 {
+		return true
+	}
+	for _, u := range r.Users {
+		if u == user {
+			return true
+		}
+	}
+	return false
+}
+
+// namedRoot is a configured root and the manager of its files
+type namedRoot struct {
+	root    Root
+	manager *Manager
+}
+
+// Roots holds the managers of the named roots. They share the upload
+// limits of the main manager, resumable uploads are staged in a directory
+// per root.
+type Roots struct {
+	main  *Manager
+	roots map[string]*namedRoot
+	mu    sync.RWMutex
+}
+
+// NewRoots creates an empty set of named roots beside main
+func NewRoots(main *Manager) *Roots {
+	return &Roots{main: main, roots: make(map[string]*namedRoot)}
+}
+
+// Configure replaces the named roots, taking the upload settings and the
+// minimum free space of the main manager. Roots keeping their name keep
+// their manager.
+func (r *Roots) Configure(roots []Root) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	maxUploadSize, extensions := r.main.uploadLimit(), r.main.extensions()
+	uploadDir, uploadExpiry := r.main.uploadSettings()
+	_, minFree := r.main.quotaSettings()
+	named := make(map[string]*namedRoot, len(roots))
+	for _, root := range roots {
+		nr := r.roots[root.Name]
+		if nr == nil {
+			nr = &namedRoot{manager: NewManager(root.Path, maxUploadSize, extensions)}
+		}
+		nr.root = root
+		nr.manager.Configure(root.Path, maxUploadSize, extensions)
+		nr.manager.SetReadOnly(root.ReadOnly)
+		nr.manager.SetQuota(root.Quota, minFree)
+		nr.manager.ConfigureUploads(filepath.Join(uploadDir, "roots", root.Name), uploadExpiry)
+		named[root.Name] = nr
+	}
+	r.roots = named
+}
+
+// Get returns a named root and its manager, nil when there is no such root
+func (r *Roots) Get(name string) (Root, *Manager) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if nr := r.roots[name]; nr != nil {
+		return nr.root, nr.manager
+	}
+	return Root{}, nil
+}
+
+// List returns the named roots user may use, sorted by name
+func (r *Roots) List(user string) []Root {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	list := make([]Root, 0, len(r.roots))
+	for _, nr := range r.roots {
+		if nr.root.Allows(user) {
+			list = append(list, nr.root)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,223 @@
+package files
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"regexp"
+)
+
+// ErrInvalidSearch is returned for malformed patterns and globs
+var ErrInvalidSearch = errors.New("invalid search")
+
+// DefaultSearchFileSize is the size of the largest file searched unless
+// given
+const DefaultSearchFileSize = 10 << 20
+
+// maxSearchLine is the longest line searched, files with longer lines are
+// most likely not text and the rest of them is skipped
+const maxSearchLine = 1 << 20
+
+// binaryProbe is how much of a file is checked for NUL bytes, which mark
+// it as binary as in grep
+const binaryProbe = 8000
+
+// SearchOptions select what SearchContent looks for
+type SearchOptions struct {
+	// Pattern is a regular expression, or plain text with Literal
+	Pattern    string
+	Literal    bool
+	IgnoreCase bool
+	// Include are globs of the file names searched, e.g. *.go, all files
+	// when empty
+	Include []string
+	// Exclude are globs of file and directory names skipped, e.g.
+	// node_modules
+	Exclude []string
+	// MaxFileSize skips larger files, 0 uses DefaultSearchFileSize
+	MaxFileSize int64
+	// Context is the number of lines sent before and after each match
+	Context int
+	// MaxResults stops the search after as many matches, 0 doesn't
+	MaxResults int
+}
+
+// Match is a line matching a content search
+type Match struct {
+	Path string `json:"path"`
+	// Line is numbered from 1
+	Line   int      `json:"line"`
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"`
+	After  []string `json:"after,omitempty"`
+}
+
+// SearchContent calls fn with the lines matching a pattern in the text
+// files below basePath, in the order they are found, stopping at the
+// first error fn returns or when ctx is done. Binary files, symbolic links
+// and files that can't be read are skipped.
+func (m *Manager) SearchContent(ctx context.Context, basePath string, opts SearchOptions, fn func(Match) error) error {
+	fullPath, err := m.resolvePath(basePath)
+	if err != nil {
+		return err
+	}
+	if _, err := m.fsys.Stat(fullPath); err != nil {
+		return err
+	}
+	re, err := compileSearch(opts)
+	if err != nil {
+		return err
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = DefaultSearchFileSize
+	}
+	if opts.Context < 0 {
+		opts.Context = 0
+	}
+
+	// errLimit ends the walk once enough matches were sent
+	errLimit := errors.New("result limit reached")
+	found := 0
+	emit := func(match Match) error {
+		if err := fn(match); err != nil {
+			return err
+		}
+		found++
+		if opts.MaxResults > 0 && found >= opts.MaxResults {
+			return errLimit
+		}
+		return nil
+	}
+
+	err = walkFS(m.fsys, fullPath, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip what can't be read
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p != fullPath && globMatch(opts.Exclude, info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || (len(opts.Include) > 0 && !globMatch(opts.Include, info.Name())) {
+			return nil
+		}
+		if info.Size() > opts.MaxFileSize {
+			return nil
+		}
+
+		rel, err := filepath.Rel(fullPath, p)
+		if err != nil {
+			return nil
+		}
+		return searchFile(m.fsys, p, filepath.Join(basePath, rel), re, opts.Context, emit)
+	})
+	if errors.Is(err, errLimit) {
+		return nil
+	}
+	return err
+}
+
+// compileSearch compiles the pattern of a search and checks its globs
+func compileSearch(opts SearchOptions) (*regexp.Regexp, error) {
+	if opts.Pattern == "" {
+		return nil, fmt.Errorf("%w: pattern required", ErrInvalidSearch)
+	}
+	pattern := opts.Pattern
+	if opts.Literal {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if opts.IgnoreCase {
+		pattern = "(?i)" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSearch, err)
+	}
+	for _, globs := range [][]string{opts.Include, opts.Exclude} {
+		for _, glob := range globs {
+			if _, err := filepath.Match(glob, ""); err != nil {
+				return nil, fmt.Errorf("%w: glob %s", ErrInvalidSearch, glob)
+			}
+		}
+	}
+	return re, nil
+}
+
+// globMatch reports whether name matches one of globs
+func globMatch(globs []string, name string) bool {
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// searchFile calls emit with the lines of a file matching re, named path
+// in the matches. Errors reading the file end its search without failing
+// the whole one.
+func searchFile(fsys FS, fullPath, path string, re *regexp.Regexp, contextLines int, emit func(Match) error) error {
+	f, err := fsys.Open(fullPath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if head, _ := r.Peek(binaryProbe); bytes.IndexByte(head, 0) >= 0 {
+		return nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxSearchLine)
+
+	// before holds the last lines read, pending the matches still
+	// collecting the lines after them
+	var before []string
+	var pending []*Match
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+
+		for len(pending) > 0 && len(pending[0].After) == contextLines {
+			if err := emit(*pending[0]); err != nil {
+				return err
+			}
+			pending = pending[1:]
+		}
+		for _, match := range pending {
+			match.After = append(match.After, text)
+		}
+
+		if re.MatchString(text) {
+			match := &Match{Path: path, Line: line, Text: text}
+			if len(before) > 0 {
+				match.Before = append([]string(nil), before...)
+			}
+			pending = append(pending, match)
+		}
+
+		if contextLines > 0 {
+			before = append(before, text)
+			if len(before) > contextLines {
+				before = before[1:]
+			}
+		}
+	}
+
+	for _, match := range pending {
+		if err := emit(*match); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package files
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpDialTimeout bounds connecting and authenticating to a remote host
+const sftpDialTimeout = 10 * time.Second
+
+// RemoteSettings describe a remote host browsed over SFTP
+type RemoteSettings struct {
+	Name string
+	// Address is host or host:port, port 22 when missing
+	Address  string
+	User     string
+	Password string
+	// KeyFile is a private key in OpenSSH or PEM format, without
+	// passphrase
+	KeyFile string
+	// HostKey is the public key of the host as in authorized_keys. When
+	// empty the host must be in KnownHosts, ~/.ssh/known_hosts by default.
+	HostKey    string
+	KnownHosts string
+	RootPath   string
+}
+
+// sftpFS is the filesystem of a remote host. The connection is opened on
+// first use and again after it drops. Files and directories are created
+// with the mode the server gives them.
+type sftpFS struct {
+	settings RemoteSettings
+	mu       sync.Mutex
+	client   *sftp.Client
+}
+
+// newSFTPFS returns the filesystem of a remote host, checking its settings
+// without connecting
+func newSFTPFS(settings RemoteSettings) (*sftpFS, error) {
+	if _, err := sshConfig(settings); err != nil {
+		return nil, err
+	}
+	return &sftpFS{settings: settings}, nil
+}
+
+// sshConfig builds the SSH client configuration of a remote host
+func sshConfig(settings RemoteSettings) (*ssh.ClientConfig, error) {
+	var methods []ssh.AuthMethod
+	if settings.KeyFile != "" {
+		key, err := os.ReadFile(settings.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key file %s: %w", settings.KeyFile, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+	if settings.Password != "" {
+		methods = append(methods, ssh.Password(settings.Password))
+	}
+	if len(methods) == 0 {
+		return nil, fmt.Errorf("password or key file required")
+	}
+
+	var hostKey ssh.HostKeyCallback
+	if settings.HostKey != "" {
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(settings.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("invalid host key: %w", err)
+		}
+		hostKey = ssh.FixedHostKey(key)
+	} else {
+		path := settings.KnownHosts
+		if path == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("host key or known hosts file required: %w", err)
+			}
+			path = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		callback, err := knownhosts.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read known hosts: %w", err)
+		}
+		hostKey = callback
+	}
+
+	return &ssh.ClientConfig{
+		User:            settings.User,
+		Auth:            methods,
+		HostKeyCallback: hostKey,
+		Timeout:         sftpDialTimeout,
+	}, nil
+}
+
+// conn returns the SFTP client, connecting when there is none
+func (f *sftpFS) conn() (*sftp.Client, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client != nil {
+		return f.client, nil
+	}
+
+	config, err := sshConfig(f.settings)
+	if err != nil {
+		return nil, err
+	}
+	address := f.settings.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+	conn, err := ssh.Dial("tcp", address, config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrUnreachable, f.settings.Name, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %s: failed to start sftp: %v", ErrUnreachable, f.settings.Name, err)
+	}
+
+	// The next call connects again once the session ends, closed or
+	// dropped
+	go func() {
+		client.Wait()
+		f.mu.Lock()
+		if f.client == client {
+			f.client = nil
+		}
+		f.mu.Unlock()
+		conn.Close()
+	}()
+	f.client = client
+	return client, nil
+}
+
+// Close closes the connection, if open
+func (f *sftpFS) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.client == nil {
+		return nil
+	}
+	err := f.client.Close()
+	f.client = nil
+	return err
+}
+
+func (f *sftpFS) Stat(name string) (fs.FileInfo, error) {
+	c, err := f.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.Stat(name)
+}
+
+func (f *sftpFS) Lstat(name string) (fs.FileInfo, error) {
+	c, err := f.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.Lstat(name)
+}
+
+func (f *sftpFS) ReadDir(name string) ([]fs.FileInfo, error) {
+	c, err := f.conn()
+	if err != nil {
+		return nil, err
+	}
+	return c.ReadDir(name)
+}
+
+func (f *sftpFS) Open(name string) (File, error) {
+	return f.OpenFile(name, os.O_RDONLY, 0)
+}
+
+func (f *sftpFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	c, err := f.conn()
+	if err != nil {
+		return nil, err
+	}
+	// perm is left to the server, which applies its umask like os.OpenFile
+	file, err := c.OpenFile(name, flag)
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+func (f *sftpFS) Mkdir(name string, perm fs.FileMode) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.Mkdir(name)
+}
+
+func (f *sftpFS) MkdirAll(name string, perm fs.FileMode) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.MkdirAll(name)
+}
+
+func (f *sftpFS) Remove(name string) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.Remove(name)
+}
+
+func (f *sftpFS) RemoveAll(name string) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.RemoveAll(name)
+}
+
+func (f *sftpFS) Rename(oldname, newname string) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	// Plain SFTP renames refuse to replace files, as os.Rename does
+	if _, ok := c.HasExtension("posix-rename@openssh.com"); ok {
+		return c.PosixRename(oldname, newname)
+	}
+	return c.Rename(oldname, newname)
+}
+
+func (f *sftpFS) Chmod(name string, mode fs.FileMode) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.Chmod(name, mode)
+}
+
+// Chown leaves an ID of -1 unchanged like os.Chown, SFTP always sets both
+func (f *sftpFS) Chown(name string, uid, gid int) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	if uid < 0 || gid < 0 {
+		info, err := c.Stat(name)
+		if err != nil {
+			return err
+		}
+		if st, ok := info.Sys().(*sftp.FileStat); ok {
+			if uid < 0 {
+				uid = int(st.UID)
+			}
+			if gid < 0 {
+				gid = int(st.GID)
+			}
+		}
+	}
+	return c.Chown(name, uid, gid)
+}
+
+// Lchown leaves symbolic links alone, SFTP has no way to change their
+// owner without changing the target
+func (f *sftpFS) Lchown(name string, uid, gid int) error {
+	info, err := f.Lstat(name)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&fs.ModeSymlink != 0 {
+		return nil
+	}
+	return f.Chown(name, uid, gid)
+}
+
+func (f *sftpFS) Chtimes(name string, atime, mtime time.Time) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.Chtimes(name, atime, mtime)
+}
+
+func (f *sftpFS) Readlink(name string) (string, error) {
+	c, err := f.conn()
+	if err != nil {
+		return "", err
+	}
+	return c.ReadLink(name)
+}
+
+func (f *sftpFS) Symlink(oldname, newname string) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.Symlink(oldname, newname)
+}
+
+func (f *sftpFS) Link(oldname, newname string) error {
+	c, err := f.conn()
+	if err != nil {
+		return err
+	}
+	return c.Link(oldname, newname)
+}
+
+func (f *sftpFS) EvalSymlinks(name string) (string, error) {
+	c, err := f.conn()
+	if err != nil {
+		return "", err
+	}
+	// Fails for broken links, realpath resolves the whole path
+	if _, err := c.Stat(name); err != nil {
+		return "", err
+	}
+	return c.RealPath(name)
+}
+
+// ownerOf returns the owner and group of a file: names for local files,
+// IDs for remote ones, their names being known only on their host
+func ownerOf(info fs.FileInfo) (string, string) {
+	if st, ok := info.Sys().(*sftp.FileStat); ok {
+		return strconv.FormatUint(uint64(st.UID), 10), strconv.FormatUint(uint64(st.GID), 10)
+	}
+	return fileOwner(info)
+}
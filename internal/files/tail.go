@@ -0,0 +1,265 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTailLines is the number of lines Tail returns unless asked
+	// for another number
+	DefaultTailLines = 10
+	// MaxTailLines is the most lines Tail returns
+	MaxTailLines = 10000
+)
+
+// Kinds of events Follow reports
+const (
+	FollowLines = "lines"
+	// FollowRotated is reported when the path names another file, as
+	// after a log rotation, which is then read from its start
+	FollowRotated = "rotated"
+	// FollowTruncated is reported when the file shrinks, which is then
+	// read again from its start
+	FollowTruncated = "truncated"
+)
+
+const (
+	// tailBlock is the size of the blocks Tail reads from the end
+	tailBlock = 64 * 1024
+	// followInterval is how often Follow checks the file for new lines
+	followInterval = 500 * time.Millisecond
+	// maxLineLength is the length of an unfinished line Follow sends as it
+	// is, rather than waiting for its end
+	maxLineLength = 64 * 1024
+)
+
+// Tail is the end of a file
+type Tail struct {
+	Path  string   `json:"path"`
+	Lines []string `json:"lines"`
+	// Offset is the end of the file, where following it starts
+	Offset int64 `json:"offset"`
+}
+
+// FollowEvent is a change to a followed file
+type FollowEvent struct {
+	Kind  string   `json:"kind"`
+	Path  string   `json:"path"`
+	Lines []string `json:"lines,omitempty"`
+	// Offset is the end of the lines in the file
+	Offset int64 `json:"offset"`
+}
+
+// Tail returns the last lines of a file, DefaultTailLines when lines is
+// zero, MaxTailLines at most. No more than MaxReadSize bytes are read.
+func (m *Manager) Tail(path string, lines int) (Tail, error) {
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return Tail{}, err
+	}
+	f, err := m.fsys.Open(fullPath)
+	if err != nil {
+		return Tail{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return Tail{}, err
+	}
+	if info.IsDir() {
+		return Tail{}, ErrIsDir
+	}
+	if lines <= 0 {
+		lines = DefaultTailLines
+	}
+	lines = min(lines, MaxTailLines)
+
+	// Blocks are read backwards until they hold one newline more than the
+	// lines wanted, the newline ending the file not counting
+	size := info.Size()
+	start := size
+	var data []byte
+	for start > 0 && len(data) < MaxReadSize {
+		n := min(start, tailBlock)
+		start -= n
+		block := make([]byte, n)
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return Tail{}, err
+		}
+		if _, err := io.ReadFull(f, block); err != nil {
+			return Tail{}, err
+		}
+		data = append(block, data...)
+		if bytes.Count(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")) >= lines {
+			break
+		}
+	}
+
+	tail := Tail{Path: path, Lines: []string{}, Offset: start + int64(len(data))}
+	if len(data) == 0 {
+		return tail, nil
+	}
+	all := splitLines(bytes.TrimSuffix(data, []byte("\n")))
+	if start > 0 && len(all) > 1 {
+		// The first line is cut unless the file starts with it
+		all = all[1:]
+	}
+	tail.Lines = all[max(len(all)-lines, 0):]
+	return tail, nil
+}
+
+// splitLines splits data at newlines, without the carriage returns of
+// CRLF line ends
+func splitLines(data []byte) []string {
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+// Follow calls fn with the lines appended to a file from offset, its end
+// when offset is negative or past it, until the returned function is
+// called. Like tail -F it keeps following the path when the file is
+// rotated or truncated. Remote files can't be followed, ErrNotSupported is
+// returned for them.
+func (m *Manager) Follow(path string, offset int64, fn func(FollowEvent)) (func(), error) {
+	if !isLocal(m.fsys) {
+		return nil, ErrNotSupported
+	}
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := m.fsys.Open(fullPath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err == nil && info.IsDir() {
+		err = ErrIsDir
+	}
+	if err == nil {
+		if offset < 0 || offset > info.Size() {
+			offset = info.Size()
+		}
+		_, err = f.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	fl := &follower{m: m, path: path, fn: fn, file: f, offset: offset}
+	done := make(chan struct{})
+	go fl.run(done)
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}, nil
+}
+
+// follower reads the lines appended to a followed file
+type follower struct {
+	m    *Manager
+	path string
+	fn   func(FollowEvent)
+	file File
+	// offset is how far the file was read, partial the unfinished line
+	// read last
+	offset  int64
+	partial []byte
+}
+
+// run checks the file for new lines until done is closed
+func (fl *follower) run(done <-chan struct{}) {
+	ticker := time.NewTicker(followInterval)
+	defer func() {
+		ticker.Stop()
+		fl.file.Close()
+	}()
+	for {
+		select {
+		case <-ticker.C:
+			fl.poll()
+		case <-done:
+			return
+		}
+	}
+}
+
+// poll sends the new lines of the file, then checks whether the path
+// still names it
+func (fl *follower) poll() {
+	fl.read()
+
+	// The path is resolved again, a link may lead elsewhere now. While the
+	// path is missing the file was moved away and the new one is awaited.
+	fullPath, err := fl.m.resolvePath(fl.path)
+	if err != nil {
+		return
+	}
+	info, err := fl.m.fsys.Stat(fullPath)
+	if err != nil || info.IsDir() {
+		return
+	}
+	current, err := fl.file.Stat()
+	if err != nil {
+		return
+	}
+
+	switch {
+	case !os.SameFile(current, info):
+		f, err := fl.m.fsys.Open(fullPath)
+		if err != nil {
+			return
+		}
+		fl.file.Close()
+		fl.file = f
+		fl.reset(FollowRotated)
+	case info.Size() < fl.offset:
+		if _, err := fl.file.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		fl.reset(FollowTruncated)
+	}
+}
+
+// reset starts reading the file again from its start
+func (fl *follower) reset(kind string) {
+	fl.offset, fl.partial = 0, nil
+	fl.fn(FollowEvent{Kind: kind, Path: fl.path})
+	fl.read()
+}
+
+// read sends the lines appended since the last read, up to MaxReadSize,
+// keeping an unfinished last line for the next read
+func (fl *follower) read() {
+	data, err := io.ReadAll(io.LimitReader(fl.file, MaxReadSize))
+	if err != nil || len(data) == 0 {
+		return
+	}
+	fl.offset += int64(len(data))
+	data = append(fl.partial, data...)
+
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 && len(data) < maxLineLength {
+		fl.partial = data
+		return
+	}
+	if end < 0 {
+		end = len(data)
+	}
+	fl.partial = append([]byte(nil), data[min(end+1, len(data)):]...)
+	fl.fn(FollowEvent{
+		Kind:   FollowLines,
+		Path:   fl.path,
+		Lines:  splitLines(data[:end]),
+		Offset: fl.offset - int64(len(fl.partial)),
+	})
+}
@@ -0,0 +1,412 @@
+package files
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Errors of resumable uploads
+var (
+	// ErrInvalidUpload is returned for uploads with a negative size or a
+	// malformed checksum
+	ErrInvalidUpload = errors.New("invalid upload")
+	// ErrUploadTooLarge is returned for uploads over the maximum upload size
+	// and chunks going past the size of their upload
+	ErrUploadTooLarge = errors.New("upload too large")
+	// ErrUploadOffset is returned for chunks that don't start where the
+	// upload stands
+	ErrUploadOffset = errors.New("chunk offset does not match the upload")
+	// ErrChecksum is returned when a complete upload doesn't match its
+	// checksum, the upload is discarded
+	ErrChecksum = errors.New("checksum mismatch")
+)
+
+// DefaultUploadExpiry is how long unfinished uploads are kept since their
+// last chunk unless configured
+const DefaultUploadExpiry = 24 * time.Hour
+
+// Upload is a resumable upload. Its chunks are appended to a staging file,
+// moved to the path once all of them arrived.
+type Upload struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Offset is where the next chunk starts, the bytes received so far
+	Offset int64 `json:"offset"`
+	// Checksum is the SHA-256 of the whole file, hex encoded
+	Checksum  string    `json:"checksum,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// File is the assembled file, once the upload is complete
+	File *FileInfo `json:"file,omitempty"`
+}
+
+// ConfigureUploads sets where resumable uploads are staged, the system
+// temporary directory when empty, and how long unfinished ones are kept
+func (m *Manager) ConfigureUploads(dir string, expiry time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.uploadDir = dir
+	m.uploadExpiry = expiry
+}
+
+// uploadSettings returns the staging directory and the upload expiry
+func (m *Manager) uploadSettings() (string, time.Duration) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dir, expiry := m.uploadDir, m.uploadExpiry
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "nebula-uploads")
+	}
+	if expiry <= 0 {
+		expiry = DefaultUploadExpiry
+	}
+	return dir, expiry
+}
+
+// CreateUpload starts a resumable upload of size bytes to path, verified
+// against checksum when given. Uploads are kept on the local filesystem,
+// remote managers return ErrNotSupported.
+func (m *Manager) CreateUpload(path string, size int64, checksum string) (*Upload, error) {
+	if err := m.writable(); err != nil {
+		return nil, err
+	}
+	if !isLocal(m.fsys) {
+		return nil, ErrNotSupported
+	}
+	fullPath, err := m.resolvePath(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.checkExtension(filepath.Base(fullPath)); err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("%w: negative size", ErrInvalidUpload)
+	}
+	if limit := m.uploadLimit(); limit > 0 && size > limit {
+		return nil, fmt.Errorf("%w: %d bytes allowed", ErrUploadTooLarge, limit)
+	}
+	checksum = strings.ToLower(strings.TrimSpace(checksum))
+	if b, err := hex.DecodeString(checksum); checksum != "" && (err != nil || len(b) != sha256.Size) {
+		return nil, fmt.Errorf("%w: checksum must be a hex encoded SHA-256", ErrInvalidUpload)
+	}
+
+	// The file must be creatable once the upload completes
+	if info, err := os.Stat(fullPath); err == nil && info.IsDir() {
+		return nil, ErrIsDir
+	}
+	if _, err := os.Stat(filepath.Dir(fullPath)); err != nil {
+		return nil, err
+	}
+
+	dir, expiry := m.uploadSettings()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create upload directory: %w", err)
+	}
+	if err := checkPrivateDir(dir); err != nil {
+		return nil, fmt.Errorf("unsafe upload directory: %w", err)
+	}
+	m.removeExpiredUploads(dir)
+
+	// The space is set aside when the upload starts, so it can complete
+	res, err := m.hold(size - m.sizeOf(fullPath))
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		res.release()
+		return nil, err
+	}
+	now := time.Now()
+	upload := &Upload{
+		ID:        hex.EncodeToString(b),
+		Path:      path,
+		Size:      size,
+		Checksum:  checksum,
+		CreatedAt: now,
+		ExpiresAt: now.Add(expiry),
+	}
+
+	part, err := os.OpenFile(filepath.Join(dir, upload.ID+".part"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0666)
+	if err != nil {
+		res.release()
+		return nil, fmt.Errorf("failed to create upload: %w", err)
+	}
+	part.Close()
+	if err := saveUpload(dir, upload); err != nil {
+		os.Remove(filepath.Join(dir, upload.ID+".part"))
+		res.release()
+		return nil, err
+	}
+	m.uploadSpace.Store(upload.ID, res)
+	return upload, nil
+}
+
+// GetUpload returns an unfinished upload, with the offset the next chunk
+// starts at
+func (m *Manager) GetUpload(id string) (*Upload, error) {
+	if !isLocal(m.fsys) {
+		return nil, ErrNotSupported
+	}
+	dir, _ := m.uploadSettings()
+	return loadUpload(dir, id)
+}
+
+// WriteChunk appends the chunk in r to an upload, starting at offset. When
+// the chunk is cut short the bytes received are kept, so the client resumes
+// from the offset of the returned upload. Once all bytes arrived the file
+// is verified and moved to its path, and File of the upload is set.
+func (m *Manager) WriteChunk(id string, offset int64, r io.Reader) (*Upload, error) {
+	if !isLocal(m.fsys) {
+		return nil, ErrNotSupported
+	}
+	if err := m.writable(); err != nil {
+		return nil, err
+	}
+	if !validUploadID(id) {
+		return nil, uploadNotFound(id)
+	}
+	lock := m.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	dir, expiry := m.uploadSettings()
+	upload, err := loadUpload(dir, id)
+	if err != nil {
+		m.dropUploadLock(id, lock, err)
+		return nil, err
+	}
+	if offset != upload.Offset {
+		return upload, fmt.Errorf("%w: upload is at %d", ErrUploadOffset, upload.Offset)
+	}
+
+	fullPath, err := m.resolvePath(upload.Path)
+	if err != nil {
+		return nil, err
+	}
+	partPath := filepath.Join(dir, id+".part")
+	part, err := os.OpenFile(partPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open upload: %w", err)
+	}
+	// The staged bytes count against the space of the root, beyond what
+	// was set aside, e.g. before a restart
+	w := &spaceWriter{w: part, res: m.uploadReservation(id), freed: m.sizeOf(fullPath), written: offset}
+	n, copyErr := io.Copy(w, io.LimitReader(r, upload.Size-offset))
+	if copyErr == nil {
+		// Bytes past the size make the whole chunk invalid
+		var extra [1]byte
+		if k, _ := r.Read(extra[:]); k > 0 {
+			part.Truncate(offset)
+			n, copyErr = 0, fmt.Errorf("%w: chunk goes past %d bytes", ErrUploadTooLarge, upload.Size)
+		}
+	}
+	if err := part.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+	upload.Offset += n
+
+	if copyErr != nil || upload.Offset < upload.Size {
+		upload.ExpiresAt = time.Now().Add(expiry)
+		if err := saveUpload(dir, upload); err != nil && copyErr == nil {
+			copyErr = err
+		}
+		return upload, copyErr
+	}
+
+	if err := m.completeUpload(dir, upload); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// CancelUpload discards an unfinished upload
+func (m *Manager) CancelUpload(id string) error {
+	if !isLocal(m.fsys) {
+		return ErrNotSupported
+	}
+	if !validUploadID(id) {
+		return uploadNotFound(id)
+	}
+	lock := m.uploadLock(id)
+	lock.Lock()
+	defer lock.Unlock()
+
+	dir, _ := m.uploadSettings()
+	if _, err := loadUpload(dir, id); err != nil {
+		m.dropUploadLock(id, lock, err)
+		return err
+	}
+	m.removeUpload(dir, id)
+	return nil
+}
+
+// completeUpload verifies a complete upload and moves it to its path
+func (m *Manager) completeUpload(dir string, upload *Upload) error {
+	partPath := filepath.Join(dir, upload.ID+".part")
+	defer m.removeUpload(dir, upload.ID)
+
+	if upload.Checksum != "" {
+		sum, err := fileChecksum(partPath)
+		if err != nil {
+			return err
+		}
+		if sum != upload.Checksum {
+			return fmt.Errorf("%w: got %s", ErrChecksum, sum)
+		}
+	}
+
+	// The root may have changed since the upload started
+	fullPath, err := m.resolvePath(upload.Path)
+	if err != nil {
+		return err
+	}
+	// So may the file replaced, the upload must still fit
+	freed := m.sizeOf(fullPath)
+	res := m.uploadReservation(upload.ID)
+	if err := res.ensure(upload.Size - freed); err != nil {
+		return err
+	}
+	if err := os.Rename(partPath, fullPath); err != nil {
+		// The staging directory may be on another file system
+		if err := m.copyFile(partPath, fullPath); err != nil {
+			return fmt.Errorf("failed to move upload: %w", err)
+		}
+	}
+	res.commit(upload.Size - freed)
+
+	info, err := m.Info(upload.Path)
+	if err != nil {
+		return err
+	}
+	upload.File = &info
+	return nil
+}
+
+// uploadLock returns the lock serializing the chunks of an upload
+func (m *Manager) uploadLock(id string) *sync.Mutex {
+	lock, _ := m.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	return lock.(*sync.Mutex)
+}
+
+// uploadReservation returns the space set aside for an upload, empty when
+// there is none, as after a restart
+func (m *Manager) uploadReservation(id string) *reservation {
+	res, _ := m.uploadSpace.LoadOrStore(id, &reservation{m: m})
+	return res.(*reservation)
+}
+
+// dropUploadLock forgets the lock taken for an ID naming no upload, so
+// requests for made up IDs do not leave locks behind
+func (m *Manager) dropUploadLock(id string, lock *sync.Mutex, err error) {
+	if errors.Is(err, fs.ErrNotExist) {
+		m.uploadLocks.CompareAndDelete(id, lock)
+	}
+}
+
+// removeUpload deletes the files of an upload and gives back the space
+// still set aside for it
+func (m *Manager) removeUpload(dir, id string) {
+	os.Remove(filepath.Join(dir, id+".part"))
+	os.Remove(filepath.Join(dir, id+".json"))
+	m.uploadLocks.Delete(id)
+	if res, ok := m.uploadSpace.LoadAndDelete(id); ok {
+		res.(*reservation).release()
+	}
+}
+
+// removeExpiredUploads deletes the uploads no chunk arrived for in time
+func (m *Manager) removeExpiredUploads(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if _, err := loadUpload(dir, id); errors.Is(err, fs.ErrNotExist) {
+			m.removeUpload(dir, id)
+		}
+	}
+}
+
+// loadUpload reads the state of an upload, reporting expired ones as
+// missing
+func loadUpload(dir, id string) (*Upload, error) {
+	if !validUploadID(id) {
+		return nil, uploadNotFound(id)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return nil, uploadNotFound(id)
+	}
+	var upload Upload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("invalid upload %s: %w", id, err)
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, fmt.Errorf("upload %s expired: %w", id, fs.ErrNotExist)
+	}
+
+	// The staging file is the source of truth for the bytes received
+	info, err := os.Stat(filepath.Join(dir, id+".part"))
+	if err != nil {
+		return nil, fmt.Errorf("upload %s: %w", id, fs.ErrNotExist)
+	}
+	upload.Offset = info.Size()
+	return &upload, nil
+}
+
+// validUploadID reports whether id has the form of the IDs CreateUpload
+// returns, 16 random bytes hex encoded
+func validUploadID(id string) bool {
+	_, err := hex.DecodeString(id)
+	return err == nil && len(id) == 32
+}
+
+// uploadNotFound is the error for an ID naming no upload
+func uploadNotFound(id string) error {
+	return fmt.Errorf("upload %s: %w", id, fs.ErrNotExist)
+}
+
+// saveUpload writes the state of an upload
+func saveUpload(dir string, upload *Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, upload.ID+".json"), data, 0600); err != nil {
+		return fmt.Errorf("failed to save upload: %w", err)
+	}
+	return nil
+}
+
+// fileChecksum returns the hex encoded SHA-256 of a file
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
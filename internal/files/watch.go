@@ -0,0 +1,200 @@
+package files
+
+import (
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Kinds of changes Watch reports
+const (
+	ChangeCreated  = "created"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+	// ChangeRenamed is reported for the old name, the new one is reported
+	// as created when it is in a watched directory
+	ChangeRenamed = "renamed"
+)
+
+// modifiedDelay coalesces the writes to a file into one change
+const modifiedDelay = 250 * time.Millisecond
+
+// Change is a change to an entry of a watched directory
+type Change struct {
+	Kind string `json:"kind"`
+	// Dir is the watched directory, Path the changed entry, as the watch
+	// named them. Both are the directory when it is deleted itself.
+	Dir  string `json:"dir"`
+	Path string `json:"path"`
+	// File is the entry after the change, for created and modified ones
+	File *FileInfo `json:"file,omitempty"`
+}
+
+// watcher shares one fsnotify watch per directory between its watches
+type watcher struct {
+	m   *Manager
+	fsw *fsnotify.Watcher
+	mu  sync.Mutex
+	// dirs holds the watches of each directory, by full path
+	dirs map[string]map[*watch]bool
+	// modified holds the files whose modified change is delayed
+	modified map[string]bool
+}
+
+// watch is a watch of a directory by a client
+type watch struct {
+	path string
+	fn   func(Change)
+}
+
+// Watch calls fn with the changes to the entries of the directory at path
+// until the returned function is called. fn may be called from several
+// goroutines and must not block. Remote directories can't be watched,
+// ErrNotSupported is returned for them.
+func (m *Manager) Watch(path string, fn func(Change)) (func(), error) {
+	if !isLocal(m.fsys) {
+		return nil, ErrNotSupported
+	}
+	fullPath, err := m.ResolveDir(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := m.fileWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	wt := &watch{path: path, fn: fn}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dirs[fullPath] == nil {
+		if err := w.fsw.Add(fullPath); err != nil {
+			return nil, err
+		}
+		w.dirs[fullPath] = make(map[*watch]bool)
+	}
+	w.dirs[fullPath][wt] = true
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { w.remove(fullPath, wt) })
+	}, nil
+}
+
+// fileWatcher returns the watcher of the manager, started on first use
+func (m *Manager) fileWatcher() (*watcher, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.watcher != nil {
+		return m.watcher, nil
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	m.watcher = &watcher{
+		m:        m,
+		fsw:      fsw,
+		dirs:     make(map[string]map[*watch]bool),
+		modified: make(map[string]bool),
+	}
+	go m.watcher.run()
+	return m.watcher, nil
+}
+
+// remove ends a watch, and the fsnotify watch of its directory with the
+// last one
+func (w *watcher) remove(fullPath string, wt *watch) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	watches := w.dirs[fullPath]
+	delete(watches, wt)
+	if len(watches) == 0 {
+		delete(w.dirs, fullPath)
+		// Fails when the directory is gone, which removed the watch already
+		w.fsw.Remove(fullPath)
+	}
+}
+
+// run turns fsnotify events into changes
+func (w *watcher) run() {
+	for {
+		select {
+		case event, ok := <-w.fsw.Events:
+			if !ok {
+				return
+			}
+			switch {
+			case event.Has(fsnotify.Create):
+				w.dispatch(event.Name, ChangeCreated)
+			case event.Has(fsnotify.Remove):
+				w.dispatch(event.Name, ChangeDeleted)
+			case event.Has(fsnotify.Rename):
+				w.dispatch(event.Name, ChangeRenamed)
+			case event.Has(fsnotify.Write), event.Has(fsnotify.Chmod):
+				w.delayModified(event.Name)
+			}
+		case err, ok := <-w.fsw.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("File watcher error: %v", err)
+		}
+	}
+}
+
+// delayModified reports a file as modified once its writes settle
+func (w *watcher) delayModified(name string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.modified[name] {
+		return
+	}
+	w.modified[name] = true
+	time.AfterFunc(modifiedDelay, func() {
+		w.mu.Lock()
+		delete(w.modified, name)
+		w.mu.Unlock()
+		w.dispatch(name, ChangeModified)
+	})
+}
+
+// dispatch sends a change of the file at name to the watches of its
+// directory, or of the directory itself when it is deleted
+func (w *watcher) dispatch(name, kind string) {
+	w.mu.Lock()
+	var watches []*watch
+	for wt := range w.dirs[filepath.Dir(name)] {
+		watches = append(watches, wt)
+	}
+	var self []*watch
+	if kind == ChangeDeleted || kind == ChangeRenamed {
+		for wt := range w.dirs[name] {
+			self = append(self, wt)
+		}
+		// fsnotify dropped the watch of the directory, a new one is needed
+		// when it is created again
+		delete(w.dirs, name)
+	}
+	w.mu.Unlock()
+
+	for _, wt := range self {
+		wt.fn(Change{Kind: ChangeDeleted, Dir: wt.path, Path: wt.path})
+	}
+	for _, wt := range watches {
+		change := Change{Kind: kind, Dir: wt.path, Path: filepath.Join(wt.path, filepath.Base(name))}
+		if kind == ChangeCreated || kind == ChangeModified {
+			info, err := w.m.Info(change.Path)
+			if err != nil {
+				// Gone again already, its removal follows
+				continue
+			}
+			change.File = &info
+		}
+		wt.fn(change)
+	}
+}
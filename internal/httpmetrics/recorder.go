@@ -0,0 +1,147 @@
+package httpmetrics
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Buckets are the upper bounds, in seconds, of the latency histogram
+var Buckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// UnmatchedRoute labels requests matching no route, so unknown paths don't
+// add a series each
+const UnmatchedRoute = "unmatched"
+
+// Recorder counts the requests of each route and how long they take
+type Recorder struct {
+	mu     sync.Mutex
+	routes map[routeKey]*routeStats
+}
+
+// routeKey identifies a route
+type routeKey struct {
+	method string
+	route  string
+}
+
+// routeStats holds the counters of a route
+type routeStats struct {
+	statuses map[int]uint64
+	inFlight int64
+	buckets  []uint64 // requests per bucket, the last one past the largest bound
+	sum      float64
+	count    uint64
+}
+
+// RouteStats are the counters of a route
+type RouteStats struct {
+	Method string `json:"method"`
+	Route  string `json:"route"`
+	// Statuses counts the finished requests per status code
+	Statuses map[string]uint64 `json:"statuses"`
+	InFlight int64             `json:"in_flight"`
+	// Buckets are the cumulative request counts of the latency histogram,
+	// one per bound of Buckets
+	Buckets []uint64 `json:"buckets"`
+	// Sum is the total latency of the finished requests, in seconds
+	Sum   float64 `json:"sum"`
+	Count uint64  `json:"count"`
+}
+
+// NewRecorder creates a recorder
+func NewRecorder() *Recorder {
+	return &Recorder{routes: make(map[routeKey]*routeStats)}
+}
+
+// Start records the start of a request and returns the function recording
+// its end with the response status
+func (r *Recorder) Start(method, route string) func(status int) {
+	if route == "" {
+		route = UnmatchedRoute
+	}
+	key := routeKey{method: method, route: route}
+	start := time.Now()
+
+	r.mu.Lock()
+	r.stats(key).inFlight++
+	r.mu.Unlock()
+
+	return func(status int) {
+		elapsed := time.Since(start).Seconds()
+		bucket := sort.SearchFloat64s(Buckets, elapsed)
+
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		s := r.stats(key)
+		s.inFlight--
+		s.statuses[status]++
+		s.buckets[bucket]++
+		s.sum += elapsed
+		s.count++
+	}
+}
+
+// Routes returns the counters of every route, ordered by route and method
+func (r *Recorder) Routes() []RouteStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list := make([]RouteStats, 0, len(r.routes))
+	for key, s := range r.routes {
+		stats := RouteStats{
+			Method:   key.method,
+			Route:    key.route,
+			Statuses: make(map[string]uint64, len(s.statuses)),
+			InFlight: s.inFlight,
+			Buckets:  make([]uint64, len(Buckets)),
+			Sum:      s.sum,
+			Count:    s.count,
+		}
+		for status, n := range s.statuses {
+			stats.Statuses[strconv.Itoa(status)] = n
+		}
+		var total uint64
+		for i := range Buckets {
+			total += s.buckets[i]
+			stats.Buckets[i] = total
+		}
+		list = append(list, stats)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Route != list[j].Route {
+			return list[i].Route < list[j].Route
+		}
+		return list[i].Method < list[j].Method
+	})
+	return list
+}
+
+// stats returns the counters of a route, creating them on first use. The
+// caller holds mu.
+func (r *Recorder) stats(key routeKey) *routeStats {
+	s, ok := r.routes[key]
+	if !ok {
+		s = &routeStats{statuses: make(map[int]uint64), buckets: make([]uint64, len(Buckets)+1)}
+		r.routes[key] = s
+	}
+	return s
+}
+
+// Quantile estimates the q quantile of the latency of a route from its
+// histogram, as the upper bound of the bucket it falls in. Requests past
+// the largest bound report it.
+func (s RouteStats) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	rank := uint64(q * float64(s.Count))
+	for i, n := range s.Buckets {
+		if n >= rank {
+			return Buckets[i]
+		}
+	}
+	return Buckets[len(Buckets)-1]
+}
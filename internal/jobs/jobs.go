@@ -0,0 +1,241 @@
+package jobs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// maxFinished is how many finished jobs are kept for clients to look up
+const maxFinished = 200
+
+// progressInterval is the least time between two reports of the progress
+// of a job
+const progressInterval = 500 * time.Millisecond
+
+// ErrNotFound is returned for unknown or expired jobs
+var ErrNotFound = errors.New("job not found")
+
+// Spec describes the operation a job runs
+type Spec struct {
+	Action string
+	// Target is what the action applies to, e.g. a package name
+	Target string
+	User   string
+	// Queue serializes jobs: those in the same queue run one at a time.
+	// Jobs without a queue start at once.
+	Queue string
+}
+
+// Job is an operation running in the background
+type Job struct {
+	ID         string     `json:"id"`
+	Action     string     `json:"action"`
+	Target     string     `json:"target,omitempty"`
+	User       string     `json:"user"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Progress is set by jobs reporting it, while they run
+	Progress *Progress `json:"progress,omitempty"`
+}
+
+// Progress is how much of its work a job has done, in units of its own,
+// e.g. bytes
+type Progress struct {
+	Done  int64 `json:"done"`
+	Total int64 `json:"total"`
+}
+
+// Finished reports whether the job has completed or failed
+func (j Job) Finished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed
+}
+
+// Manager runs jobs and keeps their state
+type Manager struct {
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	finished []string // IDs of finished jobs, oldest first
+	queues   map[string]*sync.Mutex
+	onChange func(Job)
+}
+
+// NewManager creates a job manager
+func NewManager() *Manager {
+	return &Manager{jobs: make(map[string]*Job), queues: make(map[string]*sync.Mutex)}
+}
+
+// OnChange registers a callback called with the job every time its status
+// changes
+func (m *Manager) OnChange(fn func(Job)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+// Start runs run in the background and returns the job tracking it
+func (m *Manager) Start(spec Spec, run func() error) Job {
+	job := m.create(spec)
+	go m.execute(job.ID, spec.Queue, run)
+	return job
+}
+
+// StartProgress is like Start for operations reporting their progress,
+// which run does by calling progress
+func (m *Manager) StartProgress(spec Spec, run func(progress func(done, total int64)) error) Job {
+	job := m.create(spec)
+	go m.execute(job.ID, spec.Queue, func() error {
+		return run(m.progress(job.ID))
+	})
+	return job
+}
+
+// Run runs run as a job and waits for it, returning the finished job and
+// the error of run
+func (m *Manager) Run(spec Spec, run func() error) (Job, error) {
+	job := m.create(spec)
+	err := m.execute(job.ID, spec.Queue, run)
+	job, _ = m.Get(job.ID)
+	return job, err
+}
+
+// Get returns a job
+func (m *Manager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job, ok := m.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// List returns the jobs, newest first
+func (m *Manager) List() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.jobs))
+	for _, job := range m.jobs {
+		list = append(list, *job)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.After(list[j].CreatedAt) })
+	return list
+}
+
+// create registers a queued job
+func (m *Manager) create(spec Spec) Job {
+	job := &Job{
+		ID:        newID(),
+		Action:    spec.Action,
+		Target:    spec.Target,
+		User:      spec.User,
+		Status:    StatusQueued,
+		CreatedAt: time.Now(),
+	}
+
+	m.mu.Lock()
+	m.jobs[job.ID] = job
+	m.mu.Unlock()
+	return *job
+}
+
+// execute runs a job once its queue is free, recording its progress
+func (m *Manager) execute(id, queue string, run func() error) error {
+	if queue != "" {
+		lock := m.queue(queue)
+		lock.Lock()
+		defer lock.Unlock()
+	}
+
+	m.update(id, func(job *Job) {
+		now := time.Now()
+		job.Status = StatusRunning
+		job.StartedAt = &now
+	})
+
+	err := run()
+
+	m.update(id, func(job *Job) {
+		now := time.Now()
+		job.Status = StatusCompleted
+		if err != nil {
+			job.Status = StatusFailed
+			job.Error = err.Error()
+		}
+		job.FinishedAt = &now
+	})
+	return err
+}
+
+// progress returns the function recording the progress of a job. The
+// change is reported at most every progressInterval, and on completion.
+func (m *Manager) progress(id string) func(done, total int64) {
+	var last time.Time
+	return func(done, total int64) {
+		if done < total && time.Since(last) < progressInterval {
+			return
+		}
+		last = time.Now()
+		m.update(id, func(job *Job) {
+			job.Progress = &Progress{Done: done, Total: total}
+		})
+	}
+}
+
+// queue returns the lock of a queue
+func (m *Manager) queue(name string) *sync.Mutex {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lock, ok := m.queues[name]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.queues[name] = lock
+	}
+	return lock
+}
+
+// update changes a job and reports the change, dropping the oldest
+// finished jobs past maxFinished
+func (m *Manager) update(id string, change func(*Job)) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	change(job)
+	if job.Finished() {
+		m.finished = append(m.finished, id)
+		for len(m.finished) > maxFinished {
+			delete(m.jobs, m.finished[0])
+			m.finished = m.finished[1:]
+		}
+	}
+	snapshot, onChange := *job, m.onChange
+	m.mu.Unlock()
+
+	if onChange != nil {
+		onChange(snapshot)
+	}
+}
+
+// newID returns a random job identifier
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,163 @@
+package lockout
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// Settings configures the guard
+type Settings struct {
+	Enabled bool
+	// MaxFailures is the number of failed logins that locks a client out
+	MaxFailures int
+	// BaseDelay is the first lockout, doubled by every further failure up
+	// to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Guard locks out IP addresses and usernames after repeated failed logins.
+// Failures are kept in storage so restarting doesn't reset them. A nil
+// Guard locks out nobody.
+type Guard struct {
+	store *storage.Storage
+
+	mu       sync.Mutex
+	settings Settings
+}
+
+// NewGuard creates a guard. Without storage nothing is tracked.
+func NewGuard(store *storage.Storage, settings Settings) *Guard {
+	return &Guard{store: store, settings: settings}
+}
+
+// Configure replaces the settings
+func (g *Guard) Configure(settings Settings) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.settings = settings
+}
+
+// Locked reports whether the IP address or the username is locked out, and
+// for how long
+func (g *Guard) Locked(ip, username string) (time.Duration, bool) {
+	if !g.enabled() {
+		return 0, false
+	}
+	var wait time.Duration
+	for _, key := range keys(ip, username) {
+		f, err := g.store.GetLoginFailures(key)
+		if err != nil || f == nil {
+			continue
+		}
+		if left := time.Until(f.LockedUntil); left > wait {
+			wait = left
+		}
+	}
+	return wait, wait > 0
+}
+
+// Fail records a failed login of username from ip. It returns how long the
+// client is locked out for, 0 while it stays under MaxFailures.
+func (g *Guard) Fail(ip, username string) time.Duration {
+	if !g.enabled() {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var locked time.Duration
+	for _, key := range keys(ip, username) {
+		f, err := g.store.GetLoginFailures(key)
+		if err != nil {
+			log.Printf("Failed to read login failures of %s: %v", key, err)
+			continue
+		}
+		if f == nil {
+			f = &storage.LoginFailures{Key: key}
+		}
+		f.Count++
+		f.LastFailure = now
+		if delay := g.delay(f.Count); delay > 0 {
+			f.LockedUntil = now.Add(delay)
+			locked = max(locked, delay)
+		}
+		ttl := g.settings.Window
+		if f.LockedUntil.After(now) {
+			ttl += f.LockedUntil.Sub(now)
+		}
+		if err := g.store.SaveLoginFailures(*f, ttl); err != nil {
+			log.Printf("Failed to save login failures of %s: %v", key, err)
+		}
+	}
+	return locked
+}
+
+// Succeed forgets the failures of username and ip after a successful login
+func (g *Guard) Succeed(ip, username string) {
+	if !g.enabled() {
+		return
+	}
+	for _, key := range keys(ip, username) {
+		if f, err := g.store.GetLoginFailures(key); err == nil && f != nil {
+			g.store.DeleteLoginFailures(key)
+		}
+	}
+}
+
+// Lockouts returns the clients locked out now
+func (g *Guard) Lockouts() []storage.LoginFailures {
+	locked := []storage.LoginFailures{}
+	if g == nil || g.store == nil {
+		return locked
+	}
+	all, err := g.store.ListLoginFailures()
+	if err != nil {
+		return locked
+	}
+	now := time.Now()
+	for _, f := range all {
+		if f.LockedUntil.After(now) {
+			locked = append(locked, f)
+		}
+	}
+	return locked
+}
+
+// delay returns the lockout after count failures. Callers must hold g.mu.
+func (g *Guard) delay(count int) time.Duration {
+	s := g.settings
+	if count < s.MaxFailures {
+		return 0
+	}
+	delay := s.BaseDelay
+	for i := s.MaxFailures; i < count && delay < s.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, s.MaxDelay)
+}
+
+// enabled reports whether failures are tracked
+func (g *Guard) enabled() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.settings.Enabled && g.store != nil
+}
+
+// keys returns the storage keys of a client
+func keys(ip, username string) []string {
+	k := []string{"ip:" + ip}
+	if username != "" {
+		k = append(k, "user:"+username)
+	}
+	return k
+}
@@ -0,0 +1,90 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// RequestIDHeader carries the ID of an API request, in the request to reuse
+// the caller's ID and in the response
+const RequestIDHeader = "X-Request-ID"
+
+// Formats of the log output
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// level is the level of the default logger, changed on reload
+var level = new(slog.LevelVar)
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// Setup makes a logger writing format records at or above levelName to
+// stderr the default for slog and for the log package. It can be called
+// again to apply new settings.
+func Setup(levelName, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(levelName)); err != nil {
+		return fmt.Errorf("invalid log level %q", levelName)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format {
+	case FormatJSON, "":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	case FormatText:
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q", format)
+	}
+
+	level.Set(l)
+	slog.SetDefault(slog.New(contextHandler{handler}))
+	return nil
+}
+
+// WithRequestID returns a copy of ctx carrying the ID of the request it
+// belongs to. Records logged with the context include it as request_id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID ctx carries, if any
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID of the context to the records
+type contextHandler struct {
+	slog.Handler
+}
+
+// Handle adds the request ID, if any, keeps errors for Recent and passes
+// the record on
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	id := RequestID(ctx)
+	remember(r, id)
+	if id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// WithAttrs keeps the request ID handling on derived loggers
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup keeps the request ID handling on derived loggers
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,60 @@
+package logging
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxRecent is how many error records Recent keeps
+const maxRecent = 100
+
+// Entry is a logged error kept for diagnostics
+type Entry struct {
+	Time      time.Time         `json:"time"`
+	Level     string            `json:"level"`
+	Message   string            `json:"message"`
+	RequestID string            `json:"request_id,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// recent holds the latest error records, oldest first
+var recent struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+// Recent returns the latest records logged at error level or above,
+// newest first
+func Recent() []Entry {
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+	list := make([]Entry, len(recent.entries))
+	for i, e := range recent.entries {
+		list[len(list)-1-i] = e
+	}
+	return list
+}
+
+// remember keeps r when it is an error
+func remember(r slog.Record, requestID string) {
+	if r.Level < slog.LevelError {
+		return
+	}
+
+	entry := Entry{Time: r.Time, Level: r.Level.String(), Message: r.Message, RequestID: requestID}
+	r.Attrs(func(a slog.Attr) bool {
+		if entry.Attrs == nil {
+			entry.Attrs = make(map[string]string)
+		}
+		entry.Attrs[a.Key] = a.Value.String()
+		return true
+	})
+
+	recent.mu.Lock()
+	defer recent.mu.Unlock()
+	recent.entries = append(recent.entries, entry)
+	if len(recent.entries) > maxRecent {
+		recent.entries = recent.entries[len(recent.entries)-maxRecent:]
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/disk"
 	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
 	"github.com/shirou/gopsutil/v3/mem"
 	"github.com/shirou/gopsutil/v3/net"
 )
@@ -25,6 +26,10 @@ type SystemInfo struct {
 	Uptime          uint64 `json:"uptime"`
 	BootTime        uint64 `json:"boot_time"`
 	NumCPU          int    `json:"num_cpu"`
+	// Load is unset where load averages aren't available
+	Load *LoadAverage `json:"load,omitempty"`
+	// Pressure is set on Linux kernels reporting pressure stalls
+	Pressure *Pressure `json:"pressure,omitempty"`
 }
 
 // CPUInfo contains CPU information
@@ -68,6 +73,19 @@ type NetworkInfo struct {
 	PacketsRecv uint64 `json:"packets_recv"`
 	Errin       uint64 `json:"errin"`
 	Errout      uint64 `json:"errout"`
+	// Rates are the counters per second since the previous sample, unset
+	// on the first one
+	Rates *NetworkRates `json:"rates,omitempty"`
+}
+
+// NetworkRates contains the traffic of a network interface per second
+type NetworkRates struct {
+	BytesSent   float64 `json:"bytes_sent"`
+	BytesRecv   float64 `json:"bytes_recv"`
+	PacketsSent float64 `json:"packets_sent"`
+	PacketsRecv float64 `json:"packets_recv"`
+	Errin       float64 `json:"errin"`
+	Errout      float64 `json:"errout"`
 }
 
 // AllMetrics contains all system metrics
@@ -78,6 +96,8 @@ type AllMetrics struct {
 	Memory    MemoryInfo    `json:"memory"`
 	Disks     []DiskInfo    `json:"disks"`
 	Network   []NetworkInfo `json:"network"`
+	// TopProcesses is set when the collector samples processes
+	TopProcesses *TopProcesses `json:"top_processes,omitempty"`
 }
 
 // Collector collects system metrics
@@ -86,25 +106,69 @@ type Collector struct {
 	interval time.Duration
 	history  []AllMetrics
 	histSize int
-	mu       sync.RWMutex
+	// topProcesses is how many top consumers each sample lists
+	topProcesses int
+	sampler      processSampler
+	// lastNetwork are the counters of the previous sample, which rates
+	// are measured from
+	lastNetwork   map[string]NetworkInfo
+	lastNetworkAt time.Time
+	mu            sync.RWMutex
 
 	subscribers []chan AllMetrics
 	subMu       sync.RWMutex
+
+	// intervalChanged wakes Start to reset its ticker
+	intervalChanged chan struct{}
 }
 
-// NewCollector creates a new metrics collector
-func NewCollector(store *storage.Storage, interval time.Duration, historySize int) *Collector {
+// NewCollector creates a new metrics collector, listing the topProcesses
+// processes using the most CPU and memory in each sample
+func NewCollector(store *storage.Storage, interval time.Duration, historySize, topProcesses int) *Collector {
 	return &Collector{
-		storage:  store,
-		interval: interval,
-		histSize: historySize,
-		history:  make([]AllMetrics, 0, historySize),
+		storage:      store,
+		interval:     interval,
+		histSize:     historySize,
+		history:      make([]AllMetrics, 0, historySize),
+		topProcesses: topProcesses,
+
+		intervalChanged: make(chan struct{}, 1),
+	}
+}
+
+// Configure changes the collection interval, the in-memory history size
+// and the number of top processes listed
+func (c *Collector) Configure(interval time.Duration, historySize, topProcesses int) {
+	c.mu.Lock()
+	changed := interval != c.interval
+	c.interval = interval
+	c.histSize = historySize
+	c.topProcesses = topProcesses
+	if len(c.history) > historySize {
+		c.history = c.history[len(c.history)-historySize:]
+	}
+	c.mu.Unlock()
+
+	if changed {
+		select {
+		case c.intervalChanged <- struct{}{}:
+		default:
+		}
 	}
 }
 
+// Interval returns the collection interval
+func (c *Collector) Interval() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.interval
+}
+
 // Start begins collecting metrics
 func (c *Collector) Start(ctx context.Context) {
+	c.mu.RLock()
 	ticker := time.NewTicker(c.interval)
+	c.mu.RUnlock()
 	defer ticker.Stop()
 
 	// Collect immediately
@@ -116,6 +180,10 @@ func (c *Collector) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			c.collect()
+		case <-c.intervalChanged:
+			c.mu.RLock()
+			ticker.Reset(c.interval)
+			c.mu.RUnlock()
 		}
 	}
 }
@@ -146,9 +214,28 @@ func (c *Collector) collect() {
 		metrics.Disks = disks
 	}
 
-	// Collect network info
+	// Collect network info, keeping the counters for the next rates
 	if net, err := c.GetNetworkInfo(); err == nil {
 		metrics.Network = net
+		c.mu.Lock()
+		c.lastNetwork = make(map[string]NetworkInfo, len(net))
+		for _, n := range net {
+			c.lastNetwork[n.Name] = n
+		}
+		c.lastNetworkAt = time.Now()
+		c.mu.Unlock()
+	}
+
+	// Collect the top processes, measuring their CPU since the last sample
+	c.mu.RLock()
+	topProcesses := c.topProcesses
+	c.mu.RUnlock()
+	if topProcesses > 0 {
+		if top, err := c.sampler.top(topProcesses, metrics.Memory.Total); err == nil {
+			metrics.TopProcesses = top
+		}
+	} else {
+		c.sampler.last = nil
 	}
 
 	// Store in history
@@ -282,6 +369,11 @@ func (c *Collector) GetSystemInfo() (SystemInfo, error) {
 	info.Uptime = hostInfo.Uptime
 	info.BootTime = hostInfo.BootTime
 
+	if avg, err := load.Avg(); err == nil {
+		info.Load = &LoadAverage{Load1: avg.Load1, Load5: avg.Load5, Load15: avg.Load15}
+	}
+	info.Pressure = readPressure()
+
 	return info, nil
 }
 
@@ -366,7 +458,8 @@ func (c *Collector) GetDiskInfo() ([]DiskInfo, error) {
 	return disks, nil
 }
 
-// GetNetworkInfo returns network information
+// GetNetworkInfo returns network information, with the rates since the
+// last collected sample
 func (c *Collector) GetNetworkInfo() ([]NetworkInfo, error) {
 	var networks []NetworkInfo
 
@@ -375,8 +468,12 @@ func (c *Collector) GetNetworkInfo() ([]NetworkInfo, error) {
 		return networks, err
 	}
 
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	seconds := time.Since(c.lastNetworkAt).Seconds()
+
 	for _, counter := range counters {
-		networks = append(networks, NetworkInfo{
+		info := NetworkInfo{
 			Name:        counter.Name,
 			BytesSent:   counter.BytesSent,
 			BytesRecv:   counter.BytesRecv,
@@ -384,8 +481,28 @@ func (c *Collector) GetNetworkInfo() ([]NetworkInfo, error) {
 			PacketsRecv: counter.PacketsRecv,
 			Errin:       counter.Errin,
 			Errout:      counter.Errout,
-		})
+		}
+		if prev, ok := c.lastNetwork[counter.Name]; ok && seconds > 0 {
+			info.Rates = &NetworkRates{
+				BytesSent:   rate(prev.BytesSent, info.BytesSent, seconds),
+				BytesRecv:   rate(prev.BytesRecv, info.BytesRecv, seconds),
+				PacketsSent: rate(prev.PacketsSent, info.PacketsSent, seconds),
+				PacketsRecv: rate(prev.PacketsRecv, info.PacketsRecv, seconds),
+				Errin:       rate(prev.Errin, info.Errin, seconds),
+				Errout:      rate(prev.Errout, info.Errout, seconds),
+			}
+		}
+		networks = append(networks, info)
 	}
 
 	return networks, nil
 }
+
+// rate returns how much a counter grew per second, zero when it was reset
+// meanwhile
+func rate(prev, cur uint64, seconds float64) float64 {
+	if cur < prev {
+		return 0
+	}
+	return float64(cur-prev) / seconds
+}
@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// LoadAverage contains the 1, 5 and 15 minute load averages
+type LoadAverage struct {
+	Load1  float64 `json:"load1"`
+	Load5  float64 `json:"load5"`
+	Load15 float64 `json:"load15"`
+}
+
+// PressureStall is the share of time tasks stalled waiting for a resource
+type PressureStall struct {
+	// Avg10, Avg60 and Avg300 are percentages over the last 10, 60 and
+	// 300 seconds
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// Total is the stall time since boot, in microseconds
+	Total uint64 `json:"total"`
+}
+
+// ResourcePressure is the pressure on a resource, Some when at least one
+// task stalled and Full when all of them did
+type ResourcePressure struct {
+	Some PressureStall  `json:"some"`
+	Full *PressureStall `json:"full,omitempty"`
+}
+
+// Pressure contains the Linux pressure stall information (PSI)
+type Pressure struct {
+	CPU    *ResourcePressure `json:"cpu,omitempty"`
+	Memory *ResourcePressure `json:"memory,omitempty"`
+	IO     *ResourcePressure `json:"io,omitempty"`
+}
+
+// parsePressure parses a file of /proc/pressure, made of lines such as
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+func parsePressure(r io.Reader) (*ResourcePressure, error) {
+	var rp ResourcePressure
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		var stall PressureStall
+		for _, field := range fields[1:] {
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				continue
+			}
+			switch key {
+			case "avg10":
+				stall.Avg10, _ = strconv.ParseFloat(value, 64)
+			case "avg60":
+				stall.Avg60, _ = strconv.ParseFloat(value, 64)
+			case "avg300":
+				stall.Avg300, _ = strconv.ParseFloat(value, 64)
+			case "total":
+				stall.Total, _ = strconv.ParseUint(value, 10, 64)
+			}
+		}
+		switch fields[0] {
+		case "some":
+			rp.Some = stall
+		case "full":
+			rp.Full = &stall
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return &rp, nil
+}
@@ -0,0 +1,35 @@
+//go:build linux
+
+package metrics
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// pressureDir holds the PSI files, present on kernels built with
+// CONFIG_PSI and not booted with psi=0
+const pressureDir = "/proc/pressure"
+
+// readPressure returns the pressure on CPU, memory and I/O, nil when the
+// kernel doesn't report it
+func readPressure() *Pressure {
+	read := func(name string) *ResourcePressure {
+		f, err := os.Open(filepath.Join(pressureDir, name))
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		rp, err := parsePressure(f)
+		if err != nil {
+			return nil
+		}
+		return rp
+	}
+
+	p := &Pressure{CPU: read("cpu"), Memory: read("memory"), IO: read("io")}
+	if p.CPU == nil && p.Memory == nil && p.IO == nil {
+		return nil
+	}
+	return p
+}
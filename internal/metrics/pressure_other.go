@@ -0,0 +1,6 @@
+//go:build !linux
+
+package metrics
+
+// readPressure returns nil, pressure stall information is Linux only
+func readPressure() *Pressure { return nil }
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// ProcessUsage is a process among the top CPU or memory consumers
+type ProcessUsage struct {
+	PID      int32  `json:"pid"`
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	// CPUPercent is the CPU used since the previous sample, 100 per core,
+	// or since the process started when it is new
+	CPUPercent float64 `json:"cpu_percent"`
+	MemPercent float32 `json:"mem_percent"`
+	MemRSS     uint64  `json:"mem_rss"`
+}
+
+// TopProcesses are the processes using the most CPU and the most memory
+type TopProcesses struct {
+	CPU    []ProcessUsage `json:"cpu"`
+	Memory []ProcessUsage `json:"memory"`
+}
+
+// cpuSample is the CPU time a process used up to a sample
+type cpuSample struct {
+	// created tells a process from another one reusing its PID
+	created int64
+	seconds float64
+	at      time.Time
+}
+
+// processSampler measures the CPU usage of processes between samples
+type processSampler struct {
+	last map[int32]cpuSample
+}
+
+// sampledProcess is a process measured by a sample
+type sampledProcess struct {
+	proc  *process.Process
+	usage ProcessUsage
+}
+
+// top returns the n processes using the most CPU and the n using the most
+// memory, memTotal being the memory of the system
+func (s *processSampler) top(n int, memTotal uint64) (*TopProcesses, error) {
+	procs, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	next := make(map[int32]cpuSample, len(procs))
+	sampled := make([]sampledProcess, 0, len(procs))
+	for _, p := range procs {
+		times, err := p.Times()
+		if err != nil {
+			// Gone meanwhile, or not ours to read
+			continue
+		}
+		created, _ := p.CreateTime()
+		sample := cpuSample{created: created, seconds: times.User + times.System, at: now}
+		next[p.Pid] = sample
+
+		usage := ProcessUsage{PID: p.Pid}
+		if prev, ok := s.last[p.Pid]; ok && prev.created == created && now.After(prev.at) {
+			usage.CPUPercent = (sample.seconds - prev.seconds) / now.Sub(prev.at).Seconds() * 100
+		} else if elapsed := now.Sub(time.UnixMilli(created)).Seconds(); created > 0 && elapsed > 0 {
+			usage.CPUPercent = sample.seconds / elapsed * 100
+		}
+		usage.CPUPercent = max(usage.CPUPercent, 0)
+		if mem, err := p.MemoryInfo(); err == nil && mem != nil {
+			usage.MemRSS = mem.RSS
+			if memTotal > 0 {
+				usage.MemPercent = float32(float64(mem.RSS) / float64(memTotal) * 100)
+			}
+		}
+		sampled = append(sampled, sampledProcess{proc: p, usage: usage})
+	}
+	s.last = next
+
+	// Names are read only for the processes shown
+	named := make(map[int32]ProcessUsage)
+	pick := func(less func(a, b ProcessUsage) bool) []ProcessUsage {
+		sort.SliceStable(sampled, func(i, j int) bool { return less(sampled[i].usage, sampled[j].usage) })
+		list := make([]ProcessUsage, 0, n)
+		for _, sp := range sampled[:min(n, len(sampled))] {
+			usage, ok := named[sp.usage.PID]
+			if !ok {
+				usage = sp.usage
+				usage.Name, _ = sp.proc.Name()
+				usage.Username, _ = sp.proc.Username()
+				named[usage.PID] = usage
+			}
+			list = append(list, usage)
+		}
+		return list
+	}
+	return &TopProcesses{
+		CPU:    pick(func(a, b ProcessUsage) bool { return a.CPUPercent > b.CPUPercent }),
+		Memory: pick(func(a, b ProcessUsage) bool { return a.MemRSS > b.MemRSS }),
+	}, nil
+}
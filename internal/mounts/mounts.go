@@ -0,0 +1,430 @@
+package mounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Errors callers can tell apart with errors.Is
+var (
+	// ErrUnsupported is returned where filesystems can't be managed
+	ErrUnsupported = errors.New("not supported on this system")
+	// ErrInvalid is returned for mounts and fstab entries that aren't valid
+	ErrInvalid = errors.New("invalid value")
+	// ErrNotFound is returned for mount points that aren't mounted or in fstab
+	ErrNotFound = errors.New("not found")
+)
+
+const (
+	// mountsFile lists the filesystems mounted in the namespace of the process
+	mountsFile = "/proc/self/mounts"
+	// fstabFile lists the filesystems mounted at boot
+	fstabFile = "/etc/fstab"
+)
+
+var (
+	// fsTypePattern matches filesystem types such as ext4 or fuse.sshfs
+	fsTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.+-]*$`)
+	// optionPattern matches a mount option such as ro, uid=1000 or
+	// context=system_u:object_r:tmp_t:s0
+	optionPattern = regexp.MustCompile(`^[A-Za-z0-9_.:/@=+-]+$`)
+)
+
+// Runner runs commands as root, as the privilege manager does
+type Runner interface {
+	RunWithPrivilegesContext(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// Mount is a mounted filesystem
+type Mount struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	FSType  string `json:"fstype"`
+	Options string `json:"options"`
+}
+
+// MountRequest describes a filesystem to mount. Source is a device, a
+// UUID= or LABEL= tag, a network share or an image file, which is mounted
+// through a loop device.
+type MountRequest struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+	// FSType is detected by mount when empty
+	FSType  string `json:"fstype,omitempty"`
+	Options string `json:"options,omitempty"`
+}
+
+// Entry is a line of fstab
+type Entry struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"`
+	FSType  string `json:"fstype"`
+	Options string `json:"options"`
+	Dump    int    `json:"dump"`
+	Pass    int    `json:"pass"`
+}
+
+// Key identifies the entry in fstab: its mount point, or its source for
+// swap, which has none
+func (e Entry) Key() string {
+	if e.Target == "none" || e.Target == "swap" {
+		return e.Source
+	}
+	return e.Target
+}
+
+// Manager lists, mounts and unmounts filesystems and edits fstab. Changes
+// run through the runner, with the credentials of the request in their
+// context.
+type Manager struct {
+	runner     Runner
+	mountsPath string
+	fstabPath  string
+	// mu serializes fstab edits, which read the file and write it back
+	mu sync.Mutex
+}
+
+// NewManager creates a mount manager running commands with runner
+func NewManager(runner Runner) *Manager {
+	return &Manager{runner: runner, mountsPath: mountsFile, fstabPath: fstabFile}
+}
+
+// List returns the mounted filesystems
+func (m *Manager) List() ([]Mount, error) {
+	return m.list()
+}
+
+// Get returns the filesystem mounted last at target, which hides the
+// others mounted there
+func (m *Manager) Get(target string) (Mount, error) {
+	mounts, err := m.list()
+	if err != nil {
+		return Mount{}, err
+	}
+	target = filepath.Clean(target)
+	for i := len(mounts) - 1; i >= 0; i-- {
+		if mounts[i].Target == target {
+			return mounts[i], nil
+		}
+	}
+	return Mount{}, fmt.Errorf("%w: nothing mounted on %s", ErrNotFound, target)
+}
+
+// Mount mounts a filesystem on an existing directory and returns it.
+// Regular files, such as ISO images, are mounted through a loop device.
+func (m *Manager) Mount(ctx context.Context, req MountRequest) (Mount, error) {
+	if err := validateSource(req.Source); err != nil {
+		return Mount{}, err
+	}
+	if err := validateMountPoint(req.Target); err != nil {
+		return Mount{}, err
+	}
+	if req.FSType != "" {
+		if err := validateFSType(req.FSType); err != nil {
+			return Mount{}, err
+		}
+	}
+	if req.Options != "" {
+		if err := validateOptions(req.Options); err != nil {
+			return Mount{}, err
+		}
+	}
+	req.Target = filepath.Clean(req.Target)
+	if err := m.mount(ctx, req); err != nil {
+		return Mount{}, err
+	}
+	return m.Get(req.Target)
+}
+
+// Unmount unmounts the filesystem mounted on target. A lazy unmount
+// detaches it at once and cleans up once it is no longer busy.
+func (m *Manager) Unmount(ctx context.Context, target string, lazy bool) error {
+	if err := validateMountPoint(target); err != nil {
+		return err
+	}
+	target = filepath.Clean(target)
+	if target == "/" {
+		return fmt.Errorf("%w: the root filesystem can't be unmounted", ErrInvalid)
+	}
+	if _, err := m.Get(target); err != nil {
+		return err
+	}
+	return m.unmount(ctx, target, lazy)
+}
+
+// Fstab returns the entries of fstab
+func (m *Manager) Fstab() ([]Entry, error) {
+	lines, err := m.readFstab()
+	if err != nil {
+		return nil, err
+	}
+	entries := []Entry{}
+	for _, l := range lines {
+		if l.entry != nil {
+			entries = append(entries, *l.entry)
+		}
+	}
+	return entries, nil
+}
+
+// SetFstabEntry adds an entry to fstab, or replaces the one with the same
+// key where it is. It returns the entry as written and whether it was
+// added.
+func (m *Manager) SetFstabEntry(ctx context.Context, e Entry) (Entry, bool, error) {
+	if e.Options == "" {
+		e.Options = "defaults"
+	}
+	if e.Target != "none" && e.Target != "swap" {
+		e.Target = filepath.Clean(e.Target)
+	}
+	if err := ValidateEntry(e); err != nil {
+		return Entry{}, false, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lines, err := m.readFstab()
+	if err != nil {
+		return Entry{}, false, err
+	}
+	created := true
+	for i, l := range lines {
+		if l.entry != nil && l.entry.Key() == e.Key() {
+			lines[i] = fstabLine{entry: &e}
+			created = false
+			break
+		}
+	}
+	if created {
+		lines = append(lines, fstabLine{entry: &e})
+	}
+	if err := m.writeFstab(ctx, formatFstab(lines)); err != nil {
+		return Entry{}, false, err
+	}
+	return e, created, nil
+}
+
+// RemoveFstabEntry removes the entry with key from fstab
+func (m *Manager) RemoveFstabEntry(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lines, err := m.readFstab()
+	if err != nil {
+		return err
+	}
+	for i, l := range lines {
+		if l.entry != nil && l.entry.Key() == key {
+			lines = append(lines[:i], lines[i+1:]...)
+			return m.writeFstab(ctx, formatFstab(lines))
+		}
+	}
+	return fmt.Errorf("%w: no fstab entry for %s", ErrNotFound, key)
+}
+
+// ValidateEntry checks an fstab entry
+func ValidateEntry(e Entry) error {
+	if err := validateSource(e.Source); err != nil {
+		return err
+	}
+	switch {
+	case e.FSType == "swap":
+		if e.Target != "none" && e.Target != "swap" {
+			return fmt.Errorf("%w: the mount point of swap must be none", ErrInvalid)
+		}
+	case e.Target == "none":
+		// Filesystems such as binfmt_misc have no mount point of their own
+	default:
+		if err := validateMountPoint(e.Target); err != nil {
+			return err
+		}
+	}
+	if err := validateFSType(e.FSType); err != nil {
+		return err
+	}
+	if err := validateOptions(e.Options); err != nil {
+		return err
+	}
+	if e.Dump < 0 || e.Dump > 1 {
+		return fmt.Errorf("%w: dump must be 0 or 1", ErrInvalid)
+	}
+	if e.Pass < 0 || e.Pass > 2 {
+		return fmt.Errorf("%w: pass must be between 0 and 2", ErrInvalid)
+	}
+	return nil
+}
+
+// validateSource checks the source of a mount, which can't be taken for
+// an option of mount
+func validateSource(source string) error {
+	switch {
+	case source == "":
+		return fmt.Errorf("%w: source required", ErrInvalid)
+	case strings.HasPrefix(source, "-"), strings.HasPrefix(source, "#"):
+		return fmt.Errorf("%w: source %q", ErrInvalid, source)
+	case strings.ContainsFunc(source, isControl):
+		return fmt.Errorf("%w: source contains control characters", ErrInvalid)
+	}
+	return nil
+}
+
+// validateMountPoint checks that a mount point is an absolute path
+func validateMountPoint(target string) error {
+	switch {
+	case target == "":
+		return fmt.Errorf("%w: mount point required", ErrInvalid)
+	case !strings.HasPrefix(target, "/"):
+		return fmt.Errorf("%w: mount point must be an absolute path", ErrInvalid)
+	case strings.ContainsFunc(target, isControl):
+		return fmt.Errorf("%w: mount point contains control characters", ErrInvalid)
+	}
+	return nil
+}
+
+func validateFSType(fsType string) error {
+	if !fsTypePattern.MatchString(fsType) {
+		return fmt.Errorf("%w: filesystem type %q", ErrInvalid, fsType)
+	}
+	return nil
+}
+
+// validateOptions checks a comma separated list of mount options
+func validateOptions(options string) error {
+	for _, o := range strings.Split(options, ",") {
+		if !optionPattern.MatchString(o) {
+			return fmt.Errorf("%w: mount option %q", ErrInvalid, o)
+		}
+	}
+	return nil
+}
+
+func isControl(r rune) bool {
+	return r < 0x20 || r == 0x7f
+}
+
+// hasOption reports whether a comma separated list of options holds option
+func hasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMounts parses the lines of /proc/mounts
+func parseMounts(data string) []Mount {
+	mounts := []Mount{}
+	for _, line := range strings.Split(data, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		mounts = append(mounts, Mount{
+			Source:  unescape(fields[0]),
+			Target:  unescape(fields[1]),
+			FSType:  unescape(fields[2]),
+			Options: unescape(fields[3]),
+		})
+	}
+	return mounts
+}
+
+// fstabLine is a line of fstab: an entry, or a comment or blank line kept
+// as it is
+type fstabLine struct {
+	text  string
+	entry *Entry
+}
+
+// parseFstab parses fstab. Lines that aren't valid entries are kept as
+// they are, like comments.
+func parseFstab(data string) []fstabLine {
+	var lines []fstabLine
+	for _, text := range strings.Split(strings.TrimSuffix(data, "\n"), "\n") {
+		lines = append(lines, parseFstabLine(text))
+	}
+	return lines
+}
+
+func parseFstabLine(text string) fstabLine {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || strings.HasPrefix(fields[0], "#") {
+		return fstabLine{text: text}
+	}
+	e := Entry{
+		Source:  unescape(fields[0]),
+		Target:  unescape(fields[1]),
+		FSType:  unescape(fields[2]),
+		Options: "defaults",
+	}
+	if len(fields) > 3 {
+		e.Options = unescape(fields[3])
+	}
+	var err error
+	if len(fields) > 4 {
+		e.Dump, err = strconv.Atoi(fields[4])
+	}
+	if err == nil && len(fields) > 5 {
+		e.Pass, err = strconv.Atoi(fields[5])
+	}
+	if err != nil {
+		return fstabLine{text: text}
+	}
+	return fstabLine{entry: &e}
+}
+
+// formatFstab writes back the lines of fstab
+func formatFstab(lines []fstabLine) string {
+	var b strings.Builder
+	for _, l := range lines {
+		if l.entry == nil {
+			b.WriteString(l.text)
+		} else {
+			e := l.entry
+			fmt.Fprintf(&b, "%s\t%s\t%s\t%s\t%d\t%d",
+				escape(e.Source), escape(e.Target), escape(e.FSType), escape(e.Options), e.Dump, e.Pass)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// unescape decodes the octal escapes of /proc/mounts and fstab, such as
+// \040 for a space
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// escape encodes the characters fstab separates fields with
+func escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ' ', '\t', '\n', '\\':
+			fmt.Fprintf(&b, `\%03o`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
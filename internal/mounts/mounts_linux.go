@@ -0,0 +1,103 @@
+//go:build linux
+
+package mounts
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+func (m *Manager) list() ([]Mount, error) {
+	data, err := os.ReadFile(m.mountsPath)
+	if err != nil {
+		return nil, err
+	}
+	return parseMounts(string(data)), nil
+}
+
+// mount runs mount, adding the loop option for image files
+func (m *Manager) mount(ctx context.Context, req MountRequest) error {
+	info, err := os.Stat(req.Target)
+	if err != nil {
+		return fmt.Errorf("%w: mount point %s: %v", ErrInvalid, req.Target, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%w: mount point %s is not a directory", ErrInvalid, req.Target)
+	}
+
+	options := req.Options
+	if strings.HasPrefix(req.Source, "/") {
+		if info, err := os.Stat(req.Source); err == nil && info.Mode().IsRegular() && !hasOption(options, "loop") {
+			options = strings.TrimPrefix(options+",loop", ",")
+		}
+	}
+
+	var args []string
+	if req.FSType != "" {
+		args = append(args, "-t", req.FSType)
+	}
+	if options != "" {
+		args = append(args, "-o", options)
+	}
+	return m.run(ctx, "mount", append(args, req.Source, req.Target)...)
+}
+
+func (m *Manager) unmount(ctx context.Context, target string, lazy bool) error {
+	if lazy {
+		return m.run(ctx, "umount", "-l", target)
+	}
+	return m.run(ctx, "umount", target)
+}
+
+// readFstab reads fstab, empty when there is none
+func (m *Manager) readFstab() ([]fstabLine, error) {
+	data, err := os.ReadFile(m.fstabPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseFstab(string(data)), nil
+}
+
+// writeFstab replaces fstab. The new content is staged in a temporary
+// file the privileged install copies in place.
+func (m *Manager) writeFstab(ctx context.Context, content string) error {
+	f, err := os.CreateTemp("", "nebula-fstab-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stage fstab: %w", err)
+	}
+	return m.run(ctx, "install", "-m", "644", f.Name(), m.fstabPath)
+}
+
+// run runs a command as root, returning its output as the error when it fails
+func (m *Manager) run(ctx context.Context, name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return ErrUnsupported
+	}
+	output, err := m.runner.RunWithPrivilegesContext(ctx, name, args...)
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s: %s", name, out)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
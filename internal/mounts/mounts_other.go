@@ -0,0 +1,15 @@
+//go:build !linux
+
+package mounts
+
+import "context"
+
+func (m *Manager) list() ([]Mount, error) { return nil, ErrUnsupported }
+
+func (m *Manager) mount(context.Context, MountRequest) error { return ErrUnsupported }
+
+func (m *Manager) unmount(context.Context, string, bool) error { return ErrUnsupported }
+
+func (m *Manager) readFstab() ([]fstabLine, error) { return nil, ErrUnsupported }
+
+func (m *Manager) writeFstab(context.Context, string) error { return ErrUnsupported }
@@ -0,0 +1,253 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+)
+
+// Channel types
+const (
+	TypeEmail    = "email"
+	TypeSlack    = "slack"
+	TypeDiscord  = "discord"
+	TypeTeams    = "teams"
+	TypeTelegram = "telegram"
+	TypeHTTP     = "http"
+)
+
+// Types lists the channel types
+var Types = []string{TypeEmail, TypeSlack, TypeDiscord, TypeTeams, TypeTelegram, TypeHTTP}
+
+// telegramAPI is the Telegram Bot API endpoint
+const telegramAPI = "https://api.telegram.org"
+
+// ChannelConfig holds the settings of a channel. Which fields apply depends
+// on Type.
+type ChannelConfig struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Enabled bool   `json:"enabled"`
+	// Configured channels come from the configuration file and can't be
+	// changed through the API
+	Configured bool `json:"configured,omitempty"`
+
+	// URL is the incoming webhook of slack, discord and teams channels and
+	// the endpoint of http channels
+	URL string `json:"url,omitempty"`
+	// Headers are added to the requests of http channels
+	Headers map[string]string `json:"headers,omitempty"`
+	// Secret signs the body of http channels with HMAC-SHA256
+	Secret string `json:"secret,omitempty"`
+
+	// BotToken and ChatID address a telegram chat
+	BotToken string `json:"bot_token,omitempty"`
+	ChatID   string `json:"chat_id,omitempty"`
+
+	// SMTP settings of email channels. Port 465 uses TLS from the start,
+	// other ports upgrade with STARTTLS when the server offers it.
+	SMTPHost string   `json:"smtp_host,omitempty"`
+	SMTPPort int      `json:"smtp_port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+}
+
+// Mask replaces credentials in responses. Saving a channel with a masked
+// value keeps the stored one.
+const Mask = "********"
+
+// Masked returns the channel with its credentials hidden
+func (ch ChannelConfig) Masked() ChannelConfig {
+	mask := func(s string) string {
+		if s == "" {
+			return ""
+		}
+		return Mask
+	}
+	ch.Secret = mask(ch.Secret)
+	ch.BotToken = mask(ch.BotToken)
+	ch.Password = mask(ch.Password)
+	// Slack, Discord and Teams webhook URLs grant posting to the channel
+	if ch.Type == TypeSlack || ch.Type == TypeDiscord || ch.Type == TypeTeams {
+		ch.URL = mask(ch.URL)
+	}
+	if len(ch.Headers) > 0 {
+		headers := make(map[string]string, len(ch.Headers))
+		for k := range ch.Headers {
+			headers[k] = Mask
+		}
+		ch.Headers = headers
+	}
+	return ch
+}
+
+// Unmask fills the masked fields of ch with the values of old
+func (ch ChannelConfig) Unmask(old ChannelConfig) ChannelConfig {
+	keep := func(s, prev string) string {
+		if s == Mask {
+			return prev
+		}
+		return s
+	}
+	ch.URL = keep(ch.URL, old.URL)
+	ch.Secret = keep(ch.Secret, old.Secret)
+	ch.BotToken = keep(ch.BotToken, old.BotToken)
+	ch.Password = keep(ch.Password, old.Password)
+	for k, v := range ch.Headers {
+		ch.Headers[k] = keep(v, old.Headers[k])
+	}
+	return ch
+}
+
+// sender delivers notifications to one channel
+type sender interface {
+	Send(ctx context.Context, n Notification) error
+}
+
+// newSender validates a channel and returns its sender
+func newSender(ch ChannelConfig) (sender, error) {
+	switch ch.Type {
+	case TypeSlack, TypeDiscord, TypeTeams, TypeHTTP:
+		u, err := url.Parse(ch.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("%w: url must be an http or https URL", ErrInvalid)
+		}
+		return &webhookSender{ch: ch}, nil
+	case TypeTelegram:
+		if ch.BotToken == "" || ch.ChatID == "" {
+			return nil, fmt.Errorf("%w: bot_token and chat_id are required", ErrInvalid)
+		}
+		return &webhookSender{ch: ch}, nil
+	case TypeEmail:
+		if ch.SMTPHost == "" || ch.From == "" || len(ch.To) == 0 {
+			return nil, fmt.Errorf("%w: smtp_host, from and to are required", ErrInvalid)
+		}
+		if ch.SMTPPort < 0 || ch.SMTPPort > 65535 {
+			return nil, fmt.Errorf("%w: invalid smtp_port", ErrInvalid)
+		}
+		for _, addr := range append([]string{ch.From}, ch.To...) {
+			if _, err := mail.ParseAddress(addr); err != nil {
+				return nil, fmt.Errorf("%w: invalid address %q", ErrInvalid, addr)
+			}
+		}
+		return &emailSender{ch: ch}, nil
+	}
+	return nil, fmt.Errorf("%w: type must be one of %s", ErrInvalid, strings.Join(Types, ", "))
+}
+
+// webhookSender posts notifications to chat services and HTTP endpoints
+type webhookSender struct {
+	ch ChannelConfig
+}
+
+// Send posts the notification in the format the channel type expects
+func (s *webhookSender) Send(ctx context.Context, n Notification) error {
+	text := n.Title
+	if n.Message != "" {
+		text += "\n" + n.Message
+	}
+
+	target := s.ch.URL
+	var payload interface{}
+	switch s.ch.Type {
+	case TypeSlack:
+		payload = map[string]string{"text": text}
+	case TypeDiscord:
+		payload = map[string]string{"content": text}
+	case TypeTeams:
+		// Office 365 connector card, accepted by Teams incoming webhooks
+		payload = map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    n.Title,
+			"themeColor": themeColor(n),
+			"title":      n.Title,
+			"text":       n.Message,
+		}
+	case TypeTelegram:
+		target = telegramAPI + "/bot" + s.ch.BotToken + "/sendMessage"
+		payload = map[string]string{"chat_id": s.ch.ChatID, "text": text}
+	default:
+		payload = n
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return withoutURL(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.ch.Type == TypeHTTP {
+		for k, v := range s.ch.Headers {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("X-Nebula-Event", n.Event)
+		if s.ch.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(s.ch.Secret))
+			mac.Write(body)
+			req.Header.Set("X-Nebula-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return withoutURL(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return &statusError{code: resp.StatusCode, body: strings.TrimSpace(string(msg))}
+	}
+	return nil
+}
+
+// withoutURL drops the URL from a request error. Webhook URLs carry their
+// secret, like the Telegram bot token, and errors end up in the logs and
+// the delivery history.
+func withoutURL(err error) error {
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		return fmt.Errorf("request failed: %w", ue.Err)
+	}
+	return err
+}
+
+// statusError is an unsuccessful response of a webhook
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.code, e.body)
+}
+
+// themeColor returns the card color of a notification: green once resolved,
+// otherwise by severity
+func themeColor(n Notification) string {
+	switch {
+	case n.Status == StatusResolved:
+		return "2EB886"
+	case n.Severity == SeverityCritical:
+		return "D50000"
+	case n.Severity == SeverityWarning:
+		return "F2C744"
+	}
+	return "439FE0"
+}
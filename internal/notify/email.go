@@ -0,0 +1,107 @@
+package notify
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// emailSender sends notifications through an SMTP server
+type emailSender struct {
+	ch ChannelConfig
+}
+
+// Send mails the notification to every recipient
+func (s *emailSender) Send(ctx context.Context, n Notification) error {
+	port := s.ch.SMTPPort
+	if port == 0 {
+		port = 587
+	}
+	addr := net.JoinHostPort(s.ch.SMTPHost, strconv.Itoa(port))
+	tlsConfig := &tls.Config{ServerName: s.ch.SMTPHost}
+
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	var err error
+	if port == 465 {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.ch.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		}
+	}
+	if s.ch.Username != "" {
+		// PlainAuth refuses to send credentials over unencrypted connections
+		if err := client.Auth(smtp.PlainAuth("", s.ch.Username, s.ch.Password, s.ch.SMTPHost)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(s.ch.From); err != nil {
+		return err
+	}
+	for _, to := range s.ch.To {
+		if err := client.Rcpt(to); err != nil {
+			return fmt.Errorf("recipient %s: %w", to, err)
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(s.message(n)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// message builds the mail headers and body
+func (s *emailSender) message(n Notification) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", s.ch.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(s.ch.To, ", "))
+	fmt.Fprintf(&b, "Subject: [Nebula] %s\r\n", headerSafe(n.Title))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	body := n.Message
+	if n.Host != "" {
+		body += "\n\nHost: " + n.Host
+	}
+	body += "\nEvent: " + n.Event + "\nSeverity: " + n.Severity + "\nTime: " + n.Timestamp.Format(time.RFC3339) + "\n"
+	b.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerSafe removes line breaks that would inject mail headers
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
@@ -0,0 +1,114 @@
+package notify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nebula/nebula/internal/events"
+)
+
+// describe turns an event into a notification, with a readable message for
+// the events notifications are usually routed for
+func (m *Manager) describe(event events.Event) Notification {
+	n := Notification{
+		Event:     event.Type,
+		Topic:     event.Topic,
+		Severity:  SeverityInfo,
+		Title:     event.Type,
+		Host:      m.host,
+		Timestamp: event.Timestamp,
+		Data:      event.Data,
+	}
+
+	// Events carry their own types, read them back as plain JSON fields
+	raw, _ := json.Marshal(event.Data)
+	var fields map[string]interface{}
+	json.Unmarshal(raw, &fields)
+	str := func(key string) string {
+		if v, ok := fields[key]; ok && v != nil {
+			return fmt.Sprint(v)
+		}
+		return ""
+	}
+
+	switch event.Type {
+	case "certificate.expiring":
+		n.Severity = SeverityWarning
+		n.Status = StatusFiring
+		n.Title = "Certificate expiring"
+		n.Message = fmt.Sprintf("%s (%s) expires in %s days, on %s.", str("subject"), str("path"), str("days_left"), day(str("not_after")))
+	case "certificate.expired":
+		n.Severity = SeverityCritical
+		n.Status = StatusFiring
+		n.Title = "Certificate expired"
+		n.Message = fmt.Sprintf("%s (%s) expired on %s.", str("subject"), str("path"), day(str("not_after")))
+	case "certificate.resolved":
+		n.Status = StatusResolved
+		n.Title = "Certificate alert resolved"
+		n.Message = fmt.Sprintf("%s (%s) is no longer %s, it was renewed or removed.", str("subject"), str("path"), str("status"))
+	case "update.available":
+		n.Title = "Update available"
+		n.Message = fmt.Sprintf("Nebula %s is available, %s is installed. %s", str("latest_version"), str("current_version"), str("release_url"))
+	case "update.done":
+		n.Title = "Update installed"
+		n.Message = fmt.Sprintf("Nebula %s was installed.", str("version"))
+	case "update.failed":
+		n.Severity = SeverityWarning
+		n.Title = "Update failed"
+		n.Message = fmt.Sprintf("Installing Nebula %s failed: %s", str("version"), str("error"))
+	case "service.failed":
+		n.Severity = SeverityCritical
+		n.Status = StatusFiring
+		n.Title = "Service failed"
+		n.Message = fmt.Sprintf("Service %s is in failed state.", str("name"))
+	case "service.recovered":
+		n.Status = StatusResolved
+		n.Title = "Service recovered"
+		n.Message = fmt.Sprintf("Service %s left the failed state and is %s.", str("name"), str("status"))
+	case "auth.failed":
+		n.Severity = SeverityWarning
+		n.Title = "Failed login"
+		n.Message = fmt.Sprintf("Failed login as %q from %s.", str("user"), str("ip"))
+	case "privilege.failed":
+		n.Severity = SeverityWarning
+		n.Title = "Privileged operation failed"
+		n.Message = fmt.Sprintf("%s failed: %s", str("command"), str("error"))
+	case "storage.recovered":
+		n.Severity = SeverityCritical
+		n.Title = "Database recovered"
+		n.Message = fmt.Sprintf("The database was corrupted (%s) and was re-initialized empty, the damaged file was moved to %s.", str("recovery_cause"), str("moved_to"))
+	case "cluster.rejected":
+		n.Severity = SeverityWarning
+		n.Title = "Cluster token rejected"
+		n.Message = fmt.Sprintf("A request from %s carried an invalid cluster token.", str("ip"))
+	case "power.executing":
+		n.Severity = SeverityWarning
+		n.Title = "Power action"
+		n.Message = fmt.Sprintf("%s requested by %s is starting.", str("action"), str("user"))
+	default:
+		switch {
+		case event.Topic == events.TopicAlerts || event.Topic == events.TopicSecurity:
+			n.Severity = SeverityWarning
+		case strings.HasSuffix(event.Type, ".failed"):
+			n.Severity = SeverityWarning
+		}
+		if len(raw) > 0 && string(raw) != "null" {
+			n.Message = string(raw)
+		}
+	}
+	if n.Host != "" {
+		n.Title += " on " + n.Host
+	}
+	return n
+}
+
+// day formats an RFC3339 time as a date, or returns it unchanged
+func day(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.Format("2006-01-02")
+}
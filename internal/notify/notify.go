@@ -0,0 +1,600 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nebula/nebula/internal/events"
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// Severities of notifications
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert states of notifications, empty for events that aren't alerts
+const (
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+)
+
+// sendTimeout bounds one attempt to deliver a notification to a channel
+const sendTimeout = 15 * time.Second
+
+// sendAttempts is the number of attempts to deliver a routed notification,
+// retryDelay the wait before the first retry, doubled for each further one
+const (
+	sendAttempts = 3
+	retryDelay   = 2 * time.Second
+)
+
+// eventBuffer is the number of events queued for routing
+const eventBuffer = 256
+
+// Storage key prefixes within storage.BucketNotifications
+const (
+	channelPrefix = "channel:"
+	rulePrefix    = "rule:"
+)
+
+// Errors callers can tell apart with errors.Is
+var (
+	// ErrNotFound is returned for channels and rules that don't exist
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned for channel and rule settings that can't be used
+	ErrInvalid = errors.New("invalid settings")
+)
+
+// namePattern matches channel names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Notification is a message delivered to channels
+type Notification struct {
+	// Event is the event type that caused it, e.g. certificate.expired
+	Event     string      `json:"event"`
+	Topic     string      `json:"topic"`
+	Severity  string      `json:"severity"`
+	Status    string      `json:"status,omitempty"`
+	Title     string      `json:"title"`
+	Message   string      `json:"message"`
+	Host      string      `json:"host"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// Rule routes events to channels
+type Rule struct {
+	ID      string `json:"id"`
+	Enabled bool   `json:"enabled"`
+	// Configured rules come from the configuration file and can't be
+	// changed through the API
+	Configured bool `json:"configured,omitempty"`
+	// Events are patterns matched against event types, e.g. certificate.* or *
+	Events []string `json:"events"`
+	// MinSeverity drops notifications below it, empty sends all
+	MinSeverity string   `json:"min_severity,omitempty"`
+	Channels    []string `json:"channels"`
+	// Cooldown is the minimum number of seconds between two notifications
+	// of the same event type, 0 sends every one
+	Cooldown int `json:"cooldown,omitempty"`
+}
+
+// Manager keeps the channels and rules and routes events through them
+type Manager struct {
+	mu       sync.RWMutex
+	store    *storage.Storage
+	host     string
+	channels map[string]ChannelConfig
+	rules    map[string]Rule
+	// lastSent holds when a rule last sent an event type, for cooldowns
+	lastSent map[string]time.Time
+}
+
+// NewManager creates a notification manager, loading channels and rules
+// from store. Without a store they are kept in memory only.
+func NewManager(store *storage.Storage) (*Manager, error) {
+	m := &Manager{
+		store:    store,
+		channels: make(map[string]ChannelConfig),
+		rules:    make(map[string]Rule),
+		lastSent: make(map[string]time.Time),
+	}
+	m.host, _ = os.Hostname()
+	if store == nil {
+		return m, nil
+	}
+
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Reload loads the stored channels and rules again, after they were written
+// to the store directly, as by an import. Those set in the configuration
+// file are kept and keep precedence.
+func (m *Manager) Reload() error {
+	if m.store == nil {
+		return nil
+	}
+	page, err := m.store.Scan(storage.BucketNotifications, storage.ScanOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to load notification settings: %w", err)
+	}
+	channels := make(map[string]ChannelConfig)
+	rules := make(map[string]Rule)
+	for _, item := range page.Items {
+		switch {
+		case strings.HasPrefix(item.Key, channelPrefix):
+			var ch ChannelConfig
+			if err := json.Unmarshal(item.Value, &ch); err != nil {
+				log.Printf("Skipping invalid notification channel %s: %v", item.Key, err)
+				continue
+			}
+			channels[ch.Name] = ch
+		case strings.HasPrefix(item.Key, rulePrefix):
+			var rule Rule
+			if err := json.Unmarshal(item.Value, &rule); err != nil {
+				log.Printf("Skipping invalid notification rule %s: %v", item.Key, err)
+				continue
+			}
+			rules[rule.ID] = rule
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, ch := range m.channels {
+		if ch.Configured {
+			channels[name] = ch
+		}
+	}
+	for id, rule := range m.rules {
+		if rule.Configured {
+			rules[id] = rule
+		}
+	}
+	m.channels, m.rules = channels, rules
+	return nil
+}
+
+// Channels returns the channels sorted by name
+func (m *Manager) Channels() []ChannelConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	channels := make([]ChannelConfig, 0, len(m.channels))
+	for _, ch := range m.channels {
+		channels = append(channels, ch)
+	}
+	sort.Slice(channels, func(i, j int) bool { return channels[i].Name < channels[j].Name })
+	return channels
+}
+
+// Channel returns a channel by name
+func (m *Manager) Channel(name string) (ChannelConfig, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ch, ok := m.channels[name]
+	if !ok {
+		return ChannelConfig{}, fmt.Errorf("channel %s %w", name, ErrNotFound)
+	}
+	return ch, nil
+}
+
+// SaveChannel creates or replaces a channel
+func (m *Manager) SaveChannel(ch ChannelConfig) error {
+	if !namePattern.MatchString(ch.Name) {
+		return fmt.Errorf("%w: channel names may only contain letters, digits, dots, dashes and underscores", ErrInvalid)
+	}
+	if _, err := newSender(ch); err != nil {
+		return err
+	}
+	ch.Configured = false
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.channels[ch.Name].Configured {
+		return fmt.Errorf("%w: channel %s is set in the configuration file", ErrInvalid, ch.Name)
+	}
+	if err := m.persist(channelPrefix+ch.Name, ch); err != nil {
+		return err
+	}
+	m.channels[ch.Name] = ch
+	return nil
+}
+
+// DeleteChannel removes a channel, rules keep referring to it until edited
+func (m *Manager) DeleteChannel(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ch, ok := m.channels[name]
+	if !ok {
+		return fmt.Errorf("channel %s %w", name, ErrNotFound)
+	}
+	if ch.Configured {
+		return fmt.Errorf("%w: channel %s is set in the configuration file", ErrInvalid, name)
+	}
+	if err := m.remove(channelPrefix + name); err != nil {
+		return err
+	}
+	delete(m.channels, name)
+	return nil
+}
+
+// Rules returns the routing rules sorted by ID
+func (m *Manager) Rules() []Rule {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rules := make([]Rule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		rules = append(rules, rule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].ID < rules[j].ID })
+	return rules
+}
+
+// SaveRule creates a rule when its ID is empty, or replaces an existing one
+func (m *Manager) SaveRule(rule Rule) (Rule, error) {
+	if err := validateRule(rule); err != nil {
+		return rule, err
+	}
+	rule.Configured = false
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rule.ID == "" {
+		rule.ID = newID()
+	} else if old, ok := m.rules[rule.ID]; !ok {
+		return rule, fmt.Errorf("rule %s %w", rule.ID, ErrNotFound)
+	} else if old.Configured {
+		return rule, fmt.Errorf("%w: rule %s is set in the configuration file", ErrInvalid, rule.ID)
+	}
+	for _, name := range rule.Channels {
+		if _, ok := m.channels[name]; !ok {
+			return rule, fmt.Errorf("%w: unknown channel %q", ErrInvalid, name)
+		}
+	}
+	if err := m.persist(rulePrefix+rule.ID, rule); err != nil {
+		return rule, err
+	}
+	m.rules[rule.ID] = rule
+	return rule, nil
+}
+
+// DeleteRule removes a rule
+func (m *Manager) DeleteRule(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	rule, ok := m.rules[id]
+	if !ok {
+		return fmt.Errorf("rule %s %w", id, ErrNotFound)
+	}
+	if rule.Configured {
+		return fmt.Errorf("%w: rule %s is set in the configuration file", ErrInvalid, id)
+	}
+	if err := m.remove(rulePrefix + id); err != nil {
+		return err
+	}
+	delete(m.rules, id)
+	return nil
+}
+
+// Configure replaces the channels and rules set in the configuration file,
+// which are kept in memory only and take precedence over stored ones of the
+// same name
+func (m *Manager) Configure(channels []ChannelConfig, rules []Rule) error {
+	for _, ch := range channels {
+		if _, err := newSender(ch); err != nil {
+			return fmt.Errorf("channel %s: %w", ch.Name, err)
+		}
+	}
+	for _, rule := range rules {
+		if err := validateRule(rule); err != nil {
+			return fmt.Errorf("rule %s: %w", rule.ID, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, ch := range m.channels {
+		if ch.Configured {
+			delete(m.channels, name)
+		}
+	}
+	for id, rule := range m.rules {
+		if rule.Configured {
+			delete(m.rules, id)
+		}
+	}
+	for _, ch := range channels {
+		ch.Configured = true
+		m.channels[ch.Name] = ch
+	}
+	for _, rule := range rules {
+		rule.Configured = true
+		m.rules[rule.ID] = rule
+	}
+	return nil
+}
+
+// validateRule checks the patterns and severity of a rule
+func validateRule(rule Rule) error {
+	if len(rule.Events) == 0 {
+		return fmt.Errorf("%w: a rule needs at least one event pattern", ErrInvalid)
+	}
+	for _, pattern := range rule.Events {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("%w: invalid event pattern %q", ErrInvalid, pattern)
+		}
+	}
+	if len(rule.Channels) == 0 {
+		return fmt.Errorf("%w: a rule needs at least one channel", ErrInvalid)
+	}
+	if rule.MinSeverity != "" && severityLevel(rule.MinSeverity) < 0 {
+		return fmt.Errorf("%w: min_severity must be one of info, warning, critical", ErrInvalid)
+	}
+	if rule.Cooldown < 0 {
+		return fmt.Errorf("%w: cooldown must not be negative", ErrInvalid)
+	}
+	return nil
+}
+
+// Test sends a test notification to a channel, whether enabled or not,
+// without retrying
+func (m *Manager) Test(ctx context.Context, name string) error {
+	ch, err := m.Channel(name)
+	if err != nil {
+		return err
+	}
+	return m.deliver(ctx, ch, 1, Notification{
+		Event:     "notification.test",
+		Severity:  SeverityInfo,
+		Title:     "Nebula test notification",
+		Message:   fmt.Sprintf("Channel %s of %s is working.", ch.Name, m.host),
+		Host:      m.host,
+		Timestamp: time.Now(),
+	})
+}
+
+// Start routes the events of the bus to the channels in the background
+// until ctx is cancelled. The bus is subscribed to before Start returns, so
+// events published right after are routed too. Metrics samples are never
+// routed.
+func (m *Manager) Start(ctx context.Context, bus *events.Bus) {
+	var topics []string
+	for _, topic := range events.Topics {
+		if topic != events.TopicMetrics {
+			topics = append(topics, topic)
+		}
+	}
+	sub := bus.Subscribe(eventBuffer, topics...)
+
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				m.route(ctx, event)
+			}
+		}
+	}()
+}
+
+// route sends an event to the channels of the rules matching it
+func (m *Manager) route(ctx context.Context, event events.Event) {
+	n := m.describe(event)
+
+	m.mu.Lock()
+	targets := make(map[string]ChannelConfig)
+	for _, rule := range m.rules {
+		if !rule.Enabled || !matches(rule.Events, event.Type) || severityLevel(n.Severity) < severityLevel(rule.MinSeverity) {
+			continue
+		}
+		if rule.Cooldown > 0 {
+			key := rule.ID + "\x00" + event.Type
+			if time.Since(m.lastSent[key]) < time.Duration(rule.Cooldown)*time.Second {
+				continue
+			}
+			m.lastSent[key] = time.Now()
+		}
+		for _, name := range rule.Channels {
+			if ch, ok := m.channels[name]; ok && ch.Enabled {
+				targets[name] = ch
+			}
+		}
+	}
+	m.mu.Unlock()
+
+	for _, ch := range targets {
+		go func(ch ChannelConfig) {
+			if err := m.deliver(ctx, ch, sendAttempts, n); err != nil {
+				log.Printf("Notification channel %s failed for %s: %v", ch.Name, n.Event, err)
+			}
+		}(ch)
+	}
+}
+
+// deliver sends a notification to a channel, making up to attempts
+// attempts while the failures may be temporary, and records the delivery
+func (m *Manager) deliver(ctx context.Context, ch ChannelConfig, attempts int, n Notification) error {
+	d := storage.NotifyDelivery{
+		ID:          newID(),
+		Channel:     ch.Name,
+		ChannelType: ch.Type,
+		Event:       n.Event,
+		Status:      n.Status,
+		Severity:    n.Severity,
+		Title:       n.Title,
+		StartedAt:   time.Now(),
+	}
+
+	err := m.send(ctx, ch, n)
+	d.Attempts = 1
+	for delay := retryDelay; err != nil && d.Attempts < attempts && !permanent(err); delay *= 2 {
+		if !wait(ctx, delay) {
+			break
+		}
+		err = m.send(ctx, ch, n)
+		d.Attempts++
+	}
+
+	d.Success = err == nil
+	if err != nil {
+		d.Error = err.Error()
+	}
+	d.CompletedAt = time.Now()
+	if m.store != nil {
+		if serr := m.store.AddNotifyDelivery(d); serr != nil {
+			log.Printf("Failed to record notification delivery: %v", serr)
+		}
+	}
+	return err
+}
+
+// send makes one attempt to deliver a notification to a channel
+func (m *Manager) send(ctx context.Context, ch ChannelConfig, n Notification) error {
+	sender, err := newSender(ch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return sender.Send(ctx, n)
+}
+
+// wait sleeps for d, returning false when ctx is cancelled first
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// permanent reports whether a delivery failed in a way retrying won't fix:
+// invalid settings or a request the endpoint rejected
+func permanent(err error) bool {
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code < 500 && se.code != http.StatusRequestTimeout && se.code != http.StatusTooManyRequests
+	}
+	return errors.Is(err, ErrInvalid)
+}
+
+// persist stores a channel or rule when the manager has a store
+func (m *Manager) persist(key string, v interface{}) error {
+	if m.store == nil {
+		return nil
+	}
+	return m.store.SetJSON(storage.BucketNotifications, key, v)
+}
+
+// MaskExport hides the credentials of the channels in entries, an export
+// of storage.BucketNotifications
+func MaskExport(entries map[string]json.RawMessage) error {
+	for key, data := range entries {
+		if !strings.HasPrefix(key, channelPrefix) {
+			continue
+		}
+		var ch ChannelConfig
+		if err := json.Unmarshal(data, &ch); err != nil {
+			return fmt.Errorf("invalid notification channel %s: %w", key, err)
+		}
+		masked, err := json.Marshal(ch.Masked())
+		if err != nil {
+			return err
+		}
+		entries[key] = masked
+	}
+	return nil
+}
+
+// UnmaskImport fills the masked credentials of the channels in entries, an
+// import of storage.BucketNotifications, with those of the stored channels
+// of the same name. Channels new to the instance keep the mask until their
+// credentials are set again.
+func (m *Manager) UnmaskImport(entries map[string]json.RawMessage) error {
+	for key, data := range entries {
+		if !strings.HasPrefix(key, channelPrefix) {
+			continue
+		}
+		var ch ChannelConfig
+		if err := json.Unmarshal(data, &ch); err != nil {
+			return fmt.Errorf("%w: channel %s: %v", ErrInvalid, key, err)
+		}
+		var old ChannelConfig
+		if m.store != nil {
+			if err := m.store.GetJSON(storage.BucketNotifications, key, &old); err != nil {
+				return err
+			}
+		}
+		unmasked, err := json.Marshal(ch.Unmask(old))
+		if err != nil {
+			return err
+		}
+		entries[key] = unmasked
+	}
+	return nil
+}
+
+// remove deletes a channel or rule from the store
+func (m *Manager) remove(key string) error {
+	if m.store == nil {
+		return nil
+	}
+	return m.store.Delete(storage.BucketNotifications, key)
+}
+
+// matches reports whether an event type matches one of the patterns
+func matches(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, eventType); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// severityLevel orders severities, -1 for unknown ones and 0 for empty
+func severityLevel(severity string) int {
+	switch severity {
+	case "", SeverityInfo:
+		return 0
+	case SeverityWarning:
+		return 1
+	case SeverityCritical:
+		return 2
+	}
+	return -1
+}
+
+// newID returns a random rule ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,196 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// discoveryTTL is how long the provider metadata and keys are cached
+const discoveryTTL = time.Hour
+
+// Settings configures a provider
+type Settings struct {
+	// Issuer is the issuer URL, the discovery document is fetched from
+	// Issuer/.well-known/openid-configuration
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+}
+
+// Provider logs users in with the authorization code flow of an OpenID
+// Connect provider such as Keycloak, Google or Azure AD
+type Provider struct {
+	settings Settings
+	client   *http.Client
+
+	mu       sync.Mutex
+	meta     *metadata
+	keys     map[string]interface{}
+	fetched  time.Time
+	keysTime time.Time
+}
+
+// metadata is the part of the discovery document Nebula uses
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider creates a provider. Its metadata is fetched on first use.
+func NewProvider(settings Settings) *Provider {
+	return &Provider{settings: settings, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Settings returns the settings the provider was created with
+func (p *Provider) Settings() Settings {
+	return p.settings
+}
+
+// AuthURL returns the URL of the provider login page. The provider sends
+// the browser back to redirectURL with the code and state.
+func (p *Provider) AuthURL(ctx context.Context, redirectURL, state, nonce, verifier string) (string, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	scopes := p.settings.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.settings.ClientID},
+		"redirect_uri":          {redirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return meta.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades the code of a login for its ID token, then verifies the
+// token was issued to this client for nonce and returns its claims
+func (p *Provider) Exchange(ctx context.Context, code, redirectURL, verifier, nonce string) (Claims, error) {
+	meta, err := p.metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURL},
+		"client_id":     {p.settings.ClientID},
+		"client_secret": {p.settings.ClientSecret},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var token struct {
+		IDToken     string `json:"id_token"`
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token request failed: %s %s %s", resp.Status, token.Error, token.Description)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token response has no id_token, is the openid scope requested?")
+	}
+	return p.verify(ctx, meta, token.IDToken, nonce)
+}
+
+// metadata returns the discovery document, fetched again once discoveryTTL
+// has passed
+func (p *Provider) metadata(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.meta != nil && time.Since(p.fetched) < discoveryTTL {
+		return p.meta, nil
+	}
+
+	issuer := strings.TrimSuffix(p.settings.Issuer, "/")
+	var meta metadata
+	if err := p.getJSON(ctx, issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("provider discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("provider reports issuer %q, expected %q", meta.Issuer, p.settings.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, fmt.Errorf("provider discovery document is incomplete")
+	}
+	p.meta = &meta
+	p.fetched = time.Now()
+	return p.meta, nil
+}
+
+// getJSON fetches and decodes a JSON document. Callers must hold p.mu.
+func (p *Provider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// NewState returns a random value for the state, nonce and PKCE verifier
+// of a login
+func NewState() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// challenge derives the S256 PKCE code challenge of verifier
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,189 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Schema describes a JSON value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaOf describes the JSON encoding of v. Named structs are added to the
+// components and referenced, so each is described once.
+func (d *Document) SchemaOf(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+	return d.schema(reflect.TypeOf(v))
+}
+
+// schema describes t as encoding/json writes it
+func (d *Document) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "Nanoseconds"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	// Types encoding themselves can't be described from their fields
+	if t.Kind() != reflect.Pointer && t.Kind() != reflect.Interface {
+		if implements(t, jsonMarshalerType) {
+			return &Schema{}
+		}
+		if implements(t, textMarshalerType) {
+			return &Schema{Type: "string"}
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Pointer:
+		s := d.schema(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: d.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: d.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return d.structSchema(t)
+		}
+		return d.ref(t)
+	}
+	return &Schema{}
+}
+
+// implements reports whether t or a pointer to it implements iface
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// ref adds the named struct t to the components, the first time it is
+// seen, and returns a reference to it
+func (d *Document) ref(t reflect.Type) *Schema {
+	if name, ok := d.names[t]; ok {
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	name := path.Base(t.PkgPath()) + "." + typeName(t.Name())
+
+	// Registered before the fields so recursive types refer to themselves
+	d.names[t] = name
+	schema := &Schema{}
+	d.Components.Schemas[name] = schema
+	*schema = *d.structSchema(t)
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// typeArgPattern matches the package path of a type argument in the name of
+// an instantiated generic type
+var typeArgPattern = regexp.MustCompile(`[\w./-]*/`)
+
+// typeName makes the name of a generic type instance, such as
+// ListResponse[github.com/nebula/nebula/internal/service.ServiceInfo],
+// usable as a component name: ListResponse_service.ServiceInfo
+func typeName(name string) string {
+	base, args, ok := strings.Cut(name, "[")
+	if !ok {
+		return name
+	}
+	args = typeArgPattern.ReplaceAllString(strings.TrimSuffix(args, "]"), "")
+	return base + "_" + strings.NewReplacer(",", "_", "[", "_", "]", "", "*", "", " ", "").Replace(args)
+}
+
+// structSchema describes the fields of t, following the encoding/json
+// rules for tags and embedded structs
+func (d *Document) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	d.addFields(s, t)
+	return s
+}
+
+// addFields adds the exported fields of t to s
+func (d *Document) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				d.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var fs *Schema
+		if strings.Contains(","+opts+",", ",string,") {
+			fs = &Schema{Type: "string"}
+		} else {
+			fs = d.schema(f.Type)
+		}
+		if desc := f.Tag.Get("desc"); desc != "" && fs.Ref == "" {
+			fs.Description = desc
+		}
+		s.Properties[name] = fs
+
+		if strings.Contains(f.Tag.Get("binding"), "required") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
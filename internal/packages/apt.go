@@ -123,6 +123,15 @@ func (m *AptManager) UpgradeAll() error {
 	return nil
 }
 
+// Clean removes downloaded package files from the cache
+func (m *AptManager) Clean() error {
+	cmd := exec.Command("apt-get", "clean")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clean package cache: %s", string(output))
+	}
+	return nil
+}
+
 // Info returns package information
 func (m *AptManager) Info(name string) (PackageInfo, error) {
 	cmd := exec.Command("apt-cache", "show", name)
@@ -235,6 +244,15 @@ func (m *YumManager) UpgradeAll() error {
 	return nil
 }
 
+func (m *YumManager) Clean() error {
+	cmd := exec.Command("yum", "clean", "all")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed: %s", string(output))
+	}
+	return nil
+}
+
 func (m *YumManager) Info(name string) (PackageInfo, error) {
 	cmd := exec.Command("yum", "info", name)
 	output, _ := cmd.Output()
@@ -112,6 +112,15 @@ func (m *BrewManager) UpgradeAll() error {
 	return nil
 }
 
+// Clean removes old downloads and versions from the cache
+func (m *BrewManager) Clean() error {
+	cmd := exec.Command("brew", "cleanup")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clean package cache: %s", string(output))
+	}
+	return nil
+}
+
 // Info returns package information
 func (m *BrewManager) Info(name string) (PackageInfo, error) {
 	cmd := exec.Command("brew", "info", "--json=v2", name)
@@ -118,6 +118,15 @@ func (m *ChocoManager) UpgradeAll() error {
 	return nil
 }
 
+// Clean removes cached packages
+func (m *ChocoManager) Clean() error {
+	cmd := exec.Command("choco", "cache", "remove", "-y", "--no-color")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clean package cache: %s", string(output))
+	}
+	return nil
+}
+
 // Info returns package information
 func (m *ChocoManager) Info(name string) (PackageInfo, error) {
 	cmd := exec.Command("choco", "info", name, "--no-color")
@@ -256,6 +265,11 @@ func (m *WingetManager) UpgradeAll() error {
 	return nil
 }
 
+// Clean is not supported, winget removes installers after use
+func (m *WingetManager) Clean() error {
+	return fmt.Errorf("winget has no package cache to clean")
+}
+
 // Info returns package information
 func (m *WingetManager) Info(name string) (PackageInfo, error) {
 	cmd := exec.Command("winget", "show", name)
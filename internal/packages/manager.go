@@ -35,6 +35,9 @@ type Manager interface {
 	// UpgradeAll upgrades all packages
 	UpgradeAll() error
 	
+	// Clean removes downloaded packages from the cache
+	Clean() error
+	
 	// Info returns package information
 	Info(name string) (PackageInfo, error)
 	
@@ -80,5 +83,6 @@ func (m *NullManager) Install(name string) error            { return nil }
 func (m *NullManager) Remove(name string) error             { return nil }
 func (m *NullManager) Update(name string) error             { return nil }
 func (m *NullManager) UpgradeAll() error                    { return nil }
+func (m *NullManager) Clean() error                         { return nil }
 func (m *NullManager) Info(name string) (PackageInfo, error) { return PackageInfo{}, nil }
 func (m *NullManager) Type() string                         { return "none" }
@@ -0,0 +1,168 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hash algorithms
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// Parameters of new hashes, the OWASP recommendations for argon2id
+const (
+	argonMemory  = 19 * 1024 // KiB
+	argonTime    = 2
+	argonThreads = 1
+	argonKeyLen  = 32
+	bcryptCost   = 12
+)
+
+// cacheTTL is how long a verified password is remembered, so basic auth
+// clients sending it with every request don't pay for the hash each time
+const cacheTTL = 5 * time.Minute
+
+// Hash hashes a password with algorithm, Argon2id or Bcrypt
+func Hash(password, algorithm string) (string, error) {
+	switch algorithm {
+	case Argon2id:
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+		return string(hash), err
+	}
+	return "", fmt.Errorf("unknown hash algorithm %q", algorithm)
+}
+
+// IsHash reports whether s is a bcrypt or argon2id hash rather than a
+// plaintext password
+func IsHash(s string) bool {
+	return isBcrypt(s) || strings.HasPrefix(s, "$argon2id$")
+}
+
+// Validate checks that a hash can be verified
+func Validate(hash string) error {
+	if isBcrypt(hash) {
+		_, err := bcrypt.Cost([]byte(hash))
+		return err
+	}
+	_, err := parseArgon2id(hash)
+	return err
+}
+
+// Verifier checks passwords against plaintext or hashed configured ones
+type Verifier struct {
+	mu sync.Mutex
+	// cache holds the expiry of recent successful checks of a hash, keyed
+	// by a digest of the hash and the password
+	cache map[[sha256.Size]byte]time.Time
+}
+
+// NewVerifier creates a verifier
+func NewVerifier() *Verifier {
+	return &Verifier{cache: make(map[[sha256.Size]byte]time.Time)}
+}
+
+// Verify reports whether password matches expected, a plaintext password
+// or a hash. Plaintext passwords are compared in constant time.
+func (v *Verifier) Verify(expected, password string) bool {
+	if !IsHash(expected) {
+		a := sha256.Sum256([]byte(expected))
+		b := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(a[:], b[:]) == 1
+	}
+
+	key := sha256.Sum256([]byte(expected + "\x00" + password))
+	now := time.Now()
+	v.mu.Lock()
+	expiry, ok := v.cache[key]
+	v.mu.Unlock()
+	if ok && now.Before(expiry) {
+		return true
+	}
+
+	if !verifyHash(expected, password) {
+		return false
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for k, e := range v.cache {
+		if now.After(e) {
+			delete(v.cache, k)
+		}
+	}
+	v.cache[key] = now.Add(cacheTTL)
+	return true
+}
+
+// verifyHash checks password against a bcrypt or argon2id hash
+func verifyHash(hash, password string) bool {
+	if isBcrypt(hash) {
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	p, err := parseArgon2id(hash)
+	if err != nil {
+		return false
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	return subtle.ConstantTimeCompare(key, p.key) == 1
+}
+
+// isBcrypt reports whether s looks like a bcrypt hash
+func isBcrypt(s string) bool {
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// argon2Params are the fields of an encoded argon2id hash
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2id decodes $argon2id$v=19$m=19456,t=2,p=1$salt$key
+func parseArgon2id(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return nil, fmt.Errorf("not an argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("unsupported argon2id version")
+	}
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	if p.memory == 0 || p.time == 0 || p.threads == 0 {
+		return nil, fmt.Errorf("invalid argon2id parameters")
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("invalid argon2id salt")
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return nil, fmt.Errorf("invalid argon2id key")
+	}
+	return p, nil
+}
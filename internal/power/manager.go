@@ -0,0 +1,253 @@
+package power
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions the manager can perform
+const (
+	ActionReboot   = "reboot"
+	ActionShutdown = "shutdown"
+	ActionSuspend  = "suspend"
+)
+
+// ConfirmTTL is how long a confirmation token stays valid
+const ConfirmTTL = time.Minute
+
+// minDelay leaves time to answer the request and notify users before an
+// action requested for now runs
+const minDelay = 5 * time.Second
+
+// Errors callers can tell apart with errors.Is
+var (
+	ErrUnsupported = errors.New("action not supported on this system")
+	ErrPending     = errors.New("another action is already scheduled")
+	ErrConfirm     = errors.New("invalid or expired confirmation token")
+)
+
+// Schedule is a power action waiting to run
+type Schedule struct {
+	ID        string    `json:"id"`
+	Action    string    `json:"action"`
+	At        time.Time `json:"at"`
+	User      string    `json:"user"`
+	Message   string    `json:"message,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// confirmation is an issued confirmation token
+type confirmation struct {
+	action  string
+	user    string
+	expires time.Time
+}
+
+// Manager reboots, shuts down and suspends the system. Every action needs a
+// confirmation token issued to the same user beforehand, and runs after a
+// delay during which logged in users are warned and it can be cancelled.
+type Manager struct {
+	mu        sync.Mutex
+	tokens    map[string]confirmation
+	pending   *Schedule
+	timer     *time.Timer
+	onExecute func(Schedule, error)
+}
+
+// NewManager creates a power manager
+func NewManager() *Manager {
+	return &Manager{tokens: make(map[string]confirmation)}
+}
+
+// Supported returns the actions available on this system
+func (m *Manager) Supported() []string {
+	return supported()
+}
+
+// IsSupported reports whether action is available on this system
+func (m *Manager) IsSupported(action string) bool {
+	for _, a := range supported() {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
+
+// OnExecute registers a function called when a scheduled action runs, with
+// the error of the system command
+func (m *Manager) OnExecute(fn func(Schedule, error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onExecute = fn
+}
+
+// Confirmation issues a token user must send back to perform action
+func (m *Manager) Confirmation(action, user string) (string, time.Time, error) {
+	if !m.IsSupported(action) {
+		return "", time.Time{}, ErrUnsupported
+	}
+
+	token := newID(16)
+	expires := time.Now().Add(ConfirmTTL)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for t, c := range m.tokens {
+		if time.Now().After(c.expires) {
+			delete(m.tokens, t)
+		}
+	}
+	m.tokens[token] = confirmation{action: action, user: user, expires: expires}
+	return token, expires, nil
+}
+
+// Schedule runs action at the given time, or shortly when at is zero or
+// past. token must have been issued to user for action and is consumed.
+func (m *Manager) Schedule(token, action, user, message string, at time.Time) (Schedule, error) {
+	if !m.IsSupported(action) {
+		return Schedule{}, ErrUnsupported
+	}
+
+	m.mu.Lock()
+	c, ok := m.tokens[token]
+	delete(m.tokens, token)
+	if !ok || c.action != action || c.user != user || time.Now().After(c.expires) {
+		m.mu.Unlock()
+		return Schedule{}, ErrConfirm
+	}
+	if m.pending != nil {
+		err := fmt.Errorf("%w: %s at %s", ErrPending, m.pending.Action, m.pending.At.Format(time.RFC3339))
+		m.mu.Unlock()
+		return Schedule{}, err
+	}
+
+	now := time.Now()
+	if at.Before(now.Add(minDelay)) {
+		at = now.Add(minDelay)
+	}
+	s := Schedule{
+		ID:        newID(8),
+		Action:    action,
+		At:        at,
+		User:      user,
+		Message:   message,
+		CreatedAt: now,
+	}
+	m.pending = &s
+	m.timer = time.AfterFunc(time.Until(at), func() { m.execute(s) })
+	m.mu.Unlock()
+
+	notify(fmt.Sprintf("The system will %s at %s (requested by %s)", action, at.Format("15:04 MST"), user), message)
+	return s, nil
+}
+
+// Pending returns the scheduled action, if any
+func (m *Manager) Pending() *Schedule {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.pending == nil {
+		return nil
+	}
+	s := *m.pending
+	return &s
+}
+
+// Cancel cancels the scheduled action
+func (m *Manager) Cancel(user string) (Schedule, bool) {
+	m.mu.Lock()
+	if m.pending == nil || !m.timer.Stop() {
+		m.mu.Unlock()
+		return Schedule{}, false
+	}
+	s := *m.pending
+	m.pending = nil
+	m.timer = nil
+	m.mu.Unlock()
+
+	notify(fmt.Sprintf("The scheduled %s was cancelled by %s", s.Action, user), "")
+	return s, true
+}
+
+// execute runs a scheduled action
+func (m *Manager) execute(s Schedule) {
+	m.mu.Lock()
+	if m.pending == nil || m.pending.ID != s.ID {
+		m.mu.Unlock()
+		return
+	}
+	m.pending = nil
+	m.timer = nil
+	onExecute := m.onExecute
+	m.mu.Unlock()
+
+	log.Printf("Running %s requested by %s", s.Action, s.User)
+	err := execute(s.Action)
+	if err != nil {
+		log.Printf("Failed to %s: %v", s.Action, err)
+	}
+	if onExecute != nil {
+		onExecute(s, err)
+	}
+}
+
+// notify sends a message to the terminals of logged in users
+func notify(text, message string) {
+	if message != "" {
+		text += ": " + message
+	}
+	if err := wall("Nebula: " + text); err != nil {
+		log.Printf("Failed to notify logged in users: %v", err)
+	}
+}
+
+// ParseAt parses when to run an action: empty for now, HH:MM for the next
+// time the clock shows it, or an RFC3339 time
+func ParseAt(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if clock, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+
+	at, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use HH:MM or RFC3339", value)
+	}
+	if at.Before(now) {
+		return time.Time{}, fmt.Errorf("time %q is in the past", value)
+	}
+	return at, nil
+}
+
+// newID returns a random identifier of n bytes
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// runCommand runs a system command, including its output in the error
+func runCommand(cmd *exec.Cmd) error {
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s: %w: %s", cmd.Args[0], err, out)
+		}
+		return fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+//go:build !windows
+
+package power
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// supported returns the actions available on this system
+func supported() []string {
+	actions := []string{ActionReboot, ActionShutdown}
+	if canSuspend() {
+		actions = append(actions, ActionSuspend)
+	}
+	return actions
+}
+
+// canSuspend reports whether the system can sleep
+func canSuspend() bool {
+	switch runtime.GOOS {
+	case "darwin":
+		return true
+	case "linux":
+		if _, err := exec.LookPath("systemctl"); err != nil {
+			return false
+		}
+		state, err := os.ReadFile("/sys/power/state")
+		return err == nil && strings.Contains(string(state), "mem")
+	}
+	return false
+}
+
+// execute runs a power action, systemd is preferred on Linux so services
+// are stopped in order
+func execute(action string) error {
+	_, err := exec.LookPath("systemctl")
+	systemd := runtime.GOOS == "linux" && err == nil
+
+	var cmd *exec.Cmd
+	switch {
+	case action == ActionReboot && systemd:
+		cmd = exec.Command("systemctl", "reboot")
+	case action == ActionReboot:
+		cmd = exec.Command("shutdown", "-r", "now")
+	case action == ActionShutdown && systemd:
+		cmd = exec.Command("systemctl", "poweroff")
+	case action == ActionShutdown && runtime.GOOS == "linux":
+		cmd = exec.Command("shutdown", "-h", "now")
+	case action == ActionShutdown:
+		// -p powers off on the BSDs, -h only halts there; macOS powers off with -h
+		flag := "-p"
+		if runtime.GOOS == "darwin" {
+			flag = "-h"
+		}
+		cmd = exec.Command("shutdown", flag, "now")
+	case action == ActionSuspend && runtime.GOOS == "darwin":
+		cmd = exec.Command("pmset", "sleepnow")
+	case action == ActionSuspend && systemd:
+		cmd = exec.Command("systemctl", "suspend")
+	default:
+		return ErrUnsupported
+	}
+	return runCommand(cmd)
+}
+
+// wall writes a message to the terminals of logged in users
+func wall(message string) error {
+	if _, err := exec.LookPath("wall"); err != nil {
+		return nil
+	}
+	cmd := exec.Command("wall")
+	cmd.Stdin = strings.NewReader(message + "\n")
+	return cmd.Run()
+}
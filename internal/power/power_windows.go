@@ -0,0 +1,34 @@
+//go:build windows
+
+package power
+
+import (
+	"os/exec"
+)
+
+// supported returns the actions available on this system
+func supported() []string {
+	return []string{ActionReboot, ActionShutdown, ActionSuspend}
+}
+
+// execute runs a power action
+func execute(action string) error {
+	var cmd *exec.Cmd
+	switch action {
+	case ActionReboot:
+		cmd = exec.Command("shutdown", "/r", "/t", "0")
+	case ActionShutdown:
+		cmd = exec.Command("shutdown", "/s", "/t", "0")
+	case ActionSuspend:
+		// Sleeps instead of hibernating unless hibernation is enabled
+		cmd = exec.Command("rundll32.exe", "powrprof.dll,SetSuspendState", "0,1,0")
+	default:
+		return ErrUnsupported
+	}
+	return runCommand(cmd)
+}
+
+// wall shows a message in the sessions of logged in users
+func wall(message string) error {
+	return exec.Command("msg", "*", "/TIME:300", message).Run()
+}
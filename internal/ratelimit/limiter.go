@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled are dropped
+const sweepInterval = time.Minute
+
+// ipRoute is the route of the per-IP buckets
+const ipRoute = -2
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate
+// requests per second
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Route overrides the default limit for the requests under a path prefix
+type Route struct {
+	Prefix string
+	// Methods restricts the override to these methods, all methods when empty
+	Methods []string
+	Limit
+}
+
+// Settings configures the limiter
+type Settings struct {
+	Enabled bool
+	// Default applies to requests matching no route
+	Default Limit
+	// Routes are matched by longest prefix
+	Routes []Route
+	// PerIP applies to every request of an IP address, checked before the
+	// client authenticates so failed logins are limited too
+	PerIP Limit
+}
+
+// Limiter keeps a token bucket per client and limit
+type Limiter struct {
+	mu       sync.Mutex
+	settings Settings
+	buckets  map[bucketKey]*bucket
+	swept    time.Time
+	now      func() time.Time
+}
+
+// bucketKey identifies the bucket of a client for a route, -1 for the
+// default limit and ipRoute for the per-IP limit
+type bucketKey struct {
+	client string
+	route  int
+}
+
+// bucket holds the tokens left at a point in time
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	limit   Limit
+}
+
+// NewLimiter creates a limiter
+func NewLimiter(settings Settings) *Limiter {
+	l := &Limiter{buckets: make(map[bucketKey]*bucket), now: time.Now}
+	l.Configure(settings)
+	return l
+}
+
+// Configure replaces the settings. Clients start over with full buckets.
+func (l *Limiter) Configure(settings Settings) {
+	routes := append([]Route(nil), settings.Routes...)
+	sort.SliceStable(routes, func(i, j int) bool { return len(routes[i].Prefix) > len(routes[j].Prefix) })
+	settings.Routes = routes
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.settings = settings
+	l.buckets = make(map[bucketKey]*bucket)
+}
+
+// Allow takes a token from the bucket of client for a request. When the
+// bucket is empty it reports how long until the next token.
+func (l *Limiter) Allow(client, method, path string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.settings.Enabled {
+		return true, 0
+	}
+
+	route, limit := l.match(method, path)
+	return l.take(bucketKey{client: client, route: route}, limit)
+}
+
+// AllowIP takes a token from the per-IP bucket of ip
+func (l *Limiter) AllowIP(ip string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.settings.Enabled {
+		return true, 0
+	}
+	return l.take(bucketKey{client: ip, route: ipRoute}, l.settings.PerIP)
+}
+
+// take takes a token from the bucket at key, created full with limit.
+// Callers must hold l.mu.
+func (l *Limiter) take(key bucketKey, limit Limit) (bool, time.Duration) {
+	if limit.Rate <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: float64(limit.Burst), updated: now, limit: limit}
+		l.buckets[key] = b
+	}
+	b.refill(now)
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// match returns the index and limit of the route for a request, -1 and the
+// default limit when no route matches
+func (l *Limiter) match(method, path string) (int, Limit) {
+	for i, r := range l.settings.Routes {
+		if !strings.HasPrefix(path, r.Prefix) {
+			continue
+		}
+		if len(r.Methods) == 0 {
+			return i, r.Limit
+		}
+		for _, m := range r.Methods {
+			if strings.EqualFold(m, method) {
+				return i, r.Limit
+			}
+		}
+	}
+	return -1, l.settings.Default
+}
+
+// sweep drops the buckets that have refilled, they are the same as new
+// ones. Callers must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < sweepInterval {
+		return
+	}
+	l.swept = now
+	for key, b := range l.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// refill adds the tokens earned since the last update, up to the burst
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.updated).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.limit.Burst), b.tokens+elapsed*b.limit.Rate)
+		b.updated = now
+	}
+}
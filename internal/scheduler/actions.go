@@ -0,0 +1,79 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Built-in actions. Only command is registered by the scheduler itself,
+// the others need the managers they act on.
+const (
+	ActionCommand        = "command"
+	ActionBackup         = "backup"
+	ActionCleanCache     = "clean_cache"
+	ActionRestartService = "restart_service"
+)
+
+// waitDelay is how long a killed command may keep its output open
+const waitDelay = 5 * time.Second
+
+// Output captures the output of a run up to a limit
+type Output struct {
+	mu        sync.Mutex
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+// newOutput creates an output keeping up to limit bytes, 0 for no limit
+func newOutput(limit int) *Output {
+	return &Output{limit: limit}
+}
+
+// Write keeps what fits within the limit and discards the rest
+func (o *Output) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := len(p)
+	if o.limit > 0 {
+		if room := o.limit - o.buf.Len(); room < len(p) {
+			p = p[:max(room, 0)]
+			o.truncated = true
+		}
+	}
+	o.buf.Write(p)
+	return n, nil
+}
+
+// String returns the captured output
+func (o *Output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
+
+// Truncated reports whether output was discarded
+func (o *Output) Truncated() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.truncated
+}
+
+// runCommand runs the task command with the system shell
+func runCommand(ctx context.Context, task Task, out *Output) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", task.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", task.Command)
+	}
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// Don't wait forever for background processes still holding the output
+	cmd.WaitDelay = waitDelay
+	return cmd.Run()
+}
@@ -0,0 +1,472 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// Run states
+const (
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	// StatusSkipped is recorded when a task was due while it was still
+	// running or the concurrency limit was reached
+	StatusSkipped = "skipped"
+)
+
+// Run triggers
+const (
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+)
+
+// defaultTimeout bounds tasks that don't set a timeout
+const defaultTimeout = time.Hour
+
+// Errors callers can tell apart with errors.Is
+var (
+	// ErrNotFound is returned for tasks that don't exist
+	ErrNotFound = errors.New("task not found")
+	// ErrInvalid is returned for task definitions that can't be scheduled
+	ErrInvalid = errors.New("invalid task")
+	// ErrBusy is returned when a task can't start now
+	ErrBusy = errors.New("task can't start")
+)
+
+// Task is a recurring Nebula task
+type Task struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Cron is a five field cron expression or a macro such as @daily, in local time
+	Cron string `json:"cron"`
+	// Action is one of the registered actions, e.g. command or backup
+	Action string `json:"action"`
+	// Command is run by the shell for the command action
+	Command string `json:"command,omitempty"`
+	// Service is restarted by the restart_service action
+	Service string `json:"service,omitempty"`
+	// Timeout in seconds, 0 uses one hour
+	Timeout   int       `json:"timeout,omitempty"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaskState is a task with its scheduling state
+type TaskState struct {
+	Task
+	NextRun    time.Time `json:"next_run,omitempty"`
+	Running    bool      `json:"running"`
+	LastRun    time.Time `json:"last_run,omitempty"`
+	LastStatus string    `json:"last_status,omitempty"`
+}
+
+// Action performs a task, writing its output to out
+type Action func(ctx context.Context, task Task, out *Output) error
+
+// Settings configures execution limits
+type Settings struct {
+	// MaxConcurrent is the number of tasks running at once, 0 for no limit
+	MaxConcurrent int
+	// MaxOutput is the number of output bytes kept per run
+	MaxOutput int
+}
+
+// entry is a task and its in-memory state
+type entry struct {
+	task       Task
+	cron       *Cron
+	next       time.Time
+	running    bool
+	lastRun    time.Time
+	lastStatus string
+}
+
+// Scheduler runs tasks on their cron schedule
+type Scheduler struct {
+	mu       sync.Mutex
+	store    *storage.Storage
+	settings Settings
+	actions  map[string]Action
+	tasks    map[string]*entry
+	running  int
+	onRun    []func(storage.TaskRun)
+	// ctx is cancelled on shutdown, stopping the running tasks
+	ctx context.Context
+}
+
+// NewScheduler creates a scheduler, loading the tasks from store. Without a
+// store tasks and history are kept in memory only and history is not kept.
+func NewScheduler(store *storage.Storage, settings Settings) (*Scheduler, error) {
+	s := &Scheduler{
+		store:    store,
+		settings: settings,
+		actions:  map[string]Action{ActionCommand: runCommand},
+		tasks:    make(map[string]*entry),
+		ctx:      context.Background(),
+	}
+	if store == nil {
+		return s, nil
+	}
+
+	tasks, err := loadTasks(store)
+	if err != nil {
+		return nil, err
+	}
+	s.tasks = tasks
+	return s, nil
+}
+
+// loadTasks reads the tasks kept in store, scheduled from now
+func loadTasks(store *storage.Storage) (map[string]*entry, error) {
+	page, err := store.Scan(storage.BucketTasks, storage.ScanOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tasks: %w", err)
+	}
+	now := time.Now()
+	tasks := make(map[string]*entry, len(page.Items))
+	for _, item := range page.Items {
+		var task Task
+		if err := json.Unmarshal(item.Value, &task); err != nil {
+			log.Printf("Skipping invalid task %s: %v", item.Key, err)
+			continue
+		}
+		cron, err := ParseCron(task.Cron)
+		if err != nil {
+			log.Printf("Skipping task %s: %v", task.Name, err)
+			continue
+		}
+		tasks[task.ID] = &entry{task: task, cron: cron, next: cron.Next(now)}
+	}
+	return tasks, nil
+}
+
+// Reload loads the tasks again after they were written to the store
+// directly, as by an import. Tasks still there keep their state, running
+// executions of removed ones finish.
+func (s *Scheduler) Reload() error {
+	if s.store == nil {
+		return nil
+	}
+	tasks, err := loadTasks(s.store)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, e := range tasks {
+		old, ok := s.tasks[id]
+		if !ok {
+			continue
+		}
+		// Running executions record their result in the entry they started from
+		if old.task.Cron != e.task.Cron {
+			old.cron, old.next = e.cron, e.next
+		}
+		old.task = e.task
+		tasks[id] = old
+	}
+	s.tasks = tasks
+	return nil
+}
+
+// Register makes an action available to tasks
+func (s *Scheduler) Register(name string, action Action) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.actions[name] = action
+}
+
+// Actions returns the names of the registered actions
+func (s *Scheduler) Actions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.actions))
+	for name := range s.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configure replaces the execution limits, running tasks keep theirs
+func (s *Scheduler) Configure(settings Settings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+// OnRun registers a function called when a run starts and when it ends
+func (s *Scheduler) OnRun(fn func(storage.TaskRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRun = append(s.onRun, fn)
+}
+
+// Tasks returns the tasks sorted by name
+func (s *Scheduler) Tasks() []TaskState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]TaskState, 0, len(s.tasks))
+	for _, e := range s.tasks {
+		states = append(states, e.state())
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// Get returns a task
+func (s *Scheduler) Get(id string) (TaskState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.tasks[id]
+	if !ok {
+		return TaskState{}, ErrNotFound
+	}
+	return e.state(), nil
+}
+
+// Save creates a task when its ID is empty, or replaces an existing one
+func (s *Scheduler) Save(task Task, user string) (TaskState, error) {
+	task.Name = strings.TrimSpace(task.Name)
+	if task.Name == "" {
+		return TaskState{}, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	cron, err := ParseCron(task.Cron)
+	if err != nil {
+		return TaskState{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if task.Timeout < 0 {
+		return TaskState{}, fmt.Errorf("%w: timeout must not be negative", ErrInvalid)
+	}
+	switch task.Action {
+	case ActionCommand:
+		if strings.TrimSpace(task.Command) == "" {
+			return TaskState{}, fmt.Errorf("%w: command is required", ErrInvalid)
+		}
+	case ActionRestartService:
+		if task.Service == "" {
+			return TaskState{}, fmt.Errorf("%w: service is required", ErrInvalid)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.actions[task.Action]; !ok {
+		return TaskState{}, fmt.Errorf("%w: unknown action %q", ErrInvalid, task.Action)
+	}
+
+	now := time.Now()
+	e, exists := s.tasks[task.ID]
+	switch {
+	case task.ID == "":
+		task.ID = newID()
+		task.CreatedBy = user
+		task.CreatedAt = now
+		e = &entry{}
+	case !exists:
+		return TaskState{}, ErrNotFound
+	default:
+		task.CreatedBy = e.task.CreatedBy
+		task.CreatedAt = e.task.CreatedAt
+	}
+	task.UpdatedAt = now
+
+	if s.store != nil {
+		if err := s.store.SetJSON(storage.BucketTasks, task.ID, task); err != nil {
+			return TaskState{}, err
+		}
+	}
+	e.task = task
+	e.cron = cron
+	e.next = cron.Next(now)
+	s.tasks[task.ID] = e
+	return e.state(), nil
+}
+
+// Delete removes a task, a running execution finishes
+func (s *Scheduler) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.tasks[id]; !ok {
+		return ErrNotFound
+	}
+	if s.store != nil {
+		if err := s.store.Delete(storage.BucketTasks, id); err != nil {
+			return err
+		}
+	}
+	delete(s.tasks, id)
+	return nil
+}
+
+// RunNow starts a task immediately on behalf of user, whether enabled or not
+func (s *Scheduler) RunNow(id, user string) (storage.TaskRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.tasks[id]
+	if !ok {
+		return storage.TaskRun{}, ErrNotFound
+	}
+	return s.start(e, TriggerManual, user)
+}
+
+// Start runs the due tasks every minute until ctx is cancelled, which also
+// stops the running ones
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	for {
+		now := time.Now()
+		timer := time.NewTimer(now.Truncate(time.Minute).Add(time.Minute).Sub(now))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case now = <-timer.C:
+		}
+
+		s.mu.Lock()
+		for _, e := range s.tasks {
+			if !e.task.Enabled || e.next.IsZero() || e.next.After(now) {
+				continue
+			}
+			e.next = e.cron.Next(now)
+			if _, err := s.start(e, TriggerSchedule, ""); err != nil {
+				log.Printf("Task %s skipped: %v", e.task.Name, err)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// start launches a run of e, recording it as skipped when the task is
+// already running or the concurrency limit is reached. s.mu must be held.
+func (s *Scheduler) start(e *entry, trigger, user string) (storage.TaskRun, error) {
+	run := storage.TaskRun{
+		ID:        newID(),
+		TaskID:    e.task.ID,
+		TaskName:  e.task.Name,
+		Trigger:   trigger,
+		User:      user,
+		StartedAt: time.Now(),
+	}
+
+	var reason string
+	switch {
+	case e.running:
+		reason = "previous run still in progress"
+	case s.settings.MaxConcurrent > 0 && s.running >= s.settings.MaxConcurrent:
+		reason = fmt.Sprintf("%d tasks already running", s.running)
+	}
+	if reason != "" {
+		run.Status = StatusSkipped
+		run.Error = reason
+		run.FinishedAt = run.StartedAt
+		go s.finish(run)
+		return run, fmt.Errorf("%w: %s", ErrBusy, reason)
+	}
+
+	action := s.actions[e.task.Action]
+	if action == nil {
+		run.Status = StatusFailed
+		run.Error = fmt.Sprintf("action %s not available", e.task.Action)
+		run.FinishedAt = run.StartedAt
+		go s.finish(run)
+		return run, fmt.Errorf("%w: %s", ErrBusy, run.Error)
+	}
+
+	e.running = true
+	s.running++
+	run.Status = StatusRunning
+	task := e.task
+	out := newOutput(s.settings.MaxOutput)
+	listeners := s.onRun
+	ctx := s.ctx
+
+	go func() {
+		for _, fn := range listeners {
+			fn(run)
+		}
+
+		timeout := defaultTimeout
+		if task.Timeout > 0 {
+			timeout = time.Duration(task.Timeout) * time.Second
+		}
+		runCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := action(runCtx, task, out)
+		cancel()
+
+		run.FinishedAt = time.Now()
+		run.Output, run.Truncated = out.String(), out.Truncated()
+		run.Status = StatusSucceeded
+		if err != nil {
+			run.Status = StatusFailed
+			run.Error = err.Error()
+			if runCtx.Err() == context.DeadlineExceeded {
+				run.Error = fmt.Sprintf("timed out after %s: %v", timeout, err)
+			}
+		}
+
+		s.mu.Lock()
+		e.running = false
+		e.lastRun = run.StartedAt
+		e.lastStatus = run.Status
+		s.running--
+		s.mu.Unlock()
+
+		s.finish(run)
+	}()
+	return run, nil
+}
+
+// finish stores a completed run and reports it
+func (s *Scheduler) finish(run storage.TaskRun) {
+	if s.store != nil {
+		if err := s.store.AddTaskRun(run); err != nil {
+			log.Printf("Failed to record run of task %s: %v", run.TaskName, err)
+		}
+	}
+	if run.Status == StatusFailed {
+		log.Printf("Task %s failed: %s", run.TaskName, run.Error)
+	}
+
+	s.mu.Lock()
+	listeners := s.onRun
+	s.mu.Unlock()
+	for _, fn := range listeners {
+		fn(run)
+	}
+}
+
+// state returns the task with its scheduling state
+func (e *entry) state() TaskState {
+	state := TaskState{Task: e.task, Running: e.running, LastRun: e.lastRun, LastStatus: e.lastStatus}
+	if e.task.Enabled {
+		state.NextRun = e.next
+	}
+	return state
+}
+
+// newID returns a random task or run ID
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -164,6 +164,11 @@ func (m *LaunchctlManager) Restart(name string) error {
 	return m.Start(name)
 }
 
+// Reload restarts a service, launchd has no reload
+func (m *LaunchctlManager) Reload(name string) error {
+	return m.Restart(name)
+}
+
 // Enable enables a service (load)
 func (m *LaunchctlManager) Enable(name string) error {
 	plistPath := m.findPlist(name)
@@ -36,6 +36,10 @@ type Manager interface {
 	// Restart restarts a service
 	Restart(name string) error
 	
+	// Reload asks a service to reload its configuration, restarting it
+	// where reloading isn't supported
+	Reload(name string) error
+	
 	// Enable enables a service to start at boot
 	Enable(name string) error
 	
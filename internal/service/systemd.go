@@ -146,6 +146,15 @@ func (m *SystemdManager) Restart(name string) error {
 	return nil
 }
 
+// Reload reloads a service, or restarts it when it has no reload command
+func (m *SystemdManager) Reload(name string) error {
+	cmd := exec.Command("systemctl", "reload-or-restart", name+".service")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reload service: %s", string(output))
+	}
+	return nil
+}
+
 // Enable enables a service
 func (m *SystemdManager) Enable(name string) error {
 	cmd := exec.Command("systemctl", "enable", name+".service")
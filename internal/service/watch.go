@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Watch lists the services every interval until ctx is cancelled, calling
+// onFailed for each service that entered the failed state since the
+// previous check and onRecovered, when set, for each that left it. Services
+// already failed at the first check are reported.
+func Watch(ctx context.Context, m Manager, interval time.Duration, onFailed, onRecovered func(ServiceInfo)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failed := make(map[string]bool)
+	for {
+		services, err := m.List()
+		if err != nil {
+			log.Printf("Failed to check services: %v", err)
+		} else {
+			current := make(map[string]bool)
+			for _, svc := range services {
+				if svc.Status != StatusFailed {
+					if failed[svc.Name] && onRecovered != nil {
+						onRecovered(svc)
+					}
+					continue
+				}
+				current[svc.Name] = true
+				if !failed[svc.Name] {
+					onFailed(svc)
+				}
+			}
+			failed = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -150,6 +150,11 @@ func (m *WindowsManager) Restart(name string) error {
 	return m.Start(name)
 }
 
+// Reload restarts a service, the service control manager has no reload
+func (m *WindowsManager) Reload(name string) error {
+	return m.Restart(name)
+}
+
 // Enable enables a service
 func (m *WindowsManager) Enable(name string) error {
 	cmd := exec.Command("sc", "config", name, "start=", "auto")
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AuditQuery filters the audit log. Empty fields match everything.
+type AuditQuery struct {
+	From     time.Time
+	To       time.Time
+	User     string
+	Action   string
+	Resource string // matches resources starting with this value
+	Text     string // case-insensitive search in action, resource and details
+	Cursor   string // as returned by the previous page
+	Limit    int
+	// Ascending lists the oldest entries first
+	Ascending bool
+	// Match, when set, further filters the entries
+	Match func(AuditEntry) bool
+}
+
+// AuditPage is one page of audit log entries
+type AuditPage struct {
+	Entries []AuditEntry `json:"entries"`
+	Next    string       `json:"next,omitempty"`
+	// Total is the number of entries matching the query across all pages
+	Total int `json:"total"`
+}
+
+// QueryAuditLog returns audit entries matching q, newest first unless
+// q.Ascending is set
+func (s *Storage) QueryAuditLog(q AuditQuery) (*AuditPage, error) {
+	opts := ScanOptions{
+		Limit:   q.Limit,
+		Reverse: !q.Ascending,
+	}
+	if !q.From.IsZero() {
+		opts.Start = timeKey(q.From)
+	}
+	if !q.To.IsZero() {
+		opts.End = timeKey(q.To)
+	}
+	if q.Cursor != "" {
+		cursor, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		opts.Cursor = string(cursor)
+	}
+
+	text := strings.ToLower(q.Text)
+	opts.Match = func(_, value []byte) bool {
+		var entry AuditEntry
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return false
+		}
+		return q.matches(entry, text)
+	}
+
+	result, err := s.Scan(BucketAuditLog, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AuditPage{Entries: make([]AuditEntry, 0, len(result.Items))}
+	for _, item := range result.Items {
+		var entry AuditEntry
+		if err := json.Unmarshal(item.Value, &entry); err == nil {
+			page.Entries = append(page.Entries, entry)
+		}
+	}
+	if result.Next != "" {
+		page.Next = base64.RawURLEncoding.EncodeToString([]byte(result.Next))
+	}
+
+	if page.Total, err = s.CountScan(BucketAuditLog, opts); err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// matches reports whether an entry satisfies the non-time filters of the query
+func (q AuditQuery) matches(entry AuditEntry, text string) bool {
+	if q.User != "" && entry.User != q.User {
+		return false
+	}
+	if q.Action != "" && entry.Action != q.Action {
+		return false
+	}
+	if q.Resource != "" && !strings.HasPrefix(entry.Resource, q.Resource) {
+		return false
+	}
+	if text != "" &&
+		!strings.Contains(strings.ToLower(entry.Action), text) &&
+		!strings.Contains(strings.ToLower(entry.Resource), text) &&
+		!strings.Contains(strings.ToLower(entry.Details), text) {
+		return false
+	}
+	if q.Match != nil && !q.Match(entry) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// backupPrefix is the file name prefix of scheduled backups
+const backupPrefix = "nebula-"
+
+// WriteTo streams a consistent snapshot of the database to w.
+// The snapshot is taken from a read transaction, so writers are not blocked.
+func (s *Storage) WriteTo(w io.Writer) (int64, error) {
+	return s.WriteSnapshot(w, nil)
+}
+
+// WriteSnapshot streams a snapshot like WriteTo, calling sized first with its
+// size in bytes. Both come from the same transaction, so the size matches
+// what is written even while the database changes.
+func (s *Storage) WriteSnapshot(w io.Writer, sized func(size int64)) (int64, error) {
+	// The lock is only held to begin the transaction, writers aren't kept
+	// waiting for slow readers. Closing the database waits for it to end.
+	s.mu.RLock()
+	tx, err := s.db.Begin(false)
+	s.mu.RUnlock()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if sized != nil {
+		sized(tx.Size())
+	}
+	return tx.WriteTo(w)
+}
+
+// BackupToFile writes a snapshot into dir and prunes old backups, keeping the
+// newest keep files (zero keeps all). It returns the path of the new backup.
+func (s *Storage) BackupToFile(dir string, keep int) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	name := backupPrefix + time.Now().UTC().Format("20060102-150405") + ".db"
+	path := filepath.Join(dir, name)
+	tmpPath := path + ".tmp"
+
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create backup file: %w", err)
+	}
+
+	if _, err := s.WriteTo(file); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return "", err
+	}
+	file.Close()
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+
+	if keep > 0 {
+		pruneBackups(dir, keep)
+	}
+
+	return path, nil
+}
+
+// pruneBackups removes all but the newest keep backups in dir
+func pruneBackups(dir string, keep int) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+
+	var backups []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, backupPrefix) && strings.HasSuffix(name, ".db") {
+			backups = append(backups, name)
+		}
+	}
+
+	// Timestamped names sort chronologically
+	sort.Strings(backups)
+	for len(backups) > keep {
+		os.Remove(filepath.Join(dir, backups[0]))
+		backups = backups[1:]
+	}
+}
+
+// StartBackups takes a backup into dir every interval until ctx is cancelled
+func (s *Storage) StartBackups(ctx context.Context, dir string, interval time.Duration, keep int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := s.BackupToFile(dir, keep)
+			if err != nil {
+				log.Printf("Scheduled backup failed: %v", err)
+				continue
+			}
+			log.Printf("Database backed up to %s", path)
+		}
+	}
+}
+
+// Restore replaces the database file at dst with the backup at src.
+// It must be called before the database is opened. The backup is validated
+// by opening it read-only, and the current database is kept as dst + ".bak".
+func Restore(src, dst string) error {
+	check, err := bolt.Open(src, 0600, &bolt.Options{ReadOnly: true, Timeout: 5 * time.Second})
+	if err != nil {
+		return fmt.Errorf("invalid backup: %w", err)
+	}
+	err = check.View(checkTx)
+	check.Close()
+	if err != nil {
+		return fmt.Errorf("backup is corrupted: %w", err)
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmpPath := dst + ".restore"
+	out, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if _, err := os.Stat(dst); err == nil {
+		if err := os.Rename(dst, dst+".bak"); err != nil {
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to keep current database: %w", err)
+		}
+	}
+
+	return os.Rename(tmpPath, dst)
+}
@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// metricsBatch queues metrics entries so several are written per transaction
+type metricsBatch struct {
+	mu      sync.Mutex
+	enabled bool
+	size    int
+	pending []MetricsEntry
+	full    chan struct{}
+}
+
+// StartMetricsBatching switches AddMetricsEntry to a write-behind queue that is
+// flushed every interval or once size entries are pending, until ctx is cancelled.
+// Pending entries are flushed on cancellation and when the storage is closed.
+func (s *Storage) StartMetricsBatching(ctx context.Context, interval time.Duration, size int) {
+	if size < 1 {
+		size = 1
+	}
+
+	s.metrics.mu.Lock()
+	s.metrics.enabled = true
+	s.metrics.size = size
+	s.metrics.full = make(chan struct{}, 1)
+	full := s.metrics.full
+	s.metrics.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			s.metrics.mu.Lock()
+			s.metrics.enabled = false
+			s.metrics.mu.Unlock()
+			s.flushMetricsLogged()
+			return
+		case <-ticker.C:
+			s.flushMetricsLogged()
+		case <-full:
+			s.flushMetricsLogged()
+		}
+	}
+}
+
+// queueMetrics adds an entry to the write-behind queue, returning false when batching is off
+func (s *Storage) queueMetrics(entry MetricsEntry) bool {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+
+	if !s.metrics.enabled {
+		return false
+	}
+
+	s.metrics.pending = append(s.metrics.pending, entry)
+
+	// Keep the queue bounded if flushes keep failing
+	if limit := s.metrics.size * 10; len(s.metrics.pending) > limit {
+		s.metrics.pending = s.metrics.pending[len(s.metrics.pending)-limit:]
+	}
+
+	if len(s.metrics.pending) >= s.metrics.size {
+		select {
+		case s.metrics.full <- struct{}{}:
+		default:
+		}
+	}
+	return true
+}
+
+// FlushMetrics writes all queued metrics entries in a single transaction
+func (s *Storage) FlushMetrics() error {
+	s.metrics.mu.Lock()
+	pending := s.metrics.pending
+	s.metrics.pending = nil
+	s.metrics.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketMetricsHistory))
+		for _, entry := range pending {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(timeKey(entry.Timestamp)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// Requeue ahead of newer entries so the next flush retries them
+		s.metrics.mu.Lock()
+		s.metrics.pending = append(pending, s.metrics.pending...)
+		s.metrics.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// flushMetricsLogged flushes the queue, logging failures
+func (s *Storage) flushMetricsLogged() {
+	if err := s.FlushMetrics(); err != nil {
+		log.Printf("Failed to flush metrics: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"encoding/json"
+	"fmt"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -11,22 +12,46 @@ import (
 const (
 	BucketConfig           = "config"
 	BucketMetricsHistory   = "metrics_history"
+	BucketMetrics1m        = "metrics_1m"
+	BucketMetrics5m        = "metrics_5m"
 	BucketSessions         = "sessions"
 	BucketTerminalSessions = "terminal_sessions"
 	BucketBookmarks        = "bookmarks"
 	BucketPreferences      = "preferences"
 	BucketAuditLog         = "audit_log"
+	BucketMeta             = "meta"
+	BucketTTL              = "ttl"
+	BucketConfigHistory    = "config_history"
+	BucketNotifications    = "notifications"
+	BucketTasks            = "tasks"
+	BucketTaskRuns         = "task_runs"
+	BucketLoginFailures    = "login_failures"
+	BucketPasskeys         = "passkeys"
+	BucketShareLinks       = "share_links"
+	BucketNotifyDeliveries = "notify_deliveries"
 )
 
 // AllBuckets returns all bucket names
 var AllBuckets = []string{
 	BucketConfig,
 	BucketMetricsHistory,
+	BucketMetrics1m,
+	BucketMetrics5m,
 	BucketSessions,
 	BucketTerminalSessions,
 	BucketBookmarks,
 	BucketPreferences,
 	BucketAuditLog,
+	BucketMeta,
+	BucketTTL,
+	BucketConfigHistory,
+	BucketNotifications,
+	BucketTasks,
+	BucketTaskRuns,
+	BucketLoginFailures,
+	BucketPasskeys,
+	BucketShareLinks,
+	BucketNotifyDeliveries,
 }
 
 // initBuckets creates all required buckets
@@ -99,6 +124,9 @@ type NetInfo struct {
 	PacketsRecv uint64 `json:"packets_recv"`
 }
 
+// sessionKeyPrefix separates user sessions from other entries of BucketSessions
+const sessionKeyPrefix = "session:"
+
 // Session represents a user session
 type Session struct {
 	ID        string    `json:"id"`
@@ -106,14 +134,23 @@ type Session struct {
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	// Provider is the external provider the user logged in with, empty for
+	// the basic auth credentials
+	Provider string `json:"provider,omitempty"`
+	// Role limits what the user may do, empty for full access
+	Role string `json:"role,omitempty"`
 }
 
 // TerminalSession represents a terminal session state
 type TerminalSession struct {
-	ID        string    `json:"id"`
-	Shell     string    `json:"shell"`
-	CreatedAt time.Time `json:"created_at"`
-	LastUsed  time.Time `json:"last_used"`
+	ID         string    `json:"id"`
+	Shell      string    `json:"shell"`
+	PID        int       `json:"pid"`
+	Owner      string    `json:"owner"`
+	ClientIP   string    `json:"client_ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
 }
 
 // Bookmark represents a file manager bookmark
@@ -130,53 +167,98 @@ type Preferences struct {
 	RefreshRate int    `json:"refresh_rate"`
 }
 
-// AddAuditLog adds an entry to the audit log
+// AddAuditLog adds an entry to the audit log, keyed by time so it can be queried by range
 func (s *Storage) AddAuditLog(entry AuditEntry) error {
-	return s.SetJSON(BucketAuditLog, entry.ID, entry)
+	return s.SetJSON(BucketAuditLog, timeKey(entry.Timestamp)+entry.ID, entry)
+}
+
+// SaveSession stores a user session until it expires
+func (s *Storage) SaveSession(session Session) error {
+	ttl := time.Until(session.ExpiresAt)
+	if ttl <= 0 {
+		return fmt.Errorf("session %s already expired", session.ID)
+	}
+	return s.SetJSONWithTTL(BucketSessions, sessionKeyPrefix+session.ID, session, ttl)
+}
+
+// GetSession retrieves a user session, nil if it doesn't exist or has expired
+func (s *Storage) GetSession(id string) (*Session, error) {
+	data, err := s.Get(BucketSessions, sessionKeyPrefix+id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteSession removes a user session
+func (s *Storage) DeleteSession(id string) error {
+	return s.Delete(BucketSessions, sessionKeyPrefix+id)
 }
 
-// AddMetricsEntry adds a metrics entry to history
+// AddMetricsEntry adds a metrics entry to history, keyed by its timestamp.
+// With batching enabled the entry is queued and written by the next flush.
 func (s *Storage) AddMetricsEntry(entry MetricsEntry) error {
-	key := entry.Timestamp.Format(time.RFC3339Nano)
-	return s.SetJSON(BucketMetricsHistory, key, entry)
+	if s.queueMetrics(entry) {
+		return nil
+	}
+	return s.SetJSON(BucketMetricsHistory, timeKey(entry.Timestamp), entry)
 }
 
-// GetMetricsHistory retrieves metrics history
+// GetMetricsHistory retrieves the most recent metrics entries, newest first
 func (s *Storage) GetMetricsHistory(limit int) ([]MetricsEntry, error) {
-	all, err := s.GetAll(BucketMetricsHistory)
+	entries, _, err := s.GetMetricsPage("", limit)
+	return entries, err
+}
+
+// GetMetricsPage retrieves metrics entries newest first, starting after cursor.
+// It returns the cursor for the next page, empty when there are no older entries.
+func (s *Storage) GetMetricsPage(cursor string, limit int) ([]MetricsEntry, string, error) {
+	page, err := s.Scan(BucketMetricsHistory, ScanOptions{
+		Cursor:  cursor,
+		Limit:   limit,
+		Reverse: true,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return decodeMetrics(page.Items), page.Next, nil
+}
+
+// GetMetricsRange retrieves metrics entries recorded in [from, to), oldest first.
+// A zero from or to leaves that side of the range open.
+func (s *Storage) GetMetricsRange(from, to time.Time, limit int) ([]MetricsEntry, error) {
+	opts := ScanOptions{Limit: limit}
+	if !from.IsZero() {
+		opts.Start = timeKey(from)
+	}
+	if !to.IsZero() {
+		opts.End = timeKey(to)
+	}
+
+	page, err := s.Scan(BucketMetricsHistory, opts)
 	if err != nil {
 		return nil, err
 	}
+	return decodeMetrics(page.Items), nil
+}
 
-	var entries []MetricsEntry
-	for _, v := range all {
+// decodeMetrics unmarshals scanned metrics entries, skipping corrupt values
+func decodeMetrics(items []KeyValue) []MetricsEntry {
+	entries := make([]MetricsEntry, 0, len(items))
+	for _, item := range items {
 		var entry MetricsEntry
-		if err := unmarshalJSON(v, &entry); err == nil {
+		if err := unmarshalJSON(item.Value, &entry); err == nil {
 			entries = append(entries, entry)
 		}
 	}
-
-	// Sort by timestamp descending and limit
-	sortMetricsByTimestamp(entries)
-	if limit > 0 && len(entries) > limit {
-		entries = entries[:limit]
-	}
-
-	return entries, nil
+	return entries
 }
 
 // Helper function to unmarshal JSON
 func unmarshalJSON(data []byte, v interface{}) error {
 	return json.Unmarshal(data, v)
 }
-
-// sortMetricsByTimestamp sorts metrics entries by timestamp (newest first)
-func sortMetricsByTimestamp(entries []MetricsEntry) {
-	for i := 0; i < len(entries)-1; i++ {
-		for j := i + 1; j < len(entries); j++ {
-			if entries[j].Timestamp.After(entries[i].Timestamp) {
-				entries[i], entries[j] = entries[j], entries[i]
-			}
-		}
-	}
-}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ConfigChange records one applied configuration change
+type ConfigChange struct {
+	ID        string       `json:"id"`
+	Timestamp time.Time    `json:"timestamp"`
+	User      string       `json:"user"`
+	Source    string       `json:"source"`
+	Diff      []ConfigDiff `json:"diff"`
+}
+
+// ConfigDiff is the change of a single configuration key
+type ConfigDiff struct {
+	Key string      `json:"key"`
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// ConfigHistoryPage is one page of configuration changes, newest first
+type ConfigHistoryPage struct {
+	Changes []ConfigChange `json:"changes"`
+	Next    string         `json:"next,omitempty"`
+}
+
+// AddConfigChange appends a change to the configuration history
+func (s *Storage) AddConfigChange(change ConfigChange) error {
+	return s.SetJSON(BucketConfigHistory, timeKey(change.Timestamp)+change.ID, change)
+}
+
+// GetConfigHistory returns configuration changes newest first, starting after cursor
+func (s *Storage) GetConfigHistory(cursor string, limit int) (*ConfigHistoryPage, error) {
+	opts := ScanOptions{Limit: limit, Reverse: true}
+	if cursor != "" {
+		key, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		opts.Cursor = string(key)
+	}
+
+	result, err := s.Scan(BucketConfigHistory, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ConfigHistoryPage{Changes: make([]ConfigChange, 0, len(result.Items))}
+	for _, item := range result.Items {
+		var change ConfigChange
+		if err := json.Unmarshal(item.Value, &change); err == nil {
+			page.Changes = append(page.Changes, change)
+		}
+	}
+	if result.Next != "" {
+		page.Next = base64.RawURLEncoding.EncodeToString([]byte(result.Next))
+	}
+
+	return page, nil
+}
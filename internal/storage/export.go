@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// dumpVersion is the format version written into exports
+const dumpVersion = 1
+
+// ExportableBuckets lists the buckets holding user configuration that can be
+// moved between instances. Runtime data such as metrics or sessions is excluded.
+var ExportableBuckets = []string{
+	BucketConfig,
+	BucketBookmarks,
+	BucketPreferences,
+	BucketNotifications,
+	BucketTasks,
+}
+
+// Dump is a portable JSON export of storage buckets
+type Dump struct {
+	Version   int                                   `json:"version"`
+	CreatedAt time.Time                             `json:"created_at"`
+	Buckets   map[string]map[string]json.RawMessage `json:"buckets"`
+}
+
+// ImportResult reports how many keys were written per bucket
+type ImportResult struct {
+	Imported map[string]int `json:"imported"`
+}
+
+// isExportable reports whether a bucket may be exported and imported
+func isExportable(bucket string) bool {
+	for _, b := range ExportableBuckets {
+		if b == bucket {
+			return true
+		}
+	}
+	return false
+}
+
+// Export dumps the given buckets, or all exportable buckets when none are given
+func (s *Storage) Export(buckets []string) (*Dump, error) {
+	if len(buckets) == 0 {
+		buckets = ExportableBuckets
+	}
+	for _, bucket := range buckets {
+		if !isExportable(bucket) {
+			return nil, fmt.Errorf("bucket %s cannot be exported", bucket)
+		}
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dump := &Dump{
+		Version:   dumpVersion,
+		CreatedAt: time.Now().UTC(),
+		Buckets:   make(map[string]map[string]json.RawMessage),
+	}
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		for _, bucket := range buckets {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil {
+				return fmt.Errorf("bucket %s not found", bucket)
+			}
+
+			entries := make(map[string]json.RawMessage)
+			err := b.ForEach(func(k, v []byte) error {
+				if !json.Valid(v) {
+					return fmt.Errorf("value of %s/%s is not JSON", bucket, k)
+				}
+				value := make([]byte, len(v))
+				copy(value, v)
+				entries[string(k)] = value
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			dump.Buckets[bucket] = entries
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return dump, nil
+}
+
+// Import writes a dump into the database in a single transaction. Existing keys
+// are overwritten; with replace the imported buckets are emptied first.
+func (s *Storage) Import(dump *Dump, replace bool) (*ImportResult, error) {
+	if dump.Version != dumpVersion {
+		return nil, fmt.Errorf("unsupported dump version %d", dump.Version)
+	}
+	for bucket := range dump.Buckets {
+		if !isExportable(bucket) {
+			return nil, fmt.Errorf("bucket %s cannot be imported", bucket)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &ImportResult{Imported: make(map[string]int)}
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for bucket, entries := range dump.Buckets {
+			if replace {
+				if err := tx.DeleteBucket([]byte(bucket)); err != nil && err != bolt.ErrBucketNotFound {
+					return err
+				}
+			}
+			b, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+
+			ttl := tx.Bucket([]byte(BucketTTL))
+			for key, value := range entries {
+				if err := b.Put([]byte(key), value); err != nil {
+					return err
+				}
+				// Imported values are permanent
+				if err := ttl.Delete(ttlKey(bucket, key)); err != nil {
+					return err
+				}
+			}
+			result.Imported[bucket] = len(entries)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
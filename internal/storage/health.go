@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// HealthStatus reports the result of the last integrity check
+type HealthStatus struct {
+	Healthy   bool      `json:"healthy"`
+	LastCheck time.Time `json:"last_check"`
+	Error     string    `json:"error,omitempty"`
+	// MovedTo is where a corrupted database file was moved before re-initializing
+	MovedTo       string    `json:"moved_to,omitempty"`
+	RecoveryCause string    `json:"recovery_cause,omitempty"`
+	RecoveredAt   time.Time `json:"recovered_at,omitempty"`
+}
+
+// healthState holds the health status shared with readers
+type healthState struct {
+	mu          sync.RWMutex
+	status      HealthStatus
+	onRecovered func(HealthStatus)
+}
+
+// Open opens the database at path and verifies its integrity. A corrupted
+// file is moved aside and replaced by a fresh database, so the server never
+// runs without storage because of a damaged file.
+func Open(path string) (*Storage, error) {
+	s, err := New(path)
+	if err != nil {
+		if !isCorruption(err) {
+			return nil, err
+		}
+		return recoverFile(path, err)
+	}
+
+	if err := s.Check(); err != nil {
+		s.Close()
+		return recoverFile(path, err)
+	}
+
+	s.setHealth(nil)
+	return s, nil
+}
+
+// Check verifies the consistency of every page of the database
+func (s *Storage) Check() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.db.View(checkTx)
+}
+
+// Health returns the result of the last integrity check
+func (s *Storage) Health() HealthStatus {
+	s.health.mu.RLock()
+	defer s.health.mu.RUnlock()
+	return s.health.status
+}
+
+// StartHealthChecks runs integrity checks every interval until ctx is cancelled.
+// A corrupted database is moved aside and re-initialized in place.
+func (s *Storage) StartHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := s.Check()
+			s.setHealth(err)
+			if err == nil {
+				continue
+			}
+
+			log.Printf("Storage integrity check failed: %v", err)
+			if err := s.reinitialize(err); err != nil {
+				log.Printf("Storage recovery failed: %v", err)
+				continue
+			}
+			s.reportRecovered()
+		}
+	}
+}
+
+// reinitialize swaps the open database for a fresh one after moving the corrupted file aside
+func (s *Storage) reinitialize(cause error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.db.Close()
+
+	movedTo, err := moveAside(s.path)
+	if err != nil {
+		return err
+	}
+
+	fresh, err := New(s.path)
+	if err != nil {
+		return err
+	}
+	s.db = fresh.db
+
+	s.setRecovered(cause, movedTo)
+	return nil
+}
+
+// OnRecovered registers fn to be called with the health status each time
+// the database is found corrupted and re-initialized. A recovery made when
+// the database was opened is reported right away.
+func (s *Storage) OnRecovered(fn func(HealthStatus)) {
+	s.health.mu.Lock()
+	s.health.onRecovered = fn
+	s.health.mu.Unlock()
+
+	if !s.Health().RecoveredAt.IsZero() {
+		s.reportRecovered()
+	}
+}
+
+// reportRecovered calls the OnRecovered callback, without holding the
+// storage lock so it may use the storage
+func (s *Storage) reportRecovered() {
+	s.health.mu.RLock()
+	fn, status := s.health.onRecovered, s.health.status
+	s.health.mu.RUnlock()
+
+	if fn != nil {
+		fn(status)
+	}
+}
+
+// recoverFile moves a corrupted database aside and creates a new one in its place
+func recoverFile(path string, cause error) (*Storage, error) {
+	movedTo, err := moveAside(path)
+	if err != nil {
+		return nil, fmt.Errorf("database is corrupted (%v) and could not be moved: %w", cause, err)
+	}
+
+	s, err := New(path)
+	if err != nil {
+		return nil, err
+	}
+
+	s.setRecovered(cause, movedTo)
+	return s, nil
+}
+
+// moveAside renames a database file so a new one can be created
+func moveAside(path string) (string, error) {
+	movedTo := fmt.Sprintf("%s.corrupt-%s", path, time.Now().UTC().Format("20060102-150405"))
+	if err := os.Rename(path, movedTo); err != nil {
+		return "", err
+	}
+	return movedTo, nil
+}
+
+// probeKey is the meta key Probe writes
+const probeKey = "health_probe"
+
+// Probe checks that the database accepts writes by committing the current
+// time to the meta bucket
+func (s *Storage) Probe() error {
+	return s.Set(BucketMeta, probeKey, []byte(time.Now().UTC().Format(time.RFC3339)))
+}
+
+// Path returns the path of the database file
+func (s *Storage) Path() string {
+	return s.path
+}
+
+// setHealth records the outcome of an integrity check
+func (s *Storage) setHealth(err error) {
+	s.health.mu.Lock()
+	defer s.health.mu.Unlock()
+
+	s.health.status.LastCheck = time.Now()
+	s.health.status.Healthy = err == nil
+	s.health.status.Error = ""
+	if err != nil {
+		s.health.status.Error = err.Error()
+	}
+}
+
+// setRecovered records that the database was re-initialized after corruption
+func (s *Storage) setRecovered(cause error, movedTo string) {
+	log.Printf("Database corrupted (%v): moved to %s and re-initialized", cause, movedTo)
+
+	now := time.Now()
+	s.health.mu.Lock()
+	s.health.status = HealthStatus{
+		Healthy:       true,
+		LastCheck:     now,
+		MovedTo:       movedTo,
+		RecoveryCause: cause.Error(),
+		RecoveredAt:   now,
+	}
+	s.health.mu.Unlock()
+}
+
+// isCorruption reports whether an open error is caused by a damaged file
+// rather than, for example, the file being locked by another process
+func isCorruption(err error) bool {
+	return errors.Is(err, bolt.ErrInvalid) ||
+		errors.Is(err, bolt.ErrVersionMismatch) ||
+		errors.Is(err, bolt.ErrChecksum)
+}
+
+// checkTx runs the bolt consistency checker and returns its first error
+func checkTx(tx *bolt.Tx) error {
+	// Drain the channel so the checker finishes before the tx closes
+	var firstErr error
+	for err := range tx.Check() {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// LoginFailures counts the failed logins of a client, an IP address or a
+// username
+type LoginFailures struct {
+	// Key is ip:<address> or user:<name>
+	Key         string    `json:"key"`
+	Count       int       `json:"count"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until,omitempty"`
+}
+
+// GetLoginFailures returns the failed logins of key, nil when there are none
+func (s *Storage) GetLoginFailures(key string) (*LoginFailures, error) {
+	data, err := s.Get(BucketLoginFailures, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var failures LoginFailures
+	if err := json.Unmarshal(data, &failures); err != nil {
+		return nil, err
+	}
+	return &failures, nil
+}
+
+// SaveLoginFailures stores the failed logins of a client, forgotten after ttl
+func (s *Storage) SaveLoginFailures(failures LoginFailures, ttl time.Duration) error {
+	return s.SetJSONWithTTL(BucketLoginFailures, failures.Key, failures, ttl)
+}
+
+// DeleteLoginFailures forgets the failed logins of key
+func (s *Storage) DeleteLoginFailures(key string) error {
+	return s.Delete(BucketLoginFailures, key)
+}
+
+// ListLoginFailures returns the failed logins of every client
+func (s *Storage) ListLoginFailures() ([]LoginFailures, error) {
+	page, err := s.Scan(BucketLoginFailures, ScanOptions{})
+	if err != nil {
+		return nil, err
+	}
+	list := make([]LoginFailures, 0, len(page.Items))
+	for _, item := range page.Items {
+		var failures LoginFailures
+		if err := json.Unmarshal(item.Value, &failures); err == nil {
+			list = append(list, failures)
+		}
+	}
+	return list, nil
+}
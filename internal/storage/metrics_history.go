@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MetricsStat is the average and the maximum of a metric over a step
+type MetricsStat struct {
+	Avg float64 `json:"avg"`
+	Max float64 `json:"max"`
+}
+
+// NetRates is the traffic of a network interface over a step, in bytes
+// per second
+type NetRates struct {
+	Sent MetricsStat `json:"sent"`
+	Recv MetricsStat `json:"recv"`
+}
+
+// MetricsPoint is the metrics history downsampled over a step
+type MetricsPoint struct {
+	// Timestamp is the start of the step
+	Timestamp time.Time `json:"timestamp"`
+	// Samples is the number of entries recorded in the step
+	Samples int `json:"samples"`
+	// CPU is the total CPU usage, in percent
+	CPU MetricsStat `json:"cpu"`
+	// Memory is the used memory, in percent
+	Memory MetricsStat `json:"memory"`
+	// Swap is the used swap, in bytes
+	Swap MetricsStat `json:"swap"`
+	// Disks is the used space of each mount point, in percent
+	Disks map[string]MetricsStat `json:"disks,omitempty"`
+	// Network is the traffic of each interface, measured between
+	// consecutive entries
+	Network map[string]NetRates `json:"network,omitempty"`
+}
+
+// statSum accumulates the values of a metric over a step
+type statSum struct {
+	sum float64
+	max float64
+	n   int
+}
+
+func (s *statSum) add(v float64) {
+	if s.n == 0 || v > s.max {
+		s.max = v
+	}
+	s.sum += v
+	s.n++
+}
+
+// merge adds a stat averaged over n values
+func (s *statSum) merge(stat MetricsStat, n int) {
+	if n <= 0 {
+		return
+	}
+	if s.n == 0 || stat.Max > s.max {
+		s.max = stat.Max
+	}
+	s.sum += stat.Avg * float64(n)
+	s.n += n
+}
+
+func (s statSum) stat() MetricsStat {
+	if s.n == 0 {
+		return MetricsStat{}
+	}
+	return MetricsStat{Avg: s.sum / float64(s.n), Max: s.max}
+}
+
+// metricsStep accumulates the entries of a step
+type metricsStep struct {
+	start   time.Time
+	samples int
+	cpu     statSum
+	memory  statSum
+	swap    statSum
+	disks   map[string]*statSum
+	sent    map[string]*statSum
+	recv    map[string]*statSum
+}
+
+func newMetricsStep(start time.Time) *metricsStep {
+	return &metricsStep{
+		start: start,
+		disks: make(map[string]*statSum),
+		sent:  make(map[string]*statSum),
+		recv:  make(map[string]*statSum),
+	}
+}
+
+// statOf returns the sum for key, adding it to sums
+func statOf(sums map[string]*statSum, key string) *statSum {
+	s, ok := sums[key]
+	if !ok {
+		s = &statSum{}
+		sums[key] = s
+	}
+	return s
+}
+
+func (st *metricsStep) point() MetricsPoint {
+	p := MetricsPoint{
+		Timestamp: st.start,
+		Samples:   st.samples,
+		CPU:       st.cpu.stat(),
+		Memory:    st.memory.stat(),
+		Swap:      st.swap.stat(),
+	}
+	if len(st.disks) > 0 {
+		p.Disks = make(map[string]MetricsStat, len(st.disks))
+		for mount, s := range st.disks {
+			p.Disks[mount] = s.stat()
+		}
+	}
+	if len(st.sent) > 0 {
+		p.Network = make(map[string]NetRates, len(st.sent))
+		for name, s := range st.sent {
+			p.Network[name] = NetRates{Sent: s.stat(), Recv: statOf(st.recv, name).stat()}
+		}
+	}
+	return p
+}
+
+// metricsDownsampler aggregates metrics entries or points, oldest first,
+// into steps
+type metricsDownsampler struct {
+	from   time.Time
+	step   time.Duration
+	points []MetricsPoint
+	cur    *metricsStep
+	// last is the previous entry, which network rates are measured from
+	last *MetricsEntry
+}
+
+func (d *metricsDownsampler) add(entry MetricsEntry) {
+	// Entries both flushed and still queued are seen twice
+	if d.last != nil && !entry.Timestamp.After(d.last.Timestamp) {
+		return
+	}
+
+	st := d.stepAt(entry.Timestamp)
+	st.samples++
+	st.cpu.add(entry.CPU.TotalPercent)
+	st.memory.add(entry.Memory.UsedPercent)
+	st.swap.add(float64(entry.Memory.SwapUsed))
+	for _, disk := range entry.Disk {
+		statOf(st.disks, disk.Mountpoint).add(disk.UsedPercent)
+	}
+	if d.last != nil {
+		seconds := entry.Timestamp.Sub(d.last.Timestamp).Seconds()
+		for _, n := range entry.Network {
+			for _, prev := range d.last.Network {
+				// Counters going back were reset, there is no rate to take
+				if prev.Name != n.Name || n.BytesSent < prev.BytesSent || n.BytesRecv < prev.BytesRecv {
+					continue
+				}
+				statOf(st.sent, n.Name).add(float64(n.BytesSent-prev.BytesSent) / seconds)
+				statOf(st.recv, n.Name).add(float64(n.BytesRecv-prev.BytesRecv) / seconds)
+			}
+		}
+	}
+	d.last = &entry
+}
+
+// addPoint adds a point averaged over a shorter step, weighted by its
+// samples
+func (d *metricsDownsampler) addPoint(p MetricsPoint) {
+	st := d.stepAt(p.Timestamp)
+	st.samples += p.Samples
+	st.cpu.merge(p.CPU, p.Samples)
+	st.memory.merge(p.Memory, p.Samples)
+	st.swap.merge(p.Swap, p.Samples)
+	for mount, stat := range p.Disks {
+		statOf(st.disks, mount).merge(stat, p.Samples)
+	}
+	for name, rates := range p.Network {
+		statOf(st.sent, name).merge(rates.Sent, p.Samples)
+		statOf(st.recv, name).merge(rates.Recv, p.Samples)
+	}
+}
+
+// stepAt returns the step t falls in, closing the current one when t is
+// past it
+func (d *metricsDownsampler) stepAt(t time.Time) *metricsStep {
+	start := d.from.Add(t.Sub(d.from) / d.step * d.step)
+	if d.cur == nil || !d.cur.start.Equal(start) {
+		d.flush()
+		d.cur = newMetricsStep(start)
+	}
+	return d.cur
+}
+
+// flush closes the current step
+func (d *metricsDownsampler) flush() {
+	if d.cur != nil {
+		d.points = append(d.points, d.cur.point())
+		d.cur = nil
+	}
+}
+
+// DownsampleMetrics aggregates the metrics entries recorded in [from, to)
+// into steps of the given length, oldest first. Entries are decoded one at
+// a time rather than loaded together, the ones still queued by batching are
+// included and steps without entries are left out.
+func (s *Storage) DownsampleMetrics(from, to time.Time, step time.Duration) ([]MetricsPoint, error) {
+	d := &metricsDownsampler{from: from, step: step}
+	if err := s.downsampleEntries(d, from, to); err != nil {
+		return nil, err
+	}
+	d.flush()
+	return d.points, nil
+}
+
+// downsampleEntries adds the metrics entries recorded in [from, to) to d
+func (s *Storage) downsampleEntries(d *metricsDownsampler, from, to time.Time) error {
+	// Taken before the scan, so entries flushed meanwhile aren't missed
+	s.metrics.mu.Lock()
+	pending := make([]MetricsEntry, len(s.metrics.pending))
+	copy(pending, s.metrics.pending)
+	s.metrics.mu.Unlock()
+
+	// The entry before the range is where the first network rates are
+	// measured from
+	prev, err := s.Scan(BucketMetricsHistory, ScanOptions{End: timeKey(from), Limit: 1, Reverse: true})
+	if err != nil {
+		return err
+	}
+	if entries := decodeMetrics(prev.Items); len(entries) > 0 {
+		d.last = &entries[0]
+	}
+	for i, entry := range pending {
+		if entry.Timestamp.Before(from) && (d.last == nil || entry.Timestamp.After(d.last.Timestamp)) {
+			d.last = &pending[i]
+		}
+	}
+
+	_, err = s.Scan(BucketMetricsHistory, ScanOptions{
+		Start: timeKey(from),
+		End:   timeKey(to),
+		Match: func(key, value []byte) bool {
+			var entry MetricsEntry
+			if err := json.Unmarshal(value, &entry); err == nil {
+				d.add(entry)
+			}
+			return false
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, entry := range pending {
+		if !entry.Timestamp.Before(from) && entry.Timestamp.Before(to) {
+			d.add(entry)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MetricsTier is a bucket of metrics history averaged over a fixed step
+type MetricsTier struct {
+	Bucket string
+	Step   time.Duration
+}
+
+// MetricsTiers are the rollups of the metrics history, finest first. Each
+// is kept by its own retention policy, longer than the history's.
+var MetricsTiers = []MetricsTier{
+	{Bucket: BucketMetrics1m, Step: time.Minute},
+	{Bucket: BucketMetrics5m, Step: 5 * time.Minute},
+}
+
+const (
+	// rollupInterval is how often completed steps are rolled up
+	rollupInterval = time.Minute
+	// rollupDelay leaves entries sampled at the end of a step time to be
+	// queued before the step is rolled up
+	rollupDelay = 5 * time.Second
+)
+
+// StartMetricsRollups periodically averages the metrics history into
+// MetricsTiers until ctx is cancelled. A first pass runs immediately.
+func (s *Storage) StartMetricsRollups(ctx context.Context) {
+	ticker := time.NewTicker(rollupInterval)
+	defer ticker.Stop()
+
+	s.rollupMetricsLogged()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.rollupMetricsLogged()
+		}
+	}
+}
+
+// rollupMetricsLogged rolls up the metrics history, logging failures
+func (s *Storage) rollupMetricsLogged() {
+	if err := s.RollupMetrics(time.Now()); err != nil {
+		log.Printf("Failed to roll up metrics: %v", err)
+	}
+}
+
+// RollupMetrics averages the metrics entries of the steps completed by now
+// into each tier, starting after the last step already rolled up
+func (s *Storage) RollupMetrics(now time.Time) error {
+	for _, tier := range MetricsTiers {
+		if err := s.rollupTier(tier, now); err != nil {
+			return fmt.Errorf("%s: %w", tier.Bucket, err)
+		}
+	}
+	return nil
+}
+
+func (s *Storage) rollupTier(tier MetricsTier, now time.Time) error {
+	from, ok, err := s.edgeKeyTime(tier.Bucket, true)
+	if err != nil {
+		return err
+	}
+	if ok {
+		from = from.Add(tier.Step)
+	} else {
+		first, ok, err := s.edgeKeyTime(BucketMetricsHistory, false)
+		if err != nil || !ok {
+			return err
+		}
+		from = first.Truncate(tier.Step)
+	}
+	to := now.Add(-rollupDelay).Truncate(tier.Step)
+	if !from.Before(to) {
+		return nil
+	}
+
+	points, err := s.DownsampleMetrics(from, to, tier.Step)
+	if err != nil || len(points) == 0 {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(tier.Bucket))
+		for _, p := range points {
+			data, err := json.Marshal(p)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(timeKey(p.Timestamp)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// edgeKeyTime returns the time of the newest entry of a time keyed bucket,
+// or of the oldest one, and false when the bucket is empty
+func (s *Storage) edgeKeyTime(bucket string, newest bool) (time.Time, bool, error) {
+	result, err := s.Scan(bucket, ScanOptions{Limit: 1, Reverse: newest})
+	if err != nil || len(result.Items) == 0 {
+		return time.Time{}, false, err
+	}
+	t, ok := keyTime([]byte(result.Items[0].Key))
+	return t, ok, nil
+}
+
+// MetricsHistory aggregates the metrics recorded in [from, to) into steps
+// of the given length, oldest first, like DownsampleMetrics but reading the
+// tiers wherever the history was already purged. Where they have data, the
+// coarsest source no longer than step is read, so long ranges stay cheap.
+func (s *Storage) MetricsHistory(from, to time.Time, step time.Duration) ([]MetricsPoint, error) {
+	// Sources from the coarsest to the history itself
+	type source struct {
+		tier       MetricsTier
+		first, end time.Time
+		hasData    bool
+	}
+	sources := make([]source, 0, len(MetricsTiers)+1)
+	for i := len(MetricsTiers) - 1; i >= 0; i-- {
+		tier := MetricsTiers[i]
+		first, ok, err := s.edgeKeyTime(tier.Bucket, false)
+		if err != nil {
+			return nil, err
+		}
+		last, _, err := s.edgeKeyTime(tier.Bucket, true)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{tier: tier, first: first, end: last.Add(tier.Step), hasData: ok})
+	}
+	first, ok, err := s.edgeKeyTime(BucketMetricsHistory, false)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// Entries may all be queued still
+		first = from
+	}
+	sources = append(sources, source{first: first, end: to, hasData: true})
+
+	d := &metricsDownsampler{from: from, step: step}
+	cursor := from
+	for i, src := range sources {
+		if !src.hasData {
+			continue
+		}
+		end := src.end
+		if src.tier.Step > step {
+			// Coarser than asked, only read until finer data starts
+			for _, finer := range sources[i+1:] {
+				if finer.hasData && finer.first.Before(end) {
+					end = finer.first
+				}
+			}
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !cursor.Before(end) {
+			continue
+		}
+
+		if src.tier.Bucket == "" {
+			err = s.downsampleEntries(d, cursor, end)
+		} else {
+			err = s.downsamplePoints(d, src.tier.Bucket, cursor, end)
+		}
+		if err != nil {
+			return nil, err
+		}
+		cursor = end
+	}
+	d.flush()
+	return d.points, nil
+}
+
+// downsamplePoints adds the points of a tier starting in [from, to) to d
+func (s *Storage) downsamplePoints(d *metricsDownsampler, bucket string, from, to time.Time) error {
+	_, err := s.Scan(bucket, ScanOptions{
+		Start: timeKey(from),
+		End:   timeKey(to),
+		Match: func(key, value []byte) bool {
+			var p MetricsPoint
+			if err := json.Unmarshal(value, &p); err == nil {
+				d.addPoint(p)
+			}
+			return false
+		},
+	})
+	return err
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// schemaVersionKey holds the schema version in BucketMeta
+const schemaVersionKey = "schema_version"
+
+// Migration upgrades the persisted data to a new schema version.
+// Apply runs inside the write transaction that records the version, so a
+// failed migration leaves the database untouched.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *bolt.Tx) error
+}
+
+// migrations must be ordered by version, starting at 1. Append a new entry
+// whenever the JSON shape of a stored struct changes.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "baseline schema",
+		Apply:       func(tx *bolt.Tx) error { return nil },
+	},
+	{
+		Version:     2,
+		Description: "backfill last_active of stored terminal sessions",
+		Apply: func(tx *bolt.Tx) error {
+			return rewriteJSON(tx, BucketTerminalSessions, func(fields map[string]json.RawMessage) bool {
+				created, ok := fields["created_at"]
+				if _, exists := fields["last_active"]; exists || !ok {
+					return false
+				}
+				fields["last_active"] = created
+				return true
+			})
+		},
+	},
+	{
+		Version:     3,
+		Description: "re-key metrics history by binary timestamp",
+		Apply:       migrateMetricsKeys,
+	},
+	{
+		Version:     4,
+		Description: "re-key audit log by timestamp",
+		Apply:       migrateAuditKeys,
+	},
+}
+
+// LatestSchemaVersion returns the schema version this build writes
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the schema version of the open database
+func (s *Storage) SchemaVersion() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var version int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		version = readSchemaVersion(tx)
+		return nil
+	})
+	return version, err
+}
+
+// migrate applies all pending migrations in order
+func (s *Storage) migrate() error {
+	current, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	latest := LatestSchemaVersion()
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than supported version %d", current, latest)
+	}
+
+	for _, m := range migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		err := s.db.Update(func(tx *bolt.Tx) error {
+			if err := m.Apply(tx); err != nil {
+				return err
+			}
+			return writeSchemaVersion(tx, m.Version)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+
+		log.Printf("Storage migrated to schema version %d: %s", m.Version, m.Description)
+	}
+
+	return nil
+}
+
+// readSchemaVersion returns the stored schema version, 0 for databases that predate versioning
+func readSchemaVersion(tx *bolt.Tx) int {
+	b := tx.Bucket([]byte(BucketMeta))
+	if b == nil {
+		return 0
+	}
+	v := b.Get([]byte(schemaVersionKey))
+	if len(v) != 8 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(v))
+}
+
+// writeSchemaVersion records the schema version
+func writeSchemaVersion(tx *bolt.Tx, version int) error {
+	b, err := tx.CreateBucketIfNotExists([]byte(BucketMeta))
+	if err != nil {
+		return err
+	}
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint64(v, uint64(version))
+	return b.Put([]byte(schemaVersionKey), v)
+}
+
+// rewriteJSON decodes every JSON object of a bucket into its raw fields and
+// stores it back when fn reports a change. Values that aren't objects are left alone.
+func rewriteJSON(tx *bolt.Tx, bucket string, fn func(fields map[string]json.RawMessage) bool) error {
+	b := tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+
+	updates := make(map[string][]byte)
+	err := b.ForEach(func(k, v []byte) error {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(v, &fields); err != nil || fields == nil {
+			return nil
+		}
+		if !fn(fields) {
+			return nil
+		}
+		data, err := json.Marshal(fields)
+		if err != nil {
+			return err
+		}
+		updates[string(k)] = data
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// Buckets must not be modified while iterating with ForEach
+	for key, value := range updates {
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateMetricsKeys replaces the RFC3339Nano keys of the metrics history with time keys
+func migrateMetricsKeys(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(BucketMetricsHistory))
+	if b == nil {
+		return nil
+	}
+
+	var oldKeys [][]byte
+	updates := make(map[string][]byte)
+	err := b.ForEach(func(k, v []byte) error {
+		ts, err := time.Parse(time.RFC3339Nano, string(k))
+		if err != nil {
+			// Already a time key
+			return nil
+		}
+		oldKeys = append(oldKeys, append([]byte(nil), k...))
+		updates[timeKey(ts)] = append([]byte(nil), v...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range oldKeys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for key, value := range updates {
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateAuditKeys replaces the ID keys of the audit log with time key + ID
+func migrateAuditKeys(tx *bolt.Tx) error {
+	b := tx.Bucket([]byte(BucketAuditLog))
+	if b == nil {
+		return nil
+	}
+
+	var oldKeys [][]byte
+	updates := make(map[string][]byte)
+	err := b.ForEach(func(k, v []byte) error {
+		var entry AuditEntry
+		if err := json.Unmarshal(v, &entry); err != nil {
+			return nil
+		}
+		oldKeys = append(oldKeys, append([]byte(nil), k...))
+		updates[timeKey(entry.Timestamp)+string(k)] = append([]byte(nil), v...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, k := range oldKeys {
+		if err := b.Delete(k); err != nil {
+			return err
+		}
+	}
+	for key, value := range updates {
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// NotifyDelivery records the delivery of a notification to one channel
+type NotifyDelivery struct {
+	ID          string `json:"id"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	Event       string `json:"event"`
+	// Status is firing or resolved for alerts, empty for other events
+	Status   string `json:"status,omitempty"`
+	Severity string `json:"severity"`
+	Title    string `json:"title"`
+	// Attempts is the number of requests made, retries included
+	Attempts    int       `json:"attempts"`
+	Success     bool      `json:"success"`
+	Error       string    `json:"error,omitempty"`
+	StartedAt   time.Time `json:"started_at"`
+	CompletedAt time.Time `json:"completed_at"`
+}
+
+// NotifyDeliveryPage is one page of notification deliveries, newest first
+type NotifyDeliveryPage struct {
+	Deliveries []NotifyDelivery `json:"deliveries"`
+	Next       string           `json:"next,omitempty"`
+}
+
+// AddNotifyDelivery appends a finished delivery to the history
+func (s *Storage) AddNotifyDelivery(d NotifyDelivery) error {
+	return s.SetJSON(BucketNotifyDeliveries, timeKey(d.StartedAt)+d.ID, d)
+}
+
+// GetNotifyDeliveries returns the deliveries to a channel, or to every
+// channel when channel is empty, newest first, starting after cursor
+func (s *Storage) GetNotifyDeliveries(channel, cursor string, limit int) (*NotifyDeliveryPage, error) {
+	opts := ScanOptions{Limit: limit, Reverse: true}
+	if cursor != "" {
+		key, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		opts.Cursor = string(key)
+	}
+	if channel != "" {
+		opts.Match = func(_, value []byte) bool {
+			var d struct {
+				Channel string `json:"channel"`
+			}
+			return json.Unmarshal(value, &d) == nil && d.Channel == channel
+		}
+	}
+
+	result, err := s.Scan(BucketNotifyDeliveries, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &NotifyDeliveryPage{Deliveries: make([]NotifyDelivery, 0, len(result.Items))}
+	for _, item := range result.Items {
+		var d NotifyDelivery
+		if err := json.Unmarshal(item.Value, &d); err == nil {
+			page.Deliveries = append(page.Deliveries, d)
+		}
+	}
+	if result.Next != "" {
+		page.Next = base64.RawURLEncoding.EncodeToString([]byte(result.Next))
+	}
+
+	return page, nil
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// ceremonyKeyPrefix separates pending passkey ceremonies from other entries
+// of BucketSessions
+const ceremonyKeyPrefix = "webauthn:"
+
+// Passkey is a WebAuthn credential a user logs in with
+type Passkey struct {
+	// ID is the base64url credential ID
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	// Provider and Role are those of the user when they registered the
+	// passkey, given to the sessions it opens
+	Provider string `json:"provider,omitempty"`
+	Role     string `json:"role,omitempty"`
+	// PublicKey is the COSE_Key of the credential
+	PublicKey  []byte    `json:"public_key"`
+	SignCount  uint32    `json:"sign_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// PasskeyCeremony is a passkey registration or login, kept until the
+// browser answers its challenge
+type PasskeyCeremony struct {
+	Challenge string `json:"challenge"`
+	// Registration tells a registration from a login
+	Registration bool `json:"registration"`
+	// Username is who registers, or who logs in when they gave their name
+	Username  string    `json:"username,omitempty"`
+	Provider  string    `json:"provider,omitempty"`
+	Role      string    `json:"role,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GetPasskey returns a passkey by credential ID, nil when it doesn't exist
+func (s *Storage) GetPasskey(id string) (*Passkey, error) {
+	data, err := s.Get(BucketPasskeys, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var passkey Passkey
+	if err := json.Unmarshal(data, &passkey); err != nil {
+		return nil, err
+	}
+	return &passkey, nil
+}
+
+// SavePasskey stores a passkey
+func (s *Storage) SavePasskey(passkey Passkey) error {
+	return s.SetJSON(BucketPasskeys, passkey.ID, passkey)
+}
+
+// DeletePasskey removes a passkey
+func (s *Storage) DeletePasskey(id string) error {
+	return s.Delete(BucketPasskeys, id)
+}
+
+// ListPasskeys returns the passkeys of every user, oldest first
+func (s *Storage) ListPasskeys() ([]Passkey, error) {
+	page, err := s.Scan(BucketPasskeys, ScanOptions{})
+	if err != nil {
+		return nil, err
+	}
+	passkeys := make([]Passkey, 0, len(page.Items))
+	for _, item := range page.Items {
+		var passkey Passkey
+		if err := json.Unmarshal(item.Value, &passkey); err == nil {
+			passkeys = append(passkeys, passkey)
+		}
+	}
+	sort.Slice(passkeys, func(i, j int) bool { return passkeys[i].CreatedAt.Before(passkeys[j].CreatedAt) })
+	return passkeys, nil
+}
+
+// SavePasskeyCeremony stores a pending ceremony for ttl
+func (s *Storage) SavePasskeyCeremony(ceremony PasskeyCeremony, ttl time.Duration) error {
+	return s.SetJSONWithTTL(BucketSessions, ceremonyKeyPrefix+ceremony.Challenge, ceremony, ttl)
+}
+
+// TakePasskeyCeremony returns a pending ceremony and removes it, so a
+// challenge is only answered once. It returns nil if the ceremony doesn't
+// exist or has expired.
+func (s *Storage) TakePasskeyCeremony(challenge string) (*PasskeyCeremony, error) {
+	data, err := s.Get(BucketSessions, ceremonyKeyPrefix+challenge)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	if err := s.Delete(BucketSessions, ceremonyKeyPrefix+challenge); err != nil {
+		return nil, err
+	}
+	var ceremony PasskeyCeremony
+	if err := json.Unmarshal(data, &ceremony); err != nil {
+		return nil, err
+	}
+	return &ceremony, nil
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// RetentionPolicy defines how long entries of a bucket are kept
+type RetentionPolicy struct {
+	Bucket string        `json:"bucket"`
+	MaxAge time.Duration `json:"max_age"`
+}
+
+// RetentionRun reports the outcome of the last cleanup of a bucket
+type RetentionRun struct {
+	Bucket  string        `json:"bucket"`
+	MaxAge  time.Duration `json:"max_age"`
+	Deleted int           `json:"deleted"`
+	Error   string        `json:"error,omitempty"`
+}
+
+// RetentionStatus describes the state of the retention janitor
+type RetentionStatus struct {
+	Running  bool           `json:"running"`
+	Interval time.Duration  `json:"interval"`
+	LastRun  time.Time      `json:"last_run"`
+	NextRun  time.Time      `json:"next_run"`
+	Total    int            `json:"total_deleted"`
+	Runs     []RetentionRun `json:"runs"`
+}
+
+// retentionState holds the janitor status shared with readers
+type retentionState struct {
+	mu     sync.RWMutex
+	status RetentionStatus
+}
+
+// StartRetention periodically deletes entries older than their policy allows
+// until ctx is cancelled. A first pass runs immediately.
+func (s *Storage) StartRetention(ctx context.Context, interval time.Duration, policies []RetentionPolicy) {
+	s.retention.mu.Lock()
+	s.retention.status.Running = true
+	s.retention.status.Interval = interval
+	s.retention.mu.Unlock()
+
+	defer func() {
+		s.retention.mu.Lock()
+		s.retention.status.Running = false
+		s.retention.status.NextRun = time.Time{}
+		s.retention.mu.Unlock()
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.enforceRetention(interval, policies)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.enforceRetention(interval, policies)
+		}
+	}
+}
+
+// enforceRetention runs one cleanup pass over all policies
+func (s *Storage) enforceRetention(interval time.Duration, policies []RetentionPolicy) {
+	runs := make([]RetentionRun, 0, len(policies))
+	total := 0
+
+	for _, policy := range policies {
+		if policy.MaxAge <= 0 {
+			continue
+		}
+
+		run := RetentionRun{Bucket: policy.Bucket, MaxAge: policy.MaxAge}
+		deleted, err := s.PurgeOlderThan(policy.Bucket, policy.MaxAge)
+		run.Deleted = deleted
+		if err != nil {
+			run.Error = err.Error()
+			log.Printf("Retention cleanup of %s failed: %v", policy.Bucket, err)
+		}
+
+		total += deleted
+		runs = append(runs, run)
+	}
+
+	// Values stored with a TTL are swept on every pass
+	run := RetentionRun{Bucket: BucketTTL}
+	deleted, err := s.PurgeExpired()
+	run.Deleted = deleted
+	if err != nil {
+		run.Error = err.Error()
+		log.Printf("Expired value cleanup failed: %v", err)
+	}
+	total += deleted
+	runs = append(runs, run)
+
+	now := time.Now()
+	s.retention.mu.Lock()
+	s.retention.status.LastRun = now
+	s.retention.status.NextRun = now.Add(interval)
+	s.retention.status.Total += total
+	s.retention.status.Runs = runs
+	s.retention.mu.Unlock()
+}
+
+// RetentionStatus returns the state of the retention janitor
+func (s *Storage) RetentionStatus() RetentionStatus {
+	s.retention.mu.RLock()
+	defer s.retention.mu.RUnlock()
+
+	status := s.retention.status
+	status.Runs = append([]RetentionRun(nil), status.Runs...)
+	return status
+}
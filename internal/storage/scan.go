@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ScanOptions selects a key range of a bucket. Keys are compared bytewise.
+type ScanOptions struct {
+	Prefix  string // only keys starting with Prefix
+	Start   string // inclusive lower bound
+	End     string // exclusive upper bound
+	Cursor  string // resume after this key, as returned in ScanResult.Next
+	Limit   int    // maximum number of items, 0 for no limit
+	Reverse bool   // iterate from the highest key down
+	// Match, when set, skips entries it returns false for. Skipped entries
+	// don't count towards Limit.
+	Match func(key, value []byte) bool
+}
+
+// KeyValue is a single entry returned by Scan
+type KeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// ScanResult holds one page of a scan
+type ScanResult struct {
+	Items []KeyValue
+	// Next is the cursor for the following page, empty when the range is exhausted
+	Next string
+}
+
+// Scan iterates over a key range of a bucket without loading the whole bucket
+func (s *Storage) Scan(bucket string, opts ScanOptions) (ScanResult, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result ScanResult
+	err := s.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", bucket)
+		}
+
+		c := b.Cursor()
+		k, v := seekRange(c, opts)
+		next := c.Next
+		if opts.Reverse {
+			next = c.Prev
+		}
+
+		expired := expiryChecker(tx, bucket)
+		for ; k != nil && inRange(k, opts); k, v = next() {
+			if expired(k) || (opts.Match != nil && !opts.Match(k, v)) {
+				continue
+			}
+			if opts.Limit > 0 && len(result.Items) == opts.Limit {
+				result.Next = result.Items[len(result.Items)-1].Key
+				break
+			}
+			value := make([]byte, len(v))
+			copy(value, v)
+			result.Items = append(result.Items, KeyValue{Key: string(k), Value: value})
+		}
+		return nil
+	})
+	return result, err
+}
+
+// CountScan returns the number of entries Scan returns for opts across all
+// pages, ignoring Cursor and Limit
+func (s *Storage) CountScan(bucket string, opts ScanOptions) (int, error) {
+	match := opts.Match
+	n := 0
+	opts.Cursor, opts.Limit = "", 0
+	opts.Match = func(key, value []byte) bool {
+		if match == nil || match(key, value) {
+			n++
+		}
+		return false
+	}
+	_, err := s.Scan(bucket, opts)
+	return n, err
+}
+
+// seekRange positions the cursor on the first key of the range
+func seekRange(c *bolt.Cursor, opts ScanOptions) ([]byte, []byte) {
+	if !opts.Reverse {
+		from := []byte(opts.Start)
+		if opts.Prefix > opts.Start {
+			from = []byte(opts.Prefix)
+		}
+		if opts.Cursor != "" && opts.Cursor >= string(from) {
+			k, v := c.Seek([]byte(opts.Cursor))
+			if k != nil && string(k) == opts.Cursor {
+				return c.Next()
+			}
+			return k, v
+		}
+		if len(from) == 0 {
+			return c.First()
+		}
+		return c.Seek(from)
+	}
+
+	// Upper bound is exclusive, the smallest of End, Cursor and the end of the prefix
+	upper := opts.End
+	if end := prefixEnd(opts.Prefix); end != "" && (upper == "" || end < upper) {
+		upper = end
+	}
+	if opts.Cursor != "" && (upper == "" || opts.Cursor < upper) {
+		upper = opts.Cursor
+	}
+	if upper == "" {
+		return c.Last()
+	}
+
+	k, _ := c.Seek([]byte(upper))
+	if k == nil {
+		return c.Last()
+	}
+	return c.Prev()
+}
+
+// inRange reports whether key lies within the bounds of the scan
+func inRange(key []byte, opts ScanOptions) bool {
+	if opts.Prefix != "" && !bytes.HasPrefix(key, []byte(opts.Prefix)) {
+		return false
+	}
+	if opts.Start != "" && string(key) < opts.Start {
+		return false
+	}
+	if opts.End != "" && string(key) >= opts.End {
+		return false
+	}
+	return true
+}
+
+// prefixEnd returns the smallest key greater than every key with the given prefix
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return ""
+}
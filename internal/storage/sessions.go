@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// loginKeyPrefix separates pending logins from other entries of BucketSessions
+const loginKeyPrefix = "login:"
+
+// LoginState is a login with an external provider, kept until the provider
+// sends the user back
+type LoginState struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SaveLoginState stores a pending login for ttl
+func (s *Storage) SaveLoginState(login LoginState, ttl time.Duration) error {
+	return s.SetJSONWithTTL(BucketSessions, loginKeyPrefix+login.State, login, ttl)
+}
+
+// TakeLoginState returns a pending login and removes it, so a state is only
+// accepted once. It returns nil if the login doesn't exist or has expired.
+func (s *Storage) TakeLoginState(state string) (*LoginState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := []byte(loginKeyPrefix + state)
+	var taken *LoginState
+	// Reading and deleting in one transaction, two callbacks can't both
+	// take the same state
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketSessions))
+		data := b.Get(key)
+		if data == nil || expiryChecker(tx, BucketSessions)(key) {
+			return nil
+		}
+		var login LoginState
+		if err := json.Unmarshal(data, &login); err != nil {
+			return err
+		}
+		if err := b.Delete(key); err != nil {
+			return err
+		}
+		if err := tx.Bucket([]byte(BucketTTL)).Delete(ttlKey(BucketSessions, string(key))); err != nil {
+			return err
+		}
+		taken = &login
+		return nil
+	})
+	return taken, err
+}
+
+// ListSessions returns the user sessions that haven't expired, newest first
+func (s *Storage) ListSessions() ([]Session, error) {
+	page, err := s.Scan(BucketSessions, ScanOptions{Prefix: sessionKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(page.Items))
+	for _, item := range page.Items {
+		var session Session
+		if err := json.Unmarshal(item.Value, &session); err != nil {
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].CreatedAt.After(sessions[j].CreatedAt) })
+	return sessions, nil
+}
+
+// DeleteUserSessions removes the sessions of username and returns how many
+// were removed
+func (s *Storage) DeleteUserSessions(username string) (int, error) {
+	sessions, err := s.ListSessions()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, session := range sessions {
+		if session.Username != username {
+			continue
+		}
+		if err := s.DeleteSession(session.ID); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// shareKeyName holds the key share link tokens are signed with in
+// BucketMeta
+const shareKeyName = "share_key"
+
+// ShareLink lets anyone holding its token download a file or directory
+// without logging in, until it expires or runs out of downloads
+type ShareLink struct {
+	ID        string    `json:"id"`
+	Path      string    `json:"path"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// MaxDownloads is how many times the link may be used, 0 for no limit
+	MaxDownloads int `json:"max_downloads,omitempty"`
+	Downloads    int `json:"downloads"`
+	// Root and Remote name the named root or remote host Path is on, the
+	// local root_path when both are empty
+	Root   string `json:"root,omitempty"`
+	Remote string `json:"remote,omitempty"`
+}
+
+// SaveShareLink stores a share link, removed once it expires
+func (s *Storage) SaveShareLink(link ShareLink) error {
+	return s.SetJSONWithTTL(BucketShareLinks, link.ID, link, time.Until(link.ExpiresAt))
+}
+
+// GetShareLink returns a share link, nil when it doesn't exist or expired
+func (s *Storage) GetShareLink(id string) (*ShareLink, error) {
+	data, err := s.Get(BucketShareLinks, id)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var link ShareLink
+	if err := json.Unmarshal(data, &link); err != nil {
+		return nil, err
+	}
+	return &link, nil
+}
+
+// DeleteShareLink revokes a share link
+func (s *Storage) DeleteShareLink(id string) error {
+	return s.Delete(BucketShareLinks, id)
+}
+
+// ListShareLinks returns the share links that haven't expired, newest first
+func (s *Storage) ListShareLinks() ([]ShareLink, error) {
+	page, err := s.Scan(BucketShareLinks, ScanOptions{})
+	if err != nil {
+		return nil, err
+	}
+	links := make([]ShareLink, 0, len(page.Items))
+	for _, item := range page.Items {
+		var link ShareLink
+		if err := json.Unmarshal(item.Value, &link); err == nil {
+			links = append(links, link)
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].CreatedAt.After(links[j].CreatedAt) })
+	return links, nil
+}
+
+// UseShareLink counts a download of a share link and returns it, nil when
+// the link doesn't exist, expired or has no downloads left. The check and
+// the count are one transaction, so concurrent downloads can't go past
+// the limit.
+func (s *Storage) UseShareLink(id string) (*ShareLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var used *ShareLink
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketShareLinks))
+		data := b.Get([]byte(id))
+		if data == nil || expiryChecker(tx, BucketShareLinks)([]byte(id)) {
+			return nil
+		}
+		var link ShareLink
+		if err := json.Unmarshal(data, &link); err != nil {
+			return err
+		}
+		if link.MaxDownloads > 0 && link.Downloads >= link.MaxDownloads {
+			return nil
+		}
+
+		link.Downloads++
+		data, err := json.Marshal(link)
+		if err != nil {
+			return err
+		}
+		// The expiry record is left as is
+		if err := b.Put([]byte(id), data); err != nil {
+			return err
+		}
+		used = &link
+		return nil
+	})
+	return used, err
+}
+
+// ShareKey returns the key share link tokens are signed with, generated on
+// first use
+func (s *Storage) ShareKey() ([]byte, error) {
+	if key, err := s.Get(BucketMeta, shareKeyName); err != nil || key != nil {
+		return key, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var key []byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(BucketMeta))
+		if v := b.Get([]byte(shareKeyName)); v != nil {
+			key = append([]byte(nil), v...)
+			return nil
+		}
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return fmt.Errorf("failed to generate share key: %w", err)
+		}
+		return b.Put([]byte(shareKeyName), key)
+	})
+	return key, err
+}
@@ -11,8 +11,13 @@ import (
 
 // Storage manages the BoltDB database
 type Storage struct {
-	db *bolt.DB
-	mu sync.RWMutex
+	db   *bolt.DB
+	mu   sync.RWMutex
+	path string
+
+	retention retentionState
+	health    healthState
+	metrics   metricsBatch
 }
 
 // New creates a new Storage instance
@@ -24,7 +29,7 @@ func New(path string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
-	s := &Storage{db: db}
+	s := &Storage{db: db, path: path}
 
 	// Initialize all buckets
 	if err := s.initBuckets(); err != nil {
@@ -32,18 +37,29 @@ func New(path string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to initialize buckets: %w", err)
 	}
 
+	// Upgrade data written by older releases
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
 	return s, nil
 }
 
-// Close closes the database
+// Close flushes queued writes and closes the database
 func (s *Storage) Close() error {
+	s.flushMetricsLogged()
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	return s.db.Close()
 }
 
-// DB returns the underlying bolt.DB instance
+// DB returns the underlying bolt.DB instance, replaced when the database
+// is re-initialized after corruption
 func (s *Storage) DB() *bolt.DB {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return s.db
 }
 
@@ -59,7 +75,7 @@ func (s *Storage) Get(bucket, key string) ([]byte, error) {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
 		v := b.Get([]byte(key))
-		if v != nil {
+		if v != nil && !expiryChecker(tx, bucket)([]byte(key)) {
 			value = make([]byte, len(v))
 			copy(value, v)
 		}
@@ -78,7 +94,11 @@ func (s *Storage) Set(bucket, key string, value []byte) error {
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
-		return b.Put([]byte(key), value)
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+		// A plain Set makes the value permanent again
+		return tx.Bucket([]byte(BucketTTL)).Delete(ttlKey(bucket, key))
 	})
 }
 
@@ -92,7 +112,10 @@ func (s *Storage) Delete(bucket, key string) error {
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
-		return b.Delete([]byte(key))
+		if err := b.Delete([]byte(key)); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BucketTTL)).Delete(ttlKey(bucket, key))
 	})
 }
 
@@ -128,7 +151,11 @@ func (s *Storage) GetAll(bucket string) (map[string][]byte, error) {
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
+		expired := expiryChecker(tx, bucket)
 		return b.ForEach(func(k, v []byte) error {
+			if expired(k) {
+				return nil
+			}
 			value := make([]byte, len(v))
 			copy(value, v)
 			result[string(k)] = value
@@ -141,10 +168,20 @@ func (s *Storage) GetAll(bucket string) (map[string][]byte, error) {
 // DeleteOlderThan removes entries older than the specified duration
 // Requires entries to have a "timestamp" field in JSON format
 func (s *Storage) DeleteOlderThan(bucket string, duration time.Duration) error {
+	_, err := s.PurgeOlderThan(bucket, duration)
+	return err
+}
+
+// PurgeOlderThan is like DeleteOlderThan but also reports how many entries were removed
+func (s *Storage) PurgeOlderThan(bucket string, duration time.Duration) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	cutoff := time.Now().Add(-duration)
+	if timeKeyedBuckets[bucket] {
+		return s.purgeKeysBefore(bucket, cutoff)
+	}
+
 	var keysToDelete [][]byte
 
 	err := s.db.View(func(tx *bolt.Tx) error {
@@ -167,14 +204,14 @@ func (s *Storage) DeleteOlderThan(bucket string, duration time.Duration) error {
 		})
 	})
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	if len(keysToDelete) == 0 {
-		return nil
+		return 0, nil
 	}
 
-	return s.db.Update(func(tx *bolt.Tx) error {
+	err = s.db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(bucket))
 		for _, key := range keysToDelete {
 			if err := b.Delete(key); err != nil {
@@ -183,6 +220,10 @@ func (s *Storage) DeleteOlderThan(bucket string, duration time.Duration) error {
 		}
 		return nil
 	})
+	if err != nil {
+		return 0, err
+	}
+	return len(keysToDelete), nil
 }
 
 // Count returns the number of entries in a bucket
@@ -201,3 +242,32 @@ func (s *Storage) Count(bucket string) (int, error) {
 	})
 	return count, err
 }
+
+// purgeKeysBefore deletes the leading entries of a time keyed bucket up to cutoff.
+// Only keys are read, so no values need to be decoded. Callers must hold s.mu.
+func (s *Storage) purgeKeysBefore(bucket string, cutoff time.Time) (int, error) {
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", bucket)
+		}
+
+		c := b.Cursor()
+		for k, _ := c.First(); k != nil; k, _ = c.First() {
+			ts, ok := keyTime(k)
+			if !ok || !ts.Before(cutoff) {
+				break
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			deleted++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TaskRun records one execution of a scheduled task
+type TaskRun struct {
+	ID       string `json:"id"`
+	TaskID   string `json:"task_id"`
+	TaskName string `json:"task_name"`
+	// Trigger is schedule or manual
+	Trigger    string    `json:"trigger"`
+	User       string    `json:"user,omitempty"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+	Output     string    `json:"output,omitempty"`
+	// Truncated reports that output beyond the capture limit was dropped
+	Truncated bool   `json:"truncated,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TaskRunPage is one page of task runs, newest first
+type TaskRunPage struct {
+	Runs []TaskRun `json:"runs"`
+	Next string    `json:"next,omitempty"`
+}
+
+// AddTaskRun appends a finished run to the task history
+func (s *Storage) AddTaskRun(run TaskRun) error {
+	return s.SetJSON(BucketTaskRuns, timeKey(run.StartedAt)+run.ID, run)
+}
+
+// GetTaskRuns returns the runs of a task, or of every task when taskID is
+// empty, newest first, starting after cursor
+func (s *Storage) GetTaskRuns(taskID, cursor string, limit int) (*TaskRunPage, error) {
+	opts := ScanOptions{Limit: limit, Reverse: true}
+	if cursor != "" {
+		key, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cursor")
+		}
+		opts.Cursor = string(key)
+	}
+	if taskID != "" {
+		opts.Match = func(_, value []byte) bool {
+			var run struct {
+				TaskID string `json:"task_id"`
+			}
+			return json.Unmarshal(value, &run) == nil && run.TaskID == taskID
+		}
+	}
+
+	result, err := s.Scan(BucketTaskRuns, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TaskRunPage{Runs: make([]TaskRun, 0, len(result.Items))}
+	for _, item := range result.Items {
+		var run TaskRun
+		if err := json.Unmarshal(item.Value, &run); err == nil {
+			page.Runs = append(page.Runs, run)
+		}
+	}
+	if result.Next != "" {
+		page.Next = base64.RawURLEncoding.EncodeToString([]byte(result.Next))
+	}
+
+	return page, nil
+}
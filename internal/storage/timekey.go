@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// timeKeyLen is the length of an encoded timestamp key
+const timeKeyLen = 8
+
+// timeKeyedBuckets are the buckets whose keys start with a timestamp key,
+// so time ranges map directly to key ranges
+var timeKeyedBuckets = map[string]bool{
+	BucketMetricsHistory:   true,
+	BucketMetrics1m:        true,
+	BucketMetrics5m:        true,
+	BucketAuditLog:         true,
+	BucketConfigHistory:    true,
+	BucketTaskRuns:         true,
+	BucketNotifyDeliveries: true,
+}
+
+// timeKey encodes t as big-endian Unix nanoseconds, which sort bytewise in time order
+func timeKey(t time.Time) string {
+	k := make([]byte, timeKeyLen)
+	binary.BigEndian.PutUint64(k, uint64(t.UnixNano()))
+	return string(k)
+}
+
+// keyTime decodes the timestamp at the start of a time key
+func keyTime(k []byte) (time.Time, bool) {
+	if len(k) < timeKeyLen {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(k[:timeKeyLen]))), true
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ttlKey builds the key of a value's expiry record in BucketTTL
+func ttlKey(bucket, key string) []byte {
+	return []byte(bucket + "\x00" + key)
+}
+
+// SetWithTTL stores a value that expires after ttl. Expired values read as
+// missing and are removed by PurgeExpired.
+func (s *Storage) SetWithTTL(bucket, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry := make([]byte, 8)
+	binary.BigEndian.PutUint64(expiry, uint64(time.Now().Add(ttl).UnixNano()))
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(bucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", bucket)
+		}
+		if err := b.Put([]byte(key), value); err != nil {
+			return err
+		}
+		return tx.Bucket([]byte(BucketTTL)).Put(ttlKey(bucket, key), expiry)
+	})
+}
+
+// SetJSONWithTTL marshals and stores a JSON value that expires after ttl
+func (s *Storage) SetJSONWithTTL(bucket, key string, v interface{}, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %w", err)
+	}
+	return s.SetWithTTL(bucket, key, data, ttl)
+}
+
+// TTL returns the time left before a value expires, false if it has no expiry
+func (s *Storage) TTL(bucket, key string) (time.Duration, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var expiry time.Time
+	var ok bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		expiry, ok = expiryOf(tx, bucket, []byte(key))
+		return nil
+	})
+	if err != nil || !ok {
+		return 0, false, err
+	}
+	return time.Until(expiry), true, nil
+}
+
+// PurgeExpired deletes all values whose TTL has passed
+func (s *Storage) PurgeExpired() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	deleted := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		ttl := tx.Bucket([]byte(BucketTTL))
+
+		var expired [][]byte
+		err := ttl.ForEach(func(k, v []byte) error {
+			if len(v) == 8 && now.UnixNano() >= int64(binary.BigEndian.Uint64(v)) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, k := range expired {
+			bucket, key, _ := cutTTLKey(k)
+			if b := tx.Bucket([]byte(bucket)); b != nil && b.Get(key) != nil {
+				if err := b.Delete(key); err != nil {
+					return err
+				}
+				deleted++
+			}
+			if err := ttl.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// cutTTLKey splits an expiry record key into bucket and key
+func cutTTLKey(k []byte) (string, []byte, bool) {
+	for i, c := range k {
+		if c == 0 {
+			return string(k[:i]), k[i+1:], true
+		}
+	}
+	return "", nil, false
+}
+
+// expiryOf returns the expiry time of a value, false if it has none
+func expiryOf(tx *bolt.Tx, bucket string, key []byte) (time.Time, bool) {
+	ttl := tx.Bucket([]byte(BucketTTL))
+	if ttl == nil {
+		return time.Time{}, false
+	}
+	v := ttl.Get(ttlKey(bucket, string(key)))
+	if len(v) != 8 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(v))), true
+}
+
+// expiryChecker returns a function reporting whether a key of bucket has
+// expired. It is a no-op when no value in the database has a TTL.
+func expiryChecker(tx *bolt.Tx, bucket string) func(key []byte) bool {
+	ttl := tx.Bucket([]byte(BucketTTL))
+	if ttl == nil {
+		return func([]byte) bool { return false }
+	}
+	if k, _ := ttl.Cursor().First(); k == nil {
+		return func([]byte) bool { return false }
+	}
+
+	now := time.Now()
+	return func(key []byte) bool {
+		expiry, ok := expiryOf(tx, bucket, key)
+		return ok && !now.Before(expiry)
+	}
+}
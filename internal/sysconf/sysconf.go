@@ -0,0 +1,150 @@
+package sysconf
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Errors callers can tell apart with errors.Is
+var (
+	// ErrUnsupported is returned for settings that can't be changed on this system
+	ErrUnsupported = errors.New("not supported on this system")
+	// ErrInvalid is returned for values the setting doesn't accept
+	ErrInvalid = errors.New("invalid value")
+)
+
+// zoneinfoDir holds the tz database on Unix systems
+const zoneinfoDir = "/usr/share/zoneinfo"
+
+// hostnameLabel matches a label of a hostname as defined by RFC 1123
+var hostnameLabel = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9-]{0,61}[A-Za-z0-9])?$`)
+
+// Settings are the host identity and clock settings
+type Settings struct {
+	Hostname        string `json:"hostname"`
+	Timezone        string `json:"timezone"`
+	NTP             bool   `json:"ntp"`
+	NTPSynchronized bool   `json:"ntp_synchronized"`
+	Locale          string `json:"locale"`
+	// Editable is false where the settings can only be read
+	Editable bool `json:"editable"`
+}
+
+// Get returns the current settings
+func Get() (Settings, error) {
+	return get()
+}
+
+// SetHostname changes the hostname
+func SetHostname(name string) error {
+	if err := ValidateHostname(name); err != nil {
+		return err
+	}
+	return setHostname(name)
+}
+
+// SetTimezone changes the timezone, a name of the tz database such as Europe/Rome
+func SetTimezone(zone string) error {
+	if err := ValidateTimezone(zone); err != nil {
+		return err
+	}
+	return setTimezone(zone)
+}
+
+// SetNTP enables or disables clock synchronization
+func SetNTP(enabled bool) error {
+	return setNTP(enabled)
+}
+
+// SetLocale changes the system locale, one of Locales
+func SetLocale(locale string) error {
+	locales, err := Locales()
+	if err != nil {
+		return err
+	}
+	for _, l := range locales {
+		if l == locale {
+			return setLocale(locale)
+		}
+	}
+	return fmt.Errorf("%w: unknown locale %q", ErrInvalid, locale)
+}
+
+// Locales returns the locales that can be set
+func Locales() ([]string, error) {
+	return locales()
+}
+
+// ValidateHostname checks a hostname against RFC 1123
+func ValidateHostname(name string) error {
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("%w: hostname must be 1 to 253 characters", ErrInvalid)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if !hostnameLabel.MatchString(label) {
+			return fmt.Errorf("%w: hostname labels may only contain letters, digits and inner dashes", ErrInvalid)
+		}
+	}
+	return nil
+}
+
+// ValidateTimezone checks that zone is in the tz database
+func ValidateTimezone(zone string) error {
+	if zone == "" || zone == "Local" || strings.Contains(zone, "..") {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, zone)
+	}
+	if _, err := time.LoadLocation(zone); err != nil {
+		return fmt.Errorf("%w: unknown timezone %q", ErrInvalid, zone)
+	}
+	return nil
+}
+
+// Timezones returns the names of the tz database, sorted
+func Timezones() ([]string, error) {
+	if zones, err := timezones(); err == nil {
+		return zones, nil
+	}
+
+	var zones []string
+	err := filepath.WalkDir(zoneinfoDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(path, zoneinfoDir+"/")
+		switch {
+		case d.IsDir() && (name == "posix" || name == "right"):
+			// Copies of the database with other leap second handling
+			return filepath.SkipDir
+		case d.IsDir(), name == "posixrules", name == "localtime", name == "Factory":
+			return nil
+		}
+		if isTZif(path) {
+			zones = append(zones, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the tz database: %w", err)
+	}
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// isTZif reports whether path is a compiled zone file
+func isTZif(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	magic := make([]byte, 4)
+	_, err = f.Read(magic)
+	return err == nil && string(magic) == "TZif"
+}
@@ -0,0 +1,135 @@
+//go:build linux
+
+package sysconf
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// get reads the settings from systemd, falling back to the files it manages
+func get() (Settings, error) {
+	s := Settings{Editable: hasSystemd()}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return s, err
+	}
+	s.Hostname = hostname
+
+	if out, err := exec.Command("timedatectl", "show").Output(); err == nil {
+		props := parseProperties(string(out))
+		s.Timezone = props["Timezone"]
+		s.NTP = props["NTP"] == "yes"
+		s.NTPSynchronized = props["NTPSynchronized"] == "yes"
+	}
+	if s.Timezone == "" {
+		s.Timezone = localTimezone()
+	}
+
+	if out, err := exec.Command("localectl", "status").Output(); err == nil {
+		s.Locale = parseLocale(string(out))
+	}
+	if s.Locale == "" {
+		s.Locale = os.Getenv("LANG")
+	}
+	return s, nil
+}
+
+// hasSystemd reports whether the systemd tools used to change settings are available
+func hasSystemd() bool {
+	for _, tool := range []string{"hostnamectl", "timedatectl", "localectl"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func setHostname(name string) error {
+	return run("hostnamectl", "set-hostname", name)
+}
+
+func setTimezone(zone string) error {
+	return run("timedatectl", "set-timezone", zone)
+}
+
+func setNTP(enabled bool) error {
+	return run("timedatectl", "set-ntp", fmt.Sprint(enabled))
+}
+
+func setLocale(locale string) error {
+	return run("localectl", "set-locale", "LANG="+locale)
+}
+
+func timezones() ([]string, error) {
+	out, err := exec.Command("timedatectl", "list-timezones").Output()
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(string(out)), nil
+}
+
+func locales() ([]string, error) {
+	if _, err := exec.LookPath("localectl"); err != nil {
+		return nil, ErrUnsupported
+	}
+	out, err := exec.Command("localectl", "list-locales").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locales: %w", err)
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// run runs a systemd tool, including its output in the error
+func run(name string, args ...string) error {
+	if _, err := exec.LookPath(name); err != nil {
+		return ErrUnsupported
+	}
+	output, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s: %s", name, out)
+		}
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// parseProperties parses the key=value lines of systemctl-style show commands
+func parseProperties(out string) map[string]string {
+	props := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(out))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// parseLocale finds LANG in the output of localectl status, e.g.
+// "System Locale: LANG=en_US.UTF-8"
+func parseLocale(out string) string {
+	for _, field := range strings.Fields(out) {
+		if locale, ok := strings.CutPrefix(field, "LANG="); ok {
+			return locale
+		}
+	}
+	return ""
+}
+
+// localTimezone reads the zone /etc/localtime links to
+func localTimezone() string {
+	target, err := os.Readlink("/etc/localtime")
+	if err != nil {
+		return "UTC"
+	}
+	if _, zone, ok := strings.Cut(target, "zoneinfo/"); ok {
+		return zone
+	}
+	return "UTC"
+}
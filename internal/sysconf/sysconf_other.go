@@ -0,0 +1,33 @@
+//go:build !linux
+
+package sysconf
+
+import (
+	"os"
+	"time"
+)
+
+// get reports the hostname and timezone, which can't be changed outside Linux
+func get() (Settings, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return Settings{}, err
+	}
+	return Settings{
+		Hostname: hostname,
+		Timezone: time.Local.String(),
+		Locale:   os.Getenv("LANG"),
+	}, nil
+}
+
+func setHostname(string) error { return ErrUnsupported }
+
+func setTimezone(string) error { return ErrUnsupported }
+
+func setNTP(bool) error { return ErrUnsupported }
+
+func setLocale(string) error { return ErrUnsupported }
+
+func timezones() ([]string, error) { return nil, ErrUnsupported }
+
+func locales() ([]string, error) { return nil, ErrUnsupported }
@@ -0,0 +1,89 @@
+package terminal
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SetBroadcast links the given sessions so that input typed in any of them is
+// mirrored to all of them. An empty list disables broadcasting.
+func (m *Manager) SetBroadcast(ids []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(ids) == 1 {
+		return fmt.Errorf("broadcast requires at least two sessions")
+	}
+
+	for _, id := range ids {
+		if _, ok := m.sessions[id]; !ok {
+			return fmt.Errorf("session not found: %s", id)
+		}
+	}
+
+	m.broadcast = make(map[string]bool, len(ids))
+	for _, id := range ids {
+		m.broadcast[id] = true
+	}
+	return nil
+}
+
+// BroadcastSessions returns the IDs of the sessions currently linked
+func (m *Manager) BroadcastSessions() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	ids := make([]string, 0, len(m.broadcast))
+	for id := range m.broadcast {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// IsBroadcast reports whether a session is part of the broadcast group
+func (m *Manager) IsBroadcast(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.broadcast[id]
+}
+
+// WriteInput writes client input to a session, mirroring it to every linked
+// session when the session is part of the broadcast group
+func (m *Manager) WriteInput(session *Session, data []byte) error {
+	m.mu.RLock()
+	var targets []*Session
+	if m.broadcast[session.ID] {
+		for id := range m.broadcast {
+			if s, ok := m.sessions[id]; ok {
+				targets = append(targets, s)
+			}
+		}
+	}
+	m.mu.RUnlock()
+
+	if len(targets) == 0 {
+		_, err := session.Write(data)
+		return err
+	}
+
+	var firstErr error
+	for _, s := range targets {
+		if _, err := s.Write(data); err != nil && s == session {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// unlinkLocked removes a session from the broadcast group, dissolving the
+// group when fewer than two sessions remain. Callers must hold m.mu.
+func (m *Manager) unlinkLocked(id string) {
+	if !m.broadcast[id] {
+		return
+	}
+	delete(m.broadcast, id)
+	if len(m.broadcast) < 2 {
+		m.broadcast = nil
+	}
+}
@@ -0,0 +1,216 @@
+//go:build windows
+
+package terminal
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"unicode/utf16"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// conPty is a Windows pseudo console (ConPTY) attached to a child process
+type conPty struct {
+	hpc     windows.Handle
+	process windows.Handle
+	thread  windows.Handle
+	pid     int
+	input   *os.File
+	output  *os.File
+	mu      sync.Mutex
+	closed  bool
+	// exited is set once the child process exited and its handles were
+	// released
+	exited bool
+}
+
+// isConPtyAvailable reports whether the running Windows version supports ConPTY
+// (Windows 10 1809 and later)
+func isConPtyAvailable() bool {
+	kernel32 := windows.NewLazySystemDLL("kernel32.dll")
+	return kernel32.NewProc("CreatePseudoConsole").Find() == nil &&
+		kernel32.NewProc("ResizePseudoConsole").Find() == nil &&
+		kernel32.NewProc("ClosePseudoConsole").Find() == nil
+}
+
+// startConPty starts the given command line attached to a new pseudo console
+func startConPty(args []string, env []string, dir string, cols, rows uint16) (*conPty, error) {
+	var ptyIn, ptyInWrite, ptyOutRead, ptyOut windows.Handle
+
+	if err := windows.CreatePipe(&ptyIn, &ptyInWrite, nil, 0); err != nil {
+		return nil, fmt.Errorf("failed to create input pipe: %w", err)
+	}
+	if err := windows.CreatePipe(&ptyOutRead, &ptyOut, nil, 0); err != nil {
+		windows.CloseHandle(ptyIn)
+		windows.CloseHandle(ptyInWrite)
+		return nil, fmt.Errorf("failed to create output pipe: %w", err)
+	}
+
+	var hpc windows.Handle
+	size := windows.Coord{X: int16(cols), Y: int16(rows)}
+	err := windows.CreatePseudoConsole(size, ptyIn, ptyOut, 0, &hpc)
+
+	// The pseudo console duplicates its ends of the pipes
+	windows.CloseHandle(ptyIn)
+	windows.CloseHandle(ptyOut)
+
+	if err != nil {
+		windows.CloseHandle(ptyInWrite)
+		windows.CloseHandle(ptyOutRead)
+		return nil, fmt.Errorf("failed to create pseudo console: %w", err)
+	}
+
+	c := &conPty{
+		hpc:    hpc,
+		input:  os.NewFile(uintptr(ptyInWrite), "conpty-input"),
+		output: os.NewFile(uintptr(ptyOutRead), "conpty-output"),
+	}
+
+	if err := c.spawn(args, env, dir); err != nil {
+		c.Close()
+		return nil, err
+	}
+	go c.wait()
+
+	return c, nil
+}
+
+// spawn creates the child process with the pseudo console attribute
+func (c *conPty) spawn(args []string, env []string, dir string) error {
+	attrs, err := windows.NewProcThreadAttributeList(1)
+	if err != nil {
+		return fmt.Errorf("failed to create attribute list: %w", err)
+	}
+	defer attrs.Delete()
+
+	// PROC_THREAD_ATTRIBUTE_PSEUDOCONSOLE takes the HPCON value itself
+	if err := attrs.Update(
+		windows.PROC_THREAD_ATTRIBUTE_PSEUDOCONSOLE,
+		*(*unsafe.Pointer)(unsafe.Pointer(&c.hpc)),
+		unsafe.Sizeof(c.hpc),
+	); err != nil {
+		return fmt.Errorf("failed to set pseudo console attribute: %w", err)
+	}
+
+	si := &windows.StartupInfoEx{}
+	si.Cb = uint32(unsafe.Sizeof(*si))
+	si.Flags = windows.STARTF_USESTDHANDLES
+	si.ProcThreadAttributeList = attrs.List()
+
+	cmdLine, err := windows.UTF16PtrFromString(windows.ComposeCommandLine(args))
+	if err != nil {
+		return err
+	}
+
+	var currentDir *uint16
+	if dir != "" {
+		currentDir, err = windows.UTF16PtrFromString(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	envBlock := createEnvBlock(env)
+
+	var pi windows.ProcessInformation
+	err = windows.CreateProcess(
+		nil,
+		cmdLine,
+		nil,
+		nil,
+		false,
+		windows.EXTENDED_STARTUPINFO_PRESENT|windows.CREATE_UNICODE_ENVIRONMENT,
+		&envBlock[0],
+		currentDir,
+		&si.StartupInfo,
+		&pi,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start process: %w", err)
+	}
+
+	c.process = pi.Process
+	c.thread = pi.Thread
+	c.pid = int(pi.ProcessId)
+	return nil
+}
+
+// createEnvBlock builds a double NUL terminated UTF-16 environment block
+func createEnvBlock(env []string) []uint16 {
+	if len(env) == 0 {
+		return []uint16{0, 0}
+	}
+
+	var block []uint16
+	for _, kv := range env {
+		block = append(block, utf16.Encode([]rune(kv))...)
+		block = append(block, 0)
+	}
+	return append(block, 0)
+}
+
+// wait releases the pseudo console once the child process exits. The output
+// pipe stays open as long as the console does, closing it makes reads end
+// with EOF as they do when a Unix shell exits.
+func (c *conPty) wait() {
+	windows.WaitForSingleObject(c.process, windows.INFINITE)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.exited = true
+	windows.CloseHandle(c.process)
+	windows.CloseHandle(c.thread)
+	c.closeConsole()
+}
+
+// closeConsole closes the pseudo console once. Callers must hold c.mu.
+func (c *conPty) closeConsole() {
+	if c.hpc != 0 {
+		windows.ClosePseudoConsole(c.hpc)
+		c.hpc = 0
+	}
+}
+
+func (c *conPty) Read(b []byte) (int, error) {
+	return c.output.Read(b)
+}
+
+func (c *conPty) Write(b []byte) (int, error) {
+	return c.input.Write(b)
+}
+
+// Resize changes the size of the pseudo console
+func (c *conPty) Resize(cols, rows uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.hpc == 0 {
+		return nil
+	}
+	return windows.ResizePseudoConsole(c.hpc, windows.Coord{X: int16(cols), Y: int16(rows)})
+}
+
+// Close terminates the child process and releases the pseudo console
+func (c *conPty) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+
+	// The process handles are released by wait once the process is gone
+	if c.process != 0 && !c.exited {
+		windows.TerminateProcess(c.process, 1)
+	}
+
+	// Closing the pseudo console also unblocks pending reads on the output pipe
+	c.closeConsole()
+	c.input.Close()
+	return c.output.Close()
+}
@@ -3,20 +3,41 @@ package terminal
 import (
 	"fmt"
 	"io"
+	"os"
 	"os/exec"
 	"runtime"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/nebula/nebula/internal/storage"
 )
 
 // Session represents a terminal session
 type Session struct {
-	ID       string
-	Shell    string
-	Cmd      *exec.Cmd
-	Pty      io.ReadWriteCloser
-	mu       sync.Mutex
-	closed   bool
-	OnResize func(cols, rows uint16) error
+	ID        string
+	Shell     string
+	PID       int
+	Owner     string
+	ClientIP  string
+	CreatedAt time.Time
+	Cmd       *exec.Cmd
+	Pty       io.ReadWriteCloser
+	mu        sync.Mutex
+	closed    bool
+	OnResize  func(cols, rows uint16) error
+
+	lastActive  time.Time
+	lastPersist time.Time
+	onActivity  func(*Session)
+
+	scrollback  *ringBuffer
+	listeners   map[chan []byte]struct{}
+	attached    int
+	done        bool
+	detachTimer *time.Timer
+	onIdle      func(*Session)
+	onExit      func(*Session)
 }
 
 // IsClosed returns whether the session is closed
@@ -26,6 +47,57 @@ func (s *Session) IsClosed() bool {
 	return s.closed
 }
 
+// SessionOptions holds the parameters requested by a client for a new session
+type SessionOptions struct {
+	Shell   string
+	Cols    uint16
+	Rows    uint16
+	Env     map[string]string
+	Command string
+	Dir     string
+
+	// Scrollback is the number of bytes of output kept for reattaching clients
+	Scrollback int
+
+	// Multiplexer and Target attach the session to an existing tmux/screen
+	// session on the host instead of starting a shell
+	Multiplexer string
+	Target      string
+
+	// Serial opens a serial device instead of starting a shell
+	Serial *SerialOptions
+
+	// Owner and ClientIP identify who requested the session
+	Owner    string
+	ClientIP string
+}
+
+// Policy constrains what clients may request when creating a session
+type Policy struct {
+	DefaultCols  uint16
+	DefaultRows  uint16
+	MaxCols      uint16
+	MaxRows      uint16
+	AllowedEnv   []string
+	AllowCommand bool
+
+	DefaultScrollback int
+	MaxScrollback     int
+
+	// AllowMultiplexer permits attaching to host tmux/screen sessions
+	AllowMultiplexer bool
+
+	// SerialDevices lists glob patterns of serial devices sessions may open
+	SerialDevices []string
+
+	// MaxSessionsPerUser limits sessions owned by a single user, zero means unlimited
+	MaxSessionsPerUser int
+
+	// DetachTimeout keeps a session alive without clients for reattaching,
+	// zero closes it as soon as the last client disconnects
+	DetachTimeout time.Duration
+}
+
 // Manager manages terminal sessions
 type Manager struct {
 	sessions      map[string]*Session
@@ -33,23 +105,78 @@ type Manager struct {
 	maxSessions   int
 	allowedShells []string
 	defaultShell  string
+	policy        Policy
+	storage       *storage.Storage
+
+	// configMu guards the settings above that can change on config reload
+	configMu sync.RWMutex
+
+	// broadcast holds the IDs of sessions whose input is mirrored
+	broadcast map[string]bool
 }
 
 // NewManager creates a new terminal manager
-func NewManager(maxSessions int, allowedShells []string, defaultShell string) *Manager {
-	return &Manager{
+func NewManager(maxSessions int, allowedShells []string, defaultShell string, policy Policy, store *storage.Storage) *Manager {
+	m := &Manager{
 		sessions:      make(map[string]*Session),
 		maxSessions:   maxSessions,
 		allowedShells: allowedShells,
 		defaultShell:  defaultShell,
+		policy:        policy.withDefaults(),
+		storage:       store,
 	}
+
+	// Sessions never survive a restart, drop whatever the last run left behind
+	if store != nil {
+		m.reconcileStored()
+	}
+
+	return m
+}
+
+// Reconfigure replaces the session limits, shells and policy. Running
+// sessions keep the settings they were created with.
+func (m *Manager) Reconfigure(maxSessions int, allowedShells []string, defaultShell string, policy Policy) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	m.maxSessions = maxSessions
+	m.allowedShells = allowedShells
+	m.defaultShell = defaultShell
+	m.policy = policy.withDefaults()
+}
+
+// withDefaults fills in the terminal size when the configuration leaves it unset
+func (p Policy) withDefaults() Policy {
+	if p.DefaultCols == 0 {
+		p.DefaultCols = 80
+	}
+	if p.DefaultRows == 0 {
+		p.DefaultRows = 24
+	}
+	return p
+}
+
+// currentPolicy returns the policy in effect
+func (m *Manager) currentPolicy() Policy {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.policy
+}
+
+// shells returns the allowed shells and the configured default shell
+func (m *Manager) shells() ([]string, string) {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.allowedShells, m.defaultShell
 }
 
 // GetAvailableShells returns available shells on the system
 func (m *Manager) GetAvailableShells() []string {
 	var shells []string
+	allowedShells, _ := m.shells()
 	
-	for _, shell := range m.allowedShells {
+	for _, shell := range allowedShells {
 		if path, err := exec.LookPath(shell); err == nil {
 			shells = append(shells, path)
 		}
@@ -60,8 +187,8 @@ func (m *Manager) GetAvailableShells() []string {
 
 // GetDefaultShell returns the default shell (full path)
 func (m *Manager) GetDefaultShell() string {
-	if m.defaultShell != "" {
-		if path, err := exec.LookPath(m.defaultShell); err == nil {
+	if _, defaultShell := m.shells(); defaultShell != "" {
+		if path, err := exec.LookPath(defaultShell); err == nil {
 			return path
 		}
 	}
@@ -98,7 +225,8 @@ func (m *Manager) IsShellAllowed(shell string) bool {
 		baseName = shell[idx+1:]
 	}
 	
-	for _, allowed := range m.allowedShells {
+	allowedShells, _ := m.shells()
+	for _, allowed := range allowedShells {
 		if shell == allowed || baseName == allowed {
 			return true
 		}
@@ -116,35 +244,158 @@ func lastIndex(s string, c byte) int {
 }
 
 // CreateSession creates a new terminal session
-func (m *Manager) CreateSession(id, shell string, cols, rows uint16) (*Session, error) {
+func (m *Manager) CreateSession(id string, opts SessionOptions) (*Session, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+
+	m.configMu.RLock()
+	maxSessions, policy := m.maxSessions, m.policy
+	m.configMu.RUnlock()
 	
-	if len(m.sessions) >= m.maxSessions {
+	if len(m.sessions) >= maxSessions {
 		return nil, fmt.Errorf("maximum sessions reached")
 	}
 	
 	if _, exists := m.sessions[id]; exists {
 		return nil, fmt.Errorf("session already exists")
 	}
-	
-	if shell == "" {
-		shell = m.GetDefaultShell()
+
+	if limit := policy.MaxSessionsPerUser; limit > 0 && m.countOwnedLocked(opts.Owner) >= limit {
+		return nil, fmt.Errorf("maximum sessions reached for user %s", opts.Owner)
 	}
 	
-	if !m.IsShellAllowed(shell) {
-		return nil, fmt.Errorf("shell not allowed: %s", shell)
+	if opts.Serial != nil {
+		serial := opts.Serial.withDefaults()
+		if err := serial.validate(); err != nil {
+			return nil, err
+		}
+		if !m.isSerialDeviceAllowed(serial.Device) {
+			return nil, fmt.Errorf("serial device not allowed: %s", serial.Device)
+		}
+		opts.Serial = &serial
+	} else if opts.Multiplexer != "" {
+		if !policy.AllowMultiplexer {
+			return nil, fmt.Errorf("attaching to %s sessions is not allowed", opts.Multiplexer)
+		}
+		if err := findMultiplexerSession(opts.Multiplexer, opts.Target); err != nil {
+			return nil, err
+		}
+		opts.Shell = opts.Multiplexer
+	} else {
+		if opts.Shell == "" {
+			opts.Shell = m.GetDefaultShell()
+		}
+
+		if !m.IsShellAllowed(opts.Shell) {
+			return nil, fmt.Errorf("shell not allowed: %s", opts.Shell)
+		}
+	}
+
+	if err := policy.apply(&opts); err != nil {
+		return nil, err
 	}
 	
-	session, err := newPlatformSession(id, shell, cols, rows)
+	var session *Session
+	var err error
+	if opts.Serial != nil {
+		session, err = newSerialSession(id, *opts.Serial)
+	} else {
+		session, err = newPlatformSession(id, opts)
+	}
 	if err != nil {
 		return nil, err
 	}
+
+	now := time.Now()
+	session.Owner = opts.Owner
+	session.ClientIP = opts.ClientIP
+	session.CreatedAt = now
+	session.lastActive = now
+	session.onActivity = m.persistSession
+	session.scrollback = newRingBuffer(opts.Scrollback)
+	session.listeners = make(map[chan []byte]struct{})
+	session.onIdle = m.scheduleClose
+	session.onExit = func(s *Session) { m.CloseSession(s.ID) }
 	
 	m.sessions[id] = session
+	m.persistSession(session)
+
+	go session.pump()
 	return session, nil
 }
 
+// countOwnedLocked returns the number of sessions owned by a user. Callers must hold m.mu.
+func (m *Manager) countOwnedLocked(owner string) int {
+	count := 0
+	for _, session := range m.sessions {
+		if session.Owner == owner {
+			count++
+		}
+	}
+	return count
+}
+
+// apply fills in defaults and validates the options against the policy
+func (p Policy) apply(opts *SessionOptions) error {
+	if opts.Cols == 0 {
+		opts.Cols = p.DefaultCols
+	}
+	if opts.Rows == 0 {
+		opts.Rows = p.DefaultRows
+	}
+	if p.MaxCols > 0 && opts.Cols > p.MaxCols {
+		opts.Cols = p.MaxCols
+	}
+	if p.MaxRows > 0 && opts.Rows > p.MaxRows {
+		opts.Rows = p.MaxRows
+	}
+
+	if opts.Scrollback <= 0 {
+		opts.Scrollback = p.DefaultScrollback
+	}
+	if p.MaxScrollback > 0 && opts.Scrollback > p.MaxScrollback {
+		opts.Scrollback = p.MaxScrollback
+	}
+
+	for key := range opts.Env {
+		if !p.isEnvAllowed(key) {
+			return fmt.Errorf("environment variable not allowed: %s", key)
+		}
+	}
+
+	if opts.Command != "" && !p.AllowCommand {
+		return fmt.Errorf("startup commands are not allowed")
+	}
+
+	return nil
+}
+
+// isEnvAllowed checks if a client may set an environment variable
+func (p Policy) isEnvAllowed(key string) bool {
+	for _, allowed := range p.AllowedEnv {
+		if allowed == "*" || allowed == key {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionEnv builds the environment for a new session process
+func sessionEnv(extra map[string]string) []string {
+	env := append(os.Environ(), "TERM=xterm-256color")
+
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		env = append(env, key+"="+extra[key])
+	}
+	return env
+}
+
 // GetSession returns a session by ID
 func (m *Manager) GetSession(id string) (*Session, bool) {
 	m.mu.RLock()
@@ -165,19 +416,27 @@ func (m *Manager) CloseSession(id string) error {
 	
 	session.Close()
 	delete(m.sessions, id)
+	m.unlinkLocked(id)
+	m.forgetSession(id)
 	return nil
 }
 
-// ListSessions returns all active sessions
-func (m *Manager) ListSessions() []string {
+// ListSessions returns metadata for all active sessions
+func (m *Manager) ListSessions() []SessionInfo {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	
-	var ids []string
-	for id := range m.sessions {
-		ids = append(ids, id)
+	sessions := make([]SessionInfo, 0, len(m.sessions))
+	for id, session := range m.sessions {
+		info := session.Info()
+		info.Broadcast = m.broadcast[id]
+		sessions = append(sessions, info)
 	}
-	return ids
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+	return sessions
 }
 
 // Close closes all sessions
@@ -188,15 +447,9 @@ func (m *Manager) Close() {
 	for id, session := range m.sessions {
 		session.Close()
 		delete(m.sessions, id)
+		m.forgetSession(id)
 	}
-}
-
-// Read reads from the session
-func (s *Session) Read(p []byte) (int, error) {
-	if s.IsClosed() {
-		return 0, io.EOF
-	}
-	return s.Pty.Read(p)
+	m.broadcast = nil
 }
 
 // Write writes to the session
@@ -204,6 +457,7 @@ func (s *Session) Write(p []byte) (int, error) {
 	if s.IsClosed() {
 		return 0, io.EOF
 	}
+	s.touch()
 	return s.Pty.Write(p)
 }
 
@@ -217,6 +471,11 @@ func (s *Session) Close() error {
 	}
 	
 	s.closed = true
+
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
 	
 	if s.Cmd != nil && s.Cmd.Process != nil {
 		s.Cmd.Process.Kill()
@@ -0,0 +1,126 @@
+package terminal
+
+import (
+	"bufio"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Supported terminal multiplexers
+const (
+	MultiplexerTmux   = "tmux"
+	MultiplexerScreen = "screen"
+)
+
+// MultiplexerSession describes a tmux or screen session running on the host
+type MultiplexerSession struct {
+	Type     string    `json:"type"`
+	Name     string    `json:"name"`
+	Windows  int       `json:"windows,omitempty"`
+	Attached bool      `json:"attached"`
+	Created  time.Time `json:"created,omitempty"`
+}
+
+// ListMultiplexerSessions returns the tmux and screen sessions on the host
+func ListMultiplexerSessions() []MultiplexerSession {
+	var sessions []MultiplexerSession
+	sessions = append(sessions, listTmuxSessions()...)
+	sessions = append(sessions, listScreenSessions()...)
+	return sessions
+}
+
+// listTmuxSessions parses tmux list-sessions output
+func listTmuxSessions() []MultiplexerSession {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return nil
+	}
+
+	cmd := exec.Command("tmux", "list-sessions", "-F", "#{session_name}\t#{session_windows}\t#{session_attached}\t#{session_created}")
+	output, err := cmd.Output()
+	if err != nil {
+		// No server running
+		return nil
+	}
+
+	var sessions []MultiplexerSession
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			continue
+		}
+
+		session := MultiplexerSession{
+			Type: MultiplexerTmux,
+			Name: fields[0],
+		}
+		session.Windows, _ = strconv.Atoi(fields[1])
+		if attached, err := strconv.Atoi(fields[2]); err == nil {
+			session.Attached = attached > 0
+		}
+		if created, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			session.Created = time.Unix(created, 0)
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions
+}
+
+// listScreenSessions parses screen -ls output
+func listScreenSessions() []MultiplexerSession {
+	if _, err := exec.LookPath("screen"); err != nil {
+		return nil
+	}
+
+	// screen -ls exits non-zero even when sessions exist, only the output matters
+	output, _ := exec.Command("screen", "-ls").Output()
+
+	var sessions []MultiplexerSession
+	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "\t") {
+			continue
+		}
+
+		fields := strings.Split(strings.TrimSpace(line), "\t")
+		if len(fields) == 0 || fields[0] == "" {
+			continue
+		}
+
+		sessions = append(sessions, MultiplexerSession{
+			Type:     MultiplexerScreen,
+			Name:     fields[0],
+			Attached: strings.Contains(line, "(Attached)"),
+		})
+	}
+
+	return sessions
+}
+
+// multiplexerArgs returns the command used to attach to a multiplexer session.
+// Sessions are shared rather than stolen, so an SSH client stays attached too.
+func multiplexerArgs(kind, target string) ([]string, error) {
+	switch kind {
+	case MultiplexerTmux:
+		return []string{"tmux", "attach-session", "-t", target}, nil
+	case MultiplexerScreen:
+		return []string{"screen", "-x", target}, nil
+	default:
+		return nil, fmt.Errorf("unsupported multiplexer: %s", kind)
+	}
+}
+
+// findMultiplexerSession checks that a multiplexer session exists on the host
+func findMultiplexerSession(kind, target string) error {
+	for _, session := range ListMultiplexerSessions() {
+		if session.Type == kind && session.Name == target {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s session not found: %s", kind, target)
+}
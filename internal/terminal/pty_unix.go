@@ -3,21 +3,30 @@
 package terminal
 
 import (
-	"os"
 	"os/exec"
 
 	"github.com/creack/pty"
 )
 
 // newPlatformSession creates a new terminal session for Unix systems
-func newPlatformSession(id, shell string, cols, rows uint16) (*Session, error) {
-	cmd := exec.Command(shell)
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+func newPlatformSession(id string, opts SessionOptions) (*Session, error) {
+	cmd := exec.Command(opts.Shell)
+	if opts.Multiplexer != "" {
+		args, err := multiplexerArgs(opts.Multiplexer, opts.Target)
+		if err != nil {
+			return nil, err
+		}
+		cmd = exec.Command(args[0], args[1:]...)
+	} else if opts.Command != "" {
+		cmd = exec.Command(opts.Shell, "-c", opts.Command)
+	}
+	cmd.Env = sessionEnv(opts.Env)
+	cmd.Dir = opts.Dir
 
 	// Start the command with a pty
 	ptmx, err := pty.StartWithSize(cmd, &pty.Winsize{
-		Cols: cols,
-		Rows: rows,
+		Cols: opts.Cols,
+		Rows: opts.Rows,
 	})
 	if err != nil {
 		return nil, err
@@ -25,7 +34,8 @@ func newPlatformSession(id, shell string, cols, rows uint16) (*Session, error) {
 
 	session := &Session{
 		ID:    id,
-		Shell: shell,
+		Shell: opts.Shell,
+		PID:   cmd.Process.Pid,
 		Cmd:   cmd,
 		Pty:   ptmx,
 		OnResize: func(cols, rows uint16) error {
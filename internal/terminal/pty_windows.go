@@ -3,9 +3,11 @@
 package terminal
 
 import (
+	"fmt"
 	"io"
-	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 // pipeReadWriteCloser wraps stdin/stdout pipes
@@ -27,20 +29,67 @@ func (p *pipeReadWriteCloser) Close() error {
 	return p.stdout.Close()
 }
 
-// newPlatformSession creates a new terminal session for Windows
-func newPlatformSession(id, shell string, cols, rows uint16) (*Session, error) {
-	var cmd *exec.Cmd
-	
-	switch shell {
-	case "powershell":
-		cmd = exec.Command("powershell", "-NoLogo", "-NoProfile")
+// shellArgs returns the argument vector used to start a shell on Windows,
+// optionally running a startup command
+func shellArgs(shell, command string) []string {
+	// The shell may be given as a bare name or as a full path
+	name := strings.ToLower(strings.TrimSuffix(filepath.Base(shell), filepath.Ext(shell)))
+
+	switch name {
+	case "powershell", "pwsh":
+		if command != "" {
+			return []string{shell, "-NoLogo", "-NoProfile", "-Command", command}
+		}
+		return []string{shell, "-NoLogo", "-NoProfile"}
 	case "cmd":
-		cmd = exec.Command("cmd")
+		if command != "" {
+			return []string{shell, "/C", command}
+		}
+		return []string{shell}
 	default:
-		cmd = exec.Command(shell)
+		if command != "" {
+			return []string{shell, "-c", command}
+		}
+		return []string{shell}
+	}
+}
+
+// newPlatformSession creates a new terminal session for Windows.
+// A ConPTY pseudo console is used when available, falling back to plain pipes
+// on Windows versions older than 10 1809.
+func newPlatformSession(id string, opts SessionOptions) (*Session, error) {
+	if opts.Multiplexer != "" {
+		return nil, fmt.Errorf("%s sessions are not supported on Windows", opts.Multiplexer)
 	}
 
-	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	args := shellArgs(opts.Shell, opts.Command)
+	env := sessionEnv(opts.Env)
+
+	if isConPtyAvailable() {
+		cpty, err := startConPty(args, env, opts.Dir, opts.Cols, opts.Rows)
+		if err != nil {
+			return nil, err
+		}
+
+		session := &Session{
+			ID:       id,
+			Shell:    opts.Shell,
+			PID:      cpty.pid,
+			Pty:      cpty,
+			OnResize: cpty.Resize,
+		}
+
+		return session, nil
+	}
+
+	return newPipeSession(id, opts.Shell, args, env, opts.Dir)
+}
+
+// newPipeSession creates a session backed by stdin/stdout pipes
+func newPipeSession(id, shell string, args []string, env []string, dir string) (*Session, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Dir = dir
 
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -70,6 +119,7 @@ func newPlatformSession(id, shell string, cols, rows uint16) (*Session, error) {
 	session := &Session{
 		ID:    id,
 		Shell: shell,
+		PID:   cmd.Process.Pid,
 		Cmd:   cmd,
 		Pty:   pty,
 		OnResize: func(cols, rows uint16) error {
@@ -0,0 +1,177 @@
+package terminal
+
+import (
+	"time"
+)
+
+// listenerBuffer is the number of pending output chunks per attached client
+const listenerBuffer = 256
+
+// ringBuffer keeps the most recent bytes written to it, up to its capacity
+type ringBuffer struct {
+	data  []byte
+	start int
+	size  int
+}
+
+// newRingBuffer creates a ring buffer holding at most capacity bytes
+func newRingBuffer(capacity int) *ringBuffer {
+	return &ringBuffer{data: make([]byte, capacity)}
+}
+
+// Write appends p, discarding the oldest bytes when full
+func (r *ringBuffer) Write(p []byte) {
+	capacity := len(r.data)
+	if capacity == 0 {
+		return
+	}
+
+	// Only the tail of an oversized write can be kept
+	if len(p) >= capacity {
+		copy(r.data, p[len(p)-capacity:])
+		r.start = 0
+		r.size = capacity
+		return
+	}
+
+	end := (r.start + r.size) % capacity
+	n := copy(r.data[end:], p)
+	copy(r.data, p[n:])
+
+	r.size += len(p)
+	if r.size > capacity {
+		r.start = (r.start + r.size - capacity) % capacity
+		r.size = capacity
+	}
+}
+
+// Bytes returns a copy of the buffered bytes, oldest first
+func (r *ringBuffer) Bytes() []byte {
+	out := make([]byte, r.size)
+	n := copy(out, r.data[r.start:min(r.start+r.size, len(r.data))])
+	copy(out[n:], r.data[:r.size-n])
+	return out
+}
+
+// Attach subscribes to the session output. It returns the scrollback history,
+// a channel receiving subsequent output and a function to detach again.
+// The channel is closed when the session ends or the listener falls too far behind.
+func (s *Session) Attach() ([]byte, <-chan []byte, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ch := make(chan []byte, listenerBuffer)
+	if s.closed || s.done {
+		close(ch)
+		return nil, ch, func() {}
+	}
+
+	var history []byte
+	if s.scrollback != nil {
+		history = s.scrollback.Bytes()
+	}
+
+	s.listeners[ch] = struct{}{}
+	s.attached++
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+		s.detachTimer = nil
+	}
+
+	detach := func() {
+		s.mu.Lock()
+		if _, ok := s.listeners[ch]; ok {
+			delete(s.listeners, ch)
+			close(ch)
+		}
+		s.attached--
+		idle := s.attached == 0
+		s.mu.Unlock()
+
+		if idle && s.onIdle != nil {
+			s.onIdle(s)
+		}
+	}
+
+	return history, ch, detach
+}
+
+// Attached returns the number of clients attached to the session
+func (s *Session) Attached() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attached
+}
+
+// pump reads the PTY output, records it in the scrollback buffer and fans it
+// out to attached listeners until the PTY is closed
+func (s *Session) pump() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.Pty.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			s.broadcast(chunk)
+		}
+		if err != nil {
+			break
+		}
+	}
+
+	s.mu.Lock()
+	s.done = true
+	for ch := range s.listeners {
+		delete(s.listeners, ch)
+		close(ch)
+	}
+	s.mu.Unlock()
+
+	if s.onExit != nil {
+		s.onExit(s)
+	}
+}
+
+// broadcast stores a chunk of output and delivers it to all listeners
+func (s *Session) broadcast(chunk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.scrollback != nil {
+		s.scrollback.Write(chunk)
+	}
+
+	for ch := range s.listeners {
+		select {
+		case ch <- chunk:
+		default:
+			// Client is not keeping up, drop it rather than stall the PTY
+			delete(s.listeners, ch)
+			close(ch)
+		}
+	}
+}
+
+// scheduleClose closes the session after the detach timeout unless a client reattaches
+func (m *Manager) scheduleClose(s *Session) {
+	timeout := m.currentPolicy().DetachTimeout
+	if timeout <= 0 {
+		m.CloseSession(s.ID)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.attached > 0 || s.closed {
+		return
+	}
+	if s.detachTimer != nil {
+		s.detachTimer.Stop()
+	}
+	s.detachTimer = time.AfterFunc(timeout, func() {
+		if s.Attached() == 0 {
+			m.CloseSession(s.ID)
+		}
+	})
+}
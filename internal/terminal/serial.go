@@ -0,0 +1,109 @@
+package terminal
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+)
+
+// Serial parity modes
+const (
+	ParityNone = "none"
+	ParityEven = "even"
+	ParityOdd  = "odd"
+)
+
+// SerialOptions configures a serial console session
+type SerialOptions struct {
+	Device   string `json:"device"`
+	Baud     int    `json:"baud"`
+	DataBits int    `json:"data_bits"`
+	Parity   string `json:"parity"`
+	StopBits int    `json:"stop_bits"`
+}
+
+// withDefaults fills in the common 9600 8N1 settings for unset fields
+func (o SerialOptions) withDefaults() SerialOptions {
+	if o.Baud == 0 {
+		o.Baud = 9600
+	}
+	if o.DataBits == 0 {
+		o.DataBits = 8
+	}
+	if o.Parity == "" {
+		o.Parity = ParityNone
+	}
+	if o.StopBits == 0 {
+		o.StopBits = 1
+	}
+	return o
+}
+
+// validate checks the serial line settings
+func (o SerialOptions) validate() error {
+	if o.DataBits < 5 || o.DataBits > 8 {
+		return fmt.Errorf("invalid data bits: %d", o.DataBits)
+	}
+	if o.StopBits != 1 && o.StopBits != 2 {
+		return fmt.Errorf("invalid stop bits: %d", o.StopBits)
+	}
+	switch o.Parity {
+	case ParityNone, ParityEven, ParityOdd:
+	default:
+		return fmt.Errorf("invalid parity: %s", o.Parity)
+	}
+	return nil
+}
+
+// ListSerialDevices returns the serial devices matching the allowed patterns
+func (m *Manager) ListSerialDevices() []string {
+	seen := make(map[string]bool)
+	devices := []string{}
+
+	for _, pattern := range m.currentPolicy().SerialDevices {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			continue
+		}
+		for _, device := range matches {
+			if !seen[device] {
+				seen[device] = true
+				devices = append(devices, device)
+			}
+		}
+	}
+
+	sort.Strings(devices)
+	return devices
+}
+
+// isSerialDeviceAllowed checks a device path against the allowed patterns
+func (m *Manager) isSerialDeviceAllowed(device string) bool {
+	device = filepath.Clean(device)
+	for _, pattern := range m.currentPolicy().SerialDevices {
+		if matched, err := filepath.Match(pattern, device); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// newSerialSession opens a serial device and wraps it in a session
+func newSerialSession(id string, opts SerialOptions) (*Session, error) {
+	port, err := openSerialPort(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		ID:    id,
+		Shell: "serial:" + opts.Device,
+		Pty:   port,
+		OnResize: func(cols, rows uint16) error {
+			// Serial lines have no window size
+			return nil
+		},
+	}
+
+	return session, nil
+}
@@ -0,0 +1,114 @@
+//go:build linux
+
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// baudRates maps supported line speeds to their termios constants
+var baudRates = map[int]uint32{
+	1200:    unix.B1200,
+	2400:    unix.B2400,
+	4800:    unix.B4800,
+	9600:    unix.B9600,
+	19200:   unix.B19200,
+	38400:   unix.B38400,
+	57600:   unix.B57600,
+	115200:  unix.B115200,
+	230400:  unix.B230400,
+	460800:  unix.B460800,
+	921600:  unix.B921600,
+	1000000: unix.B1000000,
+	1500000: unix.B1500000,
+	2000000: unix.B2000000,
+	3000000: unix.B3000000,
+	4000000: unix.B4000000,
+}
+
+// openSerialPort opens a tty device in raw mode with the given line settings
+func openSerialPort(opts SerialOptions) (io.ReadWriteCloser, error) {
+	speed, ok := baudRates[opts.Baud]
+	if !ok {
+		return nil, fmt.Errorf("unsupported baud rate: %d", opts.Baud)
+	}
+
+	file, err := os.OpenFile(opts.Device, os.O_RDWR|unix.O_NOCTTY|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open serial device: %w", err)
+	}
+
+	// Configure through the raw conn so the file stays in non-blocking mode
+	// and Close can interrupt a pending Read
+	rawConn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	var configErr error
+	err = rawConn.Control(func(fd uintptr) {
+		configErr = configureSerial(int(fd), speed, opts)
+	})
+	if err == nil {
+		err = configErr
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// configureSerial puts the tty in raw mode with the given line settings
+func configureSerial(fd int, speed uint32, opts SerialOptions) error {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return fmt.Errorf("not a serial device: %w", err)
+	}
+
+	// Raw mode, equivalent to cfmakeraw
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Oflag &^= unix.OPOST
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+
+	termios.Cflag &^= unix.CBAUD | unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB
+	termios.Cflag |= speed | unix.CREAD | unix.CLOCAL
+
+	switch opts.DataBits {
+	case 5:
+		termios.Cflag |= unix.CS5
+	case 6:
+		termios.Cflag |= unix.CS6
+	case 7:
+		termios.Cflag |= unix.CS7
+	default:
+		termios.Cflag |= unix.CS8
+	}
+
+	switch opts.Parity {
+	case ParityEven:
+		termios.Cflag |= unix.PARENB
+	case ParityOdd:
+		termios.Cflag |= unix.PARENB | unix.PARODD
+	}
+
+	if opts.StopBits == 2 {
+		termios.Cflag |= unix.CSTOPB
+	}
+
+	termios.Ispeed = speed
+	termios.Ospeed = speed
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err := unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return fmt.Errorf("failed to configure serial device: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package terminal
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// openSerialPort is not implemented on this platform
+func openSerialPort(opts SerialOptions) (io.ReadWriteCloser, error) {
+	return nil, fmt.Errorf("serial sessions are not supported on %s", runtime.GOOS)
+}
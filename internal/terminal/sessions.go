@@ -0,0 +1,117 @@
+package terminal
+
+import (
+	"log"
+	"time"
+
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// persistInterval limits how often last-active updates are written to storage
+const persistInterval = 30 * time.Second
+
+// SessionInfo describes an active terminal session
+type SessionInfo struct {
+	ID         string    `json:"id"`
+	Shell      string    `json:"shell"`
+	PID        int       `json:"pid"`
+	Owner      string    `json:"owner"`
+	ClientIP   string    `json:"client_ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastActive time.Time `json:"last_active"`
+	Broadcast  bool      `json:"broadcast"`
+}
+
+// Info returns the session metadata
+func (s *Session) Info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return SessionInfo{
+		ID:         s.ID,
+		Shell:      s.Shell,
+		PID:        s.PID,
+		Owner:      s.Owner,
+		ClientIP:   s.ClientIP,
+		CreatedAt:  s.CreatedAt,
+		LastActive: s.lastActive,
+	}
+}
+
+// LastActive returns the time of the last input on the session
+func (s *Session) LastActive() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastActive
+}
+
+// touch records activity on the session, persisting it at most once per interval
+func (s *Session) touch() {
+	s.mu.Lock()
+	now := time.Now()
+	s.lastActive = now
+	persist := s.onActivity != nil && now.Sub(s.lastPersist) >= persistInterval
+	s.mu.Unlock()
+
+	if persist {
+		s.onActivity(s)
+	}
+}
+
+// persistSession writes the session metadata to storage
+func (m *Manager) persistSession(s *Session) {
+	if m.storage == nil {
+		return
+	}
+
+	info := s.Info()
+	entry := storage.TerminalSession{
+		ID:         info.ID,
+		Shell:      info.Shell,
+		PID:        info.PID,
+		Owner:      info.Owner,
+		ClientIP:   info.ClientIP,
+		CreatedAt:  info.CreatedAt,
+		LastActive: info.LastActive,
+	}
+	if err := m.storage.SetJSON(storage.BucketTerminalSessions, info.ID, entry); err != nil {
+		log.Printf("Failed to persist terminal session %s: %v", info.ID, err)
+		return
+	}
+
+	s.mu.Lock()
+	s.lastPersist = time.Now()
+	s.mu.Unlock()
+}
+
+// forgetSession removes the session metadata from storage
+func (m *Manager) forgetSession(id string) {
+	if m.storage == nil {
+		return
+	}
+	if err := m.storage.Delete(storage.BucketTerminalSessions, id); err != nil {
+		log.Printf("Failed to remove terminal session %s: %v", id, err)
+	}
+}
+
+// reconcileStored removes stored sessions that are not backed by a live PTY
+func (m *Manager) reconcileStored() {
+	stored, err := m.storage.GetAll(storage.BucketTerminalSessions)
+	if err != nil {
+		log.Printf("Failed to load terminal sessions: %v", err)
+		return
+	}
+
+	stale := 0
+	for id := range stored {
+		if _, ok := m.sessions[id]; ok {
+			continue
+		}
+		m.forgetSession(id)
+		stale++
+	}
+
+	if stale > 0 {
+		log.Printf("Removed %d stale terminal sessions", stale)
+	}
+}
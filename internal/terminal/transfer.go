@@ -0,0 +1,100 @@
+package terminal
+
+import (
+	"bytes"
+)
+
+// File transfer protocols recognised in the PTY output
+const (
+	ProtocolZmodem = "zmodem"
+	ProtocolTrzsz  = "trzsz"
+)
+
+// Transfer directions, seen from the browser
+const (
+	TransferUpload   = "upload"
+	TransferDownload = "download"
+)
+
+// TransferEvent is emitted when a file transfer starts in the PTY stream
+type TransferEvent struct {
+	Protocol  string `json:"protocol"`
+	Direction string `json:"direction"`
+}
+
+// transferSignature maps an escape sequence to the transfer it announces
+type transferSignature struct {
+	prefix    []byte
+	protocol  string
+	direction string
+}
+
+var transferSignatures = []transferSignature{
+	// ZRQINIT, sent by sz when it wants to send files
+	{[]byte("**\x18B00"), ProtocolZmodem, TransferDownload},
+	// ZRINIT, sent by rz when it is ready to receive files
+	{[]byte("**\x18B01"), ProtocolZmodem, TransferUpload},
+	// trzsz magic key, followed by the mode: R (trz), D (trz -d) or S (tsz)
+	{[]byte("::TRZSZ:TRANSFER:R:"), ProtocolTrzsz, TransferUpload},
+	{[]byte("::TRZSZ:TRANSFER:D:"), ProtocolTrzsz, TransferUpload},
+	{[]byte("::TRZSZ:TRANSFER:S:"), ProtocolTrzsz, TransferDownload},
+}
+
+// maxSignatureLen is the length of the longest transfer signature
+var maxSignatureLen = func() int {
+	n := 0
+	for _, sig := range transferSignatures {
+		if len(sig.prefix) > n {
+			n = len(sig.prefix)
+		}
+	}
+	return n
+}()
+
+// TransferDetector scans PTY output for file transfer escape sequences.
+// It keeps the tail of the previous chunk so sequences split across reads are found.
+type TransferDetector struct {
+	tail []byte
+}
+
+// NewTransferDetector creates a new transfer detector
+func NewTransferDetector() *TransferDetector {
+	return &TransferDetector{}
+}
+
+// Scan looks for a transfer start in the next chunk of output
+func (d *TransferDetector) Scan(p []byte) *TransferEvent {
+	data := append(d.tail, p...)
+
+	var event *TransferEvent
+	for _, sig := range transferSignatures {
+		if bytes.Contains(data, sig.prefix) {
+			event = &TransferEvent{Protocol: sig.protocol, Direction: sig.direction}
+			break
+		}
+	}
+
+	// Keep just enough to match a signature spanning the next chunk
+	keep := maxSignatureLen - 1
+	if event != nil {
+		keep = 0
+	}
+	if len(data) < keep {
+		keep = len(data)
+	}
+	d.tail = append(d.tail[:0], data[len(data)-keep:]...)
+
+	return event
+}
+
+// CancelSequence returns the bytes that abort a transfer for the given protocol
+func CancelSequence(protocol string) []byte {
+	switch protocol {
+	case ProtocolZmodem:
+		// Eight CAN characters followed by eight backspaces
+		return append(bytes.Repeat([]byte{0x18}, 8), bytes.Repeat([]byte{0x08}, 8)...)
+	default:
+		// trzsz clients stop on interrupt
+		return []byte{0x03}
+	}
+}
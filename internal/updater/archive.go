@@ -0,0 +1,142 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+)
+
+// binaryName is the name of the server executable inside release archives
+const binaryName = "nebula"
+
+// maxBinarySize bounds the size of a downloaded or extracted binary
+const maxBinarySize = 512 << 20
+
+// isArchive reports whether an asset is an archive rather than a raw binary
+func isArchive(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".zip")
+}
+
+// isPackage reports whether an asset is a system package, which the updater does not install
+func isPackage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".deb", ".rpm", ".apk", ".msi", ".pkg", ".dmg":
+		return true
+	}
+	return false
+}
+
+// extractBinary returns the server executable from a release archive. It is
+// the file named nebula (nebula.exe on Windows) or, failing that, the only
+// executable in the archive.
+func extractBinary(name string, data []byte) ([]byte, error) {
+	want := binaryName
+	if runtime.GOOS == "windows" {
+		want += ".exe"
+	}
+
+	var (
+		found       []byte
+		executables [][]byte
+	)
+	visit := func(file string, executable bool, r io.Reader) error {
+		base := path.Base(file)
+		if base != want && !executable {
+			return nil
+		}
+
+		content, err := io.ReadAll(io.LimitReader(r, maxBinarySize+1))
+		if err != nil {
+			return err
+		}
+		if len(content) > maxBinarySize {
+			return fmt.Errorf("%s exceeds %d bytes", file, maxBinarySize)
+		}
+
+		if base == want {
+			found = content
+		} else {
+			executables = append(executables, content)
+		}
+		return nil
+	}
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(name), ".zip") {
+		err = walkZip(data, visit)
+	} else {
+		err = walkTarGz(data, visit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+
+	switch {
+	case found != nil:
+		return found, nil
+	case len(executables) == 1:
+		return executables[0], nil
+	default:
+		return nil, fmt.Errorf("%s does not contain a %s binary", name, want)
+	}
+}
+
+// walkTarGz calls visit for every regular file of a gzipped tarball
+func walkTarGz(data []byte, visit func(name string, executable bool, r io.Reader) error) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := visit(hdr.Name, hdr.Mode&0111 != 0, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// walkZip calls visit for every regular file of a zip archive. Windows
+// binaries carry no executable bit, so .exe files count as executables.
+func walkZip(data []byte, visit func(name string, executable bool, r io.Reader) error) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		executable := f.Mode()&0111 != 0 || strings.HasSuffix(strings.ToLower(f.Name), ".exe")
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = visit(f.Name, executable, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package updater
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Release channels, from the most to the least conservative
+const (
+	ChannelStable  = "stable"
+	ChannelBeta    = "beta"
+	ChannelNightly = "nightly"
+)
+
+// Channels lists the supported release channels
+var Channels = []string{ChannelStable, ChannelBeta, ChannelNightly}
+
+// inChannel reports whether a release may be installed from channel.
+// Stable only takes full releases, beta also takes prereleases except
+// nightly builds, and nightly takes everything that is not a draft.
+func inChannel(release ReleaseInfo, channel string) bool {
+	if release.Draft {
+		return false
+	}
+
+	nightly := strings.Contains(strings.ToLower(release.TagName), "nightly")
+	prerelease := release.Prerelease || nightly || strings.Contains(release.TagName, "-")
+
+	switch channel {
+	case ChannelNightly:
+		return true
+	case ChannelBeta:
+		return !nightly
+	default:
+		return !prerelease
+	}
+}
+
+// compareVersions compares two semantic versions, with or without the v
+// prefix, returning -1, 0 or 1. A prerelease sorts before its release.
+func compareVersions(a, b string) int {
+	a, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	b, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+
+	if c := compareIdentifiers(strings.Split(a, "."), strings.Split(b, ".")); c != 0 {
+		return c
+	}
+
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	return compareIdentifiers(strings.Split(preA, "."), strings.Split(preB, "."))
+}
+
+// compareIdentifiers compares dot separated identifiers, numerically when both are numbers
+func compareIdentifiers(a, b []string) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		na, errA := strconv.Atoi(a[i])
+		nb, errB := strconv.Atoi(b[i])
+
+		var c int
+		switch {
+		case errA == nil && errB == nil:
+			c = compareInts(na, nb)
+		case errA == nil:
+			c = -1
+		case errB == nil:
+			c = 1
+		default:
+			c = strings.Compare(a[i], b[i])
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(a), len(b))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
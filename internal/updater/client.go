@@ -0,0 +1,122 @@
+package updater
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiTimeout bounds GitHub API requests
+const apiTimeout = 30 * time.Second
+
+// downloadTimeout bounds the time to download a release artifact
+const downloadTimeout = 10 * time.Minute
+
+// ParseProxy parses a proxy URL. Supported schemes are http, https and socks5.
+func ParseProxy(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy URL %q, expected http, https or socks5", proxy)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q, missing host", proxy)
+	}
+	return u, nil
+}
+
+// httpClient returns a client going through the configured proxy, or the
+// proxy from HTTPS_PROXY/HTTP_PROXY/NO_PROXY when none is configured
+func (u *Updater) httpClient(timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxy := u.getSettings().Proxy; proxy != "" {
+		proxyURL, err := ParseProxy(proxy)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// isGitHub reports whether the GitHub token may be sent to host. Downloads
+// redirected to other hosts never receive it, the client drops the
+// Authorization header on cross-host redirects.
+func isGitHub(host string) bool {
+	return host == "api.github.com" || host == "github.com"
+}
+
+// get performs a GET request, authenticated with the GitHub token when set
+func (u *Updater) get(rawURL, accept string, timeout time.Duration) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if token := u.getSettings().GitHubToken; token != "" && isGitHub(req.URL.Host) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	client, err := u.httpClient(timeout)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// fetchAsset downloads a release asset into memory, failing if it is larger
+// than max bytes. With a token the API URL is used so private repositories
+// work. With progress set, the bytes downloaded are reported in Status.
+func (u *Updater) fetchAsset(asset *Asset, max int64, progress bool) ([]byte, error) {
+	rawURL, accept := asset.BrowserDownloadURL, ""
+	if u.getSettings().GitHubToken != "" && asset.URL != "" {
+		rawURL, accept = asset.URL, "application/octet-stream"
+	}
+
+	resp, err := u.get(rawURL, accept, downloadTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var body io.Reader = resp.Body
+	if progress {
+		total := resp.ContentLength
+		if total <= 0 {
+			total = asset.Size
+		}
+		body = &progressReader{r: resp.Body, u: u, total: total}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, fmt.Errorf("%s exceeds %d bytes", asset.Name, max)
+	}
+	return data, nil
+}
+
+// apiError returns the error of a failed GitHub API response, pointing at
+// the token when the rate limit is exhausted
+func apiError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0" {
+		return fmt.Errorf("GitHub API rate limit exceeded, updater.github_token raises the limit")
+	}
+	return fmt.Errorf("GitHub API error: %s", strings.TrimSpace(string(body)))
+}
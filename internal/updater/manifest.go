@@ -0,0 +1,120 @@
+package updater
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxManifestSize bounds the size of an update manifest
+const maxManifestSize = 4 << 20
+
+// Manifest lists the releases published on an update server. A manifest
+// holding a single release may also put its fields at the top level.
+type Manifest struct {
+	Releases []ManifestRelease `json:"releases"`
+	ManifestRelease
+}
+
+// ManifestRelease describes a release in an update manifest
+type ManifestRelease struct {
+	Version     string          `json:"version"`
+	Prerelease  bool            `json:"prerelease"`
+	PublishedAt time.Time       `json:"published_at"`
+	Notes       string          `json:"notes"`
+	URL         string          `json:"url"`
+	Assets      []ManifestAsset `json:"assets"`
+}
+
+// ManifestAsset is a downloadable artifact of a release. Relative URLs are
+// resolved against the manifest URL.
+type ManifestAsset struct {
+	Name         string `json:"name"`
+	URL          string `json:"url"`
+	SHA256       string `json:"sha256"`
+	SignatureURL string `json:"signature_url"`
+}
+
+// ParseManifestURL checks the URL of an update manifest
+func ParseManifestURL(manifestURL string) (*url.URL, error) {
+	u, err := url.Parse(manifestURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid manifest URL %q, expected an http or https URL", manifestURL)
+	}
+	return u, nil
+}
+
+// getManifestReleases fetches the releases listed in an update manifest,
+// converted to the same form as GitHub releases
+func (u *Updater) getManifestReleases(manifestURL string) ([]ReleaseInfo, error) {
+	base, err := ParseManifestURL(manifestURL)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := u.get(manifestURL, "application/json", apiTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch update manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch update manifest: status %d", resp.StatusCode)
+	}
+
+	var manifest Manifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode update manifest: %w", err)
+	}
+
+	entries := manifest.Releases
+	if len(entries) == 0 && manifest.Version != "" {
+		entries = []ManifestRelease{manifest.ManifestRelease}
+	}
+
+	releases := make([]ReleaseInfo, 0, len(entries))
+	for _, entry := range entries {
+		release := ReleaseInfo{
+			TagName:     entry.Version,
+			Name:        entry.Version,
+			Body:        entry.Notes,
+			HTMLURL:     resolveURL(base, entry.URL),
+			PublishedAt: entry.PublishedAt,
+			Prerelease:  entry.Prerelease,
+		}
+		for _, asset := range entry.Assets {
+			release.Assets = append(release.Assets, Asset{
+				Name:               asset.Name,
+				BrowserDownloadURL: resolveURL(base, asset.URL),
+				SHA256:             asset.SHA256,
+			})
+			if asset.SignatureURL != "" {
+				release.Assets = append(release.Assets, Asset{
+					Name:               asset.Name + ".minisig",
+					BrowserDownloadURL: resolveURL(base, asset.SignatureURL),
+				})
+			}
+		}
+		releases = append(releases, release)
+	}
+
+	return releases, nil
+}
+
+// resolveURL resolves ref against the manifest URL
+func resolveURL(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return base.ResolveReference(r).String()
+}
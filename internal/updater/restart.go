@@ -0,0 +1,22 @@
+package updater
+
+import (
+	"log"
+	"os"
+)
+
+// restartExitCode is the exit status used to ask a supervisor for a restart
+const restartExitCode = 3
+
+// supervisorRestart reports whether NEBULA_RESTART=exit asks to leave the
+// restart to an external supervisor (e.g. a Windows service wrapper or a
+// container runtime) that restarts the process when it exits
+func supervisorRestart() bool {
+	return os.Getenv("NEBULA_RESTART") == "exit"
+}
+
+// exitForRestart exits with a failure status so the supervisor starts the new binary
+func exitForRestart() {
+	log.Printf("Exiting with status %d to be restarted by the supervisor", restartExitCode)
+	os.Exit(restartExitCode)
+}
@@ -0,0 +1,83 @@
+//go:build !windows
+
+package updater
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// restart runs the new binary. Under systemd or launchd the service manager
+// is asked to restart the unit so it keeps its view of the service,
+// otherwise executable is exec'd in place of the current process.
+func restart(executable string) error {
+	if supervisorRestart() {
+		exitForRestart()
+	}
+
+	if unit := systemdUnit(); unit != "" {
+		// --no-block returns before systemd stops us
+		err := exec.Command("systemctl", "--no-block", "restart", unit).Run()
+		if err == nil {
+			log.Printf("Restart of %s requested from systemd", unit)
+			return nil
+		}
+		log.Printf("systemctl restart %s failed, restarting in place: %v", unit, err)
+	}
+
+	if target := launchdTarget(); target != "" {
+		// kickstart -k kills this instance and starts the job again
+		err := exec.Command("launchctl", "kickstart", "-k", target).Start()
+		if err == nil {
+			log.Printf("Restart of %s requested from launchd", target)
+			return nil
+		}
+		log.Printf("launchctl kickstart %s failed, restarting in place: %v", target, err)
+	}
+
+	return syscall.Exec(executable, os.Args, os.Environ())
+}
+
+// systemdUnit returns the unit the process runs in when started by systemd
+// as a service, read from its cgroup
+func systemdUnit() string {
+	if runtime.GOOS != "linux" || os.Getenv("INVOCATION_ID") == "" {
+		return ""
+	}
+
+	f, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// e.g. 0::/system.slice/nebula.service
+		parts := strings.Split(scanner.Text(), "/")
+		for i := len(parts) - 1; i >= 0; i-- {
+			if strings.HasSuffix(parts[i], ".service") {
+				return parts[i]
+			}
+		}
+	}
+	return ""
+}
+
+// launchdTarget returns the service target of the launchd job running the process
+func launchdTarget() string {
+	label := os.Getenv("XPC_SERVICE_NAME")
+	if runtime.GOOS != "darwin" || label == "" || label == "0" {
+		return ""
+	}
+	if os.Getuid() == 0 {
+		return "system/" + label
+	}
+	return fmt.Sprintf("gui/%d/%s", os.Getuid(), label)
+}
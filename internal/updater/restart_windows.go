@@ -0,0 +1,86 @@
+//go:build windows
+
+package updater
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// restart runs the new binary. When running as a Windows service the
+// service is restarted through the service manager, otherwise a detached
+// relauncher starts executable again once the current process has exited.
+func restart(executable string) error {
+	if supervisorRestart() {
+		exitForRestart()
+	}
+
+	if isService, err := svc.IsWindowsService(); err == nil && isService {
+		name, err := serviceName()
+		if err == nil {
+			log.Printf("Restart of service %s requested", name)
+			return relaunch(fmt.Sprintf("Start-Sleep -Seconds 2; Restart-Service -Name %s -Force", quotePS(name)))
+		}
+		log.Printf("Failed to find the service name, restarting the process: %v", err)
+	}
+
+	script := "Start-Sleep -Seconds 2; Start-Process -FilePath " + quotePS(executable)
+	if len(os.Args) > 1 {
+		args := make([]string, 0, len(os.Args)-1)
+		for _, arg := range os.Args[1:] {
+			args = append(args, quotePS(arg))
+		}
+		script += " -ArgumentList " + strings.Join(args, ",")
+	}
+	return relaunch(script)
+}
+
+// relaunch starts a detached PowerShell script and exits. The delay in the
+// scripts gives the server time to release its port and database.
+func relaunch(script string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", script)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
+
+// serviceName finds the service whose process is the current one
+func serviceName() (string, error) {
+	m, err := mgr.Connect()
+	if err != nil {
+		return "", err
+	}
+	defer m.Disconnect()
+
+	names, err := m.ListServices()
+	if err != nil {
+		return "", err
+	}
+
+	pid := uint32(os.Getpid())
+	for _, name := range names {
+		s, err := m.OpenService(name)
+		if err != nil {
+			continue
+		}
+		status, err := s.Query()
+		s.Close()
+		if err == nil && status.ProcessId == pid {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no service runs process %d", pid)
+}
+
+// quotePS quotes a string for PowerShell
+func quotePS(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
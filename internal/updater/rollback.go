@@ -0,0 +1,174 @@
+package updater
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/minio/selfupdate"
+)
+
+// previousDir is the directory next to the executable holding replaced versions
+const previousDir = ".nebula-previous"
+
+// SavedVersion is a replaced binary kept on disk for rollbacks
+type SavedVersion struct {
+	Version string    `json:"version"`
+	SavedAt time.Time `json:"saved_at"`
+	Size    int64     `json:"size"`
+}
+
+// versionsDir returns the directory holding replaced versions of the running executable
+func versionsDir() (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	return filepath.Join(filepath.Dir(executable), previousDir), nil
+}
+
+// savedName returns the file name a version is kept under
+func savedName(version string) string {
+	name := binaryName + "-" + strings.TrimPrefix(version, "v")
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// oldSavePath returns where Apply keeps the binary it replaces, creating the
+// directory. It returns an empty path when no versions are kept.
+func (u *Updater) oldSavePath() (string, error) {
+	if u.getSettings().KeepVersions <= 0 {
+		return "", nil
+	}
+
+	dir, err := versionsDir()
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	return filepath.Join(dir, savedName(u.currentVer)), nil
+}
+
+// Versions lists the replaced binaries available for a rollback, newest first
+func (u *Updater) Versions() ([]SavedVersion, error) {
+	dir, err := versionsDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []SavedVersion{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []SavedVersion{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".exe")
+		if entry.IsDir() || !strings.HasPrefix(name, binaryName+"-") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, SavedVersion{
+			Version: strings.TrimPrefix(name, binaryName+"-"),
+			SavedAt: info.ModTime(),
+			Size:    info.Size(),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].SavedAt.After(versions[j].SavedAt) })
+	return versions, nil
+}
+
+// pruneVersions removes all but the newest keep saved versions
+func (u *Updater) pruneVersions(keep int) {
+	versions, err := u.Versions()
+	if err != nil || len(versions) <= keep {
+		return
+	}
+
+	dir, err := versionsDir()
+	if err != nil {
+		return
+	}
+	for _, v := range versions[keep:] {
+		os.Remove(filepath.Join(dir, savedName(v.Version)))
+	}
+}
+
+// Rollback replaces the running executable with a saved version, the newest
+// one when version is empty. The saved copy is removed once restored, and
+// the server must be restarted to run it.
+func (u *Updater) Rollback(version string) (string, error) {
+	u.applyMu.Lock()
+	defer u.applyMu.Unlock()
+
+	u.begin(version, "")
+	target, err := u.rollback(version)
+	return target, u.finish(err)
+}
+
+func (u *Updater) rollback(version string) (string, error) {
+	versions, err := u.Versions()
+	if err != nil {
+		return "", err
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no previous version available")
+	}
+
+	target := versions[0].Version
+	if version != "" {
+		target = strings.TrimPrefix(version, "v")
+		found := false
+		for _, v := range versions {
+			found = found || v.Version == target
+		}
+		if !found {
+			return "", fmt.Errorf("version %s is not available", version)
+		}
+	}
+
+	dir, err := versionsDir()
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, savedName(target))
+	u.setStatus(func(s *Status) {
+		s.Phase = PhaseApplying
+		s.Version = target
+		s.Asset = savedName(target)
+	})
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	err = selfupdate.Apply(f, selfupdate.Options{})
+	f.Close()
+	if err != nil {
+		if rerr := selfupdate.RollbackError(err); rerr != nil {
+			return "", fmt.Errorf("failed to restore the current version after a failed rollback: %w", rerr)
+		}
+		return "", fmt.Errorf("failed to roll back to %s: %w", target, err)
+	}
+
+	os.Remove(path)
+	return target, nil
+}
@@ -0,0 +1,200 @@
+package updater
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/nebula/nebula/internal/storage"
+)
+
+// scheduleTick is how often the scheduler wakes up to check the interval and the maintenance window
+const scheduleTick = time.Minute
+
+// Window is a daily maintenance window in local time, optionally limited to some weekdays
+type Window struct {
+	Start time.Duration // offset from midnight
+	End   time.Duration
+	Days  []time.Weekday // empty means every day
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// ParseWindow parses a maintenance window such as "02:00-04:00" or
+// "sat,sun 22:00-02:00". A window may span midnight. An empty string
+// returns nil, meaning updates may be applied at any time.
+func ParseWindow(s string) (*Window, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var w Window
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		for _, day := range strings.Split(fields[0], ",") {
+			wd, ok := weekdays[strings.ToLower(day)[:min(3, len(day))]]
+			if !ok {
+				return nil, fmt.Errorf("invalid weekday %q", day)
+			}
+			w.Days = append(w.Days, wd)
+		}
+	default:
+		return nil, fmt.Errorf("invalid maintenance window %q", s)
+	}
+
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid maintenance window %q, expected HH:MM-HH:MM", s)
+	}
+	var err error
+	if w.Start, err = parseClock(start); err != nil {
+		return nil, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return nil, err
+	}
+	if w.Start == w.End {
+		return nil, fmt.Errorf("maintenance window %q is empty", s)
+	}
+	return &w, nil
+}
+
+// parseClock parses HH:MM into an offset from midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Contains reports whether t falls inside the window. The weekday of a window
+// spanning midnight is the day it starts on.
+func (w *Window) Contains(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	day := t.Weekday()
+
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End && w.onDay(day)
+	}
+	if offset >= w.Start {
+		return w.onDay(day)
+	}
+	if offset < w.End {
+		return w.onDay((day + 6) % 7)
+	}
+	return false
+}
+
+func (w *Window) onDay(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Start checks for updates every check interval until ctx is cancelled.
+// With auto apply enabled, an available update is installed inside the
+// maintenance window and the server restarted. Outcomes are recorded in the
+// audit log of store, which may be nil.
+func (u *Updater) Start(ctx context.Context, store *storage.Storage) {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+
+	var lastCheck time.Time
+	var pending *UpdateInfo
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			settings := u.getSettings()
+			if !settings.Enabled {
+				pending = nil
+				continue
+			}
+
+			if now.Sub(lastCheck) >= settings.CheckInterval {
+				lastCheck = now
+				info, err := u.CheckForUpdate()
+				if err != nil {
+					log.Printf("Update check failed: %v", err)
+					continue
+				}
+				pending = nil
+				if info.Available {
+					log.Printf("Update available: %s (current %s)", info.LatestVer, info.CurrentVer)
+					pending = &info
+				}
+			}
+
+			if pending == nil || !settings.AutoApply {
+				continue
+			}
+
+			window, err := ParseWindow(settings.MaintenanceWindow)
+			if err != nil {
+				log.Printf("Automatic update skipped: %v", err)
+				continue
+			}
+			if !window.Contains(now) {
+				continue
+			}
+
+			info := *pending
+			pending = nil
+			if err := u.Apply(); err != nil {
+				log.Printf("Automatic update to %s failed: %v", info.LatestVer, err)
+				recordUpdate(store, fmt.Sprintf("update from %s to %s failed: %v", info.CurrentVer, info.LatestVer, err))
+				continue
+			}
+
+			log.Printf("Updated from %s to %s, restarting", info.CurrentVer, info.LatestVer)
+			recordUpdate(store, fmt.Sprintf("updated from %s to %s", info.CurrentVer, info.LatestVer))
+			if err := u.Restart(); err != nil {
+				log.Printf("Restart after update failed: %v", err)
+			}
+		}
+	}
+}
+
+// recordUpdate writes the outcome of an automatic update to the audit log
+func recordUpdate(store *storage.Storage, details string) {
+	if store == nil {
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	entry := storage.AuditEntry{
+		ID:        hex.EncodeToString(id),
+		Timestamp: time.Now(),
+		Action:    "UPDATE",
+		Resource:  "updater",
+		Details:   details,
+		User:      "system",
+	}
+	if err := store.AddAuditLog(entry); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
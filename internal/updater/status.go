@@ -0,0 +1,127 @@
+package updater
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Phases of an update or rollback, reported in Status
+const (
+	PhaseIdle        = "idle"
+	PhasePreparing   = "preparing"
+	PhaseDownloading = "downloading"
+	PhaseVerifying   = "verifying"
+	PhaseExtracting  = "extracting"
+	PhaseApplying    = "applying"
+	PhaseDone        = "done"
+	PhaseFailed      = "failed"
+)
+
+// progressInterval throttles download progress events
+const progressInterval = 250 * time.Millisecond
+
+// Status reports the progress of the running or last update
+type Status struct {
+	Phase      string    `json:"phase"`
+	Version    string    `json:"version,omitempty"`
+	Asset      string    `json:"asset,omitempty"`
+	BytesDone  int64     `json:"bytes_done"`
+	BytesTotal int64     `json:"bytes_total"`
+	Percent    float64   `json:"percent"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"started_at,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at,omitempty"`
+}
+
+// statusState holds the update status and notifies listeners of changes
+type statusState struct {
+	mu        sync.Mutex
+	status    Status
+	listeners []func(Status)
+}
+
+// Status returns the progress of the running or last update
+func (u *Updater) Status() Status {
+	u.status.mu.Lock()
+	defer u.status.mu.Unlock()
+	if u.status.status.Phase == "" {
+		return Status{Phase: PhaseIdle}
+	}
+	return u.status.status
+}
+
+// OnStatus registers a callback for every status change, e.g. to push
+// progress to WebSocket clients. Callbacks must not block.
+func (u *Updater) OnStatus(fn func(Status)) {
+	u.status.mu.Lock()
+	defer u.status.mu.Unlock()
+	u.status.listeners = append(u.status.listeners, fn)
+}
+
+// begin starts reporting a new update or rollback
+func (u *Updater) begin(version, asset string) {
+	now := time.Now()
+	u.setStatus(func(s *Status) {
+		*s = Status{Phase: PhasePreparing, Version: version, Asset: asset, StartedAt: now}
+	})
+}
+
+// setPhase moves the running update to phase
+func (u *Updater) setPhase(phase string) {
+	u.setStatus(func(s *Status) { s.Phase = phase })
+}
+
+// finish reports the outcome of the running update and returns err
+func (u *Updater) finish(err error) error {
+	u.setStatus(func(s *Status) {
+		if err != nil {
+			s.Phase = PhaseFailed
+			s.Error = err.Error()
+			return
+		}
+		s.Phase = PhaseDone
+	})
+	return err
+}
+
+// setStatus applies change to the status and notifies the listeners
+func (u *Updater) setStatus(change func(*Status)) {
+	u.status.mu.Lock()
+	change(&u.status.status)
+	u.status.status.UpdatedAt = time.Now()
+	status := u.status.status
+	listeners := u.status.listeners
+	u.status.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(status)
+	}
+}
+
+// progressReader reports the bytes read from a download
+type progressReader struct {
+	r        io.Reader
+	u        *Updater
+	done     int64
+	total    int64
+	reported time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+
+	if now := time.Now(); err != nil || now.Sub(p.reported) >= progressInterval {
+		p.reported = now
+		done, total := p.done, p.total
+		p.u.setStatus(func(s *Status) {
+			s.BytesDone = done
+			s.BytesTotal = total
+			if total > 0 {
+				s.Percent = float64(min(done, total)) * 100 / float64(total)
+			}
+		})
+	}
+	return n, err
+}
@@ -1,13 +1,16 @@
 package updater
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/minio/selfupdate"
@@ -19,20 +22,31 @@ var Version = "0.0.2"
 // GitHubRepo is the official repository (hardcoded, not configurable)
 const GitHubRepo = "niosz/nebula"
 
+// ErrNoUpdate is returned by Apply when the latest release of the channel
+// isn't newer than the running version, e.g. after switching from beta to
+// stable. Older versions are restored with Rollback.
+var ErrNoUpdate = errors.New("no newer release available")
+
 // ReleaseInfo contains release information
 type ReleaseInfo struct {
 	TagName     string    `json:"tag_name"`
 	Name        string    `json:"name"`
 	Body        string    `json:"body"`
+	HTMLURL     string    `json:"html_url"`
 	PublishedAt time.Time `json:"published_at"`
+	Prerelease  bool      `json:"prerelease"`
+	Draft       bool      `json:"draft"`
 	Assets      []Asset   `json:"assets"`
 }
 
 // Asset represents a release asset
 type Asset struct {
 	Name               string `json:"name"`
+	URL                string `json:"url"`
 	BrowserDownloadURL string `json:"browser_download_url"`
 	Size               int64  `json:"size"`
+	// SHA256 is the checksum given by an update manifest, GitHub assets publish it as a separate file
+	SHA256 string `json:"sha256,omitempty"`
 }
 
 // UpdateInfo contains update information
@@ -43,26 +57,112 @@ type UpdateInfo struct {
 	ReleaseDate time.Time `json:"release_date"`
 	ReleaseURL  string    `json:"release_url"`
 	Changelog   string    `json:"changelog"`
+	Channel     string    `json:"channel"`
+}
+
+// Settings controls when and how the updater looks for new releases
+type Settings struct {
+	Enabled       bool
+	CheckInterval time.Duration
+	// Channel is the release channel to follow, stable when empty
+	Channel string
+	// AutoApply installs available updates from the scheduler
+	AutoApply bool
+	// MaintenanceWindow limits automatic updates, see ParseWindow
+	MaintenanceWindow string
+	// Proxy is the URL of the proxy for GitHub requests, the environment is used when empty
+	Proxy string
+	// GitHubToken authenticates GitHub requests, raising the rate limit and
+	// giving access to private repositories
+	GitHubToken string
+	// ManifestURL points to an update manifest used instead of GitHub releases
+	ManifestURL string
+	// KeepVersions is the number of replaced binaries kept for rollbacks
+	KeepVersions int
 }
 
 // Updater handles self-updates
 type Updater struct {
 	currentVer    string
-	enabled       bool
-	checkInterval time.Duration
+	settings      Settings
+	mu            sync.RWMutex
 	lastCheck     time.Time
 	latestRelease *ReleaseInfo
+
+	// applyMu serializes updates and rollbacks
+	applyMu       sync.Mutex
+	beforeRestart []func()
+	status        statusState
+
+	// announced is the last version reported to onAvailable
+	announced   string
+	onAvailable []func(UpdateInfo)
 }
 
 // NewUpdater creates a new updater
-func NewUpdater(enabled bool, checkInterval time.Duration) *Updater {
+func NewUpdater(settings Settings) *Updater {
 	return &Updater{
-		currentVer:    Version,
-		enabled:       enabled,
-		checkInterval: checkInterval,
+		currentVer: Version,
+		settings:   settings,
 	}
 }
 
+// Configure replaces the updater settings, taking effect from the next check
+func (u *Updater) Configure(settings Settings) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if settings.Channel != u.settings.Channel {
+		// The cached release may not belong to the new channel
+		u.latestRelease = nil
+	}
+	u.settings = settings
+}
+
+// OnAvailable registers a callback for update checks finding a newer
+// version, called once per version. Callbacks must not block.
+func (u *Updater) OnAvailable(fn func(UpdateInfo)) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.onAvailable = append(u.onAvailable, fn)
+}
+
+// announce reports an available update to the OnAvailable callbacks, unless
+// its version was already reported
+func (u *Updater) announce(info UpdateInfo) {
+	u.mu.Lock()
+	if u.announced == info.LatestVer {
+		u.mu.Unlock()
+		return
+	}
+	u.announced = info.LatestVer
+	listeners := u.onAvailable
+	u.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(info)
+	}
+}
+
+// getSettings returns the current settings
+func (u *Updater) getSettings() Settings {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.settings
+}
+
+// isEnabled reports whether updates are enabled
+func (u *Updater) isEnabled() bool {
+	return u.getSettings().Enabled
+}
+
+// getChannel returns the release channel being followed
+func (u *Updater) getChannel() string {
+	if channel := u.getSettings().Channel; channel != "" {
+		return channel
+	}
+	return ChannelStable
+}
+
 // GetGitHubRepo returns the hardcoded GitHub repository
 func GetGitHubRepo() string {
 	return GitHubRepo
@@ -73,69 +173,133 @@ func (u *Updater) CheckForUpdate() (UpdateInfo, error) {
 	info := UpdateInfo{
 		CurrentVer: u.currentVer,
 		Available:  false,
+		Channel:    u.getChannel(),
 	}
 
-	if !u.enabled {
+	if !u.isEnabled() {
 		return info, nil
 	}
 
-	release, err := u.getLatestRelease()
+	release, err := u.getLatestRelease(info.Channel)
 	if err != nil {
 		return info, err
 	}
 
+	u.mu.Lock()
 	u.latestRelease = release
 	u.lastCheck = time.Now()
+	u.mu.Unlock()
 
 	info.LatestVer = release.TagName
 	info.ReleaseDate = release.PublishedAt
 	info.Changelog = release.Body
-	info.ReleaseURL = fmt.Sprintf("https://github.com/%s/releases/tag/%s", GitHubRepo, release.TagName)
+	info.ReleaseURL = release.HTMLURL
+	if info.ReleaseURL == "" && u.getSettings().ManifestURL == "" {
+		info.ReleaseURL = fmt.Sprintf("https://github.com/%s/releases/tag/%s", GitHubRepo, release.TagName)
+	}
 
 	// Compare versions
 	if u.isNewerVersion(release.TagName, u.currentVer) {
 		info.Available = true
+		u.announce(info)
 	}
 
 	return info, nil
 }
 
-// Apply applies the update
+// Apply applies the update, reporting its progress in Status
 func (u *Updater) Apply() error {
-	if !u.enabled {
+	u.applyMu.Lock()
+	defer u.applyMu.Unlock()
+
+	u.begin("", "")
+	return u.finish(u.apply())
+}
+
+// getRelease returns the release found by the last check, nil before any
+func (u *Updater) getRelease() *ReleaseInfo {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return u.latestRelease
+}
+
+func (u *Updater) apply() error {
+	if !u.isEnabled() {
 		return fmt.Errorf("updater is disabled")
 	}
 
-	if u.latestRelease == nil {
+	// Work on one release throughout, checks running meanwhile may replace
+	// the cached one
+	release := u.getRelease()
+	if release == nil {
 		// Check for update first
 		_, err := u.CheckForUpdate()
 		if err != nil {
 			return err
 		}
+		release = u.getRelease()
 	}
 
-	if u.latestRelease == nil {
+	if release == nil {
 		return fmt.Errorf("no release information available")
 	}
+	if !u.isNewerVersion(release.TagName, u.currentVer) {
+		return fmt.Errorf("%w: latest %s release is %s, running %s", ErrNoUpdate, u.getChannel(), release.TagName, u.currentVer)
+	}
 
 	// Find the appropriate asset for this platform
-	asset := u.findAsset()
+	asset := findAsset(release)
 	if asset == nil {
 		return fmt.Errorf("no suitable binary found for %s/%s", runtime.GOOS, runtime.GOARCH)
 	}
 
-	// Download and apply update
-	resp, err := http.Get(asset.BrowserDownloadURL)
+	u.setStatus(func(s *Status) {
+		s.Version = release.TagName
+		s.Asset = asset.Name
+		s.BytesTotal = asset.Size
+	})
+
+	// Refuse artifacts without a valid checksum and signature
+	checksum, err := u.checksumFor(release, asset)
+	if err != nil {
+		return err
+	}
+	signature, err := u.signatureFor(release, asset)
+	if err != nil {
+		return err
+	}
+
+	// Download the artifact and verify it before unpacking anything
+	u.setPhase(PhaseDownloading)
+	data, err := u.fetchAsset(asset, maxBinarySize, true)
 	if err != nil {
 		return fmt.Errorf("failed to download update: %w", err)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download update: status %d", resp.StatusCode)
+	u.setPhase(PhaseVerifying)
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], checksum) {
+		return fmt.Errorf("checksum mismatch for %s: expected %x, got %x", asset.Name, checksum, sum)
+	}
+	if err := verifySignature(data, signature); err != nil {
+		return fmt.Errorf("invalid signature for %s: %w", asset.Name, err)
+	}
+
+	binary := data
+	if isArchive(asset.Name) {
+		u.setPhase(PhaseExtracting)
+		if binary, err = extractBinary(asset.Name, data); err != nil {
+			return err
+		}
 	}
 
-	err = selfupdate.Apply(resp.Body, selfupdate.Options{})
+	// Keep the replaced binary for rollbacks
+	oldSavePath, err := u.oldSavePath()
+	if err != nil {
+		return err
+	}
+
+	u.setPhase(PhaseApplying)
+	err = selfupdate.Apply(bytes.NewReader(binary), selfupdate.Options{OldSavePath: oldSavePath})
 	if err != nil {
 		if rerr := selfupdate.RollbackError(err); rerr != nil {
 			return fmt.Errorf("failed to rollback after failed update: %w", rerr)
@@ -143,42 +307,68 @@ func (u *Updater) Apply() error {
 		return fmt.Errorf("failed to apply update: %w", err)
 	}
 
+	if keep := u.getSettings().KeepVersions; keep > 0 {
+		u.pruneVersions(keep)
+	}
 	return nil
 }
 
-// getLatestRelease fetches the latest release from GitHub
-func (u *Updater) getLatestRelease() (*ReleaseInfo, error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/releases/latest", GitHubRepo)
-
-	req, err := http.NewRequest("GET", url, nil)
+// getLatestRelease fetches the newest release of a channel, from the update
+// manifest when one is configured and from GitHub otherwise
+func (u *Updater) getLatestRelease(channel string) (*ReleaseInfo, error) {
+	var (
+		releases []ReleaseInfo
+		err      error
+	)
+	if manifestURL := u.getSettings().ManifestURL; manifestURL != "" {
+		releases, err = u.getManifestReleases(manifestURL)
+	} else {
+		releases, err = u.getGitHubReleases()
+	}
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	var latest *ReleaseInfo
+	for i := range releases {
+		if !inChannel(releases[i], channel) {
+			continue
+		}
+		if latest == nil || compareVersions(releases[i].TagName, latest.TagName) > 0 {
+			latest = &releases[i]
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("no %s release found", channel)
+	}
+
+	return latest, nil
+}
+
+// getGitHubReleases fetches the recent releases of the GitHub repository
+func (u *Updater) getGitHubReleases() ([]ReleaseInfo, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=50", GitHubRepo)
+
+	resp, err := u.get(url, "application/vnd.github.v3+json", apiTimeout)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch release: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("GitHub API error: %s", string(body))
+		return nil, apiError(resp)
 	}
 
-	var release ReleaseInfo
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+	var releases []ReleaseInfo
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
 		return nil, fmt.Errorf("failed to decode release: %w", err)
 	}
-
-	return &release, nil
+	return releases, nil
 }
 
-// findAsset finds the appropriate asset for this platform
-func (u *Updater) findAsset() *Asset {
-	if u.latestRelease == nil {
+// findAsset finds the appropriate asset of release for this platform
+func findAsset(release *ReleaseInfo) *Asset {
+	if release == nil {
 		return nil
 	}
 
@@ -186,11 +376,11 @@ func (u *Updater) findAsset() *Asset {
 	arch := runtime.GOARCH
 
 	// Try to find exact match
-	for _, asset := range u.latestRelease.Assets {
+	for _, asset := range release.Assets {
 		name := strings.ToLower(asset.Name)
 		
-		// Skip checksums and signatures
-		if strings.HasSuffix(name, ".sha256") || strings.HasSuffix(name, ".sig") {
+		// Skip checksums, signatures and system packages
+		if isCompanion(name) || isPackage(name) {
 			continue
 		}
 
@@ -214,28 +404,13 @@ func (u *Updater) findAsset() *Asset {
 
 // isNewerVersion compares version strings
 func (u *Updater) isNewerVersion(new, current string) bool {
-	// Remove 'v' prefix
-	new = strings.TrimPrefix(new, "v")
-	current = strings.TrimPrefix(current, "v")
-
 	// Handle dev version
+	current = strings.TrimPrefix(current, "v")
 	if current == "dev" || current == "" {
 		return true
 	}
 
-	// Simple string comparison for semver
-	newParts := strings.Split(new, ".")
-	currentParts := strings.Split(current, ".")
-
-	for i := 0; i < len(newParts) && i < len(currentParts); i++ {
-		if newParts[i] > currentParts[i] {
-			return true
-		} else if newParts[i] < currentParts[i] {
-			return false
-		}
-	}
-
-	return len(newParts) > len(currentParts)
+	return compareVersions(new, current) > 0
 }
 
 // GetVersion returns the current version
@@ -243,29 +418,28 @@ func (u *Updater) GetVersion() string {
 	return u.currentVer
 }
 
-// Restart restarts the application
+// BeforeRestart registers a callback run before the process is restarted,
+// e.g. to flush pending writes
+func (u *Updater) BeforeRestart(fn func()) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.beforeRestart = append(u.beforeRestart, fn)
+}
+
+// Restart replaces the running process with the executable on disk, which
+// is the new version after a successful Apply or Rollback
 func (u *Updater) Restart() error {
 	executable, err := os.Executable()
 	if err != nil {
 		return err
 	}
 
-	// On Unix, we can exec the new binary
-	// On Windows, we need to start a new process
-	if runtime.GOOS == "windows" {
-		cmd := fmt.Sprintf("Start-Sleep -Seconds 2; Start-Process '%s'", executable)
-		return runPowerShell(cmd)
+	u.mu.RLock()
+	hooks := u.beforeRestart
+	u.mu.RUnlock()
+	for _, fn := range hooks {
+		fn()
 	}
 
-	return syscallExec(executable, os.Args, os.Environ())
-}
-
-// runPowerShell runs a PowerShell command (Windows only)
-func runPowerShell(cmd string) error {
-	return nil // Stub for cross-compilation
-}
-
-// syscallExec executes a new process (Unix only)
-func syscallExec(argv0 string, argv []string, envv []string) error {
-	return nil // Stub for cross-compilation
+	return restart(executable)
 }
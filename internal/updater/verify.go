@@ -0,0 +1,126 @@
+package updater
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"aead.dev/minisign"
+)
+
+// PublicKey is the minisign public key release artifacts are signed with, set at build time:
+//
+//	go build -ldflags "-X github.com/nebula/nebula/internal/updater.PublicKey=RWQ..."
+//
+// Updates are refused when it is empty.
+var PublicKey = ""
+
+// checksumFiles are release-wide checksum lists, used when an asset has no .sha256 file
+var checksumFiles = []string{"checksums.txt", "SHA256SUMS", "sha256sums.txt"}
+
+// maxChecksumSize bounds the size of downloaded checksum and signature files
+const maxChecksumSize = 1 << 20
+
+// isCompanion reports whether an asset is a checksum or signature rather than an artifact
+func isCompanion(name string) bool {
+	name = strings.ToLower(name)
+	for _, suffix := range []string{".sha256", ".sig", ".minisig"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	for _, file := range checksumFiles {
+		if name == strings.ToLower(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// findReleaseAsset returns the asset of release with the given name
+func findReleaseAsset(release *ReleaseInfo, name string) *Asset {
+	for i := range release.Assets {
+		if release.Assets[i].Name == name {
+			return &release.Assets[i]
+		}
+	}
+	return nil
+}
+
+// checksumFor returns the SHA-256 checksum published for an artifact, either
+// in the update manifest, in <artifact>.sha256 or in a release-wide checksum list
+func (u *Updater) checksumFor(release *ReleaseInfo, artifact *Asset) ([]byte, error) {
+	if artifact.SHA256 != "" {
+		return hex.DecodeString(artifact.SHA256)
+	}
+
+	if asset := findReleaseAsset(release, artifact.Name+".sha256"); asset != nil {
+		data, err := u.fetchAsset(asset, maxChecksumSize, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to download checksum: %w", err)
+		}
+		return parseChecksum(data, artifact.Name)
+	}
+
+	for _, file := range checksumFiles {
+		if asset := findReleaseAsset(release, file); asset != nil {
+			data, err := u.fetchAsset(asset, maxChecksumSize, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download checksums: %w", err)
+			}
+			return parseChecksum(data, artifact.Name)
+		}
+	}
+
+	return nil, fmt.Errorf("release has no checksum for %s", artifact.Name)
+}
+
+// parseChecksum finds the checksum of name in sha256sum output. A file
+// holding a single checksum without a file name is accepted as well.
+func parseChecksum(data []byte, name string) ([]byte, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 1:
+			return hex.DecodeString(fields[0])
+		case len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == name:
+			return hex.DecodeString(fields[0])
+		}
+	}
+	return nil, fmt.Errorf("no checksum found for %s", name)
+}
+
+// signatureFor downloads the minisign signature of an artifact, published
+// as <artifact>.minisig or <artifact>.sig
+func (u *Updater) signatureFor(release *ReleaseInfo, artifact *Asset) ([]byte, error) {
+	if PublicKey == "" {
+		return nil, fmt.Errorf("this build has no update signing key, refusing to apply unsigned updates")
+	}
+
+	for _, suffix := range []string{".minisig", ".sig"} {
+		if asset := findReleaseAsset(release, artifact.Name+suffix); asset != nil {
+			signature, err := u.fetchAsset(asset, maxChecksumSize, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download signature: %w", err)
+			}
+			return signature, nil
+		}
+	}
+
+	return nil, fmt.Errorf("release has no signature for %s", artifact.Name)
+}
+
+// verifySignature checks data against a minisign signature made with PublicKey
+func verifySignature(data, signature []byte) error {
+	var key minisign.PublicKey
+	if err := key.UnmarshalText([]byte(PublicKey)); err != nil {
+		return fmt.Errorf("invalid update signing key: %w", err)
+	}
+	if !minisign.Verify(key, data, signature) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms of the credentials Nebula accepts
+const (
+	algES256 = -7
+	algES384 = -35
+	algES512 = -36
+	algEdDSA = -8
+	algRS256 = -257
+)
+
+// COSE key types and parameters
+const (
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	coseKty = 1
+	coseAlg = 3
+	// Curve of EC2 and OKP keys, modulus of RSA keys
+	coseCrv = -1
+	// X coordinate of EC2 and OKP keys, exponent of RSA keys
+	coseX = -2
+	coseY = -3
+
+	crvP256    = 1
+	crvP384    = 2
+	crvP521    = 3
+	crvEd25519 = 6
+)
+
+// supportedAlgorithms are offered to authenticators, most preferred first
+var supportedAlgorithms = []int64{algES256, algEdDSA, algES384, algES512, algRS256}
+
+// coseKey is a decoded COSE_Key
+type coseKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parseCOSEKey decodes a COSE_Key credential public key
+func parseCOSEKey(data []byte) (*coseKey, error) {
+	item, _, err := decodeCBOR(data)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("public key is not a COSE key")
+	}
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+	bytesParam := func(label int64) []byte {
+		b, _ := m[label].([]byte)
+		return b
+	}
+
+	switch kty {
+	case ktyEC2:
+		crv, _ := m[int64(coseCrv)].(int64)
+		curves := map[int64]struct {
+			curve elliptic.Curve
+			alg   int64
+		}{
+			crvP256: {elliptic.P256(), algES256},
+			crvP384: {elliptic.P384(), algES384},
+			crvP521: {elliptic.P521(), algES512},
+		}
+		c, ok := curves[crv]
+		if !ok || c.alg != alg {
+			return nil, fmt.Errorf("unsupported EC2 key, curve %d algorithm %d", crv, alg)
+		}
+		x, y := new(big.Int).SetBytes(bytesParam(coseX)), new(big.Int).SetBytes(bytesParam(coseY))
+		if !c.curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("EC2 key is not on its curve")
+		}
+		return &coseKey{alg: alg, key: &ecdsa.PublicKey{Curve: c.curve, X: x, Y: y}}, nil
+	case ktyOKP:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x := bytesParam(coseX)
+		if crv != crvEd25519 || alg != algEdDSA || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported OKP key, curve %d algorithm %d", crv, alg)
+		}
+		return &coseKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case ktyRSA:
+		n, e := bytesParam(coseCrv), bytesParam(coseX)
+		if alg != algRS256 || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("unsupported RSA key, algorithm %d", alg)
+		}
+		return &coseKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %d", kty)
+}
+
+// verify checks the signature of data made with the key
+func (k *coseKey) verify(data, signature []byte) error {
+	var ok bool
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		var digest []byte
+		switch k.alg {
+		case algES256:
+			h := sha256.Sum256(data)
+			digest = h[:]
+		case algES384:
+			h := sha512.Sum384(data)
+			digest = h[:]
+		case algES512:
+			h := sha512.Sum512(data)
+			digest = h[:]
+		}
+		ok = ecdsa.VerifyASN1(key, digest, signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		h := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(key, crypto.SHA256, h[:], signature) == nil
+	}
+	if !ok {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
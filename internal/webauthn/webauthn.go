@@ -0,0 +1,341 @@
+// Package webauthn implements the relying party side of WebAuthn, enough
+// for users to register passkeys and log in with them. Authenticators are
+// asked for no attestation, so any of them is accepted.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Timeout is how long the browser waits for the user to touch their
+// authenticator
+const Timeout = 5 * time.Minute
+
+// Flags of the authenticator data
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// Settings identify the relying party, the Nebula site credentials are
+// bound to
+type Settings struct {
+	// RPID is the domain of the site, e.g. nebula.example.com
+	RPID   string
+	RPName string
+	// Origins are the URLs the browser may show, e.g. https://nebula.example.com:8080
+	Origins []string
+}
+
+// Credential is a registered public key credential
+type Credential struct {
+	ID []byte
+	// PublicKey is the COSE_Key of the credential
+	PublicKey []byte
+	SignCount uint32
+}
+
+// RelyingParty identifies the site in the creation options
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// User identifies the user in the creation options
+type User struct {
+	// ID is base64url encoded
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialParameter is an accepted credential algorithm
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+// CredentialDescriptor names a credential, base64url encoded
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// AuthenticatorSelection states what authenticators may be used
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are the options of navigator.credentials.create, with
+// binary values base64url encoded
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   User                   `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions are the options of navigator.credentials.get, with
+// binary values base64url encoded
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	RPID             string                 `json:"rpId"`
+	Timeout          int64                  `json:"timeout"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// NewChallenge returns a random base64url challenge
+func NewChallenge() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Encode encodes binary values the way the options and the API carry them
+func Encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Decode decodes a base64url value, padded or not
+func Decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(trimPadding(s))
+}
+
+// trimPadding drops the padding some encoders add
+func trimPadding(s string) string {
+	for len(s) > 0 && s[len(s)-1] == '=' {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// CreationOptions returns the options registering a credential of
+// username, excluding the credentials they already have
+func (s Settings) CreationOptions(challenge, username string, exclude [][]byte) CreationOptions {
+	// The user handle must not reveal the username, so it is derived from it
+	handle := sha256.Sum256([]byte("nebula user " + username))
+	opts := CreationOptions{
+		Challenge:          challenge,
+		RP:                 RelyingParty{ID: s.RPID, Name: s.RPName},
+		User:               User{ID: Encode(handle[:16]), Name: username, DisplayName: username},
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}
+	for _, alg := range supportedAlgorithms {
+		opts.PubKeyCredParams = append(opts.PubKeyCredParams, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+	return opts
+}
+
+// RequestOptions returns the options of a login with one of allow, or
+// with any discoverable credential when allow is empty
+func (s Settings) RequestOptions(challenge string, allow [][]byte) RequestOptions {
+	return RequestOptions{
+		Challenge:        challenge,
+		RPID:             s.RPID,
+		Timeout:          Timeout.Milliseconds(),
+		AllowCredentials: descriptors(allow),
+		UserVerification: "required",
+	}
+}
+
+// descriptors names credentials in options
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: Encode(id)})
+	}
+	return list
+}
+
+// clientData is the part of clientDataJSON the relying party checks
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// Challenge returns the challenge signed in clientDataJSON, which names
+// the ceremony a response answers
+func Challenge(clientDataJSON []byte) (string, error) {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return "", fmt.Errorf("invalid client data: %w", err)
+	}
+	if data.Challenge == "" {
+		return "", fmt.Errorf("client data has no challenge")
+	}
+	return trimPadding(data.Challenge), nil
+}
+
+// checkClientData checks that clientDataJSON answers challenge with a
+// ceremony of typ made on one of the origins
+func (s Settings) checkClientData(clientDataJSON []byte, typ, challenge string) error {
+	var data clientData
+	if err := json.Unmarshal(clientDataJSON, &data); err != nil {
+		return fmt.Errorf("invalid client data: %w", err)
+	}
+	if data.Type != typ {
+		return fmt.Errorf("unexpected ceremony %q", data.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(trimPadding(data.Challenge)), []byte(challenge)) != 1 {
+		return fmt.Errorf("challenge mismatch")
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("cross-origin ceremonies are not allowed")
+	}
+	for _, origin := range s.Origins {
+		if data.Origin == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("origin %q not allowed", data.Origin)
+}
+
+// authenticatorData is the decoded authenticator data
+type authenticatorData struct {
+	rpIDHash  []byte
+	flags     byte
+	signCount uint32
+	// Present only on registration
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthenticatorData decodes the authenticator data, with the attested
+// credential data it carries on registration
+func parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("authenticator data too short")
+	}
+	ad := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+	if ad.flags&flagAttestedData == 0 {
+		return ad, nil
+	}
+
+	// AAGUID, then the length of the credential ID, the ID and the key
+	rest := data[37:]
+	if len(rest) < 18 {
+		return nil, fmt.Errorf("attested credential data too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if idLen == 0 || idLen > 1023 || len(rest) < idLen {
+		return nil, fmt.Errorf("invalid credential ID")
+	}
+	ad.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+	_, after, err := decodeCBOR(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	ad.publicKey = rest[:len(rest)-len(after)]
+	return ad, nil
+}
+
+// checkAuthenticatorData checks that the authenticator data is bound to
+// the relying party and that the user was verified
+func (s Settings) checkAuthenticatorData(ad *authenticatorData) error {
+	hash := sha256.Sum256([]byte(s.RPID))
+	if !bytes.Equal(ad.rpIDHash, hash[:]) {
+		return fmt.Errorf("credential of another site")
+	}
+	if ad.flags&flagUserPresent == 0 {
+		return fmt.Errorf("user not present")
+	}
+	if ad.flags&flagUserVerified == 0 {
+		return fmt.Errorf("user not verified")
+	}
+	return nil
+}
+
+// VerifyRegistration checks the response of navigator.credentials.create
+// to challenge and returns the new credential
+func (s Settings) VerifyRegistration(challenge string, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := s.checkClientData(clientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	item, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid attestation object")
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("attestation object has no authenticator data")
+	}
+
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkAuthenticatorData(ad); err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, fmt.Errorf("no credential was created")
+	}
+	if _, err := parseCOSEKey(ad.publicKey); err != nil {
+		return nil, err
+	}
+	return &Credential{ID: ad.credentialID, PublicKey: ad.publicKey, SignCount: ad.signCount}, nil
+}
+
+// VerifyAssertion checks the response of navigator.credentials.get to
+// challenge, signed with credential, and returns its new signature counter
+func (s Settings) VerifyAssertion(challenge string, credential Credential, clientDataJSON, authData, signature []byte) (uint32, error) {
+	if err := s.checkClientData(clientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+	ad, err := parseAuthenticatorData(authData)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.checkAuthenticatorData(ad); err != nil {
+		return 0, err
+	}
+
+	key, err := parseCOSEKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(clientDataJSON)
+	if err := key.verify(append(append([]byte(nil), authData...), clientHash[:]...), signature); err != nil {
+		return 0, err
+	}
+
+	// Authenticators without a counter always send 0, others must increase it
+	if (ad.signCount != 0 || credential.SignCount != 0) && ad.signCount <= credential.SignCount {
+		return 0, fmt.Errorf("signature counter went back, the authenticator may be cloned")
+	}
+	return ad.signCount, nil
+}
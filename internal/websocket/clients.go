@@ -0,0 +1,135 @@
+package websocket
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transports clients are connected with
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"
+)
+
+// ClientInfo describes a connected client
+type ClientInfo struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	User        string    `json:"user"`
+	RemoteIP    string    `json:"remote_ip"`
+	Transport   string    `json:"transport"`
+	Topics      []string  `json:"topics"`
+	ConnectedAt time.Time `json:"connected_at"`
+	Queued      int       `json:"queued"`
+	Dropped     uint64    `json:"dropped"`
+	Coalesced   uint64    `json:"coalesced"`
+}
+
+// newClientID returns a random identifier for a connection
+func newClientID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ID returns the unique identifier of the connection
+func (c *Client) ID() string {
+	return c.id
+}
+
+// Info describes the client
+func (c *Client) Info() ClientInfo {
+	transport := TransportWebSocket
+	if c.conn == nil {
+		transport = TransportSSE
+	}
+	topics := c.Subscriptions()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientInfo{
+		ID:          c.id,
+		Name:        c.info.Name,
+		User:        c.info.User,
+		RemoteIP:    c.info.RemoteIP,
+		Transport:   transport,
+		Topics:      topics,
+		ConnectedAt: c.since,
+		Queued:      len(c.queue),
+		Dropped:     c.dropped,
+		Coalesced:   c.coalesced,
+	}
+}
+
+// Clients describes the connected clients, oldest connection first
+func (h *Hub) Clients() []ClientInfo {
+	h.mu.RLock()
+	clients := make([]ClientInfo, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client.Info())
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].ConnectedAt.Before(clients[j].ConnectedAt)
+	})
+	return clients
+}
+
+// SendToClient sends a message to a single client whatever its
+// subscriptions, reporting false when no client has that ID
+func (h *Hub) SendToClient(id, msgType string, payload interface{}) bool {
+	return h.sendTo(func(c *Client) bool { return c.id == id }, msgType, "", payload) > 0
+}
+
+// SendToUser sends an event to every session of a user whatever their
+// subscriptions and returns the number of clients it was sent to
+func (h *Hub) SendToUser(user, msgType, event string, payload interface{}) int {
+	return h.sendTo(func(c *Client) bool { return c.info.User == user }, msgType, event, payload)
+}
+
+// sendTo queues a message, not numbered nor kept for replays, for the clients
+// matching target
+func (h *Hub) sendTo(target func(*Client) bool, msgType, event string, payload interface{}) int {
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return 0
+	}
+	data, err := json.Marshal(Message{Type: msgType, Event: event, Payload: payloadData})
+	if err != nil {
+		log.Printf("Failed to marshal message: %v", err)
+		return 0
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	sent := 0
+	for client := range h.clients {
+		if target(client) {
+			client.enqueue(frame{data: data})
+			sent++
+		}
+	}
+	return sent
+}
+
+// Disconnect closes the connection of a client, reporting false when no
+// client has that ID
+func (h *Hub) Disconnect(id, reason string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for client := range h.clients {
+		if client.id == id {
+			client.closeWith(websocket.ClosePolicyViolation, reason)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package websocket
+
+import (
+	"compress/flate"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// DefaultCompressionLevel favours speed, metrics frames compress well even at level 1
+const DefaultCompressionLevel = flate.BestSpeed
+
+// compression holds the permessage-deflate settings for new connections
+var compression = struct {
+	sync.RWMutex
+	enabled bool
+	level   int
+}{enabled: true, level: DefaultCompressionLevel}
+
+// SetCompression configures permessage-deflate for connections opened from
+// now on. Compression is only used when the client negotiates it.
+func SetCompression(enabled bool, level int) error {
+	if err := ValidateCompressionLevel(level); err != nil {
+		return err
+	}
+
+	compression.Lock()
+	defer compression.Unlock()
+	compression.enabled = enabled
+	compression.level = level
+	return nil
+}
+
+// ValidateCompressionLevel checks a flate compression level
+func ValidateCompressionLevel(level int) error {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return fmt.Errorf("compression level must be between %d and %d", flate.HuffmanOnly, flate.BestCompression)
+	}
+	return nil
+}
+
+// upgrade upgrades an HTTP connection, negotiating compression when enabled
+func upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, error) {
+	compression.RLock()
+	enabled, level := compression.enabled, compression.level
+	compression.RUnlock()
+
+	u := upgrader
+	u.EnableCompression = enabled
+	conn, err := u.Upgrade(w, r, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if enabled {
+		conn.SetCompressionLevel(level)
+	}
+	return conn, nil
+}
@@ -0,0 +1,72 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// FollowFunc starts following a stream, calling send with its events, and
+// returns the function stopping it
+type FollowFunc func(send func(event string, payload interface{})) (func(), error)
+
+// HandleFollow serves a connection receiving the events of one stream,
+// like the lines appended to a file, as messages of the files topic with
+// the event set. Messages of the client are ignored, the stream ends when
+// it disconnects.
+func HandleFollow(w http.ResponseWriter, r *http.Request, follow FollowFunc) {
+	conn, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	out := make(chan []byte, 1024)
+	done := make(chan struct{})
+	var overflow atomic.Bool
+	send := func(msgType, event string, payload interface{}) {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return
+		}
+		msg, _ := json.Marshal(Message{Type: msgType, Event: event, Payload: data})
+		select {
+		case out <- msg:
+		case <-done:
+		default:
+			overflow.Store(true)
+		}
+	}
+	defer func() {
+		close(done)
+		conn.Close()
+	}()
+
+	// Events sent before the writer starts wait in out
+	stop, err := follow(func(event string, payload interface{}) {
+		send(TopicFiles, event, payload)
+	})
+	if err != nil {
+		payload, _ := json.Marshal(map[string]string{"error": err.Error()})
+		msg, _ := json.Marshal(Message{Type: typeError, Payload: payload})
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		conn.WriteMessage(websocket.TextMessage, msg)
+		return
+	}
+	defer stop()
+	go writeWatch(conn, out, done, &overflow)
+
+	conn.SetReadLimit(64 * 1024)
+	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
@@ -13,14 +14,17 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
+	CheckOrigin:     sameOrigin,
 }
 
 // Message represents a WebSocket message
 type Message struct {
-	Type    string          `json:"type"`
+	Type string `json:"type"`
+	// Seq numbers broadcast messages in the order they were sent, clients
+	// reconnect with resume set to the last one they received
+	Seq uint64 `json:"seq,omitempty"`
+	// Event names what happened for messages forwarded from the event bus
+	Event   string          `json:"event,omitempty"`
 	Payload json.RawMessage `json:"payload,omitempty"`
 }
 
@@ -28,95 +32,233 @@ type Message struct {
 type Client struct {
 	hub      *Hub
 	conn     *websocket.Conn
-	send     chan []byte
 	id       string
+	info     ConnectOptions
+	since    time.Time
 	mu       sync.Mutex
 	closed   bool
+	topics   map[string]bool
+	resume   uint64
+
+	// Messages waiting for the write pump, which notify wakes up
+	queue     []frame
+	notify    chan struct{}
+	policy    ClientPolicy
+	dropped   uint64
+	coalesced uint64
+
+	// Close frame sent once the queue is written
+	closeCode   int
+	closeReason string
 }
 
 // Hub maintains the set of active clients and broadcasts messages
 type Hub struct {
 	clients    map[*Client]bool
-	broadcast  chan []byte
+	broadcast  chan Message
 	register   chan *Client
 	unregister chan *Client
 	mu         sync.RWMutex
+	policy     ClientPolicy
+	stats      queueStats
+	traffic    trafficStats
+
+	// seq and history are only used by Run
+	seq     uint64
+	history *ring
+
+	// done is closed when Run returns, pumps counts the clients still writing
+	done  chan struct{}
+	pumps sync.WaitGroup
 }
 
-// NewHub creates a new Hub
-func NewHub() *Hub {
+// NewHub creates a new Hub keeping the last resumeBuffer messages for
+// clients that reconnect
+func NewHub(resumeBuffer int) *Hub {
 	return &Hub{
 		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte, 256),
+		broadcast:  make(chan Message, 256),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		policy:     DefaultClientPolicy,
+		seq:        initialSeq(),
+		history:    newRing(resumeBuffer),
+		done:       make(chan struct{}),
 	}
 }
 
-// Run starts the hub's main loop
-func (h *Hub) Run() {
+// SetClientPolicy changes the queueing policy of clients connecting from now on
+func (h *Hub) SetClientPolicy(policy ClientPolicy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = policy
+	return nil
+}
+
+// QueueStats returns the number of messages dropped and coalesced and of
+// clients disconnected for being too slow
+func (h *Hub) QueueStats() QueueStats {
+	return h.stats.snapshot()
+}
+
+// Run runs the hub's main loop until ctx is cancelled, then delivers the
+// messages already broadcast and closes every client with a going away frame
+func (h *Hub) Run(ctx context.Context) {
+	defer h.shutdown()
+
+	ticker := time.NewTicker(rateInterval)
+	defer ticker.Stop()
+	h.traffic.sample(time.Now())
+
 	for {
 		select {
+		case now := <-ticker.C:
+			h.traffic.sample(now)
+
+		case <-ctx.Done():
+			for {
+				select {
+				case msg := <-h.broadcast:
+					h.deliver(msg)
+				default:
+					return
+				}
+			}
+
 		case client := <-h.register:
 			h.mu.Lock()
 			h.clients[client] = true
+			h.traffic.connected(len(h.clients))
 			h.mu.Unlock()
-			log.Printf("Client registered: %s", client.id)
+			if client.resume > 0 {
+				h.replay(client)
+			}
+			log.Printf("Client registered: %s (%s)", client.id, client.info.Name)
 
 		case client := <-h.unregister:
 			h.mu.Lock()
 			if _, ok := h.clients[client]; ok {
 				delete(h.clients, client)
-				close(client.send)
+				client.closeSend()
+				h.traffic.disconnected()
 			}
 			h.mu.Unlock()
-			log.Printf("Client unregistered: %s", client.id)
+			log.Printf("Client unregistered: %s (%s)", client.id, client.info.Name)
 
-		case message := <-h.broadcast:
-			h.mu.RLock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					go func(c *Client) {
-						h.unregister <- c
-					}(client)
-				}
-			}
-			h.mu.RUnlock()
+		case msg := <-h.broadcast:
+			h.deliver(msg)
 		}
 	}
 }
 
-// Broadcast sends a message to all clients
-func (h *Hub) Broadcast(msg Message) {
+// deliver numbers a broadcast message and queues it for its subscribers
+func (h *Hub) deliver(msg Message) {
+	h.seq++
+	msg.Seq = h.seq
 	data, err := json.Marshal(msg)
 	if err != nil {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
-	h.broadcast <- data
+	h.history.add(sentMessage{seq: msg.Seq, topic: msg.Type, data: data})
+	h.traffic.broadcast(msg.Type)
+
+	h.mu.RLock()
+	for client := range h.clients {
+		if client.subscribed(msg.Type) {
+			client.enqueue(frame{topic: msg.Type, data: data, seq: msg.Seq})
+		}
+	}
+	h.mu.RUnlock()
 }
 
-// BroadcastJSON sends a JSON message to all clients
-func (h *Hub) BroadcastJSON(msgType string, payload interface{}) {
-	payloadData, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("Failed to marshal payload: %v", err)
-		return
+// shutdown closes every client once Run has stopped
+func (h *Hub) shutdown() {
+	close(h.done)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients {
+		client.closeWith(websocket.CloseGoingAway, "server shutting down")
+		delete(h.clients, client)
 	}
+	log.Println("WebSocket hub stopped")
+}
 
-	msg := Message{
-		Type:    msgType,
-		Payload: payloadData,
+// Wait waits until the hub has stopped and every client has been sent its
+// close frame, or ctx is done
+func (h *Hub) Wait(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		<-h.done
+		h.pumps.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	data, err := json.Marshal(msg)
+// join registers a client, reporting false when the hub has stopped
+func (h *Hub) join(client *Client) bool {
+	select {
+	case h.register <- client:
+		return true
+	case <-h.done:
+		return false
+	}
+}
+
+// leave unregisters a client, the hub drops every client when it stops
+func (h *Hub) leave(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.done:
+	}
+}
+
+// Broadcast sends a message to the clients subscribed to its type. Messages
+// broadcast after the hub has stopped are discarded.
+func (h *Hub) Broadcast(msg Message) {
+	select {
+	case h.broadcast <- msg:
+	case <-h.done:
+	}
+}
+
+// BroadcastJSON sends a JSON message to the clients subscribed to msgType
+func (h *Hub) BroadcastJSON(msgType string, payload interface{}) {
+	h.BroadcastEvent(msgType, "", payload)
+}
+
+// BroadcastEvent sends an event to the clients subscribed to topic
+func (h *Hub) BroadcastEvent(topic, event string, payload interface{}) {
+	payloadData, err := json.Marshal(payload)
 	if err != nil {
 		log.Printf("Failed to marshal message: %v", err)
 		return
 	}
-	h.broadcast <- data
+	h.Broadcast(Message{Type: topic, Event: event, Payload: payloadData})
+}
+
+// encodeMessage encodes a message with a JSON payload
+func encodeMessage(msgType string, payload interface{}) ([]byte, error) {
+	payloadData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(Message{
+		Type:    msgType,
+		Payload: payloadData,
+	})
 }
 
 // ClientCount returns the number of connected clients
@@ -126,31 +268,74 @@ func (h *Hub) ClientCount() int {
 	return len(h.clients)
 }
 
-// HandleWebSocket handles a new WebSocket connection
-func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, clientID string) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+// ConnectOptions describes a connecting client
+type ConnectOptions struct {
+	// Name is the identifier the client sent, not necessarily unique
+	Name     string
+	RemoteIP string
+	// User the client is authenticated as, for messages sent to a user
+	User string
+	// Topics the client is initially subscribed to
+	Topics []string
+	// Resume is the sequence number of the last message a reconnecting
+	// client received, the messages it missed are sent first
+	Resume uint64
+}
+
+// HandleWebSocket handles a new WebSocket connection. Clients change their
+// subscriptions with subscribe and unsubscribe messages,
+// e.g. {"type": "subscribe", "payload": {"topics": ["metrics"]}}.
+func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request, opts ConnectOptions) {
+	conn, err := upgrade(w, r)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
 		return
 	}
 
-	client := &Client{
-		hub:  h,
-		conn: conn,
-		send: make(chan []byte, 256),
-		id:   clientID,
+	client := h.newClient(conn, opts)
+	if err := client.subscribe(opts.Topics); err != nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()))
+		conn.Close()
+		return
 	}
 
-	h.register <- client
+	// Counted before joining so Wait cannot miss it
+	h.pumps.Add(1)
+	if !h.join(client) {
+		h.pumps.Done()
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"))
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
 }
 
+// newClient creates a client queueing messages with the current policy.
+// conn is nil for Server-Sent Events clients.
+func (h *Hub) newClient(conn *websocket.Conn, opts ConnectOptions) *Client {
+	h.mu.RLock()
+	policy := h.policy
+	h.mu.RUnlock()
+
+	return &Client{
+		hub:    h,
+		conn:   conn,
+		id:     newClientID(),
+		info:   opts,
+		since:  time.Now(),
+		topics: make(map[string]bool),
+		resume: opts.Resume,
+		notify: make(chan struct{}, 1),
+		policy: policy,
+	}
+}
+
 // readPump pumps messages from the WebSocket connection to the hub
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.hub.leave(c)
 		c.conn.Close()
 	}()
 
@@ -170,12 +355,12 @@ func (c *Client) readPump() {
 			break
 		}
 
-		// Handle incoming messages if needed
 		var msg Message
-		if err := json.Unmarshal(message, &msg); err == nil {
-			// Process message based on type
-			log.Printf("Received message type: %s", msg.Type)
+		if err := json.Unmarshal(message, &msg); err != nil {
+			c.reply(typeError, map[string]string{"error": "invalid message"})
+			continue
 		}
+		c.handleMessage(msg)
 	}
 }
 
@@ -185,31 +370,30 @@ func (c *Client) writePump() {
 	defer func() {
 		ticker.Stop()
 		c.conn.Close()
+		c.hub.pumps.Done()
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.send:
-			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
-			}
-
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+		case <-c.notify:
+			frames, closing := c.drain()
+
+			// Every message is its own frame so clients can parse them as JSON
+			for _, f := range frames {
+				c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				if err := c.conn.WriteMessage(websocket.TextMessage, f.data); err != nil {
+					return
+				}
+				c.hub.traffic.written(len(f.data))
 			}
-			w.Write(message)
 
-			// Batch pending messages
-			n := len(c.send)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
-			}
+			if closing {
+				c.mu.Lock()
+				code, reason := c.closeCode, c.closeReason
+				c.mu.Unlock()
 
-			if err := w.Close(); err != nil {
+				c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
 				return
 			}
 
@@ -224,36 +408,50 @@ func (c *Client) writePump() {
 
 // Send sends a message to a specific client
 func (c *Client) Send(msg []byte) error {
+	c.enqueue(frame{data: msg})
+	return nil
+}
+
+// Close closes the client connection
+func (c *Client) Close() {
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	closed := c.closed
+	c.mu.Unlock()
 
-	if c.closed {
-		return nil
+	// The hub locks the client when unregistering it
+	if !closed {
+		c.hub.leave(c)
 	}
+}
 
-	select {
-	case c.send <- msg:
-	default:
-		return nil
-	}
-	return nil
+// closeSend stops queueing messages once the hub has dropped the client
+// and lets the write pump close the connection
+func (c *Client) closeSend() {
+	c.closeWith(websocket.CloseNormalClosure, "")
 }
 
-// Close closes the client connection
-func (c *Client) Close() {
+// closeWith stops queueing messages and lets the write pump close the
+// connection with code and reason once the queued messages are written
+func (c *Client) closeWith(code int, reason string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.closeLocked(code, reason)
+}
 
+// closeLocked is closeWith with c.mu held
+func (c *Client) closeLocked(code int, reason string) {
 	if c.closed {
 		return
 	}
 	c.closed = true
-	c.hub.unregister <- c
+	c.closeCode = code
+	c.closeReason = reason
+	c.wake()
 }
 
 // TerminalHub handles terminal WebSocket connections
 type TerminalHub struct {
-	clients map[string]*TerminalClient
+	clients map[string]map[*TerminalClient]bool
 	mu      sync.RWMutex
 }
 
@@ -268,13 +466,14 @@ type TerminalClient struct {
 // NewTerminalHub creates a new terminal hub
 func NewTerminalHub() *TerminalHub {
 	return &TerminalHub{
-		clients: make(map[string]*TerminalClient),
+		clients: make(map[string]map[*TerminalClient]bool),
 	}
 }
 
-// HandleTerminalWebSocket handles a terminal WebSocket connection
+// HandleTerminalWebSocket handles a terminal WebSocket connection.
+// Several clients may be attached to the same session.
 func (h *TerminalHub) HandleTerminalWebSocket(w http.ResponseWriter, r *http.Request, sessionID string) (*TerminalClient, error) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, err := upgrade(w, r)
 	if err != nil {
 		return nil, err
 	}
@@ -286,22 +485,38 @@ func (h *TerminalHub) HandleTerminalWebSocket(w http.ResponseWriter, r *http.Req
 	}
 
 	h.mu.Lock()
-	h.clients[sessionID] = client
+	if h.clients[sessionID] == nil {
+		h.clients[sessionID] = make(map[*TerminalClient]bool)
+	}
+	h.clients[sessionID][client] = true
 	h.mu.Unlock()
 
 	return client, nil
 }
 
 // RemoveClient removes a terminal client
-func (h *TerminalHub) RemoveClient(sessionID string) {
+func (h *TerminalHub) RemoveClient(client *TerminalClient) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if client, ok := h.clients[sessionID]; ok {
-		close(client.send)
-		client.conn.Close()
-		delete(h.clients, sessionID)
+	clients, ok := h.clients[client.sessionID]
+	if !ok || !clients[client] {
+		return
 	}
+
+	close(client.send)
+	client.conn.Close()
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(h.clients, client.sessionID)
+	}
+}
+
+// ClientCount returns the number of clients attached to a session
+func (h *TerminalHub) ClientCount(sessionID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.clients[sessionID])
 }
 
 // ReadMessage reads a message from the terminal client
@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// origins holds the origin policy of upgrade requests
+var origins = struct {
+	sync.RWMutex
+	allowed []string
+	proxies []*net.IPNet
+}{}
+
+// SetAllowedOrigins sets the origins, besides the host a request is sent
+// to, whose pages may open WebSockets, e.g. the public address of a reverse
+// proxy rewriting the Host header
+func SetAllowedOrigins(allowed []string) error {
+	normalized := make([]string, 0, len(allowed))
+	for _, origin := range allowed {
+		o, err := ParseOrigin(origin)
+		if err != nil {
+			return err
+		}
+		normalized = append(normalized, o)
+	}
+
+	origins.Lock()
+	defer origins.Unlock()
+	origins.allowed = normalized
+	return nil
+}
+
+// SetTrustedProxies sets the addresses and CIDR ranges of the reverse
+// proxies whose X-Forwarded-Host header names the host requests were sent to
+func SetTrustedProxies(proxies []string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid proxy address %q", proxy)
+			}
+			if v4 := ip.To4(); v4 != nil {
+				ip = v4
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy range %q", proxy)
+		}
+		nets = append(nets, n)
+	}
+
+	origins.Lock()
+	defer origins.Unlock()
+	origins.proxies = nets
+	return nil
+}
+
+// ParseOrigin checks an origin such as https://nebula.example.com and
+// returns it in lower case
+func ParseOrigin(origin string) (string, error) {
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" || u.RawQuery != "" {
+		return "", fmt.Errorf("invalid origin %q, expected scheme://host[:port]", origin)
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// sameOrigin refuses upgrades sent by pages of another site, which browsers
+// let open WebSockets with the user's credentials. Pages are accepted from
+// the host the request was sent to, as forwarded by a trusted proxy, and
+// from the allowed origins. Clients that are not browsers send no Origin
+// and are accepted.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	origins.RLock()
+	defer origins.RUnlock()
+
+	host := r.Host
+	if forwarded := r.Header.Get("X-Forwarded-Host"); forwarded != "" && fromProxy(r, origins.proxies) {
+		host, _, _ = strings.Cut(forwarded, ",")
+		host = strings.TrimSpace(host)
+	}
+	if strings.EqualFold(u.Host, host) {
+		return true
+	}
+
+	o := strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, allowed := range origins.allowed {
+		if o == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// fromProxy reports whether r was sent by one of the proxies
+func fromProxy(r *http.Request, proxies []*net.IPNet) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, n := range proxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
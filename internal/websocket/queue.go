@@ -0,0 +1,148 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// Policies for clients that read slower than messages are sent
+const (
+	// PolicyDropOldest discards the oldest queued message to make room
+	PolicyDropOldest = "drop-oldest"
+	// PolicyDisconnect closes the connection with a close reason
+	PolicyDisconnect = "disconnect"
+)
+
+// DefaultSendBuffer is the number of messages queued per client
+const DefaultSendBuffer = 256
+
+// ClientPolicy controls how messages are queued for each client
+type ClientPolicy struct {
+	// SendBuffer is the number of messages queued per client
+	SendBuffer int
+	// SlowClient is PolicyDropOldest or PolicyDisconnect
+	SlowClient string
+	// Coalesce replaces a queued metrics or update message with a newer one
+	// of the same topic instead of queueing both
+	Coalesce bool
+}
+
+// DefaultClientPolicy is used until SetClientPolicy is called
+var DefaultClientPolicy = ClientPolicy{
+	SendBuffer: DefaultSendBuffer,
+	SlowClient: PolicyDropOldest,
+	Coalesce:   true,
+}
+
+// Validate checks a client policy
+func (p ClientPolicy) Validate() error {
+	if p.SendBuffer < 1 {
+		return fmt.Errorf("send buffer must be positive")
+	}
+	switch p.SlowClient {
+	case PolicyDropOldest, PolicyDisconnect:
+		return nil
+	default:
+		return fmt.Errorf("slow client policy must be %s or %s", PolicyDropOldest, PolicyDisconnect)
+	}
+}
+
+// coalescable reports whether only the latest message of topic matters
+func coalescable(topic string) bool {
+	return topic == TopicMetrics || topic == TopicUpdate
+}
+
+// frame is a message queued for a client, topic is empty for replies
+type frame struct {
+	topic string
+	data  []byte
+	seq   uint64
+	// replayed frames fill the gaps a resuming client asked for, so they
+	// are never coalesced
+	replayed bool
+}
+
+// QueueStats counts what happened to the messages queued for clients
+type QueueStats struct {
+	Dropped      uint64 `json:"dropped"`
+	Coalesced    uint64 `json:"coalesced"`
+	Disconnected uint64 `json:"disconnected"`
+}
+
+// queueStats holds the hub wide counters
+type queueStats struct {
+	dropped      atomic.Uint64
+	coalesced    atomic.Uint64
+	disconnected atomic.Uint64
+}
+
+func (s *queueStats) snapshot() QueueStats {
+	return QueueStats{
+		Dropped:      s.dropped.Load(),
+		Coalesced:    s.coalesced.Load(),
+		Disconnected: s.disconnected.Load(),
+	}
+}
+
+// enqueue queues a frame for the write pump, applying the client policy
+// when the queue is full
+func (c *Client) enqueue(f frame) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+
+	if c.policy.Coalesce && !f.replayed && coalescable(f.topic) {
+		if n := len(c.queue); n > 0 && c.queue[n-1].topic == f.topic && !c.queue[n-1].replayed {
+			c.queue[n-1] = f
+			c.coalesced++
+			c.hub.stats.coalesced.Add(1)
+			return
+		}
+	}
+
+	if len(c.queue) >= c.policy.SendBuffer {
+		if c.policy.SlowClient == PolicyDisconnect {
+			log.Printf("Disconnecting slow client %s", c.id)
+			c.hub.stats.disconnected.Add(1)
+			c.closeLocked(websocket.CloseTryAgainLater, "client too slow")
+			return
+		}
+		c.queue = c.queue[1:]
+		c.dropped++
+		c.hub.stats.dropped.Add(1)
+	}
+
+	c.queue = append(c.queue, f)
+	c.wake()
+}
+
+// wake signals the write pump, c.mu must be held
+func (c *Client) wake() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// drain takes the queued frames and reports whether the connection should
+// be closed once they are written
+func (c *Client) drain() (frames []frame, closing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	frames = c.queue
+	c.queue = nil
+	return frames, c.closed
+}
+
+// Dropped returns the number of messages discarded because the client was too slow
+func (c *Client) Dropped() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
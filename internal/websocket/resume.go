@@ -0,0 +1,102 @@
+package websocket
+
+import "time"
+
+// typeGap tells a resuming client that messages it missed are no longer
+// available, so it should reload its state instead of relying on the replay
+const typeGap = "gap"
+
+// gap is the payload of gap messages
+type gap struct {
+	// Resume is the sequence number the client asked to resume from
+	Resume uint64 `json:"resume"`
+	// Oldest is the oldest sequence number replayed, 0 when none is
+	Oldest uint64 `json:"oldest"`
+}
+
+// sentMessage is a broadcast message kept for replays
+type sentMessage struct {
+	seq   uint64
+	topic string
+	data  []byte
+}
+
+// ring is a bounded buffer of the last broadcast messages. It is only used
+// from the hub's main loop.
+type ring struct {
+	messages []sentMessage
+	start    int
+	size     int
+}
+
+// newRing creates a ring buffer holding up to capacity messages
+func newRing(capacity int) *ring {
+	return &ring{messages: make([]sentMessage, capacity)}
+}
+
+// add appends a message, dropping the oldest one when full
+func (r *ring) add(msg sentMessage) {
+	if len(r.messages) == 0 {
+		return
+	}
+	if r.size < len(r.messages) {
+		r.messages[(r.start+r.size)%len(r.messages)] = msg
+		r.size++
+		return
+	}
+	r.messages[r.start] = msg
+	r.start = (r.start + 1) % len(r.messages)
+}
+
+// since returns the messages with a sequence number greater than seq, oldest first
+func (r *ring) since(seq uint64) []sentMessage {
+	var out []sentMessage
+	for i := 0; i < r.size; i++ {
+		msg := r.messages[(r.start+i)%len(r.messages)]
+		if msg.seq > seq {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+// initialSeq returns the first sequence number of a hub. Starting from the
+// clock in microseconds keeps numbers increasing across server restarts, so a
+// client resuming after a restart is told about the gap.
+func initialSeq() uint64 {
+	return uint64(time.Now().UnixMicro())
+}
+
+// replay sends a resuming client the messages it missed on its topics
+func (h *Hub) replay(client *Client) {
+	if client.resume == h.seq {
+		return
+	}
+
+	missed := h.history.since(client.resume)
+	// The buffer still holds the first message the client missed
+	complete := len(missed) > 0 && missed[0].seq == client.resume+1
+
+	var pending []sentMessage
+	for _, msg := range missed {
+		if client.subscribed(msg.topic) {
+			pending = append(pending, msg)
+		}
+	}
+	// Leave room in the send buffer for live messages
+	if limit := client.policy.SendBuffer / 2; len(pending) > limit {
+		pending = pending[len(pending)-limit:]
+		complete = false
+	}
+
+	if !complete {
+		var oldest uint64
+		if len(pending) > 0 {
+			oldest = pending[0].seq
+		}
+		client.reply(typeGap, gap{Resume: client.resume, Oldest: oldest})
+	}
+	for _, msg := range pending {
+		client.enqueue(frame{topic: msg.topic, data: msg.data, seq: msg.seq, replayed: true})
+	}
+}
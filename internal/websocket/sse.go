@@ -0,0 +1,99 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// sseHeartbeat is the interval of the comments keeping idle streams open
+// through proxies
+const sseHeartbeat = 30 * time.Second
+
+// HandleSSE streams the messages of the client topics as Server-Sent Events,
+// for clients behind proxies that break WebSockets. Each event carries the
+// same JSON message as the WebSocket, with the topic as event name and the
+// sequence number as id, so EventSource resumes through Last-Event-ID.
+func (h *Hub) HandleSSE(w http.ResponseWriter, r *http.Request, opts ConnectOptions) {
+	client := h.newClient(nil, opts)
+	if err := client.subscribe(opts.Topics); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Streams outlive the server write timeout
+	rc := http.NewResponseController(w)
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil && err != http.ErrNotSupported {
+		log.Printf("Failed to clear write deadline: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	h.pumps.Add(1)
+	if !h.join(client) {
+		h.pumps.Done()
+		return
+	}
+	defer func() {
+		h.leave(client)
+		h.pumps.Done()
+	}()
+
+	ticker := time.NewTicker(sseHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case <-client.notify:
+			frames, closing := client.drain()
+			for _, f := range frames {
+				if err := writeEvent(w, f); err != nil {
+					return
+				}
+				h.traffic.written(len(f.data))
+			}
+			if closing {
+				client.mu.Lock()
+				reason := client.closeReason
+				client.mu.Unlock()
+				if reason != "" {
+					fmt.Fprintf(w, "event: close\ndata: %s\n\n", reason)
+				}
+			}
+			if err := rc.Flush(); err != nil || closing {
+				return
+			}
+
+		case <-ticker.C:
+			fmt.Fprint(w, ": ping\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent writes a queued message as a Server-Sent Event
+func writeEvent(w http.ResponseWriter, f frame) error {
+	event := f.topic
+	if event == "" {
+		event = "message"
+	}
+	if f.seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", f.seq); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, f.data)
+	return err
+}
@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// rateInterval is how often topic counters are sampled, rateWindow the
+// period topic rates are averaged over
+const (
+	rateInterval = 10 * time.Second
+	rateWindow   = time.Minute
+)
+
+// Stats describes the activity of the hub since it started
+type Stats struct {
+	Clients        int    `json:"clients"`
+	PeakClients    int    `json:"peak_clients"`
+	Connections    uint64 `json:"connections"`
+	Disconnections uint64 `json:"disconnections"`
+	MessagesSent   uint64 `json:"messages_sent"`
+	BytesSent      uint64 `json:"bytes_sent"`
+	// Queue counts messages dropped or coalesced for slow clients
+	Queue  QueueStats            `json:"queue"`
+	Topics map[string]TopicStats `json:"topics"`
+}
+
+// TopicStats describes the messages broadcast on a topic
+type TopicStats struct {
+	Messages uint64 `json:"messages"`
+	// Rate is the number of messages per second over the last minute
+	Rate float64 `json:"rate"`
+}
+
+// trafficStats holds the hub counters not related to queueing
+type trafficStats struct {
+	sent  atomic.Uint64
+	bytes atomic.Uint64
+
+	mu             sync.Mutex
+	peak           int
+	connections    uint64
+	disconnections uint64
+	topics         map[string]uint64
+	samples        []topicSample
+}
+
+// topicSample is a snapshot of the topic counters used to compute rates
+type topicSample struct {
+	at     time.Time
+	counts map[string]uint64
+}
+
+// written counts a message written to a client
+func (s *trafficStats) written(n int) {
+	s.sent.Add(1)
+	s.bytes.Add(uint64(n))
+}
+
+// connected counts a new client, clients being the number now connected
+func (s *trafficStats) connected(clients int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.connections++
+	s.peak = max(s.peak, clients)
+}
+
+// disconnected counts a client leaving
+func (s *trafficStats) disconnected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.disconnections++
+}
+
+// broadcast counts a message broadcast on topic
+func (s *trafficStats) broadcast(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.topics == nil {
+		s.topics = make(map[string]uint64)
+	}
+	s.topics[topic]++
+}
+
+// sample records the topic counters, keeping the samples of the rate window
+func (s *trafficStats) sample(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]uint64, len(s.topics))
+	for topic, n := range s.topics {
+		counts[topic] = n
+	}
+	s.samples = append(s.samples, topicSample{at: now, counts: counts})
+	for len(s.samples) > 1 && now.Sub(s.samples[1].at) >= rateWindow {
+		s.samples = s.samples[1:]
+	}
+}
+
+// Stats returns the hub counters
+func (h *Hub) Stats() Stats {
+	stats := Stats{
+		Clients:      h.ClientCount(),
+		MessagesSent: h.traffic.sent.Load(),
+		BytesSent:    h.traffic.bytes.Load(),
+		Queue:        h.stats.snapshot(),
+		Topics:       make(map[string]TopicStats),
+	}
+
+	t := &h.traffic
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats.PeakClients = t.peak
+	stats.Connections = t.connections
+	stats.Disconnections = t.disconnections
+
+	now := time.Now()
+	for topic, n := range t.topics {
+		ts := TopicStats{Messages: n}
+		if len(t.samples) > 0 {
+			oldest := t.samples[0]
+			if elapsed := now.Sub(oldest.at).Seconds(); elapsed > 0 {
+				ts.Rate = float64(n-oldest.counts[topic]) / elapsed
+			}
+		}
+		stats.Topics[topic] = ts
+	}
+	return stats
+}
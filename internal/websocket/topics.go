@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Topics clients can subscribe to. A message is delivered to the clients
+// subscribed to its type.
+const (
+	TopicMetrics    = "metrics"
+	TopicServices   = "services"
+	TopicJobs       = "jobs"
+	TopicAlerts     = "alerts"
+	TopicFiles      = "files"
+	TopicUpdate     = "update"
+	TopicAudit      = "audit"
+	TopicContainers = "containers"
+	TopicSystem     = "system"
+	TopicSecurity   = "security"
+	TopicNotices    = "notices"
+)
+
+// Topics lists every topic clients can subscribe to
+var Topics = []string{TopicMetrics, TopicServices, TopicJobs, TopicAlerts, TopicFiles, TopicUpdate, TopicAudit, TopicContainers, TopicSystem, TopicSecurity, TopicNotices}
+
+// Control message types sent by clients and the replies of the hub
+const (
+	typeSubscribe   = "subscribe"
+	typeUnsubscribe = "unsubscribe"
+	typeSubscribed  = "subscribed"
+	typeError       = "error"
+)
+
+// subscription is the payload of subscribe and unsubscribe messages
+type subscription struct {
+	Topics []string `json:"topics"`
+}
+
+// isTopic reports whether topic is known
+func isTopic(topic string) bool {
+	for _, t := range Topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// subscribe adds topics to the client subscriptions, rejecting unknown ones
+func (c *Client) subscribe(topics []string) error {
+	for _, topic := range topics {
+		if !isTopic(topic) {
+			return fmt.Errorf("unknown topic %q", topic)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		c.topics[topic] = true
+	}
+	return nil
+}
+
+// unsubscribe removes topics from the client subscriptions
+func (c *Client) unsubscribe(topics []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.topics, topic)
+	}
+}
+
+// subscribed reports whether the client receives messages of topic
+func (c *Client) subscribed(topic string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.topics[topic]
+}
+
+// Subscriptions returns the topics the client is subscribed to
+func (c *Client) Subscriptions() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	topics := make([]string, 0, len(c.topics))
+	for topic := range c.topics {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+	return topics
+}
+
+// handleMessage processes a control message from the client
+func (c *Client) handleMessage(msg Message) {
+	switch msg.Type {
+	case typeSubscribe, typeUnsubscribe:
+		var sub subscription
+		if err := json.Unmarshal(msg.Payload, &sub); err != nil {
+			c.reply(typeError, map[string]string{"error": "invalid " + msg.Type + " payload"})
+			return
+		}
+
+		if msg.Type == typeSubscribe {
+			if err := c.subscribe(sub.Topics); err != nil {
+				c.reply(typeError, map[string]string{"error": err.Error()})
+				return
+			}
+		} else {
+			c.unsubscribe(sub.Topics)
+		}
+		c.reply(typeSubscribed, subscription{Topics: c.Subscriptions()})
+
+	default:
+		c.reply(typeError, map[string]string{"error": fmt.Sprintf("unknown message type %q", msg.Type)})
+	}
+}
+
+// reply sends a message to this client only
+func (c *Client) reply(msgType string, payload interface{}) {
+	data, err := encodeMessage(msgType, payload)
+	if err != nil {
+		return
+	}
+	c.Send(data)
+}
@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxWatches is the number of paths a watch connection may subscribe to
+const maxWatches = 64
+
+// typeOverflow tells a watch client that changes were dropped because it
+// read too slowly, so it should list its directories again
+const typeOverflow = "overflow"
+
+// WatchFunc starts watching path, calling send with the events for it, and
+// returns the function stopping the watch
+type WatchFunc func(path string, send func(event string, payload interface{})) (func(), error)
+
+// watchRequest is the payload of subscribe and unsubscribe messages of
+// watch connections
+type watchRequest struct {
+	Path string `json:"path"`
+}
+
+// HandleWatch serves a connection whose client subscribes to paths with
+// subscribe and unsubscribe messages carrying {"path": ...}. Events are
+// sent as messages of the files topic, with the event set.
+func HandleWatch(w http.ResponseWriter, r *http.Request, watch WatchFunc) {
+	conn, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+
+	out := make(chan []byte, 1024)
+	done := make(chan struct{})
+	var overflow atomic.Bool
+	send := func(msgType, event string, payload interface{}) {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return
+		}
+		msg, _ := json.Marshal(Message{Type: msgType, Event: event, Payload: data})
+		select {
+		case out <- msg:
+		case <-done:
+		default:
+			overflow.Store(true)
+		}
+	}
+	go writeWatch(conn, out, done, &overflow)
+
+	// Watches are only touched by this goroutine
+	watches := make(map[string]func())
+	defer func() {
+		close(done)
+		for _, stop := range watches {
+			stop()
+		}
+		conn.Close()
+	}()
+	subscribe := func(path string) error {
+		if _, ok := watches[path]; ok {
+			return nil
+		}
+		if len(watches) >= maxWatches {
+			return fmt.Errorf("too many watched paths, %d allowed", maxWatches)
+		}
+		stop, err := watch(path, func(event string, payload interface{}) {
+			send(TopicFiles, event, payload)
+		})
+		if err != nil {
+			return err
+		}
+		watches[path] = stop
+		return nil
+	}
+	subscribed := func() {
+		paths := make([]string, 0, len(watches))
+		for path := range watches {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		send(typeSubscribed, "", map[string][]string{"paths": paths})
+	}
+
+	conn.SetReadLimit(64 * 1024)
+	conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	conn.SetPongHandler(func(string) error {
+		conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+		return nil
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			return
+		}
+
+		var msg Message
+		if err := json.Unmarshal(data, &msg); err != nil {
+			send(typeError, "", map[string]string{"error": "invalid message"})
+			continue
+		}
+		var req watchRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil || req.Path == "" {
+			send(typeError, "", map[string]string{"error": "invalid " + msg.Type + " payload, path required"})
+			continue
+		}
+
+		switch msg.Type {
+		case typeSubscribe:
+			if err := subscribe(req.Path); err != nil {
+				send(typeError, "", map[string]string{"error": err.Error(), "path": req.Path})
+				continue
+			}
+		case typeUnsubscribe:
+			if stop, ok := watches[req.Path]; ok {
+				stop()
+				delete(watches, req.Path)
+			}
+		default:
+			send(typeError, "", map[string]string{"error": fmt.Sprintf("unknown message type %q", msg.Type)})
+			continue
+		}
+		subscribed()
+	}
+}
+
+// writeWatch writes the messages of a watch connection, pinging the client
+// and telling it when messages were dropped
+func writeWatch(conn *websocket.Conn, out <-chan []byte, done <-chan struct{}, overflow *atomic.Bool) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	write := func(typ int, data []byte) bool {
+		conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		return conn.WriteMessage(typ, data) == nil
+	}
+	for {
+		select {
+		case msg := <-out:
+			if !write(websocket.TextMessage, msg) {
+				return
+			}
+			if overflow.Swap(false) {
+				msg, _ := json.Marshal(Message{Type: typeOverflow})
+				if !write(websocket.TextMessage, msg) {
+					return
+				}
+			}
+		case <-ticker.C:
+			if !write(websocket.PingMessage, nil) {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
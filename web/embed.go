@@ -1,6 +1,7 @@
 package web
 
 import (
+	"bytes"
 	"embed"
 	"io/fs"
 	"net/http"
@@ -11,25 +12,34 @@ import (
 //go:embed static/*
 var staticFS embed.FS
 
+// baseTag is the base element of index.html, which the asset and API URLs
+// of the frontend are resolved against
+var baseTag = []byte(`<base href="/">`)
+
 // StaticFS returns the embedded static filesystem
 func StaticFS() embed.FS {
 	return staticFS
 }
 
-// RegisterStaticRoutes registers routes for static files
-func RegisterStaticRoutes(r *gin.Engine) {
+// RegisterStaticRoutes registers routes for static files. basePath is the
+// prefix the browser reaches the server at, set as the base of index.html.
+func RegisterStaticRoutes(r *gin.Engine, basePath string) {
 	// Serve static files from embedded filesystem
 	staticSub, _ := fs.Sub(staticFS, "static")
 	r.StaticFS("/static", http.FS(staticSub))
 
+	index, err := staticFS.ReadFile("static/index.html")
+	if err == nil {
+		index = bytes.Replace(index, baseTag, []byte(`<base href="`+basePath+`/">`), 1)
+	}
+
 	// Serve index.html for root
 	r.GET("/", func(c *gin.Context) {
-		data, err := staticFS.ReadFile("static/index.html")
 		if err != nil {
 			c.String(http.StatusInternalServerError, "Failed to load page")
 			return
 		}
-		c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
 	})
 
 	// Serve index.html for SPA routes (client-side routing)
@@ -41,11 +51,10 @@ func RegisterStaticRoutes(r *gin.Engine) {
 		}
 
 		// For other routes, serve index.html (SPA routing)
-		data, err := staticFS.ReadFile("static/index.html")
 		if err != nil {
 			c.String(http.StatusNotFound, "Not found")
 			return
 		}
-		c.Data(http.StatusOK, "text/html; charset=utf-8", data)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
 	})
 }
@@ -2,7 +2,10 @@
 const App = {
     currentPage: 'dashboard',
 
-    init() {
+    async init() {
+        // Pick the host before any module talks to the API
+        await Hosts.init();
+
         this.setupNavigation();
         this.setupTheme();
         this.initModules();
@@ -146,6 +149,22 @@ const App = {
         modal.classList.remove('active');
     },
 
+    // Fetches every page of a list endpoint and returns the items
+    async fetchList(path) {
+        const items = [];
+        let cursor = '';
+        do {
+            const sep = path.includes('?') ? '&' : '?';
+            const page = cursor ? `&cursor=${encodeURIComponent(cursor)}` : '';
+            const response = await fetch(Hosts.url(`${path}${sep}limit=1000${page}`));
+            const data = await response.json();
+            if (!response.ok) throw new Error(data.error || response.statusText);
+            items.push(...data.items);
+            cursor = data.next_cursor;
+        } while (cursor);
+        return items;
+    },
+
     showToast(message, type = 'info') {
         const container = document.getElementById('toast-container');
         const toast = document.createElement('div');
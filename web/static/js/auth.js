@@ -2,6 +2,11 @@
 const Auth = {
     isElevated: false,
     hasCredentials: false,
+    escalation: 'sudo',
+    sudoMode: false,
+    // Elevation token of sudo mode, kept in memory only
+    elevationToken: '',
+    elevationExpires: 0,
     pendingCallback: null,
 
     async init() {
@@ -10,11 +15,13 @@ const Auth = {
 
     async checkStatus() {
         try {
-            const response = await fetch('/api/v1/auth/status');
+            const response = await fetch(Hosts.url('/api/v1/auth/status'));
             const status = await response.json();
             
             this.isElevated = status.is_elevated;
             this.hasCredentials = status.has_credentials;
+            this.escalation = status.escalation;
+            this.sudoMode = status.sudo_mode;
             
             // Update UI indicators if needed
             this.updateStatusIndicator();
@@ -36,6 +43,12 @@ const Auth = {
             } else if (this.hasCredentials) {
                 indicator.textContent = '🔑 Sudo';
                 indicator.title = 'Credentials stored';
+            } else if (this.isElevationValid()) {
+                indicator.textContent = '🔑 Sudo';
+                indicator.title = 'Elevated until ' + new Date(this.elevationExpires).toLocaleTimeString();
+            } else if (this.escalation === 'pkexec') {
+                indicator.textContent = '🛡️ Polkit';
+                indicator.title = 'Privileged actions are authorized through polkit';
             } else {
                 indicator.textContent = '🔒';
                 indicator.title = 'No credentials';
@@ -74,7 +87,7 @@ const Auth = {
 
         try {
             // Validate credentials
-            const validateResponse = await fetch('/api/v1/auth/validate', {
+            const validateResponse = await fetch(Hosts.url('/api/v1/auth/validate'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ password })
@@ -87,9 +100,23 @@ const Auth = {
                 return;
             }
 
-            // Store credentials if remember is checked
-            if (remember) {
-                const storeResponse = await fetch('/api/v1/auth/credentials', {
+            // Sudo mode never stores the password, it is traded for a short-lived token
+            if (this.sudoMode) {
+                const elevateResponse = await fetch(Hosts.url('/api/v1/auth/elevate'), {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ password })
+                });
+                if (!elevateResponse.ok) {
+                    App.showToast('Elevazione non riuscita', 'error');
+                    return;
+                }
+                const elevation = await elevateResponse.json();
+                this.elevationToken = elevation.token;
+                this.elevationExpires = Date.parse(elevation.expires_at);
+            } else if (remember) {
+                // Store credentials if remember is checked
+                const storeResponse = await fetch(Hosts.url('/api/v1/auth/credentials'), {
                     method: 'POST',
                     headers: { 'Content-Type': 'application/json' },
                     body: JSON.stringify({ password })
@@ -117,7 +144,7 @@ const Auth = {
 
     async clearCredentials() {
         try {
-            const response = await fetch('/api/v1/auth/credentials', { method: 'DELETE' });
+            const response = await fetch(Hosts.url('/api/v1/auth/credentials'), { method: 'DELETE' });
             if (response.ok) {
                 this.hasCredentials = false;
                 this.updateStatusIndicator();
@@ -128,17 +155,26 @@ const Auth = {
         }
     },
 
-    // Helper to run a privileged action
+    isElevationValid() {
+        return this.elevationToken !== '' && Date.now() < this.elevationExpires;
+    },
+
+    // headers returns the headers privileged requests send in sudo mode
+    headers() {
+        return this.isElevationValid() ? { 'X-Sudo-Token': this.elevationToken } : {};
+    },
+
+    // Helper to run a privileged action, which receives the headers to send
     async runPrivileged(action) {
-        // If already elevated or has credentials, just run the action
-        if (this.isElevated || this.hasCredentials) {
-            return action();
+        // If already elevated, has credentials or polkit asks, just run the action
+        if (this.isElevated || this.hasCredentials || this.escalation === 'pkexec' || this.isElevationValid()) {
+            return action(this.headers());
         }
 
         // Otherwise, request credentials first
         return new Promise((resolve) => {
             this.requestCredentials(async () => {
-                const result = await action();
+                const result = await action(this.headers());
                 resolve(result);
             });
         });
@@ -6,7 +6,6 @@ const Dashboard = {
     cpuHistory: [],
     memoryHistory: [],
     networkHistory: { sent: [], recv: [] },
-    lastNetwork: null,
 
     init() {
         this.initCharts();
@@ -121,7 +120,7 @@ const Dashboard = {
 
     async loadSystemInfo() {
         try {
-            const response = await fetch('/api/v1/system/info');
+            const response = await fetch(Hosts.url('/api/v1/system/info'));
             const info = await response.json();
 
             document.getElementById('hostname').textContent = info.hostname;
@@ -134,7 +133,7 @@ const Dashboard = {
 
     async loadMetrics() {
         try {
-            const response = await fetch('/api/v1/metrics/all');
+            const response = await fetch(Hosts.url('/api/v1/metrics/all'));
             const metrics = await response.json();
             this.updateMetrics(metrics);
         } catch (error) {
@@ -143,6 +142,18 @@ const Dashboard = {
     },
 
     updateMetrics(metrics) {
+        // Update load average, with the pressure stalls as a tooltip
+        const loadAvg = document.getElementById('load-avg');
+        if (loadAvg && metrics.system && metrics.system.load) {
+            const load = metrics.system.load;
+            loadAvg.textContent = `Load ${load.load1.toFixed(2)} ${load.load5.toFixed(2)} ${load.load15.toFixed(2)}`;
+            const pressure = metrics.system.pressure;
+            loadAvg.title = pressure ? ['cpu', 'memory', 'io']
+                .filter(name => pressure[name])
+                .map(name => `${name} pressure: ${pressure[name].some.avg10.toFixed(2)}% (10s)`)
+                .join('\n') : '';
+        }
+
         // Update CPU
         if (metrics.cpu) {
             const cpuTotal = metrics.cpu.total_percent.toFixed(1);
@@ -211,24 +222,26 @@ const Dashboard = {
         if (metrics.network) {
             const networkList = document.getElementById('network-list');
             if (networkList) {
-                let totalSent = 0, totalRecv = 0;
+                let sentRate = 0, recvRate = 0, hasRates = false;
 
                 networkList.innerHTML = metrics.network.map(net => {
-                    totalSent += net.bytes_sent;
-                    totalRecv += net.bytes_recv;
+                    let rates = '';
+                    if (net.rates) {
+                        hasRates = true;
+                        sentRate += net.rates.bytes_sent;
+                        recvRate += net.rates.bytes_recv;
+                        rates = ` (↑ ${this.formatBytes(Math.round(net.rates.bytes_sent))}/s ↓ ${this.formatBytes(Math.round(net.rates.bytes_recv))}/s)`;
+                    }
                     return `
                         <div class="network-item">
                             <span>${net.name}</span>
-                            <span>↑ ${this.formatBytes(net.bytes_sent)} ↓ ${this.formatBytes(net.bytes_recv)}</span>
+                            <span>↑ ${this.formatBytes(net.bytes_sent)} ↓ ${this.formatBytes(net.bytes_recv)}${rates}</span>
                         </div>
                     `;
                 }).join('');
 
-                // Calculate rate
-                if (this.lastNetwork) {
-                    const sentRate = (totalSent - this.lastNetwork.sent) / 1; // per second
-                    const recvRate = (totalRecv - this.lastNetwork.recv) / 1;
-
+                // Rates are measured by the server between samples
+                if (hasRates) {
                     this.networkHistory.sent.push(sentRate);
                     this.networkHistory.recv.push(recvRate);
 
@@ -243,8 +256,24 @@ const Dashboard = {
                         this.networkChart.update();
                     }
                 }
+            }
+        }
 
-                this.lastNetwork = { sent: totalSent, recv: totalRecv };
+        // Update top processes, sampled by the server when enabled
+        const topCard = document.getElementById('top-processes');
+        if (topCard) {
+            topCard.hidden = !metrics.top_processes;
+            if (metrics.top_processes) {
+                const row = (p, value) => `
+                    <div class="network-item">
+                        <span>${this.escapeHtml(p.name)} <small>(${p.pid})</small></span>
+                        <span>${value}</span>
+                    </div>
+                `;
+                document.getElementById('top-cpu').innerHTML = metrics.top_processes.cpu
+                    .map(p => row(p, `${p.cpu_percent.toFixed(1)}%`)).join('');
+                document.getElementById('top-memory').innerHTML = metrics.top_processes.memory
+                    .map(p => row(p, this.formatBytes(p.mem_rss))).join('');
             }
         }
     },
@@ -2,6 +2,17 @@
 const Files = {
     currentPath: '/',
     files: [],
+    // Files larger than a chunk are sent as resumable uploads
+    chunkSize: 8 * 1024 * 1024,
+    // Files are viewed a page at a time, so large ones open quickly
+    viewChunkSize: 1024 * 1024,
+    viewing: null,
+    // Follows the viewed file like tail -f
+    followSocket: null,
+    // Live changes of the current directory
+    socket: null,
+    watched: null,
+    reloadTimer: null,
 
     init() {
         this.setupEventListeners();
@@ -21,6 +32,10 @@ const Files = {
             this.promptNewFolder();
         });
 
+        document.getElementById('btn-terminal-here')?.addEventListener('click', () => {
+            TerminalManager.openHere(this.currentPath);
+        });
+
         // Drag and drop
         const container = document.getElementById('page-files');
         if (container) {
@@ -41,16 +56,52 @@ const Files = {
 
     async load(path) {
         try {
-            const response = await fetch(`/api/v1/files/list?path=${encodeURIComponent(path)}`);
-            this.files = await response.json();
+            this.files = await App.fetchList(`/api/v1/files/list?path=${encodeURIComponent(path)}`);
             this.currentPath = path;
             this.render();
+            this.watch(path);
         } catch (error) {
             console.error('Failed to load files:', error);
             App.showToast('Failed to load files', 'error');
         }
     },
 
+    async watch(path) {
+        if (this.socket && this.socket.readyState <= WebSocket.OPEN) {
+            if (this.socket.readyState === WebSocket.OPEN && this.watched !== path) {
+                if (this.watched) this.send('unsubscribe', this.watched);
+                this.send('subscribe', path);
+            }
+            this.watched = path;
+            return;
+        }
+
+        const ticket = await Hosts.ticket();
+        const socket = new WebSocket(Hosts.wsUrl('/ws/files') + (ticket ? `?ticket=${ticket}` : ''));
+        this.socket = socket;
+        this.watched = path;
+        socket.onopen = () => this.send('subscribe', this.watched);
+        socket.onmessage = (event) => {
+            const msg = JSON.parse(event.data);
+            if ((msg.type === 'files' && msg.payload.dir === this.currentPath) || msg.type === 'overflow') {
+                this.scheduleReload();
+            }
+        };
+        socket.onclose = () => {
+            if (this.socket === socket) this.socket = null;
+        };
+    },
+
+    send(type, path) {
+        this.socket.send(JSON.stringify({ type, payload: { path } }));
+    },
+
+    // Bursts of changes reload the listing once
+    scheduleReload() {
+        clearTimeout(this.reloadTimer);
+        this.reloadTimer = setTimeout(() => this.load(this.currentPath), 300);
+    },
+
     render() {
         this.renderBreadcrumb();
         this.renderFiles();
@@ -95,6 +146,7 @@ const Files = {
                     </div>
                     <div class="file-item-actions">
                         ${!file.is_dir ? `<button class="btn btn-sm" onclick="event.stopPropagation(); Files.download('${this.escapeAttr(file.path)}')">↓</button>` : ''}
+                        <button class="btn btn-sm" title="Share link" onclick="event.stopPropagation(); Files.share('${this.escapeAttr(file.path)}')">🔗</button>
                         <button class="btn btn-sm btn-danger" onclick="event.stopPropagation(); Files.delete('${this.escapeAttr(file.path)}')">×</button>
                     </div>
                 </div>
@@ -111,12 +163,15 @@ const Files = {
     },
 
     async viewFile(path) {
+        this.stopFollow();
         try {
-            const response = await fetch(`/api/v1/files/read?path=${encodeURIComponent(path)}`);
-            const data = await response.json();
+            const chunk = await this.readChunk(path, 0);
+            this.viewing = { path, next: chunk.offset + chunk.length, size: chunk.size };
 
             const content = `
-                <pre style="max-height: 400px; overflow: auto; background: var(--bg-primary); padding: 1rem; border-radius: 0.5rem; white-space: pre-wrap; word-wrap: break-word;">${this.escapeHtml(data.content)}</pre>
+                <pre id="file-view" style="max-height: 400px; overflow: auto; background: var(--bg-primary); padding: 1rem; border-radius: 0.5rem; white-space: pre-wrap; word-wrap: break-word;">${this.escapeHtml(chunk.content)}</pre>
+                <button id="file-view-more" class="btn btn-sm" onclick="Files.viewMore()" ${this.viewing.next < chunk.size ? '' : 'hidden'}>Load more</button>
+                <button class="btn btn-sm" title="Show the last lines and the new ones as they are written" onclick="Files.follow()">Follow</button>
             `;
 
             App.showModal(`File: ${path.split('/').pop()}`, content, [
@@ -128,17 +183,90 @@ const Files = {
         }
     },
 
+    async viewMore() {
+        const viewing = this.viewing;
+        try {
+            const chunk = await this.readChunk(viewing.path, viewing.next);
+            document.getElementById('file-view')?.append(chunk.content);
+            viewing.next = chunk.offset + chunk.length;
+            viewing.size = chunk.size;
+            document.getElementById('file-view-more').hidden = chunk.length === 0 || viewing.next >= chunk.size;
+        } catch (error) {
+            App.showToast(error.message || 'Failed to read file', 'error');
+        }
+    },
+
+    // Replaces the view with the last lines of the file and appends the
+    // new ones until the view is closed
+    async follow() {
+        const path = this.viewing.path;
+        const view = document.getElementById('file-view');
+        this.stopFollow();
+
+        const ticket = await Hosts.ticket();
+        const params = new URLSearchParams({ path, lines: 200 });
+        if (ticket) params.set('ticket', ticket);
+        const socket = new WebSocket(Hosts.wsUrl(`/ws/files/tail?${params}`));
+        this.followSocket = socket;
+        view.textContent = '';
+        document.getElementById('file-view-more').hidden = true;
+
+        socket.onmessage = (event) => {
+            const modal = document.getElementById('modal');
+            if (!view.isConnected || !modal.classList.contains('active')) {
+                if (this.followSocket === socket) this.stopFollow();
+                return;
+            }
+            const msg = JSON.parse(event.data);
+            if (msg.type === 'error') {
+                App.showToast(msg.payload.error, 'error');
+            } else if (msg.event === 'file.lines') {
+                const atBottom = view.scrollTop + view.clientHeight >= view.scrollHeight - 4;
+                view.append(msg.payload.lines.join('\n') + '\n');
+                if (atBottom) view.scrollTop = view.scrollHeight;
+            } else if (msg.event === 'file.rotated' || msg.event === 'file.truncated') {
+                view.append(`--- file ${msg.payload.kind} ---\n`);
+            }
+        };
+    },
+
+    stopFollow() {
+        this.followSocket?.close();
+        this.followSocket = null;
+    },
+
+    // Reads a page of a file from offset
+    async readChunk(path, offset) {
+        const encoded = path.split('/').map(encodeURIComponent).join('/');
+        const response = await fetch(Hosts.url(`/api/v2/files/content${encoded}?offset=${offset}&length=${this.viewChunkSize}`));
+        const data = await response.json();
+        if (!response.ok) {
+            throw new Error(data.error || 'Failed to read file');
+        }
+        return data;
+    },
+
     download(path) {
-        window.open(`/api/v1/files/download?path=${encodeURIComponent(path)}`, '_blank');
+        window.open(Hosts.url(`/api/v1/files/download?path=${encodeURIComponent(path)}`), '_blank');
     },
 
     async uploadFiles(files) {
         for (const file of files) {
+            if (file.size > this.chunkSize) {
+                try {
+                    await this.uploadInChunks(file);
+                    App.showToast(`Uploaded: ${file.name}`, 'success');
+                } catch (error) {
+                    App.showToast(error.message || 'Upload failed', 'error');
+                }
+                continue;
+            }
+
             const formData = new FormData();
             formData.append('file', file);
 
             try {
-                const response = await fetch(`/api/v1/files/upload?path=${encodeURIComponent(this.currentPath)}`, {
+                const response = await fetch(Hosts.url(`/api/v1/files/upload?path=${encodeURIComponent(this.currentPath)}`), {
                     method: 'POST',
                     body: formData
                 });
@@ -156,6 +284,49 @@ const Files = {
         this.load(this.currentPath);
     },
 
+    async uploadInChunks(file) {
+        const dir = this.currentPath === '/' ? '' : this.currentPath;
+        const response = await fetch(Hosts.url('/api/v2/files/uploads'), {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ path: `${dir}/${file.name}`, size: file.size })
+        });
+        const upload = await response.json();
+        if (!response.ok) {
+            throw new Error(upload.error || 'Upload failed');
+        }
+
+        const url = Hosts.url(`/api/v2/files/uploads/${upload.id}`);
+        let offset = 0;
+        let retries = 0;
+        while (offset < file.size) {
+            try {
+                const res = await fetch(url, {
+                    method: 'PATCH',
+                    headers: { 'Upload-Offset': String(offset) },
+                    body: file.slice(offset, offset + this.chunkSize)
+                });
+                const data = await res.json();
+                // 409 means the server stands elsewhere, continue from there
+                if (!res.ok && res.status !== 409) {
+                    throw new Error(data.error || 'Upload failed');
+                }
+                offset = Number(res.headers.get('Upload-Offset'));
+                retries = 0;
+            } catch (error) {
+                // Fetch fails with a TypeError when the connection drops
+                if (!(error instanceof TypeError) || ++retries > 5) {
+                    throw error;
+                }
+                await new Promise(resolve => setTimeout(resolve, 1000 * retries));
+                const res = await fetch(url).catch(() => null);
+                if (res?.ok) {
+                    offset = (await res.json()).offset;
+                }
+            }
+        }
+    },
+
     promptNewFolder() {
         const content = `
             <input type="text" id="new-folder-name" placeholder="Folder name" style="width: 100%;">
@@ -181,7 +352,7 @@ const Files = {
         const path = this.currentPath === '/' ? `/${name}` : `${this.currentPath}/${name}`;
 
         try {
-            const response = await fetch('/api/v1/files/mkdir', {
+            const response = await fetch(Hosts.url('/api/v1/files/mkdir'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ path })
@@ -203,7 +374,7 @@ const Files = {
         if (!confirm(`Delete ${path}?`)) return;
 
         try {
-            const response = await fetch(`/api/v1/files/delete?path=${encodeURIComponent(path)}`, {
+            const response = await fetch(Hosts.url(`/api/v1/files/delete?path=${encodeURIComponent(path)}`), {
                 method: 'DELETE'
             });
 
@@ -219,6 +390,33 @@ const Files = {
         }
     },
 
+    // Creates a link downloading path for a day without logging in
+    async share(path) {
+        try {
+            const response = await fetch(Hosts.url('/api/v2/files/shares'), {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ path })
+            });
+            const data = await response.json();
+            if (!response.ok) {
+                App.showToast(data.error || 'Failed to share', 'error');
+                return;
+            }
+
+            const url = new URL(data.url, window.location.origin).href;
+            App.showModal(`Share: ${path.split('/').pop()}`, `
+                <p>Anyone with this link can download the file until ${new Date(data.expires_at).toLocaleString()}.</p>
+                <input type="text" readonly value="${this.escapeHtml(url)}" onclick="this.select()" style="width: 100%;">
+            `, [
+                { text: 'Copy', class: 'btn-primary', action: () => navigator.clipboard.writeText(url).then(() => App.showToast('Link copied', 'success')) },
+                { text: 'Close', class: '', action: () => App.closeModal() }
+            ]);
+        } catch (error) {
+            App.showToast('Failed to share', 'error');
+        }
+    },
+
     getFileIcon(ext) {
         const icons = {
             'js': '📜', 'ts': '📜', 'py': '🐍', 'go': '🔷',
@@ -0,0 +1,72 @@
+// Host selection for controllers managing several Nebula agents
+const Hosts = {
+    // Name of the selected agent, empty for the controller itself
+    current: localStorage.getItem('host') || '',
+
+    // Path prefix of the server behind a reverse proxy, from the base of index.html
+    base: new URL(document.baseURI).pathname.replace(/\/$/, ''),
+
+    // url returns the path of an API or stream endpoint on the selected host
+    url(path) {
+        if (!this.current) return `${this.base}${path}`;
+        return `${this.base}/api/v1/hosts/${encodeURIComponent(this.current)}/proxy${path}`;
+    },
+
+    wsUrl(path) {
+        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
+        return `${protocol}//${window.location.host}${this.url(path)}`;
+    },
+
+    // ticket returns a one-time ticket authenticating a stream, which the
+    // browser opens without the credentials of the page. Tickets come from
+    // this instance, which authenticates the streams it proxies to agents.
+    async ticket() {
+        try {
+            const response = await fetch(`${this.base}/api/v1/auth/ticket`, { method: 'POST' });
+            if (!response.ok) return '';
+            return (await response.json()).ticket;
+        } catch (e) {
+            return '';
+        }
+    },
+
+    // init shows the host selector when this instance is a controller
+    async init() {
+        const select = document.getElementById('host-select');
+        if (!select) return;
+
+        let hosts;
+        try {
+            const response = await fetch(`${this.base}/api/v1/hosts`);
+            if (!response.ok) throw new Error(response.statusText);
+            hosts = await response.json();
+        } catch (e) {
+            // Not a controller
+            this.select('');
+            return;
+        }
+
+        select.innerHTML = '<option value="">Controller</option>' + hosts.map(host =>
+            `<option value="${host.name}" ${host.online ? '' : 'disabled'}>${host.name}${host.online ? '' : ' (offline)'}</option>`
+        ).join('');
+        select.value = hosts.some(h => h.name === this.current && h.online) ? this.current : '';
+        select.style.display = '';
+        this.select(select.value);
+
+        select.addEventListener('change', () => {
+            this.select(select.value);
+            window.wsManager.reset();
+            App.initPage(App.currentPage);
+            App.showToast(`Host: ${select.value || 'Controller'}`, 'info');
+        });
+    },
+
+    select(name) {
+        this.current = name;
+        if (name) {
+            localStorage.setItem('host', name);
+        } else {
+            localStorage.removeItem('host');
+        }
+    }
+};
@@ -38,8 +38,7 @@ const Packages = {
 
     async loadInstalled() {
         try {
-            const response = await fetch('/api/v1/packages');
-            this.installedPackages = await response.json() || [];
+            this.installedPackages = await App.fetchList('/api/v1/packages');
             this.render();
         } catch (error) {
             console.error('Failed to load packages:', error);
@@ -49,8 +48,7 @@ const Packages = {
 
     async search(query) {
         try {
-            const response = await fetch(`/api/v1/packages/search?q=${encodeURIComponent(query)}`);
-            this.searchResults = await response.json() || [];
+            this.searchResults = await App.fetchList(`/api/v1/packages/search?q=${encodeURIComponent(query)}`);
             this.activeTab = 'search-results';
             
             document.querySelectorAll('.tab').forEach(t => {
@@ -94,7 +92,7 @@ const Packages = {
     async install(name) {
         App.showToast(`Installing ${name}...`, 'info');
         try {
-            const response = await fetch('/api/v1/packages/install', {
+            const response = await fetch(Hosts.url('/api/v1/packages/install'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ name })
@@ -116,7 +114,7 @@ const Packages = {
         if (!confirm(`Remove ${name}?`)) return;
 
         try {
-            const response = await fetch(`/api/v1/packages/remove?name=${encodeURIComponent(name)}`, {
+            const response = await fetch(Hosts.url(`/api/v1/packages/remove?name=${encodeURIComponent(name)}`), {
                 method: 'DELETE'
             });
 
@@ -135,7 +133,7 @@ const Packages = {
     async update(name) {
         App.showToast(`Updating ${name}...`, 'info');
         try {
-            const response = await fetch('/api/v1/packages/update', {
+            const response = await fetch(Hosts.url('/api/v1/packages/update'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ name })
@@ -158,7 +156,7 @@ const Packages = {
 
         App.showToast('Upgrading all packages...', 'info');
         try {
-            const response = await fetch('/api/v1/packages/upgrade-all', { method: 'POST' });
+            const response = await fetch(Hosts.url('/api/v1/packages/upgrade-all'), { method: 'POST' });
 
             if (response.ok) {
                 App.showToast('All packages upgraded', 'success');
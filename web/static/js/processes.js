@@ -38,8 +38,7 @@ const Processes = {
 
     async load() {
         try {
-            const response = await fetch('/api/v1/processes');
-            this.processes = await response.json();
+            this.processes = await App.fetchList('/api/v1/processes');
             this.render();
         } catch (error) {
             console.error('Failed to load processes:', error);
@@ -97,7 +96,7 @@ const Processes = {
         if (!confirm(`Kill process ${pid}?`)) return;
 
         try {
-            const response = await fetch(`/api/v1/processes/${pid}/kill`, { method: 'POST' });
+            const response = await fetch(Hosts.url(`/api/v1/processes/${pid}/kill`), { method: 'POST' });
             if (response.ok) {
                 App.showToast('Process terminated', 'success');
                 this.load();
@@ -113,7 +112,7 @@ const Processes = {
 
     async showDetails(pid) {
         try {
-            const response = await fetch(`/api/v1/processes/${pid}`);
+            const response = await fetch(Hosts.url(`/api/v1/processes/${pid}`));
             const process = await response.json();
 
             const content = `
@@ -20,8 +20,7 @@ const Services = {
 
     async load() {
         try {
-            const response = await fetch('/api/v1/services');
-            this.services = await response.json();
+            this.services = await App.fetchList('/api/v1/services');
             this.render();
         } catch (error) {
             console.error('Failed to load services:', error);
@@ -65,7 +64,7 @@ const Services = {
 
     async start(name) {
         try {
-            const response = await fetch(`/api/v1/services/${name}/start`, { method: 'POST' });
+            const response = await fetch(Hosts.url(`/api/v1/services/${name}/start`), { method: 'POST' });
             if (response.ok) {
                 App.showToast(`Service ${name} started`, 'success');
                 this.load();
@@ -80,7 +79,7 @@ const Services = {
 
     async stop(name) {
         try {
-            const response = await fetch(`/api/v1/services/${name}/stop`, { method: 'POST' });
+            const response = await fetch(Hosts.url(`/api/v1/services/${name}/stop`), { method: 'POST' });
             if (response.ok) {
                 App.showToast(`Service ${name} stopped`, 'success');
                 this.load();
@@ -95,7 +94,7 @@ const Services = {
 
     async restart(name) {
         try {
-            const response = await fetch(`/api/v1/services/${name}/restart`, { method: 'POST' });
+            const response = await fetch(Hosts.url(`/api/v1/services/${name}/restart`), { method: 'POST' });
             if (response.ok) {
                 App.showToast(`Service ${name} restarted`, 'success');
                 this.load();
@@ -110,7 +109,7 @@ const Services = {
 
     async showLogs(name) {
         try {
-            const response = await fetch(`/api/v1/services/${name}/logs?lines=50`);
+            const response = await fetch(Hosts.url(`/api/v1/services/${name}/logs?lines=50`));
             const logs = await response.json();
 
             const content = `
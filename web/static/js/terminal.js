@@ -4,6 +4,7 @@ const TerminalManager = {
     activeTerminal: null,
     shells: [],
     terminalCounter: 0,
+    broadcast: false,
 
     init() {
         this.loadShells();
@@ -15,11 +16,15 @@ const TerminalManager = {
             const shell = document.getElementById('shell-select').value;
             this.createTerminal(shell);
         });
+
+        document.getElementById('btn-broadcast')?.addEventListener('click', () => {
+            this.toggleBroadcast();
+        });
     },
 
     async loadShells() {
         try {
-            const response = await fetch('/api/v1/terminal/shells');
+            const response = await fetch(Hosts.url('/api/v1/terminal/shells'));
             const data = await response.json();
             this.shells = data.shells || [];
 
@@ -33,12 +38,68 @@ const TerminalManager = {
                     select.value = data.default_shell;
                 }
             }
+
+            await this.loadMultiplexers();
+            await this.loadSerialDevices();
         } catch (error) {
             console.error('Failed to load shells:', error);
         }
     },
 
-    createTerminal(shell) {
+    // Offer host tmux/screen sessions next to the shells
+    async loadMultiplexers() {
+        const select = document.getElementById('shell-select');
+        if (!select) return;
+
+        const response = await fetch(Hosts.url('/api/v1/terminal/multiplexers'));
+        if (!response.ok) return;
+
+        const sessions = await response.json();
+        sessions.forEach(session => {
+            const option = document.createElement('option');
+            option.value = `attach:${session.type}:${session.name}`;
+            option.textContent = `${session.type}: ${session.name}${session.attached ? ' (attached)' : ''}`;
+            select.appendChild(option);
+        });
+    },
+
+    // Open a new terminal in the given directory (used by the file manager)
+    openHere(path) {
+        App.navigateTo('terminal');
+        const shell = document.getElementById('shell-select')?.value || '';
+        this.createTerminal(shell, path);
+    },
+
+    // Offer serial consoles next to the shells
+    async loadSerialDevices() {
+        const select = document.getElementById('shell-select');
+        if (!select) return;
+
+        const response = await fetch(Hosts.url('/api/v1/terminal/serial'));
+        if (!response.ok) return;
+
+        const devices = await response.json();
+        devices.forEach(device => {
+            const option = document.createElement('option');
+            option.value = `serial:${device}`;
+            option.textContent = `serial: ${device}`;
+            select.appendChild(option);
+        });
+    },
+
+    // Build the query parameters selecting what the session runs
+    sessionTarget(shell) {
+        if (shell.startsWith('attach:')) {
+            return `attach=${encodeURIComponent(shell.slice('attach:'.length))}`;
+        }
+        if (shell.startsWith('serial:')) {
+            const baud = document.getElementById('serial-baud')?.value || '115200';
+            return `serial=${encodeURIComponent(shell.slice('serial:'.length))}&baud=${baud}`;
+        }
+        return `shell=${encodeURIComponent(shell)}`;
+    },
+
+    async createTerminal(shell, cwd = '') {
         const id = `term-${++this.terminalCounter}`;
 
         // Create tab
@@ -102,8 +163,9 @@ const TerminalManager = {
         fitAddon.fit();
 
         // Connect WebSocket
-        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${protocol}//${window.location.host}/ws/terminal?session=${id}&shell=${encodeURIComponent(shell)}`;
+        const target = this.sessionTarget(shell);
+        const ticket = await Hosts.ticket();
+        const wsUrl = `${Hosts.wsUrl('/ws/terminal')}?session=${id}&${target}&cols=${term.cols}&rows=${term.rows}${cwd ? `&cwd=${encodeURIComponent(cwd)}` : ''}${ticket ? `&ticket=${ticket}` : ''}`;
         const ws = new WebSocket(wsUrl);
 
         ws.binaryType = 'arraybuffer';
@@ -119,10 +181,12 @@ const TerminalManager = {
             }));
         };
 
+        const transfer = this.createTransferBridge(term, ws);
+
         ws.onmessage = (event) => {
             if (event.data instanceof ArrayBuffer) {
-                term.write(new Uint8Array(event.data));
-            } else {
+                transfer.output(event.data);
+            } else if (!this.handleControlMessage(event.data, term, ws, transfer)) {
                 term.write(event.data);
             }
         };
@@ -139,7 +203,7 @@ const TerminalManager = {
         // Handle input
         term.onData((data) => {
             if (ws.readyState === WebSocket.OPEN) {
-                ws.send(data);
+                transfer.input(data);
             }
         });
 
@@ -173,6 +237,121 @@ const TerminalManager = {
         });
     },
 
+    // Handle JSON control messages sent by the server, returns true if consumed
+    handleControlMessage(data, term, ws, transfer) {
+        let msg;
+        try {
+            msg = JSON.parse(data);
+        } catch (e) {
+            return false;
+        }
+        if (!msg || msg.type !== 'transfer') {
+            return false;
+        }
+
+        if (!transfer.supports(msg.protocol)) {
+            term.write(`\r\n\x1b[33m[${msg.protocol} ${msg.direction} not supported by this browser, cancelling]\x1b[0m\r\n`);
+            ws.send(JSON.stringify({ type: 'transfer_cancel', protocol: msg.protocol }));
+        }
+        return true;
+    },
+
+    // Route terminal I/O through zmodem.js / trzsz.js when they are loaded,
+    // so rz/sz and trz/tsz become browser uploads and downloads
+    createTransferBridge(term, ws) {
+        const send = (data) => ws.send(data);
+        const protocols = [];
+        let toTerminal = (data) => term.write(typeof data === 'string' ? data : new Uint8Array(data));
+        let input = send;
+
+        // Output ZMODEM leaves alone goes through trzsz on its way to the terminal
+        if (window.TrzszFilter) {
+            const filter = new TrzszFilter({
+                writeToTerminal: toTerminal,
+                sendToServer: send,
+                terminalColumns: term.cols
+            });
+            term.onResize(({ cols }) => filter.setTerminalColumns(cols));
+            toTerminal = (data) => filter.processServerOutput(data);
+            input = (data) => filter.processTerminalInput(data);
+            protocols.push('trzsz');
+        }
+
+        let output = toTerminal;
+        if (window.Zmodem) {
+            const sentry = new Zmodem.Sentry({
+                to_terminal: (octets) => toTerminal(new Uint8Array(octets)),
+                sender: (octets) => send(new Uint8Array(octets)),
+                on_retract: () => {},
+                on_detect: (detection) => this.startZmodem(detection.confirm())
+            });
+            output = (data) => sentry.consume(data);
+            protocols.push('zmodem');
+        }
+
+        return {
+            supports: (protocol) => protocols.includes(protocol),
+            output,
+            input
+        };
+    },
+
+    startZmodem(session) {
+        if (session.type === 'receive') {
+            // Remote ran sz: save offered files in the browser
+            session.on('offer', (xfer) => {
+                const chunks = [];
+                xfer.on('input', (payload) => chunks.push(new Uint8Array(payload)));
+                xfer.accept().then(() => Zmodem.Browser.save_to_disk(chunks, xfer.get_details().name));
+            });
+            session.start();
+            return;
+        }
+
+        // Remote ran rz: let the user pick files to send
+        const input = document.createElement('input');
+        input.type = 'file';
+        input.multiple = true;
+        input.onchange = () => {
+            Zmodem.Browser.send_files(session, input.files).then(() => session.close());
+        };
+        input.click();
+    },
+
+    // Link all open terminals so keystrokes are mirrored to every one of them
+    async toggleBroadcast() {
+        const enable = !this.broadcast;
+        const sessions = enable ? Array.from(this.terminals.keys()) : [];
+
+        if (enable && sessions.length < 2) {
+            App.showToast('Open at least two terminals to broadcast input', 'error');
+            return;
+        }
+
+        try {
+            const response = await fetch(Hosts.url('/api/v1/terminal/broadcast'), {
+                method: enable ? 'PUT' : 'DELETE',
+                headers: { 'Content-Type': 'application/json' },
+                body: enable ? JSON.stringify({ sessions }) : undefined
+            });
+            if (!response.ok) {
+                const data = await response.json();
+                throw new Error(data.error);
+            }
+            this.setBroadcast(enable ? sessions : []);
+        } catch (error) {
+            App.showToast(`Broadcast failed: ${error.message}`, 'error');
+        }
+    },
+
+    setBroadcast(sessions) {
+        this.broadcast = sessions.length > 0;
+        document.getElementById('btn-broadcast')?.classList.toggle('active', this.broadcast);
+        this.terminals.forEach((terminal, id) => {
+            terminal.tab.classList.toggle('linked', sessions.includes(id));
+        });
+    },
+
     activateTerminal(id) {
         // Deactivate all
         this.terminals.forEach((terminal, termId) => {
@@ -200,6 +379,14 @@ const TerminalManager = {
             document.getElementById(id).remove();
             this.terminals.delete(id);
 
+            // The server dissolves the group once fewer than two sessions remain
+            if (this.broadcast) {
+                const linked = Array.from(this.terminals.values()).filter(t => t.tab.classList.contains('linked'));
+                if (linked.length < 2) {
+                    this.setBroadcast([]);
+                }
+            }
+
             // Activate another terminal if exists
             if (this.terminals.size > 0) {
                 const firstId = this.terminals.keys().next().value;
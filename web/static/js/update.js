@@ -17,7 +17,7 @@ const UpdateManager = {
 
     async loadCurrentVersion() {
         try {
-            const response = await fetch('/api/v1/version');
+            const response = await fetch(Hosts.url('/api/v1/version'));
             const data = await response.json();
             
             this.currentVersion = data;
@@ -56,7 +56,7 @@ const UpdateManager = {
         availableCard.style.display = 'none';
         
         try {
-            const response = await fetch('/api/v1/update/check');
+            const response = await fetch(Hosts.url('/api/v1/update/check'));
             const data = await response.json();
             
             // Save last check time
@@ -148,7 +148,7 @@ const UpdateManager = {
         }, 500);
         
         try {
-            const response = await fetch('/api/v1/update/apply', {
+            const response = await fetch(Hosts.url('/api/v1/update/apply'), {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ version: this.availableUpdate.latest_version })
@@ -189,7 +189,7 @@ const UpdateManager = {
             progressText.textContent = `Attesa riavvio server... (${attempts}/${maxAttempts})`;
             
             try {
-                const response = await fetch('/api/v1/version', { 
+                const response = await fetch(Hosts.url('/api/v1/version'), { 
                     cache: 'no-store',
                     signal: AbortSignal.timeout(2000)
                 });
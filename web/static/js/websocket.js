@@ -6,18 +6,45 @@ class WebSocketManager {
         this.reconnectAttempts = 0;
         this.maxReconnectAttempts = 5;
         this.reconnectDelay = 1000;
+        // Sequence number of the last message, sent as resume on reconnect
+        this.lastSeq = 0;
     }
 
-    connect() {
-        const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const url = `${protocol}//${window.location.host}/ws/metrics`;
+    // Message types sent by the server itself rather than topics
+    static controlTypes = new Set(['subscribed', 'error', 'gap']);
 
-        this.ws = new WebSocket(url);
+    topics() {
+        return [...this.listeners.keys()].filter(t => !WebSocketManager.controlTypes.has(t));
+    }
+
+    async connect() {
+        const params = new URLSearchParams();
+
+        // Resume where the last connection stopped so charts have no gaps
+        const topics = this.topics();
+        if (this.lastSeq > 0 && topics.length > 0) {
+            params.set('topics', topics.join(','));
+            params.set('resume', this.lastSeq);
+        }
+
+        const ticket = await Hosts.ticket();
+        if (ticket) {
+            params.set('ticket', ticket);
+        }
+
+        const query = params.toString();
+        this.ws = new WebSocket(Hosts.wsUrl('/ws') + (query ? `?${query}` : ''));
 
         this.ws.onopen = () => {
             console.log('WebSocket connected');
             this.reconnectAttempts = 0;
             this.updateStatus(true);
+
+            // Subscribe to every topic with listeners, also after a reconnect
+            const topics = this.topics();
+            if (topics.length > 0) {
+                this.send('subscribe', { topics });
+            }
         };
 
         this.ws.onclose = () => {
@@ -40,6 +67,18 @@ class WebSocketManager {
         };
     }
 
+    // Connect again from scratch, e.g. to another host whose sequence
+    // numbers are unrelated to the ones seen so far
+    reset() {
+        if (this.ws) {
+            this.ws.onclose = null;
+            this.ws.close();
+        }
+        this.lastSeq = 0;
+        this.reconnectAttempts = 0;
+        this.connect();
+    }
+
     reconnect() {
         if (this.reconnectAttempts >= this.maxReconnectAttempts) {
             console.log('Max reconnect attempts reached');
@@ -66,6 +105,10 @@ class WebSocketManager {
         const type = data.type;
         const payload = data.payload;
 
+        if (data.seq) {
+            this.lastSeq = data.seq;
+        }
+
         if (this.listeners.has(type)) {
             this.listeners.get(type).forEach(callback => {
                 callback(payload);
@@ -73,9 +116,13 @@ class WebSocketManager {
         }
     }
 
+    // Listening to a topic subscribes to it on the server
     on(type, callback) {
         if (!this.listeners.has(type)) {
             this.listeners.set(type, []);
+            if (!WebSocketManager.controlTypes.has(type)) {
+                this.send('subscribe', { topics: [type] });
+            }
         }
         this.listeners.get(type).push(callback);
     }
@@ -87,6 +134,12 @@ class WebSocketManager {
             if (index > -1) {
                 callbacks.splice(index, 1);
             }
+            if (callbacks.length === 0) {
+                this.listeners.delete(type);
+                if (!WebSocketManager.controlTypes.has(type)) {
+                    this.send('unsubscribe', { topics: [type] });
+                }
+            }
         }
     }
 